@@ -2,15 +2,30 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"path"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/destination"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/ingest"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/middleware"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/queue"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/scheduler"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/upload"
 	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -94,8 +109,10 @@ func (api *API) login(c *gin.Context) {
 
 func (api *API) initiateUpload(c *gin.Context) {
 	var req struct {
-		Filename  string `json:"filename" binding:"required"`
-		TotalSize int64  `json:"total_size" binding:"required"`
+		Filename    string `json:"filename" binding:"required"`
+		TotalSize   int64  `json:"total_size" binding:"required"`
+		Mode        string `json:"mode"` // proxy (default) or direct
+		ContentType string `json:"content_type"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -103,7 +120,17 @@ func (api *API) initiateUpload(c *gin.Context) {
 		return
 	}
 
-	upload, err := api.uploadService.InitiateUpload(req.Filename, req.TotalSize)
+	switch req.Mode {
+	case "", upload.UploadModeProxy:
+	case upload.UploadModeDirect:
+		api.initiateDirectUpload(c, req.Filename, req.TotalSize, req.ContentType)
+		return
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown upload mode: %s", req.Mode)})
+		return
+	}
+
+	upload, err := api.uploadService.InitiateUpload(c.Request.Context(), req.Filename, req.TotalSize)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -129,7 +156,17 @@ func (api *API) uploadPart(c *gin.Context) {
 		return
 	}
 
-	part, err := api.uploadService.UploadPart(uploadID, partNumber, bytes.NewReader(body))
+	sums, err := partChecksums(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	part, err := api.uploadService.UploadPart(c.Request.Context(), uploadID, partNumber, bytes.NewReader(body), int64(len(body)), sums)
+	if errors.Is(err, upload.ErrChecksumMismatch) || errors.Is(err, upload.ErrPartSize) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -138,38 +175,174 @@ func (api *API) uploadPart(c *gin.Context) {
 	c.JSON(http.StatusOK, part)
 }
 
+// partChecksums decodes the base64 Content-MD5 and X-Checksum-SHA256 headers
+// a part may be sent with
+func partChecksums(c *gin.Context) (upload.PartChecksums, error) {
+	var sums upload.PartChecksums
+	var err error
+
+	if header := c.GetHeader("Content-MD5"); header != "" {
+		if sums.MD5, err = base64.StdEncoding.DecodeString(header); err != nil {
+			return sums, fmt.Errorf("invalid Content-MD5 header")
+		}
+	}
+	if header := c.GetHeader("X-Checksum-SHA256"); header != "" {
+		if sums.SHA256, err = base64.StdEncoding.DecodeString(header); err != nil {
+			return sums, fmt.Errorf("invalid X-Checksum-SHA256 header")
+		}
+	}
+
+	return sums, nil
+}
+
 func (api *API) completeUpload(c *gin.Context) {
 	uploadID := c.Param("upload_id")
 
-	filePath, err := api.uploadService.CompleteUpload(uploadID)
+	if existing, err := api.uploadService.GetUpload(c.Request.Context(), uploadID); err == nil && existing.Mode == upload.UploadModeDirect {
+		api.completeDirectUpload(c, uploadID)
+		return
+	}
+
+	// The client may send the SHA-256 of the whole file to verify it
+	var req struct {
+		Checksum string `json:"checksum"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	completed, err := api.uploadService.CompleteUpload(c.Request.Context(), uploadID, req.Checksum)
+	if errors.Is(err, upload.ErrChecksumMismatch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Extract video metadata
-	videoInfo, err := api.ffmpeg.ExtractVideoInfo(c.Request.Context(), filePath)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to extract metadata: %v", err)})
+	// Create video record
+	video := &models.Video{
+		ID:          completed.VideoID,
+		Filename:    completed.Filename,
+		OriginalURL: completed.StorageKey,
+		Size:        completed.TotalSize,
+		Checksum:    completed.Checksum,
+		Status:      models.VideoStatusPending,
+		Metadata:    models.Metadata{},
+	}
+
+	// Get user ID from context
+	if userID, exists := middleware.GetUserID(c); exists {
+		video.UserID = &userID
+	}
+
+	// Save to database
+	if err := api.repo.CreateVideo(c.Request.Context(), video); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create video: %v", err)})
+		return
+	}
+
+	// The assembled file is in storage, so it is probed like direct uploads
+	go api.preflightVideo(video)
+
+	c.JSON(http.StatusCreated, video)
+}
+
+// initiateDirectUpload starts an upload whose parts the client PUTs straight to
+// object storage, returning presigned URLs for every part
+func (api *API) initiateDirectUpload(c *gin.Context, filename string, totalSize int64, contentType string) {
+	if !api.uploadService.DirectUploadsEnabled() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Direct uploads are not supported by the storage driver"})
 		return
 	}
 
-	// Get upload info
-	upload, err := api.uploadService.GetUpload(uploadID)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	directUpload, partURLs, err := api.uploadService.InitiateDirectUpload(c.Request.Context(), filename, totalSize, contentType)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Create video record
+	c.JSON(http.StatusCreated, struct {
+		*models.MultipartUpload
+		PartURLs []upload.PartURL `json:"part_urls"`
+	}{directUpload, partURLs})
+}
+
+// getUploadPartURL presigns a fresh URL for a part of a direct upload
+func (api *API) getUploadPartURL(c *gin.Context) {
+	partNumber, err := strconv.Atoi(c.Param("part_number"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid part number"})
+		return
+	}
+
+	partURL, err := api.uploadService.PresignPart(c.Request.Context(), c.Param("upload_id"), partNumber)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, partURL)
+}
+
+// completeDirectUpload assembles a direct upload in storage, creates its video
+// and probes it in the background
+func (api *API) completeDirectUpload(c *gin.Context, uploadID string) {
+	directUpload, err := api.uploadService.CompleteDirectUpload(c.Request.Context(), uploadID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	video := &models.Video{
-		ID:       uuid.New().String(),
-		Filename: upload.Filename,
-		Size:     upload.TotalSize,
-		Status:   models.VideoStatusPending,
+		ID:          directUpload.VideoID,
+		Filename:    directUpload.Filename,
+		OriginalURL: directUpload.StorageKey,
+		Size:        directUpload.TotalSize,
+		Status:      models.VideoStatusPending,
+		Metadata:    models.Metadata{},
+	}
+
+	if userID, exists := middleware.GetUserID(c); exists {
+		video.UserID = &userID
+	}
+
+	if err := api.repo.CreateVideo(c.Request.Context(), video); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create video: %v", err)})
+		return
+	}
+
+	go api.preflightVideo(video)
+
+	c.JSON(http.StatusCreated, video)
+}
+
+// preflightVideo probes a video uploaded straight to storage through a
+// presigned URL, without downloading it to the API host, and records its
+// metadata. Videos that cannot be probed are marked failed.
+func (api *API) preflightVideo(video *models.Video) {
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+
+	videoInfo, err := api.probeStoredVideo(ctx, video.OriginalURL)
+	if err != nil {
+		log.Printf("Preflight of video %s failed: %v", video.ID, err)
+		video.Status = models.VideoStatusFailed
+		video.Metadata["preflight_error"] = err.Error()
+		if err := api.repo.UpdateVideo(ctx, video); err != nil {
+			log.Printf("Failed to update video %s: %v", video.ID, err)
+		}
+		return
 	}
 
-	// Copy metadata
 	video.Duration = videoInfo.Duration
 	video.Width = videoInfo.Width
 	video.Height = videoInfo.Height
@@ -178,38 +351,84 @@ func (api *API) completeUpload(c *gin.Context) {
 	video.FrameRate = videoInfo.FrameRate
 	video.Metadata = videoInfo.Metadata
 
-	// Upload to storage
-	storageKey := fmt.Sprintf("videos/%s/original/%s", video.ID, upload.Filename)
-	if err := api.storage.UploadFile(c.Request.Context(), storageKey, filePath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to upload: %v", err)})
+	if err := api.repo.UpdateVideo(ctx, video); err != nil {
+		log.Printf("Failed to update video %s: %v", video.ID, err)
 		return
 	}
 
-	video.OriginalURL = storageKey
+	if api.webhookService != nil {
+		_ = api.webhookService.NotifyVideoUploaded(ctx, video)
+	}
 
-	// Get user ID from context
-	if userID, exists := middleware.GetUserID(c); exists {
-		video.UserID = &userID
+	if video.Checksum == "" {
+		api.hashStoredVideo(video)
 	}
+}
 
-	// Save to database
-	if err := api.repo.CreateVideo(c.Request.Context(), video); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create video: %v", err)})
+// hashStoredVideo records the checksum of a video whose bytes never passed
+// through the API, streaming its original from storage
+func (api *API) hashStoredVideo(video *models.Video) {
+	ctx, cancel := context.WithTimeout(context.Background(), checksumTimeout)
+	defer cancel()
+
+	checksum, err := storage.Checksum(ctx, api.storage, video.OriginalURL)
+	if err != nil {
+		log.Printf("Failed to hash video %s: %v", video.ID, err)
 		return
 	}
 
-	// Send webhook notification
-	if api.webhookService != nil {
-		_ = api.webhookService.NotifyVideoUploaded(c.Request.Context(), video)
+	video.Checksum = checksum
+	if err := api.repo.SetVideoChecksum(ctx, video); err != nil {
+		log.Printf("Failed to record checksum of video %s: %v", video.ID, err)
 	}
+}
 
-	c.JSON(http.StatusCreated, video)
+// completeTusUpload creates the video of a completed tus upload and starts its
+// preflight. Retries of an upload whose video exists are no-ops.
+func (api *API) completeTusUpload(ctx context.Context, tusUpload *models.TusUpload) error {
+	if _, err := api.repo.GetVideo(ctx, tusUpload.VideoID); err == nil {
+		return nil
+	}
+
+	filename := tusUpload.Metadata["filename"]
+	if filename == "" {
+		filename = path.Base(tusUpload.StorageKey)
+	}
+
+	video := &models.Video{
+		ID:          tusUpload.VideoID,
+		UserID:      tusUpload.UserID,
+		Filename:    filename,
+		OriginalURL: tusUpload.StorageKey,
+		Size:        tusUpload.Length,
+		Checksum:    tusUpload.Checksum,
+		Status:      models.VideoStatusPending,
+		Metadata:    models.Metadata{},
+	}
+
+	if err := api.repo.CreateVideo(ctx, video); err != nil {
+		return err
+	}
+
+	go api.preflightVideo(video)
+
+	return nil
+}
+
+// probeStoredVideo extracts the metadata of a stored video
+func (api *API) probeStoredVideo(ctx context.Context, key string) (*models.Video, error) {
+	url, err := storage.GetURL(ctx, api.storage, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return api.ffmpeg.ExtractVideoInfo(ctx, url)
 }
 
 func (api *API) abortUpload(c *gin.Context) {
 	uploadID := c.Param("upload_id")
 
-	if err := api.uploadService.AbortUpload(uploadID); err != nil {
+	if err := api.uploadService.AbortUpload(c.Request.Context(), uploadID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -220,7 +439,7 @@ func (api *API) abortUpload(c *gin.Context) {
 func (api *API) getUploadStatus(c *gin.Context) {
 	uploadID := c.Param("upload_id")
 
-	upload, err := api.uploadService.GetUpload(uploadID)
+	upload, err := api.uploadService.GetUpload(c.Request.Context(), uploadID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
 		return
@@ -306,58 +525,1043 @@ func (api *API) resumeJob(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Job resumed"})
 }
 
-// Monitoring handlers
+// Recurring job handlers
 
-func (api *API) getMetrics(c *gin.Context) {
-	if api.monitor == nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Monitoring not available"})
+func (api *API) createRecurringJob(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	metrics := api.monitor.GetMetrics()
-	c.JSON(http.StatusOK, metrics)
+	var req struct {
+		Name         string `json:"name" binding:"required"`
+		VideoID      string `json:"video_id" binding:"required"`
+		Schedule     string `json:"schedule" binding:"required"`
+		Timezone     string `json:"timezone"`
+		Resolution   string `json:"resolution" binding:"required"`
+		OutputFormat string `json:"output_format"`
+		Codec        string `json:"codec"`
+		Bitrate      int64  `json:"bitrate"`
+		Preset       string `json:"preset"`
+		Priority     int    `json:"priority"`
+
+		Requirements models.JobRequirements `json:"requirements"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+
+	nextRunAt, err := scheduler.NextRun(req.Schedule, req.Timezone, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Check video exists
+	if _, err := api.repo.GetVideo(c.Request.Context(), req.VideoID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Video not found"})
+		return
+	}
+
+	rj := &models.RecurringJob{
+		UserID:   &userID,
+		VideoID:  req.VideoID,
+		Name:     req.Name,
+		Schedule: req.Schedule,
+		Timezone: req.Timezone,
+		Priority: req.Priority,
+		Config: models.TranscodeConfig{
+			OutputFormat: req.OutputFormat,
+			Resolution:   req.Resolution,
+			Codec:        req.Codec,
+			Bitrate:      req.Bitrate,
+			Preset:       req.Preset,
+			AudioCodec:   "aac",
+			AudioBitrate: 128,
+		},
+		Requirements: req.Requirements,
+		Enabled:      true,
+		NextRunAt:    nextRunAt,
+	}
+
+	if rj.Priority == 0 {
+		rj.Priority = models.JobPriorityNormal
+	}
+
+	if err := api.repo.CreateRecurringJob(c.Request.Context(), rj); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rj)
 }
 
-func (api *API) getWorkerHealth(c *gin.Context) {
-	if api.monitor == nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Monitoring not available"})
+func (api *API) listRecurringJobs(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	workers := api.monitor.GetWorkerHealth()
-	c.JSON(http.StatusOK, gin.H{"workers": workers})
+	jobs, err := api.repo.ListRecurringJobs(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recurring_jobs": jobs, "count": len(jobs)})
 }
 
-func (api *API) getSystemHealth(c *gin.Context) {
-	if api.monitor == nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Monitoring not available"})
+func (api *API) getRecurringJob(c *gin.Context) {
+	rj, ok := api.ownedRecurringJob(c)
+	if !ok {
 		return
 	}
 
-	health := api.monitor.GetSystemHealth()
-	alerts := api.monitor.GetAlerts()
+	c.JSON(http.StatusOK, rj)
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"status": health,
-		"alerts": alerts,
-	})
+func (api *API) pauseRecurringJob(c *gin.Context) {
+	rj, ok := api.ownedRecurringJob(c)
+	if !ok {
+		return
+	}
+
+	if err := api.repo.SetRecurringJobEnabled(c.Request.Context(), rj.ID, false, rj.NextRunAt); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recurring job paused"})
 }
 
-func (api *API) getQueueStats(c *gin.Context) {
-	queueDepth, err := api.queue.GetQueueDepth()
+func (api *API) resumeRecurringJob(c *gin.Context) {
+	rj, ok := api.ownedRecurringJob(c)
+	if !ok {
+		return
+	}
+
+	// Runs missed while paused are skipped
+	nextRunAt, err := scheduler.NextRun(rj.Schedule, rj.Timezone, time.Now())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get queue depth"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	dlqDepth, err := api.queue.GetDLQDepth()
+	if err := api.repo.SetRecurringJobEnabled(c.Request.Context(), rj.ID, true, nextRunAt); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recurring job resumed", "next_run_at": nextRunAt})
+}
+
+func (api *API) deleteRecurringJob(c *gin.Context) {
+	rj, ok := api.ownedRecurringJob(c)
+	if !ok {
+		return
+	}
+
+	if err := api.repo.DeleteRecurringJob(c.Request.Context(), rj.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recurring job deleted"})
+}
+
+// ownedRecurringJob loads the recurring job named in the path and checks the
+// caller owns it, writing the error response when not
+func (api *API) ownedRecurringJob(c *gin.Context) (*models.RecurringJob, bool) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	rj, err := api.repo.GetRecurringJob(c.Request.Context(), c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get DLQ depth"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recurring job not found"})
+		return nil, false
+	}
+
+	if rj.UserID == nil || *rj.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return nil, false
+	}
+
+	return rj, true
+}
+
+// Batch handlers
+
+func (api *API) createBatch(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"queue_depth": queueDepth,
-		"dlq_depth":   dlqDepth,
-	})
+	var req struct {
+		Name string `json:"name" binding:"required"`
+		Jobs []struct {
+			Ref          string     `json:"ref"` // name later jobs use in depends_on
+			VideoID      string     `json:"video_id" binding:"required"`
+			Resolution   string     `json:"resolution" binding:"required"`
+			OutputFormat string     `json:"output_format"`
+			Codec        string     `json:"codec"`
+			Bitrate      int64      `json:"bitrate"`
+			Preset       string     `json:"preset"`
+			Priority     int        `json:"priority"`
+			RunAt        *time.Time `json:"run_at"`
+			DependsOn    []string   `json:"depends_on"` // refs of earlier jobs in the batch, or existing job IDs
+			Destinations []string   `json:"destinations"`
+
+			Requirements models.JobRequirements `json:"requirements"`
+		} `json:"jobs" binding:"required,min=1,max=1000,dive"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	videos := make(map[string]*models.Video)
+	refs := make(map[string]string) // ref -> job ID
+	jobs := make([]*models.Job, 0, len(req.Jobs))
+
+	for i, item := range req.Jobs {
+		video, ok := videos[item.VideoID]
+		if !ok {
+			var err error
+			if video, err = api.repo.GetVideo(ctx, item.VideoID); err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("jobs[%d]: video not found", i)})
+				return
+			}
+			if video.OriginalURL == "" {
+				c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("jobs[%d]: %s", i, errSourceDeleted)})
+				return
+			}
+			videos[item.VideoID] = video
+		}
+
+		job := &models.Job{
+			ID:       uuid.New().String(),
+			VideoID:  item.VideoID,
+			UserID:   &userID,
+			Status:   models.JobStatusPending,
+			Priority: item.Priority,
+			Config: models.TranscodeConfig{
+				OutputFormat: item.OutputFormat,
+				Resolution:   item.Resolution,
+				Codec:        item.Codec,
+				Bitrate:      item.Bitrate,
+				Preset:       item.Preset,
+				AudioCodec:   "aac",
+				AudioBitrate: 128,
+			},
+			Requirements: item.Requirements,
+		}
+
+		if job.Priority == 0 {
+			job.Priority = models.JobPriorityNormal
+		}
+		if item.RunAt != nil && item.RunAt.After(time.Now()) {
+			runAt := item.RunAt.UTC()
+			job.RunAt = &runAt
+		}
+		job.PrepareRouting(video)
+
+		// Only earlier jobs can be referenced, so dependencies never form a cycle
+		var external []string
+		for _, dep := range item.DependsOn {
+			if id, ok := refs[dep]; ok {
+				job.DependsOn = append(job.DependsOn, id)
+			} else {
+				external = append(external, dep)
+			}
+		}
+		if len(external) > 0 {
+			if err := api.checkDependencies(c, job.UserID, external); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("jobs[%d]: %v", i, err)})
+				return
+			}
+			job.DependsOn = append(job.DependsOn, external...)
+		}
+
+		if len(item.Destinations) > 0 {
+			if err := api.checkDestinations(c, job.UserID, item.Destinations); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("jobs[%d]: %v", i, err)})
+				return
+			}
+			job.Config.Destinations = item.Destinations
+		}
+
+		if item.Ref != "" {
+			if _, dup := refs[item.Ref]; dup {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("jobs[%d]: duplicate ref %q", i, item.Ref)})
+				return
+			}
+			refs[item.Ref] = job.ID
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	batch := &models.Batch{
+		UserID: &userID,
+		Name:   req.Name,
+	}
+
+	if err := api.repo.CreateBatch(ctx, batch, jobs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create batch: %v", err)})
+		return
+	}
+
+	// Jobs with dependencies are picked up once those complete
+	if api.scheduler != nil {
+		for _, job := range jobs {
+			if err := api.scheduler.ScheduleJob(job); err != nil {
+				log.Printf("Failed to schedule job %s: %v", job.ID, err)
+			}
+		}
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"batch": batch, "jobs": jobs})
+}
+
+func (api *API) getBatch(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	batch, err := api.repo.GetBatch(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Batch not found"})
+		return
+	}
+
+	if batch.UserID == nil || *batch.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	jobs, err := api.repo.GetBatchJobs(c.Request.Context(), batch.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"batch": batch, "jobs": jobs})
+}
+
+// checkDependencies verifies that the jobs a new job depends on exist and
+// belong to the same user
+func (api *API) checkDependencies(c *gin.Context, userID *string, jobIDs []string) error {
+	for _, jobID := range jobIDs {
+		dep, err := api.repo.GetJob(c.Request.Context(), jobID)
+		if err != nil {
+			return fmt.Errorf("dependency %s not found", jobID)
+		}
+		if (dep.UserID == nil) != (userID == nil) || (userID != nil && *dep.UserID != *userID) {
+			return fmt.Errorf("dependency %s not found", jobID)
+		}
+	}
+	return nil
+}
+
+// Import handlers
+
+// importVideo creates an import of a video at an HTTP(S) URL or s3:// URI,
+// fetched by a worker, and the jobs to run once it is imported
+func (api *API) importVideo(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req struct {
+		URL      string `json:"url" binding:"required"`
+		Filename string `json:"filename"`
+		Checksum string `json:"checksum"` // expected hex SHA-256
+		Priority int    `json:"priority"`
+		Jobs     []struct {
+			Resolution   string   `json:"resolution" binding:"required"`
+			OutputFormat string   `json:"output_format"`
+			Codec        string   `json:"codec"`
+			Bitrate      int64    `json:"bitrate"`
+			Preset       string   `json:"preset"`
+			Destinations []string `json:"destinations"`
+		} `json:"jobs" binding:"max=100,dive"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ingest.ValidateURL(req.URL, api.ingestConfig.AllowedBuckets); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Checksum != "" {
+		if sum, err := hex.DecodeString(req.Checksum); err != nil || len(sum) != sha256.Size {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "checksum must be a hex SHA-256"})
+			return
+		}
+	}
+
+	filename := path.Base(req.Filename)
+	if req.Filename == "" || filename == "." || filename == "/" {
+		filename = ingest.Filename(req.URL)
+	}
+
+	imp := &models.Import{
+		ID:               uuid.New().String(),
+		UserID:           &userID,
+		SourceURL:        req.URL,
+		Filename:         filename,
+		ExpectedChecksum: strings.ToLower(req.Checksum),
+		Priority:         req.Priority,
+		Jobs:             make([]models.TranscodeConfig, 0, len(req.Jobs)),
+		Status:           models.ImportStatusPending,
+		VideoID:          uuid.New().String(),
+	}
+	for i, item := range req.Jobs {
+		if err := api.checkDestinations(c, &userID, item.Destinations); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("jobs[%d]: %v", i, err)})
+			return
+		}
+		imp.Jobs = append(imp.Jobs, models.TranscodeConfig{
+			OutputFormat: item.OutputFormat,
+			Resolution:   item.Resolution,
+			Codec:        item.Codec,
+			Bitrate:      item.Bitrate,
+			Preset:       item.Preset,
+			AudioCodec:   "aac",
+			AudioBitrate: 128,
+			Destinations: item.Destinations,
+		})
+	}
+
+	if _, err := api.repo.CreateImport(c.Request.Context(), imp); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create import: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, imp)
+}
+
+func (api *API) getImport(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	imp, err := api.repo.GetImport(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+		return
+	}
+
+	if imp.UserID == nil || *imp.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	c.JSON(http.StatusOK, imp)
+}
+
+// Destination handlers
+
+// destinationRequest creates or replaces an output destination. Credentials
+// are only accepted, never returned.
+type destinationRequest struct {
+	Name            string `json:"name" binding:"required"`
+	Type            string `json:"type" binding:"required"`
+	Endpoint        string `json:"endpoint"`
+	Region          string `json:"region"`
+	Bucket          string `json:"bucket"`
+	UseSSL          *bool  `json:"use_ssl"`
+	Path            string `json:"path"`
+	KeyTemplate     string `json:"key_template"`
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+}
+
+// applyDestination validates req onto dest and seals its credentials, keeping
+// the sealed credentials dest already has when req has none. It writes the
+// response and returns false on failure.
+func (api *API) applyDestination(c *gin.Context, dest *models.OutputDestination, req *destinationRequest) bool {
+	dest.Name = req.Name
+	dest.Type = req.Type
+	dest.Endpoint = req.Endpoint
+	dest.Region = req.Region
+	dest.Bucket = req.Bucket
+	dest.UseSSL = req.UseSSL == nil || *req.UseSSL
+	dest.Path = req.Path
+	dest.KeyTemplate = req.KeyTemplate
+
+	if err := destination.Validate(dest, api.destinationsConfig); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	if dest.Type != models.DestinationTypeS3 {
+		dest.Credentials = nil
+		return true
+	}
+
+	if req.AccessKeyID == "" && req.SecretAccessKey == "" {
+		if len(dest.Credentials) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "access_key_id and secret_access_key are required"})
+			return false
+		}
+		return true
+	}
+	if req.AccessKeyID == "" || req.SecretAccessKey == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "access_key_id and secret_access_key are required"})
+		return false
+	}
+
+	sealed, err := api.destinationCipher.Seal(dest.ID, models.DestinationCredentials{
+		AccessKeyID:     req.AccessKeyID,
+		SecretAccessKey: req.SecretAccessKey,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	dest.Credentials = sealed
+	return true
+}
+
+func (api *API) createDestination(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if api.destinationCipher == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Output destinations are not configured"})
+		return
+	}
+
+	var req destinationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The ID is assigned up front as the credentials are sealed to it
+	dest := &models.OutputDestination{
+		ID:     uuid.New().String(),
+		UserID: userID,
+	}
+	if !api.applyDestination(c, dest, &req) {
+		return
+	}
+
+	if err := api.repo.CreateOutputDestination(c.Request.Context(), dest); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dest)
+}
+
+func (api *API) listDestinations(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	destinations, err := api.repo.ListOutputDestinations(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"destinations": destinations,
+		"count":        len(destinations),
+	})
+}
+
+// ownDestination loads a destination of the caller, writing the response and
+// returning nil when it is missing or someone else's
+func (api *API) ownDestination(c *gin.Context) *models.OutputDestination {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil
+	}
+
+	dest, err := api.repo.GetOutputDestination(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Destination not found"})
+		return nil
+	}
+
+	if dest.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return nil
+	}
+
+	return dest
+}
+
+func (api *API) getDestination(c *gin.Context) {
+	dest := api.ownDestination(c)
+	if dest == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, dest)
+}
+
+// updateDestination replaces a destination. Its credentials are kept unless
+// new ones are given.
+func (api *API) updateDestination(c *gin.Context) {
+	if api.destinationCipher == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Output destinations are not configured"})
+		return
+	}
+
+	dest := api.ownDestination(c)
+	if dest == nil {
+		return
+	}
+
+	var req destinationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !api.applyDestination(c, dest, &req) {
+		return
+	}
+
+	if err := api.repo.UpdateOutputDestination(c.Request.Context(), dest); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dest)
+}
+
+// deleteDestination deletes a destination. Jobs already referencing it fail
+// when they run.
+func (api *API) deleteDestination(c *gin.Context) {
+	dest := api.ownDestination(c)
+	if dest == nil {
+		return
+	}
+
+	if err := api.repo.DeleteOutputDestination(c.Request.Context(), dest.ID, dest.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Destination deleted"})
+}
+
+// checkDestinations verifies that the output destinations of a new job exist
+// and belong to the same user
+func (api *API) checkDestinations(c *gin.Context, userID *string, ids []string) error {
+	for _, id := range ids {
+		dest, err := api.repo.GetOutputDestination(c.Request.Context(), id)
+		if err != nil || userID == nil || dest.UserID != *userID {
+			return fmt.Errorf("destination %s not found", id)
+		}
+	}
+	return nil
+}
+
+// Lifecycle handlers
+
+func (api *API) getLifecyclePolicy(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	policy, err := api.repo.GetLifecyclePolicy(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policy": policy, "defaults": api.lifecycle.Defaults()})
+}
+
+// updateLifecyclePolicy replaces the caller's lifecycle policy. Rules left
+// out inherit the defaults and rules of 0 days are disabled.
+func (api *API) updateLifecyclePolicy(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req struct {
+		DeleteSourceAfterDays           *int `json:"delete_source_after_days" binding:"omitempty,min=0"`
+		DeleteUnusedRenditionsAfterDays *int `json:"delete_unused_renditions_after_days" binding:"omitempty,min=0"`
+		ColdStorageAfterDays            *int `json:"cold_storage_after_days" binding:"omitempty,min=0"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy := &models.LifecyclePolicy{
+		UserID:                          userID,
+		DeleteSourceAfterDays:           req.DeleteSourceAfterDays,
+		DeleteUnusedRenditionsAfterDays: req.DeleteUnusedRenditionsAfterDays,
+		ColdStorageAfterDays:            req.ColdStorageAfterDays,
+	}
+
+	if err := api.repo.SaveLifecyclePolicy(c.Request.Context(), policy); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policy": policy, "defaults": api.lifecycle.Defaults()})
+}
+
+// lifecycleReport reports what a lifecycle run would delete and move now,
+// without changing anything
+func (api *API) lifecycleReport(c *gin.Context) {
+	c.JSON(http.StatusOK, api.lifecycle.RunOnce(c.Request.Context(), true))
+}
+
+// Monitoring handlers
+
+func (api *API) getMetrics(c *gin.Context) {
+	if api.monitor == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Monitoring not available"})
+		return
+	}
+
+	metrics := api.monitor.GetMetrics()
+	c.JSON(http.StatusOK, metrics)
+}
+
+func (api *API) getWorkerHealth(c *gin.Context) {
+	if api.monitor == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Monitoring not available"})
+		return
+	}
+
+	workers := api.monitor.GetWorkerHealth()
+	c.JSON(http.StatusOK, gin.H{"workers": workers})
+}
+
+// workerStatus is a registered worker with whether its heartbeat is current
+type workerStatus struct {
+	*models.Worker
+	Alive bool `json:"alive"`
+}
+
+func (api *API) listWorkers(c *gin.Context) {
+	workers, err := api.repo.ListWorkers(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	statuses := make([]workerStatus, 0, len(workers))
+	for _, w := range workers {
+		statuses = append(statuses, workerStatus{Worker: w, Alive: w.Alive(api.heartbeatTTL)})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"workers": statuses,
+		"count":   len(statuses),
+	})
+}
+
+// drainWorker stops a worker from taking new jobs so it can be taken down
+// once its current jobs finish. The worker picks this up on its next heartbeat.
+func (api *API) drainWorker(c *gin.Context) {
+	workerID := c.Param("id")
+
+	w, err := api.repo.GetWorker(c.Request.Context(), workerID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Worker not found"})
+		return
+	}
+
+	if err := api.repo.SetWorkerStatus(c.Request.Context(), workerID, models.WorkerStatusDraining); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	w.Status = models.WorkerStatusDraining
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Worker draining",
+		"worker":  workerStatus{Worker: w, Alive: w.Alive(api.heartbeatTTL)},
+	})
+}
+
+func (api *API) getSystemHealth(c *gin.Context) {
+	if api.monitor == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Monitoring not available"})
+		return
+	}
+
+	health := api.monitor.GetSystemHealth()
+	alerts := api.monitor.GetAlerts()
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": health,
+		"alerts": alerts,
+	})
+}
+
+func (api *API) getQueueStats(c *gin.Context) {
+	queueDepth, err := api.queue.GetQueueDepth()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get queue depth"})
+		return
+	}
+
+	dlqDepth, err := api.queue.GetDLQDepth()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get DLQ depth"})
+		return
+	}
+
+	response := gin.H{
+		"queue_depth": queueDepth,
+		"dlq_depth":   dlqDepth,
+	}
+
+	// Jobs waiting for a fair-share slot have not reached the queue yet
+	if api.scheduler != nil {
+		stats := gin.H{
+			"pending": api.scheduler.GetQueueDepth(),
+			"active":  api.scheduler.GetActiveJobs(),
+			"leader":  api.scheduler.IsLeader(),
+		}
+		if tenants, ok := api.visibleTenantStats(c); ok {
+			stats["tenants"] = tenants
+		}
+		response["scheduler"] = stats
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// visibleTenantStats returns the per-tenant scheduler stats the caller may
+// see: every tenant for admins, only their own for other users and none for
+// anonymous callers
+func (api *API) visibleTenantStats(c *gin.Context) ([]scheduler.TenantStats, bool) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		return nil, false
+	}
+
+	stats := api.scheduler.GetTenantStats()
+	if user, err := api.repo.GetUserByID(c.Request.Context(), userID); err == nil && user != nil && user.IsActive && user.Role == models.UserRoleAdmin {
+		return stats, true
+	}
+	return tenantStatsFor(stats, userID), true
+}
+
+// tenantStatsFor filters stats down to a single tenant
+func tenantStatsFor(stats []scheduler.TenantStats, tenantID string) []scheduler.TenantStats {
+	own := []scheduler.TenantStats{}
+	for _, s := range stats {
+		if s.TenantID == tenantID {
+			own = append(own, s)
+		}
+	}
+	return own
+}
+
+// Dead letter queue handlers
+
+// dlqActionRequest selects dead letters to replay or purge. An empty filter
+// must be confirmed with all so the whole queue is not emptied by accident.
+type dlqActionRequest struct {
+	queue.DeadLetterFilter
+	All    bool                    `json:"all"`
+	Config *models.TranscodeConfig `json:"config"` // replay only: overrides merged into the job's config
+}
+
+func (api *API) listDeadLetters(c *gin.Context) {
+	filter := queue.DeadLetterFilter{
+		IDs:        c.QueryArray("id"),
+		JobIDs:     c.QueryArray("job_id"),
+		ErrorClass: c.Query("error_class"),
+		Reason:     c.Query("reason"),
+	}
+
+	if since := c.Query("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC 3339 time"})
+			return
+		}
+		filter.Since = t
+	}
+
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if filter.Limit < 1 || filter.Limit > 1000 {
+		filter.Limit = 100
+	}
+
+	deadLetters, err := api.queue.ListDeadLetters(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dead_letters": deadLetters, "count": len(deadLetters)})
+}
+
+func (api *API) replayDeadLetters(c *gin.Context) {
+	req, ok := bindDLQAction(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	var replayed []string
+	skipped := []gin.H{}
+
+	// Only failed jobs are replayed, so cancelled or already completed jobs
+	// stay in the queue rather than being resurrected
+	_, err := api.queue.SettleDeadLetters(ctx, req.DeadLetterFilter, func(dl *queue.DeadLetter) bool {
+		job, err := api.repo.GetJob(ctx, dl.Job.ID)
+		if err != nil {
+			skipped = append(skipped, gin.H{"id": dl.ID, "job_id": dl.Job.ID, "reason": "job not found"})
+			return false
+		}
+		if job.Status != models.JobStatusFailed {
+			skipped = append(skipped, gin.H{"id": dl.ID, "job_id": job.ID, "reason": fmt.Sprintf("job is %s", job.Status)})
+			return false
+		}
+
+		var config *models.TranscodeConfig
+		if req.Config != nil {
+			merged := job.Config.Merge(*req.Config)
+			config = &merged
+		}
+
+		reset, err := api.repo.ReplayJob(ctx, job.ID, config)
+		if err != nil || !reset {
+			skipped = append(skipped, gin.H{"id": dl.ID, "job_id": job.ID, "reason": "job changed state"})
+			return false
+		}
+
+		replayed = append(replayed, job.ID)
+		return true
+	})
+
+	api.auditDLQAction(c, models.DLQActionReplay, req, replayed, len(skipped))
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "replayed": replayed, "skipped": skipped})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"replayed": replayed, "skipped": skipped})
+}
+
+func (api *API) purgeDeadLetters(c *gin.Context) {
+	req, ok := bindDLQAction(c)
+	if !ok {
+		return
+	}
+
+	var purged []string
+	_, err := api.queue.SettleDeadLetters(c.Request.Context(), req.DeadLetterFilter, func(dl *queue.DeadLetter) bool {
+		purged = append(purged, dl.Job.ID)
+		return true
+	})
+
+	api.auditDLQAction(c, models.DLQActionPurge, req, purged, 0)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "purged": purged})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"purged": purged, "count": len(purged)})
+}
+
+func (api *API) listDLQAudit(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	entries, err := api.repo.ListDLQAuditEntries(c.Request.Context(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+// bindDLQAction binds a replay or purge request, writing the error response
+// when it is invalid
+func bindDLQAction(c *gin.Context) (*dlqActionRequest, bool) {
+	var req dlqActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if req.DeadLetterFilter.Empty() && !req.All {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Select dead letters with a filter, or set all to true"})
+		return nil, false
+	}
+
+	return &req, true
+}
+
+// auditDLQAction records a replay or purge, including partial ones that failed midway
+func (api *API) auditDLQAction(c *gin.Context, action string, req *dlqActionRequest, jobIDs []string, skipped int) {
+	filter, _ := json.Marshal(req.DeadLetterFilter)
+
+	entry := &models.DLQAuditEntry{
+		Action:   action,
+		Filter:   filter,
+		Config:   req.Config,
+		JobIDs:   jobIDs,
+		Affected: len(jobIDs),
+		Skipped:  skipped,
+	}
+	userID, exists := middleware.GetUserID(c)
+	if exists {
+		entry.UserID = &userID
+	}
+
+	if err := api.repo.CreateDLQAuditEntry(c.Request.Context(), entry); err != nil {
+		log.Printf("Failed to audit DLQ %s of %d jobs by user %s: %v", action, len(jobIDs), userID, err)
+		return
+	}
+
+	log.Printf("DLQ %s by user %s: %d jobs, %d skipped", action, userID, len(jobIDs), skipped)
 }
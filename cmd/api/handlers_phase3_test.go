@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/queue"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/scheduler"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+func TestGetQueueStats_HidesTenantsFromAnonymousCallers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	jobs := queue.NewMemoryQueue()
+	sched := scheduler.NewScheduler(nil, jobs, 10)
+	userID := "user-1"
+	require.NoError(t, sched.ScheduleJob(&models.Job{ID: "job-1", UserID: &userID}))
+
+	api := &API{queue: jobs, scheduler: sched}
+	router := gin.New()
+	router.GET("/api/v1/queue/stats", api.getQueueStats)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/queue/stats", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Scheduler map[string]json.RawMessage `json:"scheduler"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.NotNil(t, response.Scheduler)
+	assert.NotContains(t, response.Scheduler, "tenants")
+}
+
+func TestTenantStatsFor(t *testing.T) {
+	stats := []scheduler.TenantStats{
+		{TenantID: "user-1", Pending: 3},
+		{TenantID: "user-2", Pending: 1, Active: 2},
+	}
+
+	assert.Equal(t, []scheduler.TenantStats{{TenantID: "user-2", Pending: 1, Active: 2}}, tenantStatsFor(stats, "user-2"))
+	assert.Empty(t, tenantStatsFor(stats, "user-3"))
+}
@@ -1,238 +1,182 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
-	"path/filepath"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/analytics"
-	"github.com/therealutkarshpriyadarshi/transcode/internal/transcoder"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/ingest"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/middleware"
 	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
 )
 
 // Phase 7 Handlers
 
-// Scene Detection Handlers
+// Scene detection, watermark and concatenation jobs run on workers like
+// transcodes. Their endpoints respond 202 with the job, whose result and
+// outputs are available through the job APIs once it completes.
+
+// operationVideo returns the video of an operation job, checking the caller
+// owns it and its source still exists
+func (api *API) operationVideo(c *gin.Context, videoID string) (*models.Video, bool) {
+	video, err := api.repo.GetVideo(c.Request.Context(), videoID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Video not found", "video_id": videoID})
+		return nil, false
+	}
+
+	if userID, exists := middleware.GetUserID(c); exists {
+		if video.UserID == nil || *video.UserID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			return nil, false
+		}
+	}
+
+	if video.OriginalURL == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": errSourceDeleted, "video_id": videoID})
+		return nil, false
+	}
 
-type sceneDetectionRequest struct {
-	Threshold        float64 `json:"threshold"`
-	MinSceneDuration float64 `json:"min_scene_duration"`
-	MaxScenes        int     `json:"max_scenes"`
+	return video, true
 }
 
-func (s *Server) handleSceneDetection(c *gin.Context) {
-	videoID := c.Param("id")
+// submitOperation creates and queues a job of jobType on video and responds
+// with it
+func (api *API) submitOperation(c *gin.Context, video *models.Video, jobType string, priority int, config models.TranscodeConfig) {
+	job := &models.Job{
+		Type:     jobType,
+		VideoID:  video.ID,
+		Status:   models.JobStatusPending,
+		Priority: priority,
+		Config:   config,
+	}
 
-	var req sceneDetectionRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	if job.Priority == 0 {
+		job.Priority = models.JobPriorityNormal
 	}
 
-	// Get video
-	video, err := s.repo.GetVideo(c.Request.Context(), videoID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "video not found"})
+	job.PrepareRouting(video)
+
+	if userID, exists := middleware.GetUserID(c); exists {
+		job.UserID = &userID
+	}
+
+	if !api.submitJob(c, job) {
 		return
 	}
 
-	// Create temp directory for scene frames
-	tempDir := filepath.Join(s.cfg.Transcoder.TempDir, "scenes", videoID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// Scene Detection Handlers
 
-	// Download video from storage
-	inputPath := filepath.Join(tempDir, "input"+filepath.Ext(video.Filename))
-	if err := s.storage.DownloadFile(c.Request.Context(), video.OriginalURL, inputPath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to download video"})
+func (api *API) detectScenes(c *gin.Context) {
+	var req struct {
+		models.SceneDetectionParams
+		Priority int `json:"priority"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Perform scene detection
-	ffmpeg := transcoder.NewFFmpeg(s.cfg.Transcoder.FFmpegPath, s.cfg.Transcoder.FFprobePath)
-	opts := transcoder.SceneDetectionOptions{
-		InputPath:        inputPath,
-		OutputDir:        tempDir,
-		Threshold:        req.Threshold,
-		MinSceneDuration: req.MinSceneDuration,
-		MaxScenes:        req.MaxScenes,
+	if err := req.SceneDetectionParams.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	result, err := ffmpeg.DetectScenes(c.Request.Context(), opts)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "scene detection failed", "details": err.Error()})
+	video, ok := api.operationVideo(c, c.Param("id"))
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, result)
+	api.submitOperation(c, video, models.JobTypeSceneDetection, req.Priority, models.TranscodeConfig{
+		SceneDetection: &req.SceneDetectionParams,
+	})
 }
 
 // Watermark Handlers
 
-type watermarkRequest struct {
-	WatermarkText  string  `json:"watermark_text,omitempty"`
-	WatermarkImage string  `json:"watermark_image,omitempty"` // URL or path
-	Position       string  `json:"position"`
-	Opacity        float64 `json:"opacity"`
-	Scale          float64 `json:"scale"`
-	FontSize       int     `json:"font_size"`
-	FontColor      string  `json:"font_color"`
-	Padding        int     `json:"padding"`
-	OutputFormat   string  `json:"output_format"`
-}
-
-func (s *Server) handleApplyWatermark(c *gin.Context) {
-	videoID := c.Param("id")
+// watermarkFormats are the containers a watermarked video can be written to
+var watermarkFormats = map[string]bool{"mp4": true, "mov": true, "mkv": true}
 
-	var req watermarkRequest
+func (api *API) applyWatermark(c *gin.Context) {
+	var req struct {
+		models.WatermarkParams
+		OutputFormat string `json:"output_format"`
+		Priority     int    `json:"priority"`
+	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Get video
-	video, err := s.repo.GetVideo(c.Request.Context(), videoID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "video not found"})
-		return
-	}
-
-	// Create temp directory
-	tempDir := filepath.Join(s.cfg.Transcoder.TempDir, "watermark", uuid.New().String())
-
-	// Download video
-	inputPath := filepath.Join(tempDir, "input"+filepath.Ext(video.Filename))
-	if err := s.storage.DownloadFile(c.Request.Context(), video.OriginalURL, inputPath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to download video"})
+	if err := req.WatermarkParams.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Prepare output
-	outputFormat := req.OutputFormat
-	if outputFormat == "" {
-		outputFormat = "mp4"
-	}
-	outputPath := filepath.Join(tempDir, "watermarked."+outputFormat)
-
-	// Apply watermark
-	ffmpeg := transcoder.NewFFmpeg(s.cfg.Transcoder.FFmpegPath, s.cfg.Transcoder.FFprobePath)
-	opts := transcoder.WatermarkOptions{
-		InputPath:     inputPath,
-		OutputPath:    outputPath,
-		WatermarkText: req.WatermarkText,
-		Position:      req.Position,
-		Opacity:       req.Opacity,
-		Scale:         req.Scale,
-		FontSize:      req.FontSize,
-		FontColor:     req.FontColor,
-		Padding:       req.Padding,
-	}
-
-	if req.WatermarkImage != "" {
-		// Download watermark image if URL
-		watermarkPath := filepath.Join(tempDir, "watermark.png")
-		if err := s.storage.DownloadFile(c.Request.Context(), req.WatermarkImage, watermarkPath); err == nil {
-			opts.WatermarkPath = watermarkPath
-		} else {
-			opts.WatermarkPath = req.WatermarkImage // Assume it's a local path
+	if req.ImageURL != "" {
+		// Workers fetch the image, so only public HTTP(S) URLs are accepted
+		if err := ingest.ValidateURL(req.ImageURL, nil); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("watermark_image: %v", err)})
+			return
 		}
 	}
 
-	if err := ffmpeg.ApplyWatermark(c.Request.Context(), opts); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "watermarking failed", "details": err.Error()})
+	if req.OutputFormat == "" {
+		req.OutputFormat = "mp4"
+	}
+	if !watermarkFormats[req.OutputFormat] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported output format %q", req.OutputFormat)})
 		return
 	}
 
-	// Upload watermarked video
-	storageKey := filepath.Join("videos", videoID, "watermarked", filepath.Base(outputPath))
-	if err := s.storage.UploadFile(c.Request.Context(), storageKey, outputPath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to upload watermarked video"})
+	video, ok := api.operationVideo(c, c.Param("id"))
+	if !ok {
 		return
 	}
 
-	url, _ := s.storage.GetURL(c.Request.Context(), storageKey)
-
-	c.JSON(http.StatusOK, gin.H{
-		"message": "watermark applied successfully",
-		"url":     url,
-		"path":    storageKey,
+	api.submitOperation(c, video, models.JobTypeWatermark, req.Priority, models.TranscodeConfig{
+		OutputFormat: req.OutputFormat,
+		Watermark:    &req.WatermarkParams,
 	})
 }
 
 // Concatenation Handlers
 
-type concatenationRequest struct {
-	VideoIDs           []string `json:"video_ids" binding:"required"`
-	Method             string   `json:"method"`
-	TransitionType     string   `json:"transition_type"`
-	TransitionDuration float64  `json:"transition_duration"`
-	ReEncode           bool     `json:"re_encode"`
-}
-
-func (s *Server) handleConcatenateVideos(c *gin.Context) {
-	var req concatenationRequest
+func (api *API) concatenateVideos(c *gin.Context) {
+	var req struct {
+		models.ConcatenationParams
+		Priority int `json:"priority"`
+	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if len(req.VideoIDs) < 2 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "at least 2 videos required"})
+	if err := req.ConcatenationParams.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Create temp directory
-	tempDir := filepath.Join(s.cfg.Transcoder.TempDir, "concat", uuid.New().String())
-
-	// Download all videos
-	inputPaths := make([]string, 0, len(req.VideoIDs))
-	for i, videoID := range req.VideoIDs {
-		video, err := s.repo.GetVideo(c.Request.Context(), videoID)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "video not found", "video_id": videoID})
+	// The job belongs to the first video, which keeps the output
+	var first *models.Video
+	for _, videoID := range req.VideoIDs {
+		video, ok := api.operationVideo(c, videoID)
+		if !ok {
 			return
 		}
-
-		inputPath := filepath.Join(tempDir, filepath.Sprintf("input_%d%s", i, filepath.Ext(video.Filename)))
-		if err := s.storage.DownloadFile(c.Request.Context(), video.OriginalURL, inputPath); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to download video", "video_id": videoID})
-			return
+		if first == nil {
+			first = video
 		}
-
-		inputPaths = append(inputPaths, inputPath)
-	}
-
-	// Concatenate videos
-	outputPath := filepath.Join(tempDir, "concatenated.mp4")
-	ffmpeg := transcoder.NewFFmpeg(s.cfg.Transcoder.FFmpegPath, s.cfg.Transcoder.FFprobePath)
-	opts := transcoder.ConcatenationOptions{
-		InputPaths:         inputPaths,
-		OutputPath:         outputPath,
-		Method:             req.Method,
-		TransitionType:     req.TransitionType,
-		TransitionDuration: req.TransitionDuration,
-		ReEncode:           req.ReEncode,
-	}
-
-	if err := ffmpeg.ConcatVideo(c.Request.Context(), opts); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "concatenation failed", "details": err.Error()})
-		return
-	}
-
-	// Upload concatenated video
-	storageKey := filepath.Join("videos", "concatenated", uuid.New().String()+".mp4")
-	if err := s.storage.UploadFile(c.Request.Context(), storageKey, outputPath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to upload concatenated video"})
-		return
 	}
 
-	url, _ := s.storage.GetURL(c.Request.Context(), storageKey)
-
-	c.JSON(http.StatusOK, gin.H{
-		"message": "videos concatenated successfully",
-		"url":     url,
-		"path":    storageKey,
+	api.submitOperation(c, first, models.JobTypeConcatenation, req.Priority, models.TranscodeConfig{
+		Concatenation: &req.ConcatenationParams,
 	})
 }
 
@@ -384,15 +328,6 @@ func (s *Server) handleGetQoEMetrics(c *gin.Context) {
 func (s *Server) registerPhase7Routes() {
 	v1 := s.router.Group("/api/v1")
 
-	// Scene detection
-	v1.POST("/videos/:id/scenes/detect", s.handleSceneDetection)
-
-	// Watermarking
-	v1.POST("/videos/:id/watermark", s.handleApplyWatermark)
-
-	// Concatenation
-	v1.POST("/videos/concatenate", s.handleConcatenateVideos)
-
 	// Analytics
 	analytics := v1.Group("/analytics")
 	{
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/livestream"
 	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
 )
 
@@ -371,3 +373,126 @@ func (api *API) trackViewerSession(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Viewer tracked successfully"})
 }
+
+// CreateLiveStreamCue schedules an SCTE-35 ad break on a live stream
+func (api *API) createLiveStreamCue(c *gin.Context) {
+	streamID := c.Param("id")
+
+	var req struct {
+		Duration  float64    `json:"duration" binding:"required,gt=0"` // in seconds
+		Offset    float64    `json:"offset"`                           // seconds from now, ignored when start_time is set
+		StartTime *time.Time `json:"start_time"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	stream, err := api.repo.GetLiveStream(c.Request.Context(), streamID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Live stream not found"})
+		return
+	}
+
+	if stream.Status != models.LiveStreamStatusLive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cues can only be inserted into a live stream"})
+		return
+	}
+
+	startTime := time.Now().Add(time.Duration(req.Offset * float64(time.Second)))
+	if req.StartTime != nil {
+		startTime = *req.StartTime
+	}
+	if startTime.Before(time.Now().Add(-time.Second)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cue start time is in the past"})
+		return
+	}
+
+	cue := &models.LiveStreamCue{
+		LiveStreamID: streamID,
+		StartTime:    startTime,
+		Duration:     req.Duration,
+	}
+
+	if err := api.repo.CreateLiveStreamCue(c.Request.Context(), cue); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create cue: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusCreated, cue)
+}
+
+// GetLiveStreamCues lists the ad cues of a live stream
+func (api *API) getLiveStreamCues(c *gin.Context) {
+	streamID := c.Param("id")
+
+	cues, err := api.repo.ListLiveStreamCues(c.Request.Context(), streamID, time.Time{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get cues"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cues":  cues,
+		"count": len(cues),
+	})
+}
+
+// CreateLiveStreamClip cuts a clip from a running live stream into a VOD video
+func (api *API) createLiveStreamClip(c *gin.Context) {
+	streamID := c.Param("id")
+
+	var req struct {
+		Title string  `json:"title"`
+		Start float64 `json:"start" binding:"required,gt=0"` // seconds behind the live edge
+		End   float64 `json:"end" binding:"gte=0"`           // seconds behind the live edge
+		Exact bool    `json:"exact"`                         // re-encode for frame accurate cuts
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Start <= req.End {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start must be further behind the live edge than end"})
+		return
+	}
+
+	stream, err := api.repo.GetLiveStream(c.Request.Context(), streamID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Live stream not found"})
+		return
+	}
+
+	if stream.Status != models.LiveStreamStatusLive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Clips can only be cut from a live stream"})
+		return
+	}
+
+	clip, job, err := api.clipService.CreateClip(c.Request.Context(), stream, livestream.ClipRequest{
+		Title: req.Title,
+		Start: req.Start,
+		End:   req.End,
+		Exact: req.Exact,
+	})
+	if errors.Is(err, livestream.ErrClipOutOfRange) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create clip: %v", err)})
+		return
+	}
+
+	if !api.submitJob(c, job) {
+		// The video exists only for the clip
+		clip.Video.Status = models.VideoStatusFailed
+		api.repo.UpdateVideo(c.Request.Context(), clip.Video)
+		return
+	}
+	clip.JobID = job.ID
+
+	c.JSON(http.StatusAccepted, clip)
+}
@@ -23,8 +23,8 @@ import (
 
 type API struct {
 	repo    *database.Repository
-	storage *storage.Storage
-	queue   *queue.Queue
+	storage storage.Blobstore
+	queue   queue.JobQueue
 	ffmpeg  *transcoder.FFmpeg
 }
 
@@ -60,7 +60,7 @@ func main() {
 	}
 
 	// Initialize queue
-	q, err := queue.New(cfg.Queue)
+	q, err := queue.Open(cfg.Queue, db.Pool)
 	if err != nil {
 		log.Fatalf("Failed to connect to queue: %v", err)
 	}
@@ -202,14 +202,21 @@ func (api *API) uploadVideo(c *gin.Context) {
 	video.FrameRate = videoInfo.FrameRate
 	video.Metadata = videoInfo.Metadata
 
-	// Upload to storage
+	// Get user ID from context
+	if userID, exists := middleware.GetUserID(c); exists {
+		video.UserID = &userID
+	}
+
+	// Upload to storage, hashing the file on the way for deduplication
 	storageKey := fmt.Sprintf("videos/%s/original/%s", video.ID, file.Filename)
-	if err := api.storage.UploadFile(c.Request.Context(), storageKey, tempPath); err != nil {
+	checksum, err := storage.UploadFileHashed(c.Request.Context(), api.storage, storageKey, tempPath)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to upload: %v", err)})
 		return
 	}
 
 	video.OriginalURL = storageKey
+	video.Checksum = checksum
 
 	// Save to database
 	if err := api.repo.CreateVideo(c.Request.Context(), video); err != nil {
@@ -255,46 +262,26 @@ func (api *API) listVideos(c *gin.Context) {
 func (api *API) deleteVideo(c *gin.Context) {
 	videoID := c.Param("id")
 
-	// Get video to ensure it exists and get the original URL
-	video, err := api.repo.GetVideo(c.Request.Context(), videoID)
-	if err != nil {
+	// Get video to ensure it exists
+	if _, err := api.repo.GetVideo(c.Request.Context(), videoID); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Video not found"})
 		return
 	}
 
-	// Get all outputs to delete their files from storage
-	outputs, err := api.repo.GetOutputsByVideoID(c.Request.Context(), videoID)
-	if err != nil {
-		log.Printf("Warning: Failed to get outputs for video %s: %v", videoID, err)
-		// Continue with deletion even if we can't get outputs
-	}
-
-	// Delete output files from storage
-	for _, output := range outputs {
-		if output.Path != "" {
-			if err := api.storage.Delete(c.Request.Context(), output.Path); err != nil {
-				log.Printf("Warning: Failed to delete output file %s: %v", output.Path, err)
-				// Continue with deletion even if storage deletion fails
-			}
-		}
-	}
-
-	// Delete original video file from storage
-	if video.OriginalURL != "" {
-		// Extract object name from URL (assuming it's the last part)
-		objectName := video.OriginalURL
-		if err := api.storage.Delete(c.Request.Context(), objectName); err != nil {
-			log.Printf("Warning: Failed to delete original video file %s: %v", objectName, err)
-			// Continue with deletion even if storage deletion fails
-		}
-	}
-
 	// Delete video and all associated records from database
 	if err := api.repo.DeleteVideo(c.Request.Context(), videoID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to delete video: %v", err)})
 		return
 	}
 
+	// Delete everything stored for the video: original, outputs, thumbnails,
+	// subtitles and HLS/DASH files. Objects left behind by a failure here are
+	// collected by the lifecycle as orphans.
+	prefix := fmt.Sprintf("videos/%s/", videoID)
+	if _, err := storage.DeletePrefix(c.Request.Context(), api.storage, prefix); err != nil {
+		log.Printf("Warning: Failed to delete files of video %s: %v", videoID, err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Video deleted successfully", "video_id": videoID})
 }
 
@@ -303,12 +290,15 @@ func (api *API) createTranscodeJob(c *gin.Context) {
 	videoID := c.Param("id")
 
 	var req struct {
-		Resolution   string `json:"resolution" binding:"required"`
-		OutputFormat string `json:"output_format"`
-		Codec        string `json:"codec"`
-		Bitrate      int64  `json:"bitrate"`
-		Preset       string `json:"preset"`
-		Priority     int    `json:"priority"`
+		Resolution   string            `json:"resolution" binding:"required"`
+		OutputFormat string            `json:"output_format"`
+		Codec        string            `json:"codec"`
+		Bitrate      int64             `json:"bitrate"`
+		Preset       string            `json:"preset"`
+		Priority     int               `json:"priority"`
+		CuePoints    []models.CuePoint `json:"cue_points"`
+
+		Requirements models.JobRequirements `json:"requirements"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -316,8 +306,13 @@ func (api *API) createTranscodeJob(c *gin.Context) {
 		return
 	}
 
+	if err := models.ValidateCuePoints(req.CuePoints); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Check video exists
-	_, err := api.repo.GetVideo(c.Request.Context(), videoID)
+	video, err := api.repo.GetVideo(c.Request.Context(), videoID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Video not found"})
 		return
@@ -336,13 +331,18 @@ func (api *API) createTranscodeJob(c *gin.Context) {
 			Preset:       req.Preset,
 			AudioCodec:   "aac",
 			AudioBitrate: 128,
+			CuePoints:    req.CuePoints,
 		},
+		Requirements: req.Requirements,
 	}
 
 	if job.Priority == 0 {
 		job.Priority = models.JobPriorityNormal
 	}
 
+	// Estimate cost and pick the worker pool
+	job.PrepareRouting(video)
+
 	// Save to database
 	if err := api.repo.CreateJob(c.Request.Context(), job); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create job: %v", err)})
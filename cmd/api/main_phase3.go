@@ -14,27 +14,54 @@ import (
 	"github.com/google/uuid"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/config"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/database"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/destination"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/lifecycle"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/livestream"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/middleware"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/monitoring"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/queue"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/scheduler"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/transcoder"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/tus"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/upload"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/webhook"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/worker"
 	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
 )
 
+// idempotencyKeyTTL is how long responses to requests with an Idempotency-Key
+// are replayed to retries
+const idempotencyKeyTTL = 24 * time.Hour
+
+// preflightTimeout bounds probing a video uploaded straight to storage
+const preflightTimeout = 5 * time.Minute
+
+// checksumTimeout bounds hashing a video uploaded straight to storage
+const checksumTimeout = 30 * time.Minute
+
+// errSourceDeleted is returned for new jobs of videos whose original was
+// deleted by a lifecycle policy
+const errSourceDeleted = "video source was deleted by its lifecycle policy"
+
 type API struct {
 	repo           *database.Repository
-	storage        *storage.Storage
-	queue          *queue.Queue
+	storage        storage.Blobstore
+	queue          queue.JobQueue
 	ffmpeg         *transcoder.FFmpeg
 	uploadService  *upload.MultipartUploadService
+	tusServer      *tus.Server
 	webhookService *webhook.Service
 	scheduler      *scheduler.JobScheduler
 	monitor        *monitoring.Monitor
 	rateLimiter    *middleware.RateLimiter
+	clipService    *livestream.ClipService
+	heartbeatTTL   time.Duration
+	ingestConfig   config.IngestConfig
+	lifecycle      *lifecycle.Manager
+
+	destinationsConfig config.DestinationsConfig
+	destinationCipher  *destination.Cipher
 }
 
 func mainPhase3() {
@@ -65,22 +92,20 @@ func mainPhase3() {
 	}
 
 	// Initialize queue
-	q, err := queue.New(cfg.Queue)
+	q, err := queue.Open(cfg.Queue, db.Pool)
 	if err != nil {
 		log.Fatalf("Failed to connect to queue: %v", err)
 	}
 	defer q.Close()
 
-	// Setup dead letter queue
-	if err := q.SetupDeadLetterQueue(); err != nil {
-		log.Printf("Warning: Failed to setup DLQ: %v", err)
-	}
-
 	// Initialize FFmpeg
 	ffmpeg := transcoder.NewFFmpeg(cfg.Transcoder.FFmpegPath, cfg.Transcoder.FFprobePath)
 
 	// Initialize multipart upload service
-	uploadService := upload.NewMultipartUploadService(cfg.Transcoder.TempDir, cfg.Transcoder.ChunkSize)
+	uploadService := upload.NewMultipartUploadService(repo, stor, cfg.Transcoder.ChunkSize)
+	if presigner, ok := stor.(storage.MultipartPresigner); ok {
+		uploadService.SetDirectUploads(presigner)
+	}
 
 	// Start cleanup goroutine for expired uploads
 	ctx, cancel := context.WithCancel(context.Background())
@@ -95,6 +120,23 @@ func mainPhase3() {
 
 	// Initialize job scheduler
 	jobScheduler := scheduler.NewScheduler(repo, q, cfg.Transcoder.MaxConcurrent)
+	jobScheduler.SetTenantLimit(cfg.Transcoder.MaxConcurrentPerTenant)
+	jobScheduler.SetRecurringStore(repo)
+	jobScheduler.SetBatchStore(repo, webhookService)
+
+	// Only the replica holding the scheduler lease dispatches jobs
+	hostname, _ := os.Hostname()
+	replicaID := fmt.Sprintf("%s-%s", hostname, uuid.New().String()[:8])
+	jobScheduler.SetLeaderElection(repo, replicaID, cfg.Scheduler.LeaseTTL)
+
+	if cfg.Scheduler.OffPeakStart != "" {
+		window, err := scheduler.NewOffPeakWindow(cfg.Scheduler.OffPeakStart, cfg.Scheduler.OffPeakEnd,
+			cfg.Scheduler.OffPeakTimezone, cfg.Scheduler.OffPeakHoldBelowPriority)
+		if err != nil {
+			log.Fatalf("Invalid off-peak window: %v", err)
+		}
+		jobScheduler.SetOffPeakWindow(window)
+	}
 	if err := jobScheduler.Start(); err != nil {
 		log.Fatalf("Failed to start scheduler: %v", err)
 	}
@@ -102,8 +144,19 @@ func mainPhase3() {
 
 	// Initialize monitoring
 	monitor := monitoring.NewMonitor(repo, q)
+	monitor.SetWorkerSource(repo, cfg.Transcoder.HeartbeatTTL)
 	monitor.Start(ctx)
 
+	// Recover jobs abandoned by workers whose heartbeat expired
+	reaper := worker.NewReaper(repo, cfg.Transcoder.HeartbeatTTL)
+	go reaper.Run(ctx)
+
+	// Initialize live stream clipping; clips are assembled by workers
+	clipService := livestream.NewClipService(repo, stor)
+
+	// Expire responses kept for idempotent retries
+	go middleware.CleanupIdempotencyKeys(ctx, repo, time.Hour)
+
 	// Initialize rate limiter (10 requests per second, burst of 20)
 	rateLimiter := middleware.NewRateLimiter(10, 20)
 	go rateLimiter.Cleanup()
@@ -119,6 +172,36 @@ func mainPhase3() {
 		scheduler:      jobScheduler,
 		monitor:        monitor,
 		rateLimiter:    rateLimiter,
+		clipService:    clipService,
+		heartbeatTTL:   cfg.Transcoder.HeartbeatTTL,
+		ingestConfig:   cfg.Ingest,
+
+		destinationsConfig: cfg.Destinations,
+	}
+
+	// Output destinations need a key to seal customer credentials with
+	if cfg.Destinations.EncryptionKey != "" {
+		api.destinationCipher, err = destination.NewCipher(cfg.Destinations.EncryptionKey)
+		if err != nil {
+			log.Fatalf("Failed to initialize destination encryption: %v", err)
+		}
+	}
+
+	// Resumable uploads over the tus protocol
+	api.tusServer = tus.NewServer(repo, stor, tus.Config{
+		MaxSize:    cfg.Upload.TusMaxSize,
+		Expiration: cfg.Upload.TusExpiration,
+	}, api.completeTusUpload)
+	go api.tusServer.Cleanup(ctx, 10*time.Minute)
+
+	// Storage lifecycle policies and orphan collection, run by one replica
+	api.lifecycle = lifecycle.NewManager(repo, stor, cfg.Lifecycle)
+	api.lifecycle.SetLeaderElection(repo, replicaID)
+	if err := setupColdStorage(api.lifecycle, cfg, stor); err != nil {
+		log.Fatalf("Failed to set up cold storage: %v", err)
+	}
+	if cfg.Lifecycle.Enabled {
+		go api.lifecycle.Run(ctx)
 	}
 
 	// Setup router
@@ -162,6 +245,31 @@ func mainPhase3() {
 	log.Println("Server stopped")
 }
 
+// setupColdStorage gives the lifecycle the store idle outputs move to: the
+// cold bucket, or the same bucket with the cold storage class
+func setupColdStorage(manager *lifecycle.Manager, cfg *config.Config, stor storage.Blobstore) error {
+	lc := cfg.Lifecycle
+	if lc.ColdBucket == "" && lc.ColdStorageClass == "" {
+		return nil
+	}
+
+	if lc.ColdBucket != "" {
+		cold, err := storage.OpenMinIOBucket(cfg.Storage, lc.ColdBucket)
+		if err != nil {
+			return err
+		}
+		manager.SetColdStore(cold.WithStorageClass(lc.ColdStorageClass), true)
+		return nil
+	}
+
+	hot, ok := stor.(*storage.MinIOStore)
+	if !ok {
+		return fmt.Errorf("storage driver %q has no storage classes", cfg.Storage.Driver)
+	}
+	manager.SetColdStore(hot.WithStorageClass(lc.ColdStorageClass), false)
+	return nil
+}
+
 func setupRouterPhase3(api *API) *gin.Engine {
 	router := gin.Default()
 
@@ -184,6 +292,9 @@ func setupRouterPhase3(api *API) *gin.Engine {
 	// Protected routes (require authentication)
 	protected := router.Group("/api/v1")
 	protected.Use(middleware.OptionalAuth(api.repo))
+
+	// Submit endpoints replay their response to retries with the same Idempotency-Key
+	idempotent := middleware.Idempotency(api.repo, idempotencyKeyTTL)
 	{
 		// Videos
 		protected.POST("/videos/upload", middleware.QuotaLimit(api.repo), api.uploadVideo)
@@ -191,21 +302,46 @@ func setupRouterPhase3(api *API) *gin.Engine {
 		protected.GET("/videos", api.listVideos)
 		protected.DELETE("/videos/:id", api.deleteVideo)
 
+		// Imports from URLs, fetched by workers
+		protected.POST("/videos/import", middleware.QuotaLimit(api.repo), idempotent, api.importVideo)
+		protected.GET("/imports/:id", api.getImport)
+
 		// Multipart uploads
 		protected.POST("/uploads/initiate", api.initiateUpload)
 		protected.PUT("/uploads/:upload_id/parts/:part_number", api.uploadPart)
+		protected.GET("/uploads/:upload_id/parts/:part_number/url", api.getUploadPartURL)
 		protected.POST("/uploads/:upload_id/complete", middleware.QuotaLimit(api.repo), api.completeUpload)
 		protected.DELETE("/uploads/:upload_id", api.abortUpload)
 		protected.GET("/uploads/:upload_id", api.getUploadStatus)
 
+		// Resumable uploads (tus 1.0)
+		api.tusServer.Register(protected.Group("/tus"), middleware.QuotaLimit(api.repo))
+
 		// Jobs
-		protected.POST("/videos/:id/transcode", api.createTranscodeJob)
+		protected.POST("/videos/:id/transcode", idempotent, api.createTranscodeJobPhase3)
 		protected.GET("/jobs/:id", api.getJob)
 		protected.GET("/videos/:id/jobs", api.getVideoJobs)
 		protected.POST("/jobs/:id/cancel", api.cancelJob)
 		protected.POST("/jobs/:id/pause", api.pauseJob)
 		protected.POST("/jobs/:id/resume", api.resumeJob)
 
+		// Scene detection, watermark and concatenation jobs
+		protected.POST("/videos/:id/scenes/detect", idempotent, api.detectScenes)
+		protected.POST("/videos/:id/watermark", idempotent, api.applyWatermark)
+		protected.POST("/videos/concatenate", idempotent, api.concatenateVideos)
+
+		// Recurring jobs
+		protected.POST("/recurring-jobs", idempotent, api.createRecurringJob)
+		protected.GET("/recurring-jobs", api.listRecurringJobs)
+		protected.GET("/recurring-jobs/:id", api.getRecurringJob)
+		protected.POST("/recurring-jobs/:id/pause", api.pauseRecurringJob)
+		protected.POST("/recurring-jobs/:id/resume", api.resumeRecurringJob)
+		protected.DELETE("/recurring-jobs/:id", api.deleteRecurringJob)
+
+		// Batches
+		protected.POST("/batches", idempotent, api.createBatch)
+		protected.GET("/batches/:id", api.getBatch)
+
 		// Outputs
 		protected.GET("/videos/:id/outputs", api.getVideoOutputs)
 
@@ -218,6 +354,36 @@ func setupRouterPhase3(api *API) *gin.Engine {
 		protected.GET("/workers/health", api.getWorkerHealth)
 		protected.GET("/system/health", api.getSystemHealth)
 		protected.GET("/queue/stats", api.getQueueStats)
+
+		// Output destinations
+		protected.POST("/destinations", api.createDestination)
+		protected.GET("/destinations", api.listDestinations)
+		protected.GET("/destinations/:id", api.getDestination)
+		protected.PUT("/destinations/:id", api.updateDestination)
+		protected.DELETE("/destinations/:id", api.deleteDestination)
+
+		// Storage lifecycle
+		protected.GET("/lifecycle/policy", api.getLifecyclePolicy)
+		protected.PUT("/lifecycle/policy", api.updateLifecyclePolicy)
+		protected.POST("/lifecycle/report", api.lifecycleReport)
+
+		// Live streams
+		setupPhase8Routes(protected, api)
+	}
+
+	// Admin routes (require the admin role)
+	admin := router.Group("/api/v1")
+	admin.Use(middleware.OptionalAuth(api.repo), middleware.RequireRole(api.repo, models.UserRoleAdmin))
+	{
+		// Dead letter queue
+		admin.GET("/queue/dlq", api.listDeadLetters)
+		admin.POST("/queue/dlq/replay", api.replayDeadLetters)
+		admin.POST("/queue/dlq/purge", api.purgeDeadLetters)
+		admin.GET("/queue/dlq/audit", api.listDLQAudit)
+
+		// Workers
+		admin.GET("/workers", api.listWorkers)
+		admin.POST("/workers/:id/drain", api.drainWorker)
 	}
 
 	return router
@@ -268,14 +434,16 @@ func (api *API) uploadVideoPhase3(c *gin.Context) {
 		video.UserID = &userID
 	}
 
-	// Upload to storage
+	// Upload to storage, hashing the file on the way for deduplication
 	storageKey := fmt.Sprintf("videos/%s/original/%s", video.ID, file.Filename)
-	if err := api.storage.UploadFile(c.Request.Context(), storageKey, tempPath); err != nil {
+	checksum, err := storage.UploadFileHashed(c.Request.Context(), api.storage, storageKey, tempPath)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to upload: %v", err)})
 		return
 	}
 
 	video.OriginalURL = storageKey
+	video.Checksum = checksum
 
 	// Save to database
 	if err := api.repo.CreateVideo(c.Request.Context(), video); err != nil {
@@ -296,12 +464,18 @@ func (api *API) createTranscodeJobPhase3(c *gin.Context) {
 	videoID := c.Param("id")
 
 	var req struct {
-		Resolution   string `json:"resolution" binding:"required"`
-		OutputFormat string `json:"output_format"`
-		Codec        string `json:"codec"`
-		Bitrate      int64  `json:"bitrate"`
-		Preset       string `json:"preset"`
-		Priority     int    `json:"priority"`
+		Resolution   string            `json:"resolution" binding:"required"`
+		OutputFormat string            `json:"output_format"`
+		Codec        string            `json:"codec"`
+		Bitrate      int64             `json:"bitrate"`
+		Preset       string            `json:"preset"`
+		Priority     int               `json:"priority"`
+		CuePoints    []models.CuePoint `json:"cue_points"`
+
+		Requirements models.JobRequirements `json:"requirements"`
+		RunAt        *time.Time             `json:"run_at"`       // hold the job until this time
+		DependsOn    []string               `json:"depends_on"`   // jobs that must complete first
+		Destinations []string               `json:"destinations"` // output destinations to deliver to
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -309,6 +483,11 @@ func (api *API) createTranscodeJobPhase3(c *gin.Context) {
 		return
 	}
 
+	if err := models.ValidateCuePoints(req.CuePoints); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Check video exists
 	video, err := api.repo.GetVideo(c.Request.Context(), videoID)
 	if err != nil {
@@ -324,6 +503,11 @@ func (api *API) createTranscodeJobPhase3(c *gin.Context) {
 		}
 	}
 
+	if video.OriginalURL == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": errSourceDeleted})
+		return
+	}
+
 	// Create job
 	job := &models.Job{
 		VideoID:  videoID,
@@ -337,22 +521,58 @@ func (api *API) createTranscodeJobPhase3(c *gin.Context) {
 			Preset:       req.Preset,
 			AudioCodec:   "aac",
 			AudioBitrate: 128,
+			CuePoints:    req.CuePoints,
 		},
+		Requirements: req.Requirements,
 	}
 
 	if job.Priority == 0 {
 		job.Priority = models.JobPriorityNormal
 	}
 
+	if req.RunAt != nil && req.RunAt.After(time.Now()) {
+		runAt := req.RunAt.UTC()
+		job.RunAt = &runAt
+	}
+
+	// Estimate cost and pick the worker pool
+	job.PrepareRouting(video)
+
 	// Get user ID from context
 	if userID, exists := middleware.GetUserID(c); exists {
 		job.UserID = &userID
 	}
 
+	if len(req.DependsOn) > 0 {
+		if err := api.checkDependencies(c, job.UserID, req.DependsOn); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		job.DependsOn = req.DependsOn
+	}
+
+	if len(req.Destinations) > 0 {
+		if err := api.checkDestinations(c, job.UserID, req.Destinations); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		job.Config.Destinations = req.Destinations
+	}
+
+	if !api.submitJob(c, job) {
+		return
+	}
+
+	c.JSON(http.StatusCreated, job)
+}
+
+// submitJob saves a new job and schedules it, responding with an error if
+// either fails
+func (api *API) submitJob(c *gin.Context, job *models.Job) bool {
 	// Save to database
 	if err := api.repo.CreateJob(c.Request.Context(), job); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create job: %v", err)})
-		return
+		return false
 	}
 
 	// Schedule job using scheduler
@@ -362,18 +582,18 @@ func (api *API) createTranscodeJobPhase3(c *gin.Context) {
 			// Fallback to direct queue publish
 			if err := api.queue.PublishJob(c.Request.Context(), job); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to queue job: %v", err)})
-				return
+				return false
 			}
 		}
 	} else {
 		// Fallback to direct queue publish
 		if err := api.queue.PublishJob(c.Request.Context(), job); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to queue job: %v", err)})
-			return
+			return false
 		}
 	}
 
-	c.JSON(http.StatusCreated, job)
+	return true
 }
 
 // Enhanced cancel job
@@ -427,16 +647,16 @@ func (api *API) deleteVideoPhase3(c *gin.Context) {
 		}
 	}
 
-	// Delete from storage
-	if err := api.storage.DeleteFile(c.Request.Context(), video.OriginalURL); err != nil {
-		log.Printf("Failed to delete file from storage: %v", err)
-	}
-
 	// Delete from database (cascade will delete jobs and outputs)
 	if err := api.repo.DeleteVideo(c.Request.Context(), videoID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete video"})
 		return
 	}
 
+	// Delete from storage; the lifecycle collects what is left behind
+	if _, err := storage.DeletePrefix(c.Request.Context(), api.storage, fmt.Sprintf("videos/%s/", videoID)); err != nil {
+		log.Printf("Failed to delete files from storage: %v", err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Video deleted"})
 }
@@ -15,7 +15,7 @@ import (
 // 1. Add qualityService field to the API struct:
 //    type API struct {
 //        repo           *database.Repository
-//        storage        *storage.Storage
+//        storage        storage.Blobstore
 //        queue          *queue.Queue
 //        ffmpeg         *transcoder.FFmpeg
 //        qualityService *transcoder.QualityService  // Add this field
@@ -45,7 +45,7 @@ import (
 // initializeQualityService initializes the quality service with all dependencies
 func initializeQualityService(
 	cfg config.TranscoderConfig,
-	stor *storage.Storage,
+	stor storage.Blobstore,
 	repo *database.Repository,
 ) *transcoder.QualityService {
 	return transcoder.NewQualityService(cfg, stor, repo)
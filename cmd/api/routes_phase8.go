@@ -21,6 +21,13 @@ func setupPhase8Routes(router *gin.RouterGroup, api *API) {
 		livestreams.GET("/:id/analytics", api.getLiveStreamAnalytics) // Get stream analytics
 		livestreams.GET("/:id/events", api.getLiveStreamEvents)       // Get stream events
 
+		// Ad cues
+		livestreams.POST("/:id/cues", api.createLiveStreamCue) // Insert an SCTE-35 ad break
+		livestreams.GET("/:id/cues", api.getLiveStreamCues)    // List ad breaks
+
+		// Clips
+		livestreams.POST("/:id/clips", api.createLiveStreamClip) // Clip a moment into a VOD video
+
 		// DVR
 		livestreams.GET("/:id/recordings", api.getDVRRecordings)              // List DVR recordings
 		livestreams.GET("/:id/recordings/:recording_id", api.getDVRRecording) // Get specific recording
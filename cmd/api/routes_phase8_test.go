@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetupRouterPhase3_LiveStreamRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := setupRouterPhase3(&API{})
+
+	routes := make(map[string]bool)
+	for _, route := range router.Routes() {
+		routes[route.Method+" "+route.Path] = true
+	}
+
+	for _, route := range []string{
+		http.MethodPost + " /api/v1/livestreams",
+		http.MethodPost + " /api/v1/livestreams/:id/cues",
+		http.MethodGet + " /api/v1/livestreams/:id/cues",
+		http.MethodPost + " /api/v1/livestreams/:id/clips",
+	} {
+		assert.True(t, routes[route], "route %s is not registered", route)
+	}
+}
@@ -2,19 +2,29 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/google/uuid"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/config"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/database"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/destination"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/ingest"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/queue"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/transcoder"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/webhook"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/worker"
 	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
 )
 
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
 func main() {
 	// Load configuration
 	configPath := os.Getenv("CONFIG_PATH")
@@ -42,21 +52,63 @@ func main() {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 
-	// Initialize queue
-	q, err := queue.New(cfg.Queue)
+	// Detect worker capabilities and the pools to consume
+	var gpuManager *transcoder.GPUManager
+	if cfg.Transcoder.EnableGPU {
+		gpuManager = transcoder.NewGPUManager(cfg.Transcoder.FFmpegPath)
+	}
+
+	caps, err := transcoder.DetectCapabilities(context.Background(), cfg.Transcoder.FFmpegPath, gpuManager, cfg.Transcoder.MaxConcurrent)
+	if err != nil {
+		log.Fatalf("Failed to detect worker capabilities: %v", err)
+	}
+
+	caps.Pools = cfg.Queue.Pools
+	if len(caps.Pools) == 0 {
+		caps.Pools = caps.DefaultPools()
+	}
+	cfg.Queue.Pools = caps.Pools
+
+	log.Printf("Worker capabilities: gpu=%v cpus=%d memory=%dMB encoders=%d pools=%v",
+		caps.GPU, caps.CPUs, caps.MemoryMB, len(caps.Encoders), caps.Pools)
+
+	// Budget the worker's job slots by its resources
+	slots := cfg.Transcoder.WorkerCount
+	budget := worker.NewBudget(resourceBudget(cfg.Transcoder, caps, gpuManager), slots)
+	total, slots := budget.Total()
+	log.Printf("Worker budget: slots=%d cpus=%d memory=%dMB gpu_sessions=%d",
+		slots, total.CPUs, total.MemoryMB, total.GPUSessions)
+
+	// Initialize queue, prefetching a job per slot
+	cfg.Queue.Prefetch = slots
+	q, err := queue.Open(cfg.Queue, db.Pool)
 	if err != nil {
 		log.Fatalf("Failed to connect to queue: %v", err)
 	}
 	defer q.Close()
 
+	// Identify this worker process in the registry
+	hostname, _ := os.Hostname()
+	if cfg.Transcoder.WorkerID == "" {
+		cfg.Transcoder.WorkerID = fmt.Sprintf("%s-%s", hostname, uuid.New().String()[:8])
+	}
+
 	// Initialize transcoder service
 	transcoderService := transcoder.NewService(cfg.Transcoder, stor, repo)
 
-	// Create context with cancellation
+	// Deliver outputs to customer destinations, whose credentials are sealed
+	if cfg.Destinations.EncryptionKey != "" {
+		cipher, err := destination.NewCipher(cfg.Destinations.EncryptionKey)
+		if err != nil {
+			log.Fatalf("Failed to initialize destination encryption: %v", err)
+		}
+		transcoderService.SetDestinations(destination.NewResolver(repo, cipher, cfg.Destinations))
+	}
+
+	// Stop taking jobs on shutdown; the runtime drains in-flight ones
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Handle shutdown gracefully
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
@@ -66,26 +118,112 @@ func main() {
 		cancel()
 	}()
 
-	// Job handler
-	jobHandler := func(job *models.Job) error {
-		log.Printf("Processing job %s for video %s", job.ID, job.VideoID)
+	// Job webhooks are keyed by job, so a redelivered job notifies once
+	webhookService := webhook.NewService(repo)
 
-		if err := transcoderService.ProcessJob(ctx, job); err != nil {
-			log.Printf("Failed to process job %s: %v", job.ID, err)
+	process := func(ctx context.Context, job *models.Job) error {
+		err := transcoderService.Process(ctx, job)
+		if ctx.Err() != nil {
+			// Interrupted; the job runs again
 			return err
 		}
 
-		log.Printf("Successfully processed job %s", job.ID)
-		return nil
+		notify := webhookService.NotifyJobCompleted
+		if err != nil {
+			notify = webhookService.NotifyJobFailed
+		}
+		if notifyErr := notify(context.Background(), job); notifyErr != nil {
+			log.Printf("Failed to notify webhooks of job %s: %v", job.ID, notifyErr)
+		}
+		if err == nil && job.Type == models.JobTypeLiveClip {
+			notifyClipReady(webhookService, job)
+		}
+		return err
+	}
+
+	runtime := worker.NewRuntime(q, repo, process, budget, cfg.Transcoder.ShutdownTimeout)
+
+	// Jobs this worker cannot run go back to their pool without using a retry
+	runtime.SetCapabilities(caps)
+
+	// Lease jobs so a redelivered job runs on one worker at a time
+	runtime.SetJobLeaser(repo, cfg.Transcoder.WorkerID, cfg.Transcoder.JobLeaseTTL)
+
+	// Register with heartbeats so ops can see and drain the worker, and its
+	// jobs are recovered if it dies
+	heartbeat := worker.NewHeartbeat(repo, runtime, models.Worker{
+		ID:       cfg.Transcoder.WorkerID,
+		Hostname: hostname,
+		Version:  version,
+		Pools:    caps.Pools,
+		Slots:    slots,
+		CPUs:     total.CPUs,
+		MemoryMB: total.MemoryMB,
+	}, cfg.Transcoder.HeartbeatInterval)
+	go heartbeat.Run(ctx)
+
+	// Fetch imports and watch folders alongside jobs, outside the slot budget
+	sources := ingest.NewSources(cfg.Storage, cfg.Ingest.AllowPrivateNetworks)
+	if cfg.Ingest.Concurrency > 0 {
+		fetcher := ingest.NewFetcher(repo, stor, sources,
+			transcoder.NewFFmpeg(cfg.Transcoder.FFmpegPath, cfg.Transcoder.FFprobePath),
+			ingest.Config{
+				MaxSize:     cfg.Ingest.MaxSize,
+				MaxAttempts: cfg.Ingest.MaxAttempts,
+				TempDir:     cfg.Transcoder.TempDir,
+			})
+		fetcher.SetNotifier(webhookService)
+		go fetcher.Run(ctx, cfg.Ingest.Concurrency, cfg.Ingest.PollInterval)
+	}
+	for _, folder := range cfg.Ingest.Watch {
+		watcher, err := ingest.NewWatcher(repo, sources, folder)
+		if err != nil {
+			log.Fatalf("Failed to watch %s: %v", folder.Source, err)
+		}
+		go watcher.Run(ctx)
 	}
 
-	// Start consuming jobs
-	log.Println("Worker started, waiting for jobs...")
-	if err := q.ConsumeJobs(ctx, jobHandler); err != nil {
+	log.Printf("Worker %s started, waiting for jobs...", cfg.Transcoder.WorkerID)
+	if err := runtime.Run(ctx); err != nil {
 		log.Fatalf("Failed to consume jobs: %v", err)
 	}
 
-	// Wait for shutdown
-	<-ctx.Done()
+	heartbeat.Deregister(context.Background())
 	log.Println("Worker stopped")
 }
+
+// notifyClipReady sends the clip.ready webhook of a completed live clip job,
+// whose result is the clip
+func notifyClipReady(webhooks *webhook.Service, job *models.Job) {
+	var clip models.LiveStreamClip
+	if err := json.Unmarshal(job.Result, &clip); err != nil {
+		log.Printf("Failed to decode clip of job %s: %v", job.ID, err)
+		return
+	}
+	if err := webhooks.NotifyClipReady(context.Background(), &clip); err != nil {
+		log.Printf("Failed to send clip webhook for job %s: %v", job.ID, err)
+	}
+}
+
+// resourceBudget returns the configured worker budget, deriving unset values
+// from the detected capabilities
+func resourceBudget(cfg config.TranscoderConfig, caps *models.WorkerCapabilities, gpuManager *transcoder.GPUManager) worker.Resources {
+	budget := worker.Resources{
+		CPUs:        cfg.CPUBudget,
+		MemoryMB:    cfg.MemoryBudgetMB,
+		GPUSessions: cfg.GPUSessions,
+	}
+
+	if budget.CPUs <= 0 {
+		budget.CPUs = caps.CPUs
+	}
+	if budget.MemoryMB <= 0 {
+		// Leave headroom for the OS and the worker itself
+		budget.MemoryMB = caps.MemoryMB * 80 / 100
+	}
+	if budget.GPUSessions <= 0 && caps.GPU {
+		budget.GPUSessions = gpuManager.GetCapability().MaxEncoders
+	}
+
+	return budget
+}
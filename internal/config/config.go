@@ -5,17 +5,23 @@ import (
 	"time"
 
 	"github.com/spf13/viper"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
 )
 
 // Config holds all configuration for the application
 type Config struct {
-	Server     ServerConfig
-	Database   DatabaseConfig
-	Redis      RedisConfig
-	Storage    StorageConfig
-	Queue      QueueConfig
-	Transcoder TranscoderConfig
-	Auth       AuthConfig
+	Server       ServerConfig
+	Database     DatabaseConfig
+	Redis        RedisConfig
+	Storage      StorageConfig
+	Upload       UploadConfig
+	Ingest       IngestConfig
+	Queue        QueueConfig
+	Transcoder   TranscoderConfig
+	Scheduler    SchedulerConfig
+	Lifecycle    LifecycleConfig
+	Destinations DestinationsConfig
+	Auth         AuthConfig
 }
 
 // ServerConfig holds HTTP server configuration
@@ -49,12 +55,53 @@ type RedisConfig struct {
 
 // StorageConfig holds object storage configuration
 type StorageConfig struct {
+	// Driver selects the blobstore: "s3" (or "minio"), "local" or "memory"
+	Driver          string
 	Endpoint        string
 	AccessKeyID     string
 	SecretAccessKey string
 	BucketName      string
 	Region          string
 	UseSSL          bool
+
+	// LocalPath is the root directory of the local driver
+	LocalPath string
+	// BaseURL is where the local driver's root is served, used for its URLs
+	BaseURL string
+}
+
+// UploadConfig holds resumable upload configuration
+type UploadConfig struct {
+	TusMaxSize    int64         // largest tus upload in bytes, 0 for no limit
+	TusExpiration time.Duration // how long a tus upload may take before it is discarded
+}
+
+// IngestConfig holds configuration of imports from URLs and watch folders
+type IngestConfig struct {
+	MaxSize      int64         // largest imported file in bytes, 0 for no limit
+	MaxAttempts  int           // fetch attempts before an import fails
+	Concurrency  int           // imports each worker fetches at once, 0 disables fetching
+	PollInterval time.Duration // how often workers look for imports to fetch
+	// AllowPrivateNetworks allows URLs resolving to loopback, private and
+	// link-local addresses, which are refused so imports cannot reach internal services
+	AllowPrivateNetworks bool
+
+	// AllowedBuckets are the buckets s3:// URIs submitted through the API may
+	// import from, none by default
+	AllowedBuckets []string
+
+	Watch []WatchFolderConfig
+}
+
+// WatchFolderConfig configures a watch folder whose new files are imported
+type WatchFolderConfig struct {
+	// Source is an s3://bucket/prefix/ URI or a local directory, which must
+	// be shared by all workers
+	Source   string
+	Interval time.Duration // how often the folder is listed
+	UserID   string        // owner of the videos and jobs, empty for none
+	Priority int
+	Jobs     []models.TranscodeConfig // template of the jobs created for each file
 }
 
 // QueueConfig holds message queue configuration
@@ -64,6 +111,16 @@ type QueueConfig struct {
 	User     string
 	Password string
 	Vhost    string
+
+	// Backend selects the queue implementation: amqp, postgres or memory
+	Backend           string
+	PollInterval      time.Duration
+	VisibilityTimeout time.Duration
+
+	// Pools limits a consumer to these worker pools; empty consumes all
+	Pools []string
+	// Prefetch is how many unacked jobs a consumer may hold
+	Prefetch int
 }
 
 // TranscoderConfig holds transcoding configuration
@@ -74,6 +131,8 @@ type TranscoderConfig struct {
 	FFprobePath   string
 	MaxConcurrent int
 	ChunkSize     int64
+	// Per-tenant concurrency cap for users without their own limit, 0 for none
+	MaxConcurrentPerTenant int
 	// Phase 4: GPU Acceleration
 	EnableGPU      bool
 	GPUDeviceIndex int
@@ -84,6 +143,85 @@ type TranscoderConfig struct {
 	ParallelUpload     bool
 	UploadPartSize     int64
 	MaxConcurrentParts int
+	// Worker resource budget shared by its WorkerCount job slots; 0 derives
+	// the value from the host
+	CPUBudget       int
+	MemoryBudgetMB  int
+	GPUSessions     int
+	ShutdownTimeout time.Duration // how long in-flight jobs may finish before being requeued
+
+	// Worker registry
+	WorkerID          string        // unique per worker process, generated when empty
+	HeartbeatInterval time.Duration // how often workers send heartbeats
+	HeartbeatTTL      time.Duration // silence after which a worker's jobs are reaped
+	JobLeaseTTL       time.Duration // how long a job's lease lasts without renewal
+
+	// ffmpeg watchdog
+	StallTimeout     time.Duration // kill ffmpeg when its output time stops advancing this long; 0 disables
+	MaxRuntimeFactor float64       // max runtime per second of source with libx264, scaled per codec; 0 disables
+	MinMaxRuntime    time.Duration // lower bound of the derived max runtime
+
+	// Source reading
+	StreamSources      bool          // let ffmpeg read originals over presigned URLs instead of downloading them
+	SourceURLExpiry    time.Duration // lifetime of presigned source URLs, longer than any encode
+	DownloadExtensions []string      // source extensions always downloaded, for formats ffmpeg reads poorly over HTTP
+}
+
+// SchedulerConfig holds job scheduler configuration
+type SchedulerConfig struct {
+	// LeaseTTL is how long an API replica keeps the scheduler lease without
+	// renewing it before another replica takes over
+	LeaseTTL time.Duration
+
+	// Off-peak window, as "HH:MM" in OffPeakTimezone, that jobs with a priority
+	// below OffPeakHoldBelowPriority wait for. Disabled when start is empty.
+	OffPeakStart             string
+	OffPeakEnd               string
+	OffPeakTimezone          string
+	OffPeakHoldBelowPriority int
+}
+
+// LifecycleConfig holds configuration of storage lifecycle policies and
+// orphan collection
+type LifecycleConfig struct {
+	Enabled  bool
+	Interval time.Duration // how often the lifecycle runs
+	DryRun   bool          // only log what a run would delete or move
+
+	// Default rules, in days, of tenants without a policy of their own. 0
+	// disables a rule.
+	DeleteSourceAfterDays           int
+	DeleteUnusedRenditionsAfterDays int
+	ColdStorageAfterDays            int
+
+	// ColdBucket receives outputs moved to cold storage, stored with
+	// ColdStorageClass (e.g. STANDARD_IA). Outputs stay in the bucket they
+	// are in when empty; cold storage is disabled when both are empty.
+	ColdBucket       string
+	ColdStorageClass string
+
+	// OrphanGracePeriod is how old an unreferenced object must be before it
+	// is collected, so objects whose rows are still being written are kept
+	OrphanGracePeriod time.Duration
+	BatchSize         int // rows each rule handles per run
+}
+
+// DestinationsConfig holds configuration of output destinations, the
+// customer buckets and directories outputs are delivered to
+type DestinationsConfig struct {
+	// EncryptionKey is the base64 encoded 32 byte key sealing destination
+	// credentials at rest. Destinations are disabled without it.
+	EncryptionKey string
+
+	// AllowedLocalPaths are the directories local destinations may write
+	// under, each user only in its own <path>/<user_id> directory. None by
+	// default.
+	AllowedLocalPaths []string
+
+	// AllowPrivateNetworks allows S3 endpoints resolving to loopback, private
+	// and link-local addresses, which are refused so destinations cannot
+	// reach internal services
+	AllowPrivateNetworks bool
 }
 
 // AuthConfig holds authentication configuration
@@ -138,6 +276,9 @@ func setDefaults() {
 	viper.SetDefault("redis.db", 0)
 
 	// Storage defaults
+	viper.SetDefault("storage.driver", "s3")
+	viper.SetDefault("storage.localPath", "/tmp/transcode/storage")
+	viper.SetDefault("storage.baseURL", "")
 	viper.SetDefault("storage.endpoint", "localhost:9000")
 	viper.SetDefault("storage.accessKeyID", "minioadmin")
 	viper.SetDefault("storage.secretAccessKey", "minioadmin")
@@ -145,12 +286,28 @@ func setDefaults() {
 	viper.SetDefault("storage.region", "us-east-1")
 	viper.SetDefault("storage.useSSL", false)
 
+	// Upload defaults
+	viper.SetDefault("upload.tusMaxSize", 20*1024*1024*1024) // 20GB
+	viper.SetDefault("upload.tusExpiration", "24h")
+
+	// Ingest defaults
+	viper.SetDefault("ingest.maxSize", 20*1024*1024*1024) // 20GB
+	viper.SetDefault("ingest.maxAttempts", 5)
+	viper.SetDefault("ingest.concurrency", 1)
+	viper.SetDefault("ingest.pollInterval", "5s")
+	viper.SetDefault("ingest.allowPrivateNetworks", false)
+	viper.SetDefault("ingest.allowedBuckets", []string{})
+
 	// Queue defaults
 	viper.SetDefault("queue.host", "localhost")
 	viper.SetDefault("queue.port", 5672)
 	viper.SetDefault("queue.user", "guest")
 	viper.SetDefault("queue.password", "guest")
 	viper.SetDefault("queue.vhost", "/")
+	viper.SetDefault("queue.backend", "amqp")
+	viper.SetDefault("queue.pollInterval", "1s")
+	viper.SetDefault("queue.visibilityTimeout", "1h")
+	viper.SetDefault("queue.prefetch", 1)
 
 	// Transcoder defaults
 	viper.SetDefault("transcoder.workerCount", 2)
@@ -159,6 +316,7 @@ func setDefaults() {
 	viper.SetDefault("transcoder.ffprobePath", "ffprobe")
 	viper.SetDefault("transcoder.maxConcurrent", 4)
 	viper.SetDefault("transcoder.chunkSize", 5*1024*1024) // 5MB
+	viper.SetDefault("transcoder.maxConcurrentPerTenant", 0)
 	// Phase 4: GPU Acceleration defaults
 	viper.SetDefault("transcoder.enableGPU", true)
 	viper.SetDefault("transcoder.gpuDeviceIndex", -1)
@@ -169,6 +327,36 @@ func setDefaults() {
 	viper.SetDefault("transcoder.parallelUpload", true)
 	viper.SetDefault("transcoder.uploadPartSize", 10*1024*1024) // 10MB
 	viper.SetDefault("transcoder.maxConcurrentParts", 10)
+	viper.SetDefault("transcoder.shutdownTimeout", "5m")
+	viper.SetDefault("transcoder.heartbeatInterval", "10s")
+	viper.SetDefault("transcoder.heartbeatTTL", "1m")
+	viper.SetDefault("transcoder.jobLeaseTTL", "2m")
+	viper.SetDefault("transcoder.stallTimeout", "2m")
+	viper.SetDefault("transcoder.maxRuntimeFactor", 10)
+	viper.SetDefault("transcoder.minMaxRuntime", "10m")
+	viper.SetDefault("transcoder.streamSources", true)
+	viper.SetDefault("transcoder.sourceURLExpiry", "12h")
+	viper.SetDefault("transcoder.downloadExtensions", []string{".mxf"})
+
+	// Scheduler defaults
+	viper.SetDefault("scheduler.leaseTTL", "15s")
+	viper.SetDefault("scheduler.offPeakTimezone", "UTC")
+	viper.SetDefault("scheduler.offPeakHoldBelowPriority", 5)
+
+	// Lifecycle defaults
+	viper.SetDefault("lifecycle.enabled", false)
+	viper.SetDefault("lifecycle.interval", "1h")
+	viper.SetDefault("lifecycle.dryRun", true)
+	viper.SetDefault("lifecycle.deleteSourceAfterDays", 0)
+	viper.SetDefault("lifecycle.deleteUnusedRenditionsAfterDays", 0)
+	viper.SetDefault("lifecycle.coldStorageAfterDays", 0)
+	viper.SetDefault("lifecycle.orphanGracePeriod", "24h")
+	viper.SetDefault("lifecycle.batchSize", 500)
+
+	// Destinations defaults
+	viper.SetDefault("destinations.encryptionKey", "")
+	viper.SetDefault("destinations.allowedLocalPaths", []string{})
+	viper.SetDefault("destinations.allowPrivateNetworks", false)
 
 	// Auth defaults
 	viper.SetDefault("auth.jwtSecret", "change-this-secret-in-production")
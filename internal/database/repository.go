@@ -21,23 +21,36 @@ func NewRepository(db *DB) *Repository {
 
 // Videos
 
-// CreateVideo creates a new video record
-func (r *Repository) CreateVideo(ctx context.Context, video *models.Video) error {
+// createVideoQuery inserts a video, recording the tenant's earliest video
+// with the same checksum as the one it duplicates
+const createVideoQuery = `
+	INSERT INTO videos (id, filename, original_url, size, duration, width, height, codec, bitrate, frame_rate,
+	                    metadata, status, checksum, user_id, duplicate_of)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, (
+		SELECT d.id FROM videos d
+		WHERE $13 <> '' AND d.checksum = $13 AND d.user_id IS NOT DISTINCT FROM $14
+		ORDER BY d.created_at
+		LIMIT 1
+	))
+	RETURNING duplicate_of, created_at, updated_at
+`
+
+// createVideoArgs returns the createVideoQuery arguments for video, assigning its ID
+func createVideoArgs(video *models.Video) []interface{} {
 	if video.ID == "" {
 		video.ID = uuid.New().String()
 	}
 
-	query := `
-		INSERT INTO videos (id, filename, original_url, size, duration, width, height, codec, bitrate, frame_rate, metadata, status)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
-		RETURNING created_at, updated_at
-	`
-
-	err := r.db.Pool.QueryRow(ctx, query,
+	return []interface{}{
 		video.ID, video.Filename, video.OriginalURL, video.Size, video.Duration,
 		video.Width, video.Height, video.Codec, video.Bitrate, video.FrameRate,
-		video.Metadata, video.Status,
-	).Scan(&video.CreatedAt, &video.UpdatedAt)
+		video.Metadata, video.Status, video.Checksum, video.UserID,
+	}
+}
+
+// CreateVideo creates a new video record
+func (r *Repository) CreateVideo(ctx context.Context, video *models.Video) error {
+	err := r.db.Pool.QueryRow(ctx, createVideoQuery, createVideoArgs(video)...).Scan(&video.DuplicateOf, &video.CreatedAt, &video.UpdatedAt)
 
 	if err != nil {
 		return fmt.Errorf("failed to create video: %w", err)
@@ -51,16 +64,16 @@ func (r *Repository) GetVideo(ctx context.Context, id string) (*models.Video, er
 	var video models.Video
 
 	query := `
-		SELECT id, filename, original_url, size, duration, width, height, codec,
-		       bitrate, frame_rate, metadata, status, created_at, updated_at
+		SELECT id, user_id, filename, original_url, size, duration, width, height, codec,
+		       bitrate, frame_rate, metadata, status, checksum, duplicate_of, created_at, updated_at
 		FROM videos
 		WHERE id = $1
 	`
 
 	err := r.db.Pool.QueryRow(ctx, query, id).Scan(
-		&video.ID, &video.Filename, &video.OriginalURL, &video.Size, &video.Duration,
+		&video.ID, &video.UserID, &video.Filename, &video.OriginalURL, &video.Size, &video.Duration,
 		&video.Width, &video.Height, &video.Codec, &video.Bitrate, &video.FrameRate,
-		&video.Metadata, &video.Status, &video.CreatedAt, &video.UpdatedAt,
+		&video.Metadata, &video.Status, &video.Checksum, &video.DuplicateOf, &video.CreatedAt, &video.UpdatedAt,
 	)
 
 	if err == pgx.ErrNoRows {
@@ -78,14 +91,15 @@ func (r *Repository) UpdateVideo(ctx context.Context, video *models.Video) error
 	query := `
 		UPDATE videos
 		SET filename = $2, original_url = $3, size = $4, duration = $5, width = $6,
-		    height = $7, codec = $8, bitrate = $9, frame_rate = $10, metadata = $11, status = $12
+		    height = $7, codec = $8, bitrate = $9, frame_rate = $10, metadata = $11, status = $12,
+		    checksum = $13
 		WHERE id = $1
 	`
 
 	_, err := r.db.Pool.Exec(ctx, query,
 		video.ID, video.Filename, video.OriginalURL, video.Size, video.Duration,
 		video.Width, video.Height, video.Codec, video.Bitrate, video.FrameRate,
-		video.Metadata, video.Status,
+		video.Metadata, video.Status, video.Checksum,
 	)
 
 	if err != nil {
@@ -95,11 +109,38 @@ func (r *Repository) UpdateVideo(ctx context.Context, video *models.Video) error
 	return nil
 }
 
+// SetVideoChecksum records the checksum of a video hashed after it was
+// created and the tenant's earliest video it duplicates, if any
+func (r *Repository) SetVideoChecksum(ctx context.Context, video *models.Video) error {
+	query := `
+		UPDATE videos
+		SET checksum = $2, duplicate_of = (
+			SELECT d.id FROM videos d
+			WHERE $2 <> '' AND d.checksum = $2 AND d.user_id IS NOT DISTINCT FROM videos.user_id
+			AND d.id <> videos.id
+			ORDER BY d.created_at
+			LIMIT 1
+		)
+		WHERE id = $1
+		RETURNING duplicate_of
+	`
+
+	err := r.db.Pool.QueryRow(ctx, query, video.ID, video.Checksum).Scan(&video.DuplicateOf)
+	if err == pgx.ErrNoRows {
+		return fmt.Errorf("video not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set video checksum: %w", err)
+	}
+
+	return nil
+}
+
 // ListVideos retrieves all videos with pagination
 func (r *Repository) ListVideos(ctx context.Context, limit, offset int) ([]*models.Video, error) {
 	query := `
-		SELECT id, filename, original_url, size, duration, width, height, codec,
-		       bitrate, frame_rate, metadata, status, created_at, updated_at
+		SELECT id, user_id, filename, original_url, size, duration, width, height, codec,
+		       bitrate, frame_rate, metadata, status, checksum, duplicate_of, created_at, updated_at
 		FROM videos
 		ORDER BY created_at DESC
 		LIMIT $1 OFFSET $2
@@ -115,9 +156,9 @@ func (r *Repository) ListVideos(ctx context.Context, limit, offset int) ([]*mode
 	for rows.Next() {
 		var video models.Video
 		err := rows.Scan(
-			&video.ID, &video.Filename, &video.OriginalURL, &video.Size, &video.Duration,
+			&video.ID, &video.UserID, &video.Filename, &video.OriginalURL, &video.Size, &video.Duration,
 			&video.Width, &video.Height, &video.Codec, &video.Bitrate, &video.FrameRate,
-			&video.Metadata, &video.Status, &video.CreatedAt, &video.UpdatedAt,
+			&video.Metadata, &video.Status, &video.Checksum, &video.DuplicateOf, &video.CreatedAt, &video.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan video: %w", err)
@@ -130,22 +171,36 @@ func (r *Repository) ListVideos(ctx context.Context, limit, offset int) ([]*mode
 
 // Jobs
 
-// CreateJob creates a new job record
-func (r *Repository) CreateJob(ctx context.Context, job *models.Job) error {
+// createJobQuery inserts a job, shared by CreateJob and CreateBatch
+const createJobQuery = `
+	INSERT INTO jobs (id, video_id, user_id, status, priority, progress, retry_count, config,
+	                  requirements, estimated_cost, pool, run_at, batch_id, depends_on, config_fingerprint, type)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+	RETURNING created_at, updated_at
+`
+
+// createJobArgs returns the createJobQuery arguments for job, assigning its ID
+func createJobArgs(job *models.Job) []interface{} {
 	if job.ID == "" {
 		job.ID = uuid.New().String()
 	}
+	if job.DependsOn == nil {
+		job.DependsOn = []string{}
+	}
+	if job.Type == "" {
+		job.Type = models.JobTypeTranscode
+	}
 
-	query := `
-		INSERT INTO jobs (id, video_id, status, priority, progress, retry_count, config)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		RETURNING created_at, updated_at
-	`
-
-	err := r.db.Pool.QueryRow(ctx, query,
-		job.ID, job.VideoID, job.Status, job.Priority, job.Progress, job.RetryCount, job.Config,
-	).Scan(&job.CreatedAt, &job.UpdatedAt)
+	return []interface{}{
+		job.ID, job.VideoID, job.UserID, job.Status, job.Priority, job.Progress, job.RetryCount, job.Config,
+		job.Requirements, job.EstimatedCost, job.Pool, job.RunAt, job.BatchID, job.DependsOn,
+		job.Config.Fingerprint(), job.Type,
+	}
+}
 
+// CreateJob creates a new job record
+func (r *Repository) CreateJob(ctx context.Context, job *models.Job) error {
+	err := r.db.Pool.QueryRow(ctx, createJobQuery, createJobArgs(job)...).Scan(&job.CreatedAt, &job.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("failed to create job: %w", err)
 	}
@@ -158,16 +213,18 @@ func (r *Repository) GetJob(ctx context.Context, id string) (*models.Job, error)
 	var job models.Job
 
 	query := `
-		SELECT id, video_id, status, priority, progress, error_msg, retry_count,
-		       worker_id, started_at, completed_at, created_at, updated_at, config
+		SELECT id, video_id, user_id, status, priority, progress, error_msg, retry_count,
+		       worker_id, started_at, completed_at, created_at, updated_at, config,
+		       requirements, estimated_cost, pool, run_at, batch_id, depends_on, reused_from_job_id, type, result
 		FROM jobs
 		WHERE id = $1
 	`
 
 	err := r.db.Pool.QueryRow(ctx, query, id).Scan(
-		&job.ID, &job.VideoID, &job.Status, &job.Priority, &job.Progress,
+		&job.ID, &job.VideoID, &job.UserID, &job.Status, &job.Priority, &job.Progress,
 		&job.ErrorMsg, &job.RetryCount, &job.WorkerID, &job.StartedAt,
 		&job.CompletedAt, &job.CreatedAt, &job.UpdatedAt, &job.Config,
+		&job.Requirements, &job.EstimatedCost, &job.Pool, &job.RunAt, &job.BatchID, &job.DependsOn, &job.ReusedFromJobID, &job.Type, &job.Result,
 	)
 
 	if err == pgx.ErrNoRows {
@@ -180,32 +237,70 @@ func (r *Repository) GetJob(ctx context.Context, id string) (*models.Job, error)
 	return &job, nil
 }
 
-// UpdateJob updates a job record
+// UpdateJob updates a job record. A job carrying a fencing token is only
+// updated while that token is current, so a worker that lost the job's lease
+// cannot overwrite the new owner's progress.
 func (r *Repository) UpdateJob(ctx context.Context, job *models.Job) error {
 	query := `
 		UPDATE jobs
 		SET status = $2, priority = $3, progress = $4, error_msg = $5,
-		    retry_count = $6, worker_id = $7, started_at = $8, completed_at = $9, config = $10
-		WHERE id = $1
+		    retry_count = $6, worker_id = $7, started_at = $8, completed_at = $9, config = $10,
+		    config_fingerprint = $12, reused_from_job_id = $13, result = $14
+		WHERE id = $1 AND ($11 = 0 OR fencing_token = $11)
 	`
 
-	_, err := r.db.Pool.Exec(ctx, query,
+	tag, err := r.db.Pool.Exec(ctx, query,
 		job.ID, job.Status, job.Priority, job.Progress, job.ErrorMsg,
-		job.RetryCount, job.WorkerID, job.StartedAt, job.CompletedAt, job.Config,
+		job.RetryCount, job.WorkerID, job.StartedAt, job.CompletedAt, job.Config, job.FencingToken,
+		job.Config.Fingerprint(), job.ReusedFromJobID, job.Result,
 	)
 
 	if err != nil {
 		return fmt.Errorf("failed to update job: %w", err)
 	}
+	if job.FencingToken != 0 && tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to update job: lease lost to another worker")
+	}
 
 	return nil
 }
 
+// FindReusableJob finds the latest completed job that transcoded a source
+// with checksum, of a video of userID, with a config of the same fingerprint
+// as job's. Only jobs whose outputs are all in hot storage qualify. It
+// returns an empty ID when there is none.
+func (r *Repository) FindReusableJob(ctx context.Context, job *models.Job, checksum string, userID *string) (string, error) {
+	query := `
+		SELECT j.id
+		FROM jobs j
+		JOIN videos v ON v.id = j.video_id
+		WHERE j.status = 'completed' AND j.type = 'transcode' AND j.id <> $1
+		AND j.config_fingerprint = $2 AND v.checksum = $3 AND $3 <> ''
+		AND v.user_id IS NOT DISTINCT FROM $4
+		AND EXISTS (SELECT 1 FROM outputs o WHERE o.job_id = j.id)
+		AND NOT EXISTS (SELECT 1 FROM outputs o WHERE o.job_id = j.id AND o.storage_tier <> 'hot')
+		ORDER BY j.completed_at DESC
+		LIMIT 1
+	`
+
+	var id string
+	err := r.db.Pool.QueryRow(ctx, query, job.ID, job.Config.Fingerprint(), checksum, userID).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to find reusable job: %w", err)
+	}
+
+	return id, nil
+}
+
 // GetJobsByVideoID retrieves all jobs for a video
 func (r *Repository) GetJobsByVideoID(ctx context.Context, videoID string) ([]*models.Job, error) {
 	query := `
-		SELECT id, video_id, status, priority, progress, error_msg, retry_count,
-		       worker_id, started_at, completed_at, created_at, updated_at, config
+		SELECT id, video_id, user_id, status, priority, progress, error_msg, retry_count,
+		       worker_id, started_at, completed_at, created_at, updated_at, config,
+		       requirements, estimated_cost, pool, run_at, batch_id, depends_on, reused_from_job_id, type, result
 		FROM jobs
 		WHERE video_id = $1
 		ORDER BY created_at DESC
@@ -221,9 +316,10 @@ func (r *Repository) GetJobsByVideoID(ctx context.Context, videoID string) ([]*m
 	for rows.Next() {
 		var job models.Job
 		err := rows.Scan(
-			&job.ID, &job.VideoID, &job.Status, &job.Priority, &job.Progress,
+			&job.ID, &job.VideoID, &job.UserID, &job.Status, &job.Priority, &job.Progress,
 			&job.ErrorMsg, &job.RetryCount, &job.WorkerID, &job.StartedAt,
 			&job.CompletedAt, &job.CreatedAt, &job.UpdatedAt, &job.Config,
+			&job.Requirements, &job.EstimatedCost, &job.Pool, &job.RunAt, &job.BatchID, &job.DependsOn, &job.ReusedFromJobID, &job.Type, &job.Result,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan job: %w", err)
@@ -236,24 +332,64 @@ func (r *Repository) GetJobsByVideoID(ctx context.Context, videoID string) ([]*m
 
 // Outputs
 
-// CreateOutput creates a new output record
+// CreateOutput records an output of a job, replacing the job's earlier
+// output of the same rendition
 func (r *Repository) CreateOutput(ctx context.Context, output *models.Output) error {
+	return createOutput(ctx, r.db.Pool, output)
+}
+
+// CreateOutputs records several outputs of a job in one transaction, so
+// either all of them are recorded or none is
+func (r *Repository) CreateOutputs(ctx context.Context, outputs []*models.Output) error {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, output := range outputs {
+		if err := createOutput(ctx, tx, output); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// rowQuerier runs a query returning one row, in or outside a transaction
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// createOutput inserts or replaces an output
+func createOutput(ctx context.Context, q rowQuerier, output *models.Output) error {
 	if output.ID == "" {
 		output.ID = uuid.New().String()
 	}
 
+	output.Rendition = output.RenditionKey()
+
+	// A job run again, e.g. after redelivery, replaces its earlier output
 	query := `
 		INSERT INTO outputs (id, job_id, video_id, format, resolution, width, height,
-		                     codec, bitrate, size, duration, url, path)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
-		RETURNING created_at
+		                     codec, bitrate, size, duration, url, path, rendition)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		ON CONFLICT (job_id, rendition) DO UPDATE SET
+			format = EXCLUDED.format, resolution = EXCLUDED.resolution,
+			width = EXCLUDED.width, height = EXCLUDED.height, codec = EXCLUDED.codec,
+			bitrate = EXCLUDED.bitrate, size = EXCLUDED.size, duration = EXCLUDED.duration,
+			url = EXCLUDED.url, path = EXCLUDED.path, storage_tier = 'hot'
+		RETURNING id, storage_tier, created_at
 	`
 
-	err := r.db.Pool.QueryRow(ctx, query,
+	err := q.QueryRow(ctx, query,
 		output.ID, output.JobID, output.VideoID, output.Format, output.Resolution,
 		output.Width, output.Height, output.Codec, output.Bitrate, output.Size,
-		output.Duration, output.URL, output.Path,
-	).Scan(&output.CreatedAt)
+		output.Duration, output.URL, output.Path, output.Rendition,
+	).Scan(&output.ID, &output.StorageTier, &output.CreatedAt)
 
 	if err != nil {
 		return fmt.Errorf("failed to create output: %w", err)
@@ -266,7 +402,7 @@ func (r *Repository) CreateOutput(ctx context.Context, output *models.Output) er
 func (r *Repository) GetOutputsByJobID(ctx context.Context, jobID string) ([]*models.Output, error) {
 	query := `
 		SELECT id, job_id, video_id, format, resolution, width, height, codec,
-		       bitrate, size, duration, url, path, created_at
+		       bitrate, size, duration, url, path, rendition, storage_tier, created_at
 		FROM outputs
 		WHERE job_id = $1
 		ORDER BY created_at DESC
@@ -284,7 +420,7 @@ func (r *Repository) GetOutputsByJobID(ctx context.Context, jobID string) ([]*mo
 		err := rows.Scan(
 			&output.ID, &output.JobID, &output.VideoID, &output.Format, &output.Resolution,
 			&output.Width, &output.Height, &output.Codec, &output.Bitrate, &output.Size,
-			&output.Duration, &output.URL, &output.Path, &output.CreatedAt,
+			&output.Duration, &output.URL, &output.Path, &output.Rendition, &output.StorageTier, &output.CreatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan output: %w", err)
@@ -379,7 +515,7 @@ func (r *Repository) CancelJob(ctx context.Context, jobID string) error {
 func (r *Repository) GetOutputsByVideoID(ctx context.Context, videoID string) ([]*models.Output, error) {
 	query := `
 		SELECT id, job_id, video_id, format, resolution, width, height, codec,
-		       bitrate, size, duration, url, path, created_at
+		       bitrate, size, duration, url, path, rendition, storage_tier, created_at
 		FROM outputs
 		WHERE video_id = $1
 		ORDER BY created_at DESC
@@ -397,7 +533,7 @@ func (r *Repository) GetOutputsByVideoID(ctx context.Context, videoID string) ([
 		err := rows.Scan(
 			&output.ID, &output.JobID, &output.VideoID, &output.Format, &output.Resolution,
 			&output.Width, &output.Height, &output.Codec, &output.Bitrate, &output.Size,
-			&output.Duration, &output.URL, &output.Path, &output.CreatedAt,
+			&output.Duration, &output.URL, &output.Path, &output.Rendition, &output.StorageTier, &output.CreatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan output: %w", err)
@@ -0,0 +1,217 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// batchQuery selects batches with job counts and progress aggregated from
+// their jobs. Status parameters are $1 pending, $2 queued, $3 processing,
+// $4 completed, $5 failed and $6 cancelled.
+const batchQuery = `
+	SELECT b.id, b.user_id, b.name, b.status, b.total_jobs, b.completed_at, b.created_at, b.updated_at,
+	       COUNT(j.id) FILTER (WHERE j.status = $1),
+	       COUNT(j.id) FILTER (WHERE j.status = $2),
+	       COUNT(j.id) FILTER (WHERE j.status = $3),
+	       COUNT(j.id) FILTER (WHERE j.status = $4),
+	       COUNT(j.id) FILTER (WHERE j.status = $5),
+	       COUNT(j.id) FILTER (WHERE j.status = $6),
+	       COALESCE(AVG(CASE WHEN j.status IN ($4, $5, $6) THEN 100 ELSE j.progress END), 0)
+	FROM batches b
+	LEFT JOIN jobs j ON j.batch_id = b.id
+`
+
+// batchQueryArgs returns the status parameters of batchQuery followed by args
+func batchQueryArgs(args ...interface{}) []interface{} {
+	return append([]interface{}{
+		models.JobStatusPending, models.JobStatusQueued, models.JobStatusProcessing,
+		models.JobStatusCompleted, models.JobStatusFailed, models.JobStatusCancelled,
+	}, args...)
+}
+
+func scanBatch(row pgx.Row) (*models.Batch, error) {
+	batch := &models.Batch{}
+	err := row.Scan(
+		&batch.ID, &batch.UserID, &batch.Name, &batch.Status, &batch.TotalJobs, &batch.CompletedAt,
+		&batch.CreatedAt, &batch.UpdatedAt,
+		&batch.Counts.Pending, &batch.Counts.Queued, &batch.Counts.Processing,
+		&batch.Counts.Completed, &batch.Counts.Failed, &batch.Counts.Cancelled, &batch.Progress,
+	)
+	return batch, err
+}
+
+// CreateBatch creates a batch and its jobs in one transaction
+func (r *Repository) CreateBatch(ctx context.Context, batch *models.Batch, jobs []*models.Job) error {
+	if batch.ID == "" {
+		batch.ID = uuid.New().String()
+	}
+	batch.Status = models.BatchStatusProcessing
+	batch.TotalJobs = len(jobs)
+
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO batches (id, user_id, name, status, total_jobs)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at, updated_at
+	`, batch.ID, batch.UserID, batch.Name, batch.Status, batch.TotalJobs).Scan(&batch.CreatedAt, &batch.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create batch: %w", err)
+	}
+
+	for _, job := range jobs {
+		job.BatchID = &batch.ID
+		if err := tx.QueryRow(ctx, createJobQuery, createJobArgs(job)...).Scan(&job.CreatedAt, &job.UpdatedAt); err != nil {
+			return fmt.Errorf("failed to create job: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	batch.Counts.Pending = len(jobs)
+	return nil
+}
+
+// GetBatch retrieves a batch with its aggregated job status
+func (r *Repository) GetBatch(ctx context.Context, id string) (*models.Batch, error) {
+	query := batchQuery + `
+		WHERE b.id = $7
+		GROUP BY b.id
+	`
+
+	batch, err := scanBatch(r.db.Pool.QueryRow(ctx, query, batchQueryArgs(id)...))
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("batch not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batch: %w", err)
+	}
+
+	return batch, nil
+}
+
+// GetBatchJobs retrieves the jobs of a batch in submission order
+func (r *Repository) GetBatchJobs(ctx context.Context, batchID string) ([]*models.Job, error) {
+	query := `
+		SELECT id, video_id, user_id, status, priority, progress, COALESCE(error_msg, ''), retry_count,
+		       COALESCE(worker_id, ''), started_at, completed_at, created_at, updated_at, config,
+		       requirements, estimated_cost, pool, run_at, batch_id, depends_on, reused_from_job_id, type, result
+		FROM jobs
+		WHERE batch_id = $1
+		ORDER BY created_at ASC, id ASC
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batch jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*models.Job
+	for rows.Next() {
+		job := &models.Job{}
+		if err := rows.Scan(
+			&job.ID, &job.VideoID, &job.UserID, &job.Status, &job.Priority, &job.Progress,
+			&job.ErrorMsg, &job.RetryCount, &job.WorkerID, &job.StartedAt,
+			&job.CompletedAt, &job.CreatedAt, &job.UpdatedAt, &job.Config,
+			&job.Requirements, &job.EstimatedCost, &job.Pool, &job.RunAt, &job.BatchID, &job.DependsOn, &job.ReusedFromJobID, &job.Type, &job.Result,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// ListFinishedBatches lists open batches none of whose jobs are still running
+func (r *Repository) ListFinishedBatches(ctx context.Context, limit int) ([]*models.Batch, error) {
+	query := batchQuery + `
+		WHERE b.status = $7
+		GROUP BY b.id
+		HAVING COUNT(j.id) FILTER (WHERE j.status IN ($1, $2, $3)) = 0
+		ORDER BY b.created_at ASC
+		LIMIT $8
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, batchQueryArgs(models.BatchStatusProcessing, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list finished batches: %w", err)
+	}
+	defer rows.Close()
+
+	var batches []*models.Batch
+	for rows.Next() {
+		batch, err := scanBatch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan batch: %w", err)
+		}
+		batches = append(batches, batch)
+	}
+
+	return batches, rows.Err()
+}
+
+// FinishBatch closes an open batch with its final status. It returns false when
+// the batch was already closed, so completion is reported once.
+func (r *Repository) FinishBatch(ctx context.Context, batch *models.Batch) (bool, error) {
+	query := `
+		UPDATE batches
+		SET status = $2, completed_at = NOW()
+		WHERE id = $1 AND status = $3
+		RETURNING completed_at
+	`
+
+	status := batch.FinalStatus()
+	err := r.db.Pool.QueryRow(ctx, query, batch.ID, status, models.BatchStatusProcessing).Scan(&batch.CompletedAt)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to finish batch: %w", err)
+	}
+
+	batch.Status = status
+	return true, nil
+}
+
+// FailBlockedJobs fails pending jobs that depend on a job which failed or was
+// cancelled, since they can never run. It returns the IDs of the failed jobs.
+func (r *Repository) FailBlockedJobs(ctx context.Context) ([]string, error) {
+	query := `
+		UPDATE jobs
+		SET status = $1, error_msg = 'dependency ' || d.id || ' did not complete', completed_at = NOW()
+		FROM jobs d
+		WHERE jobs.status = $2
+		AND d.id = ANY(jobs.depends_on)
+		AND d.status IN ($1, $3)
+		RETURNING jobs.id
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, models.JobStatusFailed, models.JobStatusPending, models.JobStatusCancelled)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fail blocked jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobIDs []string
+	for rows.Next() {
+		var jobID string
+		if err := rows.Scan(&jobID); err != nil {
+			return nil, fmt.Errorf("failed to scan blocked job: %w", err)
+		}
+		jobIDs = append(jobIDs, jobID)
+	}
+
+	return jobIDs, rows.Err()
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// CreateLiveStreamCue creates a new ad cue for a live stream
+func (r *Repository) CreateLiveStreamCue(ctx context.Context, cue *models.LiveStreamCue) error {
+	if cue.ID == "" {
+		cue.ID = uuid.New().String()
+	}
+
+	query := `
+		INSERT INTO live_stream_cues (id, live_stream_id, start_time, duration)
+		VALUES ($1, $2, $3, $4)
+		RETURNING event_id, created_at
+	`
+
+	err := r.db.Pool.QueryRow(ctx, query,
+		cue.ID, cue.LiveStreamID, cue.StartTime, cue.Duration,
+	).Scan(&cue.EventID, &cue.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create live stream cue: %w", err)
+	}
+
+	return nil
+}
+
+// ListLiveStreamCues lists the ad cues of a live stream that end after since
+func (r *Repository) ListLiveStreamCues(ctx context.Context, streamID string, since time.Time) ([]*models.LiveStreamCue, error) {
+	query := `
+		SELECT id, live_stream_id, event_id, start_time, duration, created_at
+		FROM live_stream_cues
+		WHERE live_stream_id = $1
+		AND start_time + duration * INTERVAL '1 second' >= $2
+		ORDER BY start_time ASC
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, streamID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list live stream cues: %w", err)
+	}
+	defer rows.Close()
+
+	var cues []*models.LiveStreamCue
+	for rows.Next() {
+		cue := &models.LiveStreamCue{}
+		if err := rows.Scan(
+			&cue.ID, &cue.LiveStreamID, &cue.EventID, &cue.StartTime, &cue.Duration, &cue.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan live stream cue: %w", err)
+		}
+		cues = append(cues, cue)
+	}
+
+	return cues, rows.Err()
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+const destinationColumns = `
+	id, user_id, name, type, endpoint, region, bucket, use_ssl, path, key_template,
+	credentials, created_at, updated_at
+`
+
+// CreateOutputDestination creates an output destination
+func (r *Repository) CreateOutputDestination(ctx context.Context, dest *models.OutputDestination) error {
+	if dest.ID == "" {
+		dest.ID = uuid.New().String()
+	}
+
+	query := `
+		INSERT INTO output_destinations (id, user_id, name, type, endpoint, region, bucket,
+		                                 use_ssl, path, key_template, credentials)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING created_at, updated_at
+	`
+
+	err := r.db.Pool.QueryRow(ctx, query,
+		dest.ID, dest.UserID, dest.Name, dest.Type, dest.Endpoint, dest.Region, dest.Bucket,
+		dest.UseSSL, dest.Path, dest.KeyTemplate, dest.Credentials,
+	).Scan(&dest.CreatedAt, &dest.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create output destination: %w", err)
+	}
+
+	return nil
+}
+
+// GetOutputDestination retrieves an output destination by ID
+func (r *Repository) GetOutputDestination(ctx context.Context, id string) (*models.OutputDestination, error) {
+	row := r.db.Pool.QueryRow(ctx, `SELECT `+destinationColumns+` FROM output_destinations WHERE id = $1`, id)
+
+	dest, err := scanOutputDestination(row)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("output destination not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get output destination: %w", err)
+	}
+
+	return dest, nil
+}
+
+// ListOutputDestinations lists a user's output destinations by name
+func (r *Repository) ListOutputDestinations(ctx context.Context, userID string) ([]*models.OutputDestination, error) {
+	rows, err := r.db.Pool.Query(ctx,
+		`SELECT `+destinationColumns+` FROM output_destinations WHERE user_id = $1 ORDER BY name, created_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list output destinations: %w", err)
+	}
+	defer rows.Close()
+
+	var dests []*models.OutputDestination
+	for rows.Next() {
+		dest, err := scanOutputDestination(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan output destination: %w", err)
+		}
+		dests = append(dests, dest)
+	}
+
+	return dests, rows.Err()
+}
+
+// UpdateOutputDestination replaces an output destination of its user
+func (r *Repository) UpdateOutputDestination(ctx context.Context, dest *models.OutputDestination) error {
+	query := `
+		UPDATE output_destinations
+		SET name = $3, type = $4, endpoint = $5, region = $6, bucket = $7, use_ssl = $8,
+		    path = $9, key_template = $10, credentials = $11, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+		RETURNING created_at, updated_at
+	`
+
+	err := r.db.Pool.QueryRow(ctx, query,
+		dest.ID, dest.UserID, dest.Name, dest.Type, dest.Endpoint, dest.Region, dest.Bucket,
+		dest.UseSSL, dest.Path, dest.KeyTemplate, dest.Credentials,
+	).Scan(&dest.CreatedAt, &dest.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return fmt.Errorf("output destination not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update output destination: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteOutputDestination deletes an output destination of a user
+func (r *Repository) DeleteOutputDestination(ctx context.Context, id, userID string) error {
+	tag, err := r.db.Pool.Exec(ctx, "DELETE FROM output_destinations WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete output destination: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("output destination not found")
+	}
+
+	return nil
+}
+
+// scanOutputDestination scans a row of destinationColumns
+func scanOutputDestination(row pgx.Row) (*models.OutputDestination, error) {
+	dest := &models.OutputDestination{}
+	err := row.Scan(
+		&dest.ID, &dest.UserID, &dest.Name, &dest.Type, &dest.Endpoint, &dest.Region, &dest.Bucket,
+		&dest.UseSSL, &dest.Path, &dest.KeyTemplate, &dest.Credentials, &dest.CreatedAt, &dest.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// ReplayJob resets a failed job to pending so the scheduler dispatches it
+// again, optionally with a new config. It returns false when the job is no
+// longer failed, e.g. cancelled or already replayed.
+func (r *Repository) ReplayJob(ctx context.Context, jobID string, config *models.TranscodeConfig) (bool, error) {
+	query := `
+		UPDATE jobs
+		SET status = $2, retry_count = 0, progress = 0, error_msg = '', worker_id = '',
+		    started_at = NULL, completed_at = NULL, config = COALESCE($3::jsonb, config)
+		WHERE id = $1 AND status = $4
+	`
+
+	var configArg interface{}
+	if config != nil {
+		configArg = *config
+	}
+
+	tag, err := r.db.Pool.Exec(ctx, query, jobID, models.JobStatusPending, configArg, models.JobStatusFailed)
+	if err != nil {
+		return false, fmt.Errorf("failed to replay job: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// CreateDLQAuditEntry records an admin action on the dead letter queue
+func (r *Repository) CreateDLQAuditEntry(ctx context.Context, entry *models.DLQAuditEntry) error {
+	query := `
+		INSERT INTO dlq_audit_log (user_id, action, filter, config, job_ids, affected, skipped)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+
+	if entry.JobIDs == nil {
+		entry.JobIDs = []string{}
+	}
+
+	err := r.db.Pool.QueryRow(ctx, query,
+		entry.UserID, entry.Action, entry.Filter, entry.Config, entry.JobIDs, entry.Affected, entry.Skipped,
+	).Scan(&entry.ID, &entry.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create DLQ audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// ListDLQAuditEntries lists the most recent dead letter queue admin actions
+func (r *Repository) ListDLQAuditEntries(ctx context.Context, limit int) ([]*models.DLQAuditEntry, error) {
+	query := `
+		SELECT id, user_id, action, filter, config, job_ids, affected, skipped, created_at
+		FROM dlq_audit_log
+		ORDER BY created_at DESC, id DESC
+		LIMIT $1
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list DLQ audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*models.DLQAuditEntry
+	for rows.Next() {
+		entry := &models.DLQAuditEntry{}
+		if err := rows.Scan(
+			&entry.ID, &entry.UserID, &entry.Action, &entry.Filter, &entry.Config, &entry.JobIDs,
+			&entry.Affected, &entry.Skipped, &entry.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan DLQ audit entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
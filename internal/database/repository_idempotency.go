@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// ReserveIdempotencyKey records an in-flight request under its idempotency
+// key, taking over the key if it expired. It returns the existing record when
+// the key is in use, and nil when it was reserved.
+func (r *Repository) ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	query := `
+		INSERT INTO idempotency_keys (scope, key, fingerprint, status_code, response, created_at, expires_at)
+		VALUES ($1, $2, $3, 0, NULL, $4, $5)
+		ON CONFLICT (scope, key) DO UPDATE SET
+			fingerprint = EXCLUDED.fingerprint,
+			status_code = 0,
+			response = NULL,
+			created_at = EXCLUDED.created_at,
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at < NOW()
+	`
+
+	tag, err := r.db.Pool.Exec(ctx, query,
+		record.Scope, record.Key, record.Fingerprint, record.CreatedAt, record.ExpiresAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	if tag.RowsAffected() == 1 {
+		return nil, nil
+	}
+
+	existing := &models.IdempotencyRecord{}
+	err = r.db.Pool.QueryRow(ctx, `
+		SELECT scope, key, fingerprint, status_code, response, created_at, expires_at
+		FROM idempotency_keys
+		WHERE scope = $1 AND key = $2
+	`, record.Scope, record.Key).Scan(
+		&existing.Scope, &existing.Key, &existing.Fingerprint, &existing.StatusCode,
+		&existing.Response, &existing.CreatedAt, &existing.ExpiresAt,
+	)
+	if err == pgx.ErrNoRows {
+		// Released meanwhile; the client may retry
+		return nil, fmt.Errorf("idempotency key released concurrently")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+
+	return existing, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request holding a key
+func (r *Repository) CompleteIdempotencyKey(ctx context.Context, scope, key string, statusCode int, response []byte) error {
+	query := `
+		UPDATE idempotency_keys
+		SET status_code = $3, response = $4
+		WHERE scope = $1 AND key = $2
+	`
+
+	if _, err := r.db.Pool.Exec(ctx, query, scope, key, statusCode, response); err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey frees a key whose request did not complete, so it can
+// be retried
+func (r *Repository) ReleaseIdempotencyKey(ctx context.Context, scope, key string) error {
+	query := `DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND status_code = 0`
+
+	if _, err := r.db.Pool.Exec(ctx, query, scope, key); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys deletes keys past their expiry
+func (r *Repository) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	tag, err := r.db.Pool.Exec(ctx, "DELETE FROM idempotency_keys WHERE expires_at < NOW()")
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
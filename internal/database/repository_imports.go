@@ -0,0 +1,203 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+const importColumns = `
+	id, user_id, source_url, filename, expected_checksum, priority, jobs, status,
+	attempts, error_msg, video_id, size, checksum, watch_key, next_attempt_at,
+	created_at, updated_at, completed_at
+`
+
+// CreateImport creates an import. It returns false without creating it when
+// an import of the same watch folder file exists.
+func (r *Repository) CreateImport(ctx context.Context, imp *models.Import) (bool, error) {
+	jobs, err := json.Marshal(imp.Jobs)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal import jobs: %w", err)
+	}
+
+	query := `
+		INSERT INTO imports (id, user_id, source_url, filename, expected_checksum, priority, jobs,
+		                     status, video_id, watch_key, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW())
+		ON CONFLICT (watch_key) DO NOTHING
+		RETURNING next_attempt_at, created_at, updated_at
+	`
+
+	err = r.db.Pool.QueryRow(ctx, query,
+		imp.ID, imp.UserID, imp.SourceURL, imp.Filename, imp.ExpectedChecksum, imp.Priority,
+		jobs, imp.Status, imp.VideoID, imp.WatchKey,
+	).Scan(&imp.NextAttemptAt, &imp.CreatedAt, &imp.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create import: %w", err)
+	}
+
+	return true, nil
+}
+
+// GetImport retrieves an import by ID
+func (r *Repository) GetImport(ctx context.Context, id string) (*models.Import, error) {
+	row := r.db.Pool.QueryRow(ctx, `SELECT `+importColumns+` FROM imports WHERE id = $1`, id)
+
+	imp, err := scanImport(row)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("import not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get import: %w", err)
+	}
+
+	return imp, nil
+}
+
+// ClaimImport leases the next import due to be fetched, counting the attempt.
+// Imports whose lease expired, e.g. because their worker died, are claimed
+// again. It returns nil when no import is due.
+func (r *Repository) ClaimImport(ctx context.Context, leaseTTL time.Duration) (*models.Import, error) {
+	query := `
+		UPDATE imports
+		SET status = 'fetching', attempts = attempts + 1,
+		    lease_expires_at = NOW() + $1 * INTERVAL '1 second', updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM imports
+			WHERE (status = 'pending' AND next_attempt_at <= NOW())
+			OR (status = 'fetching' AND lease_expires_at < NOW())
+			ORDER BY next_attempt_at
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING ` + importColumns
+
+	imp, err := scanImport(r.db.Pool.QueryRow(ctx, query, leaseTTL.Seconds()))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim import: %w", err)
+	}
+
+	return imp, nil
+}
+
+// ExtendImportLease renews the lease of an import being fetched. It returns
+// false when the attempt lost the import, e.g. to another worker after its
+// lease expired.
+func (r *Repository) ExtendImportLease(ctx context.Context, id string, attempt int, leaseTTL time.Duration) (bool, error) {
+	query := `
+		UPDATE imports
+		SET lease_expires_at = NOW() + $3 * INTERVAL '1 second'
+		WHERE id = $1 AND attempts = $2 AND status = 'fetching'
+	`
+
+	tag, err := r.db.Pool.Exec(ctx, query, id, attempt, leaseTTL.Seconds())
+	if err != nil {
+		return false, fmt.Errorf("failed to extend import lease: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// CompleteImport creates the video and jobs of a fetched import and marks it
+// completed, in one transaction. It returns false, creating nothing, when the
+// attempt lost the import.
+func (r *Repository) CompleteImport(ctx context.Context, imp *models.Import, video *models.Video, jobs []*models.Job) (bool, error) {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE imports
+		SET status = 'completed', size = $3, checksum = $4, error_msg = '',
+		    lease_expires_at = NULL, completed_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND attempts = $2 AND status = 'fetching'
+	`
+
+	tag, err := tx.Exec(ctx, query, imp.ID, imp.Attempts, imp.Size, imp.Checksum)
+	if err != nil {
+		return false, fmt.Errorf("failed to complete import: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if err := tx.QueryRow(ctx, createVideoQuery, createVideoArgs(video)...).Scan(&video.DuplicateOf, &video.CreatedAt, &video.UpdatedAt); err != nil {
+		return false, fmt.Errorf("failed to create video: %w", err)
+	}
+
+	for _, job := range jobs {
+		if err := tx.QueryRow(ctx, createJobQuery, createJobArgs(job)...).Scan(&job.CreatedAt, &job.UpdatedAt); err != nil {
+			return false, fmt.Errorf("failed to create job: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+// RetryImport releases an import whose attempt failed, to be fetched again at
+// nextAttemptAt
+func (r *Repository) RetryImport(ctx context.Context, id string, attempt int, errorMsg string, nextAttemptAt time.Time) error {
+	query := `
+		UPDATE imports
+		SET status = 'pending', error_msg = $3, next_attempt_at = $4,
+		    lease_expires_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND attempts = $2 AND status = 'fetching'
+	`
+
+	if _, err := r.db.Pool.Exec(ctx, query, id, attempt, errorMsg, nextAttemptAt); err != nil {
+		return fmt.Errorf("failed to retry import: %w", err)
+	}
+	return nil
+}
+
+// FailImport marks an import failed for good
+func (r *Repository) FailImport(ctx context.Context, id string, attempt int, errorMsg string) error {
+	query := `
+		UPDATE imports
+		SET status = 'failed', error_msg = $3, lease_expires_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND attempts = $2 AND status = 'fetching'
+	`
+
+	if _, err := r.db.Pool.Exec(ctx, query, id, attempt, errorMsg); err != nil {
+		return fmt.Errorf("failed to fail import: %w", err)
+	}
+	return nil
+}
+
+// scanImport scans a row of importColumns
+func scanImport(row pgx.Row) (*models.Import, error) {
+	imp := &models.Import{}
+	var jobs []byte
+
+	err := row.Scan(
+		&imp.ID, &imp.UserID, &imp.SourceURL, &imp.Filename, &imp.ExpectedChecksum,
+		&imp.Priority, &jobs, &imp.Status, &imp.Attempts, &imp.ErrorMsg, &imp.VideoID,
+		&imp.Size, &imp.Checksum, &imp.WatchKey, &imp.NextAttemptAt, &imp.CreatedAt,
+		&imp.UpdatedAt, &imp.CompletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(jobs, &imp.Jobs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal import jobs: %w", err)
+	}
+
+	return imp, nil
+}
@@ -0,0 +1,257 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// GetLifecyclePolicy retrieves a tenant's lifecycle policy. Tenants without
+// one get a policy inheriting every default.
+func (r *Repository) GetLifecyclePolicy(ctx context.Context, userID string) (*models.LifecyclePolicy, error) {
+	query := `
+		SELECT user_id, delete_source_after_days, delete_unused_renditions_after_days,
+		       cold_storage_after_days, created_at, updated_at
+		FROM lifecycle_policies
+		WHERE user_id = $1
+	`
+
+	policy := &models.LifecyclePolicy{}
+	err := r.db.Pool.QueryRow(ctx, query, userID).Scan(
+		&policy.UserID, &policy.DeleteSourceAfterDays, &policy.DeleteUnusedRenditionsAfterDays,
+		&policy.ColdStorageAfterDays, &policy.CreatedAt, &policy.UpdatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return &models.LifecyclePolicy{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lifecycle policy: %w", err)
+	}
+
+	return policy, nil
+}
+
+// SaveLifecyclePolicy creates or replaces a tenant's lifecycle policy
+func (r *Repository) SaveLifecyclePolicy(ctx context.Context, policy *models.LifecyclePolicy) error {
+	query := `
+		INSERT INTO lifecycle_policies (user_id, delete_source_after_days,
+		                                delete_unused_renditions_after_days, cold_storage_after_days)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE SET
+			delete_source_after_days = EXCLUDED.delete_source_after_days,
+			delete_unused_renditions_after_days = EXCLUDED.delete_unused_renditions_after_days,
+			cold_storage_after_days = EXCLUDED.cold_storage_after_days,
+			updated_at = NOW()
+		RETURNING created_at, updated_at
+	`
+
+	err := r.db.Pool.QueryRow(ctx, query,
+		policy.UserID, policy.DeleteSourceAfterDays, policy.DeleteUnusedRenditionsAfterDays,
+		policy.ColdStorageAfterDays,
+	).Scan(&policy.CreatedAt, &policy.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save lifecycle policy: %w", err)
+	}
+
+	return nil
+}
+
+// ListExpiredSources lists completed videos whose original is older than
+// their tenant's delete_source_after_days, defaulting to defaultDays, and
+// that have no unfinished jobs
+func (r *Repository) ListExpiredSources(ctx context.Context, defaultDays, limit int) ([]*models.Video, error) {
+	query := `
+		SELECT v.id, v.original_url, v.size
+		FROM videos v
+		LEFT JOIN lifecycle_policies p ON p.user_id = v.user_id
+		WHERE v.original_url <> '' AND v.status = 'completed'
+		AND COALESCE(p.delete_source_after_days, $1) > 0
+		AND v.created_at < NOW() - make_interval(days => COALESCE(p.delete_source_after_days, $1))
+		AND NOT EXISTS (
+			SELECT 1 FROM jobs j
+			WHERE j.video_id = v.id AND j.status IN ('pending', 'queued', 'processing')
+		)
+		ORDER BY v.created_at
+		LIMIT $2
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, defaultDays, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired sources: %w", err)
+	}
+	defer rows.Close()
+
+	var videos []*models.Video
+	for rows.Next() {
+		video := &models.Video{}
+		if err := rows.Scan(&video.ID, &video.OriginalURL, &video.Size); err != nil {
+			return nil, fmt.Errorf("failed to scan video: %w", err)
+		}
+		videos = append(videos, video)
+	}
+
+	return videos, rows.Err()
+}
+
+// ClearVideoSource records that a video's original under key was deleted. It
+// returns false when the video no longer has that original.
+func (r *Repository) ClearVideoSource(ctx context.Context, videoID, key string) (bool, error) {
+	query := `
+		UPDATE videos
+		SET original_url = '', updated_at = NOW()
+		WHERE id = $1 AND original_url = $2
+	`
+
+	tag, err := r.db.Pool.Exec(ctx, query, videoID, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to clear video source: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// ListUnusedOutputs lists outputs not played within their tenant's
+// delete_unused_renditions_after_days, defaulting to defaultDays
+func (r *Repository) ListUnusedOutputs(ctx context.Context, defaultDays, limit int) ([]*models.Output, error) {
+	return r.listIdleOutputs(ctx, "delete_unused_renditions_after_days", "", defaultDays, limit)
+}
+
+// ListColdOutputs lists hot outputs not played within their tenant's
+// cold_storage_after_days, defaulting to defaultDays
+func (r *Repository) ListColdOutputs(ctx context.Context, defaultDays, limit int) ([]*models.Output, error) {
+	return r.listIdleOutputs(ctx, "cold_storage_after_days", models.StorageTierHot, defaultDays, limit)
+}
+
+// listIdleOutputs lists outputs, in tier unless empty, older than the days of
+// the policy column and without playback in that time. Playback events
+// without an output count for the outputs of their resolution.
+func (r *Repository) listIdleOutputs(ctx context.Context, column, tier string, defaultDays, limit int) ([]*models.Output, error) {
+	days := fmt.Sprintf("COALESCE(p.%s, $1)", column)
+	query := `
+		SELECT o.id, o.job_id, o.video_id, o.format, o.resolution, o.width, o.height, o.codec,
+		       o.bitrate, o.size, o.duration, o.url, o.path, o.rendition, o.storage_tier, o.created_at
+		FROM outputs o
+		JOIN videos v ON v.id = o.video_id
+		LEFT JOIN lifecycle_policies p ON p.user_id = v.user_id
+		WHERE ($3 = '' OR o.storage_tier = $3)
+		AND ` + days + ` > 0
+		AND o.created_at < NOW() - make_interval(days => ` + days + `)
+		AND NOT EXISTS (
+			SELECT 1 FROM playback_events e
+			WHERE e.video_id = o.video_id
+			AND e.timestamp > NOW() - make_interval(days => ` + days + `)
+			AND (e.output_id = o.id OR (e.output_id IS NULL AND e.resolution = o.resolution))
+		)
+		ORDER BY o.created_at
+		LIMIT $2
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, defaultDays, limit, tier)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list idle outputs: %w", err)
+	}
+	defer rows.Close()
+
+	var outputs []*models.Output
+	for rows.Next() {
+		var output models.Output
+		err := rows.Scan(
+			&output.ID, &output.JobID, &output.VideoID, &output.Format, &output.Resolution,
+			&output.Width, &output.Height, &output.Codec, &output.Bitrate, &output.Size,
+			&output.Duration, &output.URL, &output.Path, &output.Rendition, &output.StorageTier, &output.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan output: %w", err)
+		}
+		outputs = append(outputs, &output)
+	}
+
+	return outputs, rows.Err()
+}
+
+// DeleteOutput deletes an output record
+func (r *Repository) DeleteOutput(ctx context.Context, outputID string) error {
+	if _, err := r.db.Pool.Exec(ctx, "DELETE FROM outputs WHERE id = $1", outputID); err != nil {
+		return fmt.Errorf("failed to delete output: %w", err)
+	}
+	return nil
+}
+
+// MoveOutputToCold records that an output under path was moved to cold
+// storage, where it is served from url. It returns false when the output
+// changed meanwhile, e.g. because its job ran again.
+func (r *Repository) MoveOutputToCold(ctx context.Context, outputID, path, url string) (bool, error) {
+	query := `
+		UPDATE outputs
+		SET storage_tier = 'cold', url = $3
+		WHERE id = $1 AND path = $2 AND storage_tier = 'hot'
+	`
+
+	tag, err := r.db.Pool.Exec(ctx, query, outputID, path, url)
+	if err != nil {
+		return false, fmt.Errorf("failed to move output to cold storage: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// ListVideoObjects returns the storage keys referenced by the rows of each
+// of videoIDs that exists
+func (r *Repository) ListVideoObjects(ctx context.Context, videoIDs []string) (map[string]*models.VideoObjects, error) {
+	query := `
+		SELECT id, 'hot', original_url FROM videos WHERE id = ANY($1) AND original_url <> ''
+		UNION ALL
+		SELECT video_id, storage_tier, path FROM outputs WHERE video_id = ANY($1)
+		UNION ALL
+		SELECT video_id, 'hot', path FROM thumbnails WHERE video_id = ANY($1)
+		UNION ALL
+		SELECT video_id, 'hot', path FROM subtitles WHERE video_id = ANY($1)
+	`
+
+	objects := make(map[string]*models.VideoObjects, len(videoIDs))
+
+	// Videos without any referenced object exist all the same
+	rows, err := r.db.Pool.Query(ctx, "SELECT id FROM videos WHERE id = ANY($1)", videoIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list videos: %w", err)
+	}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan video: %w", err)
+		}
+		objects[id] = &models.VideoObjects{Hot: make(map[string]bool), Cold: make(map[string]bool)}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list videos: %w", err)
+	}
+
+	rows, err = r.db.Pool.Query(ctx, query, videoIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list video objects: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var videoID, tier, key string
+		if err := rows.Scan(&videoID, &tier, &key); err != nil {
+			return nil, fmt.Errorf("failed to scan video object: %w", err)
+		}
+		refs, ok := objects[videoID]
+		if !ok {
+			// Deleted between the queries; its objects are orphans
+			continue
+		}
+		if tier == models.StorageTierCold {
+			refs.Cold[key] = true
+		} else {
+			refs.Hot[key] = true
+		}
+	}
+
+	return objects, rows.Err()
+}
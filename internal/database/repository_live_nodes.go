@@ -0,0 +1,228 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// UpsertLiveNode registers a live node or refreshes its heartbeat and load
+func (r *Repository) UpsertLiveNode(ctx context.Context, node *models.LiveNode) error {
+	query := `
+		INSERT INTO live_nodes (id, host, rtmp_port, max_streams, active_streams, cpu_count, cpu_load)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET
+			host = EXCLUDED.host,
+			rtmp_port = EXCLUDED.rtmp_port,
+			max_streams = EXCLUDED.max_streams,
+			active_streams = EXCLUDED.active_streams,
+			cpu_count = EXCLUDED.cpu_count,
+			cpu_load = EXCLUDED.cpu_load,
+			heartbeat_at = NOW()
+		RETURNING started_at, heartbeat_at
+	`
+
+	err := r.db.Pool.QueryRow(ctx, query,
+		node.ID, node.Host, node.RTMPPort, node.MaxStreams, node.ActiveStreams, node.CPUCount, node.CPULoad,
+	).Scan(&node.StartedAt, &node.HeartbeatAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to upsert live node: %w", err)
+	}
+
+	return nil
+}
+
+// GetLiveNode retrieves a live node by ID
+func (r *Repository) GetLiveNode(ctx context.Context, id string) (*models.LiveNode, error) {
+	query := `
+		SELECT id, host, rtmp_port, max_streams, active_streams, cpu_count, cpu_load, started_at, heartbeat_at
+		FROM live_nodes
+		WHERE id = $1
+	`
+
+	node := &models.LiveNode{}
+	err := r.db.Pool.QueryRow(ctx, query, id).Scan(
+		&node.ID, &node.Host, &node.RTMPPort, &node.MaxStreams, &node.ActiveStreams,
+		&node.CPUCount, &node.CPULoad, &node.StartedAt, &node.HeartbeatAt,
+	)
+
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("live node not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get live node: %w", err)
+	}
+
+	return node, nil
+}
+
+// ListLiveNodes lists the live nodes that sent a heartbeat after since
+func (r *Repository) ListLiveNodes(ctx context.Context, since time.Time) ([]*models.LiveNode, error) {
+	query := `
+		SELECT id, host, rtmp_port, max_streams, active_streams, cpu_count, cpu_load, started_at, heartbeat_at
+		FROM live_nodes
+		WHERE heartbeat_at >= $1
+		ORDER BY id ASC
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list live nodes: %w", err)
+	}
+	defer rows.Close()
+
+	var nodes []*models.LiveNode
+	for rows.Next() {
+		node := &models.LiveNode{}
+		if err := rows.Scan(
+			&node.ID, &node.Host, &node.RTMPPort, &node.MaxStreams, &node.ActiveStreams,
+			&node.CPUCount, &node.CPULoad, &node.StartedAt, &node.HeartbeatAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan live node: %w", err)
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, rows.Err()
+}
+
+// DeleteLiveNode removes a live node from the registry
+func (r *Repository) DeleteLiveNode(ctx context.Context, id string) error {
+	_, err := r.db.Pool.Exec(ctx, "DELETE FROM live_nodes WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete live node: %w", err)
+	}
+	return nil
+}
+
+// AcquireLiveStreamLease takes ownership of a live stream for nodeID. The lease
+// is granted when the stream is unowned, already owned by nodeID or the current
+// lease has expired. Otherwise the current lease is returned with acquired false.
+func (r *Repository) AcquireLiveStreamLease(ctx context.Context, streamID, nodeID string, ttl time.Duration) (*models.LiveStreamLease, bool, error) {
+	query := `
+		INSERT INTO live_stream_leases (live_stream_id, node_id, expires_at)
+		VALUES ($1, $2, NOW() + $3 * INTERVAL '1 second')
+		ON CONFLICT (live_stream_id) DO UPDATE SET
+			node_id = EXCLUDED.node_id,
+			generation = CASE WHEN live_stream_leases.node_id = EXCLUDED.node_id
+				THEN live_stream_leases.generation ELSE live_stream_leases.generation + 1 END,
+			acquired_at = CASE WHEN live_stream_leases.node_id = EXCLUDED.node_id
+				THEN live_stream_leases.acquired_at ELSE NOW() END,
+			expires_at = EXCLUDED.expires_at
+		WHERE live_stream_leases.node_id = EXCLUDED.node_id OR live_stream_leases.expires_at < NOW()
+		RETURNING live_stream_id, node_id, generation, acquired_at, expires_at
+	`
+
+	lease := &models.LiveStreamLease{}
+	err := r.db.Pool.QueryRow(ctx, query, streamID, nodeID, ttl.Seconds()).Scan(
+		&lease.LiveStreamID, &lease.NodeID, &lease.Generation, &lease.AcquiredAt, &lease.ExpiresAt,
+	)
+
+	if err == pgx.ErrNoRows {
+		// Another node holds a valid lease
+		current, err := r.GetLiveStreamLease(ctx, streamID)
+		if err != nil {
+			return nil, false, err
+		}
+		return current, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to acquire live stream lease: %w", err)
+	}
+
+	return lease, true, nil
+}
+
+// GetLiveStreamLease retrieves the ownership lease of a live stream
+func (r *Repository) GetLiveStreamLease(ctx context.Context, streamID string) (*models.LiveStreamLease, error) {
+	query := `
+		SELECT live_stream_id, node_id, generation, acquired_at, expires_at
+		FROM live_stream_leases
+		WHERE live_stream_id = $1
+	`
+
+	lease := &models.LiveStreamLease{}
+	err := r.db.Pool.QueryRow(ctx, query, streamID).Scan(
+		&lease.LiveStreamID, &lease.NodeID, &lease.Generation, &lease.AcquiredAt, &lease.ExpiresAt,
+	)
+
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("live stream lease not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get live stream lease: %w", err)
+	}
+
+	return lease, nil
+}
+
+// RenewLiveStreamLeases extends every lease still held by nodeID and returns
+// the IDs of the streams the node owns
+func (r *Repository) RenewLiveStreamLeases(ctx context.Context, nodeID string, ttl time.Duration) ([]string, error) {
+	query := `
+		UPDATE live_stream_leases
+		SET expires_at = NOW() + $2 * INTERVAL '1 second'
+		WHERE node_id = $1
+		RETURNING live_stream_id
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, nodeID, ttl.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to renew live stream leases: %w", err)
+	}
+	defer rows.Close()
+
+	var streamIDs []string
+	for rows.Next() {
+		var streamID string
+		if err := rows.Scan(&streamID); err != nil {
+			return nil, fmt.Errorf("failed to scan live stream lease: %w", err)
+		}
+		streamIDs = append(streamIDs, streamID)
+	}
+
+	return streamIDs, rows.Err()
+}
+
+// ReleaseLiveStreamLease gives up ownership of a live stream held by nodeID
+func (r *Repository) ReleaseLiveStreamLease(ctx context.Context, streamID, nodeID string) error {
+	_, err := r.db.Pool.Exec(ctx,
+		"DELETE FROM live_stream_leases WHERE live_stream_id = $1 AND node_id = $2", streamID, nodeID)
+	if err != nil {
+		return fmt.Errorf("failed to release live stream lease: %w", err)
+	}
+	return nil
+}
+
+// ListOrphanedLiveStreams lists active live streams whose owning node let the lease expire
+func (r *Repository) ListOrphanedLiveStreams(ctx context.Context) ([]string, error) {
+	query := `
+		SELECT s.id
+		FROM live_streams s
+		JOIN live_stream_leases l ON l.live_stream_id = s.id
+		WHERE s.status IN ($1, $2)
+		AND l.expires_at < NOW()
+		ORDER BY l.expires_at ASC
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, models.LiveStreamStatusStarting, models.LiveStreamStatusLive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orphaned live streams: %w", err)
+	}
+	defer rows.Close()
+
+	var streamIDs []string
+	for rows.Next() {
+		var streamID string
+		if err := rows.Scan(&streamID); err != nil {
+			return nil, fmt.Errorf("failed to scan orphaned live stream: %w", err)
+		}
+		streamIDs = append(streamIDs, streamID)
+	}
+
+	return streamIDs, rows.Err()
+}
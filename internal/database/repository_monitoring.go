@@ -64,14 +64,12 @@ func (r *Repository) GetAverageProcessTime(ctx context.Context) (float64, error)
 	return avgProcessTime, nil
 }
 
-// GetActiveWorkers returns the number of active workers
+// GetActiveWorkers returns the number of registered workers seen in the last 5 minutes
 func (r *Repository) GetActiveWorkers(ctx context.Context) (int, error) {
 	query := `
-		SELECT COUNT(DISTINCT worker_id)
-		FROM jobs
-		WHERE worker_id IS NOT NULL
-		AND worker_id != ''
-		AND updated_at > NOW() - INTERVAL '5 minutes'
+		SELECT COUNT(*)
+		FROM workers
+		WHERE heartbeat_at > NOW() - INTERVAL '5 minutes'
 	`
 
 	var count int
@@ -55,7 +55,8 @@ func (r *Repository) CreateUser(ctx context.Context, user *models.User, password
 // GetUserByEmail retrieves a user by email
 func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-		SELECT id, email, password_hash, api_key, quota, used_quota, quota_reset_at, is_active, created_at, updated_at
+		SELECT id, email, password_hash, api_key, quota, used_quota, quota_reset_at, is_active,
+		       max_concurrent_jobs, scheduling_weight, role, created_at, updated_at
 		FROM users
 		WHERE email = $1
 	`
@@ -70,6 +71,9 @@ func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*models.
 		&user.UsedQuota,
 		&user.QuotaResetAt,
 		&user.IsActive,
+		&user.MaxConcurrentJobs,
+		&user.SchedulingWeight,
+		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -88,7 +92,8 @@ func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*models.
 // GetUserByID retrieves a user by ID
 func (r *Repository) GetUserByID(ctx context.Context, userID string) (*models.User, error) {
 	query := `
-		SELECT id, email, password_hash, api_key, quota, used_quota, quota_reset_at, is_active, created_at, updated_at
+		SELECT id, email, password_hash, api_key, quota, used_quota, quota_reset_at, is_active,
+		       max_concurrent_jobs, scheduling_weight, role, created_at, updated_at
 		FROM users
 		WHERE id = $1
 	`
@@ -103,6 +108,9 @@ func (r *Repository) GetUserByID(ctx context.Context, userID string) (*models.Us
 		&user.UsedQuota,
 		&user.QuotaResetAt,
 		&user.IsActive,
+		&user.MaxConcurrentJobs,
+		&user.SchedulingWeight,
+		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -121,7 +129,8 @@ func (r *Repository) GetUserByID(ctx context.Context, userID string) (*models.Us
 // ValidateAPIKey validates an API key and returns the user
 func (r *Repository) ValidateAPIKey(ctx context.Context, apiKey string) (*models.User, error) {
 	query := `
-		SELECT id, email, password_hash, api_key, quota, used_quota, quota_reset_at, is_active, created_at, updated_at
+		SELECT id, email, password_hash, api_key, quota, used_quota, quota_reset_at, is_active,
+		       max_concurrent_jobs, scheduling_weight, role, created_at, updated_at
 		FROM users
 		WHERE api_key = $1
 	`
@@ -136,6 +145,9 @@ func (r *Repository) ValidateAPIKey(ctx context.Context, apiKey string) (*models
 		&user.UsedQuota,
 		&user.QuotaResetAt,
 		&user.IsActive,
+		&user.MaxConcurrentJobs,
+		&user.SchedulingWeight,
+		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -234,6 +246,8 @@ func (r *Repository) GetWebhooksByEvent(ctx context.Context, event string) ([]*m
 		eventField = "job_progress"
 	case models.WebhookEventVideoUploaded:
 		eventField = "video_uploaded"
+	case models.WebhookEventBatchCompleted:
+		eventField = "batch_completed"
 	default:
 		return nil, fmt.Errorf("unknown event: %s", event)
 	}
@@ -312,14 +326,16 @@ func (r *Repository) GetUserWebhooks(ctx context.Context, userID string) ([]*mod
 
 // Webhook delivery methods
 
-// CreateDelivery creates a new webhook delivery record
-func (r *Repository) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+// CreateDelivery creates a new webhook delivery record. It returns false when
+// the webhook already has a delivery with the same idempotency key.
+func (r *Repository) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) (bool, error) {
 	query := `
-		INSERT INTO webhook_deliveries (id, webhook_id, event, payload, status, status_code, response_body, retry_count, next_retry_at, created_at, completed_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, CURRENT_TIMESTAMP, $10)
+		INSERT INTO webhook_deliveries (id, webhook_id, event, payload, status, status_code, response_body, retry_count, next_retry_at, created_at, completed_at, idempotency_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, CURRENT_TIMESTAMP, $10, NULLIF($11, ''))
+		ON CONFLICT (webhook_id, idempotency_key) WHERE idempotency_key IS NOT NULL DO NOTHING
 	`
 
-	_, err := r.db.Exec(ctx, query,
+	tag, err := r.db.Pool.Exec(ctx, query,
 		delivery.ID,
 		delivery.WebhookID,
 		delivery.Event,
@@ -330,13 +346,14 @@ func (r *Repository) CreateDelivery(ctx context.Context, delivery *models.Webhoo
 		delivery.RetryCount,
 		delivery.NextRetryAt,
 		delivery.CompletedAt,
+		delivery.IdempotencyKey,
 	)
 
 	if err != nil {
-		return fmt.Errorf("failed to create delivery: %w", err)
+		return false, fmt.Errorf("failed to create delivery: %w", err)
 	}
 
-	return nil
+	return tag.RowsAffected() == 1, nil
 }
 
 // UpdateDelivery updates a webhook delivery record
@@ -425,17 +442,24 @@ func (r *Repository) UpdateJobStatus(ctx context.Context, jobID, status string)
 	return err
 }
 
-// GetPendingJobs retrieves pending jobs
+// GetPendingJobs retrieves pending jobs that are due to run and whose
+// dependencies have completed
 func (r *Repository) GetPendingJobs(ctx context.Context, limit int) ([]*models.Job, error) {
 	query := `
-		SELECT id, video_id, status, priority, progress, error_msg, retry_count, worker_id, started_at, completed_at, created_at, updated_at, config
+		SELECT id, video_id, user_id, status, priority, progress, error_msg, retry_count, worker_id, started_at, completed_at, created_at, updated_at, config,
+		       requirements, estimated_cost, pool, run_at, batch_id, depends_on, reused_from_job_id, type, result
 		FROM jobs
 		WHERE status = $1
+		AND (run_at IS NULL OR run_at <= NOW())
+		AND NOT EXISTS (
+			SELECT 1 FROM jobs d
+			WHERE d.id = ANY(jobs.depends_on) AND d.status <> $3
+		)
 		ORDER BY priority DESC, created_at ASC
 		LIMIT $2
 	`
 
-	rows, err := r.db.Query(ctx, query, models.JobStatusPending, limit)
+	rows, err := r.db.Query(ctx, query, models.JobStatusPending, limit, models.JobStatusCompleted)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get pending jobs: %w", err)
 	}
@@ -447,6 +471,7 @@ func (r *Repository) GetPendingJobs(ctx context.Context, limit int) ([]*models.J
 		err := rows.Scan(
 			&job.ID,
 			&job.VideoID,
+			&job.UserID,
 			&job.Status,
 			&job.Priority,
 			&job.Progress,
@@ -458,6 +483,15 @@ func (r *Repository) GetPendingJobs(ctx context.Context, limit int) ([]*models.J
 			&job.CreatedAt,
 			&job.UpdatedAt,
 			&job.Config,
+			&job.Requirements,
+			&job.EstimatedCost,
+			&job.Pool,
+			&job.RunAt,
+			&job.BatchID,
+			&job.DependsOn,
+			&job.ReusedFromJobID,
+			&job.Type,
+			&job.Result,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan job: %w", err)
@@ -457,7 +457,7 @@ func (r *Repository) GetQualityPresetByName(ctx context.Context, name string) (*
 func (r *Repository) GetOutput(ctx context.Context, outputID string) (*models.Output, error) {
 	query := `
 		SELECT id, job_id, video_id, format, resolution, width, height,
-			codec, bitrate, size, duration, url, path, created_at
+			codec, bitrate, size, duration, url, path, rendition, storage_tier, created_at
 		FROM outputs
 		WHERE id = $1
 	`
@@ -466,7 +466,7 @@ func (r *Repository) GetOutput(ctx context.Context, outputID string) (*models.Ou
 	err := r.db.QueryRow(ctx, query, outputID).Scan(
 		&output.ID, &output.JobID, &output.VideoID, &output.Format, &output.Resolution,
 		&output.Width, &output.Height, &output.Codec, &output.Bitrate, &output.Size,
-		&output.Duration, &output.URL, &output.Path, &output.CreatedAt,
+		&output.Duration, &output.URL, &output.Path, &output.Rendition, &output.StorageTier, &output.CreatedAt,
 	)
 
 	if err != nil {
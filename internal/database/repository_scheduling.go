@@ -0,0 +1,275 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// ClaimPendingJob moves a pending job to queued for dispatch. It returns false
+// when the job is no longer pending, e.g. dispatched by another scheduler.
+func (r *Repository) ClaimPendingJob(ctx context.Context, jobID string) (bool, error) {
+	tag, err := r.db.Pool.Exec(ctx,
+		"UPDATE jobs SET status = $2 WHERE id = $1 AND status = $3",
+		jobID, models.JobStatusQueued, models.JobStatusPending)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim pending job: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// GetInFlightJobs retrieves jobs dispatched to the queue that have not finished
+func (r *Repository) GetInFlightJobs(ctx context.Context, limit int) ([]*models.Job, error) {
+	query := `
+		SELECT id, video_id, user_id, status, priority, progress, COALESCE(error_msg, ''), retry_count,
+		       COALESCE(worker_id, ''), started_at, completed_at, created_at, updated_at, config,
+		       requirements, estimated_cost, pool, run_at, batch_id, depends_on, reused_from_job_id, type, result
+		FROM jobs
+		WHERE status IN ($1, $2)
+		ORDER BY created_at ASC
+		LIMIT $3
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, models.JobStatusQueued, models.JobStatusProcessing, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get in-flight jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*models.Job
+	for rows.Next() {
+		job := &models.Job{}
+		if err := rows.Scan(
+			&job.ID, &job.VideoID, &job.UserID, &job.Status, &job.Priority, &job.Progress,
+			&job.ErrorMsg, &job.RetryCount, &job.WorkerID, &job.StartedAt,
+			&job.CompletedAt, &job.CreatedAt, &job.UpdatedAt, &job.Config,
+			&job.Requirements, &job.EstimatedCost, &job.Pool, &job.RunAt, &job.BatchID, &job.DependsOn, &job.ReusedFromJobID, &job.Type, &job.Result,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// GetStaleQueuedJobs retrieves jobs queued since before cutoff, which may never
+// have reached the queue
+func (r *Repository) GetStaleQueuedJobs(ctx context.Context, cutoff time.Time, limit int) ([]*models.Job, error) {
+	query := `
+		SELECT id, video_id, user_id, status, priority, progress, COALESCE(error_msg, ''), retry_count,
+		       COALESCE(worker_id, ''), started_at, completed_at, created_at, updated_at, config,
+		       requirements, estimated_cost, pool, run_at, batch_id, depends_on, reused_from_job_id, type, result
+		FROM jobs
+		WHERE status = $1 AND updated_at < $2
+		ORDER BY updated_at ASC
+		LIMIT $3
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, models.JobStatusQueued, cutoff, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stale queued jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*models.Job
+	for rows.Next() {
+		job := &models.Job{}
+		if err := rows.Scan(
+			&job.ID, &job.VideoID, &job.UserID, &job.Status, &job.Priority, &job.Progress,
+			&job.ErrorMsg, &job.RetryCount, &job.WorkerID, &job.StartedAt,
+			&job.CompletedAt, &job.CreatedAt, &job.UpdatedAt, &job.Config,
+			&job.Requirements, &job.EstimatedCost, &job.Pool, &job.RunAt, &job.BatchID, &job.DependsOn, &job.ReusedFromJobID, &job.Type, &job.Result,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// TouchQueuedJob restarts the dispatch timeout of a job still queued. It
+// returns false when the job has moved on.
+func (r *Repository) TouchQueuedJob(ctx context.Context, jobID string) (bool, error) {
+	tag, err := r.db.Pool.Exec(ctx,
+		"UPDATE jobs SET updated_at = NOW() WHERE id = $1 AND status = $2",
+		jobID, models.JobStatusQueued)
+	if err != nil {
+		return false, fmt.Errorf("failed to touch queued job: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// AcquireSchedulerLease takes or renews the named lease for holder. It is
+// granted when the lease is free, already held by holder or expired.
+func (r *Repository) AcquireSchedulerLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	query := `
+		INSERT INTO scheduler_leases (name, holder, expires_at)
+		VALUES ($1, $2, NOW() + $3 * INTERVAL '1 second')
+		ON CONFLICT (name) DO UPDATE SET
+			holder = EXCLUDED.holder,
+			acquired_at = CASE WHEN scheduler_leases.holder = EXCLUDED.holder
+				THEN scheduler_leases.acquired_at ELSE NOW() END,
+			expires_at = EXCLUDED.expires_at
+		WHERE scheduler_leases.holder = EXCLUDED.holder OR scheduler_leases.expires_at < NOW()
+	`
+
+	tag, err := r.db.Pool.Exec(ctx, query, name, holder, ttl.Seconds())
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire scheduler lease: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ReleaseSchedulerLease gives up the named lease if holder has it
+func (r *Repository) ReleaseSchedulerLease(ctx context.Context, name, holder string) error {
+	_, err := r.db.Pool.Exec(ctx, "DELETE FROM scheduler_leases WHERE name = $1 AND holder = $2", name, holder)
+	if err != nil {
+		return fmt.Errorf("failed to release scheduler lease: %w", err)
+	}
+	return nil
+}
+
+// CreateRecurringJob creates a recurring job definition
+func (r *Repository) CreateRecurringJob(ctx context.Context, rj *models.RecurringJob) error {
+	if rj.ID == "" {
+		rj.ID = uuid.New().String()
+	}
+
+	query := `
+		INSERT INTO recurring_jobs (id, user_id, video_id, name, schedule, timezone, priority, config,
+		                            requirements, enabled, next_run_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING created_at, updated_at
+	`
+
+	err := r.db.Pool.QueryRow(ctx, query,
+		rj.ID, rj.UserID, rj.VideoID, rj.Name, rj.Schedule, rj.Timezone, rj.Priority, rj.Config,
+		rj.Requirements, rj.Enabled, rj.NextRunAt,
+	).Scan(&rj.CreatedAt, &rj.UpdatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create recurring job: %w", err)
+	}
+
+	return nil
+}
+
+// GetRecurringJob retrieves a recurring job definition by ID
+func (r *Repository) GetRecurringJob(ctx context.Context, id string) (*models.RecurringJob, error) {
+	query := `
+		SELECT id, user_id, video_id, name, schedule, timezone, priority, config, requirements, enabled,
+		       next_run_at, last_run_at, last_job_id, created_at, updated_at
+		FROM recurring_jobs
+		WHERE id = $1
+	`
+
+	rj := &models.RecurringJob{}
+	err := r.db.Pool.QueryRow(ctx, query, id).Scan(
+		&rj.ID, &rj.UserID, &rj.VideoID, &rj.Name, &rj.Schedule, &rj.Timezone, &rj.Priority, &rj.Config,
+		&rj.Requirements, &rj.Enabled, &rj.NextRunAt, &rj.LastRunAt, &rj.LastJobID, &rj.CreatedAt, &rj.UpdatedAt,
+	)
+
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("recurring job not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recurring job: %w", err)
+	}
+
+	return rj, nil
+}
+
+// ListRecurringJobs lists the recurring job definitions of a user
+func (r *Repository) ListRecurringJobs(ctx context.Context, userID string) ([]*models.RecurringJob, error) {
+	query := `
+		SELECT id, user_id, video_id, name, schedule, timezone, priority, config, requirements, enabled,
+		       next_run_at, last_run_at, last_job_id, created_at, updated_at
+		FROM recurring_jobs
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+
+	return r.queryRecurringJobs(ctx, query, userID)
+}
+
+// ListDueRecurringJobs lists enabled recurring jobs whose next run is at or before now
+func (r *Repository) ListDueRecurringJobs(ctx context.Context, now time.Time, limit int) ([]*models.RecurringJob, error) {
+	query := `
+		SELECT id, user_id, video_id, name, schedule, timezone, priority, config, requirements, enabled,
+		       next_run_at, last_run_at, last_job_id, created_at, updated_at
+		FROM recurring_jobs
+		WHERE enabled AND next_run_at <= $1
+		ORDER BY next_run_at ASC
+		LIMIT $2
+	`
+
+	return r.queryRecurringJobs(ctx, query, now, limit)
+}
+
+func (r *Repository) queryRecurringJobs(ctx context.Context, query string, args ...interface{}) ([]*models.RecurringJob, error) {
+	rows, err := r.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recurring jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*models.RecurringJob
+	for rows.Next() {
+		rj := &models.RecurringJob{}
+		if err := rows.Scan(
+			&rj.ID, &rj.UserID, &rj.VideoID, &rj.Name, &rj.Schedule, &rj.Timezone, &rj.Priority, &rj.Config,
+			&rj.Requirements, &rj.Enabled, &rj.NextRunAt, &rj.LastRunAt, &rj.LastJobID, &rj.CreatedAt, &rj.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan recurring job: %w", err)
+		}
+		jobs = append(jobs, rj)
+	}
+
+	return jobs, rows.Err()
+}
+
+// AdvanceRecurringJob records a run of a recurring job as jobID and moves its
+// next run from `from` to next. It returns false when the run was already
+// taken, so a schedule fires once even if several schedulers see it due.
+func (r *Repository) AdvanceRecurringJob(ctx context.Context, id string, from, next time.Time, jobID string) (bool, error) {
+	query := `
+		UPDATE recurring_jobs
+		SET next_run_at = $3, last_run_at = NOW(), last_job_id = $4
+		WHERE id = $1 AND next_run_at = $2 AND enabled
+	`
+
+	tag, err := r.db.Pool.Exec(ctx, query, id, from, next, jobID)
+	if err != nil {
+		return false, fmt.Errorf("failed to advance recurring job: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// SetRecurringJobEnabled pauses or resumes a recurring job. Resuming sets the
+// next run so missed runs are skipped.
+func (r *Repository) SetRecurringJobEnabled(ctx context.Context, id string, enabled bool, nextRunAt time.Time) error {
+	tag, err := r.db.Pool.Exec(ctx,
+		"UPDATE recurring_jobs SET enabled = $2, next_run_at = $3 WHERE id = $1", id, enabled, nextRunAt)
+	if err != nil {
+		return fmt.Errorf("failed to update recurring job: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("recurring job not found")
+	}
+	return nil
+}
+
+// DeleteRecurringJob deletes a recurring job definition
+func (r *Repository) DeleteRecurringJob(ctx context.Context, id string) error {
+	_, err := r.db.Pool.Exec(ctx, "DELETE FROM recurring_jobs WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete recurring job: %w", err)
+	}
+	return nil
+}
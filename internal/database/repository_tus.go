@@ -0,0 +1,172 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+const tusUploadColumns = `
+	id, user_id, upload_length, upload_offset, metadata, chunks, status,
+	video_id, storage_key, created_at, updated_at, expires_at
+`
+
+// CreateTusUpload creates a tus upload
+func (r *Repository) CreateTusUpload(ctx context.Context, upload *models.TusUpload) error {
+	metadata, err := json.Marshal(upload.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal upload metadata: %w", err)
+	}
+
+	query := `
+		INSERT INTO tus_uploads (id, user_id, upload_length, upload_offset, metadata, chunks,
+		                         status, video_id, storage_key, created_at, updated_at, expires_at)
+		VALUES ($1, $2, $3, 0, $4, '[]'::jsonb, $5, $6, $7, $8, $8, $9)
+	`
+
+	_, err = r.db.Pool.Exec(ctx, query,
+		upload.ID, upload.UserID, upload.Length, metadata, upload.Status,
+		upload.VideoID, upload.StorageKey, upload.CreatedAt, upload.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create tus upload: %w", err)
+	}
+
+	return nil
+}
+
+// GetTusUpload retrieves a tus upload by ID
+func (r *Repository) GetTusUpload(ctx context.Context, id string) (*models.TusUpload, error) {
+	row := r.db.Pool.QueryRow(ctx, `SELECT `+tusUploadColumns+` FROM tus_uploads WHERE id = $1`, id)
+
+	upload, err := scanTusUpload(row)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("tus upload not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tus upload: %w", err)
+	}
+
+	return upload, nil
+}
+
+// AppendTusChunk records a chunk received at the upload's current offset. It
+// returns false when the offset moved meanwhile, e.g. by a concurrent PATCH,
+// or the upload is no longer active.
+func (r *Repository) AppendTusChunk(ctx context.Context, id string, chunk models.TusChunk) (bool, error) {
+	chunkJSON, err := json.Marshal([]models.TusChunk{chunk})
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal chunk: %w", err)
+	}
+
+	query := `
+		UPDATE tus_uploads
+		SET upload_offset = upload_offset + $3, chunks = chunks || $4::jsonb, updated_at = NOW()
+		WHERE id = $1 AND upload_offset = $2 AND upload_offset + $3 <= upload_length
+		AND status = 'active' AND expires_at > NOW()
+	`
+
+	tag, err := r.db.Pool.Exec(ctx, query, id, chunk.Offset, chunk.Size, chunkJSON)
+	if err != nil {
+		return false, fmt.Errorf("failed to append tus chunk: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// CompleteTusUpload marks a fully received upload completed once its chunks
+// were assembled, forgetting the chunks
+func (r *Repository) CompleteTusUpload(ctx context.Context, id string) error {
+	query := `
+		UPDATE tus_uploads
+		SET status = 'completed', chunks = '[]'::jsonb, updated_at = NOW()
+		WHERE id = $1 AND upload_offset = upload_length
+	`
+
+	tag, err := r.db.Pool.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to complete tus upload: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("tus upload not found")
+	}
+
+	return nil
+}
+
+// DeleteTusUpload deletes a tus upload
+func (r *Repository) DeleteTusUpload(ctx context.Context, id string) error {
+	if _, err := r.db.Pool.Exec(ctx, "DELETE FROM tus_uploads WHERE id = $1", id); err != nil {
+		return fmt.Errorf("failed to delete tus upload: %w", err)
+	}
+	return nil
+}
+
+// ListExpiredTusUploads returns uploads past their expiry
+func (r *Repository) ListExpiredTusUploads(ctx context.Context, limit int) ([]*models.TusUpload, error) {
+	return r.listTusUploads(ctx, `
+		SELECT `+tusUploadColumns+` FROM tus_uploads
+		WHERE expires_at < NOW()
+		ORDER BY expires_at
+		LIMIT $1
+	`, limit)
+}
+
+// ListStalledTusUploads returns fully received uploads that were not
+// completed for olderThan, e.g. because the API crashed while assembling them
+func (r *Repository) ListStalledTusUploads(ctx context.Context, olderThan time.Duration, limit int) ([]*models.TusUpload, error) {
+	return r.listTusUploads(ctx, `
+		SELECT `+tusUploadColumns+` FROM tus_uploads
+		WHERE status = 'active' AND upload_offset = upload_length
+		AND updated_at < NOW() - $2 * INTERVAL '1 second'
+		ORDER BY updated_at
+		LIMIT $1
+	`, limit, olderThan.Seconds())
+}
+
+func (r *Repository) listTusUploads(ctx context.Context, query string, args ...interface{}) ([]*models.TusUpload, error) {
+	rows, err := r.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tus uploads: %w", err)
+	}
+	defer rows.Close()
+
+	var uploads []*models.TusUpload
+	for rows.Next() {
+		upload, err := scanTusUpload(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan tus upload: %w", err)
+		}
+		uploads = append(uploads, upload)
+	}
+
+	return uploads, rows.Err()
+}
+
+// scanTusUpload scans a row of tusUploadColumns
+func scanTusUpload(row pgx.Row) (*models.TusUpload, error) {
+	upload := &models.TusUpload{}
+	var metadata, chunks []byte
+
+	err := row.Scan(
+		&upload.ID, &upload.UserID, &upload.Length, &upload.Offset, &metadata, &chunks,
+		&upload.Status, &upload.VideoID, &upload.StorageKey, &upload.CreatedAt,
+		&upload.UpdatedAt, &upload.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(metadata, &upload.Metadata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal upload metadata: %w", err)
+	}
+	if err := json.Unmarshal(chunks, &upload.Chunks); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal upload chunks: %w", err)
+	}
+
+	return upload, nil
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+const multipartUploadColumns = `
+	id, mode, filename, total_size, part_size, total_parts, status, video_id,
+	storage_key, storage_upload_id, checksum, created_at, expires_at, completed_at
+`
+
+// CreateMultipartUpload creates a multipart upload session
+func (r *Repository) CreateMultipartUpload(ctx context.Context, upload *models.MultipartUpload) error {
+	query := `
+		INSERT INTO multipart_uploads (id, mode, filename, total_size, part_size, total_parts, status,
+		                               video_id, storage_key, storage_upload_id, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+
+	_, err := r.db.Pool.Exec(ctx, query,
+		upload.ID, upload.Mode, upload.Filename, upload.TotalSize, upload.PartSize,
+		upload.TotalParts, upload.Status, upload.VideoID, upload.StorageKey,
+		upload.StorageUploadID, upload.CreatedAt, upload.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+
+	return nil
+}
+
+// GetMultipartUpload retrieves a multipart upload session with its parts
+func (r *Repository) GetMultipartUpload(ctx context.Context, id string) (*models.MultipartUpload, error) {
+	row := r.db.Pool.QueryRow(ctx, `SELECT `+multipartUploadColumns+` FROM multipart_uploads WHERE id = $1`, id)
+
+	upload, err := scanMultipartUpload(row)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("upload not found: %s", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get multipart upload: %w", err)
+	}
+
+	parts, err := r.ListUploadParts(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range parts {
+		upload.Parts[part.PartNumber] = part
+	}
+
+	return upload, nil
+}
+
+// SaveUploadPart records a part of an active upload, replacing an earlier
+// upload of the same part. It returns the replaced part's storage key, if any.
+func (r *Repository) SaveUploadPart(ctx context.Context, uploadID string, part *models.UploadPart) (string, error) {
+	query := `
+		WITH previous AS (
+			SELECT storage_key FROM multipart_upload_parts WHERE upload_id = $1 AND part_number = $2
+		)
+		INSERT INTO multipart_upload_parts (upload_id, part_number, size, etag, sha256, storage_key, uploaded_at)
+		SELECT id, $2, $3, $4, $5, $6, $7 FROM multipart_uploads
+		WHERE id = $1 AND status = 'active' AND expires_at > NOW()
+		ON CONFLICT (upload_id, part_number) DO UPDATE
+		SET size = EXCLUDED.size, etag = EXCLUDED.etag, sha256 = EXCLUDED.sha256,
+		    storage_key = EXCLUDED.storage_key, uploaded_at = EXCLUDED.uploaded_at
+		RETURNING COALESCE((SELECT storage_key FROM previous), '')
+	`
+
+	var previousKey string
+	err := r.db.Pool.QueryRow(ctx, query,
+		uploadID, part.PartNumber, part.Size, part.ETag, part.SHA256, part.Key, part.UploadedAt,
+	).Scan(&previousKey)
+	if err == pgx.ErrNoRows {
+		return "", fmt.Errorf("upload is not active")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to save upload part: %w", err)
+	}
+
+	return previousKey, nil
+}
+
+// ListUploadParts returns the received parts of an upload by part number
+func (r *Repository) ListUploadParts(ctx context.Context, uploadID string) ([]*models.UploadPart, error) {
+	query := `
+		SELECT part_number, size, etag, sha256, storage_key, uploaded_at
+		FROM multipart_upload_parts
+		WHERE upload_id = $1
+		ORDER BY part_number
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, uploadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list upload parts: %w", err)
+	}
+	defer rows.Close()
+
+	var parts []*models.UploadPart
+	for rows.Next() {
+		part := &models.UploadPart{Uploaded: true}
+		err := rows.Scan(&part.PartNumber, &part.Size, &part.ETag, &part.SHA256, &part.Key, &part.UploadedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan upload part: %w", err)
+		}
+		parts = append(parts, part)
+	}
+
+	return parts, rows.Err()
+}
+
+// CompleteMultipartUpload marks an active upload completed with the checksum
+// of its assembled data. It returns false when the upload is not active, e.g.
+// because another request completed it first.
+func (r *Repository) CompleteMultipartUpload(ctx context.Context, id, checksum string) (bool, error) {
+	query := `
+		UPDATE multipart_uploads
+		SET status = 'completed', checksum = $2, completed_at = NOW()
+		WHERE id = $1 AND status = 'active'
+	`
+
+	tag, err := r.db.Pool.Exec(ctx, query, id, checksum)
+	if err != nil {
+		return false, fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// DeleteMultipartUpload deletes a multipart upload session and its parts
+func (r *Repository) DeleteMultipartUpload(ctx context.Context, id string) error {
+	tag, err := r.db.Pool.Exec(ctx, "DELETE FROM multipart_uploads WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete multipart upload: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("upload not found: %s", id)
+	}
+	return nil
+}
+
+// ListExpiredMultipartUploads returns upload sessions past their expiry
+func (r *Repository) ListExpiredMultipartUploads(ctx context.Context, limit int) ([]*models.MultipartUpload, error) {
+	query := `
+		SELECT ` + multipartUploadColumns + ` FROM multipart_uploads
+		WHERE expires_at < NOW()
+		ORDER BY expires_at
+		LIMIT $1
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired multipart uploads: %w", err)
+	}
+	defer rows.Close()
+
+	var uploads []*models.MultipartUpload
+	for rows.Next() {
+		upload, err := scanMultipartUpload(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan multipart upload: %w", err)
+		}
+		uploads = append(uploads, upload)
+	}
+
+	return uploads, rows.Err()
+}
+
+// scanMultipartUpload scans a row of multipartUploadColumns
+func scanMultipartUpload(row pgx.Row) (*models.MultipartUpload, error) {
+	upload := &models.MultipartUpload{Parts: make(map[int]*models.UploadPart)}
+
+	err := row.Scan(
+		&upload.ID, &upload.Mode, &upload.Filename, &upload.TotalSize, &upload.PartSize,
+		&upload.TotalParts, &upload.Status, &upload.VideoID, &upload.StorageKey,
+		&upload.StorageUploadID, &upload.Checksum, &upload.CreatedAt, &upload.ExpiresAt,
+		&upload.CompletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return upload, nil
+}
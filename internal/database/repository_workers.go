@@ -0,0 +1,281 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// HeartbeatWorker registers a worker or refreshes its heartbeat and load. The
+// stored status is scanned back so the worker learns when it is being drained.
+func (r *Repository) HeartbeatWorker(ctx context.Context, worker *models.Worker) error {
+	query := `
+		INSERT INTO workers (id, hostname, version, pools, slots, current_jobs, cpus, memory_mb, cpu_load)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO UPDATE SET
+			hostname = EXCLUDED.hostname,
+			version = EXCLUDED.version,
+			pools = EXCLUDED.pools,
+			slots = EXCLUDED.slots,
+			current_jobs = EXCLUDED.current_jobs,
+			cpus = EXCLUDED.cpus,
+			memory_mb = EXCLUDED.memory_mb,
+			cpu_load = EXCLUDED.cpu_load,
+			heartbeat_at = NOW()
+		RETURNING status, started_at, heartbeat_at
+	`
+
+	if worker.Pools == nil {
+		worker.Pools = []string{}
+	}
+	if worker.CurrentJobs == nil {
+		worker.CurrentJobs = []string{}
+	}
+
+	err := r.db.Pool.QueryRow(ctx, query,
+		worker.ID, worker.Hostname, worker.Version, worker.Pools, worker.Slots, worker.CurrentJobs,
+		worker.CPUs, worker.MemoryMB, worker.CPULoad,
+	).Scan(&worker.Status, &worker.StartedAt, &worker.HeartbeatAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to send worker heartbeat: %w", err)
+	}
+
+	return nil
+}
+
+// GetWorker retrieves a worker by ID
+func (r *Repository) GetWorker(ctx context.Context, id string) (*models.Worker, error) {
+	query := `
+		SELECT id, hostname, version, status, pools, slots, current_jobs, cpus, memory_mb, cpu_load,
+		       started_at, heartbeat_at
+		FROM workers
+		WHERE id = $1
+	`
+
+	worker := &models.Worker{}
+	err := r.db.Pool.QueryRow(ctx, query, id).Scan(
+		&worker.ID, &worker.Hostname, &worker.Version, &worker.Status, &worker.Pools, &worker.Slots,
+		&worker.CurrentJobs, &worker.CPUs, &worker.MemoryMB, &worker.CPULoad,
+		&worker.StartedAt, &worker.HeartbeatAt,
+	)
+
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("worker not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worker: %w", err)
+	}
+
+	return worker, nil
+}
+
+// ListWorkers lists registered workers, including those whose heartbeat has
+// expired but have not been reaped yet
+func (r *Repository) ListWorkers(ctx context.Context) ([]*models.Worker, error) {
+	query := `
+		SELECT id, hostname, version, status, pools, slots, current_jobs, cpus, memory_mb, cpu_load,
+		       started_at, heartbeat_at
+		FROM workers
+		ORDER BY id ASC
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workers: %w", err)
+	}
+	defer rows.Close()
+
+	var workers []*models.Worker
+	for rows.Next() {
+		worker := &models.Worker{}
+		if err := rows.Scan(
+			&worker.ID, &worker.Hostname, &worker.Version, &worker.Status, &worker.Pools, &worker.Slots,
+			&worker.CurrentJobs, &worker.CPUs, &worker.MemoryMB, &worker.CPULoad,
+			&worker.StartedAt, &worker.HeartbeatAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan worker: %w", err)
+		}
+		workers = append(workers, worker)
+	}
+
+	return workers, rows.Err()
+}
+
+// SetWorkerStatus changes the status of a registered worker
+func (r *Repository) SetWorkerStatus(ctx context.Context, id, status string) error {
+	tag, err := r.db.Pool.Exec(ctx, "UPDATE workers SET status = $2 WHERE id = $1", id, status)
+	if err != nil {
+		return fmt.Errorf("failed to update worker status: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("worker not found")
+	}
+	return nil
+}
+
+// DeleteWorker removes a worker from the registry
+func (r *Repository) DeleteWorker(ctx context.Context, id string) error {
+	_, err := r.db.Pool.Exec(ctx, "DELETE FROM workers WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete worker: %w", err)
+	}
+	return nil
+}
+
+// ListExpiredWorkers lists the workers whose last heartbeat is before cutoff
+func (r *Repository) ListExpiredWorkers(ctx context.Context, cutoff time.Time) ([]string, error) {
+	rows, err := r.db.Pool.Query(ctx, "SELECT id FROM workers WHERE heartbeat_at < $1 ORDER BY heartbeat_at ASC", cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired workers: %w", err)
+	}
+	defer rows.Close()
+
+	var workerIDs []string
+	for rows.Next() {
+		var workerID string
+		if err := rows.Scan(&workerID); err != nil {
+			return nil, fmt.Errorf("failed to scan expired worker: %w", err)
+		}
+		workerIDs = append(workerIDs, workerID)
+	}
+
+	return workerIDs, rows.Err()
+}
+
+// ListOrphanedJobs lists processing jobs not updated since cutoff whose worker
+// has not sent a heartbeat since cutoff either
+func (r *Repository) ListOrphanedJobs(ctx context.Context, cutoff time.Time) ([]*models.Job, error) {
+	query := `
+		SELECT j.id, j.video_id, j.user_id, j.status, j.priority, j.progress, COALESCE(j.error_msg, ''),
+		       j.retry_count, COALESCE(j.worker_id, ''), j.started_at, j.completed_at, j.created_at,
+		       j.updated_at, j.config, j.requirements, j.estimated_cost, j.pool, j.run_at,
+		       j.batch_id, j.depends_on, j.reused_from_job_id, j.type, j.result
+		FROM jobs j
+		WHERE j.status = $1
+		AND j.updated_at < $2
+		AND NOT EXISTS (
+			SELECT 1 FROM workers w
+			WHERE w.id = j.worker_id AND w.heartbeat_at >= $2
+		)
+		ORDER BY j.updated_at ASC
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, models.JobStatusProcessing, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orphaned jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*models.Job
+	for rows.Next() {
+		job := &models.Job{}
+		if err := rows.Scan(
+			&job.ID, &job.VideoID, &job.UserID, &job.Status, &job.Priority, &job.Progress,
+			&job.ErrorMsg, &job.RetryCount, &job.WorkerID, &job.StartedAt,
+			&job.CompletedAt, &job.CreatedAt, &job.UpdatedAt, &job.Config,
+			&job.Requirements, &job.EstimatedCost, &job.Pool, &job.RunAt, &job.BatchID, &job.DependsOn, &job.ReusedFromJobID, &job.Type, &job.Result,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan orphaned job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// RequeueOrphanedJob resets a job left processing by workerID to queued and
+// counts the attempt. It returns false when the job has moved on meanwhile.
+func (r *Repository) RequeueOrphanedJob(ctx context.Context, jobID, workerID string) (bool, error) {
+	query := `
+		UPDATE jobs
+		SET status = $3, worker_id = '', progress = 0, started_at = NULL, retry_count = retry_count + 1,
+		    fencing_token = fencing_token + 1, lease_expires_at = NULL
+		WHERE id = $1 AND status = $4 AND COALESCE(worker_id, '') = $2
+	`
+
+	tag, err := r.db.Pool.Exec(ctx, query, jobID, workerID, models.JobStatusQueued, models.JobStatusProcessing)
+	if err != nil {
+		return false, fmt.Errorf("failed to requeue orphaned job: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// FailOrphanedJob fails a job left processing by workerID. It returns false
+// when the job has moved on meanwhile.
+func (r *Repository) FailOrphanedJob(ctx context.Context, jobID, workerID, reason string) (bool, error) {
+	query := `
+		UPDATE jobs
+		SET status = $3, error_msg = $5, completed_at = NOW(),
+		    fencing_token = fencing_token + 1, lease_expires_at = NULL
+		WHERE id = $1 AND status = $4 AND COALESCE(worker_id, '') = $2
+	`
+
+	tag, err := r.db.Pool.Exec(ctx, query, jobID, workerID, models.JobStatusFailed, models.JobStatusProcessing, reason)
+	if err != nil {
+		return false, fmt.Errorf("failed to fail orphaned job: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// AcquireJobLease gives workerID exclusive ownership of a job for ttl and
+// marks it processing. It is granted when the job awaits a worker or its
+// previous lease expired, and returns the new fencing token. It returns false
+// when another worker holds the job or the job has finished.
+func (r *Repository) AcquireJobLease(ctx context.Context, jobID, workerID string, ttl time.Duration) (int64, bool, error) {
+	query := `
+		UPDATE jobs
+		SET status = $3, worker_id = $2, fencing_token = fencing_token + 1,
+		    lease_expires_at = NOW() + $4 * INTERVAL '1 second'
+		WHERE id = $1
+		AND (status IN ($5, $6, $7)
+		     OR (status = $3 AND (lease_expires_at IS NULL OR lease_expires_at < NOW())))
+		RETURNING fencing_token
+	`
+
+	var token int64
+	err := r.db.Pool.QueryRow(ctx, query, jobID, workerID, models.JobStatusProcessing, ttl.Seconds(),
+		models.JobStatusPending, models.JobStatusQueued, models.JobStatusFailed).Scan(&token)
+	if err == pgx.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to acquire job lease: %w", err)
+	}
+	return token, true, nil
+}
+
+// RenewJobLease extends a job lease held with token. It returns false when
+// the job has been claimed by another worker since.
+func (r *Repository) RenewJobLease(ctx context.Context, jobID string, token int64, ttl time.Duration) (bool, error) {
+	query := `
+		UPDATE jobs
+		SET lease_expires_at = NOW() + $3 * INTERVAL '1 second'
+		WHERE id = $1 AND fencing_token = $2
+	`
+
+	tag, err := r.db.Pool.Exec(ctx, query, jobID, token, ttl.Seconds())
+	if err != nil {
+		return false, fmt.Errorf("failed to renew job lease: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ReleaseJobLease hands a job still processing under token back to the queue
+// for another worker
+func (r *Repository) ReleaseJobLease(ctx context.Context, jobID string, token int64) error {
+	query := `
+		UPDATE jobs
+		SET status = $3, worker_id = '', lease_expires_at = NULL
+		WHERE id = $1 AND fencing_token = $2 AND status = $4
+	`
+
+	_, err := r.db.Pool.Exec(ctx, query, jobID, token, models.JobStatusQueued, models.JobStatusProcessing)
+	if err != nil {
+		return fmt.Errorf("failed to release job lease: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package destination
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+func testCipher(t *testing.T) *Cipher {
+	t.Helper()
+	cipher, err := NewCipher(base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))))
+	require.NoError(t, err)
+	return cipher
+}
+
+func TestCipherRoundTrip(t *testing.T) {
+	cipher := testCipher(t)
+	creds := models.DestinationCredentials{AccessKeyID: "AKIA", SecretAccessKey: "secret"}
+
+	sealed, err := cipher.Seal("dest-1", creds)
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), "secret")
+
+	opened, err := cipher.Open("dest-1", sealed)
+	require.NoError(t, err)
+	assert.Equal(t, creds, *opened)
+
+	// Sealed credentials are bound to their destination
+	_, err = cipher.Open("dest-2", sealed)
+	assert.Error(t, err)
+
+	_, err = cipher.Open("dest-1", sealed[:4])
+	assert.Error(t, err)
+}
+
+func TestNewCipherRejectsBadKeys(t *testing.T) {
+	_, err := NewCipher("not base64!")
+	assert.Error(t, err)
+
+	_, err = NewCipher(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.Error(t, err)
+}
@@ -0,0 +1,192 @@
+// Package destination delivers outputs to the buckets and directories of
+// customers, configured per user as output destinations
+package destination
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/therealutkarshpriyadarshi/transcode/internal/config"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/netguard"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// Store looks up output destinations
+type Store interface {
+	GetOutputDestination(ctx context.Context, id string) (*models.OutputDestination, error)
+}
+
+// Validate checks a destination before it is saved, filling in the default
+// key template
+func Validate(dest *models.OutputDestination, cfg config.DestinationsConfig) error {
+	if strings.TrimSpace(dest.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	switch dest.Type {
+	case models.DestinationTypeS3:
+		if dest.Endpoint == "" || dest.Bucket == "" {
+			return fmt.Errorf("endpoint and bucket are required")
+		}
+		if strings.Contains(dest.Endpoint, "/") {
+			return fmt.Errorf("endpoint must be a host and optional port, without a scheme or path")
+		}
+		dest.Path = ""
+	case models.DestinationTypeLocal:
+		if err := checkLocalPath(dest.Path, dest.UserID, cfg.AllowedLocalPaths); err != nil {
+			return err
+		}
+		dest.Endpoint, dest.Region, dest.Bucket, dest.UseSSL = "", "", "", false
+	default:
+		return fmt.Errorf("unsupported destination type %q, use s3 or local", dest.Type)
+	}
+
+	if dest.KeyTemplate == "" {
+		dest.KeyTemplate = DefaultKeyTemplate
+	}
+	return ValidateTemplate(dest.KeyTemplate)
+}
+
+// checkLocalPath checks that dir is an absolute path in the directory of
+// userID under one of allowed, <root>/<user_id>, so users sharing a root
+// cannot write into each other's deliveries. Symlinks are resolved first so
+// they cannot lead out of that directory.
+func checkLocalPath(dir, userID string, allowed []string) error {
+	if !filepath.IsAbs(dir) {
+		return fmt.Errorf("path must be absolute")
+	}
+	if userID == "" || userID == ".." || userID != filepath.Base(userID) {
+		return fmt.Errorf("local destinations must belong to a user")
+	}
+
+	resolved, err := resolvePath(filepath.Clean(dir))
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	for _, root := range allowed {
+		root, err := resolvePath(filepath.Clean(root))
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(filepath.Join(root, userID), resolved)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("local destinations under %s are not allowed, use <allowed path>/%s", dir, userID)
+}
+
+// resolvePath resolves the symlinks of an absolute, clean path. The
+// directories below its deepest existing parent, created on first delivery,
+// are kept as they are.
+func resolvePath(path string) (string, error) {
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
+
+// Target is an opened destination
+type Target struct {
+	Destination *models.OutputDestination
+	Store       storage.Blobstore
+}
+
+// Resolver opens the destinations jobs deliver their outputs to
+type Resolver struct {
+	store  Store
+	cipher *Cipher
+	cfg    config.DestinationsConfig
+}
+
+// NewResolver creates a resolver opening destinations with credentials
+// sealed by cipher
+func NewResolver(store Store, cipher *Cipher, cfg config.DestinationsConfig) *Resolver {
+	return &Resolver{
+		store:  store,
+		cipher: cipher,
+		cfg:    cfg,
+	}
+}
+
+// Open opens the destinations of a job, which must belong to its owner
+func (r *Resolver) Open(ctx context.Context, job *models.Job) ([]*Target, error) {
+	var targets []*Target
+	for _, id := range job.Config.Destinations {
+		dest, err := r.store.GetOutputDestination(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.UserID == nil || dest.UserID != *job.UserID {
+			return nil, fmt.Errorf("output destination %s does not belong to the job's owner", id)
+		}
+
+		store, err := r.openStore(dest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open output destination %s: %w", dest.Name, err)
+		}
+		targets = append(targets, &Target{Destination: dest, Store: store})
+	}
+
+	return targets, nil
+}
+
+func (r *Resolver) openStore(dest *models.OutputDestination) (storage.Blobstore, error) {
+	switch dest.Type {
+	case models.DestinationTypeS3:
+		creds, err := r.cipher.Open(dest.ID, dest.Credentials)
+		if err != nil {
+			return nil, err
+		}
+		cfg := config.StorageConfig{
+			Endpoint:        dest.Endpoint,
+			AccessKeyID:     creds.AccessKeyID,
+			SecretAccessKey: creds.SecretAccessKey,
+			Region:          dest.Region,
+			UseSSL:          dest.UseSSL,
+		}
+		return storage.OpenRemoteBucket(cfg, dest.Bucket, netguard.Transport(r.cfg.AllowPrivateNetworks))
+	case models.DestinationTypeLocal:
+		// Checked again in case the allowed paths changed since it was saved
+		if err := checkLocalPath(dest.Path, dest.UserID, r.cfg.AllowedLocalPaths); err != nil {
+			return nil, err
+		}
+		return storage.NewLocalStore(dest.Path, "")
+	default:
+		return nil, fmt.Errorf("unsupported destination type %q", dest.Type)
+	}
+}
+
+// Deliver uploads a local file to every target, under the key its template
+// gives for vars
+func Deliver(ctx context.Context, targets []*Target, filePath string, vars Vars) error {
+	for _, target := range targets {
+		key, err := RenderKey(target.Destination.KeyTemplate, vars)
+		if err != nil {
+			return err
+		}
+		if err := storage.UploadFile(ctx, target.Store, key, filePath); err != nil {
+			return fmt.Errorf("failed to deliver %s to %s: %w", vars.Segment, target.Destination.Name, err)
+		}
+	}
+	return nil
+}
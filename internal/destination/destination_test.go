@@ -0,0 +1,160 @@
+package destination
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/config"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+type fakeStore struct {
+	destinations map[string]*models.OutputDestination
+}
+
+func (f *fakeStore) GetOutputDestination(ctx context.Context, id string) (*models.OutputDestination, error) {
+	dest, ok := f.destinations[id]
+	if !ok {
+		return nil, fmt.Errorf("output destination not found")
+	}
+	return dest, nil
+}
+
+func TestValidate(t *testing.T) {
+	cfg := config.DestinationsConfig{AllowedLocalPaths: []string{"/srv/exports"}}
+
+	tests := []struct {
+		name  string
+		dest  models.OutputDestination
+		valid bool
+	}{
+		{name: "s3", dest: models.OutputDestination{Name: "acme", Type: "s3", Endpoint: "s3.example.com", Bucket: "renditions"}, valid: true},
+		{name: "s3 without bucket", dest: models.OutputDestination{Name: "acme", Type: "s3", Endpoint: "s3.example.com"}},
+		{name: "s3 endpoint url", dest: models.OutputDestination{Name: "acme", Type: "s3", Endpoint: "https://s3.example.com", Bucket: "renditions"}},
+		{name: "local", dest: models.OutputDestination{UserID: "acme", Name: "nas", Type: "local", Path: "/srv/exports/acme"}, valid: true},
+		{name: "local subdirectory", dest: models.OutputDestination{UserID: "acme", Name: "nas", Type: "local", Path: "/srv/exports/acme/renditions"}, valid: true},
+		{name: "local of another user", dest: models.OutputDestination{UserID: "acme", Name: "nas", Type: "local", Path: "/srv/exports/globex"}},
+		{name: "local root", dest: models.OutputDestination{UserID: "acme", Name: "nas", Type: "local", Path: "/srv/exports"}},
+		{name: "local without owner", dest: models.OutputDestination{Name: "nas", Type: "local", Path: "/srv/exports/acme"}},
+		{name: "local outside allowed", dest: models.OutputDestination{UserID: "acme", Name: "nas", Type: "local", Path: "/etc"}},
+		{name: "local escaping allowed", dest: models.OutputDestination{UserID: "acme", Name: "nas", Type: "local", Path: "/srv/exports/../../etc"}},
+		{name: "local prefix sibling", dest: models.OutputDestination{UserID: "acme", Name: "nas", Type: "local", Path: "/srv/exports-other"}},
+		{name: "local user prefix sibling", dest: models.OutputDestination{UserID: "acme", Name: "nas", Type: "local", Path: "/srv/exports/acme-other"}},
+		{name: "local relative", dest: models.OutputDestination{UserID: "acme", Name: "nas", Type: "local", Path: "exports/acme"}},
+		{name: "bad template", dest: models.OutputDestination{UserID: "acme", Name: "nas", Type: "local", Path: "/srv/exports/acme", KeyTemplate: "{title}"}},
+		{name: "unknown type", dest: models.OutputDestination{Name: "ftp", Type: "ftp"}},
+		{name: "no name", dest: models.OutputDestination{Type: "local", Path: "/srv/exports"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(&tt.dest, cfg)
+			if tt.valid {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, tt.dest.KeyTemplate)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestResolverOpen(t *testing.T) {
+	root := t.TempDir()
+	owner := "user-1"
+	store := &fakeStore{destinations: map[string]*models.OutputDestination{
+		"mine":   {ID: "mine", UserID: owner, Name: "nas", Type: "local", Path: filepath.Join(root, owner), KeyTemplate: DefaultKeyTemplate},
+		"theirs": {ID: "theirs", UserID: "user-2", Name: "nas", Type: "local", Path: filepath.Join(root, "user-2"), KeyTemplate: DefaultKeyTemplate},
+	}}
+	resolver := NewResolver(store, testCipher(t), config.DestinationsConfig{AllowedLocalPaths: []string{root}})
+
+	targets, err := resolver.Open(context.Background(), &models.Job{
+		UserID: &owner,
+		Config: models.TranscodeConfig{Destinations: []string{"mine"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, targets, 1)
+
+	_, err = resolver.Open(context.Background(), &models.Job{
+		UserID: &owner,
+		Config: models.TranscodeConfig{Destinations: []string{"theirs"}},
+	})
+	assert.Error(t, err)
+
+	_, err = resolver.Open(context.Background(), &models.Job{
+		Config: models.TranscodeConfig{Destinations: []string{"mine"}},
+	})
+	assert.Error(t, err)
+
+	// A path no longer allowed is refused when the job runs
+	strict := NewResolver(store, testCipher(t), config.DestinationsConfig{})
+	_, err = strict.Open(context.Background(), &models.Job{
+		UserID: &owner,
+		Config: models.TranscodeConfig{Destinations: []string{"mine"}},
+	})
+	assert.Error(t, err)
+}
+
+func TestCheckLocalPath_Symlinks(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "user-1"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "user-2"), 0755))
+	outside := t.TempDir()
+
+	// Links out of the user's directory, to another user and out of the root
+	require.NoError(t, os.Symlink(filepath.Join(root, "user-2"), filepath.Join(root, "user-1", "shared")))
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "user-1", "escape")))
+	// A link staying inside the user's directory
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "user-1", "renditions"), 0755))
+	require.NoError(t, os.Symlink(filepath.Join(root, "user-1", "renditions"), filepath.Join(root, "user-1", "latest")))
+
+	allowed := []string{root}
+	assert.NoError(t, checkLocalPath(filepath.Join(root, "user-1", "latest", "new"), "user-1", allowed))
+	assert.Error(t, checkLocalPath(filepath.Join(root, "user-1", "shared"), "user-1", allowed))
+	assert.Error(t, checkLocalPath(filepath.Join(root, "user-1", "shared", "new"), "user-1", allowed))
+	assert.Error(t, checkLocalPath(filepath.Join(root, "user-1", "escape"), "user-1", allowed))
+
+	// The resolver checks again when the job runs, after links may have changed
+	store := &fakeStore{destinations: map[string]*models.OutputDestination{
+		"linked": {ID: "linked", UserID: "user-1", Name: "nas", Type: "local", Path: filepath.Join(root, "user-1", "shared"), KeyTemplate: DefaultKeyTemplate},
+	}}
+	owner := "user-1"
+	_, err := NewResolver(store, testCipher(t), config.DestinationsConfig{AllowedLocalPaths: allowed}).Open(context.Background(), &models.Job{
+		UserID: &owner,
+		Config: models.TranscodeConfig{Destinations: []string{"linked"}},
+	})
+	assert.Error(t, err)
+}
+
+func TestDeliver(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "segment_001.ts")
+	require.NoError(t, os.WriteFile(filePath, []byte("segment"), 0644))
+
+	first, second := storage.NewMemoryStore(), storage.NewMemoryStore()
+	targets := []*Target{
+		{Destination: &models.OutputDestination{Name: "primary", KeyTemplate: "{title}/{format}/{segment}"}, Store: first},
+		{Destination: &models.OutputDestination{Name: "mirror", KeyTemplate: DefaultKeyTemplate}, Store: second},
+	}
+	vars := Vars{VideoID: "vid-1", Title: "trailer", Format: "hls", Segment: "720p/segment_001.ts"}
+
+	require.NoError(t, Deliver(context.Background(), targets, filePath, vars))
+
+	for store, key := range map[*storage.MemoryStore]string{
+		first:  "trailer/hls/720p/segment_001.ts",
+		second: "vid-1/720p/segment_001.ts",
+	} {
+		reader, err := store.Get(context.Background(), key)
+		require.NoError(t, err)
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		require.NoError(t, err)
+		assert.Equal(t, "segment", string(data))
+	}
+}
@@ -0,0 +1,88 @@
+package destination
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DefaultKeyTemplate names files delivered to destinations without a template
+const DefaultKeyTemplate = "{video_id}/{segment}"
+
+// placeholder matches a template placeholder like {title}
+var placeholder = regexp.MustCompile(`\{([a-z_]*)\}`)
+
+// Vars are the values a key template may use
+type Vars struct {
+	VideoID    string // {video_id}
+	JobID      string // {job_id}
+	Title      string // {title}, the original's filename without extension
+	Resolution string // {resolution}, e.g. 720p; empty for HLS and DASH files
+	Format     string // {format}, e.g. mp4 or hls
+	Segment    string // {segment}, the file's name within the output
+}
+
+func (v Vars) lookup(name string) (string, bool) {
+	switch name {
+	case "video_id":
+		return v.VideoID, true
+	case "job_id":
+		return v.JobID, true
+	case "title":
+		// A title is one path element, whatever the uploader named the file
+		return strings.NewReplacer("/", "_", `\`, "_").Replace(v.Title), true
+	case "resolution":
+		return v.Resolution, true
+	case "format":
+		return v.Format, true
+	case "segment":
+		return v.Segment, true
+	}
+	return "", false
+}
+
+// TitleOf returns the {title} of a video with filename
+func TitleOf(filename string) string {
+	return strings.TrimSuffix(filename, path.Ext(filename))
+}
+
+// ValidateTemplate checks that a key template only uses known placeholders
+// and includes {segment}, so the files of an output get distinct keys
+func ValidateTemplate(template string) error {
+	for _, match := range placeholder.FindAllStringSubmatch(template, -1) {
+		if _, ok := (Vars{}).lookup(match[1]); !ok {
+			return fmt.Errorf("unknown placeholder %s in key template", match[0])
+		}
+	}
+	if !strings.Contains(template, "{segment}") {
+		return fmt.Errorf("key template must contain {segment}")
+	}
+	return nil
+}
+
+// RenderKey fills in a key template. Empty values collapse, so
+// "{title}/{resolution}/{segment}" of an HLS segment is "title/segment.ts".
+func RenderKey(template string, vars Vars) (string, error) {
+	if template == "" {
+		template = DefaultKeyTemplate
+	}
+
+	var unknown string
+	key := placeholder.ReplaceAllStringFunc(template, func(match string) string {
+		value, ok := vars.lookup(match[1 : len(match)-1])
+		if !ok {
+			unknown = match
+		}
+		return value
+	})
+	if unknown != "" {
+		return "", fmt.Errorf("unknown placeholder %s in key template", unknown)
+	}
+
+	key = strings.TrimPrefix(path.Clean("/"+key), "/")
+	if key == "" {
+		return "", fmt.Errorf("key template %q renders an empty key", template)
+	}
+	return key, nil
+}
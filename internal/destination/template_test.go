@@ -0,0 +1,56 @@
+package destination
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderKey(t *testing.T) {
+	vars := Vars{
+		VideoID:    "vid-1",
+		JobID:      "job-1",
+		Title:      TitleOf("summer/trailer.mov"),
+		Resolution: "720p",
+		Format:     "mp4",
+		Segment:    "output.mp4",
+	}
+
+	tests := []struct {
+		template string
+		vars     Vars
+		want     string
+	}{
+		{template: "", vars: vars, want: "vid-1/output.mp4"},
+		{template: "{title}/{resolution}/{segment}", vars: vars, want: "summer_trailer/720p/output.mp4"},
+		{template: "/{format}/{job_id}-{segment}", vars: vars, want: "mp4/job-1-output.mp4"},
+		{
+			template: "{title}/{resolution}/{segment}",
+			vars:     Vars{Title: "trailer", Format: "hls", Segment: "720p/segment_001.ts"},
+			want:     "trailer/720p/segment_001.ts",
+		},
+		{template: "{segment}", vars: Vars{Segment: "../../etc/passwd"}, want: "etc/passwd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			key, err := RenderKey(tt.template, tt.vars)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, key)
+		})
+	}
+
+	_, err := RenderKey("{segment}", Vars{})
+	assert.Error(t, err)
+
+	_, err = RenderKey("{bucket}/{segment}", vars)
+	assert.Error(t, err)
+}
+
+func TestValidateTemplate(t *testing.T) {
+	assert.NoError(t, ValidateTemplate(DefaultKeyTemplate))
+	assert.NoError(t, ValidateTemplate("exports/{title}/{resolution}/{segment}"))
+	assert.Error(t, ValidateTemplate("{title}/{resolution}"))
+	assert.Error(t, ValidateTemplate("{customer}/{segment}"))
+}
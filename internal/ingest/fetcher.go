@@ -0,0 +1,319 @@
+// Package ingest imports videos from URLs and watch folders. Imports are
+// stored in the database, where workers claim them, fetch their files and
+// create their videos and jobs.
+package ingest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+const (
+	// DefaultLeaseTTL is how long a worker holds an import without renewing
+	// its lease
+	DefaultLeaseTTL = 5 * time.Minute
+
+	// DefaultMaxAttempts is how often an import is fetched before it fails
+	DefaultMaxAttempts = 5
+
+	// baseRetryDelay is the wait before the second attempt, doubling with
+	// every further attempt up to maxRetryDelay
+	baseRetryDelay = 30 * time.Second
+	maxRetryDelay  = time.Hour
+)
+
+// Store persists imports
+type Store interface {
+	CreateImport(ctx context.Context, imp *models.Import) (bool, error)
+	ClaimImport(ctx context.Context, leaseTTL time.Duration) (*models.Import, error)
+	ExtendImportLease(ctx context.Context, id string, attempt int, leaseTTL time.Duration) (bool, error)
+	CompleteImport(ctx context.Context, imp *models.Import, video *models.Video, jobs []*models.Job) (bool, error)
+	RetryImport(ctx context.Context, id string, attempt int, errorMsg string, nextAttemptAt time.Time) error
+	FailImport(ctx context.Context, id string, attempt int, errorMsg string) error
+}
+
+// Prober extracts the metadata of a video file
+type Prober interface {
+	ExtractVideoInfo(ctx context.Context, inputPath string) (*models.Video, error)
+}
+
+// Notifier is told about imported videos
+type Notifier interface {
+	NotifyVideoUploaded(ctx context.Context, video *models.Video) error
+}
+
+// Config configures the fetcher
+type Config struct {
+	MaxSize     int64         // largest file fetched, 0 for no limit
+	MaxAttempts int           // attempts before an import fails
+	LeaseTTL    time.Duration // how long an import is held without renewal
+	TempDir     string        // where files are downloaded to
+}
+
+// permanentError is a failure that retrying will not fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// permanent marks err as not worth retrying
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Fetcher fetches imports claimed from the store
+type Fetcher struct {
+	store    Store
+	blobs    storage.Blobstore
+	sources  *Sources
+	prober   Prober
+	notifier Notifier
+	cfg      Config
+}
+
+// NewFetcher creates a fetcher storing imported videos in blobs
+func NewFetcher(store Store, blobs storage.Blobstore, sources *Sources, prober Prober, cfg Config) *Fetcher {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.LeaseTTL <= 0 {
+		cfg.LeaseTTL = DefaultLeaseTTL
+	}
+	if cfg.TempDir == "" {
+		cfg.TempDir = os.TempDir()
+	}
+
+	return &Fetcher{
+		store:   store,
+		blobs:   blobs,
+		sources: sources,
+		prober:  prober,
+		cfg:     cfg,
+	}
+}
+
+// SetNotifier notifies n of every imported video
+func (f *Fetcher) SetNotifier(n Notifier) {
+	f.notifier = n
+}
+
+// Run fetches up to concurrency imports at once until ctx is done, looking for
+// new ones every pollInterval while idle
+func (f *Fetcher) Run(ctx context.Context, concurrency int, pollInterval time.Duration) {
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				if f.fetchNext(ctx) {
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(pollInterval):
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// fetchNext claims and fetches an import, reporting whether one was due
+func (f *Fetcher) fetchNext(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	imp, err := f.store.ClaimImport(ctx, f.cfg.LeaseTTL)
+	if err != nil {
+		log.Printf("Failed to claim import: %v", err)
+		return false
+	}
+	if imp == nil {
+		return false
+	}
+
+	f.process(ctx, imp)
+	return true
+}
+
+// process fetches an import, holding its lease meanwhile, and records the
+// outcome
+func (f *Fetcher) process(ctx context.Context, imp *models.Import) {
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go f.holdLease(fetchCtx, cancel, imp)
+
+	log.Printf("Fetching import %s from %s (attempt %d)", imp.ID, imp.SourceURL, imp.Attempts)
+
+	video, err := f.fetch(fetchCtx, imp)
+	if err == nil {
+		jobs := imp.NewJobs(video)
+		var completed bool
+		completed, err = f.store.CompleteImport(ctx, imp, video, jobs)
+		if err == nil && !completed {
+			log.Printf("Import %s was taken over by another worker", imp.ID)
+			return
+		}
+		if err == nil {
+			log.Printf("Imported %s as video %s with %d jobs", imp.SourceURL, video.ID, len(jobs))
+			if f.notifier != nil {
+				if err := f.notifier.NotifyVideoUploaded(ctx, video); err != nil {
+					log.Printf("Failed to notify webhooks of video %s: %v", video.ID, err)
+				}
+			}
+			return
+		}
+	}
+
+	if ctx.Err() != nil {
+		// Shutting down; the import is claimed again once its lease expires
+		return
+	}
+
+	var perm *permanentError
+	if errors.As(err, &perm) || imp.Attempts >= f.cfg.MaxAttempts {
+		log.Printf("Import %s failed: %v", imp.ID, err)
+		if err := f.store.FailImport(ctx, imp.ID, imp.Attempts, err.Error()); err != nil {
+			log.Printf("Failed to fail import %s: %v", imp.ID, err)
+		}
+		return
+	}
+
+	next := time.Now().Add(retryDelay(imp.Attempts))
+	log.Printf("Import %s attempt %d failed, retrying at %s: %v", imp.ID, imp.Attempts, next.Format(time.RFC3339), err)
+	if err := f.store.RetryImport(ctx, imp.ID, imp.Attempts, err.Error(), next); err != nil {
+		log.Printf("Failed to retry import %s: %v", imp.ID, err)
+	}
+}
+
+// holdLease renews an import's lease until ctx is done, cancelling the fetch
+// if the lease is lost
+func (f *Fetcher) holdLease(ctx context.Context, cancel context.CancelFunc, imp *models.Import) {
+	ticker := time.NewTicker(f.cfg.LeaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			held, err := f.store.ExtendImportLease(ctx, imp.ID, imp.Attempts, f.cfg.LeaseTTL)
+			if err != nil {
+				log.Printf("Failed to extend lease of import %s: %v", imp.ID, err)
+				continue
+			}
+			if !held {
+				log.Printf("Lost lease of import %s", imp.ID)
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// fetch downloads an import, verifies and probes it and stores it as the
+// original of its video
+func (f *Fetcher) fetch(ctx context.Context, imp *models.Import) (*models.Video, error) {
+	reader, size, err := f.sources.Open(ctx, imp.SourceURL)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	if f.cfg.MaxSize > 0 && size > f.cfg.MaxSize {
+		return nil, permanent(fmt.Errorf("file is %d bytes, more than the limit of %d", size, f.cfg.MaxSize))
+	}
+
+	if err := os.MkdirAll(f.cfg.TempDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	file, err := os.CreateTemp(f.cfg.TempDir, "import-*"+path.Ext(imp.Filename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	limited := reader
+	if f.cfg.MaxSize > 0 {
+		limited = io.NopCloser(io.LimitReader(reader, f.cfg.MaxSize+1))
+	}
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(file, hash), limited)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download: %w", err)
+	}
+	if f.cfg.MaxSize > 0 && n > f.cfg.MaxSize {
+		return nil, permanent(fmt.Errorf("file is more than the limit of %d bytes", f.cfg.MaxSize))
+	}
+	if size >= 0 && n != size {
+		return nil, fmt.Errorf("download truncated at %d of %d bytes", n, size)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	if imp.ExpectedChecksum != "" && !strings.EqualFold(imp.ExpectedChecksum, checksum) {
+		// Most likely corrupted in transit, so worth another attempt
+		return nil, fmt.Errorf("checksum mismatch: file has SHA-256 %s", checksum)
+	}
+
+	video, err := f.prober.ExtractVideoInfo(ctx, file.Name())
+	if err != nil {
+		return nil, permanent(fmt.Errorf("failed to extract metadata: %w", err))
+	}
+
+	key := fmt.Sprintf("videos/%s/original/%s", imp.VideoID, path.Base(imp.Filename))
+	if err := storage.UploadFile(ctx, f.blobs, key, file.Name()); err != nil {
+		return nil, err
+	}
+
+	video.ID = imp.VideoID
+	video.UserID = imp.UserID
+	video.Filename = imp.Filename
+	video.OriginalURL = key
+	video.Size = n
+	video.Checksum = checksum
+	video.Status = models.VideoStatusPending
+	if video.Metadata == nil {
+		video.Metadata = models.Metadata{}
+	}
+
+	imp.Size = n
+	imp.Checksum = checksum
+
+	return video, nil
+}
+
+// retryDelay returns how long to wait after a failed attempt
+func retryDelay(attempt int) time.Duration {
+	delay := baseRetryDelay
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,299 @@
+package ingest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// fakeStore keeps imports in memory like the imports table
+type fakeStore struct {
+	mu        sync.Mutex
+	imports   map[string]*models.Import
+	watchKeys map[string]bool
+	videos    []*models.Video
+	jobs      []*models.Job
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		imports:   make(map[string]*models.Import),
+		watchKeys: make(map[string]bool),
+	}
+}
+
+func (s *fakeStore) CreateImport(ctx context.Context, imp *models.Import) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if imp.WatchKey != nil {
+		if s.watchKeys[*imp.WatchKey] {
+			return false, nil
+		}
+		s.watchKeys[*imp.WatchKey] = true
+	}
+	copied := *imp
+	s.imports[imp.ID] = &copied
+	return true, nil
+}
+
+func (s *fakeStore) ClaimImport(ctx context.Context, leaseTTL time.Duration) (*models.Import, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, imp := range s.imports {
+		if imp.Status == models.ImportStatusPending && !imp.NextAttemptAt.After(time.Now()) {
+			imp.Status = models.ImportStatusFetching
+			imp.Attempts++
+			copied := *imp
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *fakeStore) ExtendImportLease(ctx context.Context, id string, attempt int, leaseTTL time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	imp, ok := s.imports[id]
+	return ok && imp.Attempts == attempt && imp.Status == models.ImportStatusFetching, nil
+}
+
+func (s *fakeStore) CompleteImport(ctx context.Context, imp *models.Import, video *models.Video, jobs []*models.Job) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.imports[imp.ID]
+	if !ok || stored.Attempts != imp.Attempts || stored.Status != models.ImportStatusFetching {
+		return false, nil
+	}
+	stored.Status = models.ImportStatusCompleted
+	stored.Size = imp.Size
+	stored.Checksum = imp.Checksum
+	s.videos = append(s.videos, video)
+	s.jobs = append(s.jobs, jobs...)
+	return true, nil
+}
+
+func (s *fakeStore) RetryImport(ctx context.Context, id string, attempt int, errorMsg string, nextAttemptAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	imp := s.imports[id]
+	if imp.Attempts == attempt && imp.Status == models.ImportStatusFetching {
+		imp.Status = models.ImportStatusPending
+		imp.ErrorMsg = errorMsg
+		imp.NextAttemptAt = nextAttemptAt
+	}
+	return nil
+}
+
+func (s *fakeStore) FailImport(ctx context.Context, id string, attempt int, errorMsg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	imp := s.imports[id]
+	if imp.Attempts == attempt && imp.Status == models.ImportStatusFetching {
+		imp.Status = models.ImportStatusFailed
+		imp.ErrorMsg = errorMsg
+	}
+	return nil
+}
+
+func (s *fakeStore) get(id string) models.Import {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.imports[id]
+}
+
+// fakeProber reports every file as a short 1080p video
+type fakeProber struct {
+	err error
+}
+
+func (p *fakeProber) ExtractVideoInfo(ctx context.Context, inputPath string) (*models.Video, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &models.Video{Duration: 10, Width: 1920, Height: 1080, Codec: "h264"}, nil
+}
+
+func newTestFetcher(t *testing.T, store Store, prober Prober, maxSize int64) (*Fetcher, *storage.MemoryStore) {
+	blobs := storage.NewMemoryStore()
+	sources := newSources(true, func(name string) (storage.Blobstore, error) {
+		return nil, fmt.Errorf("no buckets in tests")
+	})
+	return NewFetcher(store, blobs, sources, prober, Config{
+		MaxSize:     maxSize,
+		MaxAttempts: 3,
+		TempDir:     t.TempDir(),
+	}), blobs
+}
+
+func newImport(sourceURL string) *models.Import {
+	return &models.Import{
+		ID:        "import-1",
+		SourceURL: sourceURL,
+		Filename:  "movie.mp4",
+		Jobs:      []models.TranscodeConfig{{Resolution: "720p"}, {Resolution: "480p"}},
+		Status:    models.ImportStatusPending,
+		VideoID:   "video-1",
+	}
+}
+
+func TestFetcherImportsVideo(t *testing.T) {
+	content := []byte("not really a video, but the prober does not mind")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	store := newFakeStore()
+	fetcher, blobs := newTestFetcher(t, store, &fakeProber{}, 0)
+
+	imp := newImport(server.URL + "/movie.mp4")
+	imp.ExpectedChecksum = checksum
+	_, err := store.CreateImport(context.Background(), imp)
+	require.NoError(t, err)
+
+	assert.True(t, fetcher.fetchNext(context.Background()))
+	assert.False(t, fetcher.fetchNext(context.Background()))
+
+	stored := store.get(imp.ID)
+	assert.Equal(t, models.ImportStatusCompleted, stored.Status)
+	assert.Equal(t, int64(len(content)), stored.Size)
+	assert.Equal(t, checksum, stored.Checksum)
+
+	require.Len(t, store.videos, 1)
+	video := store.videos[0]
+	assert.Equal(t, "video-1", video.ID)
+	assert.Equal(t, checksum, video.Checksum)
+	assert.Equal(t, 1920, video.Width)
+
+	reader, err := blobs.Get(context.Background(), video.OriginalURL)
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+
+	require.Len(t, store.jobs, 2)
+	for _, job := range store.jobs {
+		assert.Equal(t, video.ID, job.VideoID)
+		assert.Equal(t, models.JobStatusPending, job.Status)
+	}
+}
+
+func TestFetcherRetriesChecksumMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("corrupted"))
+	}))
+	defer server.Close()
+
+	store := newFakeStore()
+	fetcher, _ := newTestFetcher(t, store, &fakeProber{}, 0)
+
+	imp := newImport(server.URL + "/movie.mp4")
+	imp.ExpectedChecksum = hex.EncodeToString(make([]byte, sha256.Size))
+	_, err := store.CreateImport(context.Background(), imp)
+	require.NoError(t, err)
+
+	fetcher.fetchNext(context.Background())
+
+	stored := store.get(imp.ID)
+	assert.Equal(t, models.ImportStatusPending, stored.Status)
+	assert.Contains(t, stored.ErrorMsg, "checksum mismatch")
+	assert.True(t, stored.NextAttemptAt.After(time.Now()))
+	assert.Empty(t, store.videos)
+}
+
+func TestFetcherFailsAfterMaxAttempts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	store := newFakeStore()
+	fetcher, _ := newTestFetcher(t, store, &fakeProber{}, 0)
+
+	imp := newImport(server.URL + "/movie.mp4")
+	_, err := store.CreateImport(context.Background(), imp)
+	require.NoError(t, err)
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		store.mu.Lock()
+		store.imports[imp.ID].NextAttemptAt = time.Time{}
+		store.mu.Unlock()
+
+		require.True(t, fetcher.fetchNext(context.Background()))
+	}
+
+	stored := store.get(imp.ID)
+	assert.Equal(t, models.ImportStatusFailed, stored.Status)
+	assert.Equal(t, 3, stored.Attempts)
+	assert.Contains(t, stored.ErrorMsg, "503")
+}
+
+func TestFetcherFailsPermanentErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.mp4" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(make([]byte, 100))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		maxSize int64
+		prober  *fakeProber
+		errMsg  string
+	}{
+		{name: "not found", path: "/missing.mp4", prober: &fakeProber{}, errMsg: "404"},
+		{name: "too large", path: "/movie.mp4", maxSize: 50, prober: &fakeProber{}, errMsg: "limit"},
+		{name: "not a video", path: "/movie.mp4", prober: &fakeProber{err: fmt.Errorf("invalid data")}, errMsg: "metadata"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore()
+			fetcher, _ := newTestFetcher(t, store, tt.prober, tt.maxSize)
+
+			imp := newImport(server.URL + tt.path)
+			_, err := store.CreateImport(context.Background(), imp)
+			require.NoError(t, err)
+
+			fetcher.fetchNext(context.Background())
+
+			stored := store.get(imp.ID)
+			assert.Equal(t, models.ImportStatusFailed, stored.Status)
+			assert.Equal(t, 1, stored.Attempts)
+			assert.Contains(t, stored.ErrorMsg, tt.errMsg)
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, 30*time.Second, retryDelay(1))
+	assert.Equal(t, time.Minute, retryDelay(2))
+	assert.Equal(t, 2*time.Minute, retryDelay(3))
+	assert.Equal(t, time.Hour, retryDelay(20))
+}
@@ -0,0 +1,191 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/therealutkarshpriyadarshi/transcode/internal/config"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/netguard"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+)
+
+// Sources opens the files imports are fetched from
+type Sources struct {
+	client *http.Client
+
+	// bucket opens an S3 bucket by name
+	bucket  func(name string) (storage.Blobstore, error)
+	mu      sync.Mutex
+	buckets map[string]storage.Blobstore
+}
+
+// NewSources creates sources reading HTTP(S) URLs, and s3:// URIs with the
+// endpoint and credentials of the storage config. Unless allowPrivate is set,
+// HTTP(S) URLs must resolve to public addresses, so imports cannot be used to
+// reach internal services.
+func NewSources(cfg config.StorageConfig, allowPrivate bool) *Sources {
+	return newSources(allowPrivate, func(name string) (storage.Blobstore, error) {
+		return storage.OpenMinIOBucket(cfg, name)
+	})
+}
+
+func newSources(allowPrivate bool, bucket func(name string) (storage.Blobstore, error)) *Sources {
+	return &Sources{
+		client:  &http.Client{Transport: netguard.Transport(allowPrivate)},
+		bucket:  bucket,
+		buckets: make(map[string]storage.Blobstore),
+	}
+}
+
+// ValidateURL checks that a URL submitted through the API can be imported: an
+// HTTP(S) URL, or an s3:// URI of one of allowedBuckets
+func ValidateURL(raw string, allowedBuckets []string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return fmt.Errorf("URL has no host")
+		}
+		return nil
+	case "s3":
+		if strings.Trim(u.Path, "/") == "" {
+			return fmt.Errorf("s3 URI has no key")
+		}
+		for _, bucket := range allowedBuckets {
+			if u.Host == bucket {
+				return nil
+			}
+		}
+		return fmt.Errorf("imports from bucket %q are not allowed", u.Host)
+	default:
+		return fmt.Errorf("unsupported URL scheme %q, use http, https or s3", u.Scheme)
+	}
+}
+
+// Filename returns the name of the file a URL points to
+func Filename(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "import"
+	}
+
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return "import"
+	}
+	return name
+}
+
+// Open opens the file at a URL, returning its size or -1 when unknown
+func (s *Sources) Open(ctx context.Context, raw string) (io.ReadCloser, int64, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, 0, permanent(fmt.Errorf("invalid URL: %w", err))
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return s.openHTTP(ctx, raw)
+	case "s3":
+		return s.openS3(ctx, u.Host, strings.TrimPrefix(u.Path, "/"))
+	case "file":
+		return openFile(u.Path)
+	default:
+		return nil, 0, permanent(fmt.Errorf("unsupported URL scheme %q", u.Scheme))
+	}
+}
+
+func (s *Sources) openHTTP(ctx context.Context, raw string) (io.ReadCloser, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, raw, nil)
+	if err != nil {
+		return nil, 0, permanent(err)
+	}
+
+	resp, err := s.client.Do(req)
+	if errors.Is(err, netguard.ErrPrivateAddress) {
+		return nil, 0, permanent(err)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err := fmt.Errorf("source responded %s", resp.Status)
+		// Other client errors will not change on retry
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return nil, 0, permanent(err)
+		}
+		return nil, 0, err
+	}
+
+	return resp.Body, resp.ContentLength, nil
+}
+
+func (s *Sources) openS3(ctx context.Context, bucket, key string) (io.ReadCloser, int64, error) {
+	store, err := s.Bucket(bucket)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := store.Stat(ctx, key)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return nil, 0, permanent(fmt.Errorf("s3://%s/%s does not exist", bucket, key))
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	reader, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return reader, info.Size, nil
+}
+
+func openFile(filePath string) (io.ReadCloser, int64, error) {
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, 0, permanent(err)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+// Bucket returns the store of an S3 bucket, opening it on first use
+func (s *Sources) Bucket(name string) (storage.Blobstore, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if store, ok := s.buckets[name]; ok {
+		return store, nil
+	}
+
+	store, err := s.bucket(name)
+	if err != nil {
+		return nil, err
+	}
+	s.buckets[name] = store
+	return store, nil
+}
@@ -0,0 +1,87 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/netguard"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+)
+
+func TestValidateURL(t *testing.T) {
+	allowed := []string{"partner-drops"}
+
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{url: "https://example.com/movie.mp4", valid: true},
+		{url: "http://example.com/movie.mp4", valid: true},
+		{url: "s3://partner-drops/incoming/movie.mp4", valid: true},
+		{url: "s3://other-bucket/movie.mp4", valid: false},
+		{url: "s3://partner-drops/", valid: false},
+		{url: "file:///etc/passwd", valid: false},
+		{url: "ftp://example.com/movie.mp4", valid: false},
+		{url: "https:///movie.mp4", valid: false},
+		{url: "://bad", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := ValidateURL(tt.url, allowed)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestFilename(t *testing.T) {
+	assert.Equal(t, "movie.mp4", Filename("https://example.com/media/movie.mp4?token=abc"))
+	assert.Equal(t, "clip.mov", Filename("s3://bucket/incoming/clip.mov"))
+	assert.Equal(t, "import", Filename("https://example.com/"))
+}
+
+func TestSourcesRefusePrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal secrets"))
+	}))
+	defer server.Close()
+
+	sources := newSources(false, func(name string) (storage.Blobstore, error) {
+		return storage.NewMemoryStore(), nil
+	})
+
+	_, _, err := sources.Open(context.Background(), server.URL+"/movie.mp4")
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, netguard.ErrPrivateAddress))
+
+	var perm *permanentError
+	assert.True(t, errors.As(err, &perm))
+}
+
+func TestSourcesOpenS3(t *testing.T) {
+	bucket := storage.NewMemoryStore()
+	require.NoError(t, bucket.Put(context.Background(), "incoming/movie.mp4", strings.NewReader("video"), 5, "video/mp4"))
+
+	sources := newSources(false, func(name string) (storage.Blobstore, error) {
+		return bucket, nil
+	})
+
+	reader, size, err := sources.Open(context.Background(), "s3://partner-drops/incoming/movie.mp4")
+	require.NoError(t, err)
+	reader.Close()
+	assert.Equal(t, int64(5), size)
+
+	_, _, err = sources.Open(context.Background(), "s3://partner-drops/incoming/missing.mp4")
+	var perm *permanentError
+	assert.True(t, errors.As(err, &perm))
+}
@@ -0,0 +1,155 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/config"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// DefaultWatchInterval is how often watch folders are listed when not configured
+const DefaultWatchInterval = time.Minute
+
+// Watcher imports the new files of a watch folder: an S3 bucket prefix or a
+// local directory. Each version of a file is imported once, even with several
+// workers watching the same folder.
+type Watcher struct {
+	store  Store
+	folder storage.Blobstore
+	prefix string
+	url    func(key string) string
+	cfg    config.WatchFolderConfig
+
+	// seen holds the files of the last listing. A file is only imported once
+	// it is unchanged between two listings, so it is not fetched while still
+	// being written.
+	seen map[string]storage.ObjectInfo
+}
+
+// NewWatcher creates a watcher of the folder configured by cfg
+func NewWatcher(store Store, sources *Sources, cfg config.WatchFolderConfig) (*Watcher, error) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultWatchInterval
+	}
+
+	w := &Watcher{
+		store: store,
+		cfg:   cfg,
+		seen:  make(map[string]storage.ObjectInfo),
+	}
+
+	if strings.HasPrefix(cfg.Source, "s3://") {
+		u, err := url.Parse(cfg.Source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid watch folder %s: %w", cfg.Source, err)
+		}
+
+		bucket := u.Host
+		if w.folder, err = sources.Bucket(bucket); err != nil {
+			return nil, err
+		}
+		w.prefix = strings.TrimPrefix(u.Path, "/")
+		w.url = func(key string) string { return "s3://" + bucket + "/" + key }
+		return w, nil
+	}
+
+	dir, err := filepath.Abs(cfg.Source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid watch folder %s: %w", cfg.Source, err)
+	}
+	if w.folder, err = storage.NewLocalStore(dir, ""); err != nil {
+		return nil, err
+	}
+	w.url = func(key string) string {
+		return (&url.URL{Scheme: "file", Path: filepath.Join(dir, filepath.FromSlash(key))}).String()
+	}
+	return w, nil
+}
+
+// Run lists the folder every interval until ctx is done
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	w.poll(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.poll(ctx)
+		}
+	}
+}
+
+// poll lists the folder and creates imports of the files unchanged since the
+// last listing
+func (w *Watcher) poll(ctx context.Context) {
+	objects, err := w.folder.List(ctx, w.prefix)
+	if err != nil {
+		log.Printf("Failed to list watch folder %s: %v", w.cfg.Source, err)
+		return
+	}
+
+	seen := make(map[string]storage.ObjectInfo, len(objects))
+	for _, object := range objects {
+		if strings.HasPrefix(path.Base(object.Key), ".") || strings.HasSuffix(object.Key, "/") {
+			continue
+		}
+		seen[object.Key] = object
+
+		previous, ok := w.seen[object.Key]
+		if !ok || previous.Size != object.Size || !previous.LastModified.Equal(object.LastModified) {
+			continue
+		}
+
+		if err := w.importFile(ctx, object); err != nil {
+			log.Printf("Failed to import %s from watch folder %s: %v", object.Key, w.cfg.Source, err)
+			// Forget the file so it is retried after the next listing
+			delete(seen, object.Key)
+		}
+	}
+	w.seen = seen
+}
+
+// importFile creates an import of a file unless its version was imported
+func (w *Watcher) importFile(ctx context.Context, object storage.ObjectInfo) error {
+	sourceURL := w.url(object.Key)
+	watchKey := fmt.Sprintf("%s@%d/%s", sourceURL, object.Size, object.LastModified.UTC().Format(time.RFC3339Nano))
+
+	imp := &models.Import{
+		ID:        uuid.New().String(),
+		SourceURL: sourceURL,
+		Filename:  path.Base(object.Key),
+		Priority:  w.cfg.Priority,
+		Jobs:      w.cfg.Jobs,
+		Status:    models.ImportStatusPending,
+		VideoID:   uuid.New().String(),
+		WatchKey:  &watchKey,
+	}
+	if imp.Jobs == nil {
+		imp.Jobs = []models.TranscodeConfig{}
+	}
+	if w.cfg.UserID != "" {
+		userID := w.cfg.UserID
+		imp.UserID = &userID
+	}
+
+	created, err := w.store.CreateImport(ctx, imp)
+	if err != nil {
+		return err
+	}
+	if created {
+		log.Printf("Watch folder %s: importing %s as import %s", w.cfg.Source, object.Key, imp.ID)
+	}
+	return nil
+}
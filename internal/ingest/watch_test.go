@@ -0,0 +1,64 @@
+package ingest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/config"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+func TestWatcherImportsSettledFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "movie.mp4"), []byte("video"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".movie.mp4.part"), []byte("partial"), 0644))
+
+	store := newFakeStore()
+	watcher, err := NewWatcher(store, nil, config.WatchFolderConfig{
+		Source:   dir,
+		UserID:   "user-1",
+		Priority: models.JobPriorityHigh,
+		Jobs:     []models.TranscodeConfig{{Resolution: "720p"}},
+	})
+	require.NoError(t, err)
+
+	// Files are imported once unchanged between two listings
+	watcher.poll(context.Background())
+	assert.Empty(t, store.imports)
+
+	watcher.poll(context.Background())
+	require.Len(t, store.imports, 1)
+
+	var imp *models.Import
+	for _, stored := range store.imports {
+		imp = stored
+	}
+	assert.Equal(t, "file://"+filepath.Join(dir, "movie.mp4"), imp.SourceURL)
+	assert.Equal(t, "movie.mp4", imp.Filename)
+	assert.Equal(t, models.JobPriorityHigh, imp.Priority)
+	require.NotNil(t, imp.UserID)
+	assert.Equal(t, "user-1", *imp.UserID)
+	assert.Len(t, imp.Jobs, 1)
+
+	// The same version is not imported again, by this or another watcher
+	watcher.poll(context.Background())
+	other, err := NewWatcher(store, nil, config.WatchFolderConfig{Source: dir})
+	require.NoError(t, err)
+	other.poll(context.Background())
+	other.poll(context.Background())
+	assert.Len(t, store.imports, 1)
+
+	// A changed file is a new version
+	modTime := time.Now().Add(time.Minute)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "movie.mp4"), []byte("new video"), 0644))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "movie.mp4"), modTime, modTime))
+	watcher.poll(context.Background())
+	assert.Len(t, store.imports, 1)
+	watcher.poll(context.Background())
+	assert.Len(t, store.imports, 2)
+}
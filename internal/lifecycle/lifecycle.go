@@ -0,0 +1,426 @@
+// Package lifecycle applies storage lifecycle policies: it deletes expired
+// source files and unused renditions, moves idle outputs to cold storage and
+// collects objects no database row references.
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/therealutkarshpriyadarshi/transcode/internal/config"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+const (
+	// leaseName is the lease held by the replica running the lifecycle
+	leaseName = "lifecycle"
+
+	// maxReportActions is how many actions a report lists
+	maxReportActions = 1000
+
+	// lookupBatchSize is how many videos the collector looks up at once
+	lookupBatchSize = 500
+
+	videosPrefix = "videos/"
+)
+
+// managedDirs are the directories of a video whose objects are all
+// referenced by rows. Objects in other directories, like HLS and DASH
+// segments, are only collected with their video.
+var managedDirs = map[string]bool{
+	"original":   true,
+	"outputs":    true,
+	"thumbnails": true,
+	"subtitles":  true,
+}
+
+// Store finds the objects lifecycle rules apply to and records their changes
+type Store interface {
+	ListExpiredSources(ctx context.Context, defaultDays, limit int) ([]*models.Video, error)
+	ClearVideoSource(ctx context.Context, videoID, key string) (bool, error)
+	ListUnusedOutputs(ctx context.Context, defaultDays, limit int) ([]*models.Output, error)
+	ListColdOutputs(ctx context.Context, defaultDays, limit int) ([]*models.Output, error)
+	DeleteOutput(ctx context.Context, outputID string) error
+	MoveOutputToCold(ctx context.Context, outputID, path, url string) (bool, error)
+	ListVideoObjects(ctx context.Context, videoIDs []string) (map[string]*models.VideoObjects, error)
+}
+
+// LeaseStore grants the lifecycle lease to one replica at a time
+type LeaseStore interface {
+	AcquireSchedulerLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+}
+
+// Manager runs the lifecycle
+type Manager struct {
+	store Store
+	hot   storage.Blobstore
+	cfg   config.LifecycleConfig
+
+	// cold receives outputs moved to cold storage. coldSeparate tells
+	// whether it is another bucket, rather than hot with a cheaper class.
+	cold         storage.Blobstore
+	coldSeparate bool
+
+	lease  LeaseStore
+	holder string
+}
+
+// NewManager creates a manager of the objects in hot
+func NewManager(store Store, hot storage.Blobstore, cfg config.LifecycleConfig) *Manager {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+
+	return &Manager{
+		store: store,
+		hot:   hot,
+		cfg:   cfg,
+	}
+}
+
+// SetColdStore moves idle outputs to cold. separate tells whether cold is
+// another bucket, in which case moved outputs are deleted from hot.
+func (m *Manager) SetColdStore(cold storage.Blobstore, separate bool) {
+	m.cold = cold
+	m.coldSeparate = separate
+}
+
+// SetLeaderElection makes the manager run only while holder holds the
+// lifecycle lease, so one of several replicas runs it
+func (m *Manager) SetLeaderElection(lease LeaseStore, holder string) {
+	m.lease = lease
+	m.holder = holder
+}
+
+// Defaults returns the policy of tenants without one of their own
+func (m *Manager) Defaults() *models.LifecyclePolicy {
+	deleteSource := m.cfg.DeleteSourceAfterDays
+	deleteRenditions := m.cfg.DeleteUnusedRenditionsAfterDays
+	cold := m.cfg.ColdStorageAfterDays
+	return &models.LifecyclePolicy{
+		DeleteSourceAfterDays:           &deleteSource,
+		DeleteUnusedRenditionsAfterDays: &deleteRenditions,
+		ColdStorageAfterDays:            &cold,
+	}
+}
+
+// Run runs the lifecycle every interval until ctx is done
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if m.lease != nil {
+				// Held for an interval, so the holder keeps it from run to run
+				acquired, err := m.lease.AcquireSchedulerLease(ctx, leaseName, m.holder, m.cfg.Interval+m.cfg.Interval/2)
+				if err != nil {
+					log.Printf("Failed to acquire lifecycle lease: %v", err)
+					continue
+				}
+				if !acquired {
+					continue
+				}
+			}
+
+			report := m.RunOnce(ctx, m.cfg.DryRun)
+			log.Printf("Lifecycle run (dry run %t): %v, %d errors, %d objects listed",
+				report.DryRun, report.Counts, report.Errors, report.ObjectsSeen)
+		}
+	}
+}
+
+// RunOnce applies the lifecycle rules and collects orphans once. In a dry run
+// nothing is changed and the report lists what would have been.
+func (m *Manager) RunOnce(ctx context.Context, dryRun bool) *models.LifecycleReport {
+	report := &models.LifecycleReport{
+		DryRun:    dryRun,
+		StartedAt: time.Now(),
+		Counts:    make(map[string]int),
+		Bytes:     make(map[string]int64),
+		Actions:   []models.LifecycleAction{},
+	}
+
+	// Rules run with a default of 0 too, for the tenants enabling them
+	m.deleteSources(ctx, report)
+	m.deleteRenditions(ctx, report)
+	if m.cold != nil {
+		m.moveToCold(ctx, report)
+	}
+	m.collectOrphans(ctx, report, models.StorageTierHot, m.hot)
+	if m.cold != nil && m.coldSeparate {
+		m.collectOrphans(ctx, report, models.StorageTierCold, m.cold)
+	}
+
+	report.FinishedAt = time.Now()
+	return report
+}
+
+// record adds an action to the report
+func (m *Manager) record(report *models.LifecycleReport, action models.LifecycleAction, err error) {
+	if err != nil {
+		action.Error = err.Error()
+		report.Errors++
+		log.Printf("Lifecycle %s of %s failed: %v", action.Action, action.Key, err)
+	} else {
+		report.Counts[action.Action]++
+		report.Bytes[action.Action] += action.Size
+	}
+
+	if len(report.Actions) < maxReportActions {
+		report.Actions = append(report.Actions, action)
+	} else {
+		report.Truncated = true
+	}
+}
+
+// deleteSources deletes the originals of videos past their retention. The
+// row is cleared first, so a failed delete leaves an orphan to collect.
+func (m *Manager) deleteSources(ctx context.Context, report *models.LifecycleReport) {
+	videos, err := m.store.ListExpiredSources(ctx, m.cfg.DeleteSourceAfterDays, m.cfg.BatchSize)
+	if err != nil {
+		log.Printf("Lifecycle: %v", err)
+		report.Errors++
+		return
+	}
+
+	for _, video := range videos {
+		action := models.LifecycleAction{
+			Action:  models.LifecycleActionDeleteSource,
+			Tier:    models.StorageTierHot,
+			Key:     video.OriginalURL,
+			VideoID: video.ID,
+			Size:    video.Size,
+			Reason:  "source retention expired",
+		}
+		if report.DryRun {
+			m.record(report, action, nil)
+			continue
+		}
+
+		cleared, err := m.store.ClearVideoSource(ctx, video.ID, video.OriginalURL)
+		if err == nil && !cleared {
+			continue
+		}
+		if err == nil {
+			err = m.hot.Delete(ctx, video.OriginalURL)
+		}
+		m.record(report, action, err)
+	}
+}
+
+// deleteRenditions deletes outputs that were not played within their
+// tenant's rule
+func (m *Manager) deleteRenditions(ctx context.Context, report *models.LifecycleReport) {
+	outputs, err := m.store.ListUnusedOutputs(ctx, m.cfg.DeleteUnusedRenditionsAfterDays, m.cfg.BatchSize)
+	if err != nil {
+		log.Printf("Lifecycle: %v", err)
+		report.Errors++
+		return
+	}
+
+	for _, output := range outputs {
+		action := models.LifecycleAction{
+			Action:   models.LifecycleActionDeleteRendition,
+			Tier:     output.StorageTier,
+			Key:      output.Path,
+			VideoID:  output.VideoID,
+			OutputID: output.ID,
+			Size:     output.Size,
+			Reason:   "not played within retention",
+		}
+		if report.DryRun {
+			m.record(report, action, nil)
+			continue
+		}
+
+		err := m.store.DeleteOutput(ctx, output.ID)
+		if err == nil && output.Path != "" {
+			err = m.tierStore(output.StorageTier).Delete(ctx, output.Path)
+		}
+		m.record(report, action, err)
+	}
+}
+
+// moveToCold copies idle outputs to cold storage and points their rows there
+func (m *Manager) moveToCold(ctx context.Context, report *models.LifecycleReport) {
+	outputs, err := m.store.ListColdOutputs(ctx, m.cfg.ColdStorageAfterDays, m.cfg.BatchSize)
+	if err != nil {
+		log.Printf("Lifecycle: %v", err)
+		report.Errors++
+		return
+	}
+
+	for _, output := range outputs {
+		if output.Path == "" {
+			continue
+		}
+
+		action := models.LifecycleAction{
+			Action:   models.LifecycleActionMoveToCold,
+			Tier:     models.StorageTierHot,
+			Key:      output.Path,
+			VideoID:  output.VideoID,
+			OutputID: output.ID,
+			Size:     output.Size,
+			Reason:   "not played within cold storage rule",
+		}
+		if report.DryRun {
+			m.record(report, action, nil)
+			continue
+		}
+
+		m.record(report, action, m.moveOutput(ctx, output))
+	}
+}
+
+// moveOutput moves an output's object to cold storage
+func (m *Manager) moveOutput(ctx context.Context, output *models.Output) error {
+	info, err := m.hot.Stat(ctx, output.Path)
+	if err != nil {
+		return err
+	}
+	reader, err := m.hot.Get(ctx, output.Path)
+	if err != nil {
+		return err
+	}
+	err = m.cold.Put(ctx, output.Path, reader, info.Size, info.ContentType)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	url, err := storage.GetURL(ctx, m.cold, output.Path)
+	if err != nil {
+		return err
+	}
+
+	moved, err := m.store.MoveOutputToCold(ctx, output.ID, output.Path, url)
+	if err != nil {
+		return err
+	}
+	if !m.coldSeparate {
+		return nil
+	}
+	if !moved {
+		// The output changed meanwhile and stays hot
+		return m.cold.Delete(ctx, output.Path)
+	}
+	return m.hot.Delete(ctx, output.Path)
+}
+
+// tierStore returns the store holding objects of tier
+func (m *Manager) tierStore(tier string) storage.Blobstore {
+	if tier == models.StorageTierCold && m.cold != nil {
+		return m.cold
+	}
+	return m.hot
+}
+
+// collectOrphans deletes the objects of store, older than the grace period,
+// that belong to deleted videos or that no row references
+func (m *Manager) collectOrphans(ctx context.Context, report *models.LifecycleReport, tier string, store storage.Blobstore) {
+	objects, err := store.List(ctx, videosPrefix)
+	if err != nil {
+		log.Printf("Lifecycle: failed to list %s objects: %v", tier, err)
+		report.Errors++
+		return
+	}
+	report.ObjectsSeen += len(objects)
+
+	cutoff := time.Now().Add(-m.cfg.OrphanGracePeriod)
+
+	// Objects are sorted by key, so those of a video are adjacent
+	for start := 0; start < len(objects); {
+		var ids []string
+		end := start
+		for end < len(objects) {
+			id, _ := splitKey(objects[end].Key)
+			if len(ids) == 0 || ids[len(ids)-1] != id {
+				if len(ids) == lookupBatchSize {
+					break
+				}
+				ids = append(ids, id)
+			}
+			end++
+		}
+
+		refs, err := m.store.ListVideoObjects(ctx, ids)
+		if err != nil {
+			log.Printf("Lifecycle: %v", err)
+			report.Errors++
+			return
+		}
+
+		for _, object := range objects[start:end] {
+			if object.LastModified.After(cutoff) {
+				continue
+			}
+
+			reason := m.orphanReason(tier, object.Key, refs)
+			if reason == "" {
+				continue
+			}
+
+			id, _ := splitKey(object.Key)
+			action := models.LifecycleAction{
+				Action:  models.LifecycleActionDeleteOrphan,
+				Tier:    tier,
+				Key:     object.Key,
+				VideoID: id,
+				Size:    object.Size,
+				Reason:  reason,
+			}
+			if report.DryRun {
+				m.record(report, action, nil)
+				continue
+			}
+			m.record(report, action, store.Delete(ctx, object.Key))
+		}
+
+		start = end
+	}
+}
+
+// orphanReason returns why the object under key in tier is an orphan, or ""
+// when it is not
+func (m *Manager) orphanReason(tier, key string, refs map[string]*models.VideoObjects) string {
+	id, dir := splitKey(key)
+	objects, ok := refs[id]
+	if !ok {
+		return "video does not exist"
+	}
+	if !managedDirs[dir] {
+		return ""
+	}
+
+	referenced := objects.Cold[key]
+	if tier == models.StorageTierHot {
+		// Cold outputs stay in the hot store when it only changes their class
+		referenced = objects.Hot[key] || (!m.coldSeparate && objects.Cold[key])
+	}
+	if referenced {
+		return ""
+	}
+	return fmt.Sprintf("not referenced by video %s", id)
+}
+
+// splitKey returns the video ID and directory of a key under videos/
+func splitKey(key string) (videoID, dir string) {
+	parts := strings.SplitN(strings.TrimPrefix(key, videosPrefix), "/", 3)
+	if len(parts) < 3 {
+		// An object directly under the video, in no directory
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
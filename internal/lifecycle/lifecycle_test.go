@@ -0,0 +1,293 @@
+package lifecycle
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/config"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// fakeStore holds the rows the lifecycle looks at in memory
+type fakeStore struct {
+	mu      sync.Mutex
+	videos  map[string]*models.Video
+	outputs map[string]*models.Output
+
+	expiredSources []string // video IDs ListExpiredSources returns
+	unusedOutputs  []string // output IDs ListUnusedOutputs returns
+	coldOutputs    []string // output IDs ListColdOutputs returns
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		videos:  make(map[string]*models.Video),
+		outputs: make(map[string]*models.Output),
+	}
+}
+
+func (s *fakeStore) ListExpiredSources(ctx context.Context, defaultDays, limit int) ([]*models.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var videos []*models.Video
+	for _, id := range s.expiredSources {
+		copied := *s.videos[id]
+		videos = append(videos, &copied)
+	}
+	return videos, nil
+}
+
+func (s *fakeStore) ClearVideoSource(ctx context.Context, videoID, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	video, ok := s.videos[videoID]
+	if !ok || video.OriginalURL != key {
+		return false, nil
+	}
+	video.OriginalURL = ""
+	return true, nil
+}
+
+func (s *fakeStore) listOutputs(ids []string) []*models.Output {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var outputs []*models.Output
+	for _, id := range ids {
+		if output, ok := s.outputs[id]; ok {
+			copied := *output
+			outputs = append(outputs, &copied)
+		}
+	}
+	return outputs
+}
+
+func (s *fakeStore) ListUnusedOutputs(ctx context.Context, defaultDays, limit int) ([]*models.Output, error) {
+	return s.listOutputs(s.unusedOutputs), nil
+}
+
+func (s *fakeStore) ListColdOutputs(ctx context.Context, defaultDays, limit int) ([]*models.Output, error) {
+	return s.listOutputs(s.coldOutputs), nil
+}
+
+func (s *fakeStore) DeleteOutput(ctx context.Context, outputID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.outputs, outputID)
+	return nil
+}
+
+func (s *fakeStore) MoveOutputToCold(ctx context.Context, outputID, path, url string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	output, ok := s.outputs[outputID]
+	if !ok || output.Path != path || output.StorageTier != models.StorageTierHot {
+		return false, nil
+	}
+	output.StorageTier = models.StorageTierCold
+	output.URL = url
+	return true, nil
+}
+
+func (s *fakeStore) ListVideoObjects(ctx context.Context, videoIDs []string) (map[string]*models.VideoObjects, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objects := make(map[string]*models.VideoObjects)
+	for _, id := range videoIDs {
+		video, ok := s.videos[id]
+		if !ok {
+			continue
+		}
+		refs := &models.VideoObjects{Hot: make(map[string]bool), Cold: make(map[string]bool)}
+		if video.OriginalURL != "" {
+			refs.Hot[video.OriginalURL] = true
+		}
+		objects[id] = refs
+	}
+	for _, output := range s.outputs {
+		if refs, ok := objects[output.VideoID]; ok {
+			if output.StorageTier == models.StorageTierCold {
+				refs.Cold[output.Path] = true
+			} else {
+				refs.Hot[output.Path] = true
+			}
+		}
+	}
+	return objects, nil
+}
+
+func (s *fakeStore) addVideo(id string) {
+	s.videos[id] = &models.Video{ID: id, OriginalURL: "videos/" + id + "/original/movie.mp4", Size: 5}
+}
+
+func (s *fakeStore) addOutput(id, videoID, name string) {
+	s.outputs[id] = &models.Output{
+		ID:          id,
+		VideoID:     videoID,
+		Path:        "videos/" + videoID + "/outputs/" + name,
+		Size:        3,
+		StorageTier: models.StorageTierHot,
+	}
+}
+
+func put(t *testing.T, store storage.Blobstore, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		require.NoError(t, store.Put(context.Background(), key, strings.NewReader("abc"), 3, "video/mp4"))
+	}
+}
+
+func keys(t *testing.T, store storage.Blobstore) []string {
+	t.Helper()
+	objects, err := store.List(context.Background(), "")
+	require.NoError(t, err)
+
+	var keys []string
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+	}
+	return keys
+}
+
+func TestCollectOrphans(t *testing.T) {
+	store := newFakeStore()
+	store.addVideo("v1")
+	store.addOutput("o1", "v1", "720p.mp4")
+
+	hot := storage.NewMemoryStore()
+	put(t, hot,
+		"videos/v1/original/movie.mp4",
+		"videos/v1/outputs/720p.mp4",
+		"videos/v1/outputs/480p.mp4", // failed to be recorded
+		"videos/v1/hls/segment_000.ts",
+		"videos/v2/original/movie.mp4", // of a deleted video
+		"videos/v2/hls/segment_000.ts",
+		"uploads/u1/part-00001", // not the lifecycle's
+	)
+
+	manager := NewManager(store, hot, config.LifecycleConfig{})
+
+	report := manager.RunOnce(context.Background(), true)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 3, report.Counts[models.LifecycleActionDeleteOrphan])
+	assert.Equal(t, int64(9), report.Bytes[models.LifecycleActionDeleteOrphan])
+	assert.Equal(t, 6, report.ObjectsSeen)
+	assert.Len(t, keys(t, hot), 7, "a dry run deletes nothing")
+
+	var orphans []string
+	for _, action := range report.Actions {
+		orphans = append(orphans, action.Key)
+	}
+	assert.ElementsMatch(t, []string{
+		"videos/v1/outputs/480p.mp4",
+		"videos/v2/original/movie.mp4",
+		"videos/v2/hls/segment_000.ts",
+	}, orphans)
+
+	report = manager.RunOnce(context.Background(), false)
+	assert.Equal(t, 3, report.Counts[models.LifecycleActionDeleteOrphan])
+	assert.Zero(t, report.Errors)
+	assert.ElementsMatch(t, []string{
+		"videos/v1/original/movie.mp4",
+		"videos/v1/outputs/720p.mp4",
+		"videos/v1/hls/segment_000.ts",
+		"uploads/u1/part-00001",
+	}, keys(t, hot))
+}
+
+func TestCollectOrphansKeepsRecentObjects(t *testing.T) {
+	hot := storage.NewMemoryStore()
+	put(t, hot, "videos/v2/original/movie.mp4")
+
+	manager := NewManager(newFakeStore(), hot, config.LifecycleConfig{OrphanGracePeriod: time.Hour})
+	report := manager.RunOnce(context.Background(), false)
+
+	assert.Zero(t, report.Counts[models.LifecycleActionDeleteOrphan])
+	assert.Len(t, keys(t, hot), 1)
+}
+
+func TestDeleteSourcesAndRenditions(t *testing.T) {
+	store := newFakeStore()
+	store.addVideo("v1")
+	store.addOutput("o1", "v1", "720p.mp4")
+	store.addOutput("o2", "v1", "480p.mp4")
+	store.expiredSources = []string{"v1"}
+	store.unusedOutputs = []string{"o2"}
+
+	hot := storage.NewMemoryStore()
+	put(t, hot, "videos/v1/original/movie.mp4", "videos/v1/outputs/720p.mp4", "videos/v1/outputs/480p.mp4")
+
+	manager := NewManager(store, hot, config.LifecycleConfig{})
+	report := manager.RunOnce(context.Background(), false)
+
+	assert.Equal(t, 1, report.Counts[models.LifecycleActionDeleteSource])
+	assert.Equal(t, 1, report.Counts[models.LifecycleActionDeleteRendition])
+	assert.Zero(t, report.Counts[models.LifecycleActionDeleteOrphan])
+	assert.Zero(t, report.Errors)
+
+	assert.Empty(t, store.videos["v1"].OriginalURL)
+	assert.NotContains(t, store.outputs, "o2")
+	assert.Equal(t, []string{"videos/v1/outputs/720p.mp4"}, keys(t, hot))
+}
+
+func TestMoveToColdBucket(t *testing.T) {
+	store := newFakeStore()
+	store.addVideo("v1")
+	store.addOutput("o1", "v1", "720p.mp4")
+	store.coldOutputs = []string{"o1"}
+
+	hot := storage.NewMemoryStore()
+	cold := storage.NewMemoryStore()
+	put(t, hot, "videos/v1/original/movie.mp4", "videos/v1/outputs/720p.mp4")
+
+	manager := NewManager(store, hot, config.LifecycleConfig{})
+	manager.SetColdStore(cold, true)
+
+	report := manager.RunOnce(context.Background(), false)
+	assert.Equal(t, 1, report.Counts[models.LifecycleActionMoveToCold])
+	assert.Zero(t, report.Counts[models.LifecycleActionDeleteOrphan], "moved outputs are not orphans in either store")
+	assert.Zero(t, report.Errors)
+
+	assert.Equal(t, models.StorageTierCold, store.outputs["o1"].StorageTier)
+	assert.Equal(t, []string{"videos/v1/original/movie.mp4"}, keys(t, hot))
+	assert.Equal(t, []string{"videos/v1/outputs/720p.mp4"}, keys(t, cold))
+
+	// Once the video is deleted its cold copies are orphans too
+	delete(store.videos, "v1")
+	delete(store.outputs, "o1")
+	report = manager.RunOnce(context.Background(), false)
+	assert.Equal(t, 2, report.Counts[models.LifecycleActionDeleteOrphan])
+	assert.Empty(t, keys(t, hot))
+	assert.Empty(t, keys(t, cold))
+}
+
+func TestMoveToColdStorageClass(t *testing.T) {
+	store := newFakeStore()
+	store.addVideo("v1")
+	store.addOutput("o1", "v1", "720p.mp4")
+	store.coldOutputs = []string{"o1"}
+
+	hot := storage.NewMemoryStore()
+	put(t, hot, "videos/v1/original/movie.mp4", "videos/v1/outputs/720p.mp4")
+
+	// The same bucket with a cheaper class keeps the object where it is
+	manager := NewManager(store, hot, config.LifecycleConfig{})
+	manager.SetColdStore(hot, false)
+
+	report := manager.RunOnce(context.Background(), false)
+	assert.Equal(t, 1, report.Counts[models.LifecycleActionMoveToCold])
+	assert.Zero(t, report.Counts[models.LifecycleActionDeleteOrphan])
+	assert.Equal(t, models.StorageTierCold, store.outputs["o1"].StorageTier)
+	assert.Len(t, keys(t, hot), 2)
+}
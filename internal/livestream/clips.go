@@ -0,0 +1,409 @@
+package livestream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/database"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// ErrClipOutOfRange is returned when a clip is not covered by the live playlist
+var ErrClipOutOfRange = errors.New("clip range is outside the live window")
+
+// cuts within this distance of a segment boundary count as keyframe aligned
+const clipBoundaryTolerance = 0.05
+
+// ClipRequest describes a clip of a running live stream. Start and End are
+// seconds behind the live edge, so {Start: 30, End: 0} clips the last 30 seconds.
+type ClipRequest struct {
+	Title string
+	Start float64
+	End   float64
+	Exact bool // re-encode to cut exactly at Start and End instead of the surrounding keyframes
+}
+
+// ClipSelection is the part of a live media playlist covering a clip
+type ClipSelection struct {
+	Playlist  string    // VOD playlist of the selected segments
+	Segments  []string  // segment and init section paths referenced by Playlist
+	Offset    float64   // requested start relative to the first selected segment
+	Duration  float64   // requested clip duration
+	Covered   float64   // duration of the selected segments
+	StartTime time.Time // wall clock time of the requested start, zero when unknown
+}
+
+// Aligned reports whether the clip starts and ends on segment boundaries
+func (s *ClipSelection) Aligned() bool {
+	return s.Offset < clipBoundaryTolerance && s.Covered-s.Offset-s.Duration < clipBoundaryTolerance
+}
+
+// SelectClipSegments picks the segments of a live media playlist that cover the
+// range [Start, End] seconds behind the live edge. Relative segment URIs are
+// resolved against dir, a directory or storage key prefix.
+func SelectClipSegments(playlist, dir string, start, end float64) (*ClipSelection, error) {
+	if end < 0 || start <= end {
+		return nil, fmt.Errorf("clip start must be further behind the live edge than its end")
+	}
+
+	type segment struct {
+		uri       string
+		duration  float64
+		dateTime  time.Time
+		tags      []string
+		initURI   string
+		timeStart float64
+	}
+
+	var segments []segment
+	var pending segment
+	var initURI string
+	targetDuration := ""
+	var total float64
+
+	for _, line := range strings.Split(playlist, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
+			targetDuration = line
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			initURI = mapURI(line)
+		case strings.HasPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:"):
+			value := strings.TrimPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:")
+			for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.000-0700"} {
+				if t, err := time.Parse(layout, value); err == nil {
+					pending.dateTime = t
+					break
+				}
+			}
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value := strings.TrimPrefix(line, "#EXTINF:")
+			if i := strings.Index(value, ","); i >= 0 {
+				value = value[:i]
+			}
+			duration, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid segment duration %q: %w", value, err)
+			}
+			pending.duration = duration
+			pending.tags = append(pending.tags, line)
+		case strings.HasPrefix(line, "#EXT-X-DISCONTINUITY"):
+			pending.tags = append(pending.tags, line)
+		case !strings.HasPrefix(line, "#"):
+			pending.uri = line
+			pending.initURI = initURI
+			pending.timeStart = total
+			total += pending.duration
+			segments = append(segments, pending)
+			pending = segment{}
+		}
+	}
+
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("live playlist has no segments")
+	}
+
+	from := total - start
+	to := total - end
+	if from < -clipBoundaryTolerance {
+		return nil, ErrClipOutOfRange
+	}
+	if from < 0 {
+		from = 0
+	}
+
+	resolve := func(uri string) string {
+		if path.IsAbs(uri) {
+			return uri
+		}
+		return path.Join(dir, uri)
+	}
+
+	var out []string
+	out = append(out, "#EXTM3U", "#EXT-X-VERSION:7")
+	if targetDuration != "" {
+		out = append(out, targetDuration)
+	}
+	out = append(out, "#EXT-X-PLAYLIST-TYPE:VOD")
+
+	selection := &ClipSelection{Duration: to - from}
+	currentInit := ""
+	first := true
+
+	for _, seg := range segments {
+		segEnd := seg.timeStart + seg.duration
+		if segEnd <= from+clipBoundaryTolerance || seg.timeStart >= to-clipBoundaryTolerance {
+			continue
+		}
+
+		if first {
+			selection.Offset = from - seg.timeStart
+			if selection.Offset < 0 {
+				selection.Offset = 0
+			}
+			if !seg.dateTime.IsZero() {
+				selection.StartTime = seg.dateTime.Add(time.Duration(selection.Offset * float64(time.Second)))
+			}
+		}
+
+		if seg.initURI != "" && seg.initURI != currentInit {
+			currentInit = seg.initURI
+			out = append(out, fmt.Sprintf("#EXT-X-MAP:URI=\"%s\"", resolve(seg.initURI)))
+			selection.Segments = append(selection.Segments, resolve(seg.initURI))
+		}
+
+		for _, tag := range seg.tags {
+			// A discontinuity before the first selected segment is meaningless
+			if first && strings.HasPrefix(tag, "#EXT-X-DISCONTINUITY") {
+				continue
+			}
+			out = append(out, tag)
+		}
+		out = append(out, resolve(seg.uri))
+		selection.Segments = append(selection.Segments, resolve(seg.uri))
+		selection.Covered += seg.duration
+		first = false
+	}
+
+	if first {
+		return nil, ErrClipOutOfRange
+	}
+
+	out = append(out, "#EXT-X-ENDLIST")
+	selection.Playlist = strings.Join(out, "\n") + "\n"
+
+	return selection, nil
+}
+
+// mapURI extracts the URI attribute of an EXT-X-MAP tag
+func mapURI(line string) string {
+	attrs := strings.TrimPrefix(line, "#EXT-X-MAP:")
+	i := strings.Index(attrs, "URI=\"")
+	if i < 0 {
+		return ""
+	}
+	uri := attrs[i+len("URI=\""):]
+	if j := strings.Index(uri, "\""); j >= 0 {
+		uri = uri[:j]
+	}
+	return uri
+}
+
+// ClipService turns moments of running live streams into VOD videos. It reads
+// the live window from storage, where the live nodes publish it, so clips can
+// be requested on any API host; the clips are assembled by worker jobs.
+type ClipService struct {
+	repo    *database.Repository
+	storage storage.Blobstore
+}
+
+// NewClipService creates a new clip service
+func NewClipService(repo *database.Repository, storage storage.Blobstore) *ClipService {
+	return &ClipService{
+		repo:    repo,
+		storage: storage,
+	}
+}
+
+// clipVariant is a live variant selected for a clip
+type clipVariant struct {
+	variant   *models.LiveStreamVariant
+	selection *ClipSelection
+}
+
+// CreateClip snapshots the live segments covering the request and creates the
+// clip video. It returns the clip and the job assembling it, for the caller to
+// submit; a clip.ready webhook is sent once the job completes.
+func (s *ClipService) CreateClip(ctx context.Context, stream *models.LiveStream, req ClipRequest) (*models.LiveStreamClip, *models.Job, error) {
+	variants, err := s.repo.GetLiveStreamVariants(ctx, stream.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get variants: %w", err)
+	}
+	if len(variants) == 0 {
+		return nil, nil, fmt.Errorf("live stream has no variants")
+	}
+
+	clipID := uuid.New().String()
+	sourcePrefix := fmt.Sprintf("videos/%s/clip_sources/", clipID)
+
+	// Live segments are deleted as the playlist slides, so the selected
+	// segments are copied out of the live window before returning
+	var selected []*clipVariant
+	for _, variant := range variants {
+		playlist, err := s.readPlaylist(ctx, LiveStorageKey(stream.ID, variant.Resolution+".m3u8"))
+		if err != nil {
+			s.deleteSources(sourcePrefix)
+			return nil, nil, fmt.Errorf("failed to read playlist for %s: %w", variant.Resolution, err)
+		}
+
+		selection, err := SelectClipSegments(playlist, LiveStorageKey(stream.ID, ""), req.Start, req.End)
+		if err != nil {
+			s.deleteSources(sourcePrefix)
+			return nil, nil, err
+		}
+
+		if err := snapshotSegments(ctx, s.storage, selection, sourcePrefix+variant.Resolution); err != nil {
+			s.deleteSources(sourcePrefix)
+			return nil, nil, fmt.Errorf("failed to snapshot segments for %s: %w", variant.Resolution, err)
+		}
+
+		selected = append(selected, &clipVariant{variant: variant, selection: selection})
+	}
+
+	// The highest quality variant describes the clip
+	best := selected[0]
+	for _, v := range selected[1:] {
+		if v.variant.Bitrate > best.variant.Bitrate {
+			best = v
+		}
+	}
+
+	reEncode := req.Exact && !best.selection.Aligned()
+	duration := best.selection.Covered
+	if req.Exact {
+		duration = best.selection.Duration
+	}
+
+	title := req.Title
+	if title == "" {
+		title = fmt.Sprintf("%s clip", stream.Title)
+	}
+
+	video := &models.Video{
+		ID:        clipID,
+		Filename:  fmt.Sprintf("clip_%s.mp4", clipID),
+		Duration:  duration,
+		Width:     best.variant.Width,
+		Height:    best.variant.Height,
+		Codec:     best.variant.Codec,
+		Bitrate:   best.variant.Bitrate,
+		FrameRate: best.variant.FrameRate,
+		Status:    models.VideoStatusProcessing,
+		Metadata: models.Metadata{
+			"source":         "live_clip",
+			"title":          title,
+			"live_stream_id": stream.ID,
+			"clip_start":     req.Start,
+			"clip_end":       req.End,
+		},
+	}
+	if stream.UserID != "" {
+		video.UserID = &stream.UserID
+	}
+	if !best.selection.StartTime.IsZero() {
+		video.Metadata["clip_start_time"] = best.selection.StartTime
+	}
+
+	if err := s.repo.CreateVideo(ctx, video); err != nil {
+		s.deleteSources(sourcePrefix)
+		return nil, nil, fmt.Errorf("failed to create video: %w", err)
+	}
+
+	params := &models.LiveClipParams{
+		LiveStreamID: stream.ID,
+		StartTime:    best.selection.StartTime,
+	}
+	for _, v := range selected {
+		clipVariant := models.LiveClipVariant{
+			Resolution: v.variant.Resolution,
+			Bitrate:    v.variant.Bitrate,
+			Playlist:   v.selection.Playlist,
+			Segments:   v.selection.Segments,
+		}
+		if req.Exact && !v.selection.Aligned() {
+			clipVariant.ReEncode = true
+			clipVariant.Offset = v.selection.Offset
+			clipVariant.Duration = v.selection.Duration
+		}
+		params.Variants = append(params.Variants, clipVariant)
+	}
+
+	codec := "copy"
+	if reEncode {
+		codec = "libx264"
+	}
+
+	job := &models.Job{
+		Type:     models.JobTypeLiveClip,
+		VideoID:  video.ID,
+		UserID:   video.UserID,
+		Status:   models.JobStatusPending,
+		Priority: models.JobPriorityNormal,
+		Config: models.TranscodeConfig{
+			OutputFormat: "mp4",
+			Codec:        codec,
+			Extra:        map[string]string{"source": "live_clip", "live_stream_id": stream.ID},
+			LiveClip:     params,
+		},
+	}
+	job.PrepareRouting(video)
+
+	clip := &models.LiveStreamClip{
+		LiveStreamID: stream.ID,
+		Video:        video,
+		StartTime:    best.selection.StartTime,
+		Duration:     duration,
+	}
+
+	log.Printf("Creating clip %s from stream %s (%.1fs to %.1fs behind live)", clipID, stream.ID, req.Start, req.End)
+	return clip, job, nil
+}
+
+// readPlaylist reads a live playlist from storage
+func (s *ClipService) readPlaylist(ctx context.Context, key string) (string, error) {
+	reader, err := s.storage.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// deleteSources removes the segments copied for a clip that was not created
+func (s *ClipService) deleteSources(prefix string) {
+	if _, err := storage.DeletePrefix(context.Background(), s.storage, prefix); err != nil {
+		log.Printf("Failed to delete clip sources %s: %v", prefix, err)
+	}
+}
+
+// snapshotSegments copies the selected segments under prefix in storage and
+// points the selection playlist at the copies by file name, which is how the
+// worker assembling the clip lays them out
+func snapshotSegments(ctx context.Context, store storage.Blobstore, selection *ClipSelection, prefix string) error {
+	copies := make(map[string]string, len(selection.Segments))
+	for i, src := range selection.Segments {
+		name := fmt.Sprintf("%03d_%s", i, path.Base(src))
+		if err := store.Copy(ctx, src, path.Join(prefix, name)); err != nil {
+			return err
+		}
+		copies[src] = name
+		selection.Segments[i] = path.Join(prefix, name)
+	}
+
+	lines := strings.Split(selection.Playlist, "\n")
+	for i, line := range lines {
+		if name, ok := copies[line]; ok {
+			lines[i] = name
+		} else if uri := mapURI(line); strings.HasPrefix(line, "#EXT-X-MAP:") && copies[uri] != "" {
+			lines[i] = fmt.Sprintf("#EXT-X-MAP:URI=\"%s\"", copies[uri])
+		}
+	}
+	selection.Playlist = strings.Join(lines, "\n")
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package livestream
+
+import (
+	"context"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+)
+
+const livePlaylist = `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:40
+#EXT-X-PROGRAM-DATE-TIME:2025-01-01T12:00:00.000+0000
+#EXTINF:6.000000,
+720p_040.ts
+#EXT-X-PROGRAM-DATE-TIME:2025-01-01T12:00:06.000+0000
+#EXTINF:6.000000,
+720p_041.ts
+#EXT-X-PROGRAM-DATE-TIME:2025-01-01T12:00:12.000+0000
+#EXTINF:6.000000,
+720p_042.ts
+#EXT-X-PROGRAM-DATE-TIME:2025-01-01T12:00:18.000+0000
+#EXTINF:6.000000,
+720p_043.ts
+`
+
+func TestSelectClipSegments(t *testing.T) {
+	t.Run("aligned range", func(t *testing.T) {
+		selection, err := SelectClipSegments(livePlaylist, "/live/stream-1", 12, 0)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"/live/stream-1/720p_042.ts", "/live/stream-1/720p_043.ts"}, selection.Segments)
+		assert.Equal(t, 12.0, selection.Duration)
+		assert.Equal(t, 12.0, selection.Covered)
+		assert.True(t, selection.Aligned())
+		assert.Equal(t, time.Date(2025, 1, 1, 12, 0, 12, 0, time.UTC), selection.StartTime.UTC())
+		assert.True(t, strings.HasSuffix(selection.Playlist, "#EXT-X-ENDLIST\n"))
+		assert.Contains(t, selection.Playlist, "#EXT-X-PLAYLIST-TYPE:VOD")
+	})
+
+	t.Run("unaligned range snaps to segments", func(t *testing.T) {
+		selection, err := SelectClipSegments(livePlaylist, "/live/stream-1", 16, 8)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"/live/stream-1/720p_041.ts", "/live/stream-1/720p_042.ts"}, selection.Segments)
+		assert.InDelta(t, 2.0, selection.Offset, 0.001)
+		assert.InDelta(t, 8.0, selection.Duration, 0.001)
+		assert.False(t, selection.Aligned())
+		assert.Equal(t, time.Date(2025, 1, 1, 12, 0, 8, 0, time.UTC), selection.StartTime.UTC())
+	})
+
+	t.Run("outside window", func(t *testing.T) {
+		_, err := SelectClipSegments(livePlaylist, "/live/stream-1", 60, 0)
+		assert.ErrorIs(t, err, ErrClipOutOfRange)
+	})
+
+	t.Run("invalid range", func(t *testing.T) {
+		_, err := SelectClipSegments(livePlaylist, "/live/stream-1", 5, 10)
+		assert.Error(t, err)
+	})
+}
+
+func TestSelectClipSegments_FMP4(t *testing.T) {
+	playlist := `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:2
+#EXT-X-MAP:URI="init_0.mp4"
+#EXTINF:2.000000,
+720p_000.m4s
+#EXTINF:2.000000,
+720p_001.m4s
+`
+
+	selection, err := SelectClipSegments(playlist, "/live/stream-1", 2, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"/live/stream-1/init_0.mp4", "/live/stream-1/720p_001.m4s"}, selection.Segments)
+	assert.Contains(t, selection.Playlist, "#EXT-X-MAP:URI=\"/live/stream-1/init_0.mp4\"")
+	assert.True(t, selection.StartTime.IsZero())
+}
+
+func TestSnapshotSegments(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	for _, name := range []string{"720p_042.ts", "720p_043.ts"} {
+		require.NoError(t, store.Put(ctx, LiveStorageKey("stream-1", name), strings.NewReader(name), int64(len(name)), "video/mp2t"))
+	}
+
+	selection, err := SelectClipSegments(livePlaylist, LiveStorageKey("stream-1", ""), 12, 0)
+	require.NoError(t, err)
+	require.NoError(t, snapshotSegments(ctx, store, selection, "videos/clip-1/clip_sources/720p"))
+
+	// The copies survive the live playlist deleting its segments
+	require.NoError(t, store.Delete(ctx, LiveStorageKey("stream-1", "720p_042.ts")))
+
+	assert.Equal(t, []string{"videos/clip-1/clip_sources/720p/000_720p_042.ts", "videos/clip-1/clip_sources/720p/001_720p_043.ts"}, selection.Segments)
+	for _, key := range selection.Segments {
+		_, err := store.Stat(ctx, key)
+		assert.NoError(t, err)
+		assert.Contains(t, selection.Playlist, "\n"+path.Base(key)+"\n")
+	}
+	assert.NotContains(t, selection.Playlist, "live/")
+}
@@ -0,0 +1,86 @@
+package livestream
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/therealutkarshpriyadarshi/transcode/internal/scte35"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// packageInterval is how often FFmpeg's chunk playlists are polled
+const packageInterval = 250 * time.Millisecond
+
+// cueRefreshInterval is how often the ad cues of a live stream are reloaded
+const cueRefreshInterval = time.Second
+
+// runPackager packages the chunks FFmpeg writes into the served segments and
+// playlists of a live stream, split and tagged at its ad cues
+func (t *Transcoder) runPackager(ctx context.Context, opts TranscodeOptions) {
+	settings := opts.Settings
+	segmentDuration := settings.SegmentDuration
+	if segmentDuration == 0 {
+		segmentDuration = 6
+	}
+	windowSize := settings.PlaylistLength
+	if windowSize == 0 {
+		windowSize = 10
+	}
+	// DVR keeps segments for the DVR window
+	if opts.DVREnabled {
+		windowSize = opts.DVRWindow / segmentDuration
+	}
+
+	var variants []string
+	for _, variant := range t.getVariantConfigs(settings) {
+		variants = append(variants, variant.Resolution)
+	}
+
+	p := newPackager(opts.OutputDir, variants, time.Duration(segmentDuration)*time.Second, windowSize, opts.Resume, time.Now())
+	if t.storage != nil {
+		p.publishTo(t.storage, LiveStorageKey(opts.LiveStreamID, ""))
+	}
+	window := time.Duration(segmentDuration*windowSize) * time.Second
+
+	ticker := time.NewTicker(packageInterval)
+	defer ticker.Stop()
+
+	var cuesLoaded time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			// The open segment is dropped: a node taking over the stream
+			// packages its chunks again
+			return
+		case <-ticker.C:
+			if time.Since(cuesLoaded) >= cueRefreshInterval {
+				// Cues that ended before the window can no longer be seen
+				cues, err := t.repo.ListLiveStreamCues(ctx, opts.LiveStreamID, time.Now().Add(-window))
+				if err != nil {
+					log.Printf("Failed to list cues for stream %s: %v", opts.LiveStreamID, err)
+				} else {
+					p.setCues(toSpliceCues(cues))
+					cuesLoaded = time.Now()
+				}
+			}
+
+			if err := p.step(ctx); err != nil {
+				log.Printf("Failed to package stream %s: %v", opts.LiveStreamID, err)
+			}
+		}
+	}
+}
+
+// toSpliceCues converts stored live stream cues for playlist tagging
+func toSpliceCues(cues []*models.LiveStreamCue) []scte35.Cue {
+	spliceCues := make([]scte35.Cue, 0, len(cues))
+	for _, cue := range cues {
+		spliceCues = append(spliceCues, scte35.Cue{
+			EventID:  uint32(cue.EventID),
+			Start:    cue.StartTime,
+			Duration: time.Duration(cue.Duration * float64(time.Second)),
+		})
+	}
+	return spliceCues
+}
@@ -18,12 +18,12 @@ import (
 type DVRService struct {
 	ffmpegPath string
 	repo       *database.Repository
-	storage    *storage.Storage
+	storage    storage.Blobstore
 	outputDir  string
 }
 
 // NewDVRService creates a new DVR service
-func NewDVRService(ffmpegPath string, repo *database.Repository, storage *storage.Storage, outputDir string) *DVRService {
+func NewDVRService(ffmpegPath string, repo *database.Repository, storage storage.Blobstore, outputDir string) *DVRService {
 	return &DVRService{
 		ffmpegPath: ffmpegPath,
 		repo:       repo,
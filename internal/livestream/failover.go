@@ -0,0 +1,268 @@
+package livestream
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// healthCheckInterval is how often a running transcode is checked against the thresholds
+const healthCheckInterval = 5 * time.Second
+
+// Supervisor signals sent when the publisher disconnects or reconnects
+const (
+	signalIngestDropped     = "dropped"
+	signalIngestReconnected = "reconnected"
+)
+
+// ingestSupervisor keeps a live transcode running and fails over between the
+// primary ingest, the backup ingest and a slate when inputs drop
+type ingestSupervisor struct {
+	t       *Transcoder
+	opts    TranscodeOptions
+	monitor *HealthMonitor
+	signals chan string
+}
+
+// run drives the transcode until the context is cancelled
+func (s *ingestSupervisor) run(ctx context.Context) {
+	source := models.IngestSourcePrimary
+	resume := s.opts.Resume
+
+	for ctx.Err() == nil {
+		next := s.runSource(ctx, source, resume)
+		if ctx.Err() != nil {
+			return
+		}
+		resume = true
+
+		if next == "" {
+			// The current source dropped
+			if source != models.IngestSourceSlate {
+				s.t.logEvent(ctx, s.opts.LiveStreamID, models.LiveStreamEventConnectionLost, models.SeverityError,
+					fmt.Sprintf("Lost %s ingest", source), models.Metadata{"source": source})
+			}
+			next = s.selectSource(ctx, source)
+		}
+
+		s.switchSource(ctx, source, next)
+		source = next
+
+		if s.opts.OnSourceChange != nil {
+			s.opts.OnSourceChange(source)
+		}
+	}
+}
+
+// runSource runs FFmpeg on a single source. It returns the source to switch to
+// when a preferred ingest comes back, or an empty string when the source dropped.
+func (s *ingestSupervisor) runSource(ctx context.Context, source string, resume bool) string {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := s.t.buildFFmpegCommand(runCtx, s.opts, source, resume)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		log.Printf("Failed to get stdout pipe for stream %s: %v", s.opts.LiveStreamID, err)
+		return ""
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		log.Printf("Failed to get stderr pipe for stream %s: %v", s.opts.LiveStreamID, err)
+		return ""
+	}
+
+	s.monitor.ResetSource(source, time.Now())
+
+	if err := cmd.Start(); err != nil {
+		log.Printf("Failed to start FFmpeg on %s ingest for stream %s: %v", source, s.opts.LiveStreamID, err)
+		return ""
+	}
+
+	go s.readProgress(stdout)
+	go s.t.monitorFFmpegOutput(runCtx, s.opts.LiveStreamID, stderr, s.monitor)
+	if url := s.sourceURL(source); url != "" {
+		go s.probePackets(runCtx, url)
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+	lastProbe := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			<-exited
+			return ""
+		case err := <-exited:
+			log.Printf("FFmpeg exited on %s ingest for stream %s: %v", source, s.opts.LiveStreamID, err)
+			return ""
+		case sig := <-s.signals:
+			switch {
+			case sig == signalIngestDropped && source == models.IngestSourcePrimary:
+				cancel()
+				<-exited
+				return ""
+			case sig == signalIngestReconnected && source != models.IngestSourcePrimary:
+				lastProbe = time.Now()
+				if s.t.probeInput(ctx, s.opts.InputURL) {
+					cancel()
+					<-exited
+					return models.IngestSourcePrimary
+				}
+			}
+		case now := <-ticker.C:
+			if s.monitor.Stalled(now) {
+				log.Printf("FFmpeg stalled on %s ingest for stream %s", source, s.opts.LiveStreamID)
+				cancel()
+				<-exited
+				return ""
+			}
+
+			for _, event := range s.monitor.Evaluate(now) {
+				s.t.createEvent(ctx, event)
+			}
+
+			// While not on the primary, keep checking whether a better ingest is back
+			if source != models.IngestSourcePrimary && now.Sub(lastProbe) >= s.monitor.thresholds.ProbeInterval {
+				lastProbe = now
+				if better := s.preferredSource(ctx, source); better != "" {
+					cancel()
+					<-exited
+					return better
+				}
+			}
+		}
+	}
+}
+
+// selectSource picks the next source after the failed one dropped, falling back to the slate
+func (s *ingestSupervisor) selectSource(ctx context.Context, failed string) string {
+	for _, source := range []string{models.IngestSourcePrimary, models.IngestSourceBackup} {
+		if source == failed {
+			continue
+		}
+		if url := s.sourceURL(source); url != "" && s.t.probeInput(ctx, url) {
+			return source
+		}
+	}
+	return models.IngestSourceSlate
+}
+
+// preferredSource returns an available ingest ranked above current, if any
+func (s *ingestSupervisor) preferredSource(ctx context.Context, current string) string {
+	candidates := []string{models.IngestSourcePrimary}
+	if current == models.IngestSourceSlate {
+		candidates = append(candidates, models.IngestSourceBackup)
+	}
+
+	for _, source := range candidates {
+		if url := s.sourceURL(source); url != "" && s.t.probeInput(ctx, url) {
+			return source
+		}
+	}
+	return ""
+}
+
+// switchSource logs the transition between two ingest sources
+func (s *ingestSupervisor) switchSource(ctx context.Context, from, to string) {
+	log.Printf("Stream %s switching ingest from %s to %s", s.opts.LiveStreamID, from, to)
+
+	severity := models.SeverityWarning
+	message := fmt.Sprintf("Switched ingest from %s to %s", from, to)
+	switch to {
+	case models.IngestSourcePrimary:
+		severity = models.SeverityInfo
+	case models.IngestSourceSlate:
+		severity = models.SeverityCritical
+		message = "All ingests lost, slate inserted"
+	}
+
+	s.t.logEvent(ctx, s.opts.LiveStreamID, models.LiveStreamEventIngestSwitched, severity, message,
+		models.Metadata{"from": from, "to": to})
+
+	if from == models.IngestSourceSlate || to == models.IngestSourcePrimary {
+		s.t.logEvent(ctx, s.opts.LiveStreamID, models.LiveStreamEventConnectionRestored, models.SeverityInfo,
+			fmt.Sprintf("Ingest restored on %s", to), models.Metadata{"source": to})
+	}
+}
+
+// sourceURL returns the ingest URL for a source, or an empty string for the slate
+func (s *ingestSupervisor) sourceURL(source string) string {
+	switch source {
+	case models.IngestSourcePrimary:
+		return s.opts.InputURL
+	case models.IngestSourceBackup:
+		return s.opts.Settings.BackupIngestURL
+	default:
+		return ""
+	}
+}
+
+// readProgress feeds FFmpeg -progress output into the health monitor
+func (s *ingestSupervisor) readProgress(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		s.monitor.ObserveProgress(scanner.Text(), time.Now())
+	}
+}
+
+// probePackets reads packet timing from the ingest to measure keyframe
+// interval, A/V sync and ingest bitrate
+func (s *ingestSupervisor) probePackets(ctx context.Context, url string) {
+	cmd := exec.CommandContext(ctx, s.t.ffprobePath,
+		"-v", "error",
+		"-show_entries", "packet=codec_type,pts_time,size,flags",
+		"-of", "csv=p=0",
+		url,
+	)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		log.Printf("Failed to get probe pipe for stream %s: %v", s.opts.LiveStreamID, err)
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		log.Printf("Failed to start ingest probe for stream %s: %v", s.opts.LiveStreamID, err)
+		return
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if pkt, ok := ParsePacketLine(scanner.Text()); ok {
+			s.monitor.ObservePacket(pkt)
+		}
+	}
+	cmd.Wait()
+}
+
+// probeInput checks whether an ingest URL is currently publishing
+func (t *Transcoder) probeInput(ctx context.Context, url string) bool {
+	probeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	output, err := exec.CommandContext(probeCtx, t.ffprobePath,
+		"-v", "error",
+		"-show_entries", "stream=codec_type",
+		"-of", "csv=p=0",
+		url,
+	).Output()
+	if err != nil {
+		return false
+	}
+
+	return strings.Contains(string(output), "video")
+}
@@ -0,0 +1,360 @@
+package livestream
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// HealthThresholds controls when ingest health events are raised
+type HealthThresholds struct {
+	StallTimeout     time.Duration // no progress for this long means the input is gone
+	MaxDroppedFrames int64         // dropped frames per evaluation before a frame_drop event
+	MaxLatency       time.Duration // how far encoding may fall behind real time
+	MinSpeed         float64       // encoding speed below this counts as high latency
+	MaxAVDrift       float64       // in ms
+	ProbeInterval    time.Duration // how often lost ingests are re-probed
+}
+
+// DefaultHealthThresholds returns the default ingest health thresholds
+func DefaultHealthThresholds() HealthThresholds {
+	return HealthThresholds{
+		StallTimeout:     10 * time.Second,
+		MaxDroppedFrames: 30,
+		MaxLatency:       5 * time.Second,
+		MinSpeed:         0.9,
+		MaxAVDrift:       200,
+		ProbeInterval:    5 * time.Second,
+	}
+}
+
+// IngestStats holds the latest statistics collected for a live ingest
+type IngestStats struct {
+	Source           string        `json:"source"`
+	Frame            int64         `json:"frame"`
+	FPS              float64       `json:"fps"`
+	IngestBitrate    int64         `json:"ingest_bitrate"` // in bps
+	DroppedFrames    int64         `json:"dropped_frames"`
+	DuplicateFrames  int64         `json:"duplicate_frames"`
+	OutTime          time.Duration `json:"out_time"`
+	Speed            float64       `json:"speed"`
+	KeyframeInterval float64       `json:"keyframe_interval"` // in seconds
+	AudioVideoSync   float64       `json:"audio_video_sync"`  // in ms, positive when video leads
+	Errors           int           `json:"errors"`
+	UpdatedAt        time.Time     `json:"updated_at"`
+}
+
+// IngestPacket is a single packet reported by the ingest probe
+type IngestPacket struct {
+	CodecType string
+	PTS       float64 // in seconds
+	Size      int
+	Keyframe  bool
+}
+
+// ParseProgressLine applies a key=value line from FFmpeg's -progress output to stats.
+// It returns true when the line closes a progress block.
+func ParseProgressLine(stats *IngestStats, line string) bool {
+	key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+	if !ok {
+		return false
+	}
+	value = strings.TrimSpace(value)
+
+	switch key {
+	case "frame":
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			stats.Frame = v
+		}
+	case "fps":
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			stats.FPS = v
+		}
+	case "drop_frames":
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			stats.DroppedFrames = v
+		}
+	case "dup_frames":
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			stats.DuplicateFrames = v
+		}
+	case "out_time_us", "out_time_ms": // FFmpeg reports both in microseconds
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			stats.OutTime = time.Duration(v) * time.Microsecond
+		}
+	case "speed":
+		if v, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64); err == nil {
+			stats.Speed = v
+		}
+	case "progress":
+		return true
+	}
+
+	return false
+}
+
+// ParsePacketLine parses a "codec_type,pts_time,size,flags" line from ffprobe -show_packets
+func ParsePacketLine(line string) (IngestPacket, bool) {
+	fields := strings.Split(strings.TrimSpace(line), ",")
+	if len(fields) < 4 {
+		return IngestPacket{}, false
+	}
+
+	pts, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return IngestPacket{}, false
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return IngestPacket{}, false
+	}
+
+	return IngestPacket{
+		CodecType: fields[0],
+		PTS:       pts,
+		Size:      size,
+		Keyframe:  strings.HasPrefix(fields[3], "K"),
+	}, true
+}
+
+// HealthMonitor tracks ingest health for a single live stream
+type HealthMonitor struct {
+	mu         sync.Mutex
+	streamID   string
+	thresholds HealthThresholds
+	stats      IngestStats
+
+	sourceStart  time.Time
+	lastProgress time.Time
+	lagBaseline  time.Duration
+	hasBaseline  bool
+
+	lastKeyframePTS float64
+	lastVideoPTS    float64
+	lastAudioPTS    float64
+	windowStartPTS  float64
+	windowBytes     int64
+
+	evaluatedDrops int64
+	reportedDrops  int64
+	reportedErrors int
+	latencyAlerted bool
+	driftAlerted   bool
+}
+
+// NewHealthMonitor creates a new health monitor for a live stream
+func NewHealthMonitor(streamID string, thresholds HealthThresholds) *HealthMonitor {
+	return &HealthMonitor{
+		streamID:        streamID,
+		thresholds:      thresholds,
+		lastKeyframePTS: -1,
+		windowStartPTS:  -1,
+	}
+}
+
+// ResetSource records that the transcode restarted on a new ingest source.
+// FFmpeg counters start from zero again, so all baselines are reset.
+func (m *HealthMonitor) ResetSource(source string, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	errors := m.stats.Errors
+	m.stats = IngestStats{Source: source, Errors: errors, UpdatedAt: now}
+	m.sourceStart = now
+	m.lastProgress = now
+	m.hasBaseline = false
+	m.lastKeyframePTS = -1
+	m.lastVideoPTS = 0
+	m.lastAudioPTS = 0
+	m.windowStartPTS = -1
+	m.windowBytes = 0
+	m.evaluatedDrops = 0
+	m.reportedDrops = 0
+	m.latencyAlerted = false
+	m.driftAlerted = false
+}
+
+// ObserveProgress applies a line of FFmpeg -progress output
+func (m *HealthMonitor) ObserveProgress(line string, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !ParseProgressLine(&m.stats, line) {
+		return
+	}
+
+	m.lastProgress = now
+	m.stats.UpdatedAt = now
+	if !m.hasBaseline && m.stats.OutTime > 0 {
+		m.lagBaseline = now.Sub(m.sourceStart) - m.stats.OutTime
+		m.hasBaseline = true
+	}
+}
+
+// ObservePacket applies a packet reported by the ingest probe
+func (m *HealthMonitor) ObservePacket(pkt IngestPacket) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch pkt.CodecType {
+	case "video":
+		m.lastVideoPTS = pkt.PTS
+		if pkt.Keyframe {
+			if m.lastKeyframePTS >= 0 && pkt.PTS > m.lastKeyframePTS {
+				m.stats.KeyframeInterval = pkt.PTS - m.lastKeyframePTS
+			}
+			m.lastKeyframePTS = pkt.PTS
+		}
+	case "audio":
+		m.lastAudioPTS = pkt.PTS
+	default:
+		return
+	}
+
+	if m.lastVideoPTS > 0 && m.lastAudioPTS > 0 {
+		m.stats.AudioVideoSync = (m.lastVideoPTS - m.lastAudioPTS) * 1000
+	}
+
+	// Ingest bitrate is measured over roughly one second of media time
+	if m.windowStartPTS < 0 || pkt.PTS < m.windowStartPTS {
+		m.windowStartPTS = pkt.PTS
+		m.windowBytes = 0
+	}
+	m.windowBytes += int64(pkt.Size)
+	if span := pkt.PTS - m.windowStartPTS; span >= 1 {
+		m.stats.IngestBitrate = int64(float64(m.windowBytes*8) / span)
+		m.windowStartPTS = pkt.PTS
+		m.windowBytes = 0
+	}
+}
+
+// ObserveError records an error reported by FFmpeg
+func (m *HealthMonitor) ObserveError() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats.Errors++
+}
+
+// Stalled reports whether FFmpeg has stopped making progress on the current source
+func (m *HealthMonitor) Stalled(now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return now.Sub(m.lastProgress) > m.thresholds.StallTimeout
+}
+
+// Latency returns how far encoding has fallen behind real time since the source started
+func (m *HealthMonitor) Latency(now time.Time) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.latency(now)
+}
+
+func (m *HealthMonitor) latency(now time.Time) time.Duration {
+	if !m.hasBaseline {
+		return 0
+	}
+	lag := now.Sub(m.sourceStart) - m.stats.OutTime - m.lagBaseline
+	if lag < 0 {
+		return 0
+	}
+	return lag
+}
+
+// Snapshot returns a copy of the current ingest statistics
+func (m *HealthMonitor) Snapshot() IngestStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+// Evaluate compares the current statistics against the thresholds and returns
+// the events that should be logged. Latency and A/V drift only fire once until
+// they recover.
+func (m *HealthMonitor) Evaluate(now time.Time) []*models.LiveStreamEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []*models.LiveStreamEvent
+
+	if drops := m.stats.DroppedFrames - m.evaluatedDrops; drops > m.thresholds.MaxDroppedFrames {
+		events = append(events, m.event(now, models.LiveStreamEventFrameDrop, models.SeverityWarning,
+			fmt.Sprintf("Dropped %d frames", drops),
+			models.Metadata{"dropped_frames": drops, "source": m.stats.Source}))
+	}
+	m.evaluatedDrops = m.stats.DroppedFrames
+
+	latency := m.latency(now)
+	slow := m.stats.Speed > 0 && m.stats.Speed < m.thresholds.MinSpeed
+	if latency > m.thresholds.MaxLatency || slow {
+		if !m.latencyAlerted {
+			events = append(events, m.event(now, models.LiveStreamEventHighLatency, models.SeverityWarning,
+				fmt.Sprintf("Encoding is %s behind real time", latency.Round(time.Millisecond)),
+				models.Metadata{"latency_ms": latency.Milliseconds(), "speed": m.stats.Speed, "source": m.stats.Source}))
+			m.latencyAlerted = true
+		}
+	} else {
+		m.latencyAlerted = false
+	}
+
+	if math.Abs(m.stats.AudioVideoSync) > m.thresholds.MaxAVDrift {
+		if !m.driftAlerted {
+			events = append(events, m.event(now, models.LiveStreamEventAVDesync, models.SeverityWarning,
+				fmt.Sprintf("Audio/video drift of %.0fms", m.stats.AudioVideoSync),
+				models.Metadata{"audio_video_sync_ms": m.stats.AudioVideoSync, "source": m.stats.Source}))
+			m.driftAlerted = true
+		}
+	} else {
+		m.driftAlerted = false
+	}
+
+	return events
+}
+
+// Analytics builds an analytics sample from the current statistics.
+// Dropped frames and errors are counted since the previous sample.
+func (m *HealthMonitor) Analytics(now time.Time) *models.LiveStreamAnalytics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	drops := m.stats.DroppedFrames - m.reportedDrops
+	if drops < 0 {
+		drops = m.stats.DroppedFrames
+	}
+	m.reportedDrops = m.stats.DroppedFrames
+
+	errors := m.stats.Errors - m.reportedErrors
+	m.reportedErrors = m.stats.Errors
+
+	bufferHealth := 100.0
+	if m.stats.Speed > 0 && m.stats.Speed < 1 {
+		bufferHealth = m.stats.Speed * 100
+	}
+
+	return &models.LiveStreamAnalytics{
+		LiveStreamID:     m.streamID,
+		Timestamp:        now,
+		IngestBitrate:    m.stats.IngestBitrate,
+		DroppedFrames:    int(drops),
+		KeyframeInterval: m.stats.KeyframeInterval,
+		AudioVideoSync:   m.stats.AudioVideoSync,
+		BufferHealth:     bufferHealth,
+		AverageLatency:   float64(m.latency(now).Milliseconds()),
+		ErrorCount:       errors,
+	}
+}
+
+func (m *HealthMonitor) event(now time.Time, eventType, severity, message string, details models.Metadata) *models.LiveStreamEvent {
+	return &models.LiveStreamEvent{
+		LiveStreamID: m.streamID,
+		EventType:    eventType,
+		Severity:     severity,
+		Message:      message,
+		Details:      details,
+		Timestamp:    now,
+	}
+}
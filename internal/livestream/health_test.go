@@ -0,0 +1,140 @@
+package livestream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+func TestParseProgressLine(t *testing.T) {
+	var stats IngestStats
+
+	lines := []string{
+		"frame=1500",
+		"fps=30.00",
+		"bitrate=2500.1kbits/s",
+		"out_time_us=50000000",
+		"dup_frames=2",
+		"drop_frames=12",
+		"speed=0.98x",
+	}
+	for _, line := range lines {
+		assert.False(t, ParseProgressLine(&stats, line), line)
+	}
+	assert.True(t, ParseProgressLine(&stats, "progress=continue"))
+
+	assert.Equal(t, int64(1500), stats.Frame)
+	assert.Equal(t, 30.0, stats.FPS)
+	assert.Equal(t, 50*time.Second, stats.OutTime)
+	assert.Equal(t, int64(2), stats.DuplicateFrames)
+	assert.Equal(t, int64(12), stats.DroppedFrames)
+	assert.Equal(t, 0.98, stats.Speed)
+
+	// N/A values leave the previous reading in place
+	ParseProgressLine(&stats, "speed=N/A")
+	assert.Equal(t, 0.98, stats.Speed)
+}
+
+func TestParsePacketLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected IngestPacket
+		ok       bool
+	}{
+		{"video,12.033000,45210,K_", IngestPacket{CodecType: "video", PTS: 12.033, Size: 45210, Keyframe: true}, true},
+		{"audio,12.010000,372,K_", IngestPacket{CodecType: "audio", PTS: 12.01, Size: 372, Keyframe: true}, true},
+		{"video,12.066000,8123,__", IngestPacket{CodecType: "video", PTS: 12.066, Size: 8123}, true},
+		{"video,N/A,8123,__", IngestPacket{}, false},
+		{"garbage", IngestPacket{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			pkt, ok := ParsePacketLine(tt.line)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, pkt)
+		})
+	}
+}
+
+func TestHealthMonitor_Packets(t *testing.T) {
+	monitor := NewHealthMonitor("stream-1", DefaultHealthThresholds())
+	monitor.ResetSource(models.IngestSourcePrimary, time.Now())
+
+	// 2 seconds of 30fps video with a keyframe every second, 1000 bytes per frame
+	for i := 0; i <= 60; i++ {
+		pts := float64(i) / 30
+		monitor.ObservePacket(IngestPacket{CodecType: "video", PTS: pts, Size: 1000, Keyframe: i%30 == 0})
+	}
+	monitor.ObservePacket(IngestPacket{CodecType: "audio", PTS: 1.9, Size: 0})
+
+	stats := monitor.Snapshot()
+	assert.InDelta(t, 1.0, stats.KeyframeInterval, 0.001)
+	assert.InDelta(t, 100.0, stats.AudioVideoSync, 0.001)
+	assert.InDelta(t, 240000, stats.IngestBitrate, 10000)
+}
+
+func TestHealthMonitor_Evaluate(t *testing.T) {
+	thresholds := DefaultHealthThresholds()
+	monitor := NewHealthMonitor("stream-1", thresholds)
+	start := time.Now()
+	monitor.ResetSource(models.IngestSourcePrimary, start)
+
+	// Healthy stream
+	monitor.ObserveProgress("out_time_us=1000000", start.Add(time.Second))
+	monitor.ObserveProgress("speed=1.0x", start.Add(time.Second))
+	monitor.ObserveProgress("progress=continue", start.Add(time.Second))
+	assert.Empty(t, monitor.Evaluate(start.Add(time.Second)))
+
+	// Dropped frames and slow encoding
+	monitor.ObserveProgress("drop_frames=45", start.Add(2*time.Second))
+	monitor.ObserveProgress("speed=0.5x", start.Add(2*time.Second))
+	monitor.ObserveProgress("progress=continue", start.Add(2*time.Second))
+
+	events := monitor.Evaluate(start.Add(2 * time.Second))
+	require.Len(t, events, 2)
+	assert.Equal(t, models.LiveStreamEventFrameDrop, events[0].EventType)
+	assert.Equal(t, models.LiveStreamEventHighLatency, events[1].EventType)
+	assert.Equal(t, "stream-1", events[0].LiveStreamID)
+
+	// Latency only fires once until it recovers, drops are counted per evaluation
+	assert.Empty(t, monitor.Evaluate(start.Add(3*time.Second)))
+}
+
+func TestHealthMonitor_Stalled(t *testing.T) {
+	thresholds := DefaultHealthThresholds()
+	monitor := NewHealthMonitor("stream-1", thresholds)
+	start := time.Now()
+	monitor.ResetSource(models.IngestSourceBackup, start)
+
+	assert.False(t, monitor.Stalled(start.Add(thresholds.StallTimeout/2)))
+	assert.True(t, monitor.Stalled(start.Add(thresholds.StallTimeout+time.Second)))
+
+	monitor.ObserveProgress("progress=continue", start.Add(thresholds.StallTimeout))
+	assert.False(t, monitor.Stalled(start.Add(thresholds.StallTimeout+time.Second)))
+}
+
+func TestHealthMonitor_Analytics(t *testing.T) {
+	monitor := NewHealthMonitor("stream-1", DefaultHealthThresholds())
+	now := time.Now()
+	monitor.ResetSource(models.IngestSourcePrimary, now)
+
+	monitor.ObserveProgress("drop_frames=10", now)
+	monitor.ObserveProgress("progress=continue", now)
+	monitor.ObserveError()
+
+	analytics := monitor.Analytics(now)
+	assert.Equal(t, "stream-1", analytics.LiveStreamID)
+	assert.Equal(t, 10, analytics.DroppedFrames)
+	assert.Equal(t, 1, analytics.ErrorCount)
+
+	// Counters are reported as deltas between samples
+	monitor.ObserveProgress("drop_frames=15", now)
+	monitor.ObserveProgress("progress=continue", now)
+	analytics = monitor.Analytics(now)
+	assert.Equal(t, 5, analytics.DroppedFrames)
+	assert.Equal(t, 0, analytics.ErrorCount)
+}
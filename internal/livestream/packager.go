@@ -0,0 +1,436 @@
+package livestream
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/therealutkarshpriyadarshi/transcode/internal/scte35"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+)
+
+// FFmpeg writes short keyframe-aligned chunks to playlists of its own, and the
+// packager joins them into the served segments and playlists. FFmpeg cannot
+// cut a segment early or be told of a new keyframe at runtime, so this is what
+// lets segments end at ad break boundaries; the splice lands on the first
+// chunk boundary at or after the requested time.
+const (
+	rawPlaylistSuffix = "_chunks.m3u8"
+	rawMasterPlaylist = "master_chunks.m3u8"
+	masterPlaylist    = "master.m3u8"
+)
+
+// LiveStorageKey returns the storage key a live stream's packaged segments
+// and media playlists are published under, so hosts other than the live
+// nodes, e.g. for clipping, can read the live window
+func LiveStorageKey(streamID, name string) string {
+	return path.Join("live", streamID, name)
+}
+
+// chunkTolerance absorbs rounding of chunk and segment times
+const chunkTolerance = 50 * time.Millisecond
+
+// mediaSegment is a chunk listed by FFmpeg or a segment served by the packager
+type mediaSegment struct {
+	URI           string
+	Start         time.Time
+	Duration      time.Duration
+	Discontinuity bool
+}
+
+// End returns the time the segment finishes
+func (s mediaSegment) End() time.Time {
+	return s.Start.Add(s.Duration)
+}
+
+// mediaPlaylist is the part of a media playlist the packager needs
+type mediaPlaylist struct {
+	MediaSequence         int
+	DiscontinuitySequence int
+	Map                   string
+	Segments              []mediaSegment
+}
+
+// parseMediaPlaylist reads the segments of a media playlist. Segments without
+// an EXT-X-PROGRAM-DATE-TIME follow on from the previous one.
+func parseMediaPlaylist(content string) mediaPlaylist {
+	var playlist mediaPlaylist
+	var next mediaSegment
+	var end time.Time
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			playlist.MediaSequence, _ = strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"))
+		case strings.HasPrefix(line, "#EXT-X-DISCONTINUITY-SEQUENCE:"):
+			playlist.DiscontinuitySequence, _ = strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-DISCONTINUITY-SEQUENCE:"))
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			playlist.Map = line
+		case line == "#EXT-X-DISCONTINUITY":
+			next.Discontinuity = true
+		case strings.HasPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:"):
+			if t, ok := scte35.ParseDateTime(strings.TrimPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:")); ok {
+				next.Start = t
+			}
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value := strings.TrimPrefix(line, "#EXTINF:")
+			if i := strings.Index(value, ","); i >= 0 {
+				value = value[:i]
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+				next.Duration = time.Duration(seconds * float64(time.Second))
+			}
+		case line != "" && !strings.HasPrefix(line, "#"):
+			next.URI = line
+			if next.Start.IsZero() {
+				next.Start = end
+			}
+			end = next.End()
+			playlist.Segments = append(playlist.Segments, next)
+			next = mediaSegment{}
+		}
+	}
+
+	return playlist
+}
+
+// packagedTrack is the packaging state of one variant
+type packagedTrack struct {
+	name                  string
+	mediaSequence         int
+	discontinuitySequence int
+	mapTag                string
+	segments              []mediaSegment
+	expired               []string
+
+	open                 *mediaSegment // segment being assembled from chunks
+	openSize             int64
+	lastEnd              time.Time // end of the last chunk packaged
+	pendingDiscontinuity bool      // the next segment follows a discontinuity
+	written              string    // last playlist written
+}
+
+// nextURI names the next segment, numbered by its media sequence
+func (tr *packagedTrack) nextURI(ext string) string {
+	return fmt.Sprintf("%s_%03d%s", tr.name, tr.mediaSequence+len(tr.segments), ext)
+}
+
+// packager assembles the served segments and playlists of a live stream
+type packager struct {
+	dir             string
+	store           storage.Blobstore // segments and media playlists are published to it when set
+	storePrefix     string
+	segmentDuration time.Duration
+	windowSize      int
+	cues            []scte35.Cue
+	tracks          []*packagedTrack
+	masterWritten   bool
+}
+
+// newPackager creates the packager for the variants of a live stream. A
+// resumed stream continues the playlists already served; otherwise chunks
+// listed before startedAt belong to an earlier run and are ignored.
+func newPackager(dir string, variants []string, segmentDuration time.Duration, windowSize int, resume bool, startedAt time.Time) *packager {
+	p := &packager{
+		dir:             dir,
+		segmentDuration: segmentDuration,
+		windowSize:      windowSize,
+	}
+
+	for _, name := range variants {
+		tr := &packagedTrack{name: name, lastEnd: startedAt.Add(-chunkTolerance)}
+		if resume {
+			if content, err := os.ReadFile(filepath.Join(dir, name+".m3u8")); err == nil {
+				served := parseMediaPlaylist(string(content))
+				tr.mediaSequence = served.MediaSequence
+				tr.discontinuitySequence = served.DiscontinuitySequence
+				tr.mapTag = served.Map
+				tr.segments = served.Segments
+				if n := len(served.Segments); n > 0 {
+					tr.lastEnd = served.Segments[n-1].End()
+				}
+				tr.written = string(content)
+			}
+		}
+		p.tracks = append(p.tracks, tr)
+	}
+
+	return p
+}
+
+// publishTo makes the packager publish closed segments and media playlists to
+// store under prefix, deleting segments there as they leave the window
+func (p *packager) publishTo(store storage.Blobstore, prefix string) {
+	p.store = store
+	p.storePrefix = prefix
+}
+
+// setCues replaces the ad breaks signalled in the playlists
+func (p *packager) setCues(cues []scte35.Cue) {
+	p.cues = cues
+}
+
+// step packages the chunks FFmpeg has listed since the last step and
+// rewrites the served playlists that changed
+func (p *packager) step(ctx context.Context) error {
+	for _, tr := range p.tracks {
+		content, err := os.ReadFile(filepath.Join(p.dir, tr.name+rawPlaylistSuffix))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read chunk playlist: %w", err)
+		}
+
+		raw := parseMediaPlaylist(string(content))
+		if raw.Map != "" {
+			tr.mapTag = raw.Map
+		}
+		for _, chunk := range raw.Segments {
+			if chunk.Start.Before(tr.lastEnd.Add(-chunkTolerance)) {
+				continue
+			}
+			if err := p.addChunk(ctx, tr, chunk); err != nil {
+				return err
+			}
+		}
+
+		if err := p.writePlaylist(ctx, tr); err != nil {
+			return err
+		}
+	}
+
+	return p.writeMaster()
+}
+
+// addChunk appends a chunk to the open segment of a track. The segment is
+// closed before the chunk at a discontinuity or ad break boundary, and after
+// it once it reaches the segment duration.
+func (p *packager) addChunk(ctx context.Context, tr *packagedTrack, chunk mediaSegment) error {
+	if tr.open != nil && (chunk.Discontinuity || p.boundaryBefore(tr.open.Start, chunk.Start)) {
+		if err := p.closeSegment(ctx, tr); err != nil {
+			return err
+		}
+	}
+	if chunk.Discontinuity {
+		tr.pendingDiscontinuity = true
+	}
+
+	data, err := os.ReadFile(filepath.Join(p.dir, chunk.URI))
+	if os.IsNotExist(err) {
+		// FFmpeg already deleted it; the gap is better than stalling
+		if tr.open != nil {
+			if err := p.closeSegment(ctx, tr); err != nil {
+				return err
+			}
+		}
+		tr.pendingDiscontinuity = true
+		tr.lastEnd = chunk.End()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read chunk %s: %w", chunk.URI, err)
+	}
+
+	if tr.open == nil {
+		tr.open = &mediaSegment{
+			URI:           tr.nextURI(path.Ext(chunk.URI)),
+			Start:         chunk.Start,
+			Discontinuity: tr.pendingDiscontinuity,
+		}
+		tr.openSize = 0
+		tr.pendingDiscontinuity = false
+	}
+
+	if err := appendPart(filepath.Join(p.dir, tr.open.URI+".part"), tr.openSize, data); err != nil {
+		return fmt.Errorf("failed to write segment %s: %w", tr.open.URI, err)
+	}
+	tr.openSize += int64(len(data))
+	tr.open.Duration = chunk.End().Sub(tr.open.Start)
+	tr.lastEnd = chunk.End()
+
+	if tr.open.Duration >= p.segmentDuration-chunkTolerance {
+		return p.closeSegment(ctx, tr)
+	}
+	return nil
+}
+
+// boundaryBefore reports whether an ad break starts or ends after a segment
+// starting at segmentStart began and by the time a chunk starting at
+// chunkStart begins
+func (p *packager) boundaryBefore(segmentStart, chunkStart time.Time) bool {
+	for _, cue := range p.cues {
+		for _, boundary := range []time.Time{cue.Start, cue.End()} {
+			if boundary.After(segmentStart.Add(chunkTolerance)) && !boundary.After(chunkStart.Add(chunkTolerance)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// closeSegment publishes the open segment of a track and drops the segments
+// that left the window. Their files are deleted one segment later, so players
+// holding the previous playlist can still fetch them.
+func (p *packager) closeSegment(ctx context.Context, tr *packagedTrack) error {
+	segment := tr.open
+	segmentPath := filepath.Join(p.dir, segment.URI)
+	if err := os.Rename(segmentPath+".part", segmentPath); err != nil {
+		return fmt.Errorf("failed to publish segment %s: %w", segment.URI, err)
+	}
+	tr.open = nil
+	tr.segments = append(tr.segments, *segment)
+
+	// The segment is stored before any stored playlist lists it. Playback
+	// does not depend on storage, so a failure only leaves a gap clips
+	// cannot cover.
+	if p.store != nil {
+		if err := storage.UploadFile(ctx, p.store, path.Join(p.storePrefix, segment.URI), segmentPath); err != nil {
+			log.Printf("Failed to store live segment %s: %v", segmentPath, err)
+		}
+	}
+
+	for _, uri := range tr.expired {
+		os.Remove(filepath.Join(p.dir, uri))
+		if p.store != nil {
+			p.store.Delete(ctx, path.Join(p.storePrefix, uri))
+		}
+	}
+	tr.expired = nil
+
+	for p.windowSize > 0 && len(tr.segments) > p.windowSize {
+		if tr.segments[0].Discontinuity {
+			tr.discontinuitySequence++
+		}
+		tr.expired = append(tr.expired, tr.segments[0].URI)
+		tr.segments = tr.segments[1:]
+		tr.mediaSequence++
+	}
+
+	return nil
+}
+
+// writePlaylist writes the served playlist of a track when it changed
+func (p *packager) writePlaylist(ctx context.Context, tr *packagedTrack) error {
+	if len(tr.segments) == 0 {
+		return nil
+	}
+
+	content := scte35.TagPlaylist(p.renderPlaylist(tr), p.cues, tr.segments[0].Start)
+	if content == tr.written {
+		return nil
+	}
+
+	if err := writeAtomic(filepath.Join(p.dir, tr.name+".m3u8"), content); err != nil {
+		return fmt.Errorf("failed to write playlist: %w", err)
+	}
+	if p.store != nil {
+		key := path.Join(p.storePrefix, tr.name+".m3u8")
+		if err := p.store.Put(ctx, key, strings.NewReader(content), int64(len(content)), "application/vnd.apple.mpegurl"); err != nil {
+			// Stored again with the next change
+			log.Printf("Failed to store live playlist %s: %v", key, err)
+		}
+	}
+	tr.written = content
+	return nil
+}
+
+// renderPlaylist builds the media playlist of a track's served segments
+func (p *packager) renderPlaylist(tr *packagedTrack) string {
+	targetDuration := int(p.segmentDuration.Round(time.Second) / time.Second)
+	for _, segment := range tr.segments {
+		if seconds := int(segment.Duration.Seconds() + 0.999); seconds > targetDuration {
+			targetDuration = seconds
+		}
+	}
+
+	version := 3
+	if tr.mapTag != "" {
+		version = 7
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-VERSION:%d\n", version)
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", targetDuration)
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", tr.mediaSequence)
+	if tr.discontinuitySequence > 0 {
+		fmt.Fprintf(&b, "#EXT-X-DISCONTINUITY-SEQUENCE:%d\n", tr.discontinuitySequence)
+	}
+	b.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	if tr.mapTag != "" {
+		b.WriteString(tr.mapTag + "\n")
+	}
+
+	for _, segment := range tr.segments {
+		if segment.Discontinuity {
+			b.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		fmt.Fprintf(&b, "#EXT-X-PROGRAM-DATE-TIME:%s\n", segment.Start.UTC().Format("2006-01-02T15:04:05.000Z07:00"))
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", segment.Duration.Seconds(), segment.URI)
+	}
+
+	return b.String()
+}
+
+// writeMaster writes the served master playlist once every variant has a
+// served playlist for it to point at
+func (p *packager) writeMaster() error {
+	if p.masterWritten {
+		return nil
+	}
+	for _, tr := range p.tracks {
+		if len(tr.segments) == 0 {
+			return nil
+		}
+	}
+
+	content, err := os.ReadFile(filepath.Join(p.dir, rawMasterPlaylist))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read chunk master playlist: %w", err)
+	}
+
+	master := strings.ReplaceAll(string(content), rawPlaylistSuffix, ".m3u8")
+	if err := writeAtomic(filepath.Join(p.dir, masterPlaylist), master); err != nil {
+		return fmt.Errorf("failed to write master playlist: %w", err)
+	}
+	p.masterWritten = true
+	return nil
+}
+
+// appendPart writes data to a partial segment at offset, dropping anything
+// past it left by an earlier failed write
+func appendPart(filePath string, offset int64, data []byte) error {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := file.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := file.WriteAt(data, offset); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// writeAtomic replaces a file so players never read a partial playlist. The
+// temporary name is one FFmpeg never writes.
+func writeAtomic(filePath, content string) error {
+	tmpPath := filePath + ".packaging"
+	if err := os.WriteFile(tmpPath, []byte(content), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filePath)
+}
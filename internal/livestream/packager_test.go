@@ -0,0 +1,170 @@
+package livestream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/scte35"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+)
+
+var packagerStart = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// writeChunks lists 2 second chunks of a variant the way FFmpeg does, with
+// chunk n starting 2n seconds after packagerStart
+func writeChunks(t *testing.T, dir, variant string, from, to int, discontinuityAt int) {
+	t.Helper()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:2\n#EXT-X-MEDIA-SEQUENCE:%d\n", from)
+	for n := from; n < to; n++ {
+		uri := fmt.Sprintf("%s_chunk_%05d.ts", variant, n)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, uri), []byte(fmt.Sprintf("[%d]", n)), 0644))
+
+		if n == discontinuityAt {
+			b.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		start := packagerStart.Add(time.Duration(2*n) * time.Second)
+		fmt.Fprintf(&b, "#EXT-X-PROGRAM-DATE-TIME:%s\n#EXTINF:2.000000,\n%s\n", start.Format("2006-01-02T15:04:05.000-0700"), uri)
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, variant+rawPlaylistSuffix), []byte(b.String()), 0644))
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestPackager_JoinsChunksIntoSegments(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, rawMasterPlaylist),
+		[]byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=2800000\n720p_chunks.m3u8\n#EXT-X-STREAM-INF:BANDWIDTH=1400000\n480p_chunks.m3u8\n"), 0644))
+
+	p := newPackager(dir, []string{"720p", "480p"}, 6*time.Second, 10, false, packagerStart)
+
+	writeChunks(t, dir, "720p", 0, 4, -1)
+	require.NoError(t, p.step(context.Background()))
+
+	assert.Equal(t, "[0][1][2]", readFile(t, filepath.Join(dir, "720p_000.ts")))
+	assert.Equal(t, "[3]", readFile(t, filepath.Join(dir, "720p_001.ts.part")))
+	playlist := readFile(t, filepath.Join(dir, "720p.m3u8"))
+	assert.Contains(t, playlist, "#EXT-X-MEDIA-SEQUENCE:0\n")
+	assert.Contains(t, playlist, "#EXT-X-PROGRAM-DATE-TIME:2026-01-01T12:00:00.000Z\n#EXTINF:6.000,\n720p_000.ts\n")
+	assert.NotContains(t, playlist, "720p_001.ts")
+
+	// The master playlist waits for every variant
+	assert.NoFileExists(t, filepath.Join(dir, masterPlaylist))
+
+	writeChunks(t, dir, "480p", 0, 3, -1)
+	writeChunks(t, dir, "720p", 0, 6, -1)
+	require.NoError(t, p.step(context.Background()))
+
+	assert.Equal(t, "[3][4][5]", readFile(t, filepath.Join(dir, "720p_001.ts")))
+	assert.Contains(t, readFile(t, filepath.Join(dir, "720p.m3u8")), "#EXTINF:6.000,\n720p_001.ts\n")
+	assert.Equal(t, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=2800000\n720p.m3u8\n#EXT-X-STREAM-INF:BANDWIDTH=1400000\n480p.m3u8\n",
+		readFile(t, filepath.Join(dir, masterPlaylist)))
+}
+
+func TestPackager_SplitsSegmentsAtCues(t *testing.T) {
+	dir := t.TempDir()
+	p := newPackager(dir, []string{"720p"}, 6*time.Second, 10, false, packagerStart)
+
+	// A break from 4s to 8s, requested mid-chunk at 3.5s for 4.5s
+	p.setCues([]scte35.Cue{{EventID: 7, Start: packagerStart.Add(3500 * time.Millisecond), Duration: 4500 * time.Millisecond}})
+	writeChunks(t, dir, "720p", 0, 7, -1)
+	require.NoError(t, p.step(context.Background()))
+
+	assert.Equal(t, "[0][1]", readFile(t, filepath.Join(dir, "720p_000.ts")))
+	assert.Equal(t, "[2][3]", readFile(t, filepath.Join(dir, "720p_001.ts")))
+	assert.Equal(t, "[4][5][6]", readFile(t, filepath.Join(dir, "720p_002.ts")))
+
+	playlist := readFile(t, filepath.Join(dir, "720p.m3u8"))
+	cueOut := strings.Index(playlist, "#EXT-X-CUE-OUT")
+	cueIn := strings.Index(playlist, "#EXT-X-CUE-IN")
+	require.True(t, cueOut > 0 && cueIn > 0)
+	assert.Less(t, strings.Index(playlist, "720p_000.ts"), cueOut)
+	assert.Less(t, cueOut, strings.Index(playlist, "720p_001.ts"))
+	assert.Less(t, strings.Index(playlist, "720p_001.ts"), cueIn)
+	assert.Less(t, cueIn, strings.Index(playlist, "720p_002.ts"))
+}
+
+func TestPackager_SlidesWindow(t *testing.T) {
+	dir := t.TempDir()
+	p := newPackager(dir, []string{"720p"}, 2*time.Second, 2, false, packagerStart)
+
+	writeChunks(t, dir, "720p", 0, 3, -1)
+	require.NoError(t, p.step(context.Background()))
+	assert.Contains(t, readFile(t, filepath.Join(dir, "720p.m3u8")), "#EXT-X-MEDIA-SEQUENCE:1\n")
+	// Dropped segments outlive the playlist listing them by one segment
+	assert.FileExists(t, filepath.Join(dir, "720p_000.ts"))
+
+	writeChunks(t, dir, "720p", 1, 4, -1)
+	require.NoError(t, p.step(context.Background()))
+	playlist := readFile(t, filepath.Join(dir, "720p.m3u8"))
+	assert.Contains(t, playlist, "#EXT-X-MEDIA-SEQUENCE:2\n")
+	assert.Contains(t, playlist, "720p_003.ts")
+	assert.NoFileExists(t, filepath.Join(dir, "720p_000.ts"))
+	assert.FileExists(t, filepath.Join(dir, "720p_001.ts"))
+}
+
+func TestPackager_ResumesServedPlaylist(t *testing.T) {
+	dir := t.TempDir()
+	p := newPackager(dir, []string{"720p"}, 4*time.Second, 10, false, packagerStart)
+	writeChunks(t, dir, "720p", 0, 5, -1)
+	require.NoError(t, p.step(context.Background()))
+
+	// Another node resumes from the served playlist; FFmpeg appends to the
+	// chunk playlist after a discontinuity
+	resumed := newPackager(dir, []string{"720p"}, 4*time.Second, 10, true, packagerStart.Add(time.Hour))
+	writeChunks(t, dir, "720p", 0, 8, 5)
+	require.NoError(t, resumed.step(context.Background()))
+
+	// The chunk left in the open segment is packaged again
+	assert.Equal(t, "[4]", readFile(t, filepath.Join(dir, "720p_002.ts")))
+	assert.Equal(t, "[5][6]", readFile(t, filepath.Join(dir, "720p_003.ts")))
+
+	playlist := readFile(t, filepath.Join(dir, "720p.m3u8"))
+	assert.Equal(t, 1, strings.Count(playlist, "720p_000.ts"))
+	assert.Contains(t, playlist, "#EXT-X-DISCONTINUITY\n#EXT-X-PROGRAM-DATE-TIME:2026-01-01T12:00:10.000Z\n#EXTINF:4.000,\n720p_003.ts\n")
+}
+
+func TestPackager_PublishesToStorage(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := storage.NewMemoryStore()
+
+	p := newPackager(dir, []string{"720p"}, 2*time.Second, 2, false, packagerStart)
+	p.publishTo(store, LiveStorageKey("stream-1", ""))
+
+	writeChunks(t, dir, "720p", 0, 4, -1)
+	require.NoError(t, p.step(ctx))
+
+	stored := func(key string) string {
+		reader, err := store.Get(ctx, key)
+		require.NoError(t, err)
+		defer reader.Close()
+		data, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	assert.Equal(t, readFile(t, filepath.Join(dir, "720p.m3u8")), stored("live/stream-1/720p.m3u8"))
+	assert.Equal(t, "[3]", stored("live/stream-1/720p_003.ts"))
+
+	// Segments are deleted from storage along with their files
+	objects, err := store.List(ctx, "live/stream-1/720p_0")
+	require.NoError(t, err)
+	assert.Len(t, objects, 3)
+	_, err = store.Stat(ctx, "live/stream-1/720p_000.ts")
+	assert.Error(t, err)
+}
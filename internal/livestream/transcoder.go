@@ -4,33 +4,47 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/therealutkarshpriyadarshi/transcode/internal/database"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
 	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
 )
 
+// Repository defines the persistence the transcoder needs for live streams
+type Repository interface {
+	CreateLiveStreamEvent(ctx context.Context, event *models.LiveStreamEvent) error
+	CreateLiveStreamVariant(ctx context.Context, variant *models.LiveStreamVariant) error
+	UpdateLiveStreamMasterPlaylist(ctx context.Context, id, playlistURL string) error
+	ListLiveStreamCues(ctx context.Context, streamID string, since time.Time) ([]*models.LiveStreamCue, error)
+}
+
 // Transcoder handles real-time transcoding of live streams
 type Transcoder struct {
-	ffmpegPath string
-	repo       *database.Repository
-	storage    *storage.Storage
+	ffmpegPath      string
+	ffprobePath     string
+	repo            Repository
+	storage         storage.Blobstore
+	supervisors     map[string]*ingestSupervisor
+	mu              sync.RWMutex
+	playlistTimeout time.Duration // how long FFmpeg has to write the master playlist
 }
 
 // NewTranscoder creates a new live stream transcoder
-func NewTranscoder(ffmpegPath string, repo *database.Repository, storage *storage.Storage) *Transcoder {
+func NewTranscoder(ffmpegPath, ffprobePath string, repo Repository, storage storage.Blobstore) *Transcoder {
 	return &Transcoder{
-		ffmpegPath: ffmpegPath,
-		repo:       repo,
-		storage:    storage,
+		ffmpegPath:      ffmpegPath,
+		ffprobePath:     ffprobePath,
+		repo:            repo,
+		storage:         storage,
+		supervisors:     make(map[string]*ingestSupervisor),
+		playlistTimeout: 30 * time.Second,
 	}
 }
 
@@ -43,6 +57,11 @@ type TranscodeOptions struct {
 	DVREnabled      bool
 	DVRWindow       int // in seconds
 	LowLatency      bool
+	Thresholds      HealthThresholds // zero value uses DefaultHealthThresholds
+	Resume          bool             // continue existing playlists, e.g. after a node failover
+
+	// OnSourceChange is called whenever the transcode switches ingest source
+	OnSourceChange func(source string)
 }
 
 // TranscodeResult contains the result of a transcode operation
@@ -61,30 +80,50 @@ func (t *Transcoder) StartTranscoding(ctx context.Context, opts TranscodeOptions
 		return nil, fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	// Build FFmpeg command for multi-variant HLS
-	cmd := t.buildFFmpegCommand(ctx, opts)
-
-	// Start FFmpeg process
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get stderr pipe: %w", err)
+	thresholds := opts.Thresholds
+	if thresholds == (HealthThresholds{}) {
+		thresholds = DefaultHealthThresholds()
 	}
 
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start FFmpeg: %w", err)
+	// Run FFmpeg under a supervisor that fails over between ingests
+	supervisor := &ingestSupervisor{
+		t:       t,
+		opts:    opts,
+		monitor: NewHealthMonitor(opts.LiveStreamID, thresholds),
+		signals: make(chan string, 1),
 	}
+	t.mu.Lock()
+	t.supervisors[opts.LiveStreamID] = supervisor
+	t.mu.Unlock()
+
+	// The supervisor and packager stop with ctx, or when the stream fails
+	// to start below
+	runCtx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	go t.runPackager(runCtx, opts)
+	go func() {
+		defer close(stopped)
+		defer cancel()
+		supervisor.run(runCtx)
 
-	// Monitor FFmpeg output in background
-	go t.monitorFFmpegOutput(ctx, opts.LiveStreamID, stderr)
+		t.mu.Lock()
+		delete(t.supervisors, opts.LiveStreamID)
+		t.mu.Unlock()
+		log.Printf("Transcoding completed for stream: %s", opts.LiveStreamID)
+	}()
 
-	// Create stream variants in database
-	if err := t.createStreamVariants(ctx, opts); err != nil {
-		log.Printf("Failed to create stream variants: %v", err)
+	// Create stream variants in database; a resumed stream already has them
+	if !opts.Resume {
+		if err := t.createStreamVariants(ctx, opts); err != nil {
+			log.Printf("Failed to create stream variants: %v", err)
+		}
 	}
 
 	// Wait for master playlist to be created
-	masterPlaylistPath := filepath.Join(opts.OutputDir, "master.m3u8")
-	if err := t.waitForFile(masterPlaylistPath, 30*time.Second); err != nil {
+	masterPlaylistPath := filepath.Join(opts.OutputDir, masterPlaylist)
+	if err := t.waitForFile(masterPlaylistPath, t.playlistTimeout); err != nil {
+		cancel()
+		<-stopped
 		return nil, fmt.Errorf("master playlist not created: %w", err)
 	}
 
@@ -93,31 +132,80 @@ func (t *Transcoder) StartTranscoding(ctx context.Context, opts TranscodeOptions
 		log.Printf("Failed to update master playlist: %v", err)
 	}
 
-	// Monitor process completion
-	go func() {
-		if err := cmd.Wait(); err != nil {
-			log.Printf("FFmpeg process error for stream %s: %v", opts.LiveStreamID, err)
-		}
-		log.Printf("Transcoding completed for stream: %s", opts.LiveStreamID)
-	}()
-
 	return &TranscodeResult{
 		MasterPlaylistPath: masterPlaylistPath,
 	}, nil
 }
 
-// buildFFmpegCommand constructs the FFmpeg command for live transcoding
-func (t *Transcoder) buildFFmpegCommand(ctx context.Context, opts TranscodeOptions) *exec.Cmd {
+// Health returns the ingest health monitor for an active live stream
+func (t *Transcoder) Health(streamID string) (*HealthMonitor, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	supervisor, ok := t.supervisors[streamID]
+	if !ok {
+		return nil, false
+	}
+	return supervisor.monitor, true
+}
+
+// IngestDropped tells the transcoder that the primary publisher disconnected,
+// so it can fail over without waiting for the stall timeout
+func (t *Transcoder) IngestDropped(streamID string) {
+	t.signal(streamID, signalIngestDropped)
+}
+
+// IngestReconnected tells the transcoder that the primary publisher is back,
+// so it can resume the primary ingest without waiting for the next probe
+func (t *Transcoder) IngestReconnected(streamID string) {
+	t.signal(streamID, signalIngestReconnected)
+}
+
+// signal delivers a signal to a stream's supervisor without blocking
+func (t *Transcoder) signal(streamID, sig string) {
+	t.mu.RLock()
+	supervisor, ok := t.supervisors[streamID]
+	t.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	select {
+	case supervisor.signals <- sig:
+	default:
+	}
+}
+
+// buildFFmpegCommand constructs the FFmpeg command for live transcoding.
+// When resume is set the existing playlists are continued with an
+// #EXT-X-DISCONTINUITY marker at the switch.
+func (t *Transcoder) buildFFmpegCommand(ctx context.Context, opts TranscodeOptions, source string, resume bool) *exec.Cmd {
 	settings := opts.Settings
 
-	args := []string{
-		"-i", opts.InputURL,
+	args, audioMap := t.inputArgs(opts, source)
+	args = append(args,
 		"-y", // Overwrite output files
-	}
+		"-nostats",
+		"-progress", "pipe:1", // Machine-readable stats for the health monitor
+	)
 
 	// Set up for multiple quality variants
 	variants := t.getVariantConfigs(settings)
 
+	segmentDuration := settings.SegmentDuration
+	if segmentDuration == 0 {
+		segmentDuration = 6 // Default 6 seconds
+	}
+
+	// FFmpeg writes one chunk per keyframe interval for the packager to join
+	// into segments, so segments can be split at ad breaks
+	chunkDuration := settings.KeyframeInterval
+	if chunkDuration <= 0 {
+		chunkDuration = 2
+	}
+	if chunkDuration > segmentDuration {
+		chunkDuration = segmentDuration
+	}
+
 	// Video encoding settings for each variant
 	for i, variant := range variants {
 		// Video stream
@@ -131,61 +219,54 @@ func (t *Transcoder) buildFFmpegCommand(ctx context.Context, opts TranscodeOptio
 			fmt.Sprintf("-r:%d", i), "30", // Frame rate
 		)
 
-		// GOP settings for better seeking
-		if settings.KeyframeInterval > 0 {
-			args = append(args,
-				fmt.Sprintf("-g:%d", i), fmt.Sprintf("%d", settings.KeyframeInterval*30), // Keyframe every N seconds
-				fmt.Sprintf("-keyint_min:%d", i), fmt.Sprintf("%d", settings.KeyframeInterval*30),
-				fmt.Sprintf("-sc_threshold:%d", i), "0", // Disable scene detection for consistent GOPs
-			)
-		}
+		// GOP settings for better seeking; every chunk starts on a keyframe
+		args = append(args,
+			fmt.Sprintf("-g:%d", i), fmt.Sprintf("%d", chunkDuration*30), // Keyframe every N seconds
+			fmt.Sprintf("-keyint_min:%d", i), fmt.Sprintf("%d", chunkDuration*30),
+			fmt.Sprintf("-sc_threshold:%d", i), "0", // Disable scene detection for consistent GOPs
+		)
 
 		// Audio stream
 		args = append(args,
-			"-map", "0:a:0", // Map audio stream
+			"-map", audioMap, // Map audio stream
 			fmt.Sprintf("-c:a:%d", i), settings.AudioCodec,
 			fmt.Sprintf("-b:a:%d", i), fmt.Sprintf("%dk", settings.AudioBitrate),
 		)
 	}
 
-	// HLS output settings
-	segmentDuration := settings.SegmentDuration
-	if segmentDuration == 0 {
-		segmentDuration = 6 // Default 6 seconds
+	// HLS output settings. The chunk playlists only need to list chunks until
+	// the packager has read them; the served playlists keep the window.
+	chunksPerSegment := (segmentDuration + chunkDuration - 1) / chunkDuration
+	listSize := 3 * chunksPerSegment
+	if listSize < 6 {
+		listSize = 6
 	}
-
-	playlistLength := settings.PlaylistLength
-	if playlistLength == 0 {
-		playlistLength = 10 // Default 10 segments
-	}
-
-	args = append(args,
-		"-f", "hls",
-		"-hls_time", fmt.Sprintf("%d", segmentDuration),
-		"-hls_list_size", fmt.Sprintf("%d", playlistLength),
-		"-hls_flags", "delete_segments+independent_segments",
-	)
+	// Program date-times let ad cues be placed by wall-clock time
+	hlsFlags := []string{"delete_segments", "independent_segments", "program_date_time"}
 
 	// Low-latency HLS settings
 	if opts.LowLatency && settings.PartDuration > 0 {
 		args = append(args,
-			"-hls_flags", "delete_segments+independent_segments+program_date_time",
 			"-hls_segment_type", "fmp4", // Use fragmented MP4 for LL-HLS
 			"-hls_fmp4_init_filename", "init_%v.mp4",
 			"-ldash", "1", // Enable low-latency mode
 		)
 	}
 
-	// DVR settings
-	if opts.DVREnabled {
-		// Keep segments for DVR window
-		dvrSegments := opts.DVRWindow / segmentDuration
-		args = append(args,
-			"-hls_list_size", fmt.Sprintf("%d", dvrSegments),
-			"-hls_flags", "append_list+delete_segments",
-		)
+	if opts.DVREnabled || resume {
+		hlsFlags = append(hlsFlags, "append_list")
+	}
+	if resume {
+		hlsFlags = append(hlsFlags, "discont_start")
 	}
 
+	args = append(args,
+		"-f", "hls",
+		"-hls_time", fmt.Sprintf("%d", chunkDuration),
+		"-hls_list_size", fmt.Sprintf("%d", listSize),
+		"-hls_flags", strings.Join(hlsFlags, "+"),
+	)
+
 	// Variant stream mapping
 	var varStreamMap []string
 	for i, variant := range variants {
@@ -195,9 +276,9 @@ func (t *Transcoder) buildFFmpegCommand(ctx context.Context, opts TranscodeOptio
 	}
 	args = append(args,
 		"-var_stream_map", strings.Join(varStreamMap, " "),
-		"-master_pl_name", "master.m3u8",
-		"-hls_segment_filename", filepath.Join(opts.OutputDir, "%v_%03d.ts"),
-		filepath.Join(opts.OutputDir, "%v.m3u8"),
+		"-master_pl_name", rawMasterPlaylist,
+		"-hls_segment_filename", filepath.Join(opts.OutputDir, "%v_chunk_%05d.ts"),
+		filepath.Join(opts.OutputDir, "%v"+rawPlaylistSuffix),
 	)
 
 	return exec.CommandContext(ctx, t.ffmpegPath, args...)
@@ -275,67 +356,62 @@ func (t *Transcoder) getVideoCodec(codec string, gpuAccel bool) string {
 	}
 }
 
-// monitorFFmpegOutput monitors FFmpeg output for progress and errors
-func (t *Transcoder) monitorFFmpegOutput(ctx context.Context, streamID string, stderr bufio.Reader) {
-	scanner := bufio.NewScanner(&stderr)
-	frameRegex := regexp.MustCompile(`frame=\s*(\d+)`)
-	bitrateRegex := regexp.MustCompile(`bitrate=\s*([\d.]+)kbits/s`)
-
-	var lastUpdate time.Time
+// monitorFFmpegOutput monitors FFmpeg stderr for errors. Progress is read
+// separately from the -progress pipe.
+func (t *Transcoder) monitorFFmpegOutput(ctx context.Context, streamID string, stderr io.Reader, monitor *HealthMonitor) {
+	scanner := bufio.NewScanner(stderr)
 
 	for scanner.Scan() {
 		line := scanner.Text()
 
-		// Parse progress information
-		if matches := frameRegex.FindStringSubmatch(line); len(matches) > 1 {
-			frames, _ := strconv.Atoi(matches[1])
-
-			// Update analytics periodically (every 10 seconds)
-			if time.Since(lastUpdate) >= 10*time.Second {
-				lastUpdate = time.Now()
-
-				var bitrate int64
-				if bitrateMatches := bitrateRegex.FindStringSubmatch(line); len(bitrateMatches) > 1 {
-					bitrateFloat, _ := strconv.ParseFloat(bitrateMatches[1], 64)
-					bitrate = int64(bitrateFloat * 1000) // Convert to bps
-				}
-
-				analytics := &models.LiveStreamAnalytics{
-					LiveStreamID:  streamID,
-					Timestamp:     time.Now(),
-					IngestBitrate: bitrate,
-					BufferHealth:  100,
-					QualityScore:  95,
-				}
-
-				if err := t.repo.CreateLiveStreamAnalytics(ctx, analytics); err != nil {
-					log.Printf("Failed to create analytics: %v", err)
-				}
-
-				log.Printf("Stream %s: frames=%d, bitrate=%dkbps", streamID, frames, bitrate/1000)
-			}
-		}
-
 		// Check for errors
 		if strings.Contains(line, "Error") || strings.Contains(line, "error") {
 			log.Printf("FFmpeg error for stream %s: %s", streamID, line)
+			monitor.ObserveError()
 
-			event := &models.LiveStreamEvent{
-				LiveStreamID: streamID,
-				EventType:    models.LiveStreamEventError,
-				Severity:     models.SeverityError,
-				Message:      "FFmpeg error detected",
-				Details:      models.Metadata{"error": line},
-				Timestamp:    time.Now(),
-			}
-
-			if err := t.repo.CreateLiveStreamEvent(ctx, event); err != nil {
-				log.Printf("Failed to log event: %v", err)
-			}
+			t.logEvent(ctx, streamID, models.LiveStreamEventError, models.SeverityError,
+				"FFmpeg error detected", models.Metadata{"error": line})
 		}
 	}
 }
 
+// inputArgs returns the FFmpeg input arguments for an ingest source and the
+// stream to map audio from
+func (t *Transcoder) inputArgs(opts TranscodeOptions, source string) ([]string, string) {
+	switch source {
+	case models.IngestSourceBackup:
+		return []string{"-i", opts.Settings.BackupIngestURL}, "0:a:0"
+	case models.IngestSourceSlate:
+		video := []string{"-re", "-f", "lavfi", "-i", "color=c=black:s=1280x720:r=30"}
+		if opts.Settings.SlateImage != "" {
+			video = []string{"-re", "-loop", "1", "-i", opts.Settings.SlateImage}
+		}
+		silence := []string{"-f", "lavfi", "-i", "anullsrc=channel_layout=stereo:sample_rate=48000"}
+		return append(video, silence...), "1:a:0"
+	default:
+		return []string{"-i", opts.InputURL}, "0:a:0"
+	}
+}
+
+// logEvent records an event for a live stream
+func (t *Transcoder) logEvent(ctx context.Context, streamID, eventType, severity, message string, details models.Metadata) {
+	t.createEvent(ctx, &models.LiveStreamEvent{
+		LiveStreamID: streamID,
+		EventType:    eventType,
+		Severity:     severity,
+		Message:      message,
+		Details:      details,
+		Timestamp:    time.Now(),
+	})
+}
+
+// createEvent stores a live stream event
+func (t *Transcoder) createEvent(ctx context.Context, event *models.LiveStreamEvent) {
+	if err := t.repo.CreateLiveStreamEvent(ctx, event); err != nil {
+		log.Printf("Failed to log event: %v", err)
+	}
+}
+
 // createStreamVariants creates variant records in the database
 func (t *Transcoder) createStreamVariants(ctx context.Context, opts TranscodeOptions) error {
 	variants := t.getVariantConfigs(opts.Settings)
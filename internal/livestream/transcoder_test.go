@@ -0,0 +1,98 @@
+package livestream
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+func TestBuildFFmpegCommand_Sources(t *testing.T) {
+	transcoder := NewTranscoder("ffmpeg", "ffprobe", nil, nil)
+
+	settings := models.DefaultLiveStreamSettings()
+	settings.BackupIngestURL = "rtmp://backup/live/key"
+	opts := TranscodeOptions{
+		LiveStreamID: "stream-1",
+		InputURL:     "rtmp://primary/live/key",
+		OutputDir:    "/tmp/livestreams/stream-1",
+		Settings:     settings,
+	}
+
+	t.Run("Primary", func(t *testing.T) {
+		args := strings.Join(transcoder.buildFFmpegCommand(context.Background(), opts, models.IngestSourcePrimary, false).Args, " ")
+		assert.Contains(t, args, "-i rtmp://primary/live/key")
+		assert.Contains(t, args, "-progress pipe:1")
+		assert.Contains(t, args, "-map 0:a:0")
+		assert.Contains(t, args, "-hls_flags delete_segments+independent_segments+program_date_time ")
+		assert.Contains(t, args, "-hls_time 2 -hls_list_size 9 ")
+		assert.Contains(t, args, "-master_pl_name master_chunks.m3u8")
+		assert.Contains(t, args, "/tmp/livestreams/stream-1/%v_chunk_%05d.ts /tmp/livestreams/stream-1/%v_chunks.m3u8")
+	})
+
+	t.Run("Backup", func(t *testing.T) {
+		args := strings.Join(transcoder.buildFFmpegCommand(context.Background(), opts, models.IngestSourceBackup, true).Args, " ")
+		assert.Contains(t, args, "-i rtmp://backup/live/key")
+		assert.Contains(t, args, "append_list")
+		assert.Contains(t, args, "discont_start")
+	})
+
+	t.Run("Slate", func(t *testing.T) {
+		args := strings.Join(transcoder.buildFFmpegCommand(context.Background(), opts, models.IngestSourceSlate, true).Args, " ")
+		assert.Contains(t, args, "color=c=black")
+		assert.Contains(t, args, "anullsrc")
+		assert.Contains(t, args, "-map 1:a:0")
+		assert.NotContains(t, args, "rtmp://")
+
+		slateOpts := opts
+		slateOpts.Settings.SlateImage = "/etc/transcode/slate.png"
+		args = strings.Join(transcoder.buildFFmpegCommand(context.Background(), slateOpts, models.IngestSourceSlate, true).Args, " ")
+		assert.Contains(t, args, "-loop 1 -i /etc/transcode/slate.png")
+	})
+}
+
+// nopRepo discards everything the transcoder records
+type nopRepo struct{}
+
+func (nopRepo) CreateLiveStreamEvent(ctx context.Context, event *models.LiveStreamEvent) error {
+	return nil
+}
+
+func (nopRepo) CreateLiveStreamVariant(ctx context.Context, variant *models.LiveStreamVariant) error {
+	return nil
+}
+
+func (nopRepo) UpdateLiveStreamMasterPlaylist(ctx context.Context, id, playlistURL string) error {
+	return nil
+}
+
+func (nopRepo) ListLiveStreamCues(ctx context.Context, streamID string, since time.Time) ([]*models.LiveStreamCue, error) {
+	return nil, nil
+}
+
+func TestStartTranscoding_StopsWhenPlaylistNeverAppears(t *testing.T) {
+	// An FFmpeg that runs but never writes a playlist
+	dir := t.TempDir()
+	ffmpeg := filepath.Join(dir, "ffmpeg")
+	require.NoError(t, os.WriteFile(ffmpeg, []byte("#!/bin/sh\nexec sleep 30\n"), 0755))
+
+	transcoder := NewTranscoder(ffmpeg, ffmpeg, nopRepo{}, nil)
+	transcoder.playlistTimeout = 100 * time.Millisecond
+
+	_, err := transcoder.StartTranscoding(context.Background(), TranscodeOptions{
+		LiveStreamID: "stream-1",
+		InputURL:     "rtmp://primary/live/key",
+		OutputDir:    filepath.Join(dir, "out"),
+		Settings:     models.DefaultLiveStreamSettings(),
+	})
+	require.Error(t, err)
+
+	_, running := transcoder.Health("stream-1")
+	assert.False(t, running, "the supervisor must stop when the stream fails to start")
+}
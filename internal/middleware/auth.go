@@ -138,6 +138,33 @@ func OptionalAuth(validator APIKeyValidator) gin.HandlerFunc {
 	}
 }
 
+// UserLookup loads the authenticated user
+type UserLookup interface {
+	GetUserByID(ctx context.Context, userID string) (*models.User, error)
+}
+
+// RequireRole middleware only lets users with the given role through. It must
+// run after an authentication middleware.
+func RequireRole(users UserLookup, role models.UserRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := GetUserID(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Valid authentication required"})
+			c.Abort()
+			return
+		}
+
+		user, err := users.GetUserByID(c.Request.Context(), userID)
+		if err != nil || user == nil || !user.IsActive || user.Role != role {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // GenerateToken generates a JWT token for a user
 func GenerateToken(userID, email string, expiresIn time.Duration) (string, error) {
 	claims := Claims{
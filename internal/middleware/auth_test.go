@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -8,6 +10,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
 )
 
 func TestGenerateToken(t *testing.T) {
@@ -89,3 +92,52 @@ func TestJWTAuthWithValidToken(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Code)
 }
+
+type fakeUsers map[string]*models.User
+
+func (f fakeUsers) GetUserByID(ctx context.Context, userID string) (*models.User, error) {
+	if user, ok := f[userID]; ok {
+		return user, nil
+	}
+	return nil, errors.New("user not found")
+}
+
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	users := fakeUsers{
+		"admin":    {ID: "admin", Role: models.UserRoleAdmin, IsActive: true},
+		"user":     {ID: "user", Role: models.UserRoleUser, IsActive: true},
+		"disabled": {ID: "disabled", Role: models.UserRoleAdmin},
+	}
+
+	tests := []struct {
+		name           string
+		userID         string
+		expectedStatus int
+	}{
+		{name: "Admin", userID: "admin", expectedStatus: http.StatusOK},
+		{name: "Regular user", userID: "user", expectedStatus: http.StatusForbidden},
+		{name: "Inactive admin", userID: "disabled", expectedStatus: http.StatusForbidden},
+		{name: "Unknown user", userID: "missing", expectedStatus: http.StatusForbidden},
+		{name: "Unauthenticated", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("GET", "/test", nil)
+			if tt.userID != "" {
+				c.Set(AuthContextKey, tt.userID)
+			}
+
+			RequireRole(users, models.UserRoleAdmin)(c)
+			if !c.IsAborted() {
+				c.Status(http.StatusOK)
+			}
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+const (
+	// IdempotencyKeyHeader names the header clients set to make a request safe to retry
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// IdempotentReplayedHeader is set on responses replayed for a retried request
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// IdempotencyStore persists the responses of requests made with an
+// Idempotency-Key
+type IdempotencyStore interface {
+	// ReserveIdempotencyKey records an in-flight request. It returns the
+	// existing record when the key is already in use, and nil otherwise.
+	ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error)
+	CompleteIdempotencyKey(ctx context.Context, scope, key string, statusCode int, response []byte) error
+	ReleaseIdempotencyKey(ctx context.Context, scope, key string) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error)
+}
+
+// responseRecorder captures the response body written by a handler
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency middleware makes requests carrying an Idempotency-Key header
+// safe to retry: the first request runs and its response is kept for ttl, and
+// retries with the same key and body get that response instead of running the
+// handler again. Server errors are not kept, so the request can be retried.
+func Idempotency(store IdempotencyStore, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength),
+			})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := time.Now()
+		record := &models.IdempotencyRecord{
+			Scope:       idempotencyScope(c),
+			Key:         key,
+			Fingerprint: requestFingerprint(c.Request.Method, c.Request.URL.Path, body),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(ttl),
+		}
+
+		ctx := c.Request.Context()
+		existing, err := store.ReserveIdempotencyKey(ctx, record)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check idempotency key"})
+			c.Abort()
+			return
+		}
+
+		if existing != nil {
+			replayIdempotentResponse(c, record, existing)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		// Free the key if the handler panics, so the request can be retried
+		done := false
+		defer func() {
+			if !done {
+				releaseIdempotencyKey(store, record)
+			}
+		}()
+
+		c.Next()
+		done = true
+
+		status := recorder.Status()
+		if !storableStatus(status) {
+			releaseIdempotencyKey(store, record)
+			return
+		}
+
+		if err := store.CompleteIdempotencyKey(context.Background(), record.Scope, record.Key, status, recorder.body.Bytes()); err != nil {
+			log.Printf("Failed to record response for idempotency key %s: %v", record.Key, err)
+		}
+	}
+}
+
+// replayIdempotentResponse answers a request whose key is already in use
+func replayIdempotentResponse(c *gin.Context, record, existing *models.IdempotencyRecord) {
+	switch {
+	case existing.Fingerprint != record.Fingerprint:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "Idempotency-Key was already used for a different request",
+		})
+	case !existing.Completed():
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "A request with this Idempotency-Key is still being processed",
+		})
+	default:
+		c.Header(IdempotentReplayedHeader, "true")
+		c.Data(existing.StatusCode, "application/json; charset=utf-8", existing.Response)
+	}
+	c.Abort()
+}
+
+// storableStatus reports whether a response is final for its request. Server
+// errors, conflicts and rate limiting may succeed when retried.
+func storableStatus(status int) bool {
+	return status < http.StatusInternalServerError &&
+		status != http.StatusConflict &&
+		status != http.StatusTooManyRequests
+}
+
+func releaseIdempotencyKey(store IdempotencyStore, record *models.IdempotencyRecord) {
+	if err := store.ReleaseIdempotencyKey(context.Background(), record.Scope, record.Key); err != nil {
+		log.Printf("Failed to release idempotency key %s: %v", record.Key, err)
+	}
+}
+
+// idempotencyScope returns the namespace of a request's keys, so clients
+// cannot see each other's responses
+func idempotencyScope(c *gin.Context) string {
+	if userID, exists := GetUserID(c); exists {
+		return "user:" + userID
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// requestFingerprint hashes a request to detect a key reused for another request
+func requestFingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CleanupIdempotencyKeys periodically deletes expired idempotency keys until
+// ctx is cancelled
+func CleanupIdempotencyKeys(ctx context.Context, store IdempotencyStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := store.DeleteExpiredIdempotencyKeys(ctx)
+			if err != nil {
+				log.Printf("Failed to delete expired idempotency keys: %v", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("Deleted %d expired idempotency keys", deleted)
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+type fakeIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*models.IdempotencyRecord
+}
+
+func (s *fakeIdempotencyStore) ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.records == nil {
+		s.records = make(map[string]*models.IdempotencyRecord)
+	}
+	if existing, ok := s.records[record.Scope+"/"+record.Key]; ok && existing.ExpiresAt.After(time.Now()) {
+		copied := *existing
+		return &copied, nil
+	}
+	copied := *record
+	s.records[record.Scope+"/"+record.Key] = &copied
+	return nil, nil
+}
+
+func (s *fakeIdempotencyStore) CompleteIdempotencyKey(ctx context.Context, scope, key string, statusCode int, response []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := s.records[scope+"/"+key]
+	record.StatusCode = statusCode
+	record.Response = append([]byte(nil), response...)
+	return nil
+}
+
+func (s *fakeIdempotencyStore) ReleaseIdempotencyKey(ctx context.Context, scope, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record, ok := s.records[scope+"/"+key]; ok && !record.Completed() {
+		delete(s.records, scope+"/"+key)
+	}
+	return nil
+}
+
+func (s *fakeIdempotencyStore) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func idempotentRouter(store IdempotencyStore, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.POST("/jobs", Idempotency(store, time.Hour), handler)
+	return router
+}
+
+func postJob(router *gin.Engine, key, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/jobs", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplaysResponse(t *testing.T) {
+	calls := 0
+	router := idempotentRouter(&fakeIdempotencyStore{}, func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusCreated, gin.H{"job_id": calls})
+	})
+
+	first := postJob(router, "key-1", `{"video_id":"video-1"}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get(IdempotentReplayedHeader))
+
+	retry := postJob(router, "key-1", `{"video_id":"video-1"}`)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, "true", retry.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, 1, calls)
+
+	// A new key runs the handler again
+	other := postJob(router, "key-2", `{"video_id":"video-1"}`)
+	assert.Equal(t, http.StatusCreated, other.Code)
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotencyRejectsKeyReuse(t *testing.T) {
+	router := idempotentRouter(&fakeIdempotencyStore{}, func(c *gin.Context) {
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+
+	assert.Equal(t, http.StatusCreated, postJob(router, "key-1", `{"video_id":"video-1"}`).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, postJob(router, "key-1", `{"video_id":"video-2"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, postJob(router, strings.Repeat("k", 256), `{}`).Code)
+}
+
+func TestIdempotencyRejectsConcurrentRequest(t *testing.T) {
+	store := &fakeIdempotencyStore{}
+	inFlight := make(chan struct{})
+	release := make(chan struct{})
+	router := idempotentRouter(store, func(c *gin.Context) {
+		close(inFlight)
+		<-release
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+
+	done := make(chan int)
+	go func() {
+		done <- postJob(router, "key-1", `{}`).Code
+	}()
+
+	<-inFlight
+	assert.Equal(t, http.StatusConflict, postJob(router, "key-1", `{}`).Code)
+	close(release)
+	assert.Equal(t, http.StatusCreated, <-done)
+}
+
+func TestIdempotencyReleasesKeyOnServerError(t *testing.T) {
+	calls := 0
+	router := idempotentRouter(&fakeIdempotencyStore{}, func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create job"})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+
+	assert.Equal(t, http.StatusInternalServerError, postJob(router, "key-1", `{}`).Code)
+	assert.Equal(t, http.StatusCreated, postJob(router, "key-1", `{}`).Code)
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotencyWithoutKey(t *testing.T) {
+	calls := 0
+	router := idempotentRouter(&fakeIdempotencyStore{}, func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+
+	postJob(router, "", `{}`)
+	postJob(router, "", `{}`)
+	assert.Equal(t, 2, calls)
+}
@@ -6,6 +6,9 @@ import (
 	"log"
 	"sync"
 	"time"
+
+	"github.com/therealutkarshpriyadarshi/transcode/internal/queue"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
 )
 
 // Metrics holds system metrics
@@ -40,6 +43,13 @@ type Monitor struct {
 	mu            sync.RWMutex
 	repo          MetricsRepository
 	queueProvider QueueProvider
+	workerSource  WorkerSource
+	heartbeatTTL  time.Duration
+}
+
+// WorkerSource lists the workers registered through their heartbeats
+type WorkerSource interface {
+	ListWorkers(ctx context.Context) ([]*models.Worker, error)
 }
 
 // MetricsRepository defines the interface for metrics data
@@ -51,10 +61,7 @@ type MetricsRepository interface {
 }
 
 // QueueProvider defines the interface for queue metrics
-type QueueProvider interface {
-	GetQueueDepth() (int, error)
-	GetDLQDepth() (int, error)
-}
+type QueueProvider = queue.DepthReporter
 
 // NewMonitor creates a new monitoring service
 func NewMonitor(repo MetricsRepository, queueProvider QueueProvider) *Monitor {
@@ -68,6 +75,16 @@ func NewMonitor(repo MetricsRepository, queueProvider QueueProvider) *Monitor {
 	}
 }
 
+// SetWorkerSource makes worker health follow the worker registry. Workers
+// silent for longer than heartbeatTTL are reported unhealthy.
+func (m *Monitor) SetWorkerSource(source WorkerSource, heartbeatTTL time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.workerSource = source
+	m.heartbeatTTL = heartbeatTTL
+}
+
 // Start begins the monitoring service
 func (m *Monitor) Start(ctx context.Context) {
 	go m.collectMetrics(ctx)
@@ -163,6 +180,7 @@ func (m *Monitor) checkWorkerHealth(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			m.syncWorkers(ctx)
 			m.updateWorkerHealth()
 		}
 	}
@@ -183,6 +201,46 @@ func (m *Monitor) updateWorkerHealth() {
 	}
 }
 
+// syncWorkers replaces the known workers with those in the worker registry
+func (m *Monitor) syncWorkers(ctx context.Context) {
+	m.mu.RLock()
+	source, ttl := m.workerSource, m.heartbeatTTL
+	m.mu.RUnlock()
+
+	if source == nil {
+		return
+	}
+
+	registered, err := source.ListWorkers(ctx)
+	if err != nil {
+		log.Printf("Failed to list workers: %v", err)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	workers := make(map[string]*WorkerHealth, len(registered))
+	for _, w := range registered {
+		health := &WorkerHealth{
+			WorkerID:      w.ID,
+			Status:        "healthy",
+			LastHeartbeat: w.HeartbeatAt,
+		}
+		if len(w.CurrentJobs) > 0 {
+			health.CurrentJob = w.CurrentJobs[0]
+		}
+		if !w.Alive(ttl) {
+			health.Status = "unhealthy"
+		}
+		if previous, ok := m.workers[w.ID]; ok {
+			health.ProcessedJobs = previous.ProcessedJobs
+		}
+		workers[w.ID] = health
+	}
+	m.workers = workers
+}
+
 // RegisterWorkerHeartbeat registers a worker heartbeat
 func (m *Monitor) RegisterWorkerHeartbeat(workerID, currentJob string) {
 	m.mu.Lock()
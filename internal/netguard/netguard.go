@@ -0,0 +1,49 @@
+// Package netguard keeps connections to user supplied hosts off internal
+// networks
+package netguard
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned when a host resolves to an internal address
+var ErrPrivateAddress = errors.New("address is not publicly routable")
+
+// IsPublic reports whether ip is a publicly routable address
+func IsPublic(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// Transport returns an HTTP transport whose connections must reach public
+// addresses, unless allowPrivate is set
+func Transport(allowPrivate bool) *http.Transport {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if !allowPrivate {
+		// Checked on the resolved address of every connection, redirects
+		// included, so DNS cannot be used to sneak past it
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !IsPublic(ip) {
+				return fmt.Errorf("%s: %w", host, ErrPrivateAddress)
+			}
+			return nil
+		}
+	}
+
+	// No proxy: it would resolve hosts itself, bypassing the check
+	return &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   30 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+	}
+}
@@ -0,0 +1,167 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// maxDeadLetterScan bounds how many dead letters one list or settle call reads
+const maxDeadLetterScan = 10000
+
+// Failure classes of dead-lettered jobs
+const (
+	FailureClassTimeout  = "timeout" // ran past its max runtime
+	FailureClassStalled  = "stalled" // stopped making progress
+	FailureClassInput    = "invalid_input"
+	FailureClassResource = "resource"
+	FailureClassStorage  = "storage"
+	FailureClassEncoder  = "encoder"
+	FailureClassUnknown  = "unknown"
+)
+
+// failureClassPatterns maps substrings of failure reasons to their class,
+// checked in order
+var failureClassPatterns = []struct {
+	class    string
+	patterns []string
+}{
+	{FailureClassStalled, []string{"stalled", "no progress"}},
+	{FailureClassTimeout, []string{"timeout", "timed out", "deadline exceeded"}},
+	{FailureClassResource, []string{"out of memory", "cannot allocate", "no space left", "signal: killed", "resource"}},
+	{FailureClassInput, []string{"invalid data", "moov atom", "no such file", "not found", "unsupported", "ffprobe", "probe"}},
+	{FailureClassStorage, []string{"upload", "download", "storage", "s3", "minio", "bucket"}},
+	{FailureClassEncoder, []string{"ffmpeg", "encod", "codec", "nvenc", "exit status"}},
+}
+
+// ClassifyFailure groups a dead letter reason into a failure class so similar
+// failures can be inspected and replayed together
+func ClassifyFailure(reason string) string {
+	reason = strings.ToLower(reason)
+	for _, c := range failureClassPatterns {
+		for _, pattern := range c.patterns {
+			if strings.Contains(reason, pattern) {
+				return c.class
+			}
+		}
+	}
+	return FailureClassUnknown
+}
+
+// ClassifiedError is implemented by errors that know their failure class,
+// e.g. an ffmpeg run killed by the watchdog
+type ClassifiedError interface {
+	error
+	FailureClass() string
+}
+
+// ErrorClass returns the failure class of the first ClassifiedError in err's
+// chain, or FailureClassUnknown. Unlike ClassifyFailure it never guesses from
+// the message, so a failure is only retried less when it is known to recur.
+func ErrorClass(err error) string {
+	var classified ClassifiedError
+	if errors.As(err, &classified) {
+		return classified.FailureClass()
+	}
+	return FailureClassUnknown
+}
+
+// retryLimits caps the retries of failure classes unlikely to go away when
+// retried. A job that ran past its max runtime will probably do so again,
+// while a stall, e.g. from a flaky network source, is worth retrying fully.
+var retryLimits = map[string]int{
+	FailureClassTimeout: 1,
+}
+
+// RetryLimit returns how many times a job failing with class is retried
+// before being dead lettered
+func RetryLimit(class string) int {
+	if limit, ok := retryLimits[class]; ok && limit < MaxRetries {
+		return limit
+	}
+	return MaxRetries
+}
+
+// DeadLetter is a job in the dead letter queue
+type DeadLetter struct {
+	ID         string      `json:"id"` // backend message ID
+	Job        *models.Job `json:"job"`
+	Reason     string      `json:"reason"`
+	ErrorClass string      `json:"error_class"`
+	RetryCount int         `json:"retry_count"`
+	FailedAt   time.Time   `json:"failed_at"`
+}
+
+// newDeadLetter creates a DeadLetter, classifying its reason
+func newDeadLetter(id string, job *models.Job, reason string, retryCount int, failedAt time.Time) *DeadLetter {
+	return &DeadLetter{
+		ID:         id,
+		Job:        job,
+		Reason:     reason,
+		ErrorClass: ClassifyFailure(reason),
+		RetryCount: retryCount,
+		FailedAt:   failedAt,
+	}
+}
+
+// DeadLetterFilter selects dead letters. Empty fields match everything.
+type DeadLetterFilter struct {
+	IDs        []string  `json:"ids"`
+	JobIDs     []string  `json:"job_ids"`
+	ErrorClass string    `json:"error_class"`
+	Reason     string    `json:"reason"` // case-insensitive substring
+	Since      time.Time `json:"since"`  // failed at or after
+	Limit      int       `json:"limit"`  // 0 for no limit
+}
+
+// Empty reports whether the filter matches every dead letter
+func (f DeadLetterFilter) Empty() bool {
+	return len(f.IDs) == 0 && len(f.JobIDs) == 0 && f.ErrorClass == "" && f.Reason == "" && f.Since.IsZero()
+}
+
+// Match reports whether dl is selected by the filter, ignoring Limit
+func (f DeadLetterFilter) Match(dl *DeadLetter) bool {
+	if len(f.IDs) > 0 && !containsString(f.IDs, dl.ID) {
+		return false
+	}
+	if len(f.JobIDs) > 0 && !containsString(f.JobIDs, dl.Job.ID) {
+		return false
+	}
+	if f.ErrorClass != "" && f.ErrorClass != dl.ErrorClass {
+		return false
+	}
+	if f.Reason != "" && !strings.Contains(strings.ToLower(dl.Reason), strings.ToLower(f.Reason)) {
+		return false
+	}
+	if !f.Since.IsZero() && dl.FailedAt.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// full reports whether n matches reach the filter's limit
+func (f DeadLetterFilter) full(n int) bool {
+	return f.Limit > 0 && n >= f.Limit
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// DeadLetterManager lets operators inspect and settle dead-lettered jobs
+type DeadLetterManager interface {
+	// ListDeadLetters returns the dead letters matching filter, oldest first
+	ListDeadLetters(ctx context.Context, filter DeadLetterFilter) ([]*DeadLetter, error)
+
+	// SettleDeadLetters calls settle for each dead letter matching filter and
+	// removes those it returns true for. It returns the number removed.
+	SettleDeadLetters(ctx context.Context, filter DeadLetterFilter, settle func(*DeadLetter) bool) (int, error)
+}
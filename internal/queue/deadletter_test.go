@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	tests := map[string]string{
+		"max retries exceeded: context deadline exceeded":          FailureClassTimeout,
+		"transcoding failed: ffmpeg stalled: no progress for 2m0s": FailureClassStalled,
+		"ffmpeg timed out: exceeded max runtime of 10m0s":          FailureClassTimeout,
+		"ffmpeg: signal: killed":                                   FailureClassResource,
+		"moov atom not found":                                      FailureClassInput,
+		"failed to upload output: connection reset":                FailureClassStorage,
+		"transcoding failed: ffmpeg exited: exit status 1":         FailureClassEncoder,
+		"max retries exceeded: something unexpected happened here": FailureClassUnknown,
+	}
+
+	for reason, class := range tests {
+		assert.Equal(t, class, ClassifyFailure(reason), reason)
+	}
+}
+
+func TestRetryLimit(t *testing.T) {
+	assert.Equal(t, 1, RetryLimit(FailureClassTimeout))
+	assert.Equal(t, MaxRetries, RetryLimit(FailureClassStalled))
+	assert.Equal(t, MaxRetries, RetryLimit(FailureClassEncoder))
+}
+
+type classifiedError struct {
+	class string
+}
+
+func (e *classifiedError) Error() string        { return "ffmpeg " + e.class }
+func (e *classifiedError) FailureClass() string { return e.class }
+
+func TestErrorClass(t *testing.T) {
+	assert.Equal(t, FailureClassTimeout, ErrorClass(fmt.Errorf("transcoding failed: %w", &classifiedError{class: FailureClassTimeout})))
+	// Messages are not guessed from
+	assert.Equal(t, FailureClassUnknown, ErrorClass(errors.New("failed to upload output: i/o timeout")))
+}
+
+func TestSettleDeadLettersTimedOutJobAfterOneRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := NewMemoryQueue()
+	require.NoError(t, q.Retry(ctx, &models.Job{ID: "job-slow"}, 1, 0))
+	require.NoError(t, q.Retry(ctx, &models.Job{ID: "job-stalled"}, 1, 0))
+	require.NoError(t, q.Retry(ctx, &models.Job{ID: "job-upload"}, 1, 0))
+
+	deliveries := make(chan *Delivery, 3)
+	require.NoError(t, q.Consume(ctx, func(d *Delivery) { deliveries <- d }))
+
+	for i := 0; i < 3; i++ {
+		d := receive(t, deliveries)
+		var err error
+		switch d.Job.ID {
+		case "job-slow":
+			err = &classifiedError{class: FailureClassTimeout}
+		case "job-stalled":
+			err = &classifiedError{class: FailureClassStalled}
+		default:
+			err = errors.New("failed to upload output: i/o timeout")
+		}
+		Settle(ctx, q, d, fmt.Errorf("transcoding failed: %w", err))
+	}
+
+	// The stalled and upload jobs are retried, the timed out one is out of retries
+	dead := q.DeadLetters()
+	require.Len(t, dead, 1)
+	assert.Equal(t, "job-slow", dead[0].ID)
+}
+
+func TestDeadLetterFilterMatch(t *testing.T) {
+	failedAt := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	dl := newDeadLetter("7", &models.Job{ID: "job-1"}, "Connection timed out", 5, failedAt)
+
+	assert.True(t, DeadLetterFilter{}.Empty())
+	assert.True(t, DeadLetterFilter{}.Match(dl))
+	assert.True(t, DeadLetterFilter{IDs: []string{"7"}, JobIDs: []string{"job-1"}}.Match(dl))
+	assert.True(t, DeadLetterFilter{ErrorClass: FailureClassTimeout, Reason: "TIMED OUT"}.Match(dl))
+	assert.True(t, DeadLetterFilter{Since: failedAt}.Match(dl))
+
+	assert.False(t, DeadLetterFilter{JobIDs: []string{"job-2"}}.Match(dl))
+	assert.False(t, DeadLetterFilter{ErrorClass: FailureClassInput}.Match(dl))
+	assert.False(t, DeadLetterFilter{Since: failedAt.Add(time.Second)}.Match(dl))
+}
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
 )
@@ -59,29 +61,36 @@ func (q *Queue) SetupDeadLetterQueue() error {
 		return fmt.Errorf("failed to bind DLQ: %w", err)
 	}
 
-	// Declare retry queue with TTL
-	retryArgs := amqp.Table{
-		"x-dead-letter-exchange":    ExchangeName,
-		"x-dead-letter-routing-key": TranscodeQueueName,
-		"x-message-ttl":             60000, // 1 minute TTL
-	}
+	// Declare a retry queue with TTL per pool, so retries return to their pool
+	for _, key := range consumedRoutingKeys(nil) {
+		retryArgs := amqp.Table{
+			"x-dead-letter-exchange":    ExchangeName,
+			"x-dead-letter-routing-key": key,
+			"x-message-ttl":             60000, // 1 minute TTL
+		}
 
-	_, err = q.channel.QueueDeclare(
-		RetryQueueName,
-		true,
-		false,
-		false,
-		false,
-		retryArgs,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to declare retry queue: %w", err)
+		_, err = q.channel.QueueDeclare(
+			retryQueueName(key),
+			true,
+			false,
+			false,
+			false,
+			retryArgs,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to declare retry queue: %w", err)
+		}
 	}
 
 	log.Println("Dead letter queue infrastructure set up successfully")
 	return nil
 }
 
+// retryQueueName returns the retry queue feeding the queue of a routing key
+func retryQueueName(routingKey string) string {
+	return RetryQueueName + strings.TrimPrefix(routingKey, TranscodeQueueName)
+}
+
 // PublishJobWithRetry publishes a job with retry support
 func (q *Queue) PublishJobWithRetry(ctx context.Context, job *models.Job, retryCount int) error {
 	body, err := json.Marshal(job)
@@ -89,11 +98,7 @@ func (q *Queue) PublishJobWithRetry(ctx context.Context, job *models.Job, retryC
 		return fmt.Errorf("failed to marshal job: %w", err)
 	}
 
-	// Set priority based on job priority
-	priority := uint8(job.Priority)
-	if priority > 10 {
-		priority = 10
-	}
+	priority := messagePriority(job)
 
 	headers := amqp.Table{
 		"x-retry-count": retryCount,
@@ -101,7 +106,7 @@ func (q *Queue) PublishJobWithRetry(ctx context.Context, job *models.Job, retryC
 
 	err = q.channel.PublishWithContext(ctx,
 		ExchangeName,
-		TranscodeQueueName,
+		PoolRoutingKey(job.Pool),
 		false,
 		false,
 		amqp.Publishing{
@@ -126,21 +131,26 @@ func (q *Queue) PublishToRetryQueue(ctx context.Context, job *models.Job, retryC
 		return q.PublishToDeadLetterQueue(ctx, job, "max retries exceeded")
 	}
 
+	// Calculate exponential backoff delay
+	return q.Retry(ctx, job, retryCount+1, calculateBackoffDelay(retryCount))
+}
+
+// Retry publishes a job to the retry queue, from which it returns to the
+// transcode queue once delay expires. The retry queue caps delays at its
+// one minute message TTL.
+func (q *Queue) Retry(ctx context.Context, job *models.Job, retryCount int, delay time.Duration) error {
 	body, err := json.Marshal(job)
 	if err != nil {
 		return fmt.Errorf("failed to marshal job: %w", err)
 	}
 
 	headers := amqp.Table{
-		"x-retry-count": retryCount + 1,
+		"x-retry-count": retryCount,
 	}
 
-	// Calculate exponential backoff delay
-	delay := calculateBackoffDelay(retryCount)
-
 	err = q.channel.PublishWithContext(ctx,
 		"",
-		RetryQueueName,
+		retryQueueName(PoolRoutingKey(job.Pool)),
 		false,
 		false,
 		amqp.Publishing{
@@ -148,6 +158,7 @@ func (q *Queue) PublishToRetryQueue(ctx context.Context, job *models.Job, retryC
 			ContentType:  "application/json",
 			Body:         body,
 			Timestamp:    time.Now(),
+			Priority:     messagePriority(job),
 			Headers:      headers,
 			Expiration:   fmt.Sprintf("%d", delay.Milliseconds()),
 		},
@@ -156,10 +167,15 @@ func (q *Queue) PublishToRetryQueue(ctx context.Context, job *models.Job, retryC
 		return fmt.Errorf("failed to publish to retry queue: %w", err)
 	}
 
-	log.Printf("Job %s queued for retry #%d in %v", job.ID, retryCount+1, delay)
+	log.Printf("Job %s queued for retry #%d in %v", job.ID, retryCount, delay)
 	return nil
 }
 
+// DeadLetter moves a job to the dead letter queue
+func (q *Queue) DeadLetter(ctx context.Context, job *models.Job, reason string) error {
+	return q.PublishToDeadLetterQueue(ctx, job, reason)
+}
+
 // PublishToDeadLetterQueue publishes a failed job to the dead letter queue
 func (q *Queue) PublishToDeadLetterQueue(ctx context.Context, job *models.Job, reason string) error {
 	body, err := json.Marshal(job)
@@ -170,6 +186,7 @@ func (q *Queue) PublishToDeadLetterQueue(ctx context.Context, job *models.Job, r
 	headers := amqp.Table{
 		"x-failure-reason": reason,
 		"x-failed-at":      time.Now().Format(time.RFC3339),
+		"x-retry-count":    job.RetryCount,
 	}
 
 	err = q.channel.PublishWithContext(ctx,
@@ -180,6 +197,7 @@ func (q *Queue) PublishToDeadLetterQueue(ctx context.Context, job *models.Job, r
 		amqp.Publishing{
 			DeliveryMode: amqp.Persistent,
 			ContentType:  "application/json",
+			MessageId:    uuid.New().String(),
 			Body:         body,
 			Timestamp:    time.Now(),
 			Headers:      headers,
@@ -241,6 +259,81 @@ func (q *Queue) ConsumeDLQ(ctx context.Context, handler func(*models.Job, string
 	return nil
 }
 
+// ListDeadLetters returns the dead letters matching filter, oldest first
+func (q *Queue) ListDeadLetters(ctx context.Context, filter DeadLetterFilter) ([]*DeadLetter, error) {
+	var matched []*DeadLetter
+	err := q.browseDLQ(filter, func(dl *DeadLetter) bool {
+		matched = append(matched, dl)
+		return false
+	})
+	return matched, err
+}
+
+// SettleDeadLetters calls settle for each dead letter matching filter and
+// removes those it returns true for
+func (q *Queue) SettleDeadLetters(ctx context.Context, filter DeadLetterFilter, settle func(*DeadLetter) bool) (int, error) {
+	removed := 0
+	err := q.browseDLQ(filter, func(dl *DeadLetter) bool {
+		if settle(dl) {
+			removed++
+			return true
+		}
+		return false
+	})
+	return removed, err
+}
+
+// browseDLQ gets the dead letter queue's messages on a channel of its own and
+// passes those matching filter to visit, acking the ones it returns true for.
+// Closing the channel returns the rest to the queue. Messages being browsed
+// are not delivered to DLQ consumers meanwhile.
+func (q *Queue) browseDLQ(filter DeadLetterFilter, visit func(*DeadLetter) bool) error {
+	ch, err := q.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open channel: %w", err)
+	}
+	defer ch.Close()
+
+	matched := 0
+	for i := 0; i < maxDeadLetterScan && !filter.full(matched); i++ {
+		msg, ok, err := ch.Get(DeadLetterQueueName, false)
+		if err != nil {
+			return fmt.Errorf("failed to get dead letter: %w", err)
+		}
+		if !ok {
+			break
+		}
+
+		var job models.Job
+		if err := json.Unmarshal(msg.Body, &job); err != nil {
+			log.Printf("Skipping malformed dead letter %d: %v", msg.DeliveryTag, err)
+			continue
+		}
+
+		id := msg.MessageId
+		if id == "" {
+			// Dead lettered before messages carried an ID
+			id = job.ID
+		}
+		reason, _ := msg.Headers["x-failure-reason"].(string)
+
+		dl := newDeadLetter(id, &job, reason, headerInt(msg.Headers, "x-retry-count"), msg.Timestamp)
+
+		if !filter.Match(dl) {
+			continue
+		}
+		matched++
+
+		if visit(dl) {
+			if err := msg.Ack(false); err != nil {
+				return fmt.Errorf("failed to remove dead letter: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
 // RetryFromDLQ retries a job from the dead letter queue
 func (q *Queue) RetryFromDLQ(ctx context.Context, job *models.Job) error {
 	return q.PublishJobWithRetry(ctx, job, 0)
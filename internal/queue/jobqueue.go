@@ -0,0 +1,166 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/config"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// Queue backends
+const (
+	BackendAMQP     = "amqp"
+	BackendPostgres = "postgres"
+	BackendMemory   = "memory"
+)
+
+// WorkerPools are the pools jobs can be routed to
+var WorkerPools = []string{models.WorkerPoolGPU, models.WorkerPoolCPU, models.WorkerPoolLight}
+
+// PoolRoutingKey returns the routing key of a worker pool. Jobs without a
+// pool use the shared TranscodeQueueName key, which every worker consumes.
+func PoolRoutingKey(pool string) string {
+	if pool == "" {
+		return TranscodeQueueName
+	}
+	return TranscodeQueueName + "." + pool
+}
+
+// consumedRoutingKeys returns the routing keys a consumer of pools reads
+func consumedRoutingKeys(pools []string) []string {
+	if len(pools) == 0 {
+		pools = WorkerPools
+	}
+
+	keys := []string{TranscodeQueueName}
+	for _, pool := range pools {
+		keys = append(keys, PoolRoutingKey(pool))
+	}
+	return keys
+}
+
+// Publisher publishes jobs for workers to pick up
+type Publisher interface {
+	PublishJob(ctx context.Context, job *models.Job) error
+}
+
+// DepthReporter reports how many jobs are waiting
+type DepthReporter interface {
+	GetQueueDepth() (int, error)
+	GetDLQDepth() (int, error)
+}
+
+// JobQueue is a job queue backend. Consumers receive deliveries that must be
+// acked, nacked, or handed back with Retry or DeadLetter before being acked.
+type JobQueue interface {
+	Publisher
+	DepthReporter
+	DeadLetterManager
+
+	// Consume delivers jobs to handler one at a time until ctx is cancelled
+	Consume(ctx context.Context, handler func(*Delivery)) error
+
+	// ConsumeJobs consumes jobs, retrying failed ones with exponential backoff
+	// and dead lettering them after MaxRetries
+	ConsumeJobs(ctx context.Context, handler func(*models.Job) error) error
+
+	// Retry publishes job again after delay with the given retry count
+	Retry(ctx context.Context, job *models.Job, retryCount int, delay time.Duration) error
+
+	// DeadLetter moves job to the dead letter queue
+	DeadLetter(ctx context.Context, job *models.Job, reason string) error
+
+	Close() error
+}
+
+// acknowledger settles a delivery with its backend
+type acknowledger interface {
+	ack() error
+	nack(requeue bool) error
+}
+
+// Delivery is a job received from a JobQueue
+type Delivery struct {
+	Job        *models.Job
+	RetryCount int
+	acker      acknowledger
+}
+
+// Ack removes the job from the queue
+func (d *Delivery) Ack() error {
+	return d.acker.ack()
+}
+
+// Nack rejects the job, putting it back on the queue when requeue is set and
+// discarding it otherwise
+func (d *Delivery) Nack(requeue bool) error {
+	return d.acker.nack(requeue)
+}
+
+// Open creates the job queue backend selected in cfg. The Postgres backend
+// uses pool; the other backends ignore it.
+func Open(cfg config.QueueConfig, pool *pgxpool.Pool) (JobQueue, error) {
+	switch cfg.Backend {
+	case "", BackendAMQP:
+		q, err := New(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if err := q.SetupDeadLetterQueue(); err != nil {
+			log.Printf("Warning: Failed to setup DLQ: %v", err)
+		}
+		return q, nil
+	case BackendPostgres:
+		if pool == nil {
+			return nil, fmt.Errorf("postgres queue backend requires a database connection")
+		}
+		return NewPostgresQueue(pool, cfg.PollInterval, cfg.VisibilityTimeout, cfg.Pools...), nil
+	case BackendMemory:
+		return NewMemoryQueue(cfg.Pools...), nil
+	default:
+		return nil, fmt.Errorf("unknown queue backend: %s", cfg.Backend)
+	}
+}
+
+// consumeJobs implements ConsumeJobs on top of Consume for any backend
+func consumeJobs(ctx context.Context, q JobQueue, handler func(*models.Job) error) error {
+	return q.Consume(ctx, func(d *Delivery) {
+		Settle(ctx, q, d, handler(d.Job))
+	})
+}
+
+// Settle finishes a delivery once its job has run. Successful jobs are acked;
+// failed ones are retried with exponential backoff, or dead lettered once out
+// of retries for their failure class, and then acked.
+func Settle(ctx context.Context, q JobQueue, d *Delivery, err error) {
+	if err == nil {
+		if ackErr := d.Ack(); ackErr != nil {
+			log.Printf("Failed to ack job %s: %v", d.Job.ID, ackErr)
+		}
+		return
+	}
+
+	if d.RetryCount >= RetryLimit(ErrorClass(err)) {
+		d.Job.RetryCount = d.RetryCount
+		err = q.DeadLetter(ctx, d.Job, fmt.Sprintf("max retries exceeded: %v", err))
+	} else {
+		err = q.Retry(ctx, d.Job, d.RetryCount+1, calculateBackoffDelay(d.RetryCount))
+	}
+
+	if err != nil {
+		// Hand the job back rather than lose it
+		log.Printf("Failed to reschedule job %s: %v", d.Job.ID, err)
+		if nackErr := d.Nack(true); nackErr != nil {
+			log.Printf("Failed to nack job %s: %v", d.Job.ID, nackErr)
+		}
+		return
+	}
+
+	if ackErr := d.Ack(); ackErr != nil {
+		log.Printf("Failed to ack job %s: %v", d.Job.ID, ackErr)
+	}
+}
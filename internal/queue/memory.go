@@ -0,0 +1,296 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// MemoryQueue is an in-process JobQueue for tests and single-node setups.
+// Jobs are lost when the process exits.
+type MemoryQueue struct {
+	mu      sync.Mutex
+	nextID  int64
+	pending []*memoryMessage
+	dlq     []*memoryMessage
+	notify  chan struct{}
+	keys    map[string]bool // routing keys consumed
+}
+
+// memoryMessage is a job waiting in a MemoryQueue
+type memoryMessage struct {
+	id          int64
+	key         string
+	job         *models.Job
+	retryCount  int
+	reason      string
+	availableAt time.Time
+	locked      bool
+}
+
+// NewMemoryQueue creates an empty in-memory job queue whose consumers receive
+// jobs of the given worker pools, or of all pools when none are given
+func NewMemoryQueue(pools ...string) *MemoryQueue {
+	keys := make(map[string]bool)
+	for _, key := range consumedRoutingKeys(pools) {
+		keys[key] = true
+	}
+
+	return &MemoryQueue{
+		notify: make(chan struct{}, 1),
+		keys:   keys,
+	}
+}
+
+// Close is a no-op for the in-memory queue
+func (q *MemoryQueue) Close() error {
+	return nil
+}
+
+// PublishJob publishes a transcoding job to the queue
+func (q *MemoryQueue) PublishJob(ctx context.Context, job *models.Job) error {
+	q.push(job, 0, time.Now())
+	return nil
+}
+
+// Retry publishes a job again once delay has passed
+func (q *MemoryQueue) Retry(ctx context.Context, job *models.Job, retryCount int, delay time.Duration) error {
+	q.push(job, retryCount, time.Now().Add(delay))
+	return nil
+}
+
+// DeadLetter moves a job to the dead letter queue
+func (q *MemoryQueue) DeadLetter(ctx context.Context, job *models.Job, reason string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.nextID++
+	q.dlq = append(q.dlq, &memoryMessage{
+		id:          q.nextID,
+		job:         job,
+		retryCount:  job.RetryCount,
+		reason:      reason,
+		availableAt: time.Now(),
+	})
+	return nil
+}
+
+// ListDeadLetters returns the dead letters matching filter, oldest first
+func (q *MemoryQueue) ListDeadLetters(ctx context.Context, filter DeadLetterFilter) ([]*DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var matched []*DeadLetter
+	for _, msg := range q.dlq {
+		if filter.full(len(matched)) {
+			break
+		}
+		if dl := msg.deadLetter(); filter.Match(dl) {
+			matched = append(matched, dl)
+		}
+	}
+	return matched, nil
+}
+
+// SettleDeadLetters calls settle for each dead letter matching filter and
+// removes those it returns true for
+func (q *MemoryQueue) SettleDeadLetters(ctx context.Context, filter DeadLetterFilter, settle func(*DeadLetter) bool) (int, error) {
+	matched, err := q.ListDeadLetters(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	remove := make(map[string]bool)
+	for _, dl := range matched {
+		if settle(dl) {
+			remove[dl.ID] = true
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	kept := q.dlq[:0]
+	for _, msg := range q.dlq {
+		if !remove[strconv.FormatInt(msg.id, 10)] {
+			kept = append(kept, msg)
+		}
+	}
+	q.dlq = kept
+	return len(remove), nil
+}
+
+// deadLetter describes a message of the dead letter queue
+func (m *memoryMessage) deadLetter() *DeadLetter {
+	return newDeadLetter(strconv.FormatInt(m.id, 10), m.job, m.reason, m.retryCount, m.availableAt)
+}
+
+// DeadLetters returns the jobs in the dead letter queue
+func (q *MemoryQueue) DeadLetters() []*models.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := make([]*models.Job, 0, len(q.dlq))
+	for _, msg := range q.dlq {
+		jobs = append(jobs, msg.job)
+	}
+	return jobs
+}
+
+func (q *MemoryQueue) push(job *models.Job, retryCount int, availableAt time.Time) {
+	q.mu.Lock()
+	q.nextID++
+	q.pending = append(q.pending, &memoryMessage{
+		id:          q.nextID,
+		key:         PoolRoutingKey(job.Pool),
+		job:         job,
+		retryCount:  retryCount,
+		availableAt: availableAt,
+	})
+	q.mu.Unlock()
+
+	q.wake()
+}
+
+// wake signals a waiting consumer without blocking
+func (q *MemoryQueue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// ConsumeJobs starts consuming jobs from the queue
+func (q *MemoryQueue) ConsumeJobs(ctx context.Context, handler func(*models.Job) error) error {
+	return consumeJobs(ctx, q, handler)
+}
+
+// Consume starts delivering jobs from the queue to handler
+func (q *MemoryQueue) Consume(ctx context.Context, handler func(*Delivery)) error {
+	go func() {
+		for {
+			msg, wait := q.claim()
+			if msg != nil {
+				handler(&Delivery{
+					Job:        msg.job,
+					RetryCount: msg.retryCount,
+					acker:      &memoryAcker{queue: q, id: msg.id},
+				})
+				continue
+			}
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-q.notify:
+			case <-timer.C:
+			}
+			timer.Stop()
+		}
+	}()
+
+	return nil
+}
+
+// claim locks the next available message, highest priority first. When none
+// is available it returns how long to wait before the next delayed message.
+func (q *MemoryQueue) claim() (*memoryMessage, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	wait := time.Minute
+
+	var ready []*memoryMessage
+	for _, msg := range q.pending {
+		if msg.locked || !q.keys[msg.key] {
+			continue
+		}
+		if msg.availableAt.After(now) {
+			if d := msg.availableAt.Sub(now); d < wait {
+				wait = d
+			}
+			continue
+		}
+		ready = append(ready, msg)
+	}
+
+	if len(ready) == 0 {
+		return nil, wait
+	}
+
+	sort.SliceStable(ready, func(i, j int) bool {
+		if ready[i].job.Priority != ready[j].job.Priority {
+			return ready[i].job.Priority > ready[j].job.Priority
+		}
+		return ready[i].id < ready[j].id
+	})
+
+	ready[0].locked = true
+	return ready[0], 0
+}
+
+// settle removes a claimed message, or unlocks it when requeue is set
+func (q *MemoryQueue) settle(id int64, requeue bool) {
+	q.mu.Lock()
+	for i, msg := range q.pending {
+		if msg.id != id {
+			continue
+		}
+		if requeue {
+			msg.locked = false
+		} else {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+		}
+		break
+	}
+	q.mu.Unlock()
+
+	if requeue {
+		q.wake()
+	}
+}
+
+// memoryAcker settles a MemoryQueue delivery
+type memoryAcker struct {
+	queue *MemoryQueue
+	id    int64
+}
+
+func (a *memoryAcker) ack() error {
+	a.queue.settle(a.id, false)
+	return nil
+}
+
+func (a *memoryAcker) nack(requeue bool) error {
+	a.queue.settle(a.id, requeue)
+	return nil
+}
+
+// GetQueueDepth returns the number of jobs waiting in the queue, including delayed retries
+func (q *MemoryQueue) GetQueueDepth() (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	count := 0
+	for _, msg := range q.pending {
+		if !msg.locked {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetDLQDepth returns the number of jobs in the dead letter queue
+func (q *MemoryQueue) GetDLQDepth() (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.dlq), nil
+}
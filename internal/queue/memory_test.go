@@ -0,0 +1,193 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+func receive(t *testing.T, deliveries <-chan *Delivery) *Delivery {
+	t.Helper()
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for delivery")
+		return nil
+	}
+}
+
+func TestMemoryQueuePublishConsumeAck(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := NewMemoryQueue()
+	require.NoError(t, q.PublishJob(ctx, &models.Job{ID: "job-low", Priority: 1}))
+	require.NoError(t, q.PublishJob(ctx, &models.Job{ID: "job-high", Priority: 10}))
+
+	depth, err := q.GetQueueDepth()
+	require.NoError(t, err)
+	assert.Equal(t, 2, depth)
+
+	deliveries := make(chan *Delivery)
+	require.NoError(t, q.Consume(ctx, func(d *Delivery) { deliveries <- d }))
+
+	first := receive(t, deliveries)
+	assert.Equal(t, "job-high", first.Job.ID)
+	require.NoError(t, first.Ack())
+
+	second := receive(t, deliveries)
+	assert.Equal(t, "job-low", second.Job.ID)
+	require.NoError(t, second.Ack())
+
+	depth, err = q.GetQueueDepth()
+	require.NoError(t, err)
+	assert.Equal(t, 0, depth)
+}
+
+func TestMemoryQueueNackRequeue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := NewMemoryQueue()
+	require.NoError(t, q.PublishJob(ctx, &models.Job{ID: "job-1"}))
+
+	deliveries := make(chan *Delivery)
+	require.NoError(t, q.Consume(ctx, func(d *Delivery) { deliveries <- d }))
+
+	d := receive(t, deliveries)
+	require.NoError(t, d.Nack(true))
+
+	d = receive(t, deliveries)
+	assert.Equal(t, "job-1", d.Job.ID)
+	require.NoError(t, d.Nack(false))
+
+	depth, err := q.GetQueueDepth()
+	require.NoError(t, err)
+	assert.Equal(t, 0, depth)
+}
+
+func TestMemoryQueueRetryDelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := NewMemoryQueue()
+	start := time.Now()
+	require.NoError(t, q.Retry(ctx, &models.Job{ID: "job-1"}, 2, 100*time.Millisecond))
+
+	deliveries := make(chan *Delivery)
+	require.NoError(t, q.Consume(ctx, func(d *Delivery) { deliveries <- d }))
+
+	d := receive(t, deliveries)
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	assert.Equal(t, 2, d.RetryCount)
+	require.NoError(t, d.Ack())
+}
+
+func TestMemoryQueueConsumeJobs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := NewMemoryQueue()
+	require.NoError(t, q.PublishJob(ctx, &models.Job{ID: "job-retry"}))
+	require.NoError(t, q.Retry(ctx, &models.Job{ID: "job-dead"}, MaxRetries, 0))
+
+	handled := make(chan string, 2)
+	require.NoError(t, q.ConsumeJobs(ctx, func(job *models.Job) error {
+		handled <- job.ID
+		return errors.New("transcode failed")
+	}))
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-handled:
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for jobs")
+		}
+	}
+
+	// The first failure is rescheduled with backoff, the exhausted job is dead lettered
+	assert.Eventually(t, func() bool {
+		dlq, _ := q.GetDLQDepth()
+		return dlq == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	depth, err := q.GetQueueDepth()
+	require.NoError(t, err)
+	assert.Equal(t, 1, depth)
+
+	dead := q.DeadLetters()
+	require.Len(t, dead, 1)
+	assert.Equal(t, "job-dead", dead[0].ID)
+}
+
+func TestMemoryQueuePools(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := NewMemoryQueue(models.WorkerPoolGPU)
+	require.NoError(t, q.PublishJob(ctx, &models.Job{ID: "job-light", Pool: models.WorkerPoolLight}))
+	require.NoError(t, q.PublishJob(ctx, &models.Job{ID: "job-gpu", Pool: models.WorkerPoolGPU}))
+	require.NoError(t, q.PublishJob(ctx, &models.Job{ID: "job-shared"}))
+
+	deliveries := make(chan *Delivery, 3)
+	require.NoError(t, q.Consume(ctx, func(d *Delivery) {
+		deliveries <- d
+		d.Ack()
+	}))
+
+	got := []string{receive(t, deliveries).Job.ID, receive(t, deliveries).Job.ID}
+	assert.ElementsMatch(t, []string{"job-gpu", "job-shared"}, got)
+
+	// The light job waits for a light pool consumer
+	depth, err := q.GetQueueDepth()
+	require.NoError(t, err)
+	assert.Equal(t, 1, depth)
+}
+
+func TestPoolRoutingKey(t *testing.T) {
+	assert.Equal(t, TranscodeQueueName, PoolRoutingKey(""))
+	assert.Equal(t, "transcode_jobs.gpu", PoolRoutingKey(models.WorkerPoolGPU))
+	assert.Equal(t, "transcode_jobs_priority.gpu", poolQueueName(PoolRoutingKey(models.WorkerPoolGPU)))
+	assert.Equal(t, "transcode_jobs_retry", retryQueueName(TranscodeQueueName))
+}
+
+func TestMemoryQueueDeadLetters(t *testing.T) {
+	ctx := context.Background()
+
+	q := NewMemoryQueue()
+	require.NoError(t, q.DeadLetter(ctx, &models.Job{ID: "job-timeout", RetryCount: MaxRetries}, "max retries exceeded: context deadline exceeded"))
+	require.NoError(t, q.DeadLetter(ctx, &models.Job{ID: "job-input"}, "ffprobe: invalid data found when processing input"))
+	require.NoError(t, q.DeadLetter(ctx, &models.Job{ID: "job-cancelled"}, "context deadline exceeded"))
+
+	all, err := q.ListDeadLetters(ctx, DeadLetterFilter{})
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+	assert.Equal(t, FailureClassTimeout, all[0].ErrorClass)
+	assert.Equal(t, MaxRetries, all[0].RetryCount)
+	assert.Equal(t, FailureClassInput, all[1].ErrorClass)
+
+	limited, err := q.ListDeadLetters(ctx, DeadLetterFilter{ErrorClass: FailureClassTimeout, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, limited, 1)
+	assert.Equal(t, "job-timeout", limited[0].Job.ID)
+
+	// Only messages settle returns true for are removed
+	var seen []string
+	removed, err := q.SettleDeadLetters(ctx, DeadLetterFilter{ErrorClass: FailureClassTimeout}, func(dl *DeadLetter) bool {
+		seen = append(seen, dl.Job.ID)
+		return dl.Job.ID != "job-cancelled"
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, []string{"job-timeout", "job-cancelled"}, seen)
+
+	depth, err := q.GetDLQDepth()
+	require.NoError(t, err)
+	assert.Equal(t, 2, depth)
+}
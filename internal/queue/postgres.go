@@ -0,0 +1,305 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// PostgresQueue is a JobQueue backed by the job_queue table. Consumers claim
+// messages with SELECT ... FOR UPDATE SKIP LOCKED, so any number of workers
+// can share the table without a broker.
+type PostgresQueue struct {
+	pool              *pgxpool.Pool
+	pollInterval      time.Duration
+	visibilityTimeout time.Duration
+	pools             []string
+}
+
+// NewPostgresQueue creates a Postgres job queue. Claimed messages become
+// visible to other consumers again if not settled within visibilityTimeout.
+// Consumers only receive jobs of the given worker pools, or of all pools when none are given.
+func NewPostgresQueue(pool *pgxpool.Pool, pollInterval, visibilityTimeout time.Duration, pools ...string) *PostgresQueue {
+	if pollInterval <= 0 {
+		pollInterval = time.Second
+	}
+	if visibilityTimeout <= 0 {
+		visibilityTimeout = time.Hour
+	}
+
+	return &PostgresQueue{
+		pool:              pool,
+		pollInterval:      pollInterval,
+		visibilityTimeout: visibilityTimeout,
+		pools:             pools,
+	}
+}
+
+// Close is a no-op; the connection pool is owned by the caller
+func (q *PostgresQueue) Close() error {
+	return nil
+}
+
+// PublishJob publishes a transcoding job to the queue
+func (q *PostgresQueue) PublishJob(ctx context.Context, job *models.Job) error {
+	return q.insert(ctx, PoolRoutingKey(job.Pool), job, 0, "", time.Now())
+}
+
+// Retry publishes a job again once delay has passed
+func (q *PostgresQueue) Retry(ctx context.Context, job *models.Job, retryCount int, delay time.Duration) error {
+	if err := q.insert(ctx, PoolRoutingKey(job.Pool), job, retryCount, "", time.Now().Add(delay)); err != nil {
+		return err
+	}
+
+	log.Printf("Job %s queued for retry #%d in %v", job.ID, retryCount, delay)
+	return nil
+}
+
+// DeadLetter moves a job to the dead letter queue
+func (q *PostgresQueue) DeadLetter(ctx context.Context, job *models.Job, reason string) error {
+	if err := q.insert(ctx, DeadLetterQueueName, job, job.RetryCount, reason, time.Now()); err != nil {
+		return err
+	}
+
+	log.Printf("Job %s moved to dead letter queue: %s", job.ID, reason)
+	return nil
+}
+
+// ListDeadLetters returns the dead letters matching filter, oldest first
+func (q *PostgresQueue) ListDeadLetters(ctx context.Context, filter DeadLetterFilter) ([]*DeadLetter, error) {
+	rows, err := q.pool.Query(ctx, deadLetterQuery, DeadLetterQueueName, maxDeadLetterScan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+	defer rows.Close()
+
+	return scanDeadLetters(rows, filter)
+}
+
+// SettleDeadLetters calls settle for each dead letter matching filter and
+// removes those it returns true for. Matching rows stay locked meanwhile, so
+// concurrent calls do not settle the same dead letter twice.
+func (q *PostgresQueue) SettleDeadLetters(ctx context.Context, filter DeadLetterFilter, settle func(*DeadLetter) bool) (int, error) {
+	tx, err := q.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, deadLetterQuery+" FOR UPDATE SKIP LOCKED", DeadLetterQueueName, maxDeadLetterScan)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+	matched, err := scanDeadLetters(rows, filter)
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	var remove []int64
+	for _, dl := range matched {
+		if settle(dl) {
+			id, _ := strconv.ParseInt(dl.ID, 10, 64)
+			remove = append(remove, id)
+		}
+	}
+
+	if len(remove) > 0 {
+		if _, err := tx.Exec(ctx, "DELETE FROM job_queue WHERE id = ANY($1)", remove); err != nil {
+			return 0, fmt.Errorf("failed to remove dead letters: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return len(remove), nil
+}
+
+// deadLetterQuery selects the messages of the dead letter queue, oldest first
+const deadLetterQuery = `
+	SELECT id, payload, retry_count, COALESCE(failure_reason, ''), created_at
+	FROM job_queue
+	WHERE queue_name = $1
+	ORDER BY id ASC
+	LIMIT $2`
+
+// scanDeadLetters reads the rows of deadLetterQuery that match filter
+func scanDeadLetters(rows pgx.Rows, filter DeadLetterFilter) ([]*DeadLetter, error) {
+	var matched []*DeadLetter
+	for rows.Next() {
+		var id int64
+		var body []byte
+		var retryCount int
+		var reason string
+		var failedAt time.Time
+		if err := rows.Scan(&id, &body, &retryCount, &reason, &failedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan dead letter: %w", err)
+		}
+
+		var job models.Job
+		if err := json.Unmarshal(body, &job); err != nil {
+			log.Printf("Skipping malformed dead letter %d: %v", id, err)
+			continue
+		}
+
+		dl := newDeadLetter(strconv.FormatInt(id, 10), &job, reason, retryCount, failedAt)
+		if filter.Match(dl) && !filter.full(len(matched)) {
+			matched = append(matched, dl)
+		}
+	}
+
+	return matched, rows.Err()
+}
+
+// insert adds a message to a queue
+func (q *PostgresQueue) insert(ctx context.Context, queueName string, job *models.Job, retryCount int, reason string, availableAt time.Time) error {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	query := `
+		INSERT INTO job_queue (queue_name, job_id, payload, priority, retry_count, failure_reason, available_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)
+	`
+
+	if _, err := q.pool.Exec(ctx, query, queueName, job.ID, body, job.Priority, retryCount, reason, availableAt); err != nil {
+		return fmt.Errorf("failed to publish job: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeJobs starts consuming jobs from the queue
+func (q *PostgresQueue) ConsumeJobs(ctx context.Context, handler func(*models.Job) error) error {
+	return consumeJobs(ctx, q, handler)
+}
+
+// Consume starts delivering jobs from the queue to handler
+func (q *PostgresQueue) Consume(ctx context.Context, handler func(*Delivery)) error {
+	go func() {
+		ticker := time.NewTicker(q.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			// Drain everything available before waiting for the next poll
+			for ctx.Err() == nil {
+				delivery, err := q.claim(ctx, consumedRoutingKeys(q.pools))
+				if err != nil {
+					if ctx.Err() == nil {
+						log.Printf("Failed to claim job: %v", err)
+					}
+					break
+				}
+				if delivery == nil {
+					break
+				}
+				handler(delivery)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return nil
+}
+
+// claim locks the next available message of the given queues, or returns nil when they are empty
+func (q *PostgresQueue) claim(ctx context.Context, queueNames []string) (*Delivery, error) {
+	query := `
+		UPDATE job_queue
+		SET locked_until = NOW() + $2 * INTERVAL '1 second'
+		WHERE id = (
+			SELECT id FROM job_queue
+			WHERE queue_name = ANY($1)
+			AND available_at <= NOW()
+			AND (locked_until IS NULL OR locked_until < NOW())
+			ORDER BY priority DESC, available_at ASC, id ASC
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING id, payload, retry_count
+	`
+
+	var id int64
+	var body []byte
+	var retryCount int
+	err := q.pool.QueryRow(ctx, query, queueNames, q.visibilityTimeout.Seconds()).Scan(&id, &body, &retryCount)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var job models.Job
+	if err := json.Unmarshal(body, &job); err != nil {
+		// Drop messages that can never be processed
+		log.Printf("Discarding malformed queue message %d: %v", id, err)
+		acker := &postgresAcker{queue: q, id: id}
+		return nil, acker.nack(false)
+	}
+
+	return &Delivery{
+		Job:        &job,
+		RetryCount: retryCount,
+		acker:      &postgresAcker{queue: q, id: id},
+	}, nil
+}
+
+// postgresAcker settles a claimed job_queue row
+type postgresAcker struct {
+	queue *PostgresQueue
+	id    int64
+}
+
+func (a *postgresAcker) ack() error {
+	if _, err := a.queue.pool.Exec(context.Background(), "DELETE FROM job_queue WHERE id = $1", a.id); err != nil {
+		return fmt.Errorf("failed to ack job: %w", err)
+	}
+	return nil
+}
+
+func (a *postgresAcker) nack(requeue bool) error {
+	if !requeue {
+		return a.ack()
+	}
+	if _, err := a.queue.pool.Exec(context.Background(), "UPDATE job_queue SET locked_until = NULL WHERE id = $1", a.id); err != nil {
+		return fmt.Errorf("failed to nack job: %w", err)
+	}
+	return nil
+}
+
+// GetQueueDepth returns the number of jobs waiting in all pools, including delayed retries
+func (q *PostgresQueue) GetQueueDepth() (int, error) {
+	return q.depth(consumedRoutingKeys(nil))
+}
+
+// GetDLQDepth returns the number of jobs in the dead letter queue
+func (q *PostgresQueue) GetDLQDepth() (int, error) {
+	return q.depth([]string{DeadLetterQueueName})
+}
+
+func (q *PostgresQueue) depth(queueNames []string) (int, error) {
+	var count int
+	err := q.pool.QueryRow(context.Background(),
+		"SELECT COUNT(*) FROM job_queue WHERE queue_name = ANY($1) AND (locked_until IS NULL OR locked_until < NOW())",
+		queueNames,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count queue: %w", err)
+	}
+	return count, nil
+}
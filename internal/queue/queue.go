@@ -3,7 +3,10 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -14,12 +17,28 @@ import (
 const (
 	TranscodeQueueName = "transcode_jobs"
 	ExchangeName       = "transcode"
+
+	// PriorityQueueName is the AMQP queue consumed by workers. It is bound
+	// with the TranscodeQueueName routing key and declared with x-max-priority,
+	// which a queue cannot gain after creation, so it replaces the original
+	// transcode_jobs queue.
+	PriorityQueueName = "transcode_jobs_priority"
+
+	// MaxPriority is the highest message priority honoured by the broker
+	MaxPriority = 10
 )
 
-// Queue provides message queue operations
+// Queue is the RabbitMQ JobQueue backend
 type Queue struct {
-	conn    *amqp.Connection
-	channel *amqp.Channel
+	conn     *amqp.Connection
+	channel  *amqp.Channel
+	pools    []string
+	prefetch int
+}
+
+// poolQueueName returns the AMQP queue holding a worker pool's jobs
+func poolQueueName(routingKey string) string {
+	return PriorityQueueName + strings.TrimPrefix(routingKey, TranscodeQueueName)
 }
 
 // New creates a new queue client
@@ -54,41 +73,122 @@ func New(cfg config.QueueConfig) (*Queue, error) {
 		return nil, fmt.Errorf("failed to declare exchange: %w", err)
 	}
 
-	// Declare queue
-	_, err = channel.QueueDeclare(
-		TranscodeQueueName,
-		true,  // durable
-		false, // delete when unused
-		false, // exclusive
-		false, // no-wait
-		nil,   // arguments
-	)
-	if err != nil {
-		channel.Close()
-		conn.Close()
-		return nil, fmt.Errorf("failed to declare queue: %w", err)
+	// Declare the shared queue and one queue per worker pool
+	for _, key := range consumedRoutingKeys(nil) {
+		_, err = channel.QueueDeclare(
+			poolQueueName(key),
+			true,  // durable
+			false, // delete when unused
+			false, // exclusive
+			false, // no-wait
+			amqp.Table{"x-max-priority": MaxPriority},
+		)
+		if err != nil {
+			channel.Close()
+			conn.Close()
+			return nil, fmt.Errorf("failed to declare queue: %w", err)
+		}
+
+		// Bind queue to exchange
+		err = channel.QueueBind(
+			poolQueueName(key),
+			key,
+			ExchangeName,
+			false,
+			nil,
+		)
+		if err != nil {
+			channel.Close()
+			conn.Close()
+			return nil, fmt.Errorf("failed to bind queue: %w", err)
+		}
 	}
 
-	// Bind queue to exchange
-	err = channel.QueueBind(
-		TranscodeQueueName,
-		TranscodeQueueName,
-		ExchangeName,
-		false,
-		nil,
-	)
-	if err != nil {
-		channel.Close()
-		conn.Close()
-		return nil, fmt.Errorf("failed to bind queue: %w", err)
+	if err := migrateLegacyQueue(conn); err != nil {
+		log.Printf("Warning: Failed to migrate legacy queue %s: %v", TranscodeQueueName, err)
+	}
+
+	prefetch := cfg.Prefetch
+	if prefetch < 1 {
+		prefetch = 1
 	}
 
 	return &Queue{
-		conn:    conn,
-		channel: channel,
+		conn:     conn,
+		channel:  channel,
+		pools:    cfg.Pools,
+		prefetch: prefetch,
 	}, nil
 }
 
+// migrateLegacyQueue moves jobs left in the transcode_jobs queue, which was
+// declared without priorities, onto the priority queue. The legacy queue is
+// unbound first and deleted once drained and no old worker consumes it.
+func migrateLegacyQueue(conn *amqp.Connection) error {
+	// Failed passive declares and conditional deletes close the channel, so
+	// the migration runs on its own
+	channel, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open channel: %w", err)
+	}
+	defer channel.Close()
+
+	if _, err := channel.QueueDeclarePassive(TranscodeQueueName, true, false, false, false, nil); err != nil {
+		var amqpErr *amqp.Error
+		if errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+			return nil
+		}
+		return fmt.Errorf("failed to inspect legacy queue: %w", err)
+	}
+
+	if err := channel.QueueUnbind(TranscodeQueueName, TranscodeQueueName, ExchangeName, nil); err != nil {
+		return fmt.Errorf("failed to unbind legacy queue: %w", err)
+	}
+
+	moved := 0
+	for {
+		msg, ok, err := channel.Get(TranscodeQueueName, false)
+		if err != nil {
+			return fmt.Errorf("failed to read legacy queue: %w", err)
+		}
+		if !ok {
+			break
+		}
+
+		err = channel.PublishWithContext(context.Background(),
+			ExchangeName,
+			TranscodeQueueName,
+			false, // mandatory
+			false, // immediate
+			amqp.Publishing{
+				DeliveryMode: amqp.Persistent,
+				ContentType:  msg.ContentType,
+				Body:         msg.Body,
+				Timestamp:    msg.Timestamp,
+				Priority:     msg.Priority,
+				Headers:      msg.Headers,
+			},
+		)
+		if err != nil {
+			msg.Nack(false, true)
+			return fmt.Errorf("failed to move job to priority queue: %w", err)
+		}
+		msg.Ack(false)
+		moved++
+	}
+
+	if moved > 0 {
+		log.Printf("Moved %d jobs from %s to %s", moved, TranscodeQueueName, PriorityQueueName)
+	}
+
+	if _, err := channel.QueueDelete(TranscodeQueueName, true, true, false); err != nil {
+		return fmt.Errorf("legacy queue still in use, will retry on next start: %w", err)
+	}
+
+	log.Printf("Removed legacy queue %s", TranscodeQueueName)
+	return nil
+}
+
 // Close closes the queue connection
 func (q *Queue) Close() error {
 	if q.channel != nil {
@@ -107,15 +207,11 @@ func (q *Queue) PublishJob(ctx context.Context, job *models.Job) error {
 		return fmt.Errorf("failed to marshal job: %w", err)
 	}
 
-	// Set priority based on job priority
-	priority := uint8(job.Priority)
-	if priority > 10 {
-		priority = 10
-	}
+	priority := messagePriority(job)
 
 	err = q.channel.PublishWithContext(ctx,
 		ExchangeName,
-		TranscodeQueueName,
+		PoolRoutingKey(job.Pool),
 		false, // mandatory
 		false, // immediate
 		amqp.Publishing{
@@ -133,53 +229,93 @@ func (q *Queue) PublishJob(ctx context.Context, job *models.Job) error {
 	return nil
 }
 
+// messagePriority maps a job priority onto the broker's priority range
+func messagePriority(job *models.Job) uint8 {
+	if job.Priority <= 0 {
+		return 0
+	}
+	if job.Priority > MaxPriority {
+		return MaxPriority
+	}
+	return uint8(job.Priority)
+}
+
 // ConsumeJobs starts consuming jobs from the queue
 func (q *Queue) ConsumeJobs(ctx context.Context, handler func(*models.Job) error) error {
-	// Set QoS to limit concurrent processing
+	return consumeJobs(ctx, q, handler)
+}
+
+// Consume starts delivering jobs from the shared queue and the queues of the
+// configured worker pools to handler
+func (q *Queue) Consume(ctx context.Context, handler func(*Delivery)) error {
+	// Set QoS to limit concurrent processing across all consumed queues
 	err := q.channel.Qos(
-		1,     // prefetch count
-		0,     // prefetch size
-		false, // global
+		q.prefetch, // prefetch count
+		0,          // prefetch size
+		true,       // global
 	)
 	if err != nil {
 		return fmt.Errorf("failed to set QoS: %w", err)
 	}
 
-	msgs, err := q.channel.Consume(
-		TranscodeQueueName,
-		"",    // consumer
-		false, // auto-ack
-		false, // exclusive
-		false, // no-local
-		false, // no-wait
-		nil,   // args
-	)
-	if err != nil {
-		return fmt.Errorf("failed to register consumer: %w", err)
+	merged := make(chan amqp.Delivery)
+	var tags []string
+	for _, key := range consumedRoutingKeys(q.pools) {
+		tag := fmt.Sprintf("%s-%d", poolQueueName(key), len(tags))
+		msgs, err := q.channel.Consume(
+			poolQueueName(key),
+			tag,   // consumer
+			false, // auto-ack
+			false, // exclusive
+			false, // no-local
+			false, // no-wait
+			nil,   // args
+		)
+		if err != nil {
+			return fmt.Errorf("failed to register consumer: %w", err)
+		}
+		tags = append(tags, tag)
+
+		go func() {
+			for msg := range msgs {
+				select {
+				case merged <- msg:
+				case <-ctx.Done():
+					// Hand prefetched messages back until the broker closes the consumer
+					msg.Nack(false, true)
+				}
+			}
+		}()
 	}
 
+	// Stop the broker deliveries when ctx is cancelled so a draining worker
+	// holds no messages it will not process
+	go func() {
+		<-ctx.Done()
+		for _, tag := range tags {
+			if err := q.channel.Cancel(tag, false); err != nil {
+				log.Printf("Failed to cancel consumer %s: %v", tag, err)
+			}
+		}
+	}()
+
 	go func() {
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case msg, ok := <-msgs:
-				if !ok {
-					return
-				}
-
+			case msg := <-merged:
 				var job models.Job
 				if err := json.Unmarshal(msg.Body, &job); err != nil {
 					msg.Nack(false, false)
 					continue
 				}
 
-				if err := handler(&job); err != nil {
-					// Requeue the message with a delay
-					msg.Nack(false, true)
-				} else {
-					msg.Ack(false)
-				}
+				handler(&Delivery{
+					Job:        &job,
+					RetryCount: headerInt(msg.Headers, "x-retry-count"),
+					acker:      amqpAcker{msg: msg},
+				})
 			}
 		}
 	}()
@@ -187,12 +323,53 @@ func (q *Queue) ConsumeJobs(ctx context.Context, handler func(*models.Job) error
 	return nil
 }
 
-// GetQueueDepth returns the number of messages in the queue
+// amqpAcker settles a RabbitMQ delivery
+type amqpAcker struct {
+	msg amqp.Delivery
+}
+
+func (a amqpAcker) ack() error {
+	return a.msg.Ack(false)
+}
+
+func (a amqpAcker) nack(requeue bool) error {
+	return a.msg.Nack(false, requeue)
+}
+
+// headerInt reads an integer message header, which may arrive as any integer type
+func headerInt(headers amqp.Table, key string) int {
+	switch v := headers[key].(type) {
+	case int:
+		return v
+	case int8:
+		return int(v)
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case uint8:
+		return int(v)
+	case uint16:
+		return int(v)
+	case uint32:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+// GetQueueDepth returns the number of messages waiting in all pools
 func (q *Queue) GetQueueDepth() (int, error) {
-	info, err := q.channel.QueueInspect(TranscodeQueueName)
-	if err != nil {
-		return 0, fmt.Errorf("failed to inspect queue: %w", err)
+	depth := 0
+	for _, key := range consumedRoutingKeys(nil) {
+		info, err := q.channel.QueueInspect(poolQueueName(key))
+		if err != nil {
+			return 0, fmt.Errorf("failed to inspect queue: %w", err)
+		}
+		depth += info.Messages
 	}
 
-	return info.Messages, nil
+	return depth, nil
 }
@@ -0,0 +1,76 @@
+package rtmp
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// CallbackHandler serves the publish callbacks of the RTMP front end, in the
+// form nginx-rtmp's on_publish and on_publish_done send them. The stream key
+// is the "name" form field.
+func (s *Server) CallbackHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/on_publish", s.handlePublish)
+	mux.HandleFunc("/on_publish_done", s.handlePublishDone)
+	return mux
+}
+
+// handlePublish starts or resumes the stream of a new publisher. Publishers of
+// streams served by another node are redirected there.
+func (s *Server) handlePublish(w http.ResponseWriter, r *http.Request) {
+	streamKey := r.FormValue("name")
+	if streamKey == "" {
+		http.Error(w, "missing stream key", http.StatusBadRequest)
+		return
+	}
+
+	err := s.StartStream(r.Context(), streamKey)
+	var redirect *RedirectError
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+	case errors.As(err, &redirect):
+		http.Redirect(w, r, redirect.URL, http.StatusFound)
+	default:
+		log.Printf("Rejected publish of stream key %s: %v", streamKey, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+	}
+}
+
+// handlePublishDone records the publisher going away. The stream keeps
+// running until the reconnect grace period expires.
+func (s *Server) handlePublishDone(w http.ResponseWriter, r *http.Request) {
+	streamKey := r.FormValue("name")
+	if streamKey == "" {
+		http.Error(w, "missing stream key", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.DisconnectStream(r.Context(), streamKey); err != nil {
+		log.Printf("Failed to disconnect stream key %s: %v", streamKey, err)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// serveCallbacks listens for publish callbacks until ctx is cancelled
+func (s *Server) serveCallbacks(ctx context.Context) {
+	srv := &http.Server{
+		Addr:    s.callbackAddr,
+		Handler: s.CallbackHandler(),
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Listening for RTMP publish callbacks on %s", s.callbackAddr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("RTMP callback server failed: %v", err)
+	}
+}
@@ -0,0 +1,290 @@
+package rtmp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// ErrNoCapacity is returned when no live node can take another stream
+var ErrNoCapacity = errors.New("no live node has capacity for the stream")
+
+// RedirectError is returned when a stream is owned by, or placed on, another
+// live node. The RTMP front end should redirect the publisher to URL.
+type RedirectError struct {
+	StreamKey string
+	NodeID    string
+	URL       string
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("stream %s is served by live node %s, redirect to %s", e.StreamKey, e.NodeID, e.URL)
+}
+
+// SelectNode picks the live node with the most headroom for a new stream.
+// Nodes at their stream limit or above maxCPULoad are skipped; ties go to the
+// lowest node ID so every node reaches the same decision.
+func SelectNode(nodes []*models.LiveNode, maxCPULoad float64) *models.LiveNode {
+	var best *models.LiveNode
+	bestUtilization := 0.0
+
+	for _, node := range nodes {
+		if node.MaxStreams <= 0 || node.ActiveStreams >= node.MaxStreams {
+			continue
+		}
+		if maxCPULoad > 0 && node.CPULoad >= maxCPULoad {
+			continue
+		}
+
+		utilization := float64(node.ActiveStreams) / float64(node.MaxStreams)
+		if node.CPULoad > utilization {
+			utilization = node.CPULoad
+		}
+
+		if best == nil || utilization < bestUtilization || (utilization == bestUtilization && node.ID < best.ID) {
+			best = node
+			bestUtilization = utilization
+		}
+	}
+
+	return best
+}
+
+// localNode describes this node with its current load
+func (s *Server) localNode() *models.LiveNode {
+	s.mu.RLock()
+	active := len(s.activeStreams)
+	s.mu.RUnlock()
+
+	return &models.LiveNode{
+		ID:            s.nodeID,
+		Host:          s.advertiseHost,
+		RTMPPort:      s.port,
+		MaxStreams:    s.maxStreams,
+		ActiveStreams: active,
+		CPUCount:      runtime.NumCPU(),
+		CPULoad:       readCPULoad(),
+	}
+}
+
+// liveNodes returns the nodes with a live heartbeat, with this node's entry
+// replaced by its current state
+func (s *Server) liveNodes(ctx context.Context) ([]*models.LiveNode, error) {
+	nodes, err := s.repo.ListLiveNodes(ctx, time.Now().Add(-s.leaseTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	local := s.localNode()
+	for i, node := range nodes {
+		if node.ID == s.nodeID {
+			nodes[i] = local
+			return nodes, nil
+		}
+	}
+	return append(nodes, local), nil
+}
+
+// placeStream decides which node serves a stream. It acquires the lease when
+// the stream belongs on this node and returns a *RedirectError otherwise.
+func (s *Server) placeStream(ctx context.Context, stream *models.LiveStream) (*models.LiveStreamLease, error) {
+	lease, err := s.repo.GetLiveStreamLease(ctx, stream.ID)
+	owned := err == nil && lease.ExpiresAt.After(time.Now())
+
+	if owned && lease.NodeID != s.nodeID {
+		return nil, s.redirect(ctx, stream.StreamKey, lease.NodeID)
+	}
+
+	if !owned {
+		nodes, err := s.liveNodes(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list live nodes: %w", err)
+		}
+
+		target := SelectNode(nodes, s.maxCPULoad)
+		if target == nil {
+			return nil, ErrNoCapacity
+		}
+		if target.ID != s.nodeID {
+			return nil, &RedirectError{StreamKey: stream.StreamKey, NodeID: target.ID, URL: target.IngestURL(stream.StreamKey)}
+		}
+	}
+
+	lease, acquired, err := s.repo.AcquireLiveStreamLease(ctx, stream.ID, s.nodeID, s.leaseTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		// Another node won the race for the stream
+		return nil, s.redirect(ctx, stream.StreamKey, lease.NodeID)
+	}
+
+	return lease, nil
+}
+
+// redirect builds the redirect to the node owning a stream
+func (s *Server) redirect(ctx context.Context, streamKey, nodeID string) error {
+	node, err := s.repo.GetLiveNode(ctx, nodeID)
+	if err != nil {
+		return fmt.Errorf("stream %s is owned by unknown live node %s: %w", streamKey, nodeID, err)
+	}
+	return &RedirectError{StreamKey: streamKey, NodeID: nodeID, URL: node.IngestURL(streamKey)}
+}
+
+// runHeartbeat registers the node and renews its stream leases until ctx is cancelled
+func (s *Server) runHeartbeat(ctx context.Context) {
+	ticker := time.NewTicker(s.leaseTTL / 3)
+	defer ticker.Stop()
+
+	s.heartbeat(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.heartbeat(ctx)
+		}
+	}
+}
+
+// heartbeat publishes this node's load and renews the leases it holds. Streams
+// whose lease was taken over by another node are stopped locally.
+func (s *Server) heartbeat(ctx context.Context) {
+	if err := s.repo.UpsertLiveNode(ctx, s.localNode()); err != nil {
+		log.Printf("Failed to send live node heartbeat: %v", err)
+		return
+	}
+
+	renewedAt := time.Now()
+	owned, err := s.repo.RenewLiveStreamLeases(ctx, s.nodeID, s.leaseTTL)
+	if err != nil {
+		log.Printf("Failed to renew live stream leases: %v", err)
+		return
+	}
+
+	ownedSet := make(map[string]bool, len(owned))
+	for _, streamID := range owned {
+		ownedSet[streamID] = true
+	}
+
+	s.mu.RLock()
+	var lost []string
+	for key, handler := range s.activeStreams {
+		// Streams started during the renewal may not be in the result yet
+		if !ownedSet[handler.LiveStreamID] && handler.startTime.Before(renewedAt) {
+			lost = append(lost, key)
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, key := range lost {
+		s.abandonStream(key)
+	}
+}
+
+// abandonStream stops the local transcode of a stream now owned by another
+// node, leaving its status untouched
+func (s *Server) abandonStream(streamKey string) {
+	s.mu.Lock()
+	handler, exists := s.activeStreams[streamKey]
+	if !exists {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.activeStreams, streamKey)
+	if handler.graceTimer != nil {
+		handler.graceTimer.Stop()
+	}
+	s.mu.Unlock()
+
+	handler.cancel()
+	log.Printf("Lost ownership of live stream %s to another node, stopped local transcode", handler.LiveStreamID)
+}
+
+// runOrphanRecovery periodically adopts streams whose owning node died
+func (s *Server) runOrphanRecovery(ctx context.Context) {
+	ticker := time.NewTicker(s.leaseTTL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.recoverOrphans(ctx)
+		}
+	}
+}
+
+// recoverOrphans adopts the orphaned streams that placement assigns to this node
+func (s *Server) recoverOrphans(ctx context.Context) {
+	streamIDs, err := s.repo.ListOrphanedLiveStreams(ctx)
+	if err != nil {
+		log.Printf("Failed to list orphaned live streams: %v", err)
+		return
+	}
+
+	for _, streamID := range streamIDs {
+		nodes, err := s.liveNodes(ctx)
+		if err != nil {
+			log.Printf("Failed to list live nodes: %v", err)
+			return
+		}
+
+		target := SelectNode(nodes, s.maxCPULoad)
+		if target == nil || target.ID != s.nodeID {
+			continue
+		}
+
+		stream, err := s.repo.GetLiveStream(ctx, streamID)
+		if err != nil {
+			log.Printf("Failed to get orphaned live stream %s: %v", streamID, err)
+			continue
+		}
+
+		previous, _ := s.repo.GetLiveStreamLease(ctx, streamID)
+
+		lease, acquired, err := s.repo.AcquireLiveStreamLease(ctx, streamID, s.nodeID, s.leaseTTL)
+		if err != nil {
+			log.Printf("Failed to acquire lease for orphaned live stream %s: %v", streamID, err)
+			continue
+		}
+		if !acquired {
+			continue
+		}
+
+		if err := s.adoptStream(ctx, stream, lease, previous); err != nil {
+			log.Printf("Failed to adopt orphaned live stream %s: %v", streamID, err)
+			if err := s.repo.ReleaseLiveStreamLease(ctx, streamID, s.nodeID); err != nil {
+				log.Printf("Failed to release lease for live stream %s: %v", streamID, err)
+			}
+		}
+	}
+}
+
+// readCPULoad returns the 1 minute load average per core, or 0 when unavailable
+func readCPULoad() float64 {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0
+	}
+
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+	return load / float64(runtime.NumCPU())
+}
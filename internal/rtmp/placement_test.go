@@ -0,0 +1,77 @@
+package rtmp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+func TestSelectNode(t *testing.T) {
+	tests := []struct {
+		name     string
+		nodes    []*models.LiveNode
+		expected string
+	}{
+		{
+			name: "least utilized node",
+			nodes: []*models.LiveNode{
+				{ID: "node-a", MaxStreams: 10, ActiveStreams: 6, CPULoad: 0.3},
+				{ID: "node-b", MaxStreams: 10, ActiveStreams: 2, CPULoad: 0.2},
+			},
+			expected: "node-b",
+		},
+		{
+			name: "cpu load outweighs free slots",
+			nodes: []*models.LiveNode{
+				{ID: "node-a", MaxStreams: 10, ActiveStreams: 4, CPULoad: 0.45},
+				{ID: "node-b", MaxStreams: 10, ActiveStreams: 1, CPULoad: 0.7},
+			},
+			expected: "node-a",
+		},
+		{
+			name: "full and overloaded nodes are skipped",
+			nodes: []*models.LiveNode{
+				{ID: "node-a", MaxStreams: 5, ActiveStreams: 5},
+				{ID: "node-b", MaxStreams: 5, ActiveStreams: 0, CPULoad: 0.95},
+				{ID: "node-c", MaxStreams: 5, ActiveStreams: 4, CPULoad: 0.5},
+			},
+			expected: "node-c",
+		},
+		{
+			name: "ties go to the lowest ID",
+			nodes: []*models.LiveNode{
+				{ID: "node-b", MaxStreams: 4, ActiveStreams: 1},
+				{ID: "node-a", MaxStreams: 8, ActiveStreams: 2},
+			},
+			expected: "node-a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := SelectNode(tt.nodes, 0.9)
+			require.NotNil(t, node)
+			assert.Equal(t, tt.expected, node.ID)
+		})
+	}
+}
+
+func TestSelectNode_NoCapacity(t *testing.T) {
+	nodes := []*models.LiveNode{
+		{ID: "node-a", MaxStreams: 2, ActiveStreams: 2},
+		{ID: "node-b", MaxStreams: 2, ActiveStreams: 0, CPULoad: 1.5},
+	}
+
+	assert.Nil(t, SelectNode(nodes, 0.9))
+	assert.Nil(t, SelectNode(nil, 0.9))
+}
+
+func TestRedirectError(t *testing.T) {
+	node := &models.LiveNode{ID: "node-b", Host: "live-b.example.com", RTMPPort: 1935}
+	err := &RedirectError{StreamKey: "key-1", NodeID: node.ID, URL: node.IngestURL("key-1")}
+
+	assert.Equal(t, "rtmp://live-b.example.com:1935/live/key-1", err.URL)
+	assert.Contains(t, err.Error(), "node-b")
+}
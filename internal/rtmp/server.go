@@ -4,35 +4,74 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"sync"
 	"time"
 
-	"github.com/therealutkarshpriyadarshi/transcode/internal/database"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/livestream"
 	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
 )
 
+// Repository defines the persistence the RTMP server needs for live streams
+// and their placement across live nodes
+type Repository interface {
+	GetLiveStream(ctx context.Context, id string) (*models.LiveStream, error)
+	GetLiveStreamByKey(ctx context.Context, streamKey string) (*models.LiveStream, error)
+	UpdateLiveStreamStatus(ctx context.Context, id, status string) error
+	UpdateLiveStreamStartTime(ctx context.Context, id string, startTime *time.Time) error
+	UpdateLiveStreamEndTime(ctx context.Context, id string, endTime *time.Time) error
+	CreateLiveStreamAnalytics(ctx context.Context, analytics *models.LiveStreamAnalytics) error
+	CreateLiveStreamEvent(ctx context.Context, event *models.LiveStreamEvent) error
+
+	UpsertLiveNode(ctx context.Context, node *models.LiveNode) error
+	GetLiveNode(ctx context.Context, id string) (*models.LiveNode, error)
+	ListLiveNodes(ctx context.Context, since time.Time) ([]*models.LiveNode, error)
+	DeleteLiveNode(ctx context.Context, id string) error
+	AcquireLiveStreamLease(ctx context.Context, streamID, nodeID string, ttl time.Duration) (*models.LiveStreamLease, bool, error)
+	GetLiveStreamLease(ctx context.Context, streamID string) (*models.LiveStreamLease, error)
+	RenewLiveStreamLeases(ctx context.Context, nodeID string, ttl time.Duration) ([]string, error)
+	ReleaseLiveStreamLease(ctx context.Context, streamID, nodeID string) error
+	ListOrphanedLiveStreams(ctx context.Context) ([]string, error)
+}
+
 // Server represents an RTMP ingestion server
 type Server struct {
-	host           string
-	port           int
-	ffmpegPath     string
-	repo           *database.Repository
-	activeStreams  map[string]*StreamHandler
-	mu             sync.RWMutex
-	transcodeChan  chan *StreamTranscodeRequest
+	host          string
+	port          int
+	ffmpegPath    string
+	repo          Repository
+	transcoder    *livestream.Transcoder
+	activeStreams map[string]*StreamHandler
+	mu            sync.RWMutex
+	transcodeChan chan *StreamTranscodeRequest
+
+	// Placement across live nodes
+	nodeID        string
+	advertiseHost string
+	outputBaseDir string
+	maxStreams    int
+	maxCPULoad    float64
+	leaseTTL      time.Duration
+	callbackAddr  string
 }
 
 // StreamHandler manages an active RTMP stream
 type StreamHandler struct {
-	LiveStreamID   string
-	StreamKey      string
-	InputURL       string
-	OutputDir      string
-	cmd            *exec.Cmd
-	cancel         context.CancelFunc
-	startTime      time.Time
-	lastFrameTime  time.Time
+	LiveStreamID  string
+	StreamKey     string
+	InputURL      string
+	OutputDir     string
+	cmd           *exec.Cmd
+	ctx           context.Context
+	cancel        context.CancelFunc
+	startTime     time.Time
+	lastFrameTime time.Time
+	source        string        // ingest source currently feeding the transcode
+	publishing    bool          // whether the primary publisher is connected
+	gracePeriod   time.Duration // how long to wait for the publisher to reconnect
+	graceTimer    *time.Timer   // set while waiting for the publisher to reconnect
 }
 
 // StreamTranscodeRequest represents a request to transcode a live stream
@@ -41,40 +80,87 @@ type StreamTranscodeRequest struct {
 	StreamKey    string
 	InputURL     string
 	Settings     models.LiveStreamSettings
+	Resume       bool // continue the playlists of a stream adopted from a failed node
 }
 
 // Config holds RTMP server configuration
 type Config struct {
-	Host           string
-	Port           int
-	FFmpegPath     string
-	OutputBaseDir  string
+	Host          string
+	Port          int
+	FFmpegPath    string
+	OutputBaseDir string // must be shared between nodes for seamless stream recovery
+
+	// Placement across live nodes
+	NodeID        string        // unique per node, defaults to the hostname
+	AdvertiseHost string        // host publishers are redirected to, defaults to Host
+	MaxStreams    int           // streams this node accepts, defaults to 5
+	MaxCPULoad    float64       // load average per core above which no new streams are placed here
+	LeaseTTL      time.Duration // how long stream ownership survives without a heartbeat
+
+	// Address of the publish callbacks of the RTMP front end, disabled when empty
+	CallbackAddr string
 }
 
 // NewServer creates a new RTMP server instance
-func NewServer(config Config, repo *database.Repository) *Server {
+func NewServer(config Config, repo Repository, transcoder *livestream.Transcoder) *Server {
+	if config.NodeID == "" {
+		config.NodeID, _ = os.Hostname()
+	}
+	if config.AdvertiseHost == "" {
+		config.AdvertiseHost = config.Host
+	}
+	if config.OutputBaseDir == "" {
+		config.OutputBaseDir = "/tmp/livestreams"
+	}
+	if config.MaxStreams == 0 {
+		config.MaxStreams = 5
+	}
+	if config.MaxCPULoad == 0 {
+		config.MaxCPULoad = 0.9
+	}
+	if config.LeaseTTL == 0 {
+		config.LeaseTTL = 15 * time.Second
+	}
+
 	return &Server{
 		host:          config.Host,
 		port:          config.Port,
 		ffmpegPath:    config.FFmpegPath,
 		repo:          repo,
+		transcoder:    transcoder,
 		activeStreams: make(map[string]*StreamHandler),
 		transcodeChan: make(chan *StreamTranscodeRequest, 100),
+		nodeID:        config.NodeID,
+		advertiseHost: config.AdvertiseHost,
+		outputBaseDir: config.OutputBaseDir,
+		maxStreams:    config.MaxStreams,
+		maxCPULoad:    config.MaxCPULoad,
+		leaseTTL:      config.LeaseTTL,
+		callbackAddr:  config.CallbackAddr,
 	}
 }
 
 // Start begins the RTMP server
 func (s *Server) Start(ctx context.Context) error {
-	log.Printf("Starting RTMP server on %s:%d", s.host, s.port)
+	log.Printf("Starting RTMP server on %s:%d (live node %s)", s.host, s.port, s.nodeID)
 
-	// Start transcode workers
-	for i := 0; i < 5; i++ {
+	// Start transcode workers, one per stream the node accepts
+	for i := 0; i < s.maxStreams; i++ {
 		go s.transcodeWorker(ctx)
 	}
 
 	// Start stream monitor
 	go s.monitorStreams(ctx)
 
+	// Join stream placement and take over streams of failed nodes
+	go s.runHeartbeat(ctx)
+	go s.runOrphanRecovery(ctx)
+
+	// Receive publish start and stop from the RTMP front end
+	if s.callbackAddr != "" {
+		go s.serveCallbacks(ctx)
+	}
+
 	// Note: In production, you would use an actual RTMP server library
 	// like github.com/nareix/joy4 or run an external RTMP server (nginx-rtmp)
 	// and use webhooks to notify this service when streams start/stop
@@ -89,14 +175,13 @@ func (s *Server) Start(ctx context.Context) error {
 	return s.Shutdown()
 }
 
-// StartStream initiates transcoding for a new live stream
+// StartStream initiates transcoding for a new live stream. When the stream is
+// owned by, or placed on, another live node a *RedirectError is returned.
 func (s *Server) StartStream(ctx context.Context, streamKey string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// Check if stream is already active
-	if _, exists := s.activeStreams[streamKey]; exists {
-		return fmt.Errorf("stream with key %s is already active", streamKey)
+	// Check if stream is already active. A publisher reconnecting with the
+	// same key resumes the existing playlist instead of starting a new one.
+	if resumed, err := s.resumeStream(streamKey); resumed || err != nil {
+		return err
 	}
 
 	// Get live stream from database
@@ -105,32 +190,41 @@ func (s *Server) StartStream(ctx context.Context, streamKey string) error {
 		return fmt.Errorf("failed to get live stream: %w", err)
 	}
 
-	// Update status to starting
-	if err := s.repo.UpdateLiveStreamStatus(ctx, stream.ID, models.LiveStreamStatusStarting); err != nil {
-		return fmt.Errorf("failed to update stream status: %w", err)
+	// Only the node holding the stream's lease may transcode it. Placement
+	// reads this node's load under the lock, so it runs without holding it.
+	if _, err := s.placeStream(ctx, stream); err != nil {
+		return err
 	}
 
-	// Create stream handler
-	inputURL := fmt.Sprintf("rtmp://%s:%d/live/%s", s.host, s.port, streamKey)
-	streamCtx, cancel := context.WithCancel(ctx)
-
-	handler := &StreamHandler{
-		LiveStreamID:  stream.ID,
-		StreamKey:     streamKey,
-		InputURL:      inputURL,
-		OutputDir:     fmt.Sprintf("/tmp/livestreams/%s", stream.ID),
-		cancel:        cancel,
-		startTime:     time.Now(),
-		lastFrameTime: time.Now(),
+	// Another publish of the same key may have started the stream meanwhile;
+	// it holds the same lease
+	s.mu.Lock()
+	if _, exists := s.activeStreams[streamKey]; exists {
+		s.mu.Unlock()
+		if resumed, err := s.resumeStream(streamKey); resumed || err != nil {
+			return err
+		}
+		return fmt.Errorf("stream with key %s is already active", streamKey)
 	}
-
+	handler := s.newStreamHandler(stream)
 	s.activeStreams[streamKey] = handler
+	s.mu.Unlock()
+
+	// Update status to starting
+	if err := s.repo.UpdateLiveStreamStatus(ctx, stream.ID, models.LiveStreamStatusStarting); err != nil {
+		s.mu.Lock()
+		delete(s.activeStreams, streamKey)
+		s.mu.Unlock()
+		handler.cancel()
+		s.releaseLease(stream.ID)
+		return fmt.Errorf("failed to update stream status: %w", err)
+	}
 
 	// Send transcode request
 	s.transcodeChan <- &StreamTranscodeRequest{
 		LiveStreamID: stream.ID,
 		StreamKey:    streamKey,
-		InputURL:     inputURL,
+		InputURL:     handler.InputURL,
 		Settings:     stream.Settings,
 	}
 
@@ -150,6 +244,94 @@ func (s *Server) StartStream(ctx context.Context, streamKey string) error {
 	return nil
 }
 
+// newStreamHandler creates the handler for a stream served by this node
+func (s *Server) newStreamHandler(stream *models.LiveStream) *StreamHandler {
+	// The stream outlives the request that started it
+	streamCtx, cancel := context.WithCancel(context.Background())
+
+	return &StreamHandler{
+		LiveStreamID:  stream.ID,
+		StreamKey:     stream.StreamKey,
+		InputURL:      fmt.Sprintf("rtmp://%s:%d/live/%s", s.host, s.port, stream.StreamKey),
+		OutputDir:     filepath.Join(s.outputBaseDir, stream.ID),
+		ctx:           streamCtx,
+		cancel:        cancel,
+		startTime:     time.Now(),
+		lastFrameTime: time.Now(),
+		source:        models.IngestSourcePrimary,
+		publishing:    true,
+		gracePeriod:   time.Duration(stream.Settings.ReconnectGracePeriod) * time.Second,
+	}
+}
+
+// adoptStream resumes a stream whose owning node failed. The transcode
+// continues the existing playlists on the backup ingest or slate until the
+// publisher, redirected here, reconnects within the grace period.
+func (s *Server) adoptStream(ctx context.Context, stream *models.LiveStream, lease *models.LiveStreamLease, previous *models.LiveStreamLease) error {
+	s.mu.Lock()
+	if _, exists := s.activeStreams[stream.StreamKey]; exists {
+		// The stream is already running here, the lease was only late to renew
+		s.mu.Unlock()
+		return nil
+	}
+
+	handler := s.newStreamHandler(stream)
+	handler.source = models.IngestSourceSlate
+	handler.publishing = false
+	s.activeStreams[stream.StreamKey] = handler
+	s.mu.Unlock()
+
+	from := ""
+	if previous != nil {
+		from = previous.NodeID
+	}
+	log.Printf("Adopting live stream %s from failed node %q (lease generation %d)", stream.ID, from, lease.Generation)
+	s.logStreamEvent(ctx, stream.ID, models.LiveStreamEventNodeFailover, models.SeverityWarning,
+		"Live stream recovered on another node", models.Metadata{"from_node": from, "to_node": s.nodeID, "generation": lease.Generation})
+
+	s.transcodeChan <- &StreamTranscodeRequest{
+		LiveStreamID: stream.ID,
+		StreamKey:    stream.StreamKey,
+		InputURL:     handler.InputURL,
+		Settings:     stream.Settings,
+		Resume:       true,
+	}
+
+	return nil
+}
+
+// resumeStream reattaches a publisher to an active stream whose primary
+// publisher disconnected. It reports whether the stream was resumed, and
+// fails while the primary publisher is still connected.
+func (s *Server) resumeStream(streamKey string) (bool, error) {
+	s.mu.Lock()
+	handler, exists := s.activeStreams[streamKey]
+	if !exists {
+		s.mu.Unlock()
+		return false, nil
+	}
+	if handler.publishing {
+		s.mu.Unlock()
+		return false, fmt.Errorf("stream with key %s is already active", streamKey)
+	}
+	handler.publishing = true
+	s.mu.Unlock()
+
+	// The grace timer stops once the transcode is back on the primary ingest
+	log.Printf("Publisher reconnected to live stream: %s (key: %s)", handler.LiveStreamID, streamKey)
+	if s.transcoder != nil {
+		s.transcoder.IngestReconnected(handler.LiveStreamID)
+	}
+	return true, nil
+}
+
+// releaseLease gives up this node's ownership of a stream
+func (s *Server) releaseLease(streamID string) {
+	if err := s.repo.ReleaseLiveStreamLease(context.Background(), streamID, s.nodeID); err != nil {
+		log.Printf("Failed to release lease for live stream %s: %v", streamID, err)
+	}
+}
+
 // StopStream stops a live stream
 func (s *Server) StopStream(ctx context.Context, streamKey string) error {
 	s.mu.Lock()
@@ -159,6 +341,9 @@ func (s *Server) StopStream(ctx context.Context, streamKey string) error {
 		return fmt.Errorf("stream with key %s is not active", streamKey)
 	}
 	delete(s.activeStreams, streamKey)
+	if handler.graceTimer != nil {
+		handler.graceTimer.Stop()
+	}
 	s.mu.Unlock()
 
 	// Cancel stream context
@@ -184,10 +369,86 @@ func (s *Server) StopStream(ctx context.Context, streamKey string) error {
 		log.Printf("Failed to update stream status to ended: %v", err)
 	}
 
+	s.releaseLease(handler.LiveStreamID)
+
 	log.Printf("Stopped live stream: %s (key: %s)", handler.LiveStreamID, streamKey)
 	return nil
 }
 
+// DisconnectStream handles the publisher dropping. The stream continues on
+// the backup ingest or slate and is only stopped once the reconnect grace
+// period expires without the publisher coming back.
+func (s *Server) DisconnectStream(ctx context.Context, streamKey string) error {
+	s.mu.Lock()
+	handler, exists := s.activeStreams[streamKey]
+	if !exists {
+		s.mu.Unlock()
+		return fmt.Errorf("stream with key %s is not active", streamKey)
+	}
+	handler.publishing = false
+	s.mu.Unlock()
+
+	log.Printf("Publisher disconnected from live stream: %s (key: %s)", handler.LiveStreamID, streamKey)
+	if s.transcoder != nil {
+		s.transcoder.IngestDropped(handler.LiveStreamID)
+	}
+	return nil
+}
+
+// dropStream removes a stream that failed to start from this node and gives
+// up its lease
+func (s *Server) dropStream(streamKey string) {
+	s.mu.Lock()
+	handler, exists := s.activeStreams[streamKey]
+	if !exists {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.activeStreams, streamKey)
+	if handler.graceTimer != nil {
+		handler.graceTimer.Stop()
+	}
+	s.mu.Unlock()
+
+	handler.cancel()
+	s.releaseLease(handler.LiveStreamID)
+}
+
+// handleSourceChange tracks the ingest source of a stream and runs the
+// reconnect grace timer while the stream is on the slate
+func (s *Server) handleSourceChange(handler *StreamHandler, source string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.activeStreams[handler.StreamKey]; !exists {
+		return
+	}
+	handler.source = source
+
+	if source != models.IngestSourceSlate {
+		if handler.graceTimer != nil {
+			handler.graceTimer.Stop()
+			handler.graceTimer = nil
+		}
+		return
+	}
+
+	if handler.graceTimer != nil {
+		return
+	}
+
+	streamKey := handler.StreamKey
+	handler.graceTimer = time.AfterFunc(handler.gracePeriod, func() {
+		log.Printf("Reconnect grace period expired for live stream: %s", handler.LiveStreamID)
+		s.logStreamEvent(context.Background(), handler.LiveStreamID, models.LiveStreamEventStreamEnded, models.SeverityWarning,
+			"Publisher did not reconnect within the grace period", models.Metadata{"grace_period": handler.gracePeriod.Seconds()})
+
+		if err := s.StopStream(context.Background(), streamKey); err != nil {
+			log.Printf("Failed to stop stream after grace period: %v", err)
+		}
+	})
+}
+
 // transcodeWorker processes stream transcode requests
 func (s *Server) transcodeWorker(ctx context.Context) {
 	for {
@@ -197,6 +458,7 @@ func (s *Server) transcodeWorker(ctx context.Context) {
 		case req := <-s.transcodeChan:
 			if err := s.processStream(ctx, req); err != nil {
 				log.Printf("Error processing stream %s: %v", req.LiveStreamID, err)
+				s.dropStream(req.StreamKey)
 
 				// Update stream status to failed
 				if err := s.repo.UpdateLiveStreamStatus(ctx, req.LiveStreamID, models.LiveStreamStatusFailed); err != nil {
@@ -234,12 +496,30 @@ func (s *Server) processStream(ctx context.Context, req *StreamTranscodeRequest)
 	}
 
 	// Log stream started event
-	s.logStreamEvent(ctx, req.LiveStreamID, models.LiveStreamEventStreamStarted, models.SeverityInfo,
-		"Live stream started", nil)
+	if !req.Resume {
+		s.logStreamEvent(ctx, req.LiveStreamID, models.LiveStreamEventStreamStarted, models.SeverityInfo,
+			"Live stream started", nil)
+	}
+
+	// Transcode on the stream's context so StopStream tears it down. The
+	// transcoder fails over to the backup ingest or a slate if the input drops.
+	_, err = s.transcoder.StartTranscoding(handler.ctx, livestream.TranscodeOptions{
+		LiveStreamID: stream.ID,
+		InputURL:     req.InputURL,
+		OutputDir:    handler.OutputDir,
+		Settings:     req.Settings,
+		DVREnabled:   stream.DVREnabled,
+		DVRWindow:    stream.DVRWindow,
+		LowLatency:   stream.LowLatency,
+		Resume:       req.Resume,
+		OnSourceChange: func(source string) {
+			s.handleSourceChange(handler, source)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start transcoding: %w", err)
+	}
 
-	// Build FFmpeg command based on settings
-	// Note: This is a simplified version. Production would handle multiple variants
-	// and more complex transcoding scenarios
 	return nil
 }
 
@@ -264,24 +544,18 @@ func (s *Server) monitorStreams(ctx context.Context) {
 
 // updateStreamMetrics collects and stores metrics for a live stream
 func (s *Server) updateStreamMetrics(ctx context.Context, handler *StreamHandler) {
-	// In production, this would collect real metrics from FFmpeg
-	// For now, we'll create placeholder analytics
-
-	analytics := &models.LiveStreamAnalytics{
-		LiveStreamID:     handler.LiveStreamID,
-		Timestamp:        time.Now(),
-		ViewerCount:      0, // Would be updated by viewer tracking
-		BandwidthUsage:   0,
-		IngestBitrate:    0,
-		DroppedFrames:    0,
-		KeyframeInterval: 2.0,
-		AudioVideoSync:   0,
-		BufferHealth:     100,
-		AverageLatency:   0,
-		ErrorCount:       0,
-		QualityScore:     95,
+	monitor, ok := s.transcoder.Health(handler.LiveStreamID)
+	if !ok {
+		return
 	}
 
+	stats := monitor.Snapshot()
+	s.mu.Lock()
+	handler.lastFrameTime = stats.UpdatedAt
+	s.mu.Unlock()
+
+	analytics := monitor.Analytics(time.Now())
+
 	if err := s.repo.CreateLiveStreamAnalytics(ctx, analytics); err != nil {
 		log.Printf("Failed to create stream analytics: %v", err)
 	}
@@ -340,6 +614,12 @@ func (s *Server) Shutdown() error {
 	}
 
 	s.activeStreams = make(map[string]*StreamHandler)
+
+	// Leave placement; the leases expire and the streams are adopted by other nodes
+	if err := s.repo.DeleteLiveNode(context.Background(), s.nodeID); err != nil {
+		log.Printf("Failed to deregister live node: %v", err)
+	}
+
 	log.Println("RTMP server shutdown complete")
 	return nil
 }
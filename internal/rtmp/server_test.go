@@ -0,0 +1,245 @@
+package rtmp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// fakeRepo keeps live streams, nodes and leases in memory
+type fakeRepo struct {
+	mu       sync.Mutex
+	streams  map[string]*models.LiveStream
+	nodes    map[string]*models.LiveNode
+	leases   map[string]*models.LiveStreamLease
+	statuses map[string]string
+}
+
+func newFakeRepo(streams ...*models.LiveStream) *fakeRepo {
+	r := &fakeRepo{
+		streams:  make(map[string]*models.LiveStream),
+		nodes:    make(map[string]*models.LiveNode),
+		leases:   make(map[string]*models.LiveStreamLease),
+		statuses: make(map[string]string),
+	}
+	for _, stream := range streams {
+		r.streams[stream.ID] = stream
+	}
+	return r
+}
+
+func (r *fakeRepo) GetLiveStream(ctx context.Context, id string) (*models.LiveStream, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stream, ok := r.streams[id]; ok {
+		return stream, nil
+	}
+	return nil, errors.New("live stream not found")
+}
+
+func (r *fakeRepo) GetLiveStreamByKey(ctx context.Context, streamKey string) (*models.LiveStream, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, stream := range r.streams {
+		if stream.StreamKey == streamKey {
+			return stream, nil
+		}
+	}
+	return nil, errors.New("live stream not found")
+}
+
+func (r *fakeRepo) UpdateLiveStreamStatus(ctx context.Context, id, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statuses[id] = status
+	return nil
+}
+
+func (r *fakeRepo) status(id string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.statuses[id]
+}
+
+func (r *fakeRepo) UpdateLiveStreamStartTime(ctx context.Context, id string, startTime *time.Time) error {
+	return nil
+}
+
+func (r *fakeRepo) UpdateLiveStreamEndTime(ctx context.Context, id string, endTime *time.Time) error {
+	return nil
+}
+
+func (r *fakeRepo) CreateLiveStreamAnalytics(ctx context.Context, analytics *models.LiveStreamAnalytics) error {
+	return nil
+}
+
+func (r *fakeRepo) CreateLiveStreamEvent(ctx context.Context, event *models.LiveStreamEvent) error {
+	return nil
+}
+
+func (r *fakeRepo) UpsertLiveNode(ctx context.Context, node *models.LiveNode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nodes[node.ID] = node
+	return nil
+}
+
+func (r *fakeRepo) GetLiveNode(ctx context.Context, id string) (*models.LiveNode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if node, ok := r.nodes[id]; ok {
+		return node, nil
+	}
+	return nil, errors.New("live node not found")
+}
+
+func (r *fakeRepo) ListLiveNodes(ctx context.Context, since time.Time) ([]*models.LiveNode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	nodes := make([]*models.LiveNode, 0, len(r.nodes))
+	for _, node := range r.nodes {
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+func (r *fakeRepo) DeleteLiveNode(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.nodes, id)
+	return nil
+}
+
+func (r *fakeRepo) AcquireLiveStreamLease(ctx context.Context, streamID, nodeID string, ttl time.Duration) (*models.LiveStreamLease, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if lease, ok := r.leases[streamID]; ok && lease.NodeID != nodeID && lease.ExpiresAt.After(time.Now()) {
+		return lease, false, nil
+	}
+	lease := &models.LiveStreamLease{LiveStreamID: streamID, NodeID: nodeID, ExpiresAt: time.Now().Add(ttl)}
+	r.leases[streamID] = lease
+	return lease, true, nil
+}
+
+func (r *fakeRepo) GetLiveStreamLease(ctx context.Context, streamID string) (*models.LiveStreamLease, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if lease, ok := r.leases[streamID]; ok {
+		return lease, nil
+	}
+	return nil, errors.New("live stream lease not found")
+}
+
+func (r *fakeRepo) RenewLiveStreamLeases(ctx context.Context, nodeID string, ttl time.Duration) ([]string, error) {
+	return nil, nil
+}
+
+func (r *fakeRepo) ReleaseLiveStreamLease(ctx context.Context, streamID, nodeID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if lease, ok := r.leases[streamID]; ok && lease.NodeID == nodeID {
+		delete(r.leases, streamID)
+	}
+	return nil
+}
+
+func (r *fakeRepo) ListOrphanedLiveStreams(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+func TestStartStream_WithoutLease(t *testing.T) {
+	repo := newFakeRepo(&models.LiveStream{ID: "stream-1", StreamKey: "key-1"})
+	// A high load limit keeps the host's real load out of placement
+	server := NewServer(Config{Host: "localhost", Port: 1935, NodeID: "node-a", MaxCPULoad: 1000}, repo, nil)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- server.StartStream(context.Background(), "key-1")
+	}()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("StartStream did not return, placement deadlocked on the server lock")
+	}
+
+	assert.True(t, server.IsStreamActive("key-1"))
+	assert.Equal(t, models.LiveStreamStatusStarting, repo.status("stream-1"))
+
+	lease, err := repo.GetLiveStreamLease(context.Background(), "stream-1")
+	require.NoError(t, err)
+	assert.Equal(t, "node-a", lease.NodeID)
+
+	req := <-server.transcodeChan
+	assert.Equal(t, "stream-1", req.LiveStreamID)
+	assert.False(t, req.Resume)
+
+	// A second publish of the active key is refused
+	assert.Error(t, server.StartStream(context.Background(), "key-1"))
+}
+
+func TestStartStream_RedirectsToLeaseOwner(t *testing.T) {
+	repo := newFakeRepo(&models.LiveStream{ID: "stream-1", StreamKey: "key-1"})
+	repo.nodes["node-b"] = &models.LiveNode{ID: "node-b", Host: "live-b.example.com", RTMPPort: 1935}
+	repo.leases["stream-1"] = &models.LiveStreamLease{LiveStreamID: "stream-1", NodeID: "node-b", ExpiresAt: time.Now().Add(time.Minute)}
+
+	server := NewServer(Config{Host: "localhost", Port: 1935, NodeID: "node-a", MaxCPULoad: 1000}, repo, nil)
+
+	err := server.StartStream(context.Background(), "key-1")
+
+	var redirect *RedirectError
+	require.ErrorAs(t, err, &redirect)
+	assert.Equal(t, "node-b", redirect.NodeID)
+	assert.False(t, server.IsStreamActive("key-1"))
+}
+
+func TestStartStream_ResumesAfterDisconnect(t *testing.T) {
+	repo := newFakeRepo(&models.LiveStream{ID: "stream-1", StreamKey: "key-1"})
+	server := NewServer(Config{Host: "localhost", Port: 1935, NodeID: "node-a", MaxCPULoad: 1000}, repo, nil)
+
+	require.NoError(t, server.StartStream(context.Background(), "key-1"))
+	<-server.transcodeChan
+
+	// The connected primary publisher keeps the key
+	assert.Error(t, server.StartStream(context.Background(), "key-1"))
+
+	// After it drops, publishing the same key resumes the running stream
+	require.NoError(t, server.DisconnectStream(context.Background(), "key-1"))
+	require.NoError(t, server.StartStream(context.Background(), "key-1"))
+	assert.True(t, server.IsStreamActive("key-1"))
+	assert.Empty(t, server.transcodeChan, "a resumed stream must not start a new transcode")
+
+	assert.Error(t, server.StartStream(context.Background(), "key-1"))
+}
+
+func TestCallbackHandler_PublishDoneDisconnects(t *testing.T) {
+	repo := newFakeRepo(&models.LiveStream{ID: "stream-1", StreamKey: "key-1"})
+	server := NewServer(Config{Host: "localhost", Port: 1935, NodeID: "node-a", MaxCPULoad: 1000}, repo, nil)
+	handler := server.CallbackHandler()
+
+	post := func(path string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("name=key-1"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, post("/on_publish"))
+	<-server.transcodeChan
+	assert.Equal(t, http.StatusForbidden, post("/on_publish"))
+
+	assert.Equal(t, http.StatusOK, post("/on_publish_done"))
+	assert.Equal(t, http.StatusOK, post("/on_publish"))
+	assert.True(t, server.IsStreamActive("key-1"))
+}
@@ -0,0 +1,73 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// BatchStore tracks job dependencies and batch completion
+type BatchStore interface {
+	FailBlockedJobs(ctx context.Context) ([]string, error)
+	ListFinishedBatches(ctx context.Context, limit int) ([]*models.Batch, error)
+	FinishBatch(ctx context.Context, batch *models.Batch) (bool, error)
+}
+
+// BatchNotifier is told when every job of a batch has finished
+type BatchNotifier interface {
+	NotifyBatchCompleted(ctx context.Context, batch *models.Batch) error
+}
+
+// SetBatchStore enables failing jobs whose dependencies failed and closing
+// finished batches, done by the leader on each tick. notifier may be nil.
+func (s *JobScheduler) SetBatchStore(store BatchStore, notifier BatchNotifier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batches = store
+	s.batchNotifier = notifier
+}
+
+// processBatches fails jobs blocked by a failed dependency, then closes the
+// batches whose jobs have all finished
+func (s *JobScheduler) processBatches() {
+	if s.batches == nil {
+		return
+	}
+
+	// Failures cascade one level per tick down a dependency chain
+	blocked, err := s.batches.FailBlockedJobs(s.ctx)
+	if err != nil {
+		log.Printf("Failed to fail blocked jobs: %v", err)
+	}
+	for _, jobID := range blocked {
+		log.Printf("Job %s failed: a dependency did not complete", jobID)
+	}
+
+	finished, err := s.batches.ListFinishedBatches(s.ctx, 100)
+	if err != nil {
+		log.Printf("Failed to list finished batches: %v", err)
+		return
+	}
+
+	for _, batch := range finished {
+		closed, err := s.batches.FinishBatch(s.ctx, batch)
+		if err != nil {
+			log.Printf("Failed to finish batch %s: %v", batch.ID, err)
+			continue
+		}
+		if !closed {
+			continue
+		}
+
+		log.Printf("Batch %s (%s) %s: %d/%d jobs completed",
+			batch.ID, batch.Name, batch.Status, batch.Counts.Completed, batch.TotalJobs)
+
+		if s.batchNotifier != nil {
+			if err := s.batchNotifier.NotifyBatchCompleted(s.ctx, batch); err != nil {
+				log.Printf("Failed to notify batch %s completion: %v", batch.ID, err)
+			}
+		}
+	}
+}
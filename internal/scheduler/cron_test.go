@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2026, 1, 1, 10, 30, 0, 0, time.UTC) // a Thursday
+
+	tests := []struct {
+		name     string
+		expr     string
+		timezone string
+		want     time.Time
+	}{
+		{"every minute", "* * * * *", "", time.Date(2026, 1, 1, 10, 31, 0, 0, time.UTC)},
+		{"step", "*/15 * * * *", "", time.Date(2026, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{"daily", "0 3 * * *", "", time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)},
+		{"macro", "@hourly", "", time.Date(2026, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"weekday names", "0 9 * * mon-fri", "", time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)},
+		{"sunday as 7", "0 0 * * 7", "", time.Date(2026, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{"month list", "0 0 1 jan,jul *", "", time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"day of month or week", "0 0 15 * mon", "", time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"leap day", "0 0 29 2 *", "", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"timezone", "0 9 * * *", "Asia/Kolkata", time.Date(2026, 1, 2, 3, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseCron(tt.expr, tt.timezone)
+			if assert.NoError(t, err) {
+				assert.True(t, tt.want.Equal(schedule.Next(from)), "got %s", schedule.Next(from))
+			}
+		})
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "* * * foo *"} {
+		_, err := ParseCron(expr, "")
+		assert.Error(t, err, expr)
+	}
+
+	_, err := ParseCron("* * * * *", "Mars/Olympus")
+	assert.Error(t, err)
+
+	_, err = NextRun("0 0 30 2 *", "", time.Now())
+	assert.Error(t, err)
+}
+
+func TestOffPeakWindow(t *testing.T) {
+	window, err := NewOffPeakWindow("22:00", "06:00", "UTC", 5)
+	assert.NoError(t, err)
+
+	assert.True(t, window.Contains(time.Date(2026, 1, 1, 23, 0, 0, 0, time.UTC)))
+	assert.True(t, window.Contains(time.Date(2026, 1, 1, 5, 59, 0, 0, time.UTC)))
+	assert.False(t, window.Contains(time.Date(2026, 1, 1, 6, 0, 0, 0, time.UTC)))
+	assert.False(t, window.Contains(time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)))
+
+	_, err = NewOffPeakWindow("25:00", "06:00", "UTC", 5)
+	assert.Error(t, err)
+	_, err = NewOffPeakWindow("06:00", "06:00", "UTC", 5)
+	assert.Error(t, err)
+}
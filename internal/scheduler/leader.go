@@ -0,0 +1,56 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// leaseName is the lease API replicas compete for to run the scheduler
+const leaseName = "job_scheduler"
+
+// LeaseStore grants the scheduler lease to one replica at a time
+type LeaseStore interface {
+	AcquireSchedulerLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	ReleaseSchedulerLease(ctx context.Context, name, holder string) error
+}
+
+// leaderElection tracks whether this replica holds the scheduler lease
+type leaderElection struct {
+	store  LeaseStore
+	holder string
+	ttl    time.Duration
+	leader bool
+}
+
+// elect acquires or renews the lease and reports whether this replica leads.
+// Errors count as lost leadership so two replicas never both dispatch.
+func (e *leaderElection) elect(ctx context.Context) bool {
+	acquired, err := e.store.AcquireSchedulerLease(ctx, leaseName, e.holder, e.ttl)
+	if err != nil {
+		log.Printf("Failed to acquire scheduler lease: %v", err)
+		acquired = false
+	}
+
+	if acquired != e.leader {
+		if acquired {
+			log.Printf("Scheduler %s became leader", e.holder)
+		} else {
+			log.Printf("Scheduler %s lost leadership", e.holder)
+		}
+	}
+	e.leader = acquired
+	return acquired
+}
+
+// resign releases the lease so another replica can take over immediately
+func (e *leaderElection) resign() {
+	if !e.leader {
+		return
+	}
+	e.leader = false
+
+	if err := e.store.ReleaseSchedulerLease(context.Background(), leaseName, e.holder); err != nil {
+		log.Printf("Failed to release scheduler lease: %v", err)
+	}
+}
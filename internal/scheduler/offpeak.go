@@ -0,0 +1,78 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// OffPeakWindow holds jobs below a priority until a daily time window, so
+// bulk work runs when the cluster is otherwise idle
+type OffPeakWindow struct {
+	start, end        time.Duration // offsets from midnight; end before start spans midnight
+	location          *time.Location
+	holdBelowPriority int
+}
+
+// NewOffPeakWindow creates a window from "HH:MM" start and end times in the
+// named IANA time zone. Jobs with a priority below holdBelowPriority wait
+// for the window.
+func NewOffPeakWindow(start, end, timezone string, holdBelowPriority int) (*OffPeakWindow, error) {
+	loc := time.UTC
+	if timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+		}
+	}
+
+	startOffset, err := parseTimeOfDay(start)
+	if err != nil {
+		return nil, err
+	}
+	endOffset, err := parseTimeOfDay(end)
+	if err != nil {
+		return nil, err
+	}
+	if startOffset == endOffset {
+		return nil, fmt.Errorf("off-peak window start and end are both %s", start)
+	}
+
+	return &OffPeakWindow{
+		start:             startOffset,
+		end:               endOffset,
+		location:          loc,
+		holdBelowPriority: holdBelowPriority,
+	}, nil
+}
+
+// parseTimeOfDay parses "HH:MM" into an offset from midnight
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether t falls inside the window
+func (w *OffPeakWindow) Contains(t time.Time) bool {
+	t = t.In(w.location)
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+
+	if w.start < w.end {
+		return offset >= w.start && offset < w.end
+	}
+	return offset >= w.start || offset < w.end
+}
+
+// Holds reports whether job must wait for the window at now. Jobs given an
+// explicit run_at are left to run at that time.
+func (w *OffPeakWindow) Holds(job *models.Job, now time.Time) bool {
+	if job.RunAt != nil || job.Priority >= w.holdBelowPriority {
+		return false
+	}
+	return !w.Contains(now)
+}
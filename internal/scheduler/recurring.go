@@ -0,0 +1,95 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// RecurringStore persists recurring job definitions and the jobs they create
+type RecurringStore interface {
+	ListDueRecurringJobs(ctx context.Context, now time.Time, limit int) ([]*models.RecurringJob, error)
+	AdvanceRecurringJob(ctx context.Context, id string, from, next time.Time, jobID string) (bool, error)
+	GetVideo(ctx context.Context, id string) (*models.Video, error)
+	CreateJob(ctx context.Context, job *models.Job) error
+}
+
+// SetRecurringStore enables recurring jobs, fired by the leader on each tick
+func (s *JobScheduler) SetRecurringStore(store RecurringStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recurring = store
+}
+
+// NextRun returns the first run of a cron schedule after now, validating it
+func NextRun(schedule, timezone string, now time.Time) (time.Time, error) {
+	cron, err := ParseCron(schedule, timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	next := cron.Next(now)
+	if next.IsZero() {
+		return time.Time{}, errNeverRuns
+	}
+	return next, nil
+}
+
+// fireRecurringJobs creates a job for every recurring job that is due. Runs
+// missed while no scheduler was leading are collapsed into one.
+func (s *JobScheduler) fireRecurringJobs() {
+	if s.recurring == nil {
+		return
+	}
+
+	now := s.now()
+	due, err := s.recurring.ListDueRecurringJobs(s.ctx, now, 100)
+	if err != nil {
+		log.Printf("Failed to list due recurring jobs: %v", err)
+		return
+	}
+
+	for _, rj := range due {
+		if err := s.fireRecurringJob(rj, now); err != nil {
+			log.Printf("Failed to run recurring job %s: %v", rj.ID, err)
+		}
+	}
+}
+
+// fireRecurringJob advances a recurring job to its next run and creates the job
+// for this one. The run is skipped rather than repeated if creating the job fails.
+func (s *JobScheduler) fireRecurringJob(rj *models.RecurringJob, now time.Time) error {
+	next, err := NextRun(rj.Schedule, rj.Timezone, now)
+	if err != nil {
+		return err
+	}
+
+	job := rj.NewJob()
+	job.ID = uuid.New().String()
+
+	advanced, err := s.recurring.AdvanceRecurringJob(s.ctx, rj.ID, rj.NextRunAt, next, job.ID)
+	if err != nil {
+		return err
+	}
+	if !advanced {
+		// Already fired, or disabled meanwhile
+		return nil
+	}
+
+	video, err := s.recurring.GetVideo(s.ctx, rj.VideoID)
+	if err != nil {
+		return err
+	}
+	job.PrepareRouting(video)
+
+	if err := s.recurring.CreateJob(s.ctx, job); err != nil {
+		return err
+	}
+
+	log.Printf("Recurring job %s (%s) created job %s, next run at %s", rj.ID, rj.Name, job.ID, next.Format(time.RFC3339))
+	return s.ScheduleJob(job)
+}
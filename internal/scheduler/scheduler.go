@@ -3,62 +3,135 @@ package scheduler
 import (
 	"container/heap"
 	"context"
-	"fmt"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/therealutkarshpriyadarshi/transcode/internal/queue"
 	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
 )
 
-// JobScheduler manages job scheduling with priority and resource awareness
+// DefaultTenant groups jobs that do not belong to a user
+const DefaultTenant = "default"
+
+// tenantPolicyTTL is how long a tenant's scheduling limits are cached
+const tenantPolicyTTL = time.Minute
+
+// dispatchTimeout is how long a job may stay queued before it is published
+// again. Claiming and publishing a job are not atomic, so a leader dying in
+// between leaves a queued job that never reached the queue.
+const dispatchTimeout = 10 * time.Minute
+
+// JobScheduler manages job scheduling with priority and resource awareness.
+// Pending jobs are kept per tenant and dispatched by weighted fair share, so
+// one user's backlog cannot starve the others. With leader election only the
+// replica holding the scheduler lease dispatches; the others leave new jobs
+// in the database for the leader to pick up.
 type JobScheduler struct {
+	tenants          map[string]*tenantState
+	active           map[string]string // job ID -> tenant
+	pending          map[string]bool   // job IDs waiting in tenant queues
+	mu               sync.RWMutex
+	maxConcurrent    int
+	tenantMaxDefault int
+	activeJobs       int
+	repo             Repository
+	publisher        JobPublisher
+	ctx              context.Context
+	cancel           context.CancelFunc
+
+	leader    bool
+	election  *leaderElection
+	offPeak   *OffPeakWindow
+	recurring RecurringStore
+	now       func() time.Time
+
+	batches       BatchStore
+	batchNotifier BatchNotifier
+}
+
+// tenantState is the backlog and running jobs of a tenant
+type tenantState struct {
 	queue          *PriorityQueue
-	mu             sync.RWMutex
+	active         int
+	weight         int
 	maxConcurrent  int
-	activeJobs     int
-	repo           Repository
-	publisher      JobPublisher
-	ctx            context.Context
-	cancel         context.CancelFunc
+	policyLoadedAt time.Time
+}
+
+// TenantStats describes a tenant's backlog in the scheduler
+type TenantStats struct {
+	TenantID      string `json:"tenant_id"`
+	Pending       int    `json:"pending"`
+	Active        int    `json:"active"`
+	Weight        int    `json:"weight"`
+	MaxConcurrent int    `json:"max_concurrent"`
 }
 
 // Repository defines the interface for job persistence
 type Repository interface {
 	GetPendingJobs(ctx context.Context, limit int) ([]*models.Job, error)
+	GetInFlightJobs(ctx context.Context, limit int) ([]*models.Job, error)
+	ClaimPendingJob(ctx context.Context, jobID string) (bool, error)
+	GetStaleQueuedJobs(ctx context.Context, cutoff time.Time, limit int) ([]*models.Job, error)
+	TouchQueuedJob(ctx context.Context, jobID string) (bool, error)
 	UpdateJobStatus(ctx context.Context, jobID, status string) error
 	GetJobByID(ctx context.Context, jobID string) (*models.Job, error)
+	GetUserByID(ctx context.Context, userID string) (*models.User, error)
 }
 
 // JobPublisher defines the interface for publishing jobs to queue
-type JobPublisher interface {
-	PublishJob(ctx context.Context, job *models.Job) error
-}
+type JobPublisher = queue.Publisher
 
 // NewScheduler creates a new job scheduler
 func NewScheduler(repo Repository, publisher JobPublisher, maxConcurrent int) *JobScheduler {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &JobScheduler{
-		queue:         &PriorityQueue{},
+		tenants:       make(map[string]*tenantState),
+		active:        make(map[string]string),
+		pending:       make(map[string]bool),
 		maxConcurrent: maxConcurrent,
 		activeJobs:    0,
 		repo:          repo,
 		publisher:     publisher,
 		ctx:           ctx,
 		cancel:        cancel,
+		leader:        true,
+		now:           time.Now,
 	}
 }
 
-// Start begins the scheduler
-func (s *JobScheduler) Start() error {
-	heap.Init(s.queue)
+// SetTenantLimit sets the concurrency cap for tenants without their own
+// limit. Zero leaves tenants bounded only by the global limit.
+func (s *JobScheduler) SetTenantLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	// Load pending jobs from database
-	if err := s.loadPendingJobs(); err != nil {
-		return fmt.Errorf("failed to load pending jobs: %w", err)
-	}
+	s.tenantMaxDefault = limit
+}
+
+// SetLeaderElection makes the scheduler dispatch only while holder has the
+// scheduler lease. The lease is renewed every tick and lapses after ttl.
+func (s *JobScheduler) SetLeaderElection(store LeaseStore, holder string, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.election = &leaderElection{store: store, holder: holder, ttl: ttl}
+	s.leader = false
+}
+
+// SetOffPeakWindow holds low priority jobs until the window opens
+func (s *JobScheduler) SetOffPeakWindow(window *OffPeakWindow) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.offPeak = window
+}
 
+// Start begins the scheduler
+func (s *JobScheduler) Start() error {
 	// Start scheduler loop
 	go s.scheduleLoop()
 
@@ -69,81 +142,429 @@ func (s *JobScheduler) Start() error {
 // Stop stops the scheduler
 func (s *JobScheduler) Stop() {
 	s.cancel()
+	if s.election != nil {
+		s.election.resign()
+	}
 	log.Println("Job scheduler stopped")
 }
 
-// ScheduleJob adds a job to the scheduling queue
+// IsLeader reports whether this scheduler is dispatching jobs
+func (s *JobScheduler) IsLeader() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.leader
+}
+
+// ScheduleJob adds a job to the scheduling queue. Jobs that are not due yet,
+// depend on other jobs, or are submitted to a replica that is not the leader
+// stay pending in the database until the leader loads them.
 func (s *JobScheduler) ScheduleJob(job *models.Job) error {
+	if len(job.DependsOn) > 0 {
+		// Loaded once every dependency has completed
+		return nil
+	}
+	return s.enqueue(job)
+}
+
+// enqueue adds a due job to its tenant's queue unless it is already known
+func (s *JobScheduler) enqueue(job *models.Job) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if !s.leader || !job.Due(s.now()) {
+		return nil
+	}
+	if _, dispatched := s.active[job.ID]; dispatched || s.pending[job.ID] {
+		return nil
+	}
+
 	item := &QueueItem{
 		Job:       job,
 		Priority:  job.Priority,
 		Timestamp: time.Now(),
 	}
 
-	heap.Push(s.queue, item)
+	heap.Push(s.tenant(tenantOf(job)).queue, item)
+	s.pending[job.ID] = true
 	return nil
 }
 
-// loadPendingJobs loads pending jobs from the database
+// tenantOf returns the tenant a job is billed to
+func tenantOf(job *models.Job) string {
+	if job.UserID == nil || *job.UserID == "" {
+		return DefaultTenant
+	}
+	return *job.UserID
+}
+
+// tenant returns the state of a tenant, creating it on first use
+func (s *JobScheduler) tenant(id string) *tenantState {
+	t, exists := s.tenants[id]
+	if !exists {
+		t = &tenantState{queue: &PriorityQueue{}, weight: 1}
+		s.tenants[id] = t
+	}
+	return t
+}
+
+// refreshPolicies reloads the weight and concurrency cap of waiting tenants
+// whose cached policy expired. The user records are loaded without holding
+// the lock and applied under it.
+func (s *JobScheduler) refreshPolicies() {
+	now := time.Now()
+
+	s.mu.RLock()
+	var stale []string
+	for id, t := range s.tenants {
+		if id != DefaultTenant && t.queue.Len() > 0 && now.Sub(t.policyLoadedAt) >= tenantPolicyTTL {
+			stale = append(stale, id)
+		}
+	}
+	s.mu.RUnlock()
+
+	if len(stale) == 0 {
+		return
+	}
+
+	// A failed load keeps the current policy until the TTL passes again
+	users := make(map[string]*models.User, len(stale))
+	for _, id := range stale {
+		user, err := s.repo.GetUserByID(s.ctx, id)
+		if err != nil {
+			log.Printf("Failed to load scheduling policy for tenant %s: %v", id, err)
+		}
+		users[id] = user
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, user := range users {
+		t, exists := s.tenants[id]
+		if !exists {
+			continue
+		}
+		t.policyLoadedAt = now
+		if user == nil {
+			continue
+		}
+
+		t.weight = user.SchedulingWeight
+		if t.weight < 1 {
+			t.weight = 1
+		}
+		t.maxConcurrent = user.MaxConcurrentJobs
+	}
+}
+
+// tenantLimit returns the concurrency cap of a tenant, 0 meaning none
+func (s *JobScheduler) tenantLimit(t *tenantState) int {
+	if t.maxConcurrent > 0 {
+		return t.maxConcurrent
+	}
+	return s.tenantMaxDefault
+}
+
+// nextTenant picks the tenant to dispatch from: the one using the smallest
+// share of its weight, skipping tenants at their cap. Ties go to the tenant
+// whose next job has the higher priority, then to the older job.
+func (s *JobScheduler) nextTenant() (string, *tenantState) {
+	var bestID string
+	var best *tenantState
+	bestShare := 0.0
+
+	now := s.now()
+	for id, t := range s.tenants {
+		if t.queue.Len() == 0 {
+			continue
+		}
+		// Queues are ordered by priority, so a held head holds the whole queue
+		if s.offPeak != nil && s.offPeak.Holds((*t.queue)[0].Job, now) {
+			continue
+		}
+		if limit := s.tenantLimit(t); limit > 0 && t.active >= limit {
+			continue
+		}
+
+		share := float64(t.active) / float64(t.weight)
+		if best == nil || share < bestShare || (share == bestShare && headBefore(t.queue, best.queue)) {
+			bestID, best, bestShare = id, t, share
+		}
+	}
+
+	return bestID, best
+}
+
+// headBefore reports whether the next job of a should run before the next job of b
+func headBefore(a, b *PriorityQueue) bool {
+	x, y := (*a)[0], (*b)[0]
+	if x.Priority != y.Priority {
+		return x.Priority > y.Priority
+	}
+	return x.Timestamp.Before(y.Timestamp)
+}
+
+// loadPendingJobs adds due pending jobs from the database that the scheduler
+// does not know yet: jobs whose run_at arrived or dependencies completed, or
+// submitted to other replicas
 func (s *JobScheduler) loadPendingJobs() error {
 	jobs, err := s.repo.GetPendingJobs(s.ctx, 1000)
 	if err != nil {
 		return err
 	}
 
+	before := s.GetQueueDepth()
 	for _, job := range jobs {
-		if err := s.ScheduleJob(job); err != nil {
+		if err := s.enqueue(job); err != nil {
 			log.Printf("Failed to schedule job %s: %v", job.ID, err)
 		}
 	}
 
-	log.Printf("Loaded %d pending jobs", len(jobs))
+	if loaded := s.GetQueueDepth() - before; loaded > 0 {
+		log.Printf("Loaded %d pending jobs", loaded)
+	}
 	return nil
 }
 
+// loadInFlightJobs counts jobs already dispatched, e.g. by a previous leader,
+// against the concurrency limits
+func (s *JobScheduler) loadInFlightJobs() ([]*models.Job, error) {
+	return s.repo.GetInFlightJobs(s.ctx, 10000)
+}
+
 // scheduleLoop is the main scheduling loop
 func (s *JobScheduler) scheduleLoop() {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
+	s.tick()
 	for {
 		select {
 		case <-s.ctx.Done():
 			return
 		case <-ticker.C:
-			s.processQueue()
+			s.tick()
 		}
 	}
 }
 
-// processQueue processes jobs from the priority queue
-func (s *JobScheduler) processQueue() {
+// tick runs one scheduling round if this replica leads
+func (s *JobScheduler) tick() {
+	if !s.electLeader() {
+		return
+	}
+
+	if err := s.loadPendingJobs(); err != nil {
+		log.Printf("Failed to load pending jobs: %v", err)
+	}
+	s.fireRecurringJobs()
+	s.reconcileActive()
+	s.republishStaleJobs()
+	s.processBatches()
+	s.processQueue()
+}
+
+// electLeader renews leadership. A replica taking over rebuilds its state from
+// the database; one losing it drops its queues so it stops dispatching.
+func (s *JobScheduler) electLeader() bool {
+	if s.election == nil {
+		return true
+	}
+
+	leader := s.election.elect(s.ctx)
+
+	var inFlight []*models.Job
+	if leader && !s.IsLeader() {
+		var err error
+		if inFlight, err = s.loadInFlightJobs(); err != nil {
+			log.Printf("Failed to load in-flight jobs: %v", err)
+			return false
+		}
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Check if we can process more jobs
-	for s.activeJobs < s.maxConcurrent && s.queue.Len() > 0 {
-		item := heap.Pop(s.queue).(*QueueItem)
+	if leader != s.leader {
+		s.tenants = make(map[string]*tenantState)
+		s.active = make(map[string]string)
+		s.pending = make(map[string]bool)
+		s.activeJobs = 0
+
+		for _, job := range inFlight {
+			tenantID := tenantOf(job)
+			s.active[job.ID] = tenantID
+			s.tenant(tenantID).active++
+			s.activeJobs++
+		}
+	}
+	s.leader = leader
+
+	return leader
+}
+
+// processQueue dispatches jobs by weighted fair share until the global limit
+// or every tenant's cap is reached. Each job's slot is reserved under the
+// lock; the job is then claimed and published without holding it.
+func (s *JobScheduler) processQueue() {
+	s.refreshPolicies()
+
+	for {
+		tenantID, item := s.reserveNext()
+		if item == nil {
+			return
+		}
+
+		// Claim the job so it is dispatched once, even across a leader change
+		claimed, err := s.repo.ClaimPendingJob(s.ctx, item.Job.ID)
+		if err != nil {
+			log.Printf("Failed to claim job %s: %v", item.Job.ID, err)
+			s.unreserve(tenantID, item, true)
+			return
+		}
+		if !claimed {
+			// Cancelled or dispatched elsewhere
+			s.unreserve(tenantID, item, false)
+			continue
+		}
 
 		// Publish job to worker queue
 		if err := s.publisher.PublishJob(s.ctx, item.Job); err != nil {
 			log.Printf("Failed to publish job %s: %v", item.Job.ID, err)
-			// Re-queue the job
-			heap.Push(s.queue, item)
-			break
+			// Release the claim and re-queue the job
+			if err := s.repo.UpdateJobStatus(s.ctx, item.Job.ID, models.JobStatusPending); err != nil {
+				log.Printf("Failed to update job status %s: %v", item.Job.ID, err)
+			}
+			s.unreserve(tenantID, item, true)
+			return
 		}
 
-		// Update job status to queued
-		if err := s.repo.UpdateJobStatus(s.ctx, item.Job.ID, models.JobStatusQueued); err != nil {
-			log.Printf("Failed to update job status %s: %v", item.Job.ID, err)
+		log.Printf("Scheduled job %s (tenant: %s, priority: %d, active: %d/%d)",
+			item.Job.ID, tenantID, item.Priority, s.GetActiveJobs(), s.maxConcurrent)
+	}
+}
+
+// reserveNext takes the next job to dispatch off its tenant's queue and counts
+// it as active, or returns nil once no job can be dispatched
+func (s *JobScheduler) reserveNext() (string, *QueueItem) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.leader || s.activeJobs >= s.maxConcurrent {
+		return "", nil
+	}
+	tenantID, t := s.nextTenant()
+	if t == nil {
+		return "", nil
+	}
+
+	item := heap.Pop(t.queue).(*QueueItem)
+	delete(s.pending, item.Job.ID)
+	s.active[item.Job.ID] = tenantID
+	s.activeJobs++
+	t.active++
+
+	return tenantID, item
+}
+
+// unreserve gives back the slot of a job that was not dispatched, putting it
+// back in its tenant's queue when requeue is set. Nothing is changed if the
+// slot went meanwhile, e.g. the job was cancelled or leadership changed.
+func (s *JobScheduler) unreserve(tenantID string, item *QueueItem, requeue bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.releaseSlot(item.Job.ID) {
+		return
+	}
+	if requeue {
+		heap.Push(s.tenant(tenantID).queue, item)
+		s.pending[item.Job.ID] = true
+	}
+}
+
+// releaseSlot frees the slot of an active job, reporting whether it had one
+func (s *JobScheduler) releaseSlot(jobID string) bool {
+	tenantID, exists := s.active[jobID]
+	if !exists {
+		return false
+	}
+	delete(s.active, jobID)
+
+	if s.activeJobs > 0 {
+		s.activeJobs--
+	}
+	if t, ok := s.tenants[tenantID]; ok && t.active > 0 {
+		t.active--
+	}
+	return true
+}
+
+// reconcileActive releases the slots of dispatched jobs that have finished.
+// Workers do not report back to the scheduler, so job status is the source of truth.
+func (s *JobScheduler) reconcileActive() {
+	s.mu.RLock()
+	jobIDs := make([]string, 0, len(s.active))
+	for jobID := range s.active {
+		jobIDs = append(jobIDs, jobID)
+	}
+	s.mu.RUnlock()
+
+	var finished []string
+	for _, jobID := range jobIDs {
+		job, err := s.repo.GetJobByID(s.ctx, jobID)
+		if err != nil {
+			log.Printf("Failed to get job %s: %v", jobID, err)
+			continue
 		}
 
-		s.activeJobs++
-		log.Printf("Scheduled job %s (priority: %d, active: %d/%d)",
-			item.Job.ID, item.Priority, s.activeJobs, s.maxConcurrent)
+		switch job.Status {
+		case models.JobStatusCompleted, models.JobStatusFailed, models.JobStatusCancelled:
+			finished = append(finished, jobID)
+		}
+	}
+
+	if len(finished) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, jobID := range finished {
+		s.releaseSlot(jobID)
+	}
+	log.Printf("Released %d finished jobs (active: %d/%d)", len(finished), s.activeJobs, s.maxConcurrent)
+}
+
+// republishStaleJobs publishes again the jobs queued for longer than
+// dispatchTimeout. Workers lease a job before running it, so a job that did
+// reach the queue still runs once.
+func (s *JobScheduler) republishStaleJobs() {
+	jobs, err := s.repo.GetStaleQueuedJobs(s.ctx, s.now().Add(-dispatchTimeout), 100)
+	if err != nil {
+		log.Printf("Failed to get stale queued jobs: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		// Restart the timeout first, so the job is republished once per timeout
+		touched, err := s.repo.TouchQueuedJob(s.ctx, job.ID)
+		if err != nil {
+			log.Printf("Failed to touch queued job %s: %v", job.ID, err)
+			continue
+		}
+		if !touched {
+			// Picked up by a worker meanwhile
+			continue
+		}
+
+		if err := s.publisher.PublishJob(s.ctx, job); err != nil {
+			log.Printf("Failed to republish job %s: %v", job.ID, err)
+			continue
+		}
+		log.Printf("Republished job %s queued since %s", job.ID, job.UpdatedAt.Format(time.RFC3339))
 	}
 }
 
@@ -152,19 +573,38 @@ func (s *JobScheduler) JobCompleted(jobID string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.activeJobs > 0 {
-		s.activeJobs--
+	if !s.releaseSlot(jobID) {
+		// Never dispatched, e.g. cancelled while pending
+		s.removePending(jobID)
+		return
 	}
 
 	log.Printf("Job %s completed (active: %d/%d)", jobID, s.activeJobs, s.maxConcurrent)
 }
 
+// removePending drops a job that has not been dispatched yet
+func (s *JobScheduler) removePending(jobID string) {
+	for _, t := range s.tenants {
+		for _, item := range *t.queue {
+			if item.Job.ID == jobID {
+				heap.Remove(t.queue, item.Index)
+				delete(s.pending, jobID)
+				return
+			}
+		}
+	}
+}
+
 // GetQueueDepth returns the current queue depth
 func (s *JobScheduler) GetQueueDepth() int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	return s.queue.Len()
+	depth := 0
+	for _, t := range s.tenants {
+		depth += t.queue.Len()
+	}
+	return depth
 }
 
 // GetActiveJobs returns the number of active jobs
@@ -175,6 +615,34 @@ func (s *JobScheduler) GetActiveJobs() int {
 	return s.activeJobs
 }
 
+// GetTenantStats returns the backlog and running jobs of every tenant with work
+func (s *JobScheduler) GetTenantStats() []TenantStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := make([]TenantStats, 0, len(s.tenants))
+	for id, t := range s.tenants {
+		if t.queue.Len() == 0 && t.active == 0 {
+			continue
+		}
+		stats = append(stats, TenantStats{
+			TenantID:      id,
+			Pending:       t.queue.Len(),
+			Active:        t.active,
+			Weight:        t.weight,
+			MaxConcurrent: s.tenantLimit(t),
+		})
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Pending != stats[j].Pending {
+			return stats[i].Pending > stats[j].Pending
+		}
+		return stats[i].TenantID < stats[j].TenantID
+	})
+	return stats
+}
+
 // PriorityQueue implements a priority queue for jobs
 type PriorityQueue []*QueueItem
 
@@ -2,6 +2,8 @@ package scheduler
 
 import (
 	"container/heap"
+	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -68,3 +70,451 @@ func TestPriorityQueueFIFO(t *testing.T) {
 		assert.Equal(t, expectedID, item.Job.ID, "FIFO order mismatch at position %d", i)
 	}
 }
+
+type fakeRepo struct {
+	users    map[string]*models.User
+	inFlight []*models.Job
+	queued   map[string]*models.Job // jobs queued since before the cutoff
+	cutoff   time.Time
+}
+
+func (r *fakeRepo) GetPendingJobs(ctx context.Context, limit int) ([]*models.Job, error) {
+	return nil, nil
+}
+
+func (r *fakeRepo) UpdateJobStatus(ctx context.Context, jobID, status string) error {
+	return nil
+}
+
+func (r *fakeRepo) GetJobByID(ctx context.Context, jobID string) (*models.Job, error) {
+	return &models.Job{ID: jobID, Status: models.JobStatusQueued}, nil
+}
+
+func (r *fakeRepo) GetInFlightJobs(ctx context.Context, limit int) ([]*models.Job, error) {
+	return r.inFlight, nil
+}
+
+func (r *fakeRepo) ClaimPendingJob(ctx context.Context, jobID string) (bool, error) {
+	return true, nil
+}
+
+func (r *fakeRepo) GetStaleQueuedJobs(ctx context.Context, cutoff time.Time, limit int) ([]*models.Job, error) {
+	r.cutoff = cutoff
+	var jobs []*models.Job
+	for _, job := range r.queued {
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (r *fakeRepo) TouchQueuedJob(ctx context.Context, jobID string) (bool, error) {
+	_, queued := r.queued[jobID]
+	delete(r.queued, jobID)
+	return queued, nil
+}
+
+func (r *fakeRepo) GetUserByID(ctx context.Context, userID string) (*models.User, error) {
+	if user, ok := r.users[userID]; ok {
+		return user, nil
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+type fakePublisher struct {
+	published []*models.Job
+}
+
+func (p *fakePublisher) PublishJob(ctx context.Context, job *models.Job) error {
+	p.published = append(p.published, job)
+	return nil
+}
+
+func tenantJobs(userID string, n, priority int) []*models.Job {
+	jobs := make([]*models.Job, n)
+	for i := range jobs {
+		jobs[i] = &models.Job{ID: fmt.Sprintf("%s-%d", userID, i), UserID: &userID, Priority: priority}
+	}
+	return jobs
+}
+
+func TestSchedulerFairShare(t *testing.T) {
+	pub := &fakePublisher{}
+	s := NewScheduler(&fakeRepo{}, pub, 4)
+
+	// A large backlog from one tenant must not starve a later one
+	for _, job := range tenantJobs("bulk", 100, models.JobPriorityNormal) {
+		assert.NoError(t, s.ScheduleJob(job))
+	}
+	for _, job := range tenantJobs("small", 2, models.JobPriorityNormal) {
+		assert.NoError(t, s.ScheduleJob(job))
+	}
+
+	s.processQueue()
+
+	counts := map[string]int{}
+	for _, job := range pub.published {
+		counts[*job.UserID]++
+	}
+	assert.Equal(t, 2, counts["bulk"])
+	assert.Equal(t, 2, counts["small"])
+	assert.Equal(t, 98, s.GetQueueDepth())
+}
+
+func TestSchedulerWeightsAndCaps(t *testing.T) {
+	repo := &fakeRepo{users: map[string]*models.User{
+		"gold":   {ID: "gold", SchedulingWeight: 3},
+		"capped": {ID: "capped", SchedulingWeight: 1, MaxConcurrentJobs: 1},
+	}}
+	pub := &fakePublisher{}
+	s := NewScheduler(repo, pub, 8)
+
+	for _, user := range []string{"gold", "capped", "plain"} {
+		for _, job := range tenantJobs(user, 10, models.JobPriorityNormal) {
+			assert.NoError(t, s.ScheduleJob(job))
+		}
+	}
+
+	s.processQueue()
+
+	stats := map[string]TenantStats{}
+	for _, st := range s.GetTenantStats() {
+		stats[st.TenantID] = st
+	}
+	assert.Equal(t, 1, stats["capped"].Active)
+	assert.Equal(t, 5, stats["gold"].Active)
+	assert.Equal(t, 2, stats["plain"].Active)
+	assert.Equal(t, 9, stats["capped"].Pending)
+}
+
+func TestSchedulerPriorityWithinTenant(t *testing.T) {
+	pub := &fakePublisher{}
+	s := NewScheduler(&fakeRepo{}, pub, 1)
+
+	user := "user-1"
+	assert.NoError(t, s.ScheduleJob(&models.Job{ID: "low", UserID: &user, Priority: models.JobPriorityLow}))
+	assert.NoError(t, s.ScheduleJob(&models.Job{ID: "high", UserID: &user, Priority: models.JobPriorityHigh}))
+
+	s.processQueue()
+
+	if assert.Len(t, pub.published, 1) {
+		assert.Equal(t, "high", pub.published[0].ID)
+	}
+}
+
+func TestSchedulerJobCompleted(t *testing.T) {
+	pub := &fakePublisher{}
+	s := NewScheduler(&fakeRepo{}, pub, 1)
+
+	jobs := tenantJobs("user-1", 3, models.JobPriorityNormal)
+	for _, job := range jobs {
+		assert.NoError(t, s.ScheduleJob(job))
+	}
+
+	s.processQueue()
+	assert.Equal(t, 1, s.GetActiveJobs())
+
+	// Cancelling a pending job removes it without freeing a slot
+	s.JobCompleted(jobs[2].ID)
+	assert.Equal(t, 1, s.GetActiveJobs())
+	assert.Equal(t, 1, s.GetQueueDepth())
+
+	s.JobCompleted(jobs[0].ID)
+	assert.Equal(t, 0, s.GetActiveJobs())
+
+	s.processQueue()
+	assert.Equal(t, jobs[1].ID, pub.published[1].ID)
+}
+
+// unlockedRepo fails the test when the scheduler lock is held during a
+// repository or publisher call
+type unlockedRepo struct {
+	fakeRepo
+	t *testing.T
+	s *JobScheduler
+}
+
+func (r *unlockedRepo) assertUnlocked(call string) {
+	if !r.s.mu.TryLock() {
+		r.t.Errorf("%s called with the scheduler lock held", call)
+		return
+	}
+	r.s.mu.Unlock()
+}
+
+func (r *unlockedRepo) ClaimPendingJob(ctx context.Context, jobID string) (bool, error) {
+	r.assertUnlocked("ClaimPendingJob")
+	return jobID != "user-1-1", nil
+}
+
+func (r *unlockedRepo) GetUserByID(ctx context.Context, userID string) (*models.User, error) {
+	r.assertUnlocked("GetUserByID")
+	return &models.User{ID: userID, SchedulingWeight: 1}, nil
+}
+
+func (r *unlockedRepo) PublishJob(ctx context.Context, job *models.Job) error {
+	r.assertUnlocked("PublishJob")
+	return nil
+}
+
+func TestSchedulerCallsRepositoryWithoutLock(t *testing.T) {
+	repo := &unlockedRepo{t: t}
+	s := NewScheduler(repo, repo, 4)
+	repo.s = s
+
+	for _, job := range tenantJobs("user-1", 3, models.JobPriorityNormal) {
+		assert.NoError(t, s.ScheduleJob(job))
+	}
+
+	s.processQueue()
+
+	// The job that could not be claimed gives its slot back
+	assert.Equal(t, 2, s.GetActiveJobs())
+	assert.Equal(t, 0, s.GetQueueDepth())
+}
+
+func TestSchedulerHoldsJobsUntilRunAt(t *testing.T) {
+	pub := &fakePublisher{}
+	s := NewScheduler(&fakeRepo{}, pub, 4)
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	later := now.Add(time.Hour)
+	user := "user-1"
+	assert.NoError(t, s.ScheduleJob(&models.Job{ID: "later", UserID: &user, RunAt: &later}))
+	assert.NoError(t, s.ScheduleJob(&models.Job{ID: "now", UserID: &user}))
+
+	s.processQueue()
+
+	if assert.Len(t, pub.published, 1) {
+		assert.Equal(t, "now", pub.published[0].ID)
+	}
+	assert.Equal(t, 0, s.GetQueueDepth())
+}
+
+func TestSchedulerOffPeakWindow(t *testing.T) {
+	window, err := NewOffPeakWindow("22:00", "06:00", "UTC", models.JobPriorityNormal)
+	assert.NoError(t, err)
+
+	pub := &fakePublisher{}
+	s := NewScheduler(&fakeRepo{}, pub, 4)
+	s.SetOffPeakWindow(window)
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	assert.NoError(t, s.ScheduleJob(&models.Job{ID: "bulk", UserID: strPtr("a"), Priority: models.JobPriorityLow}))
+	assert.NoError(t, s.ScheduleJob(&models.Job{ID: "urgent", UserID: strPtr("b"), Priority: models.JobPriorityHigh}))
+
+	s.processQueue()
+	if assert.Len(t, pub.published, 1) {
+		assert.Equal(t, "urgent", pub.published[0].ID)
+	}
+
+	// Low priority work runs once the window opens
+	now = time.Date(2026, 1, 1, 23, 0, 0, 0, time.UTC)
+	s.processQueue()
+	if assert.Len(t, pub.published, 2) {
+		assert.Equal(t, "bulk", pub.published[1].ID)
+	}
+}
+
+func TestSchedulerRepublishesStaleQueuedJobs(t *testing.T) {
+	// The previous leader claimed the job and died before publishing it
+	repo := &fakeRepo{queued: map[string]*models.Job{
+		"stranded": {ID: "stranded", Status: models.JobStatusQueued},
+	}}
+	pub := &fakePublisher{}
+	s := NewScheduler(repo, pub, 4)
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	s.republishStaleJobs()
+	assert.Equal(t, now.Add(-dispatchTimeout), repo.cutoff)
+	if assert.Len(t, pub.published, 1) {
+		assert.Equal(t, "stranded", pub.published[0].ID)
+	}
+
+	// Its timeout restarted, so it is not published again on the next tick
+	s.republishStaleJobs()
+	assert.Len(t, pub.published, 1)
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+type fakeLeaseStore struct {
+	holder string
+}
+
+func (l *fakeLeaseStore) AcquireSchedulerLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	if l.holder == "" || l.holder == holder {
+		l.holder = holder
+		return true, nil
+	}
+	return false, nil
+}
+
+func (l *fakeLeaseStore) ReleaseSchedulerLease(ctx context.Context, name, holder string) error {
+	if l.holder == holder {
+		l.holder = ""
+	}
+	return nil
+}
+
+func TestSchedulerLeaderElection(t *testing.T) {
+	user := "user-1"
+	repo := &fakeRepo{inFlight: []*models.Job{{ID: "running", UserID: &user, Status: models.JobStatusProcessing}}}
+	leases := &fakeLeaseStore{}
+
+	pubA, pubB := &fakePublisher{}, &fakePublisher{}
+	a := NewScheduler(repo, pubA, 2)
+	b := NewScheduler(repo, pubB, 2)
+	a.SetLeaderElection(leases, "a", time.Minute)
+	b.SetLeaderElection(leases, "b", time.Minute)
+
+	assert.True(t, a.electLeader())
+	assert.False(t, b.electLeader())
+	assert.True(t, a.IsLeader())
+	assert.False(t, b.IsLeader())
+
+	// The leader resumes counting jobs dispatched before it took over
+	assert.Equal(t, 1, a.GetActiveJobs())
+
+	// Followers leave submitted jobs pending for the leader
+	assert.NoError(t, b.ScheduleJob(&models.Job{ID: "job-1", UserID: &user}))
+	assert.Equal(t, 0, b.GetQueueDepth())
+
+	a.election.resign()
+	assert.True(t, b.electLeader())
+	assert.Equal(t, 1, b.GetActiveJobs())
+}
+
+type fakeRecurringStore struct {
+	due      []*models.RecurringJob
+	advanced map[string]bool
+	created  []*models.Job
+}
+
+func (f *fakeRecurringStore) ListDueRecurringJobs(ctx context.Context, now time.Time, limit int) ([]*models.RecurringJob, error) {
+	return f.due, nil
+}
+
+func (f *fakeRecurringStore) AdvanceRecurringJob(ctx context.Context, id string, from, next time.Time, jobID string) (bool, error) {
+	if f.advanced[id] {
+		return false, nil
+	}
+	f.advanced[id] = true
+	return true, nil
+}
+
+func (f *fakeRecurringStore) GetVideo(ctx context.Context, id string) (*models.Video, error) {
+	return &models.Video{ID: id}, nil
+}
+
+func (f *fakeRecurringStore) CreateJob(ctx context.Context, job *models.Job) error {
+	f.created = append(f.created, job)
+	return nil
+}
+
+func TestSchedulerFiresRecurringJobsOnce(t *testing.T) {
+	user := "user-1"
+	store := &fakeRecurringStore{
+		advanced: map[string]bool{},
+		due: []*models.RecurringJob{{
+			ID:        "nightly",
+			UserID:    &user,
+			VideoID:   "video-1",
+			Schedule:  "0 3 * * *",
+			Timezone:  "UTC",
+			Priority:  models.JobPriorityNormal,
+			Enabled:   true,
+			NextRunAt: time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC),
+		}},
+	}
+
+	pub := &fakePublisher{}
+	s := NewScheduler(&fakeRepo{}, pub, 4)
+	s.SetRecurringStore(store)
+	s.now = func() time.Time { return time.Date(2026, 1, 1, 3, 0, 30, 0, time.UTC) }
+
+	s.fireRecurringJobs()
+	s.fireRecurringJobs()
+
+	if assert.Len(t, store.created, 1) {
+		assert.Equal(t, "video-1", store.created[0].VideoID)
+		assert.Equal(t, models.JobStatusPending, store.created[0].Status)
+	}
+	assert.Equal(t, 1, s.GetQueueDepth())
+}
+
+func TestSchedulerWaitsForDependencies(t *testing.T) {
+	pub := &fakePublisher{}
+	s := NewScheduler(&fakeRepo{}, pub, 4)
+
+	user := "user-1"
+	assert.NoError(t, s.ScheduleJob(&models.Job{ID: "encode", UserID: &user}))
+	assert.NoError(t, s.ScheduleJob(&models.Job{ID: "package", UserID: &user, DependsOn: []string{"encode"}}))
+
+	s.processQueue()
+
+	if assert.Len(t, pub.published, 1) {
+		assert.Equal(t, "encode", pub.published[0].ID)
+	}
+	assert.Equal(t, 0, s.GetQueueDepth())
+}
+
+type fakeBatchStore struct {
+	finished []*models.Batch
+	closed   map[string]bool
+}
+
+func (f *fakeBatchStore) FailBlockedJobs(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+func (f *fakeBatchStore) ListFinishedBatches(ctx context.Context, limit int) ([]*models.Batch, error) {
+	return f.finished, nil
+}
+
+func (f *fakeBatchStore) FinishBatch(ctx context.Context, batch *models.Batch) (bool, error) {
+	if f.closed[batch.ID] {
+		return false, nil
+	}
+	f.closed[batch.ID] = true
+	batch.Status = batch.FinalStatus()
+	return true, nil
+}
+
+type fakeBatchNotifier struct {
+	notified []*models.Batch
+}
+
+func (n *fakeBatchNotifier) NotifyBatchCompleted(ctx context.Context, batch *models.Batch) error {
+	n.notified = append(n.notified, batch)
+	return nil
+}
+
+func TestSchedulerNotifiesFinishedBatchesOnce(t *testing.T) {
+	store := &fakeBatchStore{
+		closed: map[string]bool{},
+		finished: []*models.Batch{
+			{ID: "season-1", TotalJobs: 2, Counts: models.BatchCounts{Completed: 2}},
+			{ID: "season-2", TotalJobs: 2, Counts: models.BatchCounts{Completed: 1, Failed: 1}},
+		},
+	}
+	notifier := &fakeBatchNotifier{}
+
+	s := NewScheduler(&fakeRepo{}, &fakePublisher{}, 4)
+	s.SetBatchStore(store, notifier)
+
+	s.processBatches()
+	s.processBatches()
+
+	if assert.Len(t, notifier.notified, 2) {
+		assert.Equal(t, models.BatchStatusCompleted, notifier.notified[0].Status)
+		assert.Equal(t, models.BatchStatusFailed, notifier.notified[1].Status)
+	}
+}
@@ -0,0 +1,171 @@
+package scte35
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cue is an ad break to signal in a media playlist
+type Cue struct {
+	EventID  uint32
+	Start    time.Time
+	Duration time.Duration
+}
+
+// End returns the time the ad break finishes
+func (c Cue) End() time.Time {
+	return c.Start.Add(c.Duration)
+}
+
+// dateRangeID identifies the EXT-X-DATERANGE tags written for a cue
+func (c Cue) dateRangeID() string {
+	return fmt.Sprintf("splice-%d", c.EventID)
+}
+
+// splice boundaries within this distance of a segment start snap to it
+const boundaryTolerance = 50 * time.Millisecond
+
+const dateFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// TagPlaylist inserts EXT-X-CUE-OUT/EXT-X-CUE-IN and EXT-X-DATERANGE tags into
+// a media playlist. Segment times come from EXT-X-PROGRAM-DATE-TIME, falling
+// back to base plus the EXTINF durations; a PROGRAM-DATE-TIME is added when the
+// playlist has none, since DATERANGE requires one. Each tag is placed before the
+// first segment starting at or after the splice point. Cue tags already in the
+// playlist are replaced, so tagging is idempotent.
+func TagPlaylist(playlist string, cues []Cue, base time.Time) string {
+	lines := strings.Split(strings.TrimRight(playlist, "\n"), "\n")
+
+	hasDateTime := false
+	for _, line := range lines {
+		if strings.HasPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:") {
+			hasDateTime = true
+			break
+		}
+	}
+
+	var out []string
+	segmentStart := base
+	pendingDuration := time.Duration(0)
+	firstSegment := true
+	var segmentTags []string
+	states := make([]cueState, len(cues))
+
+	for _, line := range lines {
+		switch {
+		case isCueTag(line):
+			continue
+		case strings.HasPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:"):
+			if t, ok := ParseDateTime(strings.TrimPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:")); ok {
+				segmentStart = t
+			}
+			segmentTags = append(segmentTags, line)
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value := strings.TrimPrefix(line, "#EXTINF:")
+			if i := strings.Index(value, ","); i >= 0 {
+				value = value[:i]
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+				pendingDuration = time.Duration(seconds * float64(time.Second))
+			}
+			segmentTags = append(segmentTags, line)
+		case strings.HasPrefix(line, "#EXT-X-DISCONTINUITY") || (strings.HasPrefix(line, "#") && len(segmentTags) > 0):
+			segmentTags = append(segmentTags, line)
+		case line != "" && !strings.HasPrefix(line, "#"):
+			// Segment URI: emit cue tags for this segment, then the segment
+			if firstSegment && !hasDateTime {
+				out = append(out, "#EXT-X-PROGRAM-DATE-TIME:"+segmentStart.UTC().Format(dateFormat))
+			}
+			for i, cue := range cues {
+				out = append(out, states[i].tagsAt(cue, segmentStart, firstSegment)...)
+			}
+			out = append(out, segmentTags...)
+			out = append(out, line)
+
+			segmentTags = nil
+			firstSegment = false
+			segmentStart = segmentStart.Add(pendingDuration)
+			pendingDuration = 0
+		default:
+			out = append(out, line)
+		}
+	}
+	out = append(out, segmentTags...)
+
+	return strings.Join(out, "\n") + "\n"
+}
+
+// cueState tracks which tags have been written for a cue
+type cueState struct {
+	started bool
+	done    bool
+}
+
+// tagsAt returns the tags to place before a segment starting at start
+func (st *cueState) tagsAt(cue Cue, start time.Time, firstSegment bool) []string {
+	if st.done {
+		return nil
+	}
+
+	if !st.started {
+		if start.Before(cue.Start.Add(-boundaryTolerance)) {
+			return nil
+		}
+		st.started = true
+
+		if !firstSegment || !start.After(cue.Start.Add(boundaryTolerance)) {
+			return cueOutTags(cue)
+		}
+
+		// The playlist window starts after the splice point
+		if start.Before(cue.End().Add(-boundaryTolerance)) {
+			return []string{fmt.Sprintf("#EXT-X-CUE-OUT-CONT:ElapsedTime=%.3f,Duration=%.3f",
+				start.Sub(cue.Start).Seconds(), cue.Duration.Seconds())}
+		}
+		st.done = true
+		return nil
+	}
+
+	if start.Before(cue.End().Add(-boundaryTolerance)) {
+		return nil
+	}
+	st.done = true
+	return cueInTags(cue)
+}
+
+// ParseDateTime parses an EXT-X-PROGRAM-DATE-TIME value as written by FFmpeg or RFC 3339
+func ParseDateTime(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.000-0700"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func cueOutTags(cue Cue) []string {
+	out := SpliceInsert{EventID: cue.EventID, OutOfNetwork: true, Duration: cue.Duration, AutoReturn: true}
+	return []string{
+		fmt.Sprintf("#EXT-X-DATERANGE:ID=\"%s\",START-DATE=\"%s\",PLANNED-DURATION=%.3f,SCTE35-OUT=%s",
+			cue.dateRangeID(), cue.Start.UTC().Format(dateFormat), cue.Duration.Seconds(), out.Hex()),
+		fmt.Sprintf("#EXT-X-CUE-OUT:DURATION=%.3f", cue.Duration.Seconds()),
+	}
+}
+
+func cueInTags(cue Cue) []string {
+	in := SpliceInsert{EventID: cue.EventID}
+	return []string{
+		fmt.Sprintf("#EXT-X-DATERANGE:ID=\"%s\",START-DATE=\"%s\",END-DATE=\"%s\",DURATION=%.3f,SCTE35-IN=%s",
+			cue.dateRangeID(), cue.Start.UTC().Format(dateFormat), cue.End().UTC().Format(dateFormat), cue.Duration.Seconds(), in.Hex()),
+		"#EXT-X-CUE-IN",
+	}
+}
+
+// isCueTag reports whether a line is a tag written by TagPlaylist
+func isCueTag(line string) bool {
+	return strings.HasPrefix(line, "#EXT-X-CUE-OUT") ||
+		strings.HasPrefix(line, "#EXT-X-CUE-IN") ||
+		strings.HasPrefix(line, "#EXT-X-DATERANGE:ID=\"splice-")
+}
@@ -0,0 +1,135 @@
+package scte35
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// SCTE-35 section constants
+const (
+	tableID              = 0xFC
+	spliceInsertCommand  = 0x05
+	ticksPerSecond       = 90000
+	unlimitedTier        = 0xFFF
+	spliceInsertNoTime   = 10 // splice_insert length without break_duration
+	breakDurationLength  = 5
+	sectionHeaderLength  = 11 // protocol_version through splice_command_type
+	descriptorLoopLength = 2
+	crcLength            = 4
+)
+
+// SpliceInsert describes an immediate splice_insert command
+type SpliceInsert struct {
+	EventID      uint32
+	OutOfNetwork bool          // true for the start of an ad break, false for the return
+	Duration     time.Duration // break duration, only signalled on cue-out
+	AutoReturn   bool
+}
+
+// Encode builds the binary splice_info_section for the splice_insert
+func (s SpliceInsert) Encode() []byte {
+	hasDuration := s.OutOfNetwork && s.Duration > 0
+
+	commandLength := spliceInsertNoTime
+	if hasDuration {
+		commandLength += breakDurationLength
+	}
+	sectionLength := sectionHeaderLength + commandLength + descriptorLoopLength + crcLength
+
+	w := &bitWriter{}
+
+	// splice_info_section header
+	w.write(tableID, 8)
+	w.write(0, 1) // section_syntax_indicator
+	w.write(0, 1) // private_indicator
+	w.write(3, 2) // sap_type: not specified
+	w.write(uint64(sectionLength), 12)
+	w.write(0, 8)  // protocol_version
+	w.write(0, 1)  // encrypted_packet
+	w.write(0, 6)  // encryption_algorithm
+	w.write(0, 33) // pts_adjustment
+	w.write(0, 8)  // cw_index
+	w.write(unlimitedTier, 12)
+	w.write(uint64(commandLength), 12)
+	w.write(spliceInsertCommand, 8)
+
+	// splice_insert()
+	w.write(uint64(s.EventID), 32)
+	w.write(0, 1)    // splice_event_cancel_indicator
+	w.write(0x7F, 7) // reserved
+	w.write(boolBit(s.OutOfNetwork), 1)
+	w.write(1, 1) // program_splice_flag
+	w.write(boolBit(hasDuration), 1)
+	w.write(1, 1)   // splice_immediate_flag
+	w.write(0xF, 4) // reserved
+	if hasDuration {
+		w.write(boolBit(s.AutoReturn), 1)
+		w.write(0x3F, 6) // reserved
+		w.write(uint64(s.Duration.Seconds()*ticksPerSecond), 33)
+	}
+	w.write(uint64(s.EventID&0xFFFF), 16) // unique_program_id
+	w.write(0, 8)                         // avail_num
+	w.write(0, 8)                         // avails_expected
+
+	w.write(0, 16) // descriptor_loop_length
+	w.write(uint64(crc32MPEG2(w.bytes())), 32)
+
+	return w.bytes()
+}
+
+// Hex returns the section as a 0x-prefixed hex string for EXT-X-DATERANGE
+func (s SpliceInsert) Hex() string {
+	return "0x" + strings.ToUpper(hex.EncodeToString(s.Encode()))
+}
+
+// Base64 returns the section base64 encoded
+func (s SpliceInsert) Base64() string {
+	return base64.StdEncoding.EncodeToString(s.Encode())
+}
+
+func boolBit(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// bitWriter packs big-endian bit fields into bytes
+type bitWriter struct {
+	buf   []byte
+	nbits int
+}
+
+func (w *bitWriter) write(value uint64, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		if w.nbits%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if value>>uint(i)&1 == 1 {
+			w.buf[len(w.buf)-1] |= 1 << uint(7-w.nbits%8)
+		}
+		w.nbits++
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	return w.buf
+}
+
+// crc32MPEG2 computes the CRC-32/MPEG-2 checksum used by SCTE-35
+func crc32MPEG2(data []byte) uint32 {
+	crc := uint32(0xFFFFFFFF)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04C11DB7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,135 @@
+package scte35
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCRC32MPEG2(t *testing.T) {
+	assert.Equal(t, uint32(0x0376E6E7), crc32MPEG2([]byte("123456789")))
+}
+
+func TestSpliceInsert_Encode(t *testing.T) {
+	tests := []struct {
+		name     string
+		splice   SpliceInsert
+		length   int
+		duration bool
+	}{
+		{"CueOut", SpliceInsert{EventID: 42, OutOfNetwork: true, Duration: 30 * time.Second, AutoReturn: true}, 35, true},
+		{"CueIn", SpliceInsert{EventID: 42}, 30, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			section := tt.splice.Encode()
+			require.Len(t, section, tt.length)
+
+			assert.Equal(t, byte(0xFC), section[0])
+			sectionLength := int(section[1]&0x0F)<<8 | int(section[2])
+			assert.Equal(t, len(section)-3, sectionLength)
+			assert.Equal(t, byte(spliceInsertCommand), section[13])
+
+			// splice_event_id
+			assert.Equal(t, []byte{0, 0, 0, 42}, section[14:18])
+
+			flags := section[19]
+			assert.Equal(t, tt.splice.OutOfNetwork, flags&0x80 != 0)
+			assert.Equal(t, tt.duration, flags&0x20 != 0)
+
+			if tt.duration {
+				ticks := uint64(section[20]&0x01)<<32 | uint64(section[21])<<24 | uint64(section[22])<<16 |
+					uint64(section[23])<<8 | uint64(section[24])
+				assert.Equal(t, uint64(30*ticksPerSecond), ticks)
+			}
+
+			// CRC over the whole section including the CRC is zero
+			assert.Equal(t, uint32(0), crc32MPEG2(section))
+		})
+	}
+}
+
+func TestSpliceInsert_Hex(t *testing.T) {
+	hex := SpliceInsert{EventID: 1}.Hex()
+	assert.True(t, strings.HasPrefix(hex, "0xFC"))
+	assert.Len(t, hex, 2+30*2)
+}
+
+func TestTagPlaylist_VOD(t *testing.T) {
+	playlist := strings.Join([]string{
+		"#EXTM3U",
+		"#EXT-X-VERSION:3",
+		"#EXT-X-TARGETDURATION:6",
+		"#EXT-X-PLAYLIST-TYPE:VOD",
+		"#EXTINF:6.000000,",
+		"stream_720p_000.ts",
+		"#EXTINF:6.000000,",
+		"stream_720p_001.ts",
+		"#EXTINF:6.000000,",
+		"stream_720p_002.ts",
+		"#EXTINF:6.000000,",
+		"stream_720p_003.ts",
+		"#EXT-X-ENDLIST",
+	}, "\n")
+
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cues := []Cue{{EventID: 7, Start: base.Add(6 * time.Second), Duration: 10 * time.Second}}
+
+	tagged := TagPlaylist(playlist, cues, base)
+	lines := strings.Split(strings.TrimSpace(tagged), "\n")
+
+	assert.Contains(t, tagged, "#EXT-X-PROGRAM-DATE-TIME:2025-01-01T12:00:00.000Z")
+
+	outIdx := indexOf(lines, "#EXT-X-CUE-OUT:DURATION=10.000")
+	inIdx := indexOf(lines, "#EXT-X-CUE-IN")
+	require.NotEqual(t, -1, outIdx)
+	require.NotEqual(t, -1, inIdx)
+
+	// Cue-out before segment 1, cue-in before segment 3 (first boundary after 16s)
+	assert.Equal(t, "stream_720p_001.ts", lines[outIdx+2])
+	assert.Equal(t, "stream_720p_003.ts", lines[inIdx+2])
+	assert.True(t, strings.HasPrefix(lines[outIdx-1], `#EXT-X-DATERANGE:ID="splice-7"`))
+	assert.Contains(t, lines[outIdx-1], "SCTE35-OUT=0xFC")
+	assert.Contains(t, lines[inIdx-1], "SCTE35-IN=0xFC")
+
+	// Tagging again produces the same playlist
+	assert.Equal(t, tagged, TagPlaylist(tagged, cues, base))
+}
+
+func TestTagPlaylist_LiveWindowInsideBreak(t *testing.T) {
+	playlist := strings.Join([]string{
+		"#EXTM3U",
+		"#EXT-X-MEDIA-SEQUENCE:10",
+		"#EXT-X-PROGRAM-DATE-TIME:2025-01-01T12:01:00.000+0000",
+		"#EXTINF:6.000000,",
+		"720p_010.ts",
+		"#EXT-X-PROGRAM-DATE-TIME:2025-01-01T12:01:06.000+0000",
+		"#EXTINF:6.000000,",
+		"720p_011.ts",
+	}, "\n")
+
+	cueStart := time.Date(2025, 1, 1, 12, 0, 57, 0, time.UTC)
+	cues := []Cue{{EventID: 8, Start: cueStart, Duration: 9 * time.Second}}
+
+	tagged := TagPlaylist(playlist, cues, time.Time{})
+	assert.Contains(t, tagged, "#EXT-X-CUE-OUT-CONT:ElapsedTime=3.000,Duration=9.000")
+	assert.NotContains(t, tagged, "#EXT-X-CUE-OUT:")
+
+	lines := strings.Split(strings.TrimSpace(tagged), "\n")
+	inIdx := indexOf(lines, "#EXT-X-CUE-IN")
+	require.NotEqual(t, -1, inIdx)
+	assert.Equal(t, "720p_011.ts", lines[inIdx+3])
+}
+
+func indexOf(lines []string, value string) int {
+	for i, line := range lines {
+		if line == value {
+			return i
+		}
+	}
+	return -1
+}
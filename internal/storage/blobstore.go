@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/therealutkarshpriyadarshi/transcode/internal/config"
+)
+
+// Storage drivers selectable through config.StorageConfig.Driver
+const (
+	DriverS3     = "s3"
+	DriverMinIO  = "minio"
+	DriverLocal  = "local"
+	DriverMemory = "memory"
+)
+
+// DefaultURLExpiry is how long URLs returned by GetURL stay valid
+const DefaultURLExpiry = time.Hour
+
+// ErrObjectNotFound is returned by Stat, Get and GetRange for missing objects
+var ErrObjectNotFound = errors.New("object not found")
+
+// Blobstore stores the objects of videos and their outputs under slash
+// separated keys
+type Blobstore interface {
+	// Put stores size bytes read from reader under key, replacing any object
+	// already there. A size of -1 reads until EOF.
+	Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error
+
+	// Get opens the object under key
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// GetRange opens length bytes of the object under key starting at offset.
+	// A length of -1 reads to the end of the object.
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+
+	// Stat returns the object under key without reading it
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+
+	// List returns the objects whose key starts with prefix, sorted by key
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+
+	// Delete removes the object under key. Deleting a missing object succeeds.
+	Delete(ctx context.Context, key string) error
+
+	// Copy copies the object under srcKey to dstKey
+	Copy(ctx context.Context, srcKey, dstKey string) error
+
+	// Presign returns a URL the object under key can be downloaded from
+	// without credentials until expiry passes
+	Presign(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+	Metadata     map[string]string
+}
+
+// MultipartUploader is implemented by drivers that upload large objects in
+// parallel parts
+type MultipartUploader interface {
+	PutMultipart(ctx context.Context, key string, reader io.Reader, size int64, contentType string, partSize int64, concurrency int) error
+}
+
+// MetadataSetter is implemented by drivers that store user metadata on objects
+type MetadataSetter interface {
+	SetMetadata(ctx context.Context, key string, metadata map[string]string) error
+}
+
+// New creates the blobstore selected by cfg.Driver, defaulting to S3
+func New(cfg config.StorageConfig) (Blobstore, error) {
+	switch cfg.Driver {
+	case "", DriverS3, DriverMinIO:
+		return NewMinIOStore(cfg)
+	case DriverLocal:
+		return NewLocalStore(cfg.LocalPath, cfg.BaseURL)
+	case DriverMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %s", cfg.Driver)
+	}
+}
+
+// UploadFile uploads a file from the local filesystem
+func UploadFile(ctx context.Context, store Blobstore, key, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	if err := store.Put(ctx, key, file, info.Size(), getContentType(filePath)); err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+	return nil
+}
+
+// UploadFileHashed uploads a file from the local filesystem, returning the hex
+// SHA-256 of its content computed while it streams to the store
+func UploadFileHashed(ctx context.Context, store Blobstore, key, filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	hash := sha256.New()
+	reader := io.TeeReader(file, hash)
+	if err := store.Put(ctx, key, reader, info.Size(), getContentType(filePath)); err != nil {
+		return "", fmt.Errorf("failed to upload file: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Checksum returns the hex SHA-256 of a stored object, streaming it through
+// the hash without buffering it
+func Checksum(ctx context.Context, store Blobstore, key string) (string, error) {
+	reader, err := store.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", fmt.Errorf("failed to read object: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// DeletePrefix removes every object whose key starts with prefix, returning
+// how many it removed
+func DeletePrefix(ctx context.Context, store Blobstore, prefix string) (int, error) {
+	objects, err := store.List(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, object := range objects {
+		if err := store.Delete(ctx, object.Key); err != nil {
+			return i, err
+		}
+	}
+	return len(objects), nil
+}
+
+// DownloadFile downloads an object to the local filesystem
+func DownloadFile(ctx context.Context, store Blobstore, key, filePath string) error {
+	object, err := store.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to download file: %w", err)
+	}
+	defer object.Close()
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	if _, err := io.Copy(file, object); err != nil {
+		file.Close()
+		os.Remove(filePath)
+		return fmt.Errorf("failed to download file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return nil
+}
+
+// GetURL returns a URL for an object, valid for DefaultURLExpiry
+func GetURL(ctx context.Context, store Blobstore, key string) (string, error) {
+	url, err := store.Presign(ctx, key, DefaultURLExpiry)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate URL: %w", err)
+	}
+	return url, nil
+}
+
+// getContentType returns the content type based on file extension
+func getContentType(filePath string) string {
+	ext := filepath.Ext(filePath)
+	switch ext {
+	case ".mp4":
+		return "video/mp4"
+	case ".mov":
+		return "video/quicktime"
+	case ".avi":
+		return "video/x-msvideo"
+	case ".mkv":
+		return "video/x-matroska"
+	case ".webm":
+		return "video/webm"
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".ts":
+		return "video/mp2t"
+	default:
+		return "application/octet-stream"
+	}
+}
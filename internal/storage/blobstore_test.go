@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/therealutkarshpriyadarshi/transcode/internal/config"
+)
+
+// testBlobstore runs the behaviour every driver must share
+func testBlobstore(t *testing.T, store Blobstore) {
+	ctx := context.Background()
+
+	put := func(key, data string) {
+		t.Helper()
+		if err := store.Put(ctx, key, strings.NewReader(data), int64(len(data)), "video/mp4"); err != nil {
+			t.Fatalf("Put(%q) error = %v", key, err)
+		}
+	}
+	read := func(reader io.ReadCloser, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("read error = %v", err)
+		}
+		defer reader.Close()
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("read error = %v", err)
+		}
+		return string(data)
+	}
+
+	t.Run("put and get", func(t *testing.T) {
+		put("videos/a/original.mp4", "0123456789")
+		if got := read(store.Get(ctx, "videos/a/original.mp4")); got != "0123456789" {
+			t.Errorf("Get() = %q, want %q", got, "0123456789")
+		}
+
+		// Put replaces existing objects
+		put("videos/a/original.mp4", "abc")
+		if got := read(store.Get(ctx, "videos/a/original.mp4")); got != "abc" {
+			t.Errorf("Get() after replace = %q, want %q", got, "abc")
+		}
+	})
+
+	t.Run("get range", func(t *testing.T) {
+		put("videos/b/original.mp4", "0123456789")
+
+		tests := []struct {
+			offset, length int64
+			want           string
+		}{
+			{0, 3, "012"},
+			{4, 2, "45"},
+			{7, -1, "789"},
+			{8, 10, "89"},
+			{3, 0, ""},
+		}
+		for _, tt := range tests {
+			got := read(store.GetRange(ctx, "videos/b/original.mp4", tt.offset, tt.length))
+			if got != tt.want {
+				t.Errorf("GetRange(%d, %d) = %q, want %q", tt.offset, tt.length, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("stat", func(t *testing.T) {
+		put("videos/c/original.mp4", "12345")
+		info, err := store.Stat(ctx, "videos/c/original.mp4")
+		if err != nil {
+			t.Fatalf("Stat() error = %v", err)
+		}
+		if info.Key != "videos/c/original.mp4" || info.Size != 5 || info.ETag == "" {
+			t.Errorf("Stat() = %+v", info)
+		}
+		if info.ContentType != "video/mp4" {
+			t.Errorf("Stat().ContentType = %q, want video/mp4", info.ContentType)
+		}
+	})
+
+	t.Run("missing objects", func(t *testing.T) {
+		if _, err := store.Stat(ctx, "videos/missing.mp4"); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("Stat() error = %v, want ErrObjectNotFound", err)
+		}
+		if _, err := store.Get(ctx, "videos/missing.mp4"); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("Get() error = %v, want ErrObjectNotFound", err)
+		}
+		if err := store.Delete(ctx, "videos/missing.mp4"); err != nil {
+			t.Errorf("Delete() error = %v, want nil", err)
+		}
+		if err := store.Copy(ctx, "videos/missing.mp4", "videos/copy.mp4"); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("Copy() error = %v, want ErrObjectNotFound", err)
+		}
+	})
+
+	t.Run("list, copy and delete", func(t *testing.T) {
+		put("list/a/1.ts", "1")
+		put("list/a/2.ts", "22")
+		put("list/b/1.ts", "333")
+		if err := store.Copy(ctx, "list/a/2.ts", "list/a/3.ts"); err != nil {
+			t.Fatalf("Copy() error = %v", err)
+		}
+
+		objects, err := store.List(ctx, "list/a/")
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		var keys []string
+		for _, object := range objects {
+			keys = append(keys, object.Key)
+		}
+		if got := strings.Join(keys, ","); got != "list/a/1.ts,list/a/2.ts,list/a/3.ts" {
+			t.Errorf("List() = %s", got)
+		}
+		if got := read(store.Get(ctx, "list/a/3.ts")); got != "22" {
+			t.Errorf("Get() of copy = %q, want %q", got, "22")
+		}
+
+		if err := store.Delete(ctx, "list/a/2.ts"); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		if _, err := store.Stat(ctx, "list/a/2.ts"); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("Stat() after Delete() error = %v, want ErrObjectNotFound", err)
+		}
+	})
+
+	t.Run("presign", func(t *testing.T) {
+		url, err := store.Presign(ctx, "videos/a/original.mp4", DefaultURLExpiry)
+		if err != nil {
+			t.Fatalf("Presign() error = %v", err)
+		}
+		if !strings.Contains(url, "videos/a/original.mp4") {
+			t.Errorf("Presign() = %q, want URL of the object", url)
+		}
+	})
+
+	t.Run("files", func(t *testing.T) {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "in.mp4")
+		if err := os.WriteFile(src, []byte("video data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := UploadFile(ctx, store, "files/video.mp4", src); err != nil {
+			t.Fatalf("UploadFile() error = %v", err)
+		}
+		dst := filepath.Join(dir, "out", "video.mp4")
+		if err := DownloadFile(ctx, store, "files/video.mp4", dst); err != nil {
+			t.Fatalf("DownloadFile() error = %v", err)
+		}
+		data, err := os.ReadFile(dst)
+		if err != nil || string(data) != "video data" {
+			t.Errorf("downloaded %q, %v, want %q", data, err, "video data")
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	testBlobstore(t, NewMemoryStore())
+}
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), "")
+	if err != nil {
+		t.Fatalf("NewLocalStore() error = %v", err)
+	}
+	testBlobstore(t, store)
+}
+
+func TestLocalStoreRejectsEscapingKeys(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewLocalStore(filepath.Join(root, "objects"), "")
+	if err != nil {
+		t.Fatalf("NewLocalStore() error = %v", err)
+	}
+
+	ctx := context.Background()
+	if err := store.Put(ctx, "../escaped.mp4", strings.NewReader("x"), 1, ""); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "escaped.mp4")); err == nil {
+		t.Error("Put() wrote outside the storage root")
+	}
+	if err := store.Put(ctx, "", strings.NewReader("x"), 1, ""); err == nil {
+		t.Error("Put() with empty key succeeded")
+	}
+}
+
+func TestLocalStorePresignUsesBaseURL(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), "https://cdn.example.com/media/")
+	if err != nil {
+		t.Fatalf("NewLocalStore() error = %v", err)
+	}
+
+	url, err := store.Presign(context.Background(), "videos/a/hls/master.m3u8", DefaultURLExpiry)
+	if err != nil {
+		t.Fatalf("Presign() error = %v", err)
+	}
+	if want := "https://cdn.example.com/media/videos/a/hls/master.m3u8"; url != want {
+		t.Errorf("Presign() = %q, want %q", url, want)
+	}
+}
+
+func TestNewSelectsDriver(t *testing.T) {
+	store, err := New(config.StorageConfig{Driver: DriverMemory})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, ok := store.(*MemoryStore); !ok {
+		t.Errorf("New() = %T, want *MemoryStore", store)
+	}
+
+	if _, err := New(config.StorageConfig{Driver: "ftp"}); err == nil {
+		t.Error("New() with unknown driver succeeded")
+	}
+}
+
+func TestDeletePrefix(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, key := range []string{"videos/a/original/a.mp4", "videos/a/outputs/720p.mp4", "videos/ab/original/ab.mp4"} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := DeletePrefix(ctx, store, "videos/a/")
+	if err != nil {
+		t.Fatalf("DeletePrefix() error = %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("DeletePrefix() deleted %d objects, want 2", deleted)
+	}
+
+	objects, err := store.List(ctx, "videos/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Key != "videos/ab/original/ab.mp4" {
+		t.Errorf("List() after DeletePrefix() = %v, want only videos/ab/original/ab.mp4", objects)
+	}
+}
+
+func TestUploadFileHashed(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	path := filepath.Join(t.TempDir(), "movie.mp4")
+	if err := os.WriteFile(path, []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// SHA-256 of "abc"
+	const want = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+
+	sum, err := UploadFileHashed(ctx, store, "videos/a/original/movie.mp4", path)
+	if err != nil {
+		t.Fatalf("UploadFileHashed() error = %v", err)
+	}
+	if sum != want {
+		t.Errorf("UploadFileHashed() = %s, want %s", sum, want)
+	}
+
+	sum, err = Checksum(ctx, store, "videos/a/original/movie.mp4")
+	if err != nil {
+		t.Fatalf("Checksum() error = %v", err)
+	}
+	if sum != want {
+		t.Errorf("Checksum() = %s, want %s", sum, want)
+	}
+}
+
+func TestOptimizedStorageOnMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	optimized := NewOptimizedStorage(NewMemoryStore(), MinPartSize)
+
+	data := strings.Repeat("0123456789", MinPartSize/10*3+7)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "large.mp4")
+	if err := os.WriteFile(src, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := optimized.UploadFileParallel(ctx, "videos/large.mp4", src); err != nil {
+		t.Fatalf("UploadFileParallel() error = %v", err)
+	}
+	dst := filepath.Join(dir, "download.mp4")
+	if err := optimized.DownloadFileParallel(ctx, "videos/large.mp4", dst); err != nil {
+		t.Fatalf("DownloadFileParallel() error = %v", err)
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil || string(got) != data {
+		t.Errorf("ranged download differs from upload (%d of %d bytes), %v", len(got), len(data), err)
+	}
+
+	if err := optimized.SetObjectMetadata(ctx, "videos/large.mp4", map[string]string{"source": "test"}); err != nil {
+		t.Fatalf("SetObjectMetadata() error = %v", err)
+	}
+	metadata, err := optimized.GetObjectMetadata(ctx, "videos/large.mp4")
+	if err != nil {
+		t.Fatalf("GetObjectMetadata() error = %v", err)
+	}
+	if metadata["source"] != "test" {
+		t.Errorf("GetObjectMetadata() = %v, want source=test", metadata)
+	}
+}
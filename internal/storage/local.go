@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tempFilePrefix marks files being written, skipped when listing
+const tempFilePrefix = ".upload-"
+
+// LocalStore stores objects as files under a root directory, for development
+// and single node deployments
+type LocalStore struct {
+	root    string
+	baseURL string
+}
+
+// NewLocalStore creates a store rooted at root. Presigned URLs point into
+// baseURL, where the root is expected to be served, or are file URLs when it
+// is empty.
+func NewLocalStore(root, baseURL string) (*LocalStore, error) {
+	if root == "" {
+		return nil, fmt.Errorf("local storage path is required")
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve storage path: %w", err)
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	return &LocalStore{
+		root:    root,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}, nil
+}
+
+// path returns the file an object is stored in, rejecting keys that would
+// escape the root
+func (s *LocalStore) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if key == "" || cleaned == "/" || strings.HasSuffix(key, "/") {
+		return "", fmt.Errorf("invalid object key: %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(cleaned)), nil
+}
+
+// Put writes an object to a temporary file and renames it into place, so
+// readers never see a partial object
+func (s *LocalStore) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	filePath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), tempFilePrefix)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if size >= 0 {
+		reader = io.LimitReader(reader, size)
+	}
+	written, err := io.Copy(tmp, &contextReader{ctx: ctx, reader: reader})
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+	if size >= 0 && written != size {
+		tmp.Close()
+		return fmt.Errorf("failed to upload object: read %d of %d bytes", written, size)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+	return nil
+}
+
+// Get opens an object
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.GetRange(ctx, key, 0, -1)
+}
+
+// GetRange opens part of an object
+func (s *LocalStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	filePath, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download object: %w", mapFileError(err))
+	}
+
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to seek object: %w", err)
+		}
+	}
+	if length < 0 {
+		return file, nil
+	}
+
+	return &limitedReadCloser{Reader: io.LimitReader(file, length), Closer: file}, nil
+}
+
+// Stat returns an object's info
+func (s *LocalStore) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	filePath, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat object: %w", mapFileError(err))
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("failed to stat object: %w", ErrObjectNotFound)
+	}
+
+	object := s.objectInfo(key, info)
+	return &object, nil
+}
+
+// List walks the root for objects with a prefix
+func (s *LocalStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	err := filepath.WalkDir(s.root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), tempFilePrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.root, filePath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, s.objectInfo(key, info))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// Delete removes an object's file
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	filePath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	return nil
+}
+
+// Copy copies an object's file
+func (s *LocalStore) Copy(ctx context.Context, srcKey, dstKey string) error {
+	src, err := s.Get(ctx, srcKey)
+	if err != nil {
+		return fmt.Errorf("failed to copy object: %w", err)
+	}
+	defer src.Close()
+
+	if err := s.Put(ctx, dstKey, src, -1, ""); err != nil {
+		return fmt.Errorf("failed to copy object: %w", err)
+	}
+	return nil
+}
+
+// Presign returns the object's URL under the base URL, or its file URL. Local
+// files cannot be signed, so expiry is ignored.
+func (s *LocalStore) Presign(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	filePath, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+
+	if s.baseURL != "" {
+		return s.baseURL + "/" + strings.TrimPrefix(path.Clean("/"+key), "/"), nil
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(filePath)}).String(), nil
+}
+
+// objectInfo describes a stored file. The ETag is derived from the file's size
+// and modification time, which change whenever the object is replaced.
+func (s *LocalStore) objectInfo(key string, info fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  getContentType(key),
+		ETag:         fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size()),
+		LastModified: info.ModTime(),
+		Metadata:     map[string]string{},
+	}
+}
+
+// mapFileError maps missing file errors to ErrObjectNotFound
+func mapFileError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrObjectNotFound
+	}
+	return err
+}
+
+// limitedReadCloser closes the file under a limited reader
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// contextReader stops reading once its context is done
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
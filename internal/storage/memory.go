@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps objects in memory, for tests
+type MemoryStore struct {
+	mu      sync.RWMutex
+	objects map[string]*memoryObject
+}
+
+// memoryObject is an object held by a MemoryStore
+type memoryObject struct {
+	data         []byte
+	contentType  string
+	lastModified time.Time
+	metadata     map[string]string
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		objects: make(map[string]*memoryObject),
+	}
+}
+
+// Put stores a copy of an object
+func (s *MemoryStore) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	if key == "" {
+		return fmt.Errorf("invalid object key: %q", key)
+	}
+
+	if size >= 0 {
+		reader = io.LimitReader(reader, size)
+	}
+	data, err := io.ReadAll(&contextReader{ctx: ctx, reader: reader})
+	if err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return fmt.Errorf("failed to upload object: read %d of %d bytes", len(data), size)
+	}
+	if contentType == "" {
+		contentType = getContentType(key)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[key] = &memoryObject{
+		data:         data,
+		contentType:  contentType,
+		lastModified: time.Now(),
+		metadata:     map[string]string{},
+	}
+	return nil
+}
+
+// Get opens an object
+func (s *MemoryStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.GetRange(ctx, key, 0, -1)
+}
+
+// GetRange opens part of an object
+func (s *MemoryStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	s.mu.RLock()
+	object, ok := s.objects[key]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("failed to download object: %w", ErrObjectNotFound)
+	}
+
+	size := int64(len(object.data))
+	if offset > size {
+		offset = size
+	}
+	end := size
+	if length >= 0 && offset+length < size {
+		end = offset + length
+	}
+
+	// Objects are replaced, never modified, so the data can be shared
+	return io.NopCloser(bytes.NewReader(object.data[offset:end])), nil
+}
+
+// Stat returns an object's info
+func (s *MemoryStore) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	object, ok := s.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("failed to stat object: %w", ErrObjectNotFound)
+	}
+
+	info := object.info(key)
+	return &info, nil
+}
+
+// List returns the objects with a prefix
+func (s *MemoryStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var objects []ObjectInfo
+	for key, object := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, object.info(key))
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// Delete removes an object
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.objects, key)
+	return nil
+}
+
+// Copy copies an object, including its metadata
+func (s *MemoryStore) Copy(ctx context.Context, srcKey, dstKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	object, ok := s.objects[srcKey]
+	if !ok {
+		return fmt.Errorf("failed to copy object: %w", ErrObjectNotFound)
+	}
+
+	copied := *object
+	copied.lastModified = time.Now()
+	copied.metadata = copyMetadata(object.metadata)
+	s.objects[dstKey] = &copied
+	return nil
+}
+
+// SetMetadata replaces an object's user metadata
+func (s *MemoryStore) SetMetadata(ctx context.Context, key string, metadata map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	object, ok := s.objects[key]
+	if !ok {
+		return fmt.Errorf("failed to update metadata: %w", ErrObjectNotFound)
+	}
+
+	object.metadata = copyMetadata(metadata)
+	return nil
+}
+
+// Presign returns a memory URL naming the object. It cannot be downloaded
+// from, but lets tests check which object a URL refers to.
+func (s *MemoryStore) Presign(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("invalid object key: %q", key)
+	}
+
+	query := url.Values{}
+	query.Set("expires", time.Now().Add(expiry).UTC().Format(time.RFC3339))
+	return (&url.URL{Scheme: "memory", Path: "/" + key, RawQuery: query.Encode()}).String(), nil
+}
+
+// info describes the object stored under key
+func (o *memoryObject) info(key string) ObjectInfo {
+	sum := md5.Sum(o.data)
+	return ObjectInfo{
+		Key:          key,
+		Size:         int64(len(o.data)),
+		ContentType:  o.contentType,
+		ETag:         hex.EncodeToString(sum[:]),
+		LastModified: o.lastModified,
+		Metadata:     copyMetadata(o.metadata),
+	}
+}
+
+// copyMetadata copies user metadata, so stored objects are not shared
+func copyMetadata(metadata map[string]string) map[string]string {
+	copied := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/config"
+)
+
+// MinIOStore stores objects in an S3 compatible bucket
+type MinIOStore struct {
+	client       *minio.Client
+	bucketName   string
+	storageClass string // of stored objects, the bucket default when empty
+}
+
+// NewMinIOStore creates an S3 compatible store, creating its bucket if missing
+func NewMinIOStore(cfg config.StorageConfig) (*MinIOStore, error) {
+	client, err := newMinIOClient(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure bucket exists
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, cfg.BucketName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket existence: %w", err)
+	}
+
+	if !exists {
+		err = client.MakeBucket(ctx, cfg.BucketName, minio.MakeBucketOptions{
+			Region: cfg.Region,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create bucket: %w", err)
+		}
+	}
+
+	return &MinIOStore{
+		client:     client,
+		bucketName: cfg.BucketName,
+	}, nil
+}
+
+// OpenMinIOBucket opens an existing bucket with the endpoint and credentials
+// of cfg, e.g. a partner's bucket videos are imported from
+func OpenMinIOBucket(cfg config.StorageConfig, bucket string) (*MinIOStore, error) {
+	return OpenRemoteBucket(cfg, bucket, nil)
+}
+
+// OpenRemoteBucket opens an existing bucket like OpenMinIOBucket, sending
+// requests through transport, e.g. one refusing internal addresses for an
+// endpoint a customer chose. A nil transport uses the default.
+func OpenRemoteBucket(cfg config.StorageConfig, bucket string, transport http.RoundTripper) (*MinIOStore, error) {
+	client, err := newMinIOClient(cfg, transport)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MinIOStore{
+		client:     client,
+		bucketName: bucket,
+	}, nil
+}
+
+// WithStorageClass returns a store of the same bucket that stores objects
+// with storageClass, e.g. STANDARD_IA
+func (s *MinIOStore) WithStorageClass(storageClass string) *MinIOStore {
+	copied := *s
+	copied.storageClass = storageClass
+	return &copied
+}
+
+func newMinIOClient(cfg config.StorageConfig, transport http.RoundTripper) (*minio.Client, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:     credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		Secure:    cfg.UseSSL,
+		Region:    cfg.Region,
+		Transport: transport,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+	return client, nil
+}
+
+// Put uploads an object
+func (s *MinIOStore) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucketName, key, reader, size, minio.PutObjectOptions{
+		ContentType:  contentType,
+		StorageClass: s.storageClass,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+
+	return nil
+}
+
+// PutMultipart uploads an object in parts of partSize, concurrency at a time
+func (s *MinIOStore) PutMultipart(ctx context.Context, key string, reader io.Reader, size int64, contentType string, partSize int64, concurrency int) error {
+	_, err := s.client.PutObject(ctx, s.bucketName, key, reader, size, minio.PutObjectOptions{
+		PartSize:     uint64(partSize),
+		ContentType:  contentType,
+		NumThreads:   uint(concurrency),
+		StorageClass: s.storageClass,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+
+	return nil
+}
+
+// Get downloads an object
+func (s *MinIOStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.GetRange(ctx, key, 0, -1)
+}
+
+// GetRange downloads part of an object
+func (s *MinIOStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+
+	opts := minio.GetObjectOptions{}
+	if offset > 0 || length > 0 {
+		end := int64(0)
+		if length > 0 {
+			end = offset + length - 1
+		}
+		if err := opts.SetRange(offset, end); err != nil {
+			return nil, fmt.Errorf("failed to set range: %w", err)
+		}
+	}
+
+	object, err := s.client.GetObject(ctx, s.bucketName, key, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download object: %w", mapMinIOError(err))
+	}
+
+	// GetObject is lazy; stat it so missing objects fail here
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, fmt.Errorf("failed to download object: %w", mapMinIOError(err))
+	}
+
+	return object, nil
+}
+
+// Stat returns an object's info
+func (s *MinIOStore) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucketName, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat object: %w", mapMinIOError(err))
+	}
+
+	object := toObjectInfo(info)
+	return &object, nil
+}
+
+// List lists objects with a prefix
+func (s *MinIOStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	for object := range s.client.ListObjects(ctx, s.bucketName, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+		objects = append(objects, toObjectInfo(object))
+	}
+
+	return objects, nil
+}
+
+// Delete deletes an object
+func (s *MinIOStore) Delete(ctx context.Context, key string) error {
+	err := s.client.RemoveObject(ctx, s.bucketName, key, minio.RemoveObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+
+	return nil
+}
+
+// Copy copies an object within the bucket
+func (s *MinIOStore) Copy(ctx context.Context, srcKey, dstKey string) error {
+	src := minio.CopySrcOptions{
+		Bucket: s.bucketName,
+		Object: srcKey,
+	}
+
+	dst := minio.CopyDestOptions{
+		Bucket: s.bucketName,
+		Object: dstKey,
+	}
+
+	if _, err := s.client.CopyObject(ctx, dst, src); err != nil {
+		return fmt.Errorf("failed to copy object: %w", mapMinIOError(err))
+	}
+
+	return nil
+}
+
+// SetMetadata replaces an object's user metadata
+func (s *MinIOStore) SetMetadata(ctx context.Context, key string, metadata map[string]string) error {
+	// S3 requires copying the object to itself to update metadata
+	src := minio.CopySrcOptions{
+		Bucket: s.bucketName,
+		Object: key,
+	}
+
+	dst := minio.CopyDestOptions{
+		Bucket:          s.bucketName,
+		Object:          key,
+		UserMetadata:    metadata,
+		ReplaceMetadata: true,
+	}
+
+	if _, err := s.client.CopyObject(ctx, dst, src); err != nil {
+		return fmt.Errorf("failed to update metadata: %w", mapMinIOError(err))
+	}
+
+	return nil
+}
+
+// Presign returns a presigned download URL for an object
+func (s *MinIOStore) Presign(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	url, err := s.client.PresignedGetObject(ctx, s.bucketName, key, expiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign object: %w", err)
+	}
+
+	return url.String(), nil
+}
+
+// toObjectInfo converts MinIO's object info
+func toObjectInfo(info minio.ObjectInfo) ObjectInfo {
+	metadata := make(map[string]string, len(info.UserMetadata))
+	for k, v := range info.UserMetadata {
+		metadata[k] = v
+	}
+
+	return ObjectInfo{
+		Key:          info.Key,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		ETag:         info.ETag,
+		LastModified: info.LastModified,
+		Metadata:     metadata,
+	}
+}
+
+// mapMinIOError maps missing object errors to ErrObjectNotFound
+func mapMinIOError(err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NotFound":
+		return ErrObjectNotFound
+	}
+	return err
+}
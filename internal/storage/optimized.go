@@ -6,8 +6,6 @@ import (
 	"io"
 	"os"
 	"sync"
-
-	"github.com/minio/minio-go/v7"
 )
 
 const (
@@ -21,22 +19,22 @@ const (
 	MaxConcurrentParts = 10
 )
 
-// OptimizedStorage extends Storage with optimization features
+// OptimizedStorage speeds up transfers of large objects on any Blobstore
 type OptimizedStorage struct {
-	*Storage
-	partSize         int64
+	Blobstore
+	partSize           int64
 	maxConcurrentParts int
 }
 
 // NewOptimizedStorage creates a new optimized storage instance
-func NewOptimizedStorage(storage *Storage, partSize int64) *OptimizedStorage {
+func NewOptimizedStorage(store Blobstore, partSize int64) *OptimizedStorage {
 	if partSize < MinPartSize {
 		partSize = DefaultPartSize
 	}
 
 	return &OptimizedStorage{
-		Storage:           storage,
-		partSize:          partSize,
+		Blobstore:          store,
+		partSize:           partSize,
 		maxConcurrentParts: MaxConcurrentParts,
 	}
 }
@@ -53,7 +51,7 @@ func (s *OptimizedStorage) UploadFileParallel(ctx context.Context, key, filePath
 
 	// For small files, use standard upload
 	if fileSize < s.partSize {
-		return s.UploadFile(ctx, key, filePath)
+		return UploadFile(ctx, s.Blobstore, key, filePath)
 	}
 
 	// Open file
@@ -63,21 +61,7 @@ func (s *OptimizedStorage) UploadFileParallel(ctx context.Context, key, filePath
 	}
 	defer file.Close()
 
-	// Use MinIO's optimized PutObject with multipart upload
-	_, err = s.client.PutObject(
-		ctx,
-		s.bucketName,
-		key,
-		file,
-		fileSize,
-		minio.PutObjectOptions{
-			PartSize:    uint64(s.partSize),
-			ContentType: "application/octet-stream",
-			NumThreads:  uint(s.maxConcurrentParts),
-		},
-	)
-
-	if err != nil {
+	if err := s.put(ctx, key, file, fileSize, getContentType(filePath)); err != nil {
 		return fmt.Errorf("failed to upload file: %w", err)
 	}
 
@@ -86,53 +70,32 @@ func (s *OptimizedStorage) UploadFileParallel(ctx context.Context, key, filePath
 
 // UploadStreamParallel uploads a stream using parallel multipart upload
 func (s *OptimizedStorage) UploadStreamParallel(ctx context.Context, key string, reader io.Reader, size int64) error {
-	if size < s.partSize {
-		// For small files, use standard upload
-		_, err := s.client.PutObject(
-			ctx,
-			s.bucketName,
-			key,
-			reader,
-			size,
-			minio.PutObjectOptions{
-				ContentType: "application/octet-stream",
-			},
-		)
-		return err
-	}
-
-	// Use MinIO's optimized PutObject with multipart upload
-	_, err := s.client.PutObject(
-		ctx,
-		s.bucketName,
-		key,
-		reader,
-		size,
-		minio.PutObjectOptions{
-			PartSize:    uint64(s.partSize),
-			ContentType: "application/octet-stream",
-			NumThreads:  uint(s.maxConcurrentParts),
-		},
-	)
-
-	if err != nil {
+	if err := s.put(ctx, key, reader, size, "application/octet-stream"); err != nil {
 		return fmt.Errorf("failed to upload stream: %w", err)
 	}
 
 	return nil
 }
 
+// put uploads large objects in parallel parts when the driver supports it
+func (s *OptimizedStorage) put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	if uploader, ok := s.Blobstore.(MultipartUploader); ok && size >= s.partSize {
+		return uploader.PutMultipart(ctx, key, reader, size, contentType, s.partSize, s.maxConcurrentParts)
+	}
+	return s.Put(ctx, key, reader, size, contentType)
+}
+
 // DownloadFileParallel downloads a file using parallel connections
 func (s *OptimizedStorage) DownloadFileParallel(ctx context.Context, key, destPath string) error {
 	// Get object info
-	objInfo, err := s.client.StatObject(ctx, s.bucketName, key, minio.StatObjectOptions{})
+	objInfo, err := s.Stat(ctx, key)
 	if err != nil {
-		return fmt.Errorf("failed to stat object: %w", err)
+		return err
 	}
 
 	// For small files, use standard download
 	if objInfo.Size < s.partSize {
-		return s.DownloadFile(ctx, key, destPath)
+		return DownloadFile(ctx, s.Blobstore, key, destPath)
 	}
 
 	// Download using range requests for large files
@@ -220,14 +183,9 @@ func (s *OptimizedStorage) downloadWithRanges(ctx context.Context, key, destPath
 
 // downloadPart downloads a single part using range request
 func (s *OptimizedStorage) downloadPart(ctx context.Context, key string, start, end int64) ([]byte, error) {
-	opts := minio.GetObjectOptions{}
-	if err := opts.SetRange(start, end); err != nil {
-		return nil, fmt.Errorf("failed to set range: %w", err)
-	}
-
-	object, err := s.client.GetObject(ctx, s.bucketName, key, opts)
+	object, err := s.GetRange(ctx, key, start, end-start+1)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get object: %w", err)
+		return nil, err
 	}
 	defer object.Close()
 
@@ -246,38 +204,21 @@ type partData struct {
 	data    []byte
 }
 
-// CopyObject copies an object within the bucket (useful for deduplication)
+// CopyObject copies an object within the store (useful for deduplication)
 func (s *OptimizedStorage) CopyObject(ctx context.Context, srcKey, destKey string) error {
-	src := minio.CopySrcOptions{
-		Bucket: s.bucketName,
-		Object: srcKey,
-	}
-
-	dst := minio.CopyDestOptions{
-		Bucket: s.bucketName,
-		Object: destKey,
-	}
-
-	_, err := s.client.CopyObject(ctx, dst, src)
-	if err != nil {
-		return fmt.Errorf("failed to copy object: %w", err)
-	}
-
-	return nil
+	return s.Copy(ctx, srcKey, destKey)
 }
 
 // GetObjectMetadata retrieves object metadata without downloading
 func (s *OptimizedStorage) GetObjectMetadata(ctx context.Context, key string) (map[string]string, error) {
-	objInfo, err := s.client.StatObject(ctx, s.bucketName, key, minio.StatObjectOptions{})
+	objInfo, err := s.Stat(ctx, key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to stat object: %w", err)
+		return nil, err
 	}
 
 	metadata := make(map[string]string)
-	for k, v := range objInfo.UserMetadata {
-		if len(v) > 0 {
-			metadata[k] = v[0]
-		}
+	for k, v := range objInfo.Metadata {
+		metadata[k] = v
 	}
 
 	metadata["content-type"] = objInfo.ContentType
@@ -289,57 +230,30 @@ func (s *OptimizedStorage) GetObjectMetadata(ctx context.Context, key string) (m
 
 // SetObjectMetadata sets object metadata
 func (s *OptimizedStorage) SetObjectMetadata(ctx context.Context, key string, metadata map[string]string) error {
-	// MinIO requires copying the object to itself to update metadata
-	src := minio.CopySrcOptions{
-		Bucket: s.bucketName,
-		Object: key,
-	}
-
-	dst := minio.CopyDestOptions{
-		Bucket:          s.bucketName,
-		Object:          key,
-		UserMetadata:    metadata,
-		ReplaceMetadata: true,
-	}
-
-	_, err := s.client.CopyObject(ctx, dst, src)
-	if err != nil {
-		return fmt.Errorf("failed to update metadata: %w", err)
+	setter, ok := s.Blobstore.(MetadataSetter)
+	if !ok {
+		return fmt.Errorf("storage driver does not support object metadata")
 	}
 
-	return nil
+	return setter.SetMetadata(ctx, key, metadata)
 }
 
 // BatchDelete deletes multiple objects
 func (s *OptimizedStorage) BatchDelete(ctx context.Context, keys []string) error {
-	objectsCh := make(chan minio.ObjectInfo, len(keys))
-
-	// Send object keys to channel
-	go func() {
-		defer close(objectsCh)
-		for _, key := range keys {
-			objectsCh <- minio.ObjectInfo{Key: key}
-		}
-	}()
-
-	// Delete objects
-	errorCh := s.client.RemoveObjects(ctx, s.bucketName, objectsCh, minio.RemoveObjectsOptions{})
-
-	// Check for errors
-	for err := range errorCh {
-		if err.Err != nil {
-			return fmt.Errorf("failed to delete object %s: %w", err.ObjectName, err.Err)
+	for _, key := range keys {
+		if err := s.Delete(ctx, key); err != nil {
+			return fmt.Errorf("failed to delete object %s: %w", key, err)
 		}
 	}
 
 	return nil
 }
 
-// CalculateChecksum calculates checksum for a file
+// CalculateChecksum returns the checksum of an object
 func (s *OptimizedStorage) CalculateChecksum(ctx context.Context, key string) (string, error) {
-	objInfo, err := s.client.StatObject(ctx, s.bucketName, key, minio.StatObjectOptions{})
+	objInfo, err := s.Stat(ctx, key)
 	if err != nil {
-		return "", fmt.Errorf("failed to stat object: %w", err)
+		return "", err
 	}
 
 	return objInfo.ETag, nil
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// MultipartPresigner is implemented by drivers that let clients upload the
+// parts of a multipart upload straight to storage through presigned URLs
+type MultipartPresigner interface {
+	// CreateMultipartUpload starts a multipart upload of key, returning its
+	// storage upload ID
+	CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error)
+
+	// PresignUploadPart returns a URL a part can be PUT to until expiry passes
+	PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int, expiry time.Duration) (string, error)
+
+	// ListUploadedParts returns the parts uploaded so far, by part number
+	ListUploadedParts(ctx context.Context, key, uploadID string) ([]UploadedPart, error)
+
+	// CompleteMultipartUpload assembles the parts into the object under key
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []UploadedPart) error
+
+	// AbortMultipartUpload discards a multipart upload and its parts
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+}
+
+// UploadedPart is a part of a multipart upload held by storage
+type UploadedPart struct {
+	PartNumber int    `json:"part_number"`
+	Size       int64  `json:"size"`
+	ETag       string `json:"etag"`
+}
+
+// CreateMultipartUpload starts a multipart upload in the bucket
+func (s *MinIOStore) CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	core := minio.Core{Client: s.client}
+
+	uploadID, err := core.NewMultipartUpload(ctx, s.bucketName, key, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+
+	return uploadID, nil
+}
+
+// PresignUploadPart presigns a PUT of one part
+func (s *MinIOStore) PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int, expiry time.Duration) (string, error) {
+	params := url.Values{}
+	params.Set("partNumber", strconv.Itoa(partNumber))
+	params.Set("uploadId", uploadID)
+
+	u, err := s.client.Presign(ctx, "PUT", s.bucketName, key, expiry, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign part: %w", err)
+	}
+
+	return u.String(), nil
+}
+
+// ListUploadedParts lists the parts of a multipart upload, following pages
+func (s *MinIOStore) ListUploadedParts(ctx context.Context, key, uploadID string) ([]UploadedPart, error) {
+	core := minio.Core{Client: s.client}
+
+	var parts []UploadedPart
+	marker := 0
+	for {
+		result, err := core.ListObjectParts(ctx, s.bucketName, key, uploadID, marker, 1000)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list parts: %w", err)
+		}
+
+		for _, part := range result.ObjectParts {
+			parts = append(parts, UploadedPart{
+				PartNumber: part.PartNumber,
+				Size:       part.Size,
+				ETag:       part.ETag,
+			})
+		}
+
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+// CompleteMultipartUpload assembles the parts of a multipart upload
+func (s *MinIOStore) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []UploadedPart) error {
+	core := minio.Core{Client: s.client}
+
+	complete := make([]minio.CompletePart, len(parts))
+	for i, part := range parts {
+		complete[i] = minio.CompletePart{
+			PartNumber: part.PartNumber,
+			ETag:       part.ETag,
+		}
+	}
+
+	if _, err := core.CompleteMultipartUpload(ctx, s.bucketName, key, uploadID, complete, minio.PutObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+
+	return nil
+}
+
+// AbortMultipartUpload aborts a multipart upload
+func (s *MinIOStore) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	core := minio.Core{Client: s.client}
+
+	if err := core.AbortMultipartUpload(ctx, s.bucketName, key, uploadID); err != nil {
+		return fmt.Errorf("failed to abort multipart upload: %w", err)
+	}
+
+	return nil
+}
@@ -1,157 +0,0 @@
-package storage
-
-import (
-	"context"
-	"fmt"
-	"io"
-	"path/filepath"
-
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
-	"github.com/therealutkarshpriyadarshi/transcode/internal/config"
-)
-
-// Storage provides object storage operations
-type Storage struct {
-	client     *minio.Client
-	bucketName string
-}
-
-// New creates a new storage client
-func New(cfg config.StorageConfig) (*Storage, error) {
-	client, err := minio.New(cfg.Endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
-		Secure: cfg.UseSSL,
-		Region: cfg.Region,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create storage client: %w", err)
-	}
-
-	// Ensure bucket exists
-	ctx := context.Background()
-	exists, err := client.BucketExists(ctx, cfg.BucketName)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check bucket existence: %w", err)
-	}
-
-	if !exists {
-		err = client.MakeBucket(ctx, cfg.BucketName, minio.MakeBucketOptions{
-			Region: cfg.Region,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to create bucket: %w", err)
-		}
-	}
-
-	return &Storage{
-		client:     client,
-		bucketName: cfg.BucketName,
-	}, nil
-}
-
-// Upload uploads a file to storage
-func (s *Storage) Upload(ctx context.Context, objectName string, reader io.Reader, size int64, contentType string) error {
-	_, err := s.client.PutObject(ctx, s.bucketName, objectName, reader, size, minio.PutObjectOptions{
-		ContentType: contentType,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to upload object: %w", err)
-	}
-
-	return nil
-}
-
-// Download downloads a file from storage
-func (s *Storage) Download(ctx context.Context, objectName string) (io.ReadCloser, error) {
-	object, err := s.client.GetObject(ctx, s.bucketName, objectName, minio.GetObjectOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to download object: %w", err)
-	}
-
-	return object, nil
-}
-
-// UploadFile uploads a file from local filesystem
-func (s *Storage) UploadFile(ctx context.Context, objectName, filePath string) error {
-	contentType := getContentType(filePath)
-
-	_, err := s.client.FPutObject(ctx, s.bucketName, objectName, filePath, minio.PutObjectOptions{
-		ContentType: contentType,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to upload file: %w", err)
-	}
-
-	return nil
-}
-
-// DownloadFile downloads a file to local filesystem
-func (s *Storage) DownloadFile(ctx context.Context, objectName, filePath string) error {
-	err := s.client.FGetObject(ctx, s.bucketName, objectName, filePath, minio.GetObjectOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to download file: %w", err)
-	}
-
-	return nil
-}
-
-// Delete deletes an object from storage
-func (s *Storage) Delete(ctx context.Context, objectName string) error {
-	err := s.client.RemoveObject(ctx, s.bucketName, objectName, minio.RemoveObjectOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to delete object: %w", err)
-	}
-
-	return nil
-}
-
-// GetURL returns a presigned URL for an object
-func (s *Storage) GetURL(ctx context.Context, objectName string) (string, error) {
-	url, err := s.client.PresignedGetObject(ctx, s.bucketName, objectName, 3600, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate URL: %w", err)
-	}
-
-	return url.String(), nil
-}
-
-// List lists objects with a prefix
-func (s *Storage) List(ctx context.Context, prefix string) ([]string, error) {
-	var objects []string
-
-	for object := range s.client.ListObjects(ctx, s.bucketName, minio.ListObjectsOptions{
-		Prefix:    prefix,
-		Recursive: true,
-	}) {
-		if object.Err != nil {
-			return nil, fmt.Errorf("failed to list objects: %w", object.Err)
-		}
-		objects = append(objects, object.Key)
-	}
-
-	return objects, nil
-}
-
-// getContentType returns the content type based on file extension
-func getContentType(filePath string) string {
-	ext := filepath.Ext(filePath)
-	switch ext {
-	case ".mp4":
-		return "video/mp4"
-	case ".mov":
-		return "video/quicktime"
-	case ".avi":
-		return "video/x-msvideo"
-	case ".mkv":
-		return "video/x-matroska"
-	case ".webm":
-		return "video/webm"
-	case ".m3u8":
-		return "application/vnd.apple.mpegurl"
-	case ".ts":
-		return "video/mp2t"
-	default:
-		return "application/octet-stream"
-	}
-}
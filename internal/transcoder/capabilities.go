@@ -0,0 +1,91 @@
+package transcoder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// DetectCapabilities describes what this worker can run: GPU encoding via
+// gpuManager, the video encoders of the ffmpeg build, cores and memory
+func DetectCapabilities(ctx context.Context, ffmpegPath string, gpuManager *GPUManager, maxConcurrent int) (*models.WorkerCapabilities, error) {
+	cmd := exec.CommandContext(ctx, ffmpegPath, "-hide_banner", "-encoders")
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to list ffmpeg encoders: %w", err)
+	}
+
+	caps := &models.WorkerCapabilities{
+		Encoders:      parseEncoders(stdout.String()),
+		CPUs:          runtime.NumCPU(),
+		MemoryMB:      readMemoryMB(),
+		MaxConcurrent: maxConcurrent,
+	}
+
+	if gpuManager != nil && gpuManager.IsAvailable() {
+		caps.GPU = true
+		caps.GPUCount = gpuManager.GetCapability().DeviceCount
+	}
+
+	return caps, nil
+}
+
+// parseEncoders extracts video encoder names from `ffmpeg -encoders` output,
+// whose entries look like " V....D libx264   libx264 H.264 / AVC"
+func parseEncoders(output string) []string {
+	var encoders []string
+	listing := false
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		// The encoder list follows the " ------" separator
+		if strings.HasPrefix(fields[0], "---") {
+			listing = true
+			continue
+		}
+		if !listing || len(fields) < 2 || !strings.HasPrefix(fields[0], "V") {
+			continue
+		}
+
+		encoders = append(encoders, fields[1])
+	}
+
+	return encoders
+}
+
+// readMemoryMB returns total system memory in MB, or 0 when unavailable
+func readMemoryMB() int {
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return 0
+			}
+			return kb / 1024
+		}
+	}
+
+	return 0
+}
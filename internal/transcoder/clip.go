@@ -0,0 +1,75 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// ClipOptions holds options for cutting a clip out of an HLS playlist or video
+type ClipOptions struct {
+	InputPath  string
+	OutputPath string
+	Start      float64 // offset into the input in seconds
+	Duration   float64 // clip length in seconds, 0 keeps the rest of the input
+	ReEncode   bool    // re-encode for frame accurate cuts, otherwise streams are copied
+	VideoCodec string  // Output video codec when re-encoding (default: libx264)
+	AudioCodec string  // Output audio codec when re-encoding (default: aac)
+	Bitrate    int64   // Video bitrate in bps when re-encoding
+	Preset     string  // Encoding preset (default: veryfast)
+}
+
+// ExtractClip cuts a clip into an MP4 file. Without ReEncode the streams are
+// copied, so the cut points should fall on keyframes.
+func (f *FFmpeg) ExtractClip(ctx context.Context, opts ClipOptions) error {
+	cmd := exec.CommandContext(ctx, f.ffmpegPath, buildClipArgs(opts)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("clip extraction failed: %w, output: %s", err, string(output))
+	}
+
+	return nil
+}
+
+// buildClipArgs builds the FFmpeg arguments for a clip
+func buildClipArgs(opts ClipOptions) []string {
+	if opts.VideoCodec == "" {
+		opts.VideoCodec = "libx264"
+	}
+	if opts.AudioCodec == "" {
+		opts.AudioCodec = "aac"
+	}
+	if opts.Preset == "" {
+		opts.Preset = "veryfast"
+	}
+
+	// Local playlists reference their segments by file path
+	args := []string{"-protocol_whitelist", "file,crypto", "-i", opts.InputPath}
+
+	if opts.Start > 0 {
+		args = append(args, "-ss", fmt.Sprintf("%.3f", opts.Start))
+	}
+	if opts.Duration > 0 {
+		args = append(args, "-t", fmt.Sprintf("%.3f", opts.Duration))
+	}
+
+	if opts.ReEncode {
+		args = append(args,
+			"-c:v", opts.VideoCodec,
+			"-preset", opts.Preset,
+			"-c:a", opts.AudioCodec,
+		)
+		if opts.Bitrate > 0 {
+			args = append(args, "-b:v", fmt.Sprintf("%d", opts.Bitrate))
+		}
+	} else {
+		args = append(args,
+			"-c", "copy",
+			"-bsf:a", "aac_adtstoasc", // MPEG-TS audio needs ASC headers in MP4
+		)
+	}
+
+	args = append(args, "-movflags", "+faststart", "-y", opts.OutputPath)
+
+	return args
+}
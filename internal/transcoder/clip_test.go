@@ -0,0 +1,37 @@
+package transcoder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildClipArgs(t *testing.T) {
+	t.Run("stream copy", func(t *testing.T) {
+		args := buildClipArgs(ClipOptions{InputPath: "clip.m3u8", OutputPath: "clip.mp4"})
+
+		assert.Equal(t, []string{
+			"-protocol_whitelist", "file,crypto", "-i", "clip.m3u8",
+			"-c", "copy", "-bsf:a", "aac_adtstoasc",
+			"-movflags", "+faststart", "-y", "clip.mp4",
+		}, args)
+	})
+
+	t.Run("exact cut", func(t *testing.T) {
+		args := buildClipArgs(ClipOptions{
+			InputPath:  "clip.m3u8",
+			OutputPath: "clip.mp4",
+			Start:      2.5,
+			Duration:   10,
+			ReEncode:   true,
+			Bitrate:    2500000,
+		})
+
+		assert.Equal(t, []string{
+			"-protocol_whitelist", "file,crypto", "-i", "clip.m3u8",
+			"-ss", "2.500", "-t", "10.000",
+			"-c:v", "libx264", "-preset", "veryfast", "-c:a", "aac", "-b:v", "2500000",
+			"-movflags", "+faststart", "-y", "clip.mp4",
+		}, args)
+	})
+}
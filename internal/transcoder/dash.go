@@ -1,11 +1,9 @@
 package transcoder
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 
 	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
@@ -70,10 +68,10 @@ func (f *FFmpeg) GenerateDASH(ctx context.Context, opts DASHOptions, progressCB
 	}
 
 	// Build FFmpeg command
-	args := []string{
-		"-i", opts.InputPath,
+	args := append(inputArgs(opts.InputPath),
 		"-y",
-	}
+		"-progress", "pipe:1", // Progress for the callback and the watchdog
+	)
 
 	// Add mapping and encoding options for each resolution
 	for i, res := range opts.Resolutions {
@@ -138,22 +136,12 @@ func (f *FFmpeg) GenerateDASH(ctx context.Context, opts DASHOptions, progressCB
 		manifestPath,
 	)
 
-	// Execute FFmpeg command
-	cmd := exec.CommandContext(ctx, f.ffmpegPath, args...)
-
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-
-	if progressCB != nil {
-		progressCB(50) // Midway progress
-	}
-
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("ffmpeg DASH generation failed: %w, stderr: %s", err, stderr.String())
-	}
-
-	if progressCB != nil {
-		progressCB(100)
+	// Execute FFmpeg command. Every rendition is encoded in the one run, so
+	// the max runtime covers all of them.
+	duration := f.sourceDuration(ctx, opts.InputPath)
+	maxRuntime := f.watchdog.MaxRuntime(duration*float64(len(opts.Resolutions)), opts.VideoCodec)
+	if err := f.runWatched(ctx, "ffmpeg DASH generation", args, duration, maxRuntime, progressCB); err != nil {
+		return nil, err
 	}
 
 	result.ManifestPath = manifestPath
@@ -10,6 +10,8 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
 )
@@ -18,6 +20,7 @@ import (
 type FFmpeg struct {
 	ffmpegPath  string
 	ffprobePath string
+	watchdog    WatchdogConfig
 }
 
 // NewFFmpeg creates a new FFmpeg instance
@@ -28,6 +31,12 @@ func NewFFmpeg(ffmpegPath, ffprobePath string) *FFmpeg {
 	}
 }
 
+// SetWatchdog makes Transcode, GenerateHLS and GenerateDASH kill ffmpeg runs
+// that stall or exceed their max runtime
+func (f *FFmpeg) SetWatchdog(cfg WatchdogConfig) {
+	f.watchdog = cfg
+}
+
 // VideoMetadata holds video metadata extracted from ffprobe
 type VideoMetadata struct {
 	Format   FormatInfo   `json:"format"`
@@ -149,6 +158,18 @@ type TranscodeOptions struct {
 	ExtraArgs    []string
 }
 
+// sourceDuration returns the duration of a source in seconds, or 0 when it
+// cannot be probed
+func (f *FFmpeg) sourceDuration(ctx context.Context, inputPath string) float64 {
+	metadata, err := f.ProbeVideo(ctx, inputPath)
+	if err != nil {
+		return 0
+	}
+
+	duration, _ := strconv.ParseFloat(metadata.Format.Duration, 64)
+	return duration
+}
+
 // ProgressCallback is called with progress updates
 type ProgressCallback func(progress float64)
 
@@ -163,10 +184,9 @@ func (f *FFmpeg) Transcode(ctx context.Context, opts TranscodeOptions, progressC
 	totalDuration, _ := strconv.ParseFloat(metadata.Format.Duration, 64)
 
 	// Build FFmpeg command
-	args := []string{
-		"-i", opts.InputPath,
+	args := append(inputArgs(opts.InputPath),
 		"-y", // overwrite output
-	}
+	)
 
 	// Video codec
 	if opts.VideoCodec != "" {
@@ -213,7 +233,22 @@ func (f *FFmpeg) Transcode(ctx context.Context, opts TranscodeOptions, progressC
 	// Output
 	args = append(args, opts.OutputPath)
 
-	cmd := exec.CommandContext(ctx, f.ffmpegPath, args...)
+	maxRuntime := f.watchdog.MaxRuntime(totalDuration, opts.VideoCodec)
+	return f.runWatched(ctx, "ffmpeg", args, totalDuration, maxRuntime, progressCB)
+}
+
+// runWatched runs ffmpeg with args, which must include "-progress pipe:1",
+// reporting progress against totalDuration seconds of output. The run is
+// killed once it stalls or exceeds maxRuntime, and then fails with a
+// *WatchdogError; other failures are reported as what failed.
+func (f *FFmpeg) runWatched(ctx context.Context, what string, args []string, totalDuration float64, maxRuntime time.Duration, progressCB ProgressCallback) error {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dog := newWatchdog(f.watchdog.StallTimeout, maxRuntime)
+	var tripped atomic.Pointer[WatchdogError]
+
+	cmd := exec.CommandContext(runCtx, f.ffmpegPath, args...)
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -229,6 +264,13 @@ func (f *FFmpeg) Transcode(ctx context.Context, opts TranscodeOptions, progressC
 		return fmt.Errorf("failed to start ffmpeg: %w", err)
 	}
 
+	if dog.enabled() {
+		go dog.run(runCtx, func(werr *WatchdogError) {
+			tripped.Store(werr)
+			cancel()
+		})
+	}
+
 	// Parse progress
 	progressRegex := regexp.MustCompile(`out_time_ms=(\d+)`)
 	scanner := bufio.NewScanner(stdout)
@@ -238,6 +280,7 @@ func (f *FFmpeg) Transcode(ctx context.Context, opts TranscodeOptions, progressC
 			line := scanner.Text()
 			if matches := progressRegex.FindStringSubmatch(line); len(matches) > 1 {
 				if timeMs, err := strconv.ParseFloat(matches[1], 64); err == nil {
+					dog.observe(int64(timeMs))
 					currentTime := timeMs / 1000000.0 // Convert to seconds
 					if totalDuration > 0 {
 						progress := (currentTime / totalDuration) * 100
@@ -263,7 +306,11 @@ func (f *FFmpeg) Transcode(ctx context.Context, opts TranscodeOptions, progressC
 	}()
 
 	if err := cmd.Wait(); err != nil {
-		return fmt.Errorf("ffmpeg failed: %w, stderr: %s", err, stderrBuf.String())
+		if werr := tripped.Load(); werr != nil {
+			werr.Stderr = stderrBuf.String()
+			return werr
+		}
+		return fmt.Errorf("%s failed: %w, stderr: %s", what, err, stderrBuf.String())
 	}
 
 	// Final progress update
@@ -1,14 +1,16 @@
 package transcoder
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/therealutkarshpriyadarshi/transcode/internal/scte35"
 	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
 )
 
@@ -22,6 +24,7 @@ type HLSOptions struct {
 	VideoCodec     string
 	AudioCodec     string
 	Preset         string
+	CuePoints      []models.CuePoint // ad breaks to signal with SCTE-35 tags
 }
 
 // HLSResult holds the result of HLS generation
@@ -73,10 +76,10 @@ func (f *FFmpeg) GenerateHLS(ctx context.Context, opts HLSOptions, progressCB Pr
 	}
 
 	// Build FFmpeg command with multiple outputs
-	args := []string{
-		"-i", opts.InputPath,
+	args := append(inputArgs(opts.InputPath),
 		"-y",
-	}
+		"-progress", "pipe:1", // Progress for the callback and the watchdog
+	)
 
 	// Add mapping and encoding options for each resolution
 	for i, res := range opts.Resolutions {
@@ -105,10 +108,23 @@ func (f *FFmpeg) GenerateHLS(ctx context.Context, opts HLSOptions, progressCB Pr
 		}
 	}
 
+	// With ad breaks every segment boundary is a forced keyframe, so segments
+	// are split exactly at the break boundaries. The muxer cuts at every
+	// keyframe and the encoder adds none of its own.
+	hlsTime := fmt.Sprintf("%d", opts.SegmentTime)
+	if len(opts.CuePoints) > 0 {
+		args = append(args,
+			"-force_key_frames", cueKeyframeExpr(opts.CuePoints, opts.SegmentTime),
+			"-g", fmt.Sprintf("%d", opts.SegmentTime*maxCueFrameRate),
+			"-sc_threshold", "0",
+		)
+		hlsTime = "0.1"
+	}
+
 	// HLS-specific options
 	args = append(args,
 		"-f", "hls",
-		"-hls_time", fmt.Sprintf("%d", opts.SegmentTime),
+		"-hls_time", hlsTime,
 		"-hls_playlist_type", opts.PlaylistType,
 		"-hls_flags", "independent_segments+temp_file",
 		"-hls_segment_type", "mpegts",
@@ -139,32 +155,84 @@ func (f *FFmpeg) GenerateHLS(ctx context.Context, opts HLSOptions, progressCB Pr
 		filepath.Join(opts.OutputDir, "stream_%v.m3u8"),
 	)
 
-	// Execute FFmpeg command
-	cmd := exec.CommandContext(ctx, f.ffmpegPath, args...)
+	// Execute FFmpeg command. Every rendition is encoded in the one run, so
+	// the max runtime covers all of them.
+	duration := f.sourceDuration(ctx, opts.InputPath)
+	maxRuntime := f.watchdog.MaxRuntime(duration*float64(len(opts.Resolutions)), opts.VideoCodec)
+	if err := f.runWatched(ctx, "ffmpeg HLS generation", args, duration, maxRuntime, progressCB); err != nil {
+		return nil, err
+	}
 
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	result.MasterPlaylistPath = filepath.Join(opts.OutputDir, "master.m3u8")
 
-	if progressCB != nil {
-		// Get total duration for progress tracking
-		metadata, _ := f.ProbeVideo(ctx, opts.InputPath)
-		if metadata != nil {
-			// Could parse stderr for progress, but simplified for now
-			progressCB(50) // Midway progress
+	if len(opts.CuePoints) > 0 {
+		if err := tagCuePoints(result.VariantPlaylists, opts.CuePoints, time.Now()); err != nil {
+			return nil, fmt.Errorf("failed to insert ad cues: %w", err)
 		}
 	}
 
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("ffmpeg HLS generation failed: %w, stderr: %s", err, stderr.String())
+	return result, nil
+}
+
+// maxCueFrameRate is the highest frame rate for which the GOP length set
+// with ad breaks spans a whole segment
+const maxCueFrameRate = 120
+
+// minCueSegment is the shortest segment left before an ad break boundary;
+// a regular boundary closer to it is dropped
+const minCueSegment = 1.0
+
+// cueKeyframeExpr returns the -force_key_frames expression placing a keyframe
+// every segmentTime seconds and at the start and end of every ad break.
+// Regular keyframes count from the last forced one, so the segment grid
+// restarts at each break boundary.
+func cueKeyframeExpr(cues []models.CuePoint, segmentTime int) string {
+	var boundaries []float64
+	for _, cue := range cues {
+		boundaries = append(boundaries, cue.Offset, cue.Offset+cue.Duration)
 	}
+	sort.Float64s(boundaries)
 
-	if progressCB != nil {
-		progressCB(100)
+	regular := fmt.Sprintf("gte(t,prev_forced_t+%d)", segmentTime)
+	var terms []string
+	for i, boundary := range boundaries {
+		if boundary <= 0 || (i > 0 && boundary == boundaries[i-1]) {
+			continue
+		}
+		b := strconv.FormatFloat(boundary, 'f', 3, 64)
+
+		regular += fmt.Sprintf("*(lt(t,%s)+gte(t,%s))", strconv.FormatFloat(boundary-minCueSegment, 'f', 3, 64), b)
+		terms = append(terms, fmt.Sprintf("gte(t,%s)*lt(prev_forced_t,%s)", b, b))
 	}
 
-	result.MasterPlaylistPath = filepath.Join(opts.OutputDir, "master.m3u8")
+	return fmt.Sprintf("expr:if(isnan(prev_forced_t),1,%s)", strings.Join(append([]string{regular}, terms...), "+"))
+}
 
-	return result, nil
+// tagCuePoints inserts SCTE-35 cue tags into the variant playlists. The
+// playlists get a program date-time starting at base, which DATERANGE needs.
+func tagCuePoints(variants []HLSVariant, cuePoints []models.CuePoint, base time.Time) error {
+	cues := make([]scte35.Cue, 0, len(cuePoints))
+	for i, cue := range cuePoints {
+		cues = append(cues, scte35.Cue{
+			EventID:  uint32(i + 1),
+			Start:    base.Add(time.Duration(cue.Offset * float64(time.Second))),
+			Duration: time.Duration(cue.Duration * float64(time.Second)),
+		})
+	}
+
+	for _, variant := range variants {
+		content, err := os.ReadFile(variant.PlaylistPath)
+		if err != nil {
+			return fmt.Errorf("failed to read playlist: %w", err)
+		}
+
+		tagged := scte35.TagPlaylist(string(content), cues, base)
+		if err := os.WriteFile(variant.PlaylistPath, []byte(tagged), 0644); err != nil {
+			return fmt.Errorf("failed to write playlist: %w", err)
+		}
+	}
+
+	return nil
 }
 
 // GenerateMasterPlaylist creates an HLS master playlist manually
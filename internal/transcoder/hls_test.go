@@ -0,0 +1,56 @@
+package transcoder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+func TestCueKeyframeExpr(t *testing.T) {
+	cues := []models.CuePoint{
+		{Offset: 120.5, Duration: 30},
+		{Offset: 30, Duration: 15},
+	}
+
+	assert.Equal(t,
+		"expr:if(isnan(prev_forced_t),1,gte(t,prev_forced_t+6)"+
+			"*(lt(t,29.000)+gte(t,30.000))*(lt(t,44.000)+gte(t,45.000))*(lt(t,119.500)+gte(t,120.500))*(lt(t,149.500)+gte(t,150.500))"+
+			"+gte(t,30.000)*lt(prev_forced_t,30.000)+gte(t,45.000)*lt(prev_forced_t,45.000)"+
+			"+gte(t,120.500)*lt(prev_forced_t,120.500)+gte(t,150.500)*lt(prev_forced_t,150.500))",
+		cueKeyframeExpr(cues, 6))
+}
+
+func TestTagCuePoints(t *testing.T) {
+	dir := t.TempDir()
+	playlistPath := filepath.Join(dir, "stream_720p.m3u8")
+
+	var playlist strings.Builder
+	playlist.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:6\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+	for i := 0; i < 10; i++ {
+		playlist.WriteString("#EXTINF:6.000000,\n")
+		playlist.WriteString("stream_720p_00" + string(rune('0'+i)) + ".ts\n")
+	}
+	playlist.WriteString("#EXT-X-ENDLIST\n")
+	require.NoError(t, os.WriteFile(playlistPath, []byte(playlist.String()), 0644))
+
+	variants := []HLSVariant{{PlaylistPath: playlistPath}}
+	cues := []models.CuePoint{{Offset: 30, Duration: 12}}
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	require.NoError(t, tagCuePoints(variants, cues, base))
+
+	content, err := os.ReadFile(playlistPath)
+	require.NoError(t, err)
+
+	tagged := string(content)
+	assert.Contains(t, tagged, "#EXT-X-PROGRAM-DATE-TIME:2025-01-01T00:00:00.000Z")
+	assert.Contains(t, tagged, "#EXT-X-CUE-OUT:DURATION=12.000\n#EXTINF:6.000000,\nstream_720p_005.ts")
+	assert.Contains(t, tagged, "#EXT-X-CUE-IN\n#EXTINF:6.000000,\nstream_720p_007.ts")
+	assert.True(t, strings.HasSuffix(tagged, "#EXT-X-ENDLIST\n"))
+}
@@ -90,7 +90,7 @@ func (f *FFmpeg) TranscodeMultiResolution(ctx context.Context, opts MultiResolut
 
 			// Generate output filename
 			outputFilename := fmt.Sprintf("%s_%s_%s.mp4",
-				filepath.Base(opts.InputPath[:len(opts.InputPath)-len(filepath.Ext(opts.InputPath))]),
+				inputName(opts.InputPath),
 				res.Name,
 				opts.VideoCodec,
 			)
@@ -15,7 +15,7 @@ import (
 // QualityService handles quality analysis and per-title encoding
 type QualityService struct {
 	ffmpeg     *FFmpeg
-	storage    *storage.Storage
+	storage    storage.Blobstore
 	repo       *database.Repository
 	optimizer  *EncodingOptimizer
 	vmaf       *VMAFAnalyzer
@@ -26,7 +26,7 @@ type QualityService struct {
 // NewQualityService creates a new quality service
 func NewQualityService(
 	cfg config.TranscoderConfig,
-	storage *storage.Storage,
+	storage storage.Blobstore,
 	repo *database.Repository,
 ) *QualityService {
 	ffmpeg := NewFFmpeg(cfg.FFmpegPath, cfg.FFprobePath)
@@ -52,7 +52,7 @@ func (s *QualityService) AnalyzeVideoQuality(ctx context.Context, videoID string
 
 	// Download video temporarily
 	tempPath := fmt.Sprintf("%s/%s_analysis", s.cfg.TempDir, videoID)
-	if err := s.storage.DownloadFile(ctx, video.OriginalURL, tempPath); err != nil {
+	if err := storage.DownloadFile(ctx, s.storage, video.OriginalURL, tempPath); err != nil {
 		return nil, fmt.Errorf("failed to download video: %w", err)
 	}
 	defer removeFile(tempPath)
@@ -106,7 +106,7 @@ func (s *QualityService) GenerateEncodingProfile(
 
 	// Download video temporarily
 	tempPath := fmt.Sprintf("%s/%s_profile", s.cfg.TempDir, videoID)
-	if err := s.storage.DownloadFile(ctx, video.OriginalURL, tempPath); err != nil {
+	if err := storage.DownloadFile(ctx, s.storage, video.OriginalURL, tempPath); err != nil {
 		return nil, fmt.Errorf("failed to download video: %w", err)
 	}
 	defer removeFile(tempPath)
@@ -172,13 +172,13 @@ func (s *QualityService) CompareEncodings(
 	defer removeFile(out1Path)
 	defer removeFile(out2Path)
 
-	if err := s.storage.DownloadFile(ctx, video.OriginalURL, refPath); err != nil {
+	if err := storage.DownloadFile(ctx, s.storage, video.OriginalURL, refPath); err != nil {
 		return nil, fmt.Errorf("failed to download reference: %w", err)
 	}
-	if err := s.storage.DownloadFile(ctx, output1.URL, out1Path); err != nil {
+	if err := storage.DownloadFile(ctx, s.storage, output1.URL, out1Path); err != nil {
 		return nil, fmt.Errorf("failed to download output1: %w", err)
 	}
-	if err := s.storage.DownloadFile(ctx, output2.URL, out2Path); err != nil {
+	if err := storage.DownloadFile(ctx, s.storage, output2.URL, out2Path); err != nil {
 		return nil, fmt.Errorf("failed to download output2: %w", err)
 	}
 
@@ -300,7 +300,7 @@ func (s *QualityService) runExperimentAsync(ctx context.Context, experiment *mod
 
 	// Download video
 	tempPath := fmt.Sprintf("%s/exp_%s", s.cfg.TempDir, experiment.ID)
-	if err := s.storage.DownloadFile(ctx, video.OriginalURL, tempPath); err != nil {
+	if err := storage.DownloadFile(ctx, s.storage, video.OriginalURL, tempPath); err != nil {
 		experiment.Status = "failed"
 		s.repo.UpdateBitrateExperiment(ctx, experiment)
 		return
@@ -58,13 +58,12 @@ func (f *FFmpeg) DetectScenes(ctx context.Context, opts SceneDetectionOptions) (
 
 	// Use FFmpeg's scene detection filter
 	// The select filter detects scene changes based on pixel differences
-	args := []string{
-		"-i", opts.InputPath,
+	args := append(inputArgs(opts.InputPath),
 		"-vf", fmt.Sprintf("select='gt(scene,%f)',metadata=print:file=%s", opts.Threshold, sceneFile),
 		"-vsync", "vfr",
 		"-f", "null",
 		"-",
-	}
+	)
 
 	cmd := exec.CommandContext(ctx, f.ffmpegPath, args...)
 	output, err := cmd.CombinedOutput()
@@ -111,14 +110,13 @@ func (f *FFmpeg) DetectScenes(ctx context.Context, opts SceneDetectionOptions) (
 
 // extractFrameAtTimestamp extracts a single frame at the specified timestamp
 func (f *FFmpeg) extractFrameAtTimestamp(ctx context.Context, inputPath string, timestamp float64, outputPath string) error {
-	args := []string{
-		"-ss", fmt.Sprintf("%.2f", timestamp),
-		"-i", inputPath,
+	args := append([]string{"-ss", fmt.Sprintf("%.2f", timestamp)}, inputArgs(inputPath)...)
+	args = append(args,
 		"-frames:v", "1",
 		"-q:v", "2", // High quality
 		"-y",
 		outputPath,
-	}
+	)
 
 	cmd := exec.CommandContext(ctx, f.ffmpegPath, args...)
 	output, err := cmd.CombinedOutput()
@@ -0,0 +1,127 @@
+package transcoder
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// segmentPollInterval is how often the output directory of a running
+// encode is checked for finished segments
+const segmentPollInterval = 2 * time.Second
+
+// segmentStreamer uploads the segments of an HLS or DASH encode while ffmpeg
+// is still writing later ones. ffmpeg writes each segment under a temporary
+// name and renames it once it is complete, so every segment file found under
+// its final name is finished. Playlists and manifests are rewritten until the
+// encode ends and are left for flush.
+type segmentStreamer struct {
+	dir       string
+	isSegment func(name string) bool
+	upload    func(ctx context.Context, path, relPath string) error
+
+	mu       sync.Mutex
+	uploaded map[string]bool
+}
+
+// newSegmentStreamer creates a streamer uploading the files under dir, while
+// the encode runs only those whose names isSegment accepts
+func newSegmentStreamer(dir string, isSegment func(name string) bool, upload func(ctx context.Context, path, relPath string) error) *segmentStreamer {
+	return &segmentStreamer{
+		dir:       dir,
+		isSegment: isSegment,
+		upload:    upload,
+		uploaded:  make(map[string]bool),
+	}
+}
+
+// start uploads finished segments until the returned stop is called, which
+// waits for an upload in progress. A failed upload stops streaming; flush
+// uploads the rest.
+func (s *segmentStreamer) start(ctx context.Context) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(segmentPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.sweep(ctx, s.isSegment); err != nil {
+					if ctx.Err() == nil {
+						log.Printf("Failed to stream segments of %s, uploading them after the encode: %v", s.dir, err)
+					}
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// flush uploads every file of the finished encode not streamed yet
+func (s *segmentStreamer) flush(ctx context.Context) error {
+	return s.sweep(ctx, func(string) bool { return true })
+}
+
+// sweep uploads the files accepted by include that were not uploaded yet
+func (s *segmentStreamer) sweep(ctx context.Context, include func(name string) bool) error {
+	return filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Temporary files are renamed away while walking
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(path, ".tmp") || !include(info.Name()) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(s.dir, path)
+		if err != nil || s.done(relPath) {
+			return err
+		}
+
+		if err := s.upload(ctx, path, relPath); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		s.uploaded[relPath] = true
+		s.mu.Unlock()
+		return nil
+	})
+}
+
+// done reports whether the file at relPath was uploaded
+func (s *segmentStreamer) done(relPath string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.uploaded[relPath]
+}
+
+// isHLSSegment reports whether name is an HLS media segment
+func isHLSSegment(name string) bool {
+	return strings.HasSuffix(name, ".ts")
+}
+
+// isDASHSegment reports whether name is a DASH media segment. Init segments
+// are only final once the encode ends.
+func isDASHSegment(name string) bool {
+	return strings.HasPrefix(name, "chunk-") && strings.HasSuffix(name, ".m4s")
+}
@@ -0,0 +1,81 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegmentStreamer(t *testing.T) {
+	dir := t.TempDir()
+
+	var mu sync.Mutex
+	var uploaded []string
+	streamer := newSegmentStreamer(dir, isHLSSegment, func(ctx context.Context, path, relPath string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		uploaded = append(uploaded, relPath)
+		return nil
+	})
+
+	// A finished segment, one still being written and a playlist
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "stream_720p_000.ts"), []byte("seg"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "stream_720p_001.ts.tmp"), []byte("se"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "stream_720p.m3u8"), []byte("#EXTM3U"), 0644))
+
+	stop := streamer.start(context.Background())
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(uploaded) == 1
+	}, 5*segmentPollInterval, 50*time.Millisecond)
+	stop()
+
+	mu.Lock()
+	assert.Equal(t, []string{"stream_720p_000.ts"}, uploaded)
+	mu.Unlock()
+
+	// The encode finishes: the last segment is renamed into place
+	require.NoError(t, os.Rename(filepath.Join(dir, "stream_720p_001.ts.tmp"), filepath.Join(dir, "stream_720p_001.ts")))
+	require.NoError(t, streamer.flush(context.Background()))
+
+	sort.Strings(uploaded)
+	assert.Equal(t, []string{"stream_720p.m3u8", "stream_720p_000.ts", "stream_720p_001.ts"}, uploaded)
+}
+
+func TestSegmentStreamerFlushRetriesFailedUploads(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "chunk-stream0-00001.m4s"), []byte("seg"), 0644))
+
+	fail := true
+	var uploaded []string
+	streamer := newSegmentStreamer(dir, isDASHSegment, func(ctx context.Context, path, relPath string) error {
+		if fail {
+			return fmt.Errorf("storage unavailable")
+		}
+		uploaded = append(uploaded, relPath)
+		return nil
+	})
+
+	assert.Error(t, streamer.sweep(context.Background(), streamer.isSegment))
+
+	fail = false
+	require.NoError(t, streamer.flush(context.Background()))
+	assert.Equal(t, []string{"chunk-stream0-00001.m4s"}, uploaded)
+}
+
+func TestSegmentNames(t *testing.T) {
+	assert.True(t, isHLSSegment("stream_720p_003.ts"))
+	assert.False(t, isHLSSegment("stream_720p.m3u8"))
+	assert.True(t, isDASHSegment("chunk-stream0-00003.m4s"))
+	assert.False(t, isDASHSegment("init-stream0.m4s"))
+	assert.False(t, isDASHSegment("manifest.mpd"))
+}
@@ -3,13 +3,16 @@ package transcoder
 import (
 	"context"
 	"fmt"
+	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/config"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/database"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/destination"
 	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
 	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
 )
@@ -17,27 +20,61 @@ import (
 // Service orchestrates transcoding operations
 type Service struct {
 	ffmpeg     *FFmpeg
-	storage    *storage.Storage
+	storage    storage.Blobstore
+	objects    *storage.OptimizedStorage
 	repo       *database.Repository
 	cfg        config.TranscoderConfig
 	workerID   string
+
+	// destinations opens the customer destinations outputs are delivered
+	// to; jobs naming destinations fail without it
+	destinations *destination.Resolver
 }
 
 // NewService creates a new transcoder service
 func NewService(
 	cfg config.TranscoderConfig,
-	storage *storage.Storage,
+	store storage.Blobstore,
 	repo *database.Repository,
 ) *Service {
+	workerID := cfg.WorkerID
+	if workerID == "" {
+		workerID = uuid.New().String()
+	}
+
+	ffmpeg := NewFFmpeg(cfg.FFmpegPath, cfg.FFprobePath)
+	ffmpeg.SetWatchdog(WatchdogConfig{
+		StallTimeout:     cfg.StallTimeout,
+		MaxRuntimeFactor: cfg.MaxRuntimeFactor,
+		MinMaxRuntime:    cfg.MinMaxRuntime,
+	})
+
 	return &Service{
-		ffmpeg:   NewFFmpeg(cfg.FFmpegPath, cfg.FFprobePath),
-		storage:  storage,
+		ffmpeg:   ffmpeg,
+		storage:  store,
+		objects:  storage.NewOptimizedStorage(store, storage.DefaultPartSize),
 		repo:     repo,
 		cfg:      cfg,
-		workerID: uuid.New().String(),
+		workerID: workerID,
 	}
 }
 
+// SetDestinations enables delivery of outputs to output destinations
+func (s *Service) SetDestinations(resolver *destination.Resolver) {
+	s.destinations = resolver
+}
+
+// openDestinations opens the output destinations of a job
+func (s *Service) openDestinations(ctx context.Context, job *models.Job) ([]*destination.Target, error) {
+	if len(job.Config.Destinations) == 0 {
+		return nil, nil
+	}
+	if s.destinations == nil {
+		return nil, fmt.Errorf("output destinations are not configured on this worker")
+	}
+	return s.destinations.Open(ctx, job)
+}
+
 // ProcessJob processes a transcoding job
 func (s *Service) ProcessJob(ctx context.Context, job *models.Job) error {
 	// Update job status to processing
@@ -46,6 +83,7 @@ func (s *Service) ProcessJob(ctx context.Context, job *models.Job) error {
 	now := time.Now()
 	job.StartedAt = &now
 	job.Progress = 0
+	job.ReusedFromJobID = nil
 
 	if err := s.repo.UpdateJob(ctx, job); err != nil {
 		return fmt.Errorf("failed to update job status: %w", err)
@@ -57,6 +95,21 @@ func (s *Service) ProcessJob(ctx context.Context, job *models.Job) error {
 		return s.failJob(ctx, job, fmt.Errorf("failed to get video: %w", err))
 	}
 
+	targets, err := s.openDestinations(ctx, job)
+	if err != nil {
+		return s.failJob(ctx, job, err)
+	}
+
+	// An earlier job may have transcoded the same source with the same
+	// config; its outputs are copied instead of encoding again
+	reused, err := s.reuseOutputs(ctx, job, video)
+	if err != nil {
+		log.Printf("Failed to reuse outputs for job %s, transcoding instead: %v", job.ID, err)
+	}
+	if reused {
+		return s.completeJob(ctx, job, video.ID)
+	}
+
 	// Create temporary directory
 	tempDir := filepath.Join(s.cfg.TempDir, job.ID)
 	if err := os.MkdirAll(tempDir, 0755); err != nil {
@@ -64,10 +117,10 @@ func (s *Service) ProcessJob(ctx context.Context, job *models.Job) error {
 	}
 	defer os.RemoveAll(tempDir)
 
-	// Download source video
-	inputPath := filepath.Join(tempDir, "input"+filepath.Ext(video.Filename))
-	if err := s.storage.DownloadFile(ctx, video.OriginalURL, inputPath); err != nil {
-		return s.failJob(ctx, job, fmt.Errorf("failed to download video: %w", err))
+	// Read the source in place, or download it when it cannot be streamed
+	inputPath, err := s.sourceInput(ctx, video, tempDir)
+	if err != nil {
+		return s.failJob(ctx, job, err)
 	}
 
 	// Determine output format
@@ -131,12 +184,24 @@ func (s *Service) ProcessJob(ctx context.Context, job *models.Job) error {
 
 	// Upload output to storage
 	storageKey := fmt.Sprintf("videos/%s/outputs/%s", video.ID, outputFilename)
-	if err := s.storage.UploadFile(ctx, storageKey, outputPath); err != nil {
+	if err := storage.UploadFile(ctx, s.storage, storageKey, outputPath); err != nil {
 		return s.failJob(ctx, job, fmt.Errorf("failed to upload output: %w", err))
 	}
 
+	vars := destination.Vars{
+		VideoID:    video.ID,
+		JobID:      job.ID,
+		Title:      destination.TitleOf(video.Filename),
+		Resolution: job.Config.Resolution,
+		Format:     format,
+		Segment:    outputFilename,
+	}
+	if err := destination.Deliver(ctx, targets, outputPath, vars); err != nil {
+		return s.failJob(ctx, job, err)
+	}
+
 	// Get URL for output
-	url, err := s.storage.GetURL(ctx, storageKey)
+	url, err := storage.GetURL(ctx, s.storage, storageKey)
 	if err != nil {
 		return s.failJob(ctx, job, fmt.Errorf("failed to get output URL: %w", err))
 	}
@@ -161,7 +226,93 @@ func (s *Service) ProcessJob(ctx context.Context, job *models.Job) error {
 		return s.failJob(ctx, job, fmt.Errorf("failed to create output record: %w", err))
 	}
 
-	// Update job as completed
+	return s.completeJob(ctx, job, video.ID)
+}
+
+// reuseOutputs gives job copies of the outputs of the latest completed job
+// that transcoded a source with the same checksum, of the same tenant, with
+// an equivalent config. It returns false when there is no such job.
+func (s *Service) reuseOutputs(ctx context.Context, job *models.Job, video *models.Video) (bool, error) {
+	return reuseJobOutputs(ctx, s.repo, s.objects, job, video)
+}
+
+// ReuseStore finds the outputs of earlier jobs and records their copies
+type ReuseStore interface {
+	FindReusableJob(ctx context.Context, job *models.Job, checksum string, userID *string) (string, error)
+	GetOutputsByJobID(ctx context.Context, jobID string) ([]*models.Output, error)
+	CreateOutputs(ctx context.Context, outputs []*models.Output) error
+}
+
+// reuseJobOutputs copies every output first and records the copies together.
+// When a step fails the copies made are deleted, so a job transcoding
+// instead leaves nothing of the reuse behind.
+func reuseJobOutputs(ctx context.Context, repo ReuseStore, store storage.Blobstore, job *models.Job, video *models.Video) (bool, error) {
+	// Copies in our bucket would not reach the job's destinations
+	if video.Checksum == "" || len(job.Config.Destinations) > 0 {
+		return false, nil
+	}
+
+	priorID, err := repo.FindReusableJob(ctx, job, video.Checksum, video.UserID)
+	if err != nil || priorID == "" {
+		return false, err
+	}
+
+	priors, err := repo.GetOutputsByJobID(ctx, priorID)
+	if err != nil {
+		return false, err
+	}
+
+	var copied []string
+	cleanup := func() {
+		for _, key := range copied {
+			if err := store.Delete(ctx, key); err != nil {
+				log.Printf("Failed to delete copied output %s: %v", key, err)
+			}
+		}
+	}
+
+	outputs := make([]*models.Output, 0, len(priors))
+	for _, prior := range priors {
+		// Every video has its own copy, so lifecycle rules and deletion of
+		// one video leave the other's outputs alone
+		key := prior.Path
+		if prior.VideoID != video.ID {
+			key = fmt.Sprintf("videos/%s/outputs/%s", video.ID, path.Base(prior.Path))
+			if err := store.Copy(ctx, prior.Path, key); err != nil {
+				cleanup()
+				return false, fmt.Errorf("failed to copy output %s: %w", prior.Path, err)
+			}
+			copied = append(copied, key)
+		}
+
+		url, err := storage.GetURL(ctx, store, key)
+		if err != nil {
+			cleanup()
+			return false, fmt.Errorf("failed to get output URL: %w", err)
+		}
+
+		output := *prior
+		output.ID = ""
+		output.JobID = job.ID
+		output.VideoID = video.ID
+		output.URL = url
+		output.Path = key
+		outputs = append(outputs, &output)
+	}
+
+	if err := repo.CreateOutputs(ctx, outputs); err != nil {
+		cleanup()
+		return false, err
+	}
+
+	job.ReusedFromJobID = &priorID
+	log.Printf("Job %s reused %d outputs of job %s", job.ID, len(outputs), priorID)
+
+	return true, nil
+}
+
+// completeJob marks a job completed and updates its video's status
+func (s *Service) completeJob(ctx context.Context, job *models.Job, videoID string) error {
 	job.Status = models.JobStatusCompleted
 	job.Progress = 100
 	completed := time.Now()
@@ -172,7 +323,7 @@ func (s *Service) ProcessJob(ctx context.Context, job *models.Job) error {
 	}
 
 	// Update video status if all jobs are completed
-	if err := s.updateVideoStatus(ctx, video.ID); err != nil {
+	if err := s.updateVideoStatus(ctx, videoID); err != nil {
 		return fmt.Errorf("failed to update video status: %w", err)
 	}
 
@@ -193,21 +344,24 @@ func (s *Service) failJob(ctx context.Context, job *models.Job, err error) error
 	return err
 }
 
-// updateVideoStatus updates video status based on job statuses
+// updateVideoStatus updates video status based on the statuses of its
+// transcode jobs. Other jobs operate on a video without changing its status.
 func (s *Service) updateVideoStatus(ctx context.Context, videoID string) error {
 	jobs, err := s.repo.GetJobsByVideoID(ctx, videoID)
 	if err != nil {
 		return err
 	}
 
-	if len(jobs) == 0 {
-		return nil
-	}
-
 	allCompleted := true
 	anyFailed := false
+	transcodes := 0
 
 	for _, job := range jobs {
+		if !job.IsTranscode() {
+			continue
+		}
+		transcodes++
+
 		if job.Status == models.JobStatusPending || job.Status == models.JobStatusProcessing {
 			allCompleted = false
 		}
@@ -216,6 +370,10 @@ func (s *Service) updateVideoStatus(ctx context.Context, videoID string) error {
 		}
 	}
 
+	if transcodes == 0 {
+		return nil
+	}
+
 	video, err := s.repo.GetVideo(ctx, videoID)
 	if err != nil {
 		return err
@@ -0,0 +1,453 @@
+package transcoder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/therealutkarshpriyadarshi/transcode/internal/netguard"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// maxWatermarkSize caps watermark images fetched from URLs
+const maxWatermarkSize = 10 << 20
+
+// watermarkClient fetches watermark images, refusing private addresses
+var watermarkClient = &http.Client{
+	Transport: netguard.Transport(false),
+	Timeout:   time.Minute,
+}
+
+// operation runs a job other than a transcode on its video, with a temporary
+// directory removed afterwards, and returns the job's result
+type operation func(ctx context.Context, job *models.Job, video *models.Video, tempDir string) (interface{}, error)
+
+// Process runs a job of any type
+func (s *Service) Process(ctx context.Context, job *models.Job) error {
+	switch job.Type {
+	case "", models.JobTypeTranscode:
+		return s.ProcessJob(ctx, job)
+	case models.JobTypeSceneDetection:
+		return s.runOperation(ctx, job, s.detectScenes)
+	case models.JobTypeWatermark:
+		return s.runOperation(ctx, job, s.applyWatermark)
+	case models.JobTypeConcatenation:
+		return s.runOperation(ctx, job, s.concatenate)
+	case models.JobTypeLiveClip:
+		return s.runOperation(ctx, job, s.assembleLiveClip)
+	default:
+		return s.failJob(ctx, job, fmt.Errorf("unsupported job type %q", job.Type))
+	}
+}
+
+// runOperation runs op for a job and stores its result
+func (s *Service) runOperation(ctx context.Context, job *models.Job, op operation) error {
+	job.Status = models.JobStatusProcessing
+	job.WorkerID = s.workerID
+	now := time.Now()
+	job.StartedAt = &now
+	job.Progress = 0
+	job.Result = nil
+
+	if err := s.repo.UpdateJob(ctx, job); err != nil {
+		return fmt.Errorf("failed to update job status: %w", err)
+	}
+
+	video, err := s.repo.GetVideo(ctx, job.VideoID)
+	if err != nil {
+		return s.failJob(ctx, job, fmt.Errorf("failed to get video: %w", err))
+	}
+
+	tempDir := filepath.Join(s.cfg.TempDir, job.ID)
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return s.failJob(ctx, job, fmt.Errorf("failed to create temp directory: %w", err))
+	}
+	defer os.RemoveAll(tempDir)
+
+	result, err := op(ctx, job, video, tempDir)
+	if err != nil {
+		return s.failJob(ctx, job, err)
+	}
+
+	job.Result, err = json.Marshal(result)
+	if err != nil {
+		return s.failJob(ctx, job, fmt.Errorf("failed to encode job result: %w", err))
+	}
+
+	return s.completeJob(ctx, job, video.ID)
+}
+
+// setProgress records the progress of a job between its steps
+func (s *Service) setProgress(ctx context.Context, job *models.Job, progress float64) {
+	job.Progress = progress
+	s.repo.UpdateJob(ctx, job)
+}
+
+// detectScenes finds the scenes of a video. Their representative frames are
+// stored as artifacts under videos/<id>/artifacts/<job-id>/.
+func (s *Service) detectScenes(ctx context.Context, job *models.Job, video *models.Video, tempDir string) (interface{}, error) {
+	params := job.Config.SceneDetection
+	if params == nil {
+		params = &models.SceneDetectionParams{}
+	}
+
+	inputPath, err := s.sourceInput(ctx, video, tempDir)
+	if err != nil {
+		return nil, err
+	}
+	s.setProgress(ctx, job, 10)
+
+	result, err := s.ffmpeg.DetectScenes(ctx, SceneDetectionOptions{
+		InputPath:        inputPath,
+		OutputDir:        filepath.Join(tempDir, "scenes"),
+		Threshold:        params.Threshold,
+		MinSceneDuration: params.MinSceneDuration,
+		MaxScenes:        params.MaxScenes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scene detection failed: %w", err)
+	}
+	s.setProgress(ctx, job, 80)
+
+	// Frames are returned as storage keys instead of worker paths
+	for i := range result.Scenes {
+		scene := &result.Scenes[i]
+		if scene.FramePath == "" {
+			continue
+		}
+
+		key := fmt.Sprintf("videos/%s/artifacts/%s/%s", video.ID, job.ID, filepath.Base(scene.FramePath))
+		if err := storage.UploadFile(ctx, s.storage, key, scene.FramePath); err != nil {
+			return nil, fmt.Errorf("failed to upload scene frame: %w", err)
+		}
+		scene.FramePath = key
+
+		if result.BestScene != nil && result.BestScene.SceneNumber == scene.SceneNumber {
+			best := *scene
+			result.BestScene = &best
+		}
+	}
+
+	return result, nil
+}
+
+// applyWatermark renders a text or image watermark onto a video, stored as
+// an output of the job
+func (s *Service) applyWatermark(ctx context.Context, job *models.Job, video *models.Video, tempDir string) (interface{}, error) {
+	params := job.Config.Watermark
+	if params == nil {
+		return nil, fmt.Errorf("watermark job has no watermark parameters")
+	}
+
+	inputPath, err := s.sourceInput(ctx, video, tempDir)
+	if err != nil {
+		return nil, err
+	}
+
+	format := job.Config.OutputFormat
+	if format == "" {
+		format = "mp4"
+	}
+
+	opts := WatermarkOptions{
+		InputPath:     inputPath,
+		OutputPath:    filepath.Join(tempDir, fmt.Sprintf("watermarked_%s.%s", job.ID, format)),
+		WatermarkText: params.Text,
+		Position:      params.Position,
+		Opacity:       params.Opacity,
+		Scale:         params.Scale,
+		FontSize:      params.FontSize,
+		FontColor:     params.FontColor,
+		Padding:       params.Padding,
+	}
+
+	if params.ImageURL != "" {
+		opts.WatermarkPath = filepath.Join(tempDir, "watermark"+path.Ext(imagePath(params.ImageURL)))
+		if err := fetchWatermark(ctx, params.ImageURL, opts.WatermarkPath); err != nil {
+			return nil, err
+		}
+	}
+	s.setProgress(ctx, job, 10)
+
+	if err := s.ffmpeg.ApplyWatermark(ctx, opts); err != nil {
+		return nil, err
+	}
+	s.setProgress(ctx, job, 80)
+
+	return s.storeOperationOutput(ctx, job, video.ID, opts.OutputPath, format, "")
+}
+
+// concatenate joins the videos of a job into one, stored as an output of the
+// job's video, the first one
+func (s *Service) concatenate(ctx context.Context, job *models.Job, video *models.Video, tempDir string) (interface{}, error) {
+	params := job.Config.Concatenation
+	if params == nil || len(params.VideoIDs) < 2 {
+		return nil, fmt.Errorf("concatenation job needs at least 2 videos")
+	}
+
+	// The concat demuxer reads a list of local files
+	inputPaths := make([]string, 0, len(params.VideoIDs))
+	for i, videoID := range params.VideoIDs {
+		input, err := s.repo.GetVideo(ctx, videoID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get video %s: %w", videoID, err)
+		}
+		if job.UserID != nil && (input.UserID == nil || *input.UserID != *job.UserID) {
+			return nil, fmt.Errorf("video %s does not belong to the job's owner", videoID)
+		}
+		if input.OriginalURL == "" {
+			return nil, fmt.Errorf("source of video %s was deleted", videoID)
+		}
+
+		inputPath := filepath.Join(tempDir, fmt.Sprintf("input_%d%s", i, filepath.Ext(input.Filename)))
+		if err := storage.DownloadFile(ctx, s.storage, input.OriginalURL, inputPath); err != nil {
+			return nil, fmt.Errorf("failed to download video %s: %w", videoID, err)
+		}
+		inputPaths = append(inputPaths, inputPath)
+
+		s.setProgress(ctx, job, float64(i+1)/float64(len(params.VideoIDs))*40)
+	}
+
+	outputPath := filepath.Join(tempDir, fmt.Sprintf("concatenated_%s.mp4", job.ID))
+	err := s.ffmpeg.ConcatVideo(ctx, ConcatenationOptions{
+		InputPaths:         inputPaths,
+		OutputPath:         outputPath,
+		Method:             params.Method,
+		TransitionType:     params.TransitionType,
+		TransitionDuration: params.TransitionDuration,
+		ReEncode:           params.ReEncode,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("concatenation failed: %w", err)
+	}
+	s.setProgress(ctx, job, 80)
+
+	return s.storeOperationOutput(ctx, job, video.ID, outputPath, "mp4", "")
+}
+
+// assembleLiveClip remuxes the live segments copied for a clip into an MP4
+// output per variant, re-encoding variants cut between keyframes. The clip
+// video, which exists only for the clip, gets the highest bitrate output as
+// its source and fails along with the job.
+func (s *Service) assembleLiveClip(ctx context.Context, job *models.Job, video *models.Video, tempDir string) (result interface{}, err error) {
+	params := job.Config.LiveClip
+	if params == nil || len(params.Variants) == 0 {
+		return nil, fmt.Errorf("live clip job has no variants")
+	}
+
+	defer func() {
+		if err != nil {
+			video.Status = models.VideoStatusFailed
+			if updateErr := s.repo.UpdateVideo(ctx, video); updateErr != nil {
+				log.Printf("Failed to update clip video %s: %v", video.ID, updateErr)
+			}
+		}
+	}()
+
+	clip := &models.LiveStreamClip{
+		LiveStreamID: params.LiveStreamID,
+		JobID:        job.ID,
+		Video:        video,
+		StartTime:    params.StartTime,
+	}
+
+	var best *models.Output
+	var bestPath string
+	for i, variant := range params.Variants {
+		dir := filepath.Join(tempDir, variant.Resolution)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create clip directory: %w", err)
+		}
+
+		for _, key := range variant.Segments {
+			if err := storage.DownloadFile(ctx, s.storage, key, filepath.Join(dir, path.Base(key))); err != nil {
+				return nil, fmt.Errorf("failed to download clip segment: %w", err)
+			}
+		}
+
+		playlistPath := filepath.Join(dir, "clip.m3u8")
+		if err := os.WriteFile(playlistPath, []byte(variant.Playlist), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write clip playlist: %w", err)
+		}
+
+		opts := ClipOptions{
+			InputPath:  playlistPath,
+			OutputPath: filepath.Join(tempDir, fmt.Sprintf("clip_%s.mp4", variant.Resolution)),
+			Start:      variant.Offset,
+			Duration:   variant.Duration,
+			ReEncode:   variant.ReEncode,
+			Bitrate:    variant.Bitrate,
+		}
+		if err := s.ffmpeg.ExtractClip(ctx, opts); err != nil {
+			return nil, fmt.Errorf("failed to assemble %s clip: %w", variant.Resolution, err)
+		}
+
+		output, err := s.storeOperationOutput(ctx, job, video.ID, opts.OutputPath, "mp4", variant.Resolution)
+		if err != nil {
+			return nil, err
+		}
+		clip.Outputs = append(clip.Outputs, output)
+
+		if best == nil || output.Bitrate >= best.Bitrate {
+			best = output
+			bestPath = opts.OutputPath
+		}
+		s.setProgress(ctx, job, float64(i+1)/float64(len(params.Variants))*80)
+	}
+
+	video.OriginalURL = best.Path
+	video.Size = best.Size
+	video.Duration = best.Duration
+	clip.Duration = best.Duration
+
+	clip.Thumbnail, err = s.clipThumbnail(ctx, video, bestPath, tempDir)
+	if err != nil {
+		log.Printf("Failed to create thumbnail for clip %s: %v", video.ID, err)
+	}
+
+	video.Status = models.VideoStatusCompleted
+	if err := s.repo.UpdateVideo(ctx, video); err != nil {
+		return nil, fmt.Errorf("failed to update clip video: %w", err)
+	}
+
+	// The copied live segments are only kept for retries
+	for _, variant := range params.Variants {
+		for _, key := range variant.Segments {
+			s.storage.Delete(ctx, key)
+		}
+	}
+
+	return clip, nil
+}
+
+// clipThumbnail extracts a poster frame from the middle of a clip
+func (s *Service) clipThumbnail(ctx context.Context, video *models.Video, inputPath, tempDir string) (*models.Thumbnail, error) {
+	timestamp := video.Duration / 2
+	thumbPath := filepath.Join(tempDir, "thumbnail.jpg")
+
+	if err := s.ffmpeg.ExtractThumbnail(ctx, inputPath, thumbPath, timestamp); err != nil {
+		return nil, err
+	}
+
+	storageKey := fmt.Sprintf("videos/%s/thumbnails/clip.jpg", video.ID)
+	if err := storage.UploadFile(ctx, s.storage, storageKey, thumbPath); err != nil {
+		return nil, fmt.Errorf("failed to upload thumbnail: %w", err)
+	}
+
+	url, err := storage.GetURL(ctx, s.storage, storageKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thumbnail URL: %w", err)
+	}
+
+	thumbnail := &models.Thumbnail{
+		VideoID:       video.ID,
+		ThumbnailType: models.ThumbnailTypeSingle,
+		URL:           url,
+		Path:          storageKey,
+		Width:         video.Width,
+		Height:        video.Height,
+		Timestamp:     &timestamp,
+	}
+
+	if err := s.repo.CreateThumbnail(ctx, thumbnail); err != nil {
+		return nil, err
+	}
+
+	return thumbnail, nil
+}
+
+// storeOperationOutput uploads the file an operation produced and records it
+// as an output of the job
+func (s *Service) storeOperationOutput(ctx context.Context, job *models.Job, videoID, outputPath, format, resolution string) (*models.Output, error) {
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat output file: %w", err)
+	}
+
+	metadata, err := s.ffmpeg.ExtractVideoInfo(ctx, outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract output metadata: %w", err)
+	}
+
+	storageKey := fmt.Sprintf("videos/%s/outputs/%s", videoID, filepath.Base(outputPath))
+	if err := storage.UploadFile(ctx, s.storage, storageKey, outputPath); err != nil {
+		return nil, fmt.Errorf("failed to upload output: %w", err)
+	}
+
+	outputURL, err := storage.GetURL(ctx, s.storage, storageKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get output URL: %w", err)
+	}
+
+	output := &models.Output{
+		JobID:      job.ID,
+		VideoID:    videoID,
+		Format:     format,
+		Resolution: resolution,
+		Width:      metadata.Width,
+		Height:     metadata.Height,
+		Codec:      metadata.Codec,
+		Bitrate:    metadata.Bitrate,
+		Size:       info.Size(),
+		Duration:   metadata.Duration,
+		URL:        outputURL,
+		Path:       storageKey,
+	}
+	if err := s.repo.CreateOutput(ctx, output); err != nil {
+		return nil, fmt.Errorf("failed to create output record: %w", err)
+	}
+
+	return output, nil
+}
+
+// imagePath returns the path of an image URL without its query
+func imagePath(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
+
+// fetchWatermark downloads a watermark image from an HTTP(S) URL
+func fetchWatermark(ctx context.Context, rawURL, filePath string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("invalid watermark image URL: %w", err)
+	}
+
+	resp, err := watermarkClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch watermark image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch watermark image: %s", resp.Status)
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create watermark file: %w", err)
+	}
+	defer file.Close()
+
+	n, err := io.Copy(file, io.LimitReader(resp.Body, maxWatermarkSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to fetch watermark image: %w", err)
+	}
+	if n > maxWatermarkSize {
+		return fmt.Errorf("watermark image is larger than %d bytes", maxWatermarkSize)
+	}
+
+	return file.Close()
+}
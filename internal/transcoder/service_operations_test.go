@@ -0,0 +1,29 @@
+package transcoder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/netguard"
+)
+
+func TestImagePath(t *testing.T) {
+	assert.Equal(t, "/assets/logo.png", imagePath("https://cdn.example.com/assets/logo.png?v=3"))
+	assert.Equal(t, "", imagePath("://bad"))
+}
+
+func TestFetchWatermarkRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("png"))
+	}))
+	defer server.Close()
+
+	err := fetchWatermark(context.Background(), server.URL+"/logo.png", filepath.Join(t.TempDir(), "watermark.png"))
+	require.Error(t, err)
+	assert.ErrorIs(t, err, netguard.ErrPrivateAddress)
+}
@@ -9,6 +9,8 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/destination"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
 	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
 )
 
@@ -32,6 +34,18 @@ func (s *Service) ProcessJobPhase2(ctx context.Context, job *models.Job) error {
 		return s.failJob(ctx, job, fmt.Errorf("failed to get video: %w", err))
 	}
 
+	// Outputs are also delivered to the job's output destinations
+	targets, err := s.openDestinations(ctx, job)
+	if err != nil {
+		return s.failJob(ctx, job, err)
+	}
+	vars := destination.Vars{
+		VideoID: video.ID,
+		JobID:   job.ID,
+		Title:   destination.TitleOf(video.Filename),
+		Format:  job.Config.OutputFormat,
+	}
+
 	// Create temporary directory
 	tempDir := filepath.Join(s.cfg.TempDir, job.ID)
 	if err := os.MkdirAll(tempDir, 0755); err != nil {
@@ -39,10 +53,10 @@ func (s *Service) ProcessJobPhase2(ctx context.Context, job *models.Job) error {
 	}
 	defer os.RemoveAll(tempDir)
 
-	// Download source video
-	inputPath := filepath.Join(tempDir, "input"+filepath.Ext(video.Filename))
-	if err := s.storage.DownloadFile(ctx, video.OriginalURL, inputPath); err != nil {
-		return s.failJob(ctx, job, fmt.Errorf("failed to download video: %w", err))
+	// Read the source in place, or download it when it cannot be streamed
+	inputPath, err := s.sourceInput(ctx, video, tempDir)
+	if err != nil {
+		return s.failJob(ctx, job, err)
 	}
 
 	// Parse resolutions from job config
@@ -138,15 +152,20 @@ func (s *Service) ProcessJobPhase2(ctx context.Context, job *models.Job) error {
 			VideoCodec:   videoCodec,
 			AudioCodec:   audioCodec,
 			Preset:       preset,
+			CuePoints:    job.Config.CuePoints,
 		}
 
-		hlsResult, err := s.ffmpeg.GenerateHLS(ctx, hlsOpts, progressCallback)
+		// Segments are uploaded as they are written
+		streamer := newSegmentStreamer(hlsDir, isHLSSegment, s.streamFileUploader(video.ID, "hls", targets, vars))
+		stop := streamer.start(ctx)
+		_, err := s.ffmpeg.GenerateHLS(ctx, hlsOpts, progressCallback)
+		stop()
 		if err != nil {
 			return s.failJob(ctx, job, fmt.Errorf("HLS generation failed: %w", err))
 		}
 
-		// Upload HLS files to storage
-		if err := s.uploadHLSFiles(ctx, video.ID, job.ID, hlsDir, hlsResult); err != nil {
+		// Upload the playlists and the segments not streamed yet
+		if err := streamer.flush(ctx); err != nil {
 			return s.failJob(ctx, job, fmt.Errorf("failed to upload HLS files: %w", err))
 		}
 
@@ -168,13 +187,17 @@ func (s *Service) ProcessJobPhase2(ctx context.Context, job *models.Job) error {
 			Preset:      preset,
 		}
 
-		dashResult, err := s.ffmpeg.GenerateDASH(ctx, dashOpts, progressCallback)
+		// Segments are uploaded as they are written
+		streamer := newSegmentStreamer(dashDir, isDASHSegment, s.streamFileUploader(video.ID, "dash", targets, vars))
+		stop := streamer.start(ctx)
+		_, err := s.ffmpeg.GenerateDASH(ctx, dashOpts, progressCallback)
+		stop()
 		if err != nil {
 			return s.failJob(ctx, job, fmt.Errorf("DASH generation failed: %w", err))
 		}
 
-		// Upload DASH files to storage
-		if err := s.uploadDASHFiles(ctx, video.ID, job.ID, dashDir, dashResult); err != nil {
+		// Upload the manifest, init segments and the segments not streamed yet
+		if err := streamer.flush(ctx); err != nil {
 			return s.failJob(ctx, job, fmt.Errorf("failed to upload DASH files: %w", err))
 		}
 
@@ -206,11 +229,18 @@ func (s *Service) ProcessJobPhase2(ctx context.Context, job *models.Job) error {
 
 			// Upload to storage
 			storageKey := fmt.Sprintf("videos/%s/outputs/%s", video.ID, filepath.Base(output.OutputPath))
-			if err := s.storage.UploadFile(ctx, storageKey, output.OutputPath); err != nil {
+			if err := storage.UploadFile(ctx, s.storage, storageKey, output.OutputPath); err != nil {
 				continue
 			}
 
-			url, _ := s.storage.GetURL(ctx, storageKey)
+			outputVars := vars
+			outputVars.Resolution = output.Resolution.Name
+			outputVars.Segment = filepath.Base(output.OutputPath)
+			if err := destination.Deliver(ctx, targets, output.OutputPath, outputVars); err != nil {
+				return s.failJob(ctx, job, err)
+			}
+
+			url, _ := storage.GetURL(ctx, s.storage, storageKey)
 
 			// Get file size
 			fileInfo, _ := os.Stat(output.OutputPath)
@@ -312,11 +342,11 @@ func (s *Service) generateAndUploadThumbnails(ctx context.Context, video *models
 	// Upload thumbnails
 	for i, thumbPath := range result.Thumbnails {
 		storageKey := fmt.Sprintf("videos/%s/thumbnails/thumb_%04d.jpg", video.ID, i)
-		if err := s.storage.UploadFile(ctx, storageKey, thumbPath); err != nil {
+		if err := storage.UploadFile(ctx, s.storage, storageKey, thumbPath); err != nil {
 			continue
 		}
 
-		url, _ := s.storage.GetURL(ctx, storageKey)
+		url, _ := storage.GetURL(ctx, s.storage, storageKey)
 
 		// Create thumbnail record
 		thumbnail := &models.Thumbnail{
@@ -346,8 +376,8 @@ func (s *Service) generateAndUploadThumbnails(ctx context.Context, video *models
 
 	if err := s.ffmpeg.GenerateSpriteSheet(ctx, spriteOpts); err == nil {
 		storageKey := fmt.Sprintf("videos/%s/thumbnails/sprite.jpg", video.ID)
-		if err := s.storage.UploadFile(ctx, storageKey, spriteOpts.OutputPath); err == nil {
-			url, _ := s.storage.GetURL(ctx, storageKey)
+		if err := storage.UploadFile(ctx, s.storage, storageKey, spriteOpts.OutputPath); err == nil {
+			url, _ := storage.GetURL(ctx, s.storage, storageKey)
 
 			cols := spriteOpts.Columns
 			rows := spriteOpts.Rows
@@ -393,11 +423,11 @@ func (s *Service) extractAndUploadSubtitles(ctx context.Context, video *models.V
 	// Upload subtitle files
 	for _, sub := range result.Subtitles {
 		storageKey := fmt.Sprintf("videos/%s/subtitles/%s", video.ID, filepath.Base(sub.OutputPath))
-		if err := s.storage.UploadFile(ctx, storageKey, sub.OutputPath); err != nil {
+		if err := storage.UploadFile(ctx, s.storage, storageKey, sub.OutputPath); err != nil {
 			continue
 		}
 
-		url, _ := s.storage.GetURL(ctx, storageKey)
+		url, _ := storage.GetURL(ctx, s.storage, storageKey)
 
 		// Create subtitle record
 		subtitle := &models.Subtitle{
@@ -415,40 +445,19 @@ func (s *Service) extractAndUploadSubtitles(ctx context.Context, video *models.V
 	return nil
 }
 
-// uploadHLSFiles uploads HLS manifest and segment files to storage
-func (s *Service) uploadHLSFiles(ctx context.Context, videoID, jobID, localDir string, result *HLSResult) error {
-	// Walk through HLS directory and upload all files
-	return filepath.Walk(localDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return err
-		}
-
-		relPath, _ := filepath.Rel(localDir, path)
-		storageKey := fmt.Sprintf("videos/%s/hls/%s", videoID, relPath)
-
-		if err := s.storage.UploadFile(ctx, storageKey, path); err != nil {
+// streamFileUploader returns the upload of an HLS or DASH file to
+// videos/<id>/<format>/ and to targets. The files keep their names, which the
+// manifests reference.
+func (s *Service) streamFileUploader(videoID, format string, targets []*destination.Target, vars destination.Vars) func(ctx context.Context, path, relPath string) error {
+	vars.Format = format
+	return func(ctx context.Context, path, relPath string) error {
+		storageKey := fmt.Sprintf("videos/%s/%s/%s", videoID, format, filepath.ToSlash(relPath))
+		if err := storage.UploadFile(ctx, s.storage, storageKey, path); err != nil {
 			return err
 		}
 
-		return nil
-	})
-}
-
-// uploadDASHFiles uploads DASH manifest and segment files to storage
-func (s *Service) uploadDASHFiles(ctx context.Context, videoID, jobID, localDir string, result *DASHResult) error {
-	// Walk through DASH directory and upload all files
-	return filepath.Walk(localDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return err
-		}
-
-		relPath, _ := filepath.Rel(localDir, path)
-		storageKey := fmt.Sprintf("videos/%s/dash/%s", videoID, relPath)
-
-		if err := s.storage.UploadFile(ctx, storageKey, path); err != nil {
-			return err
-		}
-
-		return nil
-	})
+		fileVars := vars
+		fileVars.Segment = filepath.ToSlash(relPath)
+		return destination.Deliver(ctx, targets, path, fileVars)
+	}
 }
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
 	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
 )
 
@@ -59,10 +60,10 @@ func (s *Phase4Service) ProcessJobWithGPU(ctx context.Context, job *models.Job)
 	}
 	defer os.RemoveAll(tempDir)
 
-	// Download source video
-	inputPath := filepath.Join(tempDir, "input"+filepath.Ext(video.Filename))
-	if err := s.storage.DownloadFile(ctx, video.OriginalURL, inputPath); err != nil {
-		return s.failJob(ctx, job, fmt.Errorf("failed to download video: %w", err))
+	// Read the source in place, or download it when it cannot be streamed
+	inputPath, err := s.sourceInput(ctx, video, tempDir)
+	if err != nil {
+		return s.failJob(ctx, job, err)
 	}
 
 	// Determine output format
@@ -175,7 +176,7 @@ func (s *Phase4Service) ProcessJobWithGPU(ctx context.Context, job *models.Job)
 	}
 
 	// Get URL for output
-	url, err := s.storage.GetURL(ctx, storageKey)
+	url, err := storage.GetURL(ctx, s.storage, storageKey)
 	if err != nil {
 		return s.failJob(ctx, job, fmt.Errorf("failed to get output URL: %w", err))
 	}
@@ -378,7 +379,7 @@ func (s *Phase4Service) TranscodeTwoPass(ctx context.Context, opts TranscodeOpti
 func (s *Phase4Service) uploadWithOptimization(ctx context.Context, key, filePath string) error {
 	// For now, use standard upload
 	// In production, this could use parallel multipart upload for large files
-	return s.storage.UploadFile(ctx, key, filePath)
+	return storage.UploadFile(ctx, s.storage, key, filePath)
 }
 
 // GetGPUStatus returns current GPU status
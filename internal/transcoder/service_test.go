@@ -1,7 +1,15 @@
 package transcoder
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
 )
 
 func TestParseResolution(t *testing.T) {
@@ -50,3 +58,107 @@ func TestNewService(t *testing.T) {
 		t.Error("FFmpeg path should not be empty")
 	}
 }
+
+type fakeReuseStore struct {
+	priorID   string
+	priors    []*models.Output
+	createErr error
+	created   []*models.Output
+}
+
+func (r *fakeReuseStore) FindReusableJob(ctx context.Context, job *models.Job, checksum string, userID *string) (string, error) {
+	return r.priorID, nil
+}
+
+func (r *fakeReuseStore) GetOutputsByJobID(ctx context.Context, jobID string) ([]*models.Output, error) {
+	return r.priors, nil
+}
+
+func (r *fakeReuseStore) CreateOutputs(ctx context.Context, outputs []*models.Output) error {
+	if r.createErr != nil {
+		return r.createErr
+	}
+	r.created = append(r.created, outputs...)
+	return nil
+}
+
+// failingCopyStore fails the nth copy
+type failingCopyStore struct {
+	storage.Blobstore
+	failOn int
+	copies int
+}
+
+func (s *failingCopyStore) Copy(ctx context.Context, srcKey, dstKey string) error {
+	s.copies++
+	if s.copies == s.failOn {
+		return errors.New("copy failed")
+	}
+	return s.Blobstore.Copy(ctx, srcKey, dstKey)
+}
+
+func newReuseFixture(t *testing.T) (*fakeReuseStore, storage.Blobstore, *models.Job, *models.Video) {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	repo := &fakeReuseStore{priorID: "job-prior"}
+	for _, name := range []string{"720p.mp4", "480p.mp4"} {
+		key := "videos/video-prior/outputs/" + name
+		require.NoError(t, store.Put(context.Background(), key, bytes.NewReader([]byte(name)), -1, "video/mp4"))
+		repo.priors = append(repo.priors, &models.Output{ID: "out-" + name, JobID: "job-prior", VideoID: "video-prior", Path: key})
+	}
+
+	return repo, store, &models.Job{ID: "job-new"}, &models.Video{ID: "video-new", Checksum: "abc"}
+}
+
+func TestReuseJobOutputs(t *testing.T) {
+	repo, store, job, video := newReuseFixture(t)
+
+	reused, err := reuseJobOutputs(context.Background(), repo, store, job, video)
+	require.NoError(t, err)
+	assert.True(t, reused)
+	assert.Equal(t, "job-prior", *job.ReusedFromJobID)
+
+	require.Len(t, repo.created, 2)
+	for _, output := range repo.created {
+		assert.Equal(t, "job-new", output.JobID)
+		assert.Equal(t, "video-new", output.VideoID)
+		_, err := store.Stat(context.Background(), output.Path)
+		assert.NoError(t, err)
+	}
+}
+
+func TestReuseJobOutputs_CleansUpPartialCopies(t *testing.T) {
+	t.Run("Copy fails", func(t *testing.T) {
+		repo, store, job, video := newReuseFixture(t)
+		failing := &failingCopyStore{Blobstore: store, failOn: 2}
+
+		reused, err := reuseJobOutputs(context.Background(), repo, failing, job, video)
+		assert.Error(t, err)
+		assert.False(t, reused)
+		assert.Nil(t, job.ReusedFromJobID)
+		assert.Empty(t, repo.created)
+
+		objects, err := store.List(context.Background(), "videos/video-new/")
+		require.NoError(t, err)
+		assert.Empty(t, objects)
+	})
+
+	t.Run("Recording fails", func(t *testing.T) {
+		repo, store, job, video := newReuseFixture(t)
+		repo.createErr = errors.New("database unavailable")
+
+		reused, err := reuseJobOutputs(context.Background(), repo, store, job, video)
+		assert.Error(t, err)
+		assert.False(t, reused)
+
+		objects, err := store.List(context.Background(), "videos/video-new/")
+		require.NoError(t, err)
+		assert.Empty(t, objects)
+
+		// The prior job's outputs are untouched
+		objects, err = store.List(context.Background(), "videos/video-prior/")
+		require.NoError(t, err)
+		assert.Len(t, objects, 2)
+	})
+}
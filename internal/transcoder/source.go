@@ -0,0 +1,112 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// sourceInput returns what ffmpeg reads the original of a video from. When
+// the store can hand out a URL ffmpeg reads with range requests, the source
+// is read in place; otherwise it is downloaded into tempDir.
+func (s *Service) sourceInput(ctx context.Context, video *models.Video, tempDir string) (string, error) {
+	if s.cfg.StreamSources && !downloadOnly(video.Filename, s.cfg.DownloadExtensions) {
+		input, err := s.remoteInput(ctx, video)
+		if err == nil {
+			return input, nil
+		}
+		log.Printf("Downloading source of video %s instead of streaming it: %v", video.ID, err)
+	}
+
+	inputPath := filepath.Join(tempDir, "input"+filepath.Ext(video.Filename))
+	if err := storage.DownloadFile(ctx, s.storage, video.OriginalURL, inputPath); err != nil {
+		return "", fmt.Errorf("failed to download video: %w", err)
+	}
+	return inputPath, nil
+}
+
+// remoteInput presigns the original of a video. ffprobe must be able to read
+// a URL, so sources ffmpeg cannot seek over HTTP fall back to a download.
+func (s *Service) remoteInput(ctx context.Context, video *models.Video) (string, error) {
+	presigned, err := s.storage.Presign(ctx, video.OriginalURL, s.cfg.SourceURLExpiry)
+	if err != nil {
+		return "", err
+	}
+
+	input, ok := ffmpegInput(presigned)
+	if !ok {
+		return "", fmt.Errorf("store URLs cannot be read by ffmpeg")
+	}
+
+	if isRemoteInput(input) {
+		if _, err := s.ffmpeg.ProbeVideo(ctx, input); err != nil {
+			return "", fmt.Errorf("source cannot be read remotely: %w", err)
+		}
+	}
+	return input, nil
+}
+
+// ffmpegInput turns a presigned URL into an ffmpeg input: HTTP(S) URLs are
+// read as they are and file URLs as local paths
+func ffmpegInput(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return rawURL, true
+	case "file":
+		return filepath.FromSlash(u.Path), u.Path != ""
+	default:
+		return "", false
+	}
+}
+
+// downloadOnly reports whether a source with filename is always downloaded
+func downloadOnly(filename string, extensions []string) bool {
+	ext := strings.TrimPrefix(filepath.Ext(filename), ".")
+	if ext == "" {
+		return false
+	}
+	for _, e := range extensions {
+		if strings.EqualFold(strings.TrimPrefix(e, "."), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRemoteInput reports whether ffmpeg reads input over the network
+func isRemoteInput(input string) bool {
+	return strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://")
+}
+
+// inputArgs returns the ffmpeg arguments reading input. Remote inputs
+// reconnect when the connection drops during a long encode.
+func inputArgs(input string) []string {
+	if isRemoteInput(input) {
+		return []string{"-reconnect", "1", "-reconnect_delay_max", "30", "-i", input}
+	}
+	return []string{"-i", input}
+}
+
+// inputName returns the filename of input without its extension, ignoring
+// the query of a presigned URL
+func inputName(input string) string {
+	name := filepath.Base(input)
+	if isRemoteInput(input) {
+		if u, err := url.Parse(input); err == nil {
+			name = path.Base(u.Path)
+		}
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
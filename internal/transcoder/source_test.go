@@ -0,0 +1,96 @@
+package transcoder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/config"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+func TestFFmpegInput(t *testing.T) {
+	input, ok := ffmpegInput("https://minio:9000/videos/videos/v1/original/movie.mp4?X-Amz-Signature=abc")
+	assert.True(t, ok)
+	assert.Equal(t, "https://minio:9000/videos/videos/v1/original/movie.mp4?X-Amz-Signature=abc", input)
+
+	input, ok = ffmpegInput("file:///var/lib/transcode/videos/v1/original/movie.mp4")
+	assert.True(t, ok)
+	assert.Equal(t, filepath.FromSlash("/var/lib/transcode/videos/v1/original/movie.mp4"), input)
+
+	_, ok = ffmpegInput("memory:///videos/v1/original/movie.mp4")
+	assert.False(t, ok)
+}
+
+func TestDownloadOnly(t *testing.T) {
+	extensions := []string{".mxf", "avi"}
+
+	assert.True(t, downloadOnly("master.MXF", extensions))
+	assert.True(t, downloadOnly("clip.avi", extensions))
+	assert.False(t, downloadOnly("movie.mp4", extensions))
+	assert.False(t, downloadOnly("noextension", extensions))
+}
+
+func TestInputArgs(t *testing.T) {
+	url := "https://minio:9000/videos/movie.mp4?X-Amz-Credential=a/b/c&X-Amz-Signature=abc"
+
+	args := inputArgs(url)
+	assert.Equal(t, []string{"-reconnect", "1", "-reconnect_delay_max", "30", "-i", url}, args)
+	assert.Equal(t, []string{"-i", "/tmp/input.mp4"}, inputArgs("/tmp/input.mp4"))
+
+	assert.Equal(t, "movie", inputName(url))
+	assert.Equal(t, "input", inputName("/tmp/job/input.mp4"))
+}
+
+func TestSourceInput(t *testing.T) {
+	ctx := context.Background()
+	video := &models.Video{ID: "v1", Filename: "movie.mp4", OriginalURL: "videos/v1/original/movie.mp4"}
+
+	t.Run("local store is read in place", func(t *testing.T) {
+		store, err := storage.NewLocalStore(t.TempDir(), "")
+		require.NoError(t, err)
+		require.NoError(t, store.Put(ctx, video.OriginalURL, strings.NewReader("video"), 5, "video/mp4"))
+
+		s := &Service{storage: store, cfg: config.TranscoderConfig{StreamSources: true}}
+		tempDir := t.TempDir()
+
+		input, err := s.sourceInput(ctx, video, tempDir)
+		require.NoError(t, err)
+		assert.False(t, strings.HasPrefix(input, tempDir))
+
+		data, err := os.ReadFile(input)
+		require.NoError(t, err)
+		assert.Equal(t, "video", string(data))
+	})
+
+	t.Run("unreadable URLs fall back to a download", func(t *testing.T) {
+		store := storage.NewMemoryStore()
+		require.NoError(t, store.Put(ctx, video.OriginalURL, strings.NewReader("video"), 5, "video/mp4"))
+
+		s := &Service{storage: store, cfg: config.TranscoderConfig{StreamSources: true}}
+		tempDir := t.TempDir()
+
+		input, err := s.sourceInput(ctx, video, tempDir)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(tempDir, "input.mp4"), input)
+	})
+
+	t.Run("download only extensions are downloaded", func(t *testing.T) {
+		mxf := &models.Video{ID: "v2", Filename: "master.mxf", OriginalURL: "videos/v2/original/master.mxf"}
+		store, err := storage.NewLocalStore(t.TempDir(), "")
+		require.NoError(t, err)
+		require.NoError(t, store.Put(ctx, mxf.OriginalURL, strings.NewReader("video"), 5, "application/mxf"))
+
+		s := &Service{storage: store, cfg: config.TranscoderConfig{StreamSources: true, DownloadExtensions: []string{".mxf"}}}
+		tempDir := t.TempDir()
+
+		input, err := s.sourceInput(ctx, mxf, tempDir)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(tempDir, "input.mxf"), input)
+	})
+}
@@ -0,0 +1,192 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/therealutkarshpriyadarshi/transcode/internal/queue"
+)
+
+// WatchdogConfig bounds how long ffmpeg may run, so a hung process, e.g. on a
+// bad network source or a decoder deadlock, does not hold a worker forever
+type WatchdogConfig struct {
+	// StallTimeout is how long ffmpeg's output time may stop advancing before
+	// the process is killed. 0 disables stall detection.
+	StallTimeout time.Duration
+
+	// MaxRuntimeFactor is the max runtime per second of source encoded with
+	// libx264, scaled by the relative cost of other codecs. 0 disables the
+	// max runtime.
+	MaxRuntimeFactor float64
+
+	// MinMaxRuntime is the lowest max runtime, leaving short sources time to
+	// start up
+	MinMaxRuntime time.Duration
+}
+
+// codecRuntimeCost is the encoding time of codecs relative to libx264
+var codecRuntimeCost = map[string]float64{
+	"libx264":    1,
+	"h264":       1,
+	"libx265":    3,
+	"hevc":       3,
+	"h265":       3,
+	"libvpx":     2,
+	"vp8":        2,
+	"libvpx-vp9": 4,
+	"vp9":        4,
+	"libaom-av1": 10,
+	"libsvtav1":  3,
+	"av1":        3,
+	"copy":       0.2,
+}
+
+// hardwareEncoderSuffixes mark GPU encoders, much faster than software ones
+var hardwareEncoderSuffixes = []string{"_nvenc", "_qsv", "_vaapi", "_videotoolbox", "_amf"}
+
+// codecCost returns the encoding time of codec relative to libx264
+func codecCost(codec string) float64 {
+	codec = strings.ToLower(codec)
+	if codec == "" {
+		codec = "libx264"
+	}
+
+	for _, suffix := range hardwareEncoderSuffixes {
+		if strings.HasSuffix(codec, suffix) {
+			return 0.5
+		}
+	}
+	if cost, ok := codecRuntimeCost[codec]; ok {
+		return cost
+	}
+	return 1
+}
+
+// MaxRuntime returns how long encoding a source of duration seconds with codec
+// may take. It returns 0, for no limit, when the max runtime is disabled or the
+// duration is unknown.
+func (c WatchdogConfig) MaxRuntime(duration float64, codec string) time.Duration {
+	if c.MaxRuntimeFactor <= 0 || duration <= 0 {
+		return 0
+	}
+
+	runtime := time.Duration(duration * c.MaxRuntimeFactor * codecCost(codec) * float64(time.Second))
+	if runtime < c.MinMaxRuntime {
+		runtime = c.MinMaxRuntime
+	}
+	return runtime
+}
+
+// WatchdogError reports an ffmpeg run killed by the watchdog
+type WatchdogError struct {
+	Stalled bool          // no progress for Limit, otherwise ran past Limit
+	Limit   time.Duration // stall timeout or max runtime
+	Stderr  string        // ffmpeg's error output
+}
+
+func (e *WatchdogError) Error() string {
+	if e.Stalled {
+		return fmt.Sprintf("ffmpeg stalled: no progress for %v, stderr: %s", e.Limit, e.Stderr)
+	}
+	return fmt.Sprintf("ffmpeg timed out: exceeded max runtime of %v, stderr: %s", e.Limit, e.Stderr)
+}
+
+// FailureClass classifies the failure for retries and the dead letter queue
+func (e *WatchdogError) FailureClass() string {
+	if e.Stalled {
+		return queue.FailureClassStalled
+	}
+	return queue.FailureClassTimeout
+}
+
+// watchdog tracks an ffmpeg run's progress and trips once it stalls or runs
+// past its max runtime
+type watchdog struct {
+	stallTimeout time.Duration
+	maxRuntime   time.Duration
+	now          func() time.Time
+
+	mu          sync.Mutex
+	started     time.Time
+	lastAdvance time.Time
+	outTime     int64
+}
+
+func newWatchdog(stallTimeout, maxRuntime time.Duration) *watchdog {
+	return newWatchdogAt(stallTimeout, maxRuntime, time.Now)
+}
+
+// newWatchdogAt creates a watchdog reading the time from now
+func newWatchdogAt(stallTimeout, maxRuntime time.Duration, now func() time.Time) *watchdog {
+	started := now()
+	return &watchdog{
+		stallTimeout: stallTimeout,
+		maxRuntime:   maxRuntime,
+		now:          now,
+		started:      started,
+		lastAdvance:  started,
+	}
+}
+
+// observe records ffmpeg's reported output time in microseconds
+func (w *watchdog) observe(outTime int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if outTime > w.outTime {
+		w.outTime = outTime
+		w.lastAdvance = w.now()
+	}
+}
+
+// check returns the error the run is killed with, or nil while it is healthy
+func (w *watchdog) check() *WatchdogError {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.now()
+	if w.maxRuntime > 0 && now.Sub(w.started) >= w.maxRuntime {
+		return &WatchdogError{Limit: w.maxRuntime}
+	}
+	if w.stallTimeout > 0 && now.Sub(w.lastAdvance) >= w.stallTimeout {
+		return &WatchdogError{Stalled: true, Limit: w.stallTimeout}
+	}
+	return nil
+}
+
+// enabled reports whether the watchdog can trip at all
+func (w *watchdog) enabled() bool {
+	return w.stallTimeout > 0 || w.maxRuntime > 0
+}
+
+// interval returns how often the watchdog is checked
+func (w *watchdog) interval() time.Duration {
+	interval := time.Second
+	for _, limit := range []time.Duration{w.stallTimeout, w.maxRuntime} {
+		if limit > 0 && limit/4 < interval {
+			interval = limit / 4
+		}
+	}
+	return interval
+}
+
+// run checks the watchdog until ctx is done, calling kill once it trips
+func (w *watchdog) run(ctx context.Context, kill func(*WatchdogError)) {
+	ticker := time.NewTicker(w.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.check(); err != nil {
+				kill(err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/queue"
+)
+
+func TestWatchdogMaxRuntime(t *testing.T) {
+	cfg := WatchdogConfig{MaxRuntimeFactor: 2, MinMaxRuntime: time.Minute}
+
+	assert.Equal(t, 20*time.Minute, cfg.MaxRuntime(600, "libx264"))
+	assert.Equal(t, 60*time.Minute, cfg.MaxRuntime(600, "libx265"))
+	assert.Equal(t, 10*time.Minute, cfg.MaxRuntime(600, "h264_nvenc"))
+	assert.Equal(t, 20*time.Minute, cfg.MaxRuntime(600, ""))
+
+	// Short sources get the minimum; unknown durations and a zero factor no limit
+	assert.Equal(t, time.Minute, cfg.MaxRuntime(5, "libx264"))
+	assert.Equal(t, time.Duration(0), cfg.MaxRuntime(0, "libx264"))
+	assert.Equal(t, time.Duration(0), WatchdogConfig{}.MaxRuntime(600, "libx264"))
+}
+
+func TestWatchdogDetectsStall(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	dog := newWatchdogAt(time.Minute, 0, func() time.Time { return now })
+
+	now = now.Add(50 * time.Second)
+	dog.observe(1000000)
+	assert.Nil(t, dog.check())
+
+	// Repeated progress lines with the same output time are not progress
+	now = now.Add(50 * time.Second)
+	dog.observe(1000000)
+	assert.Nil(t, dog.check())
+
+	now = now.Add(10 * time.Second)
+	err := dog.check()
+	require.NotNil(t, err)
+	assert.True(t, err.Stalled)
+	assert.Contains(t, err.Error(), "ffmpeg stalled")
+}
+
+func TestWatchdogEnforcesMaxRuntime(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	dog := newWatchdogAt(time.Minute, 5*time.Minute, func() time.Time { return now })
+
+	for i := int64(1); i <= 10; i++ {
+		now = now.Add(30 * time.Second)
+		dog.observe(i * 1000000)
+	}
+
+	err := dog.check()
+	require.NotNil(t, err)
+	assert.False(t, err.Stalled)
+	assert.Equal(t, 5*time.Minute, err.Limit)
+	assert.Contains(t, err.Error(), "timed out")
+}
+
+func TestWatchdogRunKills(t *testing.T) {
+	dog := newWatchdog(20*time.Millisecond, 0)
+	assert.Equal(t, 5*time.Millisecond, dog.interval())
+
+	killed := make(chan *WatchdogError, 1)
+	go dog.run(context.Background(), func(err *WatchdogError) { killed <- err })
+
+	select {
+	case err := <-killed:
+		assert.True(t, err.Stalled)
+	case <-time.After(2 * time.Second):
+		t.Fatal("watchdog did not trip")
+	}
+
+	assert.False(t, newWatchdog(0, 0).enabled())
+}
+
+func TestWatchdogErrorFailureClass(t *testing.T) {
+	stalled := fmt.Errorf("transcoding failed: %w", &WatchdogError{Stalled: true, Limit: 2 * time.Minute})
+	assert.Equal(t, queue.FailureClassStalled, queue.ErrorClass(stalled))
+
+	timedOut := fmt.Errorf("transcoding failed: %w", &WatchdogError{Limit: 10 * time.Minute})
+	assert.Equal(t, queue.FailureClassTimeout, queue.ErrorClass(timedOut))
+}
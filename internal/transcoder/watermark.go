@@ -55,9 +55,7 @@ func (f *FFmpeg) ApplyWatermark(ctx context.Context, opts WatermarkOptions) erro
 	}
 
 	// Build FFmpeg command
-	args := []string{
-		"-i", opts.InputPath,
-	}
+	args := inputArgs(opts.InputPath)
 
 	// Add watermark image as second input if using image watermark
 	if opts.WatermarkPath != "" {
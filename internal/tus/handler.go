@@ -0,0 +1,304 @@
+package tus
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/middleware"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+const (
+	// offsetContentType is the content type of PATCH requests
+	offsetContentType = "application/offset+octet-stream"
+
+	// statusChecksumMismatch is returned when a PATCH fails its checksum
+	statusChecksumMismatch = 460
+
+	// VideoIDHeader names the video an upload becomes once completed
+	VideoIDHeader = "X-Video-ID"
+)
+
+// Register mounts the tus endpoints on group, e.g. /api/v1/tus
+func (s *Server) Register(group *gin.RouterGroup, handlers ...gin.HandlerFunc) {
+	group.Use(resumable)
+
+	group.OPTIONS("", s.options)
+	group.OPTIONS("/:id", s.options)
+	group.POST("", append(handlers, s.create)...)
+	group.HEAD("/:id", s.head)
+	group.PATCH("/:id", s.patch)
+	group.DELETE("/:id", s.terminate)
+}
+
+// resumable sets the protocol version on responses and rejects requests for
+// other versions
+func resumable(c *gin.Context) {
+	c.Header("Tus-Resumable", Version)
+
+	if c.Request.Method != http.MethodOptions && c.GetHeader("Tus-Resumable") != Version {
+		c.Header("Tus-Version", Version)
+		c.AbortWithStatus(http.StatusPreconditionFailed)
+		return
+	}
+
+	c.Next()
+}
+
+// options describes the server's capabilities
+func (s *Server) options(c *gin.Context) {
+	c.Header("Tus-Version", Version)
+	c.Header("Tus-Extension", Extensions)
+	c.Header("Tus-Checksum-Algorithm", ChecksumAlgorithms)
+	if s.cfg.MaxSize > 0 {
+		c.Header("Tus-Max-Size", strconv.FormatInt(s.cfg.MaxSize, 10))
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// create starts an upload of Upload-Length bytes
+func (s *Server) create(c *gin.Context) {
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or missing Upload-Length header"})
+		return
+	}
+	if s.cfg.MaxSize > 0 && length > s.cfg.MaxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Upload exceeds max size of %d bytes", s.cfg.MaxSize)})
+		return
+	}
+
+	metadata, err := parseMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	videoID := uuid.New().String()
+	upload := &models.TusUpload{
+		ID:         uuid.New().String(),
+		Length:     length,
+		Metadata:   metadata,
+		Status:     models.TusUploadStatusActive,
+		VideoID:    videoID,
+		StorageKey: originalKey(videoID, metadata["filename"]),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		ExpiresAt:  now.Add(s.cfg.Expiration),
+	}
+	if userID, exists := middleware.GetUserID(c); exists {
+		upload.UserID = &userID
+	}
+
+	if err := s.store.CreateTusUpload(c.Request.Context(), upload); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload"})
+		return
+	}
+
+	// Empty uploads are complete right away
+	if length == 0 {
+		if err := s.finish(c.Request.Context(), upload); err != nil {
+			log.Printf("Failed to complete tus upload %s: %v", upload.ID, err)
+		}
+	}
+
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.ID)
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Header(VideoIDHeader, upload.VideoID)
+	c.Status(http.StatusCreated)
+}
+
+// head reports how much of an upload was received
+func (s *Server) head(c *gin.Context) {
+	upload, ok := s.loadUpload(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if len(upload.Metadata) > 0 {
+		c.Header("Upload-Metadata", encodeMetadata(upload.Metadata))
+	}
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Header(VideoIDHeader, upload.VideoID)
+	c.Status(http.StatusOK)
+}
+
+// patch appends the request body to an upload at Upload-Offset, assembling
+// the upload once all of it was received
+func (s *Server) patch(c *gin.Context) {
+	if c.ContentType() != offsetContentType {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be " + offsetContentType})
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or missing Upload-Offset header"})
+		return
+	}
+
+	sum, err := parseChecksum(c.GetHeader("Upload-Checksum"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	upload, ok := s.loadUpload(c)
+	if !ok {
+		return
+	}
+	if offset != upload.Offset {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Upload is at offset %d", upload.Offset)})
+		return
+	}
+
+	remaining := upload.Length - upload.Offset
+	if c.Request.ContentLength > remaining {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Only %d bytes remain", remaining)})
+		return
+	}
+
+	ctx := c.Request.Context()
+	chunk, err := s.writeChunk(ctx, upload, c.Request.Body, c.Request.ContentLength, remaining, sum)
+	if err == errChecksumMismatch {
+		c.JSON(statusChecksumMismatch, gin.H{"error": "Checksum mismatch"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to write tus upload %s: %v", upload.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write upload data"})
+		return
+	}
+
+	if chunk != nil {
+		appended, err := s.store.AppendTusChunk(ctx, upload.ID, *chunk)
+		if err != nil || !appended {
+			s.deleteChunks(context.Background(), []models.TusChunk{*chunk})
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record upload data"})
+			return
+		}
+		if !appended {
+			c.JSON(http.StatusConflict, gin.H{"error": "Upload offset changed concurrently"})
+			return
+		}
+
+		upload.Chunks = append(upload.Chunks, *chunk)
+		upload.Offset += chunk.Size
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+
+	if upload.Received() && upload.Status == models.TusUploadStatusActive {
+		if err := s.finish(ctx, upload); err != nil {
+			// The cleanup loop retries, so the client need not resend anything
+			log.Printf("Failed to complete tus upload %s: %v", upload.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete upload"})
+			return
+		}
+		c.Header(VideoIDHeader, upload.VideoID)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// errChecksumMismatch reports data that failed its Upload-Checksum
+var errChecksumMismatch = fmt.Errorf("checksum mismatch")
+
+// writeChunk stores up to remaining bytes of body as a chunk object. It returns
+// nil for an empty body, and deletes the chunk again if it fails its checksum.
+func (s *Server) writeChunk(ctx context.Context, upload *models.TusUpload, body io.Reader, size, remaining int64, sum *checksum) (*models.TusChunk, error) {
+	if size == 0 {
+		return nil, nil
+	}
+
+	counter := &countingReader{reader: io.LimitReader(body, remaining)}
+	var reader io.Reader = counter
+	if sum != nil {
+		reader = io.TeeReader(counter, sum.hash)
+	}
+
+	key := chunkKey(upload.ID, upload.Offset, uuid.New().String()[:8])
+	if err := s.blobs.Put(ctx, key, reader, size, offsetContentType); err != nil {
+		return nil, err
+	}
+
+	chunk := &models.TusChunk{Offset: upload.Offset, Size: counter.n, Key: key}
+	if counter.n == 0 || (sum != nil && !sum.matches()) {
+		s.deleteChunks(ctx, []models.TusChunk{*chunk})
+		if counter.n == 0 {
+			return nil, nil
+		}
+		return nil, errChecksumMismatch
+	}
+
+	return chunk, nil
+}
+
+// terminate deletes an upload and its data. Completed uploads keep the video
+// they became.
+func (s *Server) terminate(c *gin.Context) {
+	upload, ok := s.loadUpload(c)
+	if !ok {
+		return
+	}
+
+	s.deleteChunks(c.Request.Context(), upload.Chunks)
+	if err := s.store.DeleteTusUpload(c.Request.Context(), upload.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete upload"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// loadUpload loads the upload named in the path, responding 404 for unknown
+// uploads and those of other users, and 410 for expired ones
+func (s *Server) loadUpload(c *gin.Context) (*models.TusUpload, bool) {
+	upload, err := s.store.GetTusUpload(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return nil, false
+	}
+
+	if upload.UserID != nil {
+		if userID, exists := middleware.GetUserID(c); !exists || userID != *upload.UserID {
+			c.AbortWithStatus(http.StatusNotFound)
+			return nil, false
+		}
+	}
+
+	if time.Now().After(upload.ExpiresAt) {
+		c.AbortWithStatus(http.StatusGone)
+		return nil, false
+	}
+
+	return upload, true
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
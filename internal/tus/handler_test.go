@@ -0,0 +1,290 @@
+package tus
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// fakeStore keeps uploads in memory like the tus_uploads table
+type fakeStore struct {
+	mu      sync.Mutex
+	uploads map[string]*models.TusUpload
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{uploads: make(map[string]*models.TusUpload)}
+}
+
+func (s *fakeStore) CreateTusUpload(ctx context.Context, upload *models.TusUpload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *upload
+	s.uploads[upload.ID] = &copied
+	return nil
+}
+
+func (s *fakeStore) GetTusUpload(ctx context.Context, id string) (*models.TusUpload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upload, ok := s.uploads[id]
+	if !ok {
+		return nil, fmt.Errorf("tus upload not found")
+	}
+	copied := *upload
+	copied.Chunks = append([]models.TusChunk(nil), upload.Chunks...)
+	return &copied, nil
+}
+
+func (s *fakeStore) AppendTusChunk(ctx context.Context, id string, chunk models.TusChunk) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upload, ok := s.uploads[id]
+	if !ok || upload.Offset != chunk.Offset || upload.Offset+chunk.Size > upload.Length {
+		return false, nil
+	}
+	upload.Offset += chunk.Size
+	upload.Chunks = append(upload.Chunks, chunk)
+	return true, nil
+}
+
+func (s *fakeStore) CompleteTusUpload(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.uploads[id].Status = models.TusUploadStatusCompleted
+	s.uploads[id].Chunks = nil
+	return nil
+}
+
+func (s *fakeStore) DeleteTusUpload(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.uploads, id)
+	return nil
+}
+
+func (s *fakeStore) ListExpiredTusUploads(ctx context.Context, limit int) ([]*models.TusUpload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired []*models.TusUpload
+	for _, upload := range s.uploads {
+		if upload.ExpiresAt.Before(time.Now()) {
+			expired = append(expired, upload)
+		}
+	}
+	return expired, nil
+}
+
+func (s *fakeStore) ListStalledTusUploads(ctx context.Context, olderThan time.Duration, limit int) ([]*models.TusUpload, error) {
+	return nil, nil
+}
+
+type tusTest struct {
+	store     *fakeStore
+	blobs     *storage.MemoryStore
+	router    *gin.Engine
+	completed []*models.TusUpload
+}
+
+func newTusTest(t *testing.T, cfg Config) *tusTest {
+	gin.SetMode(gin.TestMode)
+
+	tt := &tusTest{store: newFakeStore(), blobs: storage.NewMemoryStore()}
+	server := NewServer(tt.store, tt.blobs, cfg, func(ctx context.Context, upload *models.TusUpload) error {
+		tt.completed = append(tt.completed, upload)
+		return nil
+	})
+
+	tt.router = gin.New()
+	server.Register(tt.router.Group("/api/v1/tus"))
+	return tt
+}
+
+func (tt *tusTest) do(method, target string, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Tus-Resumable", Version)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	w := httptest.NewRecorder()
+	tt.router.ServeHTTP(w, req)
+	return w
+}
+
+func (tt *tusTest) create(t *testing.T, length int, metadata string) string {
+	w := tt.do("POST", "/api/v1/tus", "", map[string]string{
+		"Upload-Length":   fmt.Sprint(length),
+		"Upload-Metadata": metadata,
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Upload-Expires"))
+	return w.Header().Get("Location")
+}
+
+func (tt *tusTest) patch(location string, offset int, data string, headers map[string]string) *httptest.ResponseRecorder {
+	all := map[string]string{
+		"Content-Type":  offsetContentType,
+		"Upload-Offset": fmt.Sprint(offset),
+	}
+	for key, value := range headers {
+		all[key] = value
+	}
+	return tt.do("PATCH", location, data, all)
+}
+
+func TestTusOptions(t *testing.T) {
+	tt := newTusTest(t, Config{MaxSize: 1000})
+
+	req := httptest.NewRequest("OPTIONS", "/api/v1/tus", nil)
+	w := httptest.NewRecorder()
+	tt.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, Version, w.Header().Get("Tus-Version"))
+	assert.Equal(t, Extensions, w.Header().Get("Tus-Extension"))
+	assert.Equal(t, "1000", w.Header().Get("Tus-Max-Size"))
+}
+
+func TestTusRejectsOtherVersions(t *testing.T) {
+	tt := newTusTest(t, Config{})
+
+	w := tt.do("POST", "/api/v1/tus", "", map[string]string{"Tus-Resumable": "0.2.2", "Upload-Length": "10"})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, Version, w.Header().Get("Tus-Version"))
+}
+
+func TestTusUpload(t *testing.T) {
+	tt := newTusTest(t, Config{})
+
+	filename := base64.StdEncoding.EncodeToString([]byte("movie.mp4"))
+	location := tt.create(t, 10, "filename "+filename+",private")
+	assert.True(t, strings.HasPrefix(location, "/api/v1/tus/"))
+
+	w := tt.patch(location, 0, "01234", nil)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Upload-Offset"))
+
+	// A resumed client asks where to continue
+	w = tt.do("HEAD", location, "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Upload-Offset"))
+	assert.Equal(t, "10", w.Header().Get("Upload-Length"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Contains(t, w.Header().Get("Upload-Metadata"), "filename "+filename)
+
+	// Resending data at a stale offset conflicts
+	assert.Equal(t, http.StatusConflict, tt.patch(location, 0, "01234", nil).Code)
+
+	w = tt.patch(location, 5, "56789", nil)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Upload-Offset"))
+
+	require.Len(t, tt.completed, 1)
+	upload := tt.completed[0]
+	assert.Equal(t, "movie.mp4", upload.Metadata["filename"])
+	assert.Equal(t, w.Header().Get(VideoIDHeader), upload.VideoID)
+	assert.Equal(t, fmt.Sprintf("videos/%s/original/movie.mp4", upload.VideoID), upload.StorageKey)
+	sum := sha256.Sum256([]byte("0123456789"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), upload.Checksum)
+
+	// The chunks were assembled and removed
+	object, err := tt.blobs.Get(context.Background(), upload.StorageKey)
+	require.NoError(t, err)
+	data, _ := io.ReadAll(object)
+	assert.Equal(t, "0123456789", string(data))
+
+	chunks, err := tt.blobs.List(context.Background(), "tus/")
+	require.NoError(t, err)
+	assert.Empty(t, chunks)
+}
+
+func TestTusChecksum(t *testing.T) {
+	tt := newTusTest(t, Config{})
+	location := tt.create(t, 5, "")
+
+	wrong := base64.StdEncoding.EncodeToString(sha1.New().Sum(nil))
+	w := tt.patch(location, 0, "hello", map[string]string{"Upload-Checksum": "sha1 " + wrong})
+	assert.Equal(t, statusChecksumMismatch, w.Code)
+
+	w = tt.patch(location, 0, "hello", map[string]string{"Upload-Checksum": "crc64 AAAA"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	sum := sha1.Sum([]byte("hello"))
+	w = tt.patch(location, 0, "hello", map[string]string{"Upload-Checksum": "sha1 " + base64.StdEncoding.EncodeToString(sum[:])})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Len(t, tt.completed, 1)
+}
+
+func TestTusRejectsInvalidRequests(t *testing.T) {
+	tt := newTusTest(t, Config{MaxSize: 100})
+
+	w := tt.do("POST", "/api/v1/tus", "", map[string]string{"Upload-Length": "101"})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = tt.do("POST", "/api/v1/tus", "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	location := tt.create(t, 5, "")
+	w = tt.do("PATCH", location, "hello", map[string]string{"Upload-Offset": "0", "Content-Type": "text/plain"})
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	w = tt.patch(location, 0, "hello world", nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	assert.Equal(t, http.StatusNotFound, tt.do("HEAD", "/api/v1/tus/missing", "", nil).Code)
+}
+
+func TestTusTermination(t *testing.T) {
+	tt := newTusTest(t, Config{})
+	location := tt.create(t, 10, "")
+	require.Equal(t, http.StatusNoContent, tt.patch(location, 0, "01234", nil).Code)
+
+	assert.Equal(t, http.StatusNoContent, tt.do("DELETE", location, "", nil).Code)
+	assert.Equal(t, http.StatusNotFound, tt.do("HEAD", location, "", nil).Code)
+
+	chunks, err := tt.blobs.List(context.Background(), "tus/")
+	require.NoError(t, err)
+	assert.Empty(t, chunks)
+}
+
+func TestTusExpiration(t *testing.T) {
+	tt := newTusTest(t, Config{Expiration: time.Hour})
+	location := tt.create(t, 10, "")
+	require.Equal(t, http.StatusNoContent, tt.patch(location, 0, "01234", nil).Code)
+
+	id := location[strings.LastIndex(location, "/")+1:]
+	tt.store.uploads[id].ExpiresAt = time.Now().Add(-time.Minute)
+	assert.Equal(t, http.StatusGone, tt.do("HEAD", location, "", nil).Code)
+
+	server := NewServer(tt.store, tt.blobs, Config{}, nil)
+	server.cleanup(context.Background())
+
+	_, err := tt.store.GetTusUpload(context.Background(), id)
+	assert.Error(t, err)
+	chunks, err := tt.blobs.List(context.Background(), "tus/")
+	require.NoError(t, err)
+	assert.Empty(t, chunks)
+}
@@ -0,0 +1,326 @@
+// Package tus implements a tus 1.0 resumable upload server
+// (https://tus.io/protocols/resumable-upload) storing upload state in the
+// database and upload data in object storage
+package tus
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+const (
+	// Version is the protocol version spoken by the server
+	Version = "1.0.0"
+
+	// Extensions are the protocol extensions the server supports
+	Extensions = "creation,expiration,checksum,termination"
+
+	// ChecksumAlgorithms are the algorithms of the checksum extension
+	ChecksumAlgorithms = "sha1,md5,sha256"
+
+	// DefaultExpiration is how long an upload may take when not configured
+	DefaultExpiration = 24 * time.Hour
+
+	// stalledAfter is how long a fully received upload may stay unassembled
+	// before the cleanup loop assembles it
+	stalledAfter = 10 * time.Minute
+)
+
+// Store persists tus uploads
+type Store interface {
+	CreateTusUpload(ctx context.Context, upload *models.TusUpload) error
+	GetTusUpload(ctx context.Context, id string) (*models.TusUpload, error)
+	AppendTusChunk(ctx context.Context, id string, chunk models.TusChunk) (bool, error)
+	CompleteTusUpload(ctx context.Context, id string) error
+	DeleteTusUpload(ctx context.Context, id string) error
+	ListExpiredTusUploads(ctx context.Context, limit int) ([]*models.TusUpload, error)
+	ListStalledTusUploads(ctx context.Context, olderThan time.Duration, limit int) ([]*models.TusUpload, error)
+}
+
+// CompleteFunc is called once an upload is assembled under its storage key,
+// e.g. to create its video. It may be called again for the same upload if
+// completing it failed, so it must be idempotent.
+type CompleteFunc func(ctx context.Context, upload *models.TusUpload) error
+
+// Config configures the tus server
+type Config struct {
+	MaxSize    int64         // largest accepted upload, 0 for no limit
+	Expiration time.Duration // how long an upload may take
+}
+
+// Server serves tus uploads
+type Server struct {
+	store      Store
+	blobs      storage.Blobstore
+	cfg        Config
+	onComplete CompleteFunc
+}
+
+// NewServer creates a tus server storing uploads in blobs
+func NewServer(store Store, blobs storage.Blobstore, cfg Config, onComplete CompleteFunc) *Server {
+	if cfg.Expiration <= 0 {
+		cfg.Expiration = DefaultExpiration
+	}
+
+	return &Server{
+		store:      store,
+		blobs:      blobs,
+		cfg:        cfg,
+		onComplete: onComplete,
+	}
+}
+
+// chunkKey returns a unique storage key for data received by a PATCH at offset
+func chunkKey(uploadID string, offset int64, nonce string) string {
+	return fmt.Sprintf("tus/%s/%020d-%s", uploadID, offset, nonce)
+}
+
+// originalKey returns where an upload's video original is stored
+func originalKey(videoID, filename string) string {
+	if filename == "" {
+		filename = "upload"
+	}
+	return fmt.Sprintf("videos/%s/original/%s", videoID, path.Base(filename))
+}
+
+// finish assembles a fully received upload's chunks under its storage key,
+// calls the completion callback and marks the upload completed
+func (s *Server) finish(ctx context.Context, upload *models.TusUpload) error {
+	var offset int64
+	for _, chunk := range upload.Chunks {
+		if chunk.Offset != offset {
+			return fmt.Errorf("chunk at offset %d, expected %d", chunk.Offset, offset)
+		}
+		offset += chunk.Size
+	}
+	if offset != upload.Length {
+		return fmt.Errorf("received %d of %d bytes", offset, upload.Length)
+	}
+
+	reader := &chunkReader{ctx: ctx, blobs: s.blobs, chunks: upload.Chunks}
+	defer reader.Close()
+
+	contentType := upload.Metadata["filetype"]
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	// The checksum is computed while assembling so the upload is read once
+	hash := sha256.New()
+	if err := s.blobs.Put(ctx, upload.StorageKey, io.TeeReader(reader, hash), upload.Length, contentType); err != nil {
+		return fmt.Errorf("failed to assemble upload: %w", err)
+	}
+	upload.Checksum = hex.EncodeToString(hash.Sum(nil))
+
+	if s.onComplete != nil {
+		if err := s.onComplete(ctx, upload); err != nil {
+			return err
+		}
+	}
+
+	if err := s.store.CompleteTusUpload(ctx, upload.ID); err != nil {
+		return err
+	}
+
+	s.deleteChunks(ctx, upload.Chunks)
+	log.Printf("Completed tus upload %s (%s)", upload.ID, upload.StorageKey)
+
+	return nil
+}
+
+// deleteChunks removes chunk objects, logging failures
+func (s *Server) deleteChunks(ctx context.Context, chunks []models.TusChunk) {
+	for _, chunk := range chunks {
+		if err := s.blobs.Delete(ctx, chunk.Key); err != nil {
+			log.Printf("Failed to delete tus chunk %s: %v", chunk.Key, err)
+		}
+	}
+}
+
+// Cleanup deletes expired uploads and assembles stalled ones every interval
+// until ctx is done
+func (s *Server) Cleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.cleanup(ctx)
+		}
+	}
+}
+
+func (s *Server) cleanup(ctx context.Context) {
+	stalled, err := s.store.ListStalledTusUploads(ctx, stalledAfter, 100)
+	if err != nil {
+		log.Printf("Failed to list stalled tus uploads: %v", err)
+	}
+	for _, upload := range stalled {
+		if err := s.finish(ctx, upload); err != nil {
+			log.Printf("Failed to complete tus upload %s: %v", upload.ID, err)
+		}
+	}
+
+	expired, err := s.store.ListExpiredTusUploads(ctx, 100)
+	if err != nil {
+		log.Printf("Failed to list expired tus uploads: %v", err)
+		return
+	}
+	for _, upload := range expired {
+		s.deleteChunks(ctx, upload.Chunks)
+		if err := s.store.DeleteTusUpload(ctx, upload.ID); err != nil {
+			log.Printf("Failed to delete expired tus upload %s: %v", upload.ID, err)
+			continue
+		}
+		log.Printf("Cleaned up expired tus upload %s", upload.ID)
+	}
+}
+
+// chunkReader reads an upload's chunks in order, opening each when reached
+type chunkReader struct {
+	ctx     context.Context
+	blobs   storage.Blobstore
+	chunks  []models.TusChunk
+	current io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.EOF
+			}
+
+			chunk, err := r.blobs.Get(r.ctx, r.chunks[0].Key)
+			if err != nil {
+				return 0, err
+			}
+			r.current = chunk
+			r.chunks = r.chunks[1:]
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
+
+// parseMetadata decodes an Upload-Metadata header: comma separated pairs of a
+// key and an optional base64 encoded value
+func parseMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		switch len(fields) {
+		case 1:
+			metadata[fields[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid metadata value of %s", fields[0])
+			}
+			metadata[fields[0]] = string(value)
+		default:
+			return nil, fmt.Errorf("invalid metadata pair: %q", pair)
+		}
+	}
+
+	return metadata, nil
+}
+
+// encodeMetadata encodes metadata as an Upload-Metadata header
+func encodeMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		if metadata[key] == "" {
+			pairs[i] = key
+			continue
+		}
+		pairs[i] = key + " " + base64.StdEncoding.EncodeToString([]byte(metadata[key]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// checksum is an Upload-Checksum header: an algorithm and the expected digest
+type checksum struct {
+	hash     hash.Hash
+	expected []byte
+}
+
+// parseChecksum parses an Upload-Checksum header, returning nil when absent
+func parseChecksum(header string) (*checksum, error) {
+	if header == "" {
+		return nil, nil
+	}
+
+	fields := strings.Fields(header)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("invalid Upload-Checksum header")
+	}
+
+	var h hash.Hash
+	switch fields[0] {
+	case "sha1":
+		h = sha1.New()
+	case "md5":
+		h = md5.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm: %s", fields[0])
+	}
+
+	expected, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid Upload-Checksum header")
+	}
+
+	return &checksum{hash: h, expected: expected}, nil
+}
+
+// matches reports whether the data written to the checksum's hash matches
+func (c *checksum) matches() bool {
+	return bytes.Equal(c.hash.Sum(nil), c.expected)
+}
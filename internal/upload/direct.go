@@ -0,0 +1,237 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+const (
+	// MinDirectPartSize is the smallest part object storage accepts, except
+	// for the last part
+	MinDirectPartSize = 5 * 1024 * 1024
+
+	// MaxDirectParts is the most parts object storage accepts per upload
+	MaxDirectParts = 10000
+
+	// DefaultPartURLExpiry is how long presigned part URLs stay valid
+	DefaultPartURLExpiry = time.Hour
+)
+
+// PartURL is a presigned URL a client uploads one part to with a PUT
+type PartURL struct {
+	PartNumber int       `json:"part_number"`
+	URL        string    `json:"url"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// SetDirectUploads enables direct uploads, whose parts clients upload straight
+// to storage through presigned URLs instead of through the API
+func (s *MultipartUploadService) SetDirectUploads(presigner storage.MultipartPresigner) {
+	s.presigner = presigner
+}
+
+// DirectUploadsEnabled reports whether direct uploads can be initiated
+func (s *MultipartUploadService) DirectUploadsEnabled() bool {
+	return s.presigner != nil
+}
+
+// InitiateDirectUpload starts a multipart upload in storage for a new video,
+// returning presigned URLs for all of its parts
+func (s *MultipartUploadService) InitiateDirectUpload(ctx context.Context, filename string, totalSize int64, contentType string) (*models.MultipartUpload, []PartURL, error) {
+	if s.presigner == nil {
+		return nil, nil, fmt.Errorf("direct uploads are not supported by the storage driver")
+	}
+	if totalSize <= 0 {
+		return nil, nil, fmt.Errorf("total size must be positive")
+	}
+
+	partSize := directPartSize(s.partSize, totalSize)
+	videoID := uuid.New().String()
+	key := originalKey(videoID, filename)
+
+	storageUploadID, err := s.presigner.CreateMultipartUpload(ctx, key, contentType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	upload := &models.MultipartUpload{
+		ID:              uuid.New().String(),
+		Mode:            UploadModeDirect,
+		Filename:        filename,
+		TotalSize:       totalSize,
+		PartSize:        partSize,
+		TotalParts:      int((totalSize + partSize - 1) / partSize),
+		Parts:           make(map[int]*models.UploadPart),
+		Status:          MultipartUploadStatusActive,
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(DefaultUploadExpiration),
+		VideoID:         videoID,
+		StorageKey:      key,
+		StorageUploadID: storageUploadID,
+	}
+
+	urls := make([]PartURL, 0, upload.TotalParts)
+	for partNumber := 1; partNumber <= upload.TotalParts; partNumber++ {
+		url, err := s.presignPart(ctx, upload, partNumber)
+		if err != nil {
+			s.abortStorageUpload(upload)
+			return nil, nil, err
+		}
+		urls = append(urls, *url)
+	}
+
+	if err := s.store.CreateMultipartUpload(ctx, upload); err != nil {
+		s.abortStorageUpload(upload)
+		return nil, nil, err
+	}
+
+	log.Printf("Initiated direct upload %s for %s (%d bytes, %d parts)",
+		upload.ID, filename, totalSize, upload.TotalParts)
+
+	return upload, urls, nil
+}
+
+// PresignPart returns a fresh URL for a part of a direct upload, for clients
+// whose URL expired
+func (s *MultipartUploadService) PresignPart(ctx context.Context, uploadID string, partNumber int) (*PartURL, error) {
+	upload, err := s.store.GetMultipartUpload(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	if upload.Mode != UploadModeDirect {
+		return nil, fmt.Errorf("upload is not a direct upload")
+	}
+	if upload.Status != MultipartUploadStatusActive {
+		return nil, fmt.Errorf("upload is not active")
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		return nil, fmt.Errorf("upload has expired")
+	}
+	if partNumber < 1 || partNumber > upload.TotalParts {
+		return nil, fmt.Errorf("invalid part number: %d", partNumber)
+	}
+
+	return s.presignPart(ctx, upload, partNumber)
+}
+
+// presignPart presigns the upload of a part, expiring with the upload at the
+// latest
+func (s *MultipartUploadService) presignPart(ctx context.Context, upload *models.MultipartUpload, partNumber int) (*PartURL, error) {
+	expiresAt := time.Now().Add(DefaultPartURLExpiry)
+	if upload.ExpiresAt.Before(expiresAt) {
+		expiresAt = upload.ExpiresAt
+	}
+
+	url, err := s.presigner.PresignUploadPart(ctx, upload.StorageKey, upload.StorageUploadID, partNumber, time.Until(expiresAt))
+	if err != nil {
+		return nil, err
+	}
+
+	return &PartURL{PartNumber: partNumber, URL: url, ExpiresAt: expiresAt}, nil
+}
+
+// CompleteDirectUpload checks that storage holds every part of a direct
+// upload and assembles them into the video's original
+func (s *MultipartUploadService) CompleteDirectUpload(ctx context.Context, uploadID string) (*models.MultipartUpload, error) {
+	upload, err := s.store.GetMultipartUpload(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	if upload.Mode != UploadModeDirect {
+		return nil, fmt.Errorf("upload is not a direct upload")
+	}
+	if upload.Status != MultipartUploadStatusActive {
+		return nil, fmt.Errorf("upload is not active")
+	}
+
+	// Ask storage which parts arrived rather than trusting the client
+	uploaded, err := s.presigner.ListUploadedParts(ctx, upload.StorageKey, upload.StorageUploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	byNumber := make(map[int]storage.UploadedPart, len(uploaded))
+	for _, part := range uploaded {
+		byNumber[part.PartNumber] = part
+	}
+
+	parts := make([]storage.UploadedPart, 0, upload.TotalParts)
+	var size int64
+	for i := 1; i <= upload.TotalParts; i++ {
+		part, ok := byNumber[i]
+		if !ok {
+			return nil, fmt.Errorf("missing part %d", i)
+		}
+		parts = append(parts, part)
+		size += part.Size
+	}
+	if size != upload.TotalSize {
+		return nil, fmt.Errorf("uploaded %d of %d bytes", size, upload.TotalSize)
+	}
+
+	if err := s.presigner.CompleteMultipartUpload(ctx, upload.StorageKey, upload.StorageUploadID, parts); err != nil {
+		return nil, err
+	}
+
+	completed, err := s.store.CompleteMultipartUpload(ctx, uploadID, "")
+	if err != nil {
+		return nil, err
+	}
+	if !completed {
+		return nil, fmt.Errorf("upload is not active")
+	}
+
+	now := time.Now()
+	for _, part := range parts {
+		upload.Parts[part.PartNumber] = &models.UploadPart{
+			PartNumber: part.PartNumber,
+			Size:       part.Size,
+			ETag:       part.ETag,
+			Uploaded:   true,
+			UploadedAt: now,
+		}
+	}
+	upload.Status = MultipartUploadStatusCompleted
+	upload.CompletedAt = &now
+
+	log.Printf("Completed direct upload %s (%s)", uploadID, upload.StorageKey)
+
+	return upload, nil
+}
+
+// abortStorageUpload discards the parts storage holds for a direct upload
+func (s *MultipartUploadService) abortStorageUpload(upload *models.MultipartUpload) {
+	if upload.Mode != UploadModeDirect || s.presigner == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := s.presigner.AbortMultipartUpload(ctx, upload.StorageKey, upload.StorageUploadID); err != nil {
+		log.Printf("Failed to abort storage upload of %s: %v", upload.ID, err)
+	}
+}
+
+// directPartSize returns the part size of a direct upload: at least what
+// storage accepts, and large enough to stay within MaxDirectParts
+func directPartSize(partSize, totalSize int64) int64 {
+	if partSize < MinDirectPartSize {
+		partSize = MinDirectPartSize
+	}
+
+	if minimum := (totalSize + MaxDirectParts - 1) / MaxDirectParts; partSize < minimum {
+		// Round up to whole MiB
+		partSize = (minimum + 1<<20 - 1) &^ (1<<20 - 1)
+	}
+	return partSize
+}
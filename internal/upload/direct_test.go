@@ -0,0 +1,158 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+)
+
+// fakePresigner holds multipart uploads like object storage, with parts
+// "uploaded" by the test
+type fakePresigner struct {
+	mu        sync.Mutex
+	parts     map[string][]storage.UploadedPart
+	completed map[string][]storage.UploadedPart
+	aborted   map[string]bool
+}
+
+func newFakePresigner() *fakePresigner {
+	return &fakePresigner{
+		parts:     make(map[string][]storage.UploadedPart),
+		completed: make(map[string][]storage.UploadedPart),
+		aborted:   make(map[string]bool),
+	}
+}
+
+func (p *fakePresigner) CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	return "s3-" + key, nil
+}
+
+func (p *fakePresigner) PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int, expiry time.Duration) (string, error) {
+	return fmt.Sprintf("https://storage.example.com/%s?uploadId=%s&partNumber=%d", key, uploadID, partNumber), nil
+}
+
+func (p *fakePresigner) ListUploadedParts(ctx context.Context, key, uploadID string) ([]storage.UploadedPart, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]storage.UploadedPart(nil), p.parts[uploadID]...), nil
+}
+
+func (p *fakePresigner) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []storage.UploadedPart) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.completed[key] = parts
+	return nil
+}
+
+func (p *fakePresigner) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.aborted[key] = true
+	return nil
+}
+
+// upload records a part as uploaded by the client
+func (p *fakePresigner) upload(uploadID string, partNumber int, size int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.parts[uploadID] = append(p.parts[uploadID], storage.UploadedPart{
+		PartNumber: partNumber,
+		Size:       size,
+		ETag:       fmt.Sprintf("etag-%d", partNumber),
+	})
+}
+
+func TestDirectUpload(t *testing.T) {
+	presigner := newFakePresigner()
+	service := NewMultipartUploadService(newFakeStore(), storage.NewMemoryStore(), MinDirectPartSize)
+	service.SetDirectUploads(presigner)
+
+	ctx := context.Background()
+	total := int64(2*MinDirectPartSize + 100)
+	upload, urls, err := service.InitiateDirectUpload(ctx, "../movie.mp4", total, "video/mp4")
+	require.NoError(t, err)
+
+	assert.Equal(t, UploadModeDirect, upload.Mode)
+	assert.Equal(t, 3, upload.TotalParts)
+	assert.Equal(t, fmt.Sprintf("videos/%s/original/movie.mp4", upload.VideoID), upload.StorageKey)
+	require.Len(t, urls, 3)
+	assert.Contains(t, urls[2].URL, "partNumber=3")
+
+	// Parts of direct uploads never go through the API
+	_, err = service.UploadPart(ctx, upload.ID, 1, nil, MinDirectPartSize, PartChecksums{})
+	assert.Error(t, err)
+
+	storageUploadID := "s3-" + upload.StorageKey
+	presigner.upload(storageUploadID, 2, MinDirectPartSize)
+	presigner.upload(storageUploadID, 1, MinDirectPartSize)
+
+	_, err = service.CompleteDirectUpload(ctx, upload.ID)
+	assert.EqualError(t, err, "missing part 3")
+
+	presigner.upload(storageUploadID, 3, 100)
+	completed, err := service.CompleteDirectUpload(ctx, upload.ID)
+	require.NoError(t, err)
+
+	assert.Equal(t, MultipartUploadStatusCompleted, completed.Status)
+	parts := presigner.completed[upload.StorageKey]
+	require.Len(t, parts, 3)
+	for i, part := range parts {
+		assert.Equal(t, i+1, part.PartNumber)
+	}
+}
+
+func TestDirectUploadRejectsWrongSize(t *testing.T) {
+	presigner := newFakePresigner()
+	service := NewMultipartUploadService(newFakeStore(), storage.NewMemoryStore(), 0)
+	service.SetDirectUploads(presigner)
+
+	ctx := context.Background()
+	upload, _, err := service.InitiateDirectUpload(ctx, "movie.mp4", 1000, "video/mp4")
+	require.NoError(t, err)
+
+	presigner.upload("s3-"+upload.StorageKey, 1, 999)
+	_, err = service.CompleteDirectUpload(ctx, upload.ID)
+	assert.EqualError(t, err, "uploaded 999 of 1000 bytes")
+
+	require.NoError(t, service.AbortUpload(ctx, upload.ID))
+	assert.True(t, presigner.aborted[upload.StorageKey])
+}
+
+func TestDirectUploadsNeedPresigner(t *testing.T) {
+	service := NewMultipartUploadService(newFakeStore(), storage.NewMemoryStore(), 0)
+
+	_, _, err := service.InitiateDirectUpload(context.Background(), "movie.mp4", 1000, "video/mp4")
+	assert.Error(t, err)
+	assert.False(t, service.DirectUploadsEnabled())
+}
+
+func TestDirectPartSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		partSize  int64
+		totalSize int64
+		want      int64
+	}{
+		{"raised to storage minimum", 1024, 100 << 20, MinDirectPartSize},
+		{"kept when large enough", 10 << 20, 100 << 20, 10 << 20},
+		{"grown to fit max parts", MinDirectPartSize, 100 << 30, 11 << 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := directPartSize(tt.partSize, tt.totalSize)
+			assert.Equal(t, tt.want, got)
+			assert.LessOrEqual(t, (tt.totalSize+got-1)/got, int64(MaxDirectParts))
+		})
+	}
+}
@@ -1,63 +1,78 @@
 package upload
 
 import (
+	"bytes"
 	"context"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"os"
-	"path/filepath"
-	"sync"
+	"mime"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
 )
 
-// MultipartUpload represents a multipart upload session
-type MultipartUpload struct {
-	ID          string             `json:"id"`
-	Filename    string             `json:"filename"`
-	TotalSize   int64              `json:"total_size"`
-	PartSize    int64              `json:"part_size"`
-	TotalParts  int                `json:"total_parts"`
-	Parts       map[int]*UploadPart `json:"parts"`
-	Status      string             `json:"status"`
-	CreatedAt   time.Time          `json:"created_at"`
-	ExpiresAt   time.Time          `json:"expires_at"`
-	CompletedAt *time.Time         `json:"completed_at,omitempty"`
-	mu          sync.RWMutex
+// Store persists multipart upload sessions and their parts
+type Store interface {
+	CreateMultipartUpload(ctx context.Context, upload *models.MultipartUpload) error
+	GetMultipartUpload(ctx context.Context, id string) (*models.MultipartUpload, error)
+	SaveUploadPart(ctx context.Context, uploadID string, part *models.UploadPart) (string, error)
+	ListUploadParts(ctx context.Context, uploadID string) ([]*models.UploadPart, error)
+	CompleteMultipartUpload(ctx context.Context, id, checksum string) (bool, error)
+	DeleteMultipartUpload(ctx context.Context, id string) error
+	ListExpiredMultipartUploads(ctx context.Context, limit int) ([]*models.MultipartUpload, error)
 }
 
-// UploadPart represents a single part of a multipart upload
-type UploadPart struct {
-	PartNumber int       `json:"part_number"`
-	Size       int64     `json:"size"`
-	ETag       string    `json:"etag"`
-	Uploaded   bool      `json:"uploaded"`
-	UploadedAt time.Time `json:"uploaded_at,omitempty"`
+// PartChecksums are the digests a client sent with a part, nil when not sent
+type PartChecksums struct {
+	MD5    []byte
+	SHA256 []byte
 }
 
-// MultipartUploadService manages multipart uploads
+var (
+	// ErrChecksumMismatch reports data that does not match its client-sent checksum
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	// ErrPartSize reports a part that is not of its expected size
+	ErrPartSize = errors.New("unexpected part size")
+)
+
+// MultipartUploadService manages multipart uploads. Sessions live in the
+// store and parts in object storage, so uploads survive restarts and their
+// requests may be served by different API replicas.
 type MultipartUploadService struct {
-	uploads  map[string]*MultipartUpload
-	mu       sync.RWMutex
-	tempDir  string
+	store    Store
+	blobs    storage.Blobstore
 	partSize int64
+
+	presigner storage.MultipartPresigner
 }
 
 const (
 	DefaultPartSize          = 5 * 1024 * 1024  // 5MB
 	MaxPartSize              = 100 * 1024 * 1024 // 100MB
 	DefaultUploadExpiration  = 24 * time.Hour
-	MultipartUploadStatusActive   = "active"
-	MultipartUploadStatusCompleted = "completed"
-	MultipartUploadStatusAborted  = "aborted"
+	MultipartUploadStatusActive   = models.MultipartUploadStatusActive
+	MultipartUploadStatusCompleted = models.MultipartUploadStatusCompleted
+	MultipartUploadStatusAborted  = models.MultipartUploadStatusAborted
+
+	// UploadModeProxy uploads send their parts through the API
+	UploadModeProxy = "proxy"
+	// UploadModeDirect uploads send their parts straight to storage
+	UploadModeDirect = "direct"
 )
 
+
 // NewMultipartUploadService creates a new multipart upload service
-func NewMultipartUploadService(tempDir string, partSize int64) *MultipartUploadService {
+func NewMultipartUploadService(store Store, blobs storage.Blobstore, partSize int64) *MultipartUploadService {
 	if partSize == 0 {
 		partSize = DefaultPartSize
 	}
@@ -67,60 +82,61 @@ func NewMultipartUploadService(tempDir string, partSize int64) *MultipartUploadS
 	}
 
 	return &MultipartUploadService{
-		uploads:  make(map[string]*MultipartUpload),
-		tempDir:  tempDir,
+		store:    store,
+		blobs:    blobs,
 		partSize: partSize,
 	}
 }
 
 // InitiateUpload starts a new multipart upload
-func (s *MultipartUploadService) InitiateUpload(filename string, totalSize int64) (*MultipartUpload, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	uploadID := uuid.New().String()
-	totalParts := int((totalSize + s.partSize - 1) / s.partSize)
+func (s *MultipartUploadService) InitiateUpload(ctx context.Context, filename string, totalSize int64) (*models.MultipartUpload, error) {
+	if totalSize <= 0 {
+		return nil, fmt.Errorf("total size must be positive")
+	}
 
-	upload := &MultipartUpload{
-		ID:         uploadID,
+	now := time.Now()
+	videoID := uuid.New().String()
+	upload := &models.MultipartUpload{
+		ID:         uuid.New().String(),
+		Mode:       UploadModeProxy,
 		Filename:   filename,
 		TotalSize:  totalSize,
 		PartSize:   s.partSize,
-		TotalParts: totalParts,
-		Parts:      make(map[int]*UploadPart),
+		TotalParts: int((totalSize + s.partSize - 1) / s.partSize),
+		Parts:      make(map[int]*models.UploadPart),
 		Status:     MultipartUploadStatusActive,
-		CreatedAt:  time.Now(),
-		ExpiresAt:  time.Now().Add(DefaultUploadExpiration),
+		VideoID:    videoID,
+		StorageKey: originalKey(videoID, filename),
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(DefaultUploadExpiration),
 	}
 
-	// Create upload directory
-	uploadDir := filepath.Join(s.tempDir, "uploads", uploadID)
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	if err := s.store.CreateMultipartUpload(ctx, upload); err != nil {
+		return nil, err
 	}
 
-	s.uploads[uploadID] = upload
-
 	log.Printf("Initiated multipart upload %s for %s (%d bytes, %d parts)",
-		uploadID, filename, totalSize, totalParts)
+		upload.ID, filename, totalSize, upload.TotalParts)
 
 	return upload, nil
 }
 
-// UploadPart uploads a single part
-func (s *MultipartUploadService) UploadPart(uploadID string, partNumber int, data io.Reader) (*UploadPart, error) {
-	s.mu.RLock()
-	upload, exists := s.uploads[uploadID]
-	s.mu.RUnlock()
-
-	if !exists {
-		return nil, fmt.Errorf("upload not found: %s", uploadID)
+// UploadPart stores a part of size bytes, verifying it against the checksums
+// the client sent. Uploading a part again replaces it.
+func (s *MultipartUploadService) UploadPart(ctx context.Context, uploadID string, partNumber int, data io.Reader, size int64, sums PartChecksums) (*models.UploadPart, error) {
+	upload, err := s.store.GetMultipartUpload(ctx, uploadID)
+	if err != nil {
+		return nil, err
 	}
 
 	if upload.Status != MultipartUploadStatusActive {
 		return nil, fmt.Errorf("upload is not active")
 	}
 
+	if upload.Mode == UploadModeDirect {
+		return nil, fmt.Errorf("parts of direct uploads are uploaded to storage")
+	}
+
 	if time.Now().After(upload.ExpiresAt) {
 		return nil, fmt.Errorf("upload has expired")
 	}
@@ -129,166 +145,160 @@ func (s *MultipartUploadService) UploadPart(uploadID string, partNumber int, dat
 		return nil, fmt.Errorf("invalid part number: %d", partNumber)
 	}
 
-	// Save part to disk
-	uploadDir := filepath.Join(s.tempDir, "uploads", uploadID)
-	partPath := filepath.Join(uploadDir, fmt.Sprintf("part_%d", partNumber))
-
-	file, err := os.Create(partPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create part file: %w", err)
+	if expected := upload.ExpectedPartSize(partNumber); size != expected {
+		return nil, fmt.Errorf("%w: part %d must be %d bytes, got %d", ErrPartSize, partNumber, expected, size)
 	}
-	defer file.Close()
 
-	// Calculate MD5 while writing
-	hash := md5.New()
-	writer := io.MultiWriter(file, hash)
+	// Each attempt gets its own object, so a failed retry cannot clobber a
+	// part that was already recorded
+	key := fmt.Sprintf("%spart-%05d-%s", partPrefix(uploadID), partNumber, uuid.New().String()[:8])
 
-	size, err := io.Copy(writer, data)
-	if err != nil {
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+	counter := &countingReader{reader: io.LimitReader(data, size)}
+	reader := io.TeeReader(counter, io.MultiWriter(md5Hash, sha256Hash))
+
+	if err := s.blobs.Put(ctx, key, reader, size, "application/octet-stream"); err != nil {
 		return nil, fmt.Errorf("failed to write part: %w", err)
 	}
 
-	etag := hex.EncodeToString(hash.Sum(nil))
-
-	part := &UploadPart{
+	part := &models.UploadPart{
 		PartNumber: partNumber,
-		Size:       size,
-		ETag:       etag,
+		Size:       counter.n,
+		ETag:       hex.EncodeToString(md5Hash.Sum(nil)),
+		SHA256:     hex.EncodeToString(sha256Hash.Sum(nil)),
+		Key:        key,
 		Uploaded:   true,
 		UploadedAt: time.Now(),
 	}
 
-	upload.mu.Lock()
-	upload.Parts[partNumber] = part
-	upload.mu.Unlock()
+	if part.Size != size {
+		s.deleteObject(ctx, key)
+		return nil, fmt.Errorf("%w: part %d must be %d bytes, got %d", ErrPartSize, partNumber, size, part.Size)
+	}
+	if (sums.MD5 != nil && !bytes.Equal(sums.MD5, md5Hash.Sum(nil))) ||
+		(sums.SHA256 != nil && !bytes.Equal(sums.SHA256, sha256Hash.Sum(nil))) {
+		s.deleteObject(ctx, key)
+		return nil, fmt.Errorf("%w: part %d", ErrChecksumMismatch, partNumber)
+	}
+
+	previousKey, err := s.store.SaveUploadPart(ctx, uploadID, part)
+	if err != nil {
+		s.deleteObject(ctx, key)
+		return nil, err
+	}
+	if previousKey != "" && previousKey != key {
+		s.deleteObject(ctx, previousKey)
+	}
 
 	log.Printf("Uploaded part %d/%d for upload %s (%d bytes, etag: %s)",
-		partNumber, upload.TotalParts, uploadID, size, etag)
+		partNumber, upload.TotalParts, uploadID, part.Size, part.ETag)
 
 	return part, nil
 }
 
-// CompleteUpload finalizes the multipart upload
-func (s *MultipartUploadService) CompleteUpload(uploadID string) (string, error) {
-	s.mu.RLock()
-	upload, exists := s.uploads[uploadID]
-	s.mu.RUnlock()
-
-	if !exists {
-		return "", fmt.Errorf("upload not found: %s", uploadID)
+// CompleteUpload assembles the parts of an upload under its storage key. When
+// checksum, a hex SHA-256, is given the assembled data must match it.
+func (s *MultipartUploadService) CompleteUpload(ctx context.Context, uploadID, checksum string) (*models.MultipartUpload, error) {
+	upload, err := s.store.GetMultipartUpload(ctx, uploadID)
+	if err != nil {
+		return nil, err
 	}
 
-	upload.mu.Lock()
-	defer upload.mu.Unlock()
-
 	if upload.Status != MultipartUploadStatusActive {
-		return "", fmt.Errorf("upload is not active")
+		return nil, fmt.Errorf("upload is not active")
+	}
+
+	if upload.Mode == UploadModeDirect {
+		return nil, fmt.Errorf("direct uploads are completed in storage")
 	}
 
 	// Verify all parts are uploaded
+	keys := make([]string, 0, upload.TotalParts)
 	for i := 1; i <= upload.TotalParts; i++ {
-		if part, ok := upload.Parts[i]; !ok || !part.Uploaded {
-			return "", fmt.Errorf("missing part %d", i)
+		part, ok := upload.Parts[i]
+		if !ok || !part.Uploaded {
+			return nil, fmt.Errorf("missing part %d", i)
 		}
+		if part.Size != upload.ExpectedPartSize(i) {
+			return nil, fmt.Errorf("%w: part %d has %d bytes", ErrPartSize, i, part.Size)
+		}
+		keys = append(keys, part.Key)
 	}
 
-	// Combine parts into final file
-	uploadDir := filepath.Join(s.tempDir, "uploads", uploadID)
-	finalPath := filepath.Join(uploadDir, upload.Filename)
+	// Concatenate all parts, hashing the whole file on the way
+	reader := &partReader{ctx: ctx, blobs: s.blobs, keys: keys}
+	defer reader.Close()
 
-	finalFile, err := os.Create(finalPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to create final file: %w", err)
+	hash := sha256.New()
+	contentType := mime.TypeByExtension(path.Ext(upload.Filename))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if err := s.blobs.Put(ctx, upload.StorageKey, io.TeeReader(reader, hash), upload.TotalSize, contentType); err != nil {
+		return nil, fmt.Errorf("failed to assemble upload: %w", err)
 	}
-	defer finalFile.Close()
-
-	// Concatenate all parts
-	for i := 1; i <= upload.TotalParts; i++ {
-		partPath := filepath.Join(uploadDir, fmt.Sprintf("part_%d", i))
-		partFile, err := os.Open(partPath)
-		if err != nil {
-			return "", fmt.Errorf("failed to open part %d: %w", i, err)
-		}
-
-		if _, err := io.Copy(finalFile, partFile); err != nil {
-			partFile.Close()
-			return "", fmt.Errorf("failed to copy part %d: %w", i, err)
-		}
 
-		partFile.Close()
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if checksum != "" && !strings.EqualFold(checksum, sum) {
+		s.deleteObject(ctx, upload.StorageKey)
+		return nil, fmt.Errorf("%w: uploaded file has SHA-256 %s", ErrChecksumMismatch, sum)
+	}
 
-		// Delete part file
-		os.Remove(partPath)
+	completed, err := s.store.CompleteMultipartUpload(ctx, uploadID, sum)
+	if err != nil {
+		return nil, err
+	}
+	if !completed {
+		return nil, fmt.Errorf("upload is not active")
 	}
 
-	upload.Status = MultipartUploadStatusCompleted
+	s.deleteParts(ctx, uploadID)
+
 	now := time.Now()
+	upload.Status = MultipartUploadStatusCompleted
+	upload.Checksum = sum
 	upload.CompletedAt = &now
 
-	log.Printf("Completed multipart upload %s (%s)", uploadID, finalPath)
+	log.Printf("Completed multipart upload %s (%s)", uploadID, upload.StorageKey)
 
-	return finalPath, nil
+	return upload, nil
 }
 
 // AbortUpload cancels a multipart upload
-func (s *MultipartUploadService) AbortUpload(uploadID string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func (s *MultipartUploadService) AbortUpload(ctx context.Context, uploadID string) error {
+	upload, err := s.store.GetMultipartUpload(ctx, uploadID)
+	if err != nil {
+		return err
+	}
 
-	upload, exists := s.uploads[uploadID]
-	if !exists {
-		return fmt.Errorf("upload not found: %s", uploadID)
+	if upload.Status == MultipartUploadStatusActive {
+		s.abortStorageUpload(upload)
 	}
 
-	upload.mu.Lock()
-	upload.Status = MultipartUploadStatusAborted
-	upload.mu.Unlock()
+	s.deleteParts(ctx, uploadID)
 
-	// Clean up upload directory
-	uploadDir := filepath.Join(s.tempDir, "uploads", uploadID)
-	if err := os.RemoveAll(uploadDir); err != nil {
-		log.Printf("Failed to remove upload directory %s: %v", uploadDir, err)
+	if err := s.store.DeleteMultipartUpload(ctx, uploadID); err != nil {
+		return err
 	}
 
-	delete(s.uploads, uploadID)
-
 	log.Printf("Aborted multipart upload %s", uploadID)
 
 	return nil
 }
 
 // GetUpload retrieves upload status
-func (s *MultipartUploadService) GetUpload(uploadID string) (*MultipartUpload, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	upload, exists := s.uploads[uploadID]
-	if !exists {
-		return nil, fmt.Errorf("upload not found: %s", uploadID)
-	}
-
-	return upload, nil
+func (s *MultipartUploadService) GetUpload(ctx context.Context, uploadID string) (*models.MultipartUpload, error) {
+	return s.store.GetMultipartUpload(ctx, uploadID)
 }
 
 // ListParts lists all uploaded parts for an upload
-func (s *MultipartUploadService) ListParts(uploadID string) ([]*UploadPart, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	upload, exists := s.uploads[uploadID]
-	if !exists {
-		return nil, fmt.Errorf("upload not found: %s", uploadID)
-	}
-
-	upload.mu.RLock()
-	defer upload.mu.RUnlock()
-
-	parts := make([]*UploadPart, 0, len(upload.Parts))
-	for _, part := range upload.Parts {
-		parts = append(parts, part)
+func (s *MultipartUploadService) ListParts(ctx context.Context, uploadID string) ([]*models.UploadPart, error) {
+	if _, err := s.store.GetMultipartUpload(ctx, uploadID); err != nil {
+		return nil, err
 	}
 
-	return parts, nil
+	return s.store.ListUploadParts(ctx, uploadID)
 }
 
 // CleanupExpired removes expired uploads
@@ -301,30 +311,114 @@ func (s *MultipartUploadService) CleanupExpired(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			s.cleanupExpiredUploads()
+			s.cleanupExpiredUploads(ctx)
+		}
+	}
+}
+
+func (s *MultipartUploadService) cleanupExpiredUploads(ctx context.Context) {
+	expired, err := s.store.ListExpiredMultipartUploads(ctx, 100)
+	if err != nil {
+		log.Printf("Failed to list expired uploads: %v", err)
+		return
+	}
+
+	for _, upload := range expired {
+		if upload.Status == MultipartUploadStatusActive {
+			s.abortStorageUpload(upload)
+		}
+		s.deleteParts(ctx, upload.ID)
+
+		if err := s.store.DeleteMultipartUpload(ctx, upload.ID); err != nil {
+			log.Printf("Failed to delete expired upload %s: %v", upload.ID, err)
+			continue
 		}
+		log.Printf("Cleaned up expired upload %s", upload.ID)
 	}
 }
 
-func (s *MultipartUploadService) cleanupExpiredUploads() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// originalKey returns where the video original an upload becomes is stored
+func originalKey(videoID, filename string) string {
+	return fmt.Sprintf("videos/%s/original/%s", videoID, path.Base(filename))
+}
 
-	now := time.Now()
-	for uploadID, upload := range s.uploads {
-		if now.After(upload.ExpiresAt) && upload.Status == MultipartUploadStatusActive {
-			upload.mu.Lock()
-			upload.Status = MultipartUploadStatusAborted
-			upload.mu.Unlock()
-
-			// Clean up upload directory
-			uploadDir := filepath.Join(s.tempDir, "uploads", uploadID)
-			if err := os.RemoveAll(uploadDir); err != nil {
-				log.Printf("Failed to remove expired upload directory %s: %v", uploadDir, err)
+// partPrefix returns the storage prefix of an upload's part objects
+func partPrefix(uploadID string) string {
+	return "uploads/" + uploadID + "/"
+}
+
+// deleteParts removes all part objects of an upload, including those of
+// superseded or interrupted attempts
+func (s *MultipartUploadService) deleteParts(ctx context.Context, uploadID string) {
+	objects, err := s.blobs.List(ctx, partPrefix(uploadID))
+	if err != nil {
+		log.Printf("Failed to list parts of upload %s: %v", uploadID, err)
+		return
+	}
+
+	for _, object := range objects {
+		s.deleteObject(ctx, object.Key)
+	}
+}
+
+// deleteObject removes an object, logging failures
+func (s *MultipartUploadService) deleteObject(ctx context.Context, key string) {
+	if err := s.blobs.Delete(ctx, key); err != nil {
+		log.Printf("Failed to delete %s: %v", key, err)
+	}
+}
+
+// partReader reads part objects in order, opening each when reached
+type partReader struct {
+	ctx     context.Context
+	blobs   storage.Blobstore
+	keys    []string
+	current io.ReadCloser
+}
+
+func (r *partReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.keys) == 0 {
+				return 0, io.EOF
 			}
 
-			delete(s.uploads, uploadID)
-			log.Printf("Cleaned up expired upload %s", uploadID)
+			part, err := r.blobs.Get(r.ctx, r.keys[0])
+			if err != nil {
+				return 0, fmt.Errorf("failed to open part: %w", err)
+			}
+			r.current = part
+			r.keys = r.keys[1:]
 		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *partReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
 	}
+	return nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
 }
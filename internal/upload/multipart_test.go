@@ -0,0 +1,284 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/storage"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// fakeStore keeps upload sessions in memory like the multipart_uploads tables
+type fakeStore struct {
+	mu      sync.Mutex
+	uploads map[string]*models.MultipartUpload
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{uploads: make(map[string]*models.MultipartUpload)}
+}
+
+func (s *fakeStore) CreateMultipartUpload(ctx context.Context, upload *models.MultipartUpload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *upload
+	copied.Parts = make(map[int]*models.UploadPart)
+	s.uploads[upload.ID] = &copied
+	return nil
+}
+
+func (s *fakeStore) GetMultipartUpload(ctx context.Context, id string) (*models.MultipartUpload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upload, ok := s.uploads[id]
+	if !ok {
+		return nil, fmt.Errorf("upload not found: %s", id)
+	}
+
+	copied := *upload
+	copied.Parts = make(map[int]*models.UploadPart, len(upload.Parts))
+	for number, part := range upload.Parts {
+		partCopy := *part
+		copied.Parts[number] = &partCopy
+	}
+	return &copied, nil
+}
+
+func (s *fakeStore) SaveUploadPart(ctx context.Context, uploadID string, part *models.UploadPart) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upload, ok := s.uploads[uploadID]
+	if !ok || upload.Status != models.MultipartUploadStatusActive {
+		return "", fmt.Errorf("upload is not active")
+	}
+
+	var previousKey string
+	if previous, ok := upload.Parts[part.PartNumber]; ok {
+		previousKey = previous.Key
+	}
+	partCopy := *part
+	upload.Parts[part.PartNumber] = &partCopy
+	return previousKey, nil
+}
+
+func (s *fakeStore) ListUploadParts(ctx context.Context, uploadID string) ([]*models.UploadPart, error) {
+	upload, err := s.GetMultipartUpload(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []*models.UploadPart
+	for _, part := range upload.Parts {
+		parts = append(parts, part)
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+func (s *fakeStore) CompleteMultipartUpload(ctx context.Context, id, checksum string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upload, ok := s.uploads[id]
+	if !ok || upload.Status != models.MultipartUploadStatusActive {
+		return false, nil
+	}
+	upload.Status = models.MultipartUploadStatusCompleted
+	upload.Checksum = checksum
+	return true, nil
+}
+
+func (s *fakeStore) DeleteMultipartUpload(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.uploads[id]; !ok {
+		return fmt.Errorf("upload not found: %s", id)
+	}
+	delete(s.uploads, id)
+	return nil
+}
+
+func (s *fakeStore) ListExpiredMultipartUploads(ctx context.Context, limit int) ([]*models.MultipartUpload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired []*models.MultipartUpload
+	for _, upload := range s.uploads {
+		if upload.ExpiresAt.Before(time.Now()) {
+			copied := *upload
+			expired = append(expired, &copied)
+		}
+	}
+	return expired, nil
+}
+
+// uploadTest runs two services sharing a store and object storage, like two
+// API replicas
+type uploadTest struct {
+	store    *fakeStore
+	blobs    *storage.MemoryStore
+	replicas [2]*MultipartUploadService
+}
+
+func newUploadTest(partSize int64) *uploadTest {
+	ut := &uploadTest{store: newFakeStore(), blobs: storage.NewMemoryStore()}
+	for i := range ut.replicas {
+		ut.replicas[i] = NewMultipartUploadService(ut.store, ut.blobs, partSize)
+	}
+	return ut
+}
+
+func (ut *uploadTest) objects(t *testing.T, prefix string) []string {
+	objects, err := ut.blobs.List(context.Background(), prefix)
+	require.NoError(t, err)
+
+	keys := make([]string, len(objects))
+	for i, object := range objects {
+		keys[i] = object.Key
+	}
+	return keys
+}
+
+func TestMultipartUploadAcrossReplicas(t *testing.T) {
+	ut := newUploadTest(4)
+	ctx := context.Background()
+	data := "0123456789"
+
+	upload, err := ut.replicas[0].InitiateUpload(ctx, "movie.mp4", int64(len(data)))
+	require.NoError(t, err)
+	assert.Equal(t, 3, upload.TotalParts)
+	assert.Equal(t, fmt.Sprintf("videos/%s/original/movie.mp4", upload.VideoID), upload.StorageKey)
+
+	// Parts arrive at different replicas, out of order
+	for i, partNumber := range []int{3, 1, 2} {
+		start := (partNumber - 1) * 4
+		end := start + 4
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := data[start:end]
+
+		part, err := ut.replicas[i%2].UploadPart(ctx, upload.ID, partNumber, strings.NewReader(chunk), int64(len(chunk)), PartChecksums{})
+		require.NoError(t, err)
+		sum := md5.Sum([]byte(chunk))
+		assert.Equal(t, hex.EncodeToString(sum[:]), part.ETag)
+	}
+
+	parts, err := ut.replicas[1].ListParts(ctx, upload.ID)
+	require.NoError(t, err)
+	require.Len(t, parts, 3)
+	assert.Equal(t, 1, parts[0].PartNumber)
+
+	sum := sha256.Sum256([]byte(data))
+	completed, err := ut.replicas[1].CompleteUpload(ctx, upload.ID, hex.EncodeToString(sum[:]))
+	require.NoError(t, err)
+	assert.Equal(t, MultipartUploadStatusCompleted, completed.Status)
+	assert.Equal(t, hex.EncodeToString(sum[:]), completed.Checksum)
+
+	object, err := ut.blobs.Get(ctx, upload.StorageKey)
+	require.NoError(t, err)
+	assembled, _ := io.ReadAll(object)
+	assert.Equal(t, data, string(assembled))
+	assert.Empty(t, ut.objects(t, partPrefix(upload.ID)))
+
+	// Only one completion wins
+	_, err = ut.replicas[0].CompleteUpload(ctx, upload.ID, "")
+	assert.EqualError(t, err, "upload is not active")
+}
+
+func TestUploadPartVerifiesChecksums(t *testing.T) {
+	ut := newUploadTest(4)
+	ctx := context.Background()
+	service := ut.replicas[0]
+
+	upload, err := service.InitiateUpload(ctx, "movie.mp4", 8)
+	require.NoError(t, err)
+
+	wrong := md5.Sum([]byte("nope"))
+	_, err = service.UploadPart(ctx, upload.ID, 1, strings.NewReader("abcd"), 4, PartChecksums{MD5: wrong[:]})
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	wrongSHA := sha256.Sum256([]byte("nope"))
+	_, err = service.UploadPart(ctx, upload.ID, 1, strings.NewReader("abcd"), 4, PartChecksums{SHA256: wrongSHA[:]})
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.Empty(t, ut.objects(t, partPrefix(upload.ID)))
+
+	_, err = service.UploadPart(ctx, upload.ID, 1, strings.NewReader("abc"), 3, PartChecksums{})
+	assert.ErrorIs(t, err, ErrPartSize)
+
+	md5Sum := md5.Sum([]byte("abcd"))
+	shaSum := sha256.Sum256([]byte("abcd"))
+	part, err := service.UploadPart(ctx, upload.ID, 1, strings.NewReader("abcd"), 4, PartChecksums{MD5: md5Sum[:], SHA256: shaSum[:]})
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(shaSum[:]), part.SHA256)
+
+	// Uploading a part again replaces it
+	_, err = service.UploadPart(ctx, upload.ID, 1, strings.NewReader("ABCD"), 4, PartChecksums{})
+	require.NoError(t, err)
+	assert.Len(t, ut.objects(t, partPrefix(upload.ID)), 1)
+
+	_, err = service.CompleteUpload(ctx, upload.ID, "")
+	assert.EqualError(t, err, "missing part 2")
+
+	_, err = service.UploadPart(ctx, upload.ID, 2, strings.NewReader("efgh"), 4, PartChecksums{})
+	require.NoError(t, err)
+
+	// A whole-file mismatch leaves the upload active
+	_, err = service.CompleteUpload(ctx, upload.ID, strings.Repeat("0", 64))
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.Empty(t, ut.objects(t, upload.StorageKey))
+
+	completed, err := service.CompleteUpload(ctx, upload.ID, "")
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte("ABCDefgh"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), completed.Checksum)
+}
+
+func TestAbortUploadDeletesParts(t *testing.T) {
+	ut := newUploadTest(4)
+	ctx := context.Background()
+
+	upload, err := ut.replicas[0].InitiateUpload(ctx, "movie.mp4", 8)
+	require.NoError(t, err)
+	_, err = ut.replicas[0].UploadPart(ctx, upload.ID, 1, bytes.NewReader([]byte("abcd")), 4, PartChecksums{})
+	require.NoError(t, err)
+
+	require.NoError(t, ut.replicas[1].AbortUpload(ctx, upload.ID))
+	assert.Empty(t, ut.objects(t, partPrefix(upload.ID)))
+
+	_, err = ut.replicas[0].GetUpload(ctx, upload.ID)
+	assert.Error(t, err)
+}
+
+func TestCleanupExpiredUploads(t *testing.T) {
+	ut := newUploadTest(4)
+	ctx := context.Background()
+
+	upload, err := ut.replicas[0].InitiateUpload(ctx, "movie.mp4", 8)
+	require.NoError(t, err)
+	_, err = ut.replicas[0].UploadPart(ctx, upload.ID, 1, strings.NewReader("abcd"), 4, PartChecksums{})
+	require.NoError(t, err)
+
+	ut.store.uploads[upload.ID].ExpiresAt = time.Now().Add(-time.Minute)
+	ut.replicas[1].cleanupExpiredUploads(ctx)
+
+	_, err = ut.replicas[0].GetUpload(ctx, upload.ID)
+	assert.Error(t, err)
+	assert.Empty(t, ut.objects(t, partPrefix(upload.ID)))
+}
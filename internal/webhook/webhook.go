@@ -26,7 +26,7 @@ type Service struct {
 // Repository defines the interface for webhook persistence
 type Repository interface {
 	GetWebhooksByEvent(ctx context.Context, event string) ([]*models.Webhook, error)
-	CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) (bool, error)
 	UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
 	GetPendingDeliveries(ctx context.Context, limit int) ([]*models.WebhookDelivery, error)
 }
@@ -43,6 +43,12 @@ func NewService(repo Repository) *Service {
 
 // Notify sends a webhook notification for an event
 func (s *Service) Notify(ctx context.Context, event string, data interface{}) error {
+	return s.NotifyOnce(ctx, event, "", data)
+}
+
+// NotifyOnce sends a webhook notification for an event unless one was already
+// sent with the same idempotency key. An empty key always notifies.
+func (s *Service) NotifyOnce(ctx context.Context, event, key string, data interface{}) error {
 	webhooks, err := s.repo.GetWebhooksByEvent(ctx, event)
 	if err != nil {
 		return fmt.Errorf("failed to get webhooks: %w", err)
@@ -65,19 +71,25 @@ func (s *Service) Notify(ctx context.Context, event string, data interface{}) er
 		}
 
 		delivery := &models.WebhookDelivery{
-			ID:         uuid.New().String(),
-			WebhookID:  webhook.ID,
-			Event:      event,
-			Payload:    string(payloadBytes),
-			Status:     models.WebhookDeliveryStatusPending,
-			RetryCount: 0,
-			CreatedAt:  time.Now(),
+			ID:             uuid.New().String(),
+			WebhookID:      webhook.ID,
+			Event:          event,
+			Payload:        string(payloadBytes),
+			Status:         models.WebhookDeliveryStatusPending,
+			RetryCount:     0,
+			CreatedAt:      time.Now(),
+			IdempotencyKey: key,
 		}
 
-		if err := s.repo.CreateDelivery(ctx, delivery); err != nil {
+		created, err := s.repo.CreateDelivery(ctx, delivery)
+		if err != nil {
 			log.Printf("Failed to create delivery: %v", err)
 			continue
 		}
+		if !created {
+			// Already notified
+			continue
+		}
 
 		// Attempt immediate delivery in background
 		go s.deliver(context.Background(), webhook, delivery, payloadBytes)
@@ -226,19 +238,32 @@ func (s *Service) retryPendingDeliveries(ctx context.Context) {
 	}
 }
 
+// jobEventKey returns the idempotency key of a job event, so a redelivered
+// job notifies once. A job completes once; it starts and fails once per
+// attempt, identified by the fencing token of the worker's lease.
+func jobEventKey(job *models.Job, event string) string {
+	if event == models.WebhookEventJobCompleted {
+		return job.ID + "/" + event
+	}
+	if job.FencingToken == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/%d", job.ID, event, job.FencingToken)
+}
+
 // NotifyJobStarted sends notification when a job starts
 func (s *Service) NotifyJobStarted(ctx context.Context, job *models.Job) error {
-	return s.Notify(ctx, models.WebhookEventJobStarted, job)
+	return s.NotifyOnce(ctx, models.WebhookEventJobStarted, jobEventKey(job, models.WebhookEventJobStarted), job)
 }
 
 // NotifyJobCompleted sends notification when a job completes
 func (s *Service) NotifyJobCompleted(ctx context.Context, job *models.Job) error {
-	return s.Notify(ctx, models.WebhookEventJobCompleted, job)
+	return s.NotifyOnce(ctx, models.WebhookEventJobCompleted, jobEventKey(job, models.WebhookEventJobCompleted), job)
 }
 
 // NotifyJobFailed sends notification when a job fails
 func (s *Service) NotifyJobFailed(ctx context.Context, job *models.Job) error {
-	return s.Notify(ctx, models.WebhookEventJobFailed, job)
+	return s.NotifyOnce(ctx, models.WebhookEventJobFailed, jobEventKey(job, models.WebhookEventJobFailed), job)
 }
 
 // NotifyJobProgress sends notification for job progress updates
@@ -250,3 +275,14 @@ func (s *Service) NotifyJobProgress(ctx context.Context, job *models.Job) error
 func (s *Service) NotifyVideoUploaded(ctx context.Context, video *models.Video) error {
 	return s.Notify(ctx, models.WebhookEventVideoUploaded, video)
 }
+
+// NotifyClipReady sends notification when a live stream clip is available,
+// once per clip job
+func (s *Service) NotifyClipReady(ctx context.Context, clip *models.LiveStreamClip) error {
+	return s.NotifyOnce(ctx, models.WebhookEventClipReady, clip.JobID+"/"+models.WebhookEventClipReady, clip)
+}
+
+// NotifyBatchCompleted sends notification when every job of a batch has finished
+func (s *Service) NotifyBatchCompleted(ctx context.Context, batch *models.Batch) error {
+	return s.NotifyOnce(ctx, models.WebhookEventBatchCompleted, batch.ID, batch)
+}
@@ -21,9 +21,14 @@ func (m *mockRepository) GetWebhooksByEvent(ctx context.Context, event string) (
 	return m.webhooks, nil
 }
 
-func (m *mockRepository) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+func (m *mockRepository) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) (bool, error) {
+	for _, d := range m.deliveries {
+		if delivery.IdempotencyKey != "" && d.WebhookID == delivery.WebhookID && d.IdempotencyKey == delivery.IdempotencyKey {
+			return false, nil
+		}
+	}
 	m.deliveries = append(m.deliveries, delivery)
-	return nil
+	return true, nil
 }
 
 func (m *mockRepository) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
@@ -0,0 +1,152 @@
+package worker
+
+import (
+	"context"
+	"sync"
+
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// Resources is an amount of worker capacity
+type Resources struct {
+	CPUs        int `json:"cpus"`
+	MemoryMB    int `json:"memory_mb"`
+	GPUSessions int `json:"gpu_sessions"`
+}
+
+func (r Resources) add(o Resources) Resources {
+	return Resources{r.CPUs + o.CPUs, r.MemoryMB + o.MemoryMB, r.GPUSessions + o.GPUSessions}
+}
+
+func (r Resources) sub(o Resources) Resources {
+	return Resources{r.CPUs - o.CPUs, r.MemoryMB - o.MemoryMB, r.GPUSessions - o.GPUSessions}
+}
+
+// within reports whether r fits in limit
+func (r Resources) within(limit Resources) bool {
+	return r.CPUs <= limit.CPUs && r.MemoryMB <= limit.MemoryMB && r.GPUSessions <= limit.GPUSessions
+}
+
+// Budget admits jobs while there is a free slot and their combined demand fits
+// the worker's resources
+type Budget struct {
+	mu      sync.Mutex
+	total   Resources
+	used    Resources
+	slots   int
+	running int
+	changed chan struct{} // closed whenever capacity is released
+}
+
+// NewBudget creates a budget of slots concurrent jobs sharing total
+func NewBudget(total Resources, slots int) *Budget {
+	if slots < 1 {
+		slots = 1
+	}
+
+	return &Budget{
+		total:   total,
+		slots:   slots,
+		changed: make(chan struct{}),
+	}
+}
+
+// Clamp caps a demand at the budget's total so any job can run on its own
+func (b *Budget) Clamp(demand Resources) Resources {
+	if demand.CPUs > b.total.CPUs {
+		demand.CPUs = b.total.CPUs
+	}
+	if demand.MemoryMB > b.total.MemoryMB {
+		demand.MemoryMB = b.total.MemoryMB
+	}
+	if demand.GPUSessions > b.total.GPUSessions {
+		demand.GPUSessions = b.total.GPUSessions
+	}
+	return demand
+}
+
+// Acquire blocks until demand fits the budget or ctx is cancelled
+func (b *Budget) Acquire(ctx context.Context, demand Resources) error {
+	demand = b.Clamp(demand)
+
+	for {
+		b.mu.Lock()
+		if b.running < b.slots && b.used.add(demand).within(b.total) {
+			b.used = b.used.add(demand)
+			b.running++
+			b.mu.Unlock()
+			return nil
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Release returns the capacity taken by Acquire
+func (b *Budget) Release(demand Resources) {
+	demand = b.Clamp(demand)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.used = b.used.sub(demand)
+	b.running--
+
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// Usage returns the resources in use and the number of running jobs
+func (b *Budget) Usage() (Resources, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.used, b.running
+}
+
+// Total returns the budget's resources and slot count
+func (b *Budget) Total() (Resources, int) {
+	return b.total, b.slots
+}
+
+// JobDemand estimates the resources a job needs from its output resolution
+// and declared requirements
+func JobDemand(job *models.Job) Resources {
+	height := 1080
+	if profile := models.GetResolutionProfile(job.Config.Resolution); profile != nil {
+		height = profile.Height
+	}
+
+	var demand Resources
+	switch {
+	case height >= 2160:
+		demand = Resources{CPUs: 8, MemoryMB: 4096}
+	case height >= 1080:
+		demand = Resources{CPUs: 4, MemoryMB: 2048}
+	case height >= 720:
+		demand = Resources{CPUs: 2, MemoryMB: 1536}
+	default:
+		demand = Resources{CPUs: 1, MemoryMB: 1024}
+	}
+
+	// Hardware encodes need an encoder session but little CPU
+	if job.Requirements.GPU || job.Pool == models.WorkerPoolGPU {
+		demand.CPUs = 1
+		demand.GPUSessions = 1
+	}
+
+	if job.Requirements.MinCPUs > demand.CPUs {
+		demand.CPUs = job.Requirements.MinCPUs
+	}
+	if job.Requirements.MinMemoryMB > demand.MemoryMB {
+		demand.MemoryMB = job.Requirements.MinMemoryMB
+	}
+
+	return demand
+}
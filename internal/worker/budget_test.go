@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+func TestBudgetSlots(t *testing.T) {
+	b := NewBudget(Resources{CPUs: 16, MemoryMB: 16384}, 2)
+	demand := Resources{CPUs: 1, MemoryMB: 1024}
+
+	require.NoError(t, b.Acquire(context.Background(), demand))
+	require.NoError(t, b.Acquire(context.Background(), demand))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Error(t, b.Acquire(ctx, demand))
+
+	b.Release(demand)
+	require.NoError(t, b.Acquire(context.Background(), demand))
+
+	used, running := b.Usage()
+	assert.Equal(t, 2, running)
+	assert.Equal(t, Resources{CPUs: 2, MemoryMB: 2048}, used)
+}
+
+func TestBudgetResources(t *testing.T) {
+	b := NewBudget(Resources{CPUs: 8, MemoryMB: 8192}, 4)
+
+	require.NoError(t, b.Acquire(context.Background(), Resources{CPUs: 6, MemoryMB: 2048}))
+
+	acquired := make(chan struct{})
+	go func() {
+		b.Acquire(context.Background(), Resources{CPUs: 4, MemoryMB: 2048})
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquired beyond the CPU budget")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	b.Release(Resources{CPUs: 6, MemoryMB: 2048})
+
+	select {
+	case <-acquired:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for released capacity")
+	}
+}
+
+func TestBudgetClampsOversizedDemand(t *testing.T) {
+	b := NewBudget(Resources{CPUs: 2, MemoryMB: 1024}, 1)
+
+	// A job larger than the whole worker still runs, alone
+	require.NoError(t, b.Acquire(context.Background(), Resources{CPUs: 8, MemoryMB: 4096}))
+	used, _ := b.Usage()
+	assert.Equal(t, Resources{CPUs: 2, MemoryMB: 1024}, used)
+}
+
+func TestJobDemand(t *testing.T) {
+	tests := []struct {
+		name string
+		job  *models.Job
+		want Resources
+	}{
+		{"4k", &models.Job{Config: models.TranscodeConfig{Resolution: "2160p"}}, Resources{CPUs: 8, MemoryMB: 4096}},
+		{"720p", &models.Job{Config: models.TranscodeConfig{Resolution: "720p"}}, Resources{CPUs: 2, MemoryMB: 1536}},
+		{"360p", &models.Job{Config: models.TranscodeConfig{Resolution: "360p"}}, Resources{CPUs: 1, MemoryMB: 1024}},
+		{"gpu", &models.Job{Config: models.TranscodeConfig{Resolution: "1080p"}, Pool: models.WorkerPoolGPU}, Resources{CPUs: 1, MemoryMB: 2048, GPUSessions: 1}},
+		{"declared minimums", &models.Job{
+			Config:       models.TranscodeConfig{Resolution: "480p"},
+			Requirements: models.JobRequirements{MinCPUs: 4, MinMemoryMB: 3000},
+		}, Resources{CPUs: 4, MemoryMB: 3000}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, JobDemand(tt.job))
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// Registry stores worker heartbeats
+type Registry interface {
+	HeartbeatWorker(ctx context.Context, worker *models.Worker) error
+	DeleteWorker(ctx context.Context, id string) error
+}
+
+// Heartbeat keeps a worker registered with its current jobs and load, and
+// drains the runtime once the worker is marked draining
+type Heartbeat struct {
+	registry Registry
+	runtime  *Runtime
+	info     models.Worker
+	interval time.Duration
+}
+
+// NewHeartbeat creates a heartbeat for the worker described by info, sent
+// every interval
+func NewHeartbeat(registry Registry, rt *Runtime, info models.Worker, interval time.Duration) *Heartbeat {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	return &Heartbeat{
+		registry: registry,
+		runtime:  rt,
+		info:     info,
+		interval: interval,
+	}
+}
+
+// Run sends heartbeats until ctx is cancelled
+func (h *Heartbeat) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	h.beat(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.beat(ctx)
+		}
+	}
+}
+
+// beat publishes the worker's state and applies a drain requested through the registry
+func (h *Heartbeat) beat(ctx context.Context) {
+	worker := h.info
+	worker.CurrentJobs = h.runtime.Jobs()
+	worker.CPULoad = readCPULoad()
+
+	if err := h.registry.HeartbeatWorker(ctx, &worker); err != nil {
+		log.Printf("Failed to send worker heartbeat: %v", err)
+		return
+	}
+
+	if worker.Status == models.WorkerStatusDraining && !h.runtime.Draining() {
+		log.Printf("Worker %s marked draining", worker.ID)
+		h.runtime.Drain()
+	}
+}
+
+// Deregister removes the worker from the registry after a clean shutdown
+func (h *Heartbeat) Deregister(ctx context.Context) {
+	if err := h.registry.DeleteWorker(ctx, h.info.ID); err != nil {
+		log.Printf("Failed to deregister worker %s: %v", h.info.ID, err)
+	}
+}
+
+// readCPULoad returns the 1 minute load average per core, or 0 when unavailable
+func readCPULoad() float64 {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0
+	}
+
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+	return load / float64(runtime.NumCPU())
+}
@@ -0,0 +1,101 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/queue"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+type fakeRegistry struct {
+	mu      sync.Mutex
+	status  string
+	beats   []models.Worker
+	deleted bool
+}
+
+func (r *fakeRegistry) HeartbeatWorker(ctx context.Context, worker *models.Worker) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.status == "" {
+		r.status = models.WorkerStatusActive
+	}
+	worker.Status = r.status
+	r.beats = append(r.beats, *worker)
+	return nil
+}
+
+func (r *fakeRegistry) DeleteWorker(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deleted = true
+	return nil
+}
+
+func (r *fakeRegistry) setStatus(status string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.status = status
+}
+
+func (r *fakeRegistry) lastBeat() models.Worker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.beats[len(r.beats)-1]
+}
+
+func TestHeartbeatReportsJobsAndDrains(t *testing.T) {
+	q := queue.NewMemoryQueue()
+	require.NoError(t, q.PublishJob(context.Background(), smallJob("job-1")))
+
+	release := make(chan struct{})
+	process := func(ctx context.Context, job *models.Job) error {
+		<-release
+		return nil
+	}
+
+	budget := NewBudget(Resources{CPUs: 4, MemoryMB: 4096}, 2)
+	rt := NewRuntime(q, &fakeStore{}, process, budget, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rt.Run(ctx)
+
+	require.Eventually(t, func() bool { return len(rt.Jobs()) == 1 }, 2*time.Second, 10*time.Millisecond)
+
+	registry := &fakeRegistry{}
+	hb := NewHeartbeat(registry, rt, models.Worker{ID: "worker-1", Slots: 2}, time.Hour)
+
+	hb.beat(ctx)
+	beat := registry.lastBeat()
+	assert.Equal(t, "worker-1", beat.ID)
+	assert.Equal(t, []string{"job-1"}, beat.CurrentJobs)
+	assert.False(t, rt.Draining())
+
+	// Ops mark the worker draining; new jobs stay queued while the running one finishes
+	registry.setStatus(models.WorkerStatusDraining)
+	hb.beat(ctx)
+	assert.True(t, rt.Draining())
+
+	require.NoError(t, q.PublishJob(context.Background(), smallJob("job-2")))
+	close(release)
+
+	assert.Eventually(t, func() bool { return len(rt.Jobs()) == 0 }, 2*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+
+	depth, err := q.GetQueueDepth()
+	require.NoError(t, err)
+	assert.Equal(t, 1, depth)
+
+	hb.Deregister(context.Background())
+	assert.True(t, registry.deleted)
+}
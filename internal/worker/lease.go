@@ -0,0 +1,95 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// JobLeaser grants workers exclusive ownership of jobs. Each grant comes with
+// a fencing token that increases with every claim, so writes of a worker that
+// lost the job can be told apart from those of its new owner.
+type JobLeaser interface {
+	AcquireJobLease(ctx context.Context, jobID, workerID string, ttl time.Duration) (int64, bool, error)
+	RenewJobLease(ctx context.Context, jobID string, token int64, ttl time.Duration) (bool, error)
+	ReleaseJobLease(ctx context.Context, jobID string, token int64) error
+}
+
+// SetJobLeaser makes the runtime lease each job before running it, so a job
+// delivered twice, e.g. redelivered after a nack, runs on one worker at a
+// time. The lease is renewed while the job runs and the job is interrupted if
+// another worker takes it over.
+func (r *Runtime) SetJobLeaser(leaser JobLeaser, workerID string, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = 2 * time.Minute
+	}
+
+	r.leases = leaser
+	r.workerID = workerID
+	r.leaseTTL = ttl
+}
+
+// jobLease is a worker's hold on a running job
+type jobLease struct {
+	job    *models.Job
+	lost   atomic.Bool
+	cancel context.CancelFunc
+}
+
+// acquireLease leases a delivered job, setting its fencing token. It returns
+// false when another worker holds the job or the job has finished.
+func (r *Runtime) acquireLease(ctx context.Context, job *models.Job) (bool, error) {
+	token, ok, err := r.leases.AcquireJobLease(ctx, job.ID, r.workerID, r.leaseTTL)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	job.FencingToken = token
+	return true, nil
+}
+
+// keepLease renews a lease until ctx is done, cancelling the job once the
+// lease is lost
+func (r *Runtime) keepLease(ctx context.Context, lease *jobLease) {
+	ticker := time.NewTicker(r.leaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.renewLease(ctx, lease) {
+				return
+			}
+		}
+	}
+}
+
+// renewLease extends a lease, reporting false once it is lost. Failed renewals
+// are retried until the lease expires.
+func (r *Runtime) renewLease(ctx context.Context, lease *jobLease) bool {
+	if lease.lost.Load() {
+		return false
+	}
+
+	held, err := r.leases.RenewJobLease(ctx, lease.job.ID, lease.job.FencingToken, r.leaseTTL)
+	if err != nil {
+		log.Printf("Failed to renew lease of job %s: %v", lease.job.ID, err)
+		return true
+	}
+	if !held {
+		log.Printf("Lost lease of job %s to another worker, stopping it", lease.job.ID)
+		lease.lost.Store(true)
+		lease.cancel()
+	}
+	return held
+}
+
+// releaseLease hands a job interrupted by shutdown back for another worker
+func (r *Runtime) releaseLease(job *models.Job) error {
+	return r.leases.ReleaseJobLease(context.Background(), job.ID, job.FencingToken)
+}
@@ -0,0 +1,202 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/queue"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// fakeLeaser hands out leases like the jobs table: one owner per job, with a
+// token bumped on every claim
+type fakeLeaser struct {
+	mu       sync.Mutex
+	owners   map[string]string
+	tokens   map[string]int64
+	released map[string]bool
+}
+
+func newFakeLeaser() *fakeLeaser {
+	return &fakeLeaser{
+		owners:   make(map[string]string),
+		tokens:   make(map[string]int64),
+		released: make(map[string]bool),
+	}
+}
+
+func (l *fakeLeaser) AcquireJobLease(ctx context.Context, jobID, workerID string, ttl time.Duration) (int64, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if owner, ok := l.owners[jobID]; ok && owner != workerID {
+		return 0, false, nil
+	}
+	l.owners[jobID] = workerID
+	l.tokens[jobID]++
+	return l.tokens[jobID], true, nil
+}
+
+func (l *fakeLeaser) RenewJobLease(ctx context.Context, jobID string, token int64, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.tokens[jobID] == token, nil
+}
+
+func (l *fakeLeaser) ReleaseJobLease(ctx context.Context, jobID string, token int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.tokens[jobID] == token {
+		delete(l.owners, jobID)
+		l.released[jobID] = true
+	}
+	return nil
+}
+
+// steal hands a job over to another worker
+func (l *fakeLeaser) steal(jobID, workerID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.owners[jobID] = workerID
+	l.tokens[jobID]++
+}
+
+func (l *fakeLeaser) wasReleased(jobID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.released[jobID]
+}
+
+// runRuntime runs rt until the returned stop function is called
+func runRuntime(rt *Runtime) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	go func() {
+		rt.Run(ctx)
+		close(finished)
+	}()
+
+	return func() {
+		cancel()
+		<-finished
+	}
+}
+
+func TestRuntimeLeasesJobs(t *testing.T) {
+	q := queue.NewMemoryQueue()
+	require.NoError(t, q.PublishJob(context.Background(), smallJob("job-1")))
+
+	var token int64
+	var done int32
+	process := func(ctx context.Context, job *models.Job) error {
+		atomic.StoreInt64(&token, job.FencingToken)
+		atomic.StoreInt32(&done, 1)
+		return nil
+	}
+
+	leaser := newFakeLeaser()
+	rt := NewRuntime(q, &fakeStore{}, process, NewBudget(Resources{CPUs: 4, MemoryMB: 4096}, 1), time.Second)
+	rt.SetJobLeaser(leaser, "worker-1", time.Minute)
+	stop := runRuntime(rt)
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&done) == 1 }, 2*time.Second, 10*time.Millisecond)
+	stop()
+
+	assert.Equal(t, int64(1), atomic.LoadInt64(&token))
+}
+
+func TestRuntimeSkipsJobLeasedByAnotherWorker(t *testing.T) {
+	q := queue.NewMemoryQueue()
+	require.NoError(t, q.PublishJob(context.Background(), smallJob("job-1")))
+
+	var calls int32
+	process := func(ctx context.Context, job *models.Job) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}
+
+	leaser := newFakeLeaser()
+	leaser.steal("job-1", "worker-2")
+
+	rt := NewRuntime(q, &fakeStore{}, process, NewBudget(Resources{CPUs: 4, MemoryMB: 4096}, 1), time.Second)
+	rt.SetJobLeaser(leaser, "worker-1", time.Minute)
+	stop := runRuntime(rt)
+
+	// The duplicate delivery is acked without running the job
+	assert.Eventually(t, func() bool {
+		depth, err := q.GetQueueDepth()
+		return err == nil && depth == 0 && len(rt.Jobs()) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+	stop()
+
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+	assert.Empty(t, q.DeadLetters())
+}
+
+func TestRuntimeStopsJobWhenLeaseIsLost(t *testing.T) {
+	q := queue.NewMemoryQueue()
+	require.NoError(t, q.PublishJob(context.Background(), smallJob("job-1")))
+
+	leaser := newFakeLeaser()
+	started := make(chan struct{})
+	var interrupted int32
+	process := func(ctx context.Context, job *models.Job) error {
+		close(started)
+		<-ctx.Done()
+		atomic.StoreInt32(&interrupted, 1)
+		return ctx.Err()
+	}
+
+	rt := NewRuntime(q, &fakeStore{}, process, NewBudget(Resources{CPUs: 4, MemoryMB: 4096}, 1), time.Second)
+	rt.SetJobLeaser(leaser, "worker-1", 30*time.Millisecond)
+	stop := runRuntime(rt)
+
+	<-started
+	leaser.steal("job-1", "worker-2")
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&interrupted) == 1 && len(rt.Jobs()) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+	stop()
+
+	// The new owner settles the job: it is neither retried nor dead lettered
+	depth, err := q.GetQueueDepth()
+	require.NoError(t, err)
+	assert.Equal(t, 0, depth)
+	assert.Empty(t, q.DeadLetters())
+}
+
+func TestRuntimeReleasesLeaseOnShutdown(t *testing.T) {
+	q := queue.NewMemoryQueue()
+	require.NoError(t, q.PublishJob(context.Background(), smallJob("job-slow")))
+
+	started := make(chan struct{})
+	process := func(ctx context.Context, job *models.Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	leaser := newFakeLeaser()
+	rt := NewRuntime(q, &fakeStore{}, process, NewBudget(Resources{CPUs: 4, MemoryMB: 4096}, 1), 50*time.Millisecond)
+	rt.SetJobLeaser(leaser, "worker-1", time.Minute)
+	stop := runRuntime(rt)
+
+	<-started
+	stop()
+
+	assert.True(t, leaser.wasReleased("job-slow"))
+
+	depth, err := q.GetQueueDepth()
+	require.NoError(t, err)
+	assert.Equal(t, 1, depth)
+}
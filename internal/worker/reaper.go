@@ -0,0 +1,121 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/therealutkarshpriyadarshi/transcode/internal/queue"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// ReaperStore finds and recovers jobs abandoned by dead workers
+type ReaperStore interface {
+	ListOrphanedJobs(ctx context.Context, cutoff time.Time) ([]*models.Job, error)
+	RequeueOrphanedJob(ctx context.Context, jobID, workerID string) (bool, error)
+	FailOrphanedJob(ctx context.Context, jobID, workerID, reason string) (bool, error)
+	ListExpiredWorkers(ctx context.Context, cutoff time.Time) ([]string, error)
+	DeleteWorker(ctx context.Context, id string) error
+}
+
+// Reaper requeues, or fails once out of retries, the jobs left processing by
+// workers whose heartbeat expired. Every worker must send heartbeats: jobs of
+// an unregistered worker are reaped once they go ttl without an update.
+//
+// Requeueing only resets the job's state. The dead worker never acked the
+// job's message, so the broker delivers it again once the worker's connection
+// drops, and the next worker takes the job over through its lease.
+type Reaper struct {
+	store    ReaperStore
+	ttl      time.Duration
+	interval time.Duration
+}
+
+// NewReaper creates a reaper treating workers silent for ttl as dead
+func NewReaper(store ReaperStore, ttl time.Duration) *Reaper {
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+
+	return &Reaper{
+		store:    store,
+		ttl:      ttl,
+		interval: ttl / 2,
+	}
+}
+
+// Run reaps periodically until ctx is cancelled
+func (r *Reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Reap(ctx)
+		}
+	}
+}
+
+// Reap recovers the jobs of dead workers, then removes the dead workers from
+// the registry. Several reapers may run at once; each job is recovered by one.
+func (r *Reaper) Reap(ctx context.Context) {
+	cutoff := time.Now().Add(-r.ttl)
+
+	jobs, err := r.store.ListOrphanedJobs(ctx, cutoff)
+	if err != nil {
+		log.Printf("Failed to list orphaned jobs: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		if err := r.reapJob(ctx, job); err != nil {
+			log.Printf("Failed to reap job %s: %v", job.ID, err)
+		}
+	}
+
+	workerIDs, err := r.store.ListExpiredWorkers(ctx, cutoff)
+	if err != nil {
+		log.Printf("Failed to list expired workers: %v", err)
+		return
+	}
+
+	for _, workerID := range workerIDs {
+		if err := r.store.DeleteWorker(ctx, workerID); err != nil {
+			log.Printf("Failed to remove dead worker %s: %v", workerID, err)
+			continue
+		}
+		log.Printf("Removed worker %s after its heartbeat expired", workerID)
+	}
+}
+
+// reapJob requeues a job of a dead worker, or fails it when out of retries
+func (r *Reaper) reapJob(ctx context.Context, job *models.Job) error {
+	if job.RetryCount >= queue.MaxRetries {
+		reason := fmt.Sprintf("worker %s stopped responding and the job is out of retries", job.WorkerID)
+		failed, err := r.store.FailOrphanedJob(ctx, job.ID, job.WorkerID, reason)
+		if err != nil {
+			return err
+		}
+		if failed {
+			log.Printf("Failed job %s abandoned by worker %s", job.ID, job.WorkerID)
+		}
+		return nil
+	}
+
+	workerID := job.WorkerID
+	requeued, err := r.store.RequeueOrphanedJob(ctx, job.ID, workerID)
+	if err != nil {
+		return err
+	}
+	if !requeued {
+		// Picked up or finished meanwhile
+		return nil
+	}
+
+	log.Printf("Requeued job %s abandoned by worker %s (attempt %d)", job.ID, workerID, job.RetryCount+2)
+	return nil
+}
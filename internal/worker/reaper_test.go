@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/queue"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+type fakeReaperStore struct {
+	orphaned []*models.Job
+	expired  []string
+	status   map[string]string
+	deleted  []string
+}
+
+func (s *fakeReaperStore) ListOrphanedJobs(ctx context.Context, cutoff time.Time) ([]*models.Job, error) {
+	return s.orphaned, nil
+}
+
+func (s *fakeReaperStore) RequeueOrphanedJob(ctx context.Context, jobID, workerID string) (bool, error) {
+	if s.status[jobID] != models.JobStatusProcessing {
+		return false, nil
+	}
+	s.status[jobID] = models.JobStatusQueued
+	return true, nil
+}
+
+func (s *fakeReaperStore) FailOrphanedJob(ctx context.Context, jobID, workerID, reason string) (bool, error) {
+	if s.status[jobID] != models.JobStatusProcessing {
+		return false, nil
+	}
+	s.status[jobID] = models.JobStatusFailed
+	return true, nil
+}
+
+func (s *fakeReaperStore) ListExpiredWorkers(ctx context.Context, cutoff time.Time) ([]string, error) {
+	return s.expired, nil
+}
+
+func (s *fakeReaperStore) DeleteWorker(ctx context.Context, id string) error {
+	s.deleted = append(s.deleted, id)
+	return nil
+}
+
+func TestReaperRecoversOrphanedJobs(t *testing.T) {
+	store := &fakeReaperStore{
+		orphaned: []*models.Job{
+			{ID: "job-retry", WorkerID: "worker-dead", RetryCount: 1},
+			{ID: "job-exhausted", WorkerID: "worker-dead", RetryCount: queue.MaxRetries},
+			{ID: "job-finished", WorkerID: "worker-dead"},
+		},
+		expired: []string{"worker-dead"},
+		status: map[string]string{
+			"job-retry":     models.JobStatusProcessing,
+			"job-exhausted": models.JobStatusProcessing,
+			"job-finished":  models.JobStatusCompleted, // finished after being listed
+		},
+	}
+
+	NewReaper(store, time.Minute).Reap(context.Background())
+
+	assert.Equal(t, models.JobStatusQueued, store.status["job-retry"])
+	assert.Equal(t, models.JobStatusFailed, store.status["job-exhausted"])
+	assert.Equal(t, models.JobStatusCompleted, store.status["job-finished"])
+	assert.Equal(t, []string{"worker-dead"}, store.deleted)
+}
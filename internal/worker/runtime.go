@@ -0,0 +1,285 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/therealutkarshpriyadarshi/transcode/internal/queue"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+// Processor runs a job to completion
+type Processor func(ctx context.Context, job *models.Job) error
+
+// JobStore records job state changes made by the runtime
+type JobStore interface {
+	UpdateJobStatus(ctx context.Context, jobID, status string) error
+}
+
+// handBackDelay spaces out a job handed back by a worker that cannot run it,
+// so it does not bounce between such workers in a tight loop
+const handBackDelay = 10 * time.Second
+
+// Runtime runs jobs from a queue concurrently within a resource budget
+type Runtime struct {
+	queue           queue.JobQueue
+	store           JobStore
+	process         Processor
+	budget          *Budget
+	shutdownTimeout time.Duration
+
+	consumeCtx    context.Context
+	stopConsuming context.CancelFunc
+	jobCtx        context.Context
+	cancelJobs    context.CancelFunc
+	wg            sync.WaitGroup
+
+	mu       sync.Mutex
+	jobs     map[string]time.Time // running job ID -> start time
+	draining bool
+
+	// Optional job leases
+	leases   JobLeaser
+	workerID string
+	leaseTTL time.Duration
+
+	// Optional capabilities jobs are checked against
+	caps *models.WorkerCapabilities
+}
+
+// NewRuntime creates a worker runtime. In-flight jobs get shutdownTimeout to
+// finish once Run's context is cancelled before they are requeued.
+func NewRuntime(q queue.JobQueue, store JobStore, process Processor, budget *Budget, shutdownTimeout time.Duration) *Runtime {
+	jobCtx, cancelJobs := context.WithCancel(context.Background())
+
+	return &Runtime{
+		queue:           q,
+		store:           store,
+		process:         process,
+		budget:          budget,
+		shutdownTimeout: shutdownTimeout,
+		jobCtx:          jobCtx,
+		cancelJobs:      cancelJobs,
+		jobs:            make(map[string]time.Time),
+	}
+}
+
+// SetCapabilities makes the runtime hand back jobs whose requirements the
+// worker does not satisfy instead of running them. Call before Run.
+func (r *Runtime) SetCapabilities(caps *models.WorkerCapabilities) {
+	r.caps = caps
+}
+
+// Run consumes jobs until ctx is cancelled, then stops taking new jobs and
+// drains the in-flight ones
+func (r *Runtime) Run(ctx context.Context) error {
+	r.mu.Lock()
+	r.consumeCtx, r.stopConsuming = context.WithCancel(ctx)
+	consumeCtx := r.consumeCtx
+	if r.draining {
+		r.stopConsuming()
+	}
+	r.mu.Unlock()
+
+	if err := r.queue.Consume(consumeCtx, r.admit); err != nil {
+		return err
+	}
+
+	<-ctx.Done()
+	r.drain()
+	return nil
+}
+
+// Drain stops taking new jobs while in-flight ones run to completion. Run
+// keeps going until its context is cancelled.
+func (r *Runtime) Drain() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.draining {
+		return
+	}
+	r.draining = true
+	if r.stopConsuming != nil {
+		r.stopConsuming()
+	}
+
+	log.Printf("Draining worker, %d jobs in flight", len(r.jobs))
+}
+
+// Draining reports whether the runtime has stopped taking new jobs
+func (r *Runtime) Draining() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.draining
+}
+
+// Jobs returns the IDs of the running jobs, oldest first
+func (r *Runtime) Jobs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	jobIDs := make([]string, 0, len(r.jobs))
+	for jobID := range r.jobs {
+		jobIDs = append(jobIDs, jobID)
+	}
+	sort.Slice(jobIDs, func(i, j int) bool {
+		return r.jobs[jobIDs[i]].Before(r.jobs[jobIDs[j]])
+	})
+	return jobIDs
+}
+
+// admit waits for budget for a delivery and starts its job
+func (r *Runtime) admit(d *queue.Delivery) {
+	if r.caps != nil && !r.caps.Satisfies(d.Job.Requirements) {
+		r.handBack(d)
+		return
+	}
+
+	demand := r.budget.Clamp(JobDemand(d.Job))
+
+	if err := r.budget.Acquire(r.consumeCtx, demand); err != nil {
+		// Shutting down before the job could start
+		if nackErr := d.Nack(true); nackErr != nil {
+			log.Printf("Failed to requeue job %s: %v", d.Job.ID, nackErr)
+		}
+		return
+	}
+
+	r.mu.Lock()
+	r.jobs[d.Job.ID] = time.Now()
+	r.mu.Unlock()
+
+	r.wg.Add(1)
+	go r.run(d, demand)
+}
+
+// run processes a job and settles its delivery
+func (r *Runtime) run(d *queue.Delivery, demand Resources) {
+	defer r.wg.Done()
+	defer r.budget.Release(demand)
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.jobs, d.Job.ID)
+		r.mu.Unlock()
+	}()
+
+	ctx := r.jobCtx
+	var lease *jobLease
+	if r.leases != nil {
+		leased, err := r.acquireLease(ctx, d.Job)
+		if err != nil {
+			log.Printf("Failed to lease job %s: %v", d.Job.ID, err)
+			queue.Settle(context.Background(), r.queue, d, err)
+			return
+		}
+		if !leased {
+			// A redelivered job another worker runs or already finished
+			log.Printf("Skipping job %s: running on another worker or already finished", d.Job.ID)
+			if err := d.Ack(); err != nil {
+				log.Printf("Failed to ack job %s: %v", d.Job.ID, err)
+			}
+			return
+		}
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+
+		lease = &jobLease{job: d.Job, cancel: cancel}
+		go r.keepLease(ctx, lease)
+	}
+
+	_, running := r.budget.Usage()
+	log.Printf("Processing job %s for video %s (running: %d)", d.Job.ID, d.Job.VideoID, running)
+
+	err := r.process(ctx, d.Job)
+
+	if r.jobCtx.Err() != nil {
+		r.requeue(d)
+		return
+	}
+
+	// Fenced writes fail once the lease is lost; the new owner settles the job
+	if lease != nil && (lease.lost.Load() || (err != nil && !r.renewLease(context.Background(), lease))) {
+		log.Printf("Dropping attempt of job %s taken over by another worker", d.Job.ID)
+		if ackErr := d.Ack(); ackErr != nil {
+			log.Printf("Failed to ack job %s: %v", d.Job.ID, ackErr)
+		}
+		return
+	}
+
+	if err != nil {
+		log.Printf("Failed to process job %s: %v", d.Job.ID, err)
+	} else {
+		log.Printf("Successfully processed job %s", d.Job.ID)
+	}
+
+	queue.Settle(context.Background(), r.queue, d, err)
+}
+
+// handBack republishes a job this worker cannot run to the pool matching its
+// requirements. The job never ran here, so it keeps its retry count.
+func (r *Runtime) handBack(d *queue.Delivery) {
+	log.Printf("Handing back job %s: worker cannot satisfy requirements %+v", d.Job.ID, d.Job.Requirements)
+
+	d.Job.Pool = models.RouteJob(d.Job)
+	if err := r.queue.Retry(context.Background(), d.Job, d.RetryCount, handBackDelay); err != nil {
+		log.Printf("Failed to republish job %s: %v", d.Job.ID, err)
+		if nackErr := d.Nack(true); nackErr != nil {
+			log.Printf("Failed to requeue job %s: %v", d.Job.ID, nackErr)
+		}
+		return
+	}
+
+	if err := d.Ack(); err != nil {
+		log.Printf("Failed to ack job %s: %v", d.Job.ID, err)
+	}
+}
+
+// requeue hands a job interrupted by shutdown back to the queue
+func (r *Runtime) requeue(d *queue.Delivery) {
+	if d.Job.FencingToken != 0 && r.leases != nil {
+		if err := r.releaseLease(d.Job); err != nil {
+			log.Printf("Failed to release lease of job %s: %v", d.Job.ID, err)
+		}
+	} else if err := r.store.UpdateJobStatus(context.Background(), d.Job.ID, models.JobStatusQueued); err != nil {
+		log.Printf("Failed to reset status of job %s: %v", d.Job.ID, err)
+	}
+	if err := d.Nack(true); err != nil {
+		log.Printf("Failed to requeue job %s: %v", d.Job.ID, err)
+		return
+	}
+
+	log.Printf("Requeued job %s interrupted by shutdown", d.Job.ID)
+}
+
+// drain waits for in-flight jobs, interrupting and requeueing those still
+// running after the shutdown timeout
+func (r *Runtime) drain() {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	_, running := r.budget.Usage()
+	if running > 0 {
+		log.Printf("Waiting up to %v for %d in-flight jobs", r.shutdownTimeout, running)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(r.shutdownTimeout):
+		log.Println("Shutdown timeout reached, requeueing in-flight jobs")
+		r.cancelJobs()
+		<-done
+	}
+
+	r.cancelJobs()
+}
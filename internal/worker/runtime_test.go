@@ -0,0 +1,192 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/therealutkarshpriyadarshi/transcode/internal/queue"
+	"github.com/therealutkarshpriyadarshi/transcode/pkg/models"
+)
+
+type fakeStore struct {
+	mu       sync.Mutex
+	statuses map[string]string
+}
+
+func (s *fakeStore) UpdateJobStatus(ctx context.Context, jobID, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.statuses == nil {
+		s.statuses = make(map[string]string)
+	}
+	s.statuses[jobID] = status
+	return nil
+}
+
+func (s *fakeStore) status(jobID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.statuses[jobID]
+}
+
+func smallJob(id string) *models.Job {
+	return &models.Job{ID: id, Config: models.TranscodeConfig{Resolution: "360p"}}
+}
+
+func TestRuntimeBoundsConcurrency(t *testing.T) {
+	q := queue.NewMemoryQueue()
+	for _, id := range []string{"job-1", "job-2", "job-3", "job-4", "job-5"} {
+		require.NoError(t, q.PublishJob(context.Background(), smallJob(id)))
+	}
+
+	var running, peak, done int32
+	process := func(ctx context.Context, job *models.Job) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(30 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&done, 1)
+		return nil
+	}
+
+	budget := NewBudget(Resources{CPUs: 16, MemoryMB: 16384}, 2)
+	rt := NewRuntime(q, &fakeStore{}, process, budget, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	go func() {
+		rt.Run(ctx)
+		close(finished)
+	}()
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&done) == 5 }, 2*time.Second, 10*time.Millisecond)
+	cancel()
+	<-finished
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peak))
+
+	depth, err := q.GetQueueDepth()
+	require.NoError(t, err)
+	assert.Equal(t, 0, depth)
+}
+
+func TestRuntimeRequeuesOnShutdownTimeout(t *testing.T) {
+	q := queue.NewMemoryQueue()
+	require.NoError(t, q.PublishJob(context.Background(), smallJob("job-slow")))
+
+	started := make(chan struct{})
+	process := func(ctx context.Context, job *models.Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	store := &fakeStore{}
+	budget := NewBudget(Resources{CPUs: 4, MemoryMB: 4096}, 1)
+	rt := NewRuntime(q, store, process, budget, 50*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	go func() {
+		rt.Run(ctx)
+		close(finished)
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for job to start")
+	}
+	cancel()
+
+	select {
+	case <-finished:
+	case <-time.After(2 * time.Second):
+		t.Fatal("runtime did not drain")
+	}
+
+	assert.Equal(t, models.JobStatusQueued, store.status("job-slow"))
+	assert.Empty(t, q.DeadLetters())
+
+	depth, err := q.GetQueueDepth()
+	require.NoError(t, err)
+	assert.Equal(t, 1, depth)
+}
+
+// retryRecorder records the retries published to a MemoryQueue
+type retryRecorder struct {
+	*queue.MemoryQueue
+
+	mu      sync.Mutex
+	retries map[string]int
+	pools   map[string]string
+}
+
+func (q *retryRecorder) Retry(ctx context.Context, job *models.Job, retryCount int, delay time.Duration) error {
+	q.mu.Lock()
+	q.retries[job.ID] = retryCount
+	q.pools[job.ID] = job.Pool
+	q.mu.Unlock()
+
+	return q.MemoryQueue.Retry(ctx, job, retryCount, delay)
+}
+
+func (q *retryRecorder) retry(jobID string) (int, string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	count, ok := q.retries[jobID]
+	return count, q.pools[jobID], ok
+}
+
+func TestRuntimeHandsBackUnsatisfiableJobs(t *testing.T) {
+	q := &retryRecorder{MemoryQueue: queue.NewMemoryQueue(), retries: map[string]int{}, pools: map[string]string{}}
+	job := smallJob("job-gpu")
+	job.Requirements.GPU = true
+	require.NoError(t, q.MemoryQueue.Retry(context.Background(), job, 2, 0))
+
+	var processed int32
+	process := func(ctx context.Context, job *models.Job) error {
+		atomic.AddInt32(&processed, 1)
+		return nil
+	}
+
+	rt := NewRuntime(q, &fakeStore{}, process, NewBudget(Resources{CPUs: 16, MemoryMB: 16384}, 2), time.Second)
+	rt.SetCapabilities(&models.WorkerCapabilities{CPUs: 16, MemoryMB: 16384})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	go func() {
+		rt.Run(ctx)
+		close(finished)
+	}()
+
+	assert.Eventually(t, func() bool {
+		_, _, ok := q.retry("job-gpu")
+		return ok
+	}, 2*time.Second, 10*time.Millisecond)
+	cancel()
+	<-finished
+
+	// Republished to the GPU pool without using up a retry
+	retryCount, pool, _ := q.retry("job-gpu")
+	assert.Equal(t, 2, retryCount)
+	assert.Equal(t, models.WorkerPoolGPU, pool)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&processed))
+
+	depth, err := q.GetQueueDepth()
+	require.NoError(t, err)
+	assert.Equal(t, 1, depth)
+}
@@ -0,0 +1,3 @@
+-- Live stream ad cues rollback
+
+DROP TABLE IF EXISTS live_stream_cues;
@@ -0,0 +1,12 @@
+-- Live stream ad cues (SCTE-35)
+
+CREATE TABLE IF NOT EXISTS live_stream_cues (
+    id VARCHAR(36) PRIMARY KEY,
+    live_stream_id VARCHAR(36) NOT NULL REFERENCES live_streams(id) ON DELETE CASCADE,
+    event_id BIGSERIAL,
+    start_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    duration DOUBLE PRECISION NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_live_stream_cues_stream_start ON live_stream_cues(live_stream_id, start_time);
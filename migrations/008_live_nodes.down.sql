@@ -0,0 +1,4 @@
+-- Live node registry rollback
+
+DROP TABLE IF EXISTS live_stream_leases;
+DROP TABLE IF EXISTS live_nodes;
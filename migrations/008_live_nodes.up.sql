@@ -0,0 +1,26 @@
+-- Live node registry and live stream ownership leases
+
+CREATE TABLE IF NOT EXISTS live_nodes (
+    id VARCHAR(100) PRIMARY KEY,
+    host VARCHAR(255) NOT NULL,
+    rtmp_port INTEGER NOT NULL,
+    max_streams INTEGER NOT NULL,
+    active_streams INTEGER NOT NULL DEFAULT 0,
+    cpu_count INTEGER NOT NULL DEFAULT 1,
+    cpu_load DOUBLE PRECISION NOT NULL DEFAULT 0, -- load average per core
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    heartbeat_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_live_nodes_heartbeat_at ON live_nodes(heartbeat_at);
+
+CREATE TABLE IF NOT EXISTS live_stream_leases (
+    live_stream_id VARCHAR(36) PRIMARY KEY REFERENCES live_streams(id) ON DELETE CASCADE,
+    node_id VARCHAR(100) NOT NULL,
+    generation BIGINT NOT NULL DEFAULT 1, -- incremented whenever ownership changes hands
+    acquired_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_live_stream_leases_node_id ON live_stream_leases(node_id);
+CREATE INDEX IF NOT EXISTS idx_live_stream_leases_expires_at ON live_stream_leases(expires_at);
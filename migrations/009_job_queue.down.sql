@@ -0,0 +1,3 @@
+-- Postgres job queue backend rollback
+
+DROP TABLE IF EXISTS job_queue;
@@ -0,0 +1,17 @@
+-- Postgres job queue backend
+
+CREATE TABLE IF NOT EXISTS job_queue (
+    id BIGSERIAL PRIMARY KEY,
+    queue_name VARCHAR(100) NOT NULL,
+    job_id VARCHAR(36) NOT NULL,
+    payload JSONB NOT NULL,
+    priority INTEGER NOT NULL DEFAULT 0,
+    retry_count INTEGER NOT NULL DEFAULT 0,
+    failure_reason TEXT,
+    available_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMP WITH TIME ZONE, -- set while a consumer holds the message
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_queue_claim ON job_queue(queue_name, priority DESC, available_at, id);
+CREATE INDEX IF NOT EXISTS idx_job_queue_job_id ON job_queue(job_id);
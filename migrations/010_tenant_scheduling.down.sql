@@ -0,0 +1,6 @@
+-- Per-tenant scheduling limits rollback
+
+DROP INDEX IF EXISTS idx_jobs_user_id_status;
+
+ALTER TABLE users DROP COLUMN IF EXISTS scheduling_weight;
+ALTER TABLE users DROP COLUMN IF EXISTS max_concurrent_jobs;
@@ -0,0 +1,6 @@
+-- Per-tenant scheduling limits
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS max_concurrent_jobs INTEGER NOT NULL DEFAULT 0; -- 0 uses the scheduler default
+ALTER TABLE users ADD COLUMN IF NOT EXISTS scheduling_weight INTEGER NOT NULL DEFAULT 1;
+
+CREATE INDEX IF NOT EXISTS idx_jobs_user_id_status ON jobs(user_id, status);
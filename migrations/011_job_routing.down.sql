@@ -0,0 +1,7 @@
+-- Resource-aware job routing rollback
+
+DROP INDEX IF EXISTS idx_jobs_pool_status;
+
+ALTER TABLE jobs DROP COLUMN IF EXISTS pool;
+ALTER TABLE jobs DROP COLUMN IF EXISTS estimated_cost;
+ALTER TABLE jobs DROP COLUMN IF EXISTS requirements;
@@ -0,0 +1,7 @@
+-- Resource-aware job routing
+
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS requirements JSONB NOT NULL DEFAULT '{}'::jsonb;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS estimated_cost DOUBLE PRECISION NOT NULL DEFAULT 0; -- 1080p H.264 minutes
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS pool VARCHAR(20) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_jobs_pool_status ON jobs(pool, status);
@@ -0,0 +1,4 @@
+-- Transcode worker registry rollback
+
+DROP INDEX IF EXISTS idx_jobs_processing_worker;
+DROP TABLE IF EXISTS workers;
@@ -0,0 +1,20 @@
+-- Transcode worker registry
+
+CREATE TABLE IF NOT EXISTS workers (
+    id VARCHAR(100) PRIMARY KEY,
+    hostname VARCHAR(255) NOT NULL,
+    version VARCHAR(50) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    pools TEXT[] NOT NULL DEFAULT '{}',
+    slots INTEGER NOT NULL DEFAULT 1,
+    current_jobs TEXT[] NOT NULL DEFAULT '{}',
+    cpus INTEGER NOT NULL DEFAULT 0,
+    memory_mb INTEGER NOT NULL DEFAULT 0,
+    cpu_load DOUBLE PRECISION NOT NULL DEFAULT 0, -- load average per core
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    heartbeat_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_workers_heartbeat_at ON workers(heartbeat_at);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_processing_worker ON jobs(worker_id) WHERE status = 'processing';
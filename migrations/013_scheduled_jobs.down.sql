@@ -0,0 +1,7 @@
+-- Delayed, scheduled and recurring jobs rollback
+
+DROP TABLE IF EXISTS scheduler_leases;
+DROP TRIGGER IF EXISTS update_recurring_jobs_updated_at ON recurring_jobs;
+DROP TABLE IF EXISTS recurring_jobs;
+DROP INDEX IF EXISTS idx_jobs_pending_run_at;
+ALTER TABLE jobs DROP COLUMN IF EXISTS run_at;
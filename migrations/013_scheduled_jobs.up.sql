@@ -0,0 +1,37 @@
+-- Delayed, scheduled and recurring jobs
+
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS run_at TIMESTAMP WITH TIME ZONE; -- NULL runs as soon as possible
+
+CREATE INDEX IF NOT EXISTS idx_jobs_pending_run_at ON jobs(run_at) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS recurring_jobs (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) REFERENCES users(id) ON DELETE CASCADE,
+    video_id VARCHAR(36) NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    schedule VARCHAR(100) NOT NULL, -- cron expression
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    priority INTEGER NOT NULL DEFAULT 5,
+    config JSONB NOT NULL DEFAULT '{}'::jsonb,
+    requirements JSONB NOT NULL DEFAULT '{}'::jsonb,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    next_run_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_run_at TIMESTAMP WITH TIME ZONE,
+    last_job_id VARCHAR(36),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_recurring_jobs_next_run_at ON recurring_jobs(next_run_at) WHERE enabled;
+CREATE INDEX IF NOT EXISTS idx_recurring_jobs_user_id ON recurring_jobs(user_id);
+
+CREATE TRIGGER update_recurring_jobs_updated_at BEFORE UPDATE ON recurring_jobs
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Leader election among API replicas
+CREATE TABLE IF NOT EXISTS scheduler_leases (
+    name VARCHAR(100) PRIMARY KEY,
+    holder VARCHAR(255) NOT NULL,
+    acquired_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,8 @@
+-- Batch jobs and job dependencies rollback
+
+DROP INDEX IF EXISTS idx_jobs_pending_depends_on;
+DROP INDEX IF EXISTS idx_jobs_batch_id;
+ALTER TABLE jobs DROP COLUMN IF EXISTS depends_on;
+ALTER TABLE jobs DROP COLUMN IF EXISTS batch_id;
+DROP TRIGGER IF EXISTS update_batches_updated_at ON batches;
+DROP TABLE IF EXISTS batches;
@@ -0,0 +1,24 @@
+-- Batch jobs and job dependencies
+
+CREATE TABLE IF NOT EXISTS batches (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'processing', -- processing until every job has finished
+    total_jobs INTEGER NOT NULL DEFAULT 0,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_batches_user_id ON batches(user_id);
+CREATE INDEX IF NOT EXISTS idx_batches_open ON batches(created_at) WHERE status = 'processing';
+
+CREATE TRIGGER update_batches_updated_at BEFORE UPDATE ON batches
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS batch_id VARCHAR(36) REFERENCES batches(id) ON DELETE SET NULL;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS depends_on TEXT[] NOT NULL DEFAULT '{}'; -- jobs that must complete first
+
+CREATE INDEX IF NOT EXISTS idx_jobs_batch_id ON jobs(batch_id);
+CREATE INDEX IF NOT EXISTS idx_jobs_pending_depends_on ON jobs USING GIN (depends_on) WHERE status = 'pending';
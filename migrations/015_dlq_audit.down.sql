@@ -0,0 +1,3 @@
+-- Audit log of dead letter queue replays and purges rollback
+
+DROP TABLE IF EXISTS dlq_audit_log;
@@ -0,0 +1,15 @@
+-- Audit log of dead letter queue replays and purges
+
+CREATE TABLE IF NOT EXISTS dlq_audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    user_id VARCHAR(36) REFERENCES users(id) ON DELETE SET NULL,
+    action VARCHAR(20) NOT NULL, -- replay or purge
+    filter JSONB NOT NULL DEFAULT '{}'::jsonb,
+    config JSONB, -- config overrides applied to replayed jobs
+    job_ids TEXT[] NOT NULL DEFAULT '{}',
+    affected INTEGER NOT NULL DEFAULT 0,
+    skipped INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_dlq_audit_log_created_at ON dlq_audit_log(created_at DESC);
@@ -0,0 +1,12 @@
+-- Idempotent job submission, fenced job ownership and exactly-once side effects rollback
+
+DROP INDEX IF EXISTS idx_webhook_deliveries_idempotency_key;
+ALTER TABLE webhook_deliveries DROP COLUMN IF EXISTS idempotency_key;
+
+DROP INDEX IF EXISTS idx_outputs_job_rendition;
+ALTER TABLE outputs DROP COLUMN IF EXISTS rendition;
+
+ALTER TABLE jobs DROP COLUMN IF EXISTS lease_expires_at;
+ALTER TABLE jobs DROP COLUMN IF EXISTS fencing_token;
+
+DROP TABLE IF EXISTS idempotency_keys;
@@ -0,0 +1,34 @@
+-- Idempotent job submission, fenced job ownership and exactly-once side effects
+
+-- Responses of submit requests by Idempotency-Key, replayed to client retries
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    scope VARCHAR(100) NOT NULL, -- user or client IP the key belongs to
+    key VARCHAR(255) NOT NULL,
+    fingerprint VARCHAR(64) NOT NULL, -- SHA-256 of method, path and body
+    status_code INTEGER NOT NULL DEFAULT 0, -- 0 while the request is in flight
+    response BYTEA,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+
+-- Job leases: each claim by a worker bumps the fencing token, and writes made
+-- with an older token are rejected
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS fencing_token BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMP WITH TIME ZONE;
+
+-- One output per job and rendition; keep the newest of existing duplicates
+ALTER TABLE outputs ADD COLUMN IF NOT EXISTS rendition VARCHAR(100) NOT NULL DEFAULT '';
+UPDATE outputs SET rendition = COALESCE(resolution, '') || '/' || COALESCE(format, '') WHERE rendition = '';
+DELETE FROM outputs o
+USING outputs newer
+WHERE o.job_id = newer.job_id AND o.rendition = newer.rendition
+AND (o.created_at, o.id) < (newer.created_at, newer.id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_outputs_job_rendition ON outputs(job_id, rendition);
+
+-- One delivery per webhook and idempotency key
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS idempotency_key VARCHAR(255);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_deliveries_idempotency_key
+    ON webhook_deliveries(webhook_id, idempotency_key) WHERE idempotency_key IS NOT NULL;
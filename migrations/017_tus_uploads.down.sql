@@ -0,0 +1,3 @@
+-- Resumable uploads over the tus protocol rollback
+
+DROP TABLE IF EXISTS tus_uploads;
@@ -0,0 +1,23 @@
+-- Resumable uploads over the tus protocol
+
+-- Each PATCH is stored as a chunk object; chunks lists them in offset order
+-- and is appended to together with upload_offset, so concurrent PATCHes at the
+-- same offset cannot both be recorded
+CREATE TABLE IF NOT EXISTS tus_uploads (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) REFERENCES users(id) ON DELETE CASCADE,
+    upload_length BIGINT NOT NULL,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    metadata JSONB NOT NULL DEFAULT '{}'::jsonb, -- decoded Upload-Metadata
+    chunks JSONB NOT NULL DEFAULT '[]'::jsonb,
+    status VARCHAR(20) NOT NULL DEFAULT 'active', -- active, completed
+    video_id VARCHAR(36) NOT NULL, -- video created once the upload completes
+    storage_key TEXT NOT NULL, -- where the assembled upload is stored
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_tus_uploads_expires_at ON tus_uploads(expires_at);
+CREATE INDEX IF NOT EXISTS idx_tus_uploads_unfinished ON tus_uploads(status)
+    WHERE status = 'active';
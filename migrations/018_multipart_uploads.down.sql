@@ -0,0 +1,6 @@
+-- Multipart upload sessions shared by all API replicas rollback
+
+ALTER TABLE videos DROP COLUMN IF EXISTS checksum;
+
+DROP TABLE IF EXISTS multipart_upload_parts;
+DROP TABLE IF EXISTS multipart_uploads;
@@ -0,0 +1,36 @@
+-- Multipart upload sessions shared by all API replicas
+
+CREATE TABLE IF NOT EXISTS multipart_uploads (
+    id VARCHAR(36) PRIMARY KEY,
+    mode VARCHAR(20) NOT NULL, -- proxy, direct
+    filename VARCHAR(255) NOT NULL,
+    total_size BIGINT NOT NULL,
+    part_size BIGINT NOT NULL,
+    total_parts INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'active', -- active, completed
+    video_id VARCHAR(36) NOT NULL, -- video created once the upload completes
+    storage_key TEXT NOT NULL, -- where the assembled upload is stored
+    storage_upload_id TEXT NOT NULL DEFAULT '', -- multipart upload held by storage, direct uploads only
+    checksum VARCHAR(64) NOT NULL DEFAULT '', -- SHA-256 of the assembled upload
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_multipart_uploads_expires_at ON multipart_uploads(expires_at);
+
+-- Parts received through the API; each is stored as its own object until the
+-- upload is assembled
+CREATE TABLE IF NOT EXISTS multipart_upload_parts (
+    upload_id VARCHAR(36) NOT NULL REFERENCES multipart_uploads(id) ON DELETE CASCADE,
+    part_number INTEGER NOT NULL,
+    size BIGINT NOT NULL,
+    etag VARCHAR(32) NOT NULL, -- hex MD5
+    sha256 VARCHAR(64) NOT NULL, -- hex SHA-256
+    storage_key TEXT NOT NULL,
+    uploaded_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (upload_id, part_number)
+);
+
+-- SHA-256 of the original, known for videos assembled by the API
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS checksum VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Videos imported from URLs and watch folders by workers rollback
+
+DROP TABLE IF EXISTS imports;
@@ -0,0 +1,27 @@
+-- Videos imported from URLs and watch folders by workers
+
+CREATE TABLE IF NOT EXISTS imports (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) REFERENCES users(id) ON DELETE CASCADE,
+    source_url TEXT NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    expected_checksum VARCHAR(64) NOT NULL DEFAULT '',
+    priority INTEGER NOT NULL DEFAULT 0,
+    jobs JSONB NOT NULL DEFAULT '[]'::jsonb, -- transcode configs of the jobs to create
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, fetching, completed, failed
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error_msg TEXT NOT NULL DEFAULT '',
+    video_id VARCHAR(36) NOT NULL, -- video created once the import completes
+    size BIGINT NOT NULL DEFAULT 0,
+    checksum VARCHAR(64) NOT NULL DEFAULT '',
+    watch_key TEXT UNIQUE, -- watch folder file version, so each is imported once
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    lease_expires_at TIMESTAMP WITH TIME ZONE, -- while a worker fetches the import
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_imports_claimable ON imports(next_attempt_at)
+    WHERE status IN ('pending', 'fetching');
+CREATE INDEX IF NOT EXISTS idx_imports_user_id ON imports(user_id);
@@ -0,0 +1,6 @@
+-- Storage lifecycle policies and output storage tiers rollback
+
+DROP INDEX IF EXISTS idx_playback_events_output_id;
+DROP INDEX IF EXISTS idx_outputs_created_at;
+ALTER TABLE outputs DROP COLUMN IF EXISTS storage_tier;
+DROP TABLE IF EXISTS lifecycle_policies;
@@ -0,0 +1,16 @@
+-- Storage lifecycle policies and output storage tiers
+
+CREATE TABLE IF NOT EXISTS lifecycle_policies (
+    user_id VARCHAR(36) PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    -- NULL inherits the configured default, 0 disables the rule
+    delete_source_after_days INTEGER,
+    delete_unused_renditions_after_days INTEGER,
+    cold_storage_after_days INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE outputs ADD COLUMN IF NOT EXISTS storage_tier VARCHAR(10) NOT NULL DEFAULT 'hot'; -- hot or cold
+
+CREATE INDEX IF NOT EXISTS idx_outputs_created_at ON outputs(created_at);
+CREATE INDEX IF NOT EXISTS idx_playback_events_output_id ON playback_events(output_id, timestamp);
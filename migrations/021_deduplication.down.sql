@@ -0,0 +1,7 @@
+-- Deduplication of uploaded sources and reuse of outputs rollback
+
+DROP INDEX IF EXISTS idx_jobs_config_fingerprint;
+DROP INDEX IF EXISTS idx_videos_user_checksum;
+ALTER TABLE jobs DROP COLUMN IF EXISTS reused_from_job_id;
+ALTER TABLE jobs DROP COLUMN IF EXISTS config_fingerprint;
+ALTER TABLE videos DROP COLUMN IF EXISTS duplicate_of;
@@ -0,0 +1,10 @@
+-- Deduplication of uploaded sources and reuse of outputs
+
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS duplicate_of VARCHAR(36) REFERENCES videos(id) ON DELETE SET NULL;
+
+-- SHA-256 of the job's normalized transcode config
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS config_fingerprint VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS reused_from_job_id VARCHAR(36) REFERENCES jobs(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_videos_user_checksum ON videos(user_id, checksum) WHERE checksum <> '';
+CREATE INDEX IF NOT EXISTS idx_jobs_config_fingerprint ON jobs(config_fingerprint) WHERE status = 'completed';
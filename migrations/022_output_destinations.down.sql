@@ -0,0 +1,3 @@
+-- Output destinations rollback
+
+DROP TABLE IF EXISTS output_destinations;
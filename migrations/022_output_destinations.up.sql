@@ -0,0 +1,19 @@
+-- Output destinations: customer buckets and directories outputs are delivered to
+
+CREATE TABLE IF NOT EXISTS output_destinations (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    type VARCHAR(20) NOT NULL, -- s3 or local
+    endpoint VARCHAR(255) NOT NULL DEFAULT '',
+    region VARCHAR(100) NOT NULL DEFAULT '',
+    bucket VARCHAR(255) NOT NULL DEFAULT '',
+    use_ssl BOOLEAN NOT NULL DEFAULT TRUE,
+    path TEXT NOT NULL DEFAULT '',
+    key_template TEXT NOT NULL,
+    credentials BYTEA, -- AES-GCM sealed access keys
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_output_destinations_user_id ON output_destinations(user_id);
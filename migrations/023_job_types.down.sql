@@ -0,0 +1,5 @@
+-- Job types other than transcodes rollback
+
+DROP INDEX IF EXISTS idx_jobs_type;
+ALTER TABLE jobs DROP COLUMN IF EXISTS result;
+ALTER TABLE jobs DROP COLUMN IF EXISTS type;
@@ -0,0 +1,8 @@
+-- Job types other than transcodes, run by workers
+
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS type VARCHAR(32) NOT NULL DEFAULT 'transcode';
+
+-- What a job other than a transcode produced, e.g. detected scenes
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS result JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_jobs_type ON jobs(type) WHERE type <> 'transcode';
@@ -0,0 +1,3 @@
+-- User roles rollback
+
+ALTER TABLE users DROP COLUMN IF EXISTS role;
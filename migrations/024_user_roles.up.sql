@@ -0,0 +1,3 @@
+-- User roles; admin users manage the queue and workers
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'user';
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// Batch status constants
+const (
+	BatchStatusProcessing = "processing" // some jobs have not finished yet
+	BatchStatusCompleted  = "completed"  // every job completed
+	BatchStatusFailed     = "failed"     // every job finished, at least one did not complete
+)
+
+// Batch groups jobs submitted together, e.g. the episodes of a season, so they
+// can be tracked as one unit
+type Batch struct {
+	ID          string     `json:"id" db:"id"`
+	UserID      *string    `json:"user_id,omitempty" db:"user_id"`
+	Name        string     `json:"name" db:"name"`
+	Status      string     `json:"status" db:"status"`
+	TotalJobs   int        `json:"total_jobs" db:"total_jobs"`
+	CompletedAt *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+
+	// Aggregated from the batch's jobs
+	Counts   BatchCounts `json:"counts" db:"-"`
+	Progress float64     `json:"progress" db:"-"` // percent, finished jobs count as done
+}
+
+// BatchCounts is the number of jobs of a batch in each status
+type BatchCounts struct {
+	Pending    int `json:"pending"`
+	Queued     int `json:"queued"`
+	Processing int `json:"processing"`
+	Completed  int `json:"completed"`
+	Failed     int `json:"failed"`
+	Cancelled  int `json:"cancelled"`
+}
+
+// Finished returns the number of jobs that reached a final status
+func (c BatchCounts) Finished() int {
+	return c.Completed + c.Failed + c.Cancelled
+}
+
+// FinalStatus returns the status the batch ends with once all its jobs finished
+func (b *Batch) FinalStatus() string {
+	if b.Counts.Failed > 0 || b.Counts.Cancelled > 0 {
+		return BatchStatusFailed
+	}
+	return BatchStatusCompleted
+}
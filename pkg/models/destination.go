@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// OutputDestination is a customer's bucket or directory outputs are
+// delivered to, referenced by ID from TranscodeConfig.Destinations
+type OutputDestination struct {
+	ID     string `json:"id" db:"id"`
+	UserID string `json:"user_id" db:"user_id"`
+	Name   string `json:"name" db:"name"`
+	Type   string `json:"type" db:"type"`
+
+	// S3 compatible bucket
+	Endpoint string `json:"endpoint,omitempty" db:"endpoint"`
+	Region   string `json:"region,omitempty" db:"region"`
+	Bucket   string `json:"bucket,omitempty" db:"bucket"`
+	UseSSL   bool   `json:"use_ssl" db:"use_ssl"`
+
+	// Path is the directory of a local destination
+	Path string `json:"path,omitempty" db:"path"`
+
+	// KeyTemplate names delivered files, e.g. "{title}/{resolution}/{segment}"
+	KeyTemplate string `json:"key_template" db:"key_template"`
+
+	// Credentials are the sealed DestinationCredentials, never returned
+	Credentials []byte `json:"-" db:"credentials"`
+
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// DestinationCredentials authenticate to an S3 compatible destination
+type DestinationCredentials struct {
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+}
+
+// OutputDestination type constants
+const (
+	DestinationTypeS3    = "s3"
+	DestinationTypeLocal = "local"
+)
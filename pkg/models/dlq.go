@@ -0,0 +1,25 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Dead letter queue admin actions
+const (
+	DLQActionReplay = "replay"
+	DLQActionPurge  = "purge"
+)
+
+// DLQAuditEntry records an admin action on the dead letter queue
+type DLQAuditEntry struct {
+	ID        int64            `json:"id" db:"id"`
+	UserID    *string          `json:"user_id,omitempty" db:"user_id"`
+	Action    string           `json:"action" db:"action"`
+	Filter    json.RawMessage  `json:"filter" db:"filter"`
+	Config    *TranscodeConfig `json:"config,omitempty" db:"config"` // overrides applied on replay
+	JobIDs    []string         `json:"job_ids" db:"job_ids"`
+	Affected  int              `json:"affected" db:"affected"`
+	Skipped   int              `json:"skipped" db:"skipped"`
+	CreatedAt time.Time        `json:"created_at" db:"created_at"`
+}
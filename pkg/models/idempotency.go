@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// IdempotencyRecord is the response to a request made with an Idempotency-Key
+// header, replayed when the client retries the request
+type IdempotencyRecord struct {
+	Scope       string    `json:"scope" db:"scope"` // user or client the key belongs to
+	Key         string    `json:"key" db:"key"`
+	Fingerprint string    `json:"fingerprint" db:"fingerprint"` // hash of the request
+	StatusCode  int       `json:"status_code" db:"status_code"` // 0 while in flight
+	Response    []byte    `json:"response" db:"response"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at" db:"expires_at"`
+}
+
+// Completed reports whether the response has been recorded
+func (r *IdempotencyRecord) Completed() bool {
+	return r.StatusCode != 0
+}
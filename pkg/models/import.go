@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// Import is a video fetched from a URL by a worker, submitted through the API
+// or found in a watch folder
+type Import struct {
+	ID               string            `json:"id" db:"id"`
+	UserID           *string           `json:"user_id,omitempty" db:"user_id"`
+	SourceURL        string            `json:"source_url" db:"source_url"` // http(s)://, s3:// or, for watch folders, file://
+	Filename         string            `json:"filename" db:"filename"`
+	ExpectedChecksum string            `json:"expected_checksum,omitempty" db:"expected_checksum"` // hex SHA-256 the file must match
+	Priority         int               `json:"priority" db:"priority"`
+	Jobs             []TranscodeConfig `json:"jobs" db:"jobs"` // jobs created once the video is imported
+	Status           string            `json:"status" db:"status"`
+	Attempts         int               `json:"attempts" db:"attempts"`
+	ErrorMsg         string            `json:"error_msg,omitempty" db:"error_msg"`
+	VideoID          string            `json:"video_id" db:"video_id"`
+	Size             int64             `json:"size" db:"size"`
+	Checksum         string            `json:"checksum,omitempty" db:"checksum"`
+	WatchKey         *string           `json:"-" db:"watch_key"` // identifies the watch folder file version imported
+	NextAttemptAt    time.Time         `json:"next_attempt_at" db:"next_attempt_at"`
+	CreatedAt        time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time         `json:"updated_at" db:"updated_at"`
+	CompletedAt      *time.Time        `json:"completed_at,omitempty" db:"completed_at"`
+}
+
+// Import status constants
+const (
+	ImportStatusPending   = "pending"
+	ImportStatusFetching  = "fetching"
+	ImportStatusCompleted = "completed"
+	ImportStatusFailed    = "failed"
+)
+
+// NewJobs creates the import's pending jobs for its video
+func (i *Import) NewJobs(video *Video) []*Job {
+	jobs := make([]*Job, len(i.Jobs))
+	for n, config := range i.Jobs {
+		jobs[n] = &Job{
+			VideoID:  i.VideoID,
+			UserID:   i.UserID,
+			Status:   JobStatusPending,
+			Priority: i.Priority,
+			Config:   config,
+		}
+		if jobs[n].Priority == 0 {
+			jobs[n].Priority = JobPriorityNormal
+		}
+		jobs[n].PrepareRouting(video)
+	}
+	return jobs
+}
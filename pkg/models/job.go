@@ -1,15 +1,22 @@
 package models
 
 import (
+	"crypto/sha256"
 	"database/sql/driver"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
 // Job represents a transcoding job
 type Job struct {
 	ID          string        `json:"id" db:"id"`
+	Type        string        `json:"type" db:"type"`
 	VideoID     string        `json:"video_id" db:"video_id"`
+	UserID      *string       `json:"user_id,omitempty" db:"user_id"`
 	Status      string        `json:"status" db:"status"`
 	Priority    int           `json:"priority" db:"priority"`
 	Progress    float64       `json:"progress" db:"progress"`
@@ -21,6 +28,44 @@ type Job struct {
 	CreatedAt   time.Time     `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time     `json:"updated_at" db:"updated_at"`
 	Config      TranscodeConfig `json:"config" db:"config"`
+
+	// Routing
+	Requirements  JobRequirements `json:"requirements" db:"requirements"`
+	EstimatedCost float64         `json:"estimated_cost" db:"estimated_cost"`
+	Pool          string          `json:"pool,omitempty" db:"pool"`
+
+	// RunAt holds the job until the given time; nil runs it as soon as possible
+	RunAt *time.Time `json:"run_at,omitempty" db:"run_at"`
+
+	// Batching
+	BatchID   *string  `json:"batch_id,omitempty" db:"batch_id"`
+	DependsOn []string `json:"depends_on,omitempty" db:"depends_on"` // jobs that must complete first
+
+	// ReusedFromJobID is the earlier job whose outputs were copied instead of
+	// transcoding the same source with the same config again
+	ReusedFromJobID *string `json:"reused_from_job_id,omitempty" db:"reused_from_job_id"`
+
+	// Result is what a job other than a transcode produced, e.g. the scenes
+	// a scene detection found
+	Result json.RawMessage `json:"result,omitempty" db:"result"`
+
+	// FencingToken is set while a worker holds the job's lease; writes made
+	// with it are rejected once another worker has claimed the job
+	FencingToken int64 `json:"-" db:"fencing_token"`
+}
+
+// Due reports whether the job may run at now
+func (j *Job) Due(now time.Time) bool {
+	return j.RunAt == nil || !j.RunAt.After(now)
+}
+
+// Finished reports whether the job has reached a final status
+func (j *Job) Finished() bool {
+	switch j.Status {
+	case JobStatusCompleted, JobStatusFailed, JobStatusCancelled:
+		return true
+	}
+	return false
 }
 
 // TranscodeConfig holds transcoding configuration for a job
@@ -33,6 +78,120 @@ type TranscodeConfig struct {
 	AudioCodec   string              `json:"audio_codec"`
 	AudioBitrate int                 `json:"audio_bitrate"`
 	Extra        map[string]string   `json:"extra,omitempty"`
+	CuePoints    []CuePoint          `json:"cue_points,omitempty"`
+	Destinations []string            `json:"destinations,omitempty"` // IDs of output destinations outputs are also delivered to
+
+	// Parameters of the job types other than transcode
+	SceneDetection *SceneDetectionParams `json:"scene_detection,omitempty"`
+	Watermark      *WatermarkParams      `json:"watermark,omitempty"`
+	Concatenation  *ConcatenationParams  `json:"concatenation,omitempty"`
+	LiveClip       *LiveClipParams       `json:"live_clip,omitempty"`
+}
+
+// CuePoint marks an ad break in a VOD output
+type CuePoint struct {
+	Offset   float64 `json:"offset"`   // seconds from the start of the video
+	Duration float64 `json:"duration"` // length of the ad break in seconds
+}
+
+// ValidateCuePoints checks that ad breaks have a positive duration and do not overlap
+func ValidateCuePoints(cues []CuePoint) error {
+	sorted := make([]CuePoint, len(cues))
+	copy(sorted, cues)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Offset < sorted[j].Offset })
+
+	for i, cue := range sorted {
+		if cue.Offset < 0 {
+			return fmt.Errorf("cue point offset must not be negative")
+		}
+		if cue.Duration <= 0 {
+			return fmt.Errorf("cue point duration must be positive")
+		}
+		if i > 0 && cue.Offset < sorted[i-1].Offset+sorted[i-1].Duration {
+			return fmt.Errorf("cue point at %.3fs overlaps the previous ad break", cue.Offset)
+		}
+	}
+
+	return nil
+}
+
+// Merge returns the config with the non-zero fields of override applied
+func (tc TranscodeConfig) Merge(override TranscodeConfig) TranscodeConfig {
+	if override.OutputFormat != "" {
+		tc.OutputFormat = override.OutputFormat
+	}
+	if override.Resolution != "" {
+		tc.Resolution = override.Resolution
+	}
+	if override.Bitrate != 0 {
+		tc.Bitrate = override.Bitrate
+	}
+	if override.Codec != "" {
+		tc.Codec = override.Codec
+	}
+	if override.Preset != "" {
+		tc.Preset = override.Preset
+	}
+	if override.AudioCodec != "" {
+		tc.AudioCodec = override.AudioCodec
+	}
+	if override.AudioBitrate != 0 {
+		tc.AudioBitrate = override.AudioBitrate
+	}
+	if len(override.Extra) > 0 {
+		extra := make(map[string]string, len(tc.Extra)+len(override.Extra))
+		for k, v := range tc.Extra {
+			extra[k] = v
+		}
+		for k, v := range override.Extra {
+			extra[k] = v
+		}
+		tc.Extra = extra
+	}
+	if override.CuePoints != nil {
+		tc.CuePoints = override.CuePoints
+	}
+	if override.Destinations != nil {
+		tc.Destinations = override.Destinations
+	}
+	return tc
+}
+
+// Normalize returns the config with the defaults the transcoder applies
+// filled in and values spelled in one way, so configs producing the same
+// output compare equal
+func (tc TranscodeConfig) Normalize() TranscodeConfig {
+	tc.OutputFormat = strings.ToLower(strings.TrimSpace(tc.OutputFormat))
+	if tc.OutputFormat == "" {
+		tc.OutputFormat = "mp4"
+	}
+	tc.Resolution = strings.ToLower(strings.TrimSpace(tc.Resolution))
+	tc.Codec = strings.ToLower(strings.TrimSpace(tc.Codec))
+	tc.Preset = strings.ToLower(strings.TrimSpace(tc.Preset))
+	tc.AudioCodec = strings.ToLower(strings.TrimSpace(tc.AudioCodec))
+	if len(tc.Extra) == 0 {
+		tc.Extra = nil
+	}
+	if len(tc.CuePoints) == 0 {
+		tc.CuePoints = nil
+	} else {
+		cues := make([]CuePoint, len(tc.CuePoints))
+		copy(cues, tc.CuePoints)
+		sort.Slice(cues, func(i, j int) bool { return cues[i].Offset < cues[j].Offset })
+		tc.CuePoints = cues
+	}
+	// Where outputs are delivered does not change them
+	tc.Destinations = nil
+	return tc
+}
+
+// Fingerprint returns the hex SHA-256 of the normalized config. Jobs with the
+// same fingerprint transcode a source into the same outputs.
+func (tc TranscodeConfig) Fingerprint() string {
+	// Maps are marshaled with sorted keys, so the encoding is stable
+	data, _ := json.Marshal(tc.Normalize())
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
 
 // Value implements driver.Valuer for database storage
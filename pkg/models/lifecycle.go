@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// LifecyclePolicy holds a tenant's storage lifecycle rules. A nil rule
+// inherits the configured default and a rule of 0 days is disabled.
+type LifecyclePolicy struct {
+	UserID string `json:"user_id,omitempty" db:"user_id"`
+
+	// DeleteSourceAfterDays deletes the original upload this many days after
+	// the video was created, once it has no unfinished jobs
+	DeleteSourceAfterDays *int `json:"delete_source_after_days" db:"delete_source_after_days"`
+
+	// DeleteUnusedRenditionsAfterDays deletes outputs that were not played
+	// for this many days
+	DeleteUnusedRenditionsAfterDays *int `json:"delete_unused_renditions_after_days" db:"delete_unused_renditions_after_days"`
+
+	// ColdStorageAfterDays moves outputs that were not played for this many
+	// days to cold storage
+	ColdStorageAfterDays *int `json:"cold_storage_after_days" db:"cold_storage_after_days"`
+
+	CreatedAt time.Time `json:"created_at,omitempty" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+// VideoObjects are the storage keys the rows of a video reference, by tier
+type VideoObjects struct {
+	Hot  map[string]bool
+	Cold map[string]bool
+}
+
+// LifecycleAction constants
+const (
+	LifecycleActionDeleteSource    = "delete_source"
+	LifecycleActionDeleteRendition = "delete_rendition"
+	LifecycleActionMoveToCold      = "move_to_cold"
+	LifecycleActionDeleteOrphan    = "delete_orphan"
+)
+
+// LifecycleAction is an object a lifecycle run deleted or moved, or would
+// have in a dry run
+type LifecycleAction struct {
+	Action   string `json:"action"`
+	Tier     string `json:"tier"` // storage tier holding the object
+	Key      string `json:"key"`
+	VideoID  string `json:"video_id,omitempty"`
+	OutputID string `json:"output_id,omitempty"`
+	Size     int64  `json:"size"`
+	Reason   string `json:"reason,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// LifecycleReport summarizes a lifecycle run
+type LifecycleReport struct {
+	DryRun      bool              `json:"dry_run"`
+	StartedAt   time.Time         `json:"started_at"`
+	FinishedAt  time.Time         `json:"finished_at"`
+	Counts      map[string]int    `json:"counts"`       // actions by type
+	Bytes       map[string]int64  `json:"bytes"`        // bytes deleted or moved by action type
+	Actions     []LifecycleAction `json:"actions"`      // up to the report limit
+	Truncated   bool              `json:"truncated"`    // whether actions were left out
+	Errors      int               `json:"errors"`       // actions that failed
+	ObjectsSeen int               `json:"objects_seen"` // objects the garbage collector listed
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -50,6 +51,15 @@ type LiveStreamSettings struct {
 	// Advanced settings
 	KeyframeInterval  int  `json:"keyframe_interval"` // in seconds
 	GPUAcceleration   bool `json:"gpu_acceleration"`
+
+	// Ingest redundancy settings
+	BackupIngestURL   string `json:"backup_ingest_url,omitempty"` // used when the primary ingest drops
+	SlateImage        string `json:"slate_image,omitempty"`       // shown when both ingests drop
+
+	// ReconnectGracePeriod is how long, in seconds, the stream stays up on the
+	// slate waiting for the publisher to reconnect. 0 ends the stream as soon
+	// as all ingests are lost.
+	ReconnectGracePeriod int `json:"reconnect_grace_period"`
 }
 
 // Value implements driver.Valuer for database storage
@@ -167,6 +177,16 @@ const (
 	LiveStreamEventFrameDrop          = "frame_drop"
 	LiveStreamEventBitrateChange      = "bitrate_change"
 	LiveStreamEventError              = "error"
+	LiveStreamEventIngestSwitched     = "ingest_switched"
+	LiveStreamEventAVDesync           = "av_desync"
+	LiveStreamEventNodeFailover       = "node_failover"
+)
+
+// IngestSource constants identify which input feeds a live transcode
+const (
+	IngestSourcePrimary = "primary"
+	IngestSourceBackup  = "backup"
+	IngestSourceSlate   = "slate"
 )
 
 // EventSeverity constants
@@ -177,6 +197,54 @@ const (
 	SeverityCritical = "critical"
 )
 
+// LiveStreamCue represents an ad break signalled on a live stream with SCTE-35 markers
+type LiveStreamCue struct {
+	ID           string    `json:"id" db:"id"`
+	LiveStreamID string    `json:"live_stream_id" db:"live_stream_id"`
+	EventID      int64     `json:"event_id" db:"event_id"`     // SCTE-35 splice_event_id
+	StartTime    time.Time `json:"start_time" db:"start_time"` // wall-clock splice time
+	Duration     float64   `json:"duration" db:"duration"`     // in seconds
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// LiveStreamClip is a VOD clip cut from a running live stream
+type LiveStreamClip struct {
+	LiveStreamID string     `json:"live_stream_id"`
+	JobID        string     `json:"job_id"`
+	Video        *Video     `json:"video"`
+	Outputs      []*Output  `json:"outputs,omitempty"`
+	Thumbnail    *Thumbnail `json:"thumbnail,omitempty"`
+	StartTime    time.Time  `json:"start_time"` // wall-clock time of the first frame, zero when unknown
+	Duration     float64    `json:"duration"`   // in seconds
+}
+
+// LiveNode is a live ingest/transcode node taking part in stream placement
+type LiveNode struct {
+	ID            string    `json:"id" db:"id"`
+	Host          string    `json:"host" db:"host"` // host publishers are redirected to
+	RTMPPort      int       `json:"rtmp_port" db:"rtmp_port"`
+	MaxStreams    int       `json:"max_streams" db:"max_streams"`
+	ActiveStreams int       `json:"active_streams" db:"active_streams"`
+	CPUCount      int       `json:"cpu_count" db:"cpu_count"`
+	CPULoad       float64   `json:"cpu_load" db:"cpu_load"` // load average per core
+	StartedAt     time.Time `json:"started_at" db:"started_at"`
+	HeartbeatAt   time.Time `json:"heartbeat_at" db:"heartbeat_at"`
+}
+
+// IngestURL returns the RTMP URL publishers use to reach the node
+func (n *LiveNode) IngestURL(streamKey string) string {
+	return fmt.Sprintf("rtmp://%s:%d/live/%s", n.Host, n.RTMPPort, streamKey)
+}
+
+// LiveStreamLease records which live node owns a stream until the lease expires
+type LiveStreamLease struct {
+	LiveStreamID string    `json:"live_stream_id" db:"live_stream_id"`
+	NodeID       string    `json:"node_id" db:"node_id"`
+	Generation   int64     `json:"generation" db:"generation"`
+	AcquiredAt   time.Time `json:"acquired_at" db:"acquired_at"`
+	ExpiresAt    time.Time `json:"expires_at" db:"expires_at"`
+}
+
 // LiveStreamViewer represents a viewer watching a live stream
 type LiveStreamViewer struct {
 	ID            string    `json:"id" db:"id"`
@@ -198,15 +266,16 @@ type LiveStreamViewer struct {
 // DefaultLiveStreamSettings returns default settings for a live stream
 func DefaultLiveStreamSettings() LiveStreamSettings {
 	return LiveStreamSettings{
-		EnableTranscoding: true,
-		Resolutions:       []string{"1080p", "720p", "480p", "360p"},
-		Codec:             "h264",
-		SegmentDuration:   6,
-		PlaylistLength:    10,
-		PartDuration:      0.5, // for LL-HLS
-		AudioCodec:        "aac",
-		AudioBitrate:      128,
-		KeyframeInterval:  2,
-		GPUAcceleration:   true,
+		EnableTranscoding:    true,
+		Resolutions:          []string{"1080p", "720p", "480p", "360p"},
+		Codec:                "h264",
+		SegmentDuration:      6,
+		PlaylistLength:       10,
+		PartDuration:         0.5, // for LL-HLS
+		AudioCodec:           "aac",
+		AudioBitrate:         128,
+		KeyframeInterval:     2,
+		GPUAcceleration:      true,
+		ReconnectGracePeriod: 30,
 	}
 }
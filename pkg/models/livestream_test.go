@@ -58,6 +58,7 @@ func TestDefaultLiveStreamSettings(t *testing.T) {
 	assert.Equal(t, 128, settings.AudioBitrate)
 	assert.Equal(t, 2, settings.KeyframeInterval)
 	assert.True(t, settings.GPUAcceleration)
+	assert.Equal(t, 30, settings.ReconnectGracePeriod)
 }
 
 func TestLiveStreamStatus(t *testing.T) {
@@ -79,6 +79,34 @@ func TestTranscodeConfigValue(t *testing.T) {
 	}
 }
 
+func TestTranscodeConfigFingerprint(t *testing.T) {
+	config := TranscodeConfig{
+		Resolution: "720p",
+		Codec:      "h264",
+		CuePoints:  []CuePoint{{Offset: 30, Duration: 5}, {Offset: 10, Duration: 5}},
+	}
+	same := TranscodeConfig{
+		OutputFormat: "MP4",
+		Resolution:   "720P",
+		Codec:        " h264",
+		Extra:        map[string]string{},
+		CuePoints:    []CuePoint{{Offset: 10, Duration: 5}, {Offset: 30, Duration: 5}},
+	}
+
+	if config.Fingerprint() != same.Fingerprint() {
+		t.Errorf("Expected equivalent configs to have the same fingerprint")
+	}
+	if config.CuePoints[0].Offset != 30 {
+		t.Errorf("Expected Normalize to leave the config's cue points unsorted")
+	}
+
+	other := config
+	other.Bitrate = 2500000
+	if config.Fingerprint() == other.Fingerprint() {
+		t.Errorf("Expected different configs to have different fingerprints")
+	}
+}
+
 func TestJobStatusConstants(t *testing.T) {
 	statuses := []string{
 		JobStatusPending,
@@ -110,3 +138,229 @@ func TestVideoStatusConstants(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateCuePoints(t *testing.T) {
+	tests := []struct {
+		name    string
+		cues    []CuePoint
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"valid", []CuePoint{{Offset: 60, Duration: 30}, {Offset: 0, Duration: 15}}, false},
+		{"adjacent", []CuePoint{{Offset: 0, Duration: 30}, {Offset: 30, Duration: 30}}, false},
+		{"negative offset", []CuePoint{{Offset: -1, Duration: 30}}, true},
+		{"zero duration", []CuePoint{{Offset: 10, Duration: 0}}, true},
+		{"overlapping", []CuePoint{{Offset: 10, Duration: 30}, {Offset: 20, Duration: 5}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCuePoints(tt.cues)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCuePoints() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEstimateJobCost(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration float64
+		height   int
+		codec    string
+		want     float64
+	}{
+		{"1080p h264 minute", 60, 1080, "h264", 1},
+		{"4k hevc minute", 60, 2160, "hevc", 10},
+		{"720p default codec", 120, 720, "", 2 * 0.444},
+		{"unknown duration", 0, 1080, "h264", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EstimateJobCost(tt.duration, tt.height, tt.codec)
+			if got < tt.want-0.01 || got > tt.want+0.01 {
+				t.Errorf("EstimateJobCost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrepareRouting(t *testing.T) {
+	video := &Video{Duration: 600, Height: 2160}
+
+	tests := []struct {
+		name         string
+		job          Job
+		wantPool     string
+		wantEncoders []string
+	}{
+		{"long 4k hevc", Job{Config: TranscodeConfig{Resolution: "2160p", Codec: "hevc"}}, WorkerPoolCPU, []string{"libx265"}},
+		{"declared gpu", Job{Config: TranscodeConfig{Resolution: "1080p", Codec: "h264"}, Requirements: JobRequirements{GPU: true}}, WorkerPoolGPU, nil},
+		{"small preview", Job{Config: TranscodeConfig{Resolution: "240p", Codec: "h264"}}, WorkerPoolLight, []string{"libx264"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := tt.job
+			job.PrepareRouting(video)
+			if job.Pool != tt.wantPool {
+				t.Errorf("Pool = %s, want %s", job.Pool, tt.wantPool)
+			}
+			if len(job.Requirements.Encoders) != len(tt.wantEncoders) {
+				t.Errorf("Encoders = %v, want %v", job.Requirements.Encoders, tt.wantEncoders)
+			}
+		})
+	}
+}
+
+func TestWorkerCapabilitiesSatisfies(t *testing.T) {
+	caps := &WorkerCapabilities{CPUs: 8, MemoryMB: 16384, Encoders: []string{"libx264", "libx265"}}
+
+	tests := []struct {
+		name string
+		req  JobRequirements
+		want bool
+	}{
+		{"none", JobRequirements{}, true},
+		{"encoders", JobRequirements{Encoders: []string{"libx265"}}, true},
+		{"missing encoder", JobRequirements{Encoders: []string{"libaom-av1"}}, false},
+		{"gpu", JobRequirements{GPU: true}, false},
+		{"cpus", JobRequirements{MinCPUs: 16}, false},
+		{"memory", JobRequirements{MinMemoryMB: 8192}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := caps.Satisfies(tt.req); got != tt.want {
+				t.Errorf("Satisfies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranscodeConfigMerge(t *testing.T) {
+	base := TranscodeConfig{
+		OutputFormat: "mp4",
+		Resolution:   "1080p",
+		Codec:        "libx264",
+		Preset:       "medium",
+		Extra:        map[string]string{"crf": "23"},
+	}
+
+	merged := base.Merge(TranscodeConfig{Preset: "veryfast", Extra: map[string]string{"tune": "film"}})
+
+	if merged.Preset != "veryfast" {
+		t.Errorf("Preset = %q, want veryfast", merged.Preset)
+	}
+	if merged.Codec != "libx264" || merged.Resolution != "1080p" {
+		t.Errorf("unset override fields changed: codec %q, resolution %q", merged.Codec, merged.Resolution)
+	}
+	if merged.Extra["crf"] != "23" || merged.Extra["tune"] != "film" {
+		t.Errorf("Extra = %v, want crf and tune", merged.Extra)
+	}
+	if _, ok := base.Extra["tune"]; ok {
+		t.Error("Merge modified the base config")
+	}
+}
+
+func TestOutputRenditionKey(t *testing.T) {
+	output := &Output{Format: "mp4", Resolution: "720p"}
+	if got := output.RenditionKey(); got != "720p/mp4" {
+		t.Errorf("RenditionKey() = %q, want 720p/mp4", got)
+	}
+
+	output.Rendition = "clip-2"
+	if got := output.RenditionKey(); got != "clip-2" {
+		t.Errorf("RenditionKey() = %q, want clip-2", got)
+	}
+}
+
+func TestJobIsTranscode(t *testing.T) {
+	for jobType, want := range map[string]bool{
+		"":                    true,
+		JobTypeTranscode:      true,
+		JobTypeSceneDetection: false,
+		JobTypeWatermark:      false,
+		JobTypeConcatenation:  false,
+	} {
+		job := &Job{Type: jobType}
+		if got := job.IsTranscode(); got != want {
+			t.Errorf("IsTranscode() for type %q = %v, want %v", jobType, got, want)
+		}
+	}
+}
+
+func TestSceneDetectionParamsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  SceneDetectionParams
+		wantErr bool
+	}{
+		{"defaults", SceneDetectionParams{}, false},
+		{"valid", SceneDetectionParams{Threshold: 0.4, MinSceneDuration: 2, MaxScenes: 20}, false},
+		{"threshold above 1", SceneDetectionParams{Threshold: 1.5}, true},
+		{"negative max scenes", SceneDetectionParams{MaxScenes: -1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.params.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWatermarkParamsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  WatermarkParams
+		wantErr bool
+	}{
+		{"text", WatermarkParams{Text: "Sample", Position: "top-left", FontColor: "#FFFFFF"}, false},
+		{"image", WatermarkParams{ImageURL: "https://example.com/logo.png", Opacity: 0.5, Scale: 0.2}, false},
+		{"neither", WatermarkParams{}, true},
+		{"both", WatermarkParams{Text: "Sample", ImageURL: "https://example.com/logo.png"}, true},
+		{"unknown position", WatermarkParams{Text: "Sample", Position: "middle"}, true},
+		{"opacity above 1", WatermarkParams{Text: "Sample", Opacity: 2}, true},
+		{"filter characters in text", WatermarkParams{Text: "a':drawtext=text=b"}, true},
+		{"filter characters in color", WatermarkParams{Text: "Sample", FontColor: "white:x=0"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.params.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConcatenationParamsValidate(t *testing.T) {
+	tooMany := make([]string, MaxConcatenationVideos+1)
+
+	tests := []struct {
+		name    string
+		params  ConcatenationParams
+		wantErr bool
+	}{
+		{"valid", ConcatenationParams{VideoIDs: []string{"a", "b"}, Method: "filter", TransitionType: "fade", TransitionDuration: 1}, false},
+		{"one video", ConcatenationParams{VideoIDs: []string{"a"}}, true},
+		{"too many videos", ConcatenationParams{VideoIDs: tooMany}, true},
+		{"unknown method", ConcatenationParams{VideoIDs: []string{"a", "b"}, Method: "xfade"}, true},
+		{"unknown transition", ConcatenationParams{VideoIDs: []string{"a", "b"}, TransitionType: "wipe"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.params.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
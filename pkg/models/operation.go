@@ -0,0 +1,137 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Job type constants. Jobs other than transcodes run one ffmpeg operation on
+// a worker, with its parameters in the job's config.
+const (
+	JobTypeTranscode      = "transcode"
+	JobTypeSceneDetection = "scene_detection"
+	JobTypeWatermark      = "watermark"
+	JobTypeConcatenation  = "concatenation"
+	JobTypeLiveClip       = "live_clip"
+)
+
+// IsTranscode reports whether the job transcodes its video. Jobs created
+// before job types existed have no type.
+func (j *Job) IsTranscode() bool {
+	return j.Type == "" || j.Type == JobTypeTranscode
+}
+
+// SceneDetectionParams configure a scene detection job
+type SceneDetectionParams struct {
+	Threshold        float64 `json:"threshold"`          // scene change threshold, 0 to 1
+	MinSceneDuration float64 `json:"min_scene_duration"` // seconds
+	MaxScenes        int     `json:"max_scenes"`
+}
+
+// Validate checks the scene detection parameters
+func (p *SceneDetectionParams) Validate() error {
+	if p.Threshold < 0 || p.Threshold > 1 {
+		return fmt.Errorf("threshold must be between 0 and 1")
+	}
+	if p.MinSceneDuration < 0 || p.MaxScenes < 0 {
+		return fmt.Errorf("min_scene_duration and max_scenes must not be negative")
+	}
+	return nil
+}
+
+// fontColorPattern matches ffmpeg color names and hex colors
+var fontColorPattern = regexp.MustCompile(`^(#?[A-Za-z0-9]+)?$`)
+
+// WatermarkParams configure a watermark job
+type WatermarkParams struct {
+	Text      string  `json:"watermark_text,omitempty"`
+	ImageURL  string  `json:"watermark_image,omitempty"` // HTTP(S) URL of the image, fetched by the worker
+	Position  string  `json:"position,omitempty"`        // top-left, top-right, bottom-left, bottom-right or center
+	Opacity   float64 `json:"opacity,omitempty"`
+	Scale     float64 `json:"scale,omitempty"`
+	FontSize  int     `json:"font_size,omitempty"`
+	FontColor string  `json:"font_color,omitempty"`
+	Padding   int     `json:"padding,omitempty"`
+}
+
+// Validate checks the watermark parameters
+func (p *WatermarkParams) Validate() error {
+	if (p.Text == "") == (p.ImageURL == "") {
+		return fmt.Errorf("exactly one of watermark_text and watermark_image is required")
+	}
+	switch p.Position {
+	case "", "top-left", "top-right", "bottom-left", "bottom-right", "center":
+	default:
+		return fmt.Errorf("unsupported watermark position %q", p.Position)
+	}
+	if p.Opacity < 0 || p.Opacity > 1 || p.Scale < 0 || p.Scale > 1 {
+		return fmt.Errorf("opacity and scale must be between 0 and 1")
+	}
+	if p.FontSize < 0 || p.Padding < 0 {
+		return fmt.Errorf("font_size and padding must not be negative")
+	}
+	// Text and colors end up in an ffmpeg filter graph
+	if strings.ContainsAny(p.Text, `'\%:;,[]`) {
+		return fmt.Errorf("watermark_text must not contain any of ' \\ %% : ; , [ ]")
+	}
+	if !fontColorPattern.MatchString(p.FontColor) {
+		return fmt.Errorf("font_color must be a color name or #RRGGBB")
+	}
+	return nil
+}
+
+// ConcatenationParams configure a concatenation job. The job belongs to the
+// first video, which keeps the output.
+type ConcatenationParams struct {
+	VideoIDs           []string `json:"video_ids"`
+	Method             string   `json:"method,omitempty"`          // concat or filter
+	TransitionType     string   `json:"transition_type,omitempty"` // none, fade or dissolve
+	TransitionDuration float64  `json:"transition_duration,omitempty"`
+	ReEncode           bool     `json:"re_encode,omitempty"`
+}
+
+// MaxConcatenationVideos caps the videos joined by one job
+const MaxConcatenationVideos = 50
+
+// Validate checks the concatenation parameters
+func (p *ConcatenationParams) Validate() error {
+	if len(p.VideoIDs) < 2 || len(p.VideoIDs) > MaxConcatenationVideos {
+		return fmt.Errorf("between 2 and %d videos are required", MaxConcatenationVideos)
+	}
+	switch p.Method {
+	case "", "concat", "filter":
+	default:
+		return fmt.Errorf("unsupported concatenation method %q", p.Method)
+	}
+	switch p.TransitionType {
+	case "", "none", "fade", "dissolve":
+	default:
+		return fmt.Errorf("unsupported transition type %q", p.TransitionType)
+	}
+	if p.TransitionDuration < 0 {
+		return fmt.Errorf("transition_duration must not be negative")
+	}
+	return nil
+}
+
+// LiveClipParams configure a live clip job. The segments covering the clip
+// are copied out of the live window when the clip is requested, since the
+// window slides on while the job waits.
+type LiveClipParams struct {
+	LiveStreamID string            `json:"live_stream_id"`
+	StartTime    time.Time         `json:"start_time,omitempty"` // wall-clock time of the clip start, zero when unknown
+	Variants     []LiveClipVariant `json:"variants"`
+}
+
+// LiveClipVariant is the part of a live variant covering a clip
+type LiveClipVariant struct {
+	Resolution string   `json:"resolution"`
+	Bitrate    int64    `json:"bitrate"`
+	Playlist   string   `json:"playlist"` // VOD playlist referencing the segments by file name
+	Segments   []string `json:"segments"` // storage keys of the segments and init sections
+	ReEncode   bool     `json:"re_encode,omitempty"`
+	Offset     float64  `json:"offset,omitempty"`   // cut start into the first segment when re-encoding
+	Duration   float64  `json:"duration,omitempty"` // cut duration when re-encoding
+}
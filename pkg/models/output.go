@@ -6,18 +6,36 @@ import (
 
 // Output represents a transcoded output file
 type Output struct {
-	ID         string    `json:"id" db:"id"`
-	JobID      string    `json:"job_id" db:"job_id"`
-	VideoID    string    `json:"video_id" db:"video_id"`
-	Format     string    `json:"format" db:"format"`
-	Resolution string    `json:"resolution" db:"resolution"`
-	Width      int       `json:"width" db:"width"`
-	Height     int       `json:"height" db:"height"`
-	Codec      string    `json:"codec" db:"codec"`
-	Bitrate    int64     `json:"bitrate" db:"bitrate"`
-	Size       int64     `json:"size" db:"size"`
-	Duration   float64   `json:"duration" db:"duration"`
-	URL        string    `json:"url" db:"url"`
-	Path       string    `json:"path" db:"path"`
-	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	ID          string    `json:"id" db:"id"`
+	JobID       string    `json:"job_id" db:"job_id"`
+	VideoID     string    `json:"video_id" db:"video_id"`
+	Format      string    `json:"format" db:"format"`
+	Resolution  string    `json:"resolution" db:"resolution"`
+	Width       int       `json:"width" db:"width"`
+	Height      int       `json:"height" db:"height"`
+	Codec       string    `json:"codec" db:"codec"`
+	Bitrate     int64     `json:"bitrate" db:"bitrate"`
+	Size        int64     `json:"size" db:"size"`
+	Duration    float64   `json:"duration" db:"duration"`
+	URL         string    `json:"url" db:"url"`
+	Path        string    `json:"path" db:"path"`
+	Rendition   string    `json:"rendition" db:"rendition"`       // unique within the job
+	StorageTier string    `json:"storage_tier" db:"storage_tier"` // hot, or cold once moved by a lifecycle policy
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// StorageTier constants
+const (
+	StorageTierHot  = "hot"
+	StorageTierCold = "cold"
+)
+
+// RenditionKey returns the key identifying the output within its job,
+// defaulting to its resolution and format. Recording an output again for the
+// same job and rendition replaces the earlier record.
+func (o *Output) RenditionKey() string {
+	if o.Rendition != "" {
+		return o.Rendition
+	}
+	return o.Resolution + "/" + o.Format
 }
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// RecurringJob is a job template run on a cron schedule. Each run creates a
+// regular job from the template.
+type RecurringJob struct {
+	ID           string          `json:"id" db:"id"`
+	UserID       *string         `json:"user_id,omitempty" db:"user_id"`
+	VideoID      string          `json:"video_id" db:"video_id"`
+	Name         string          `json:"name" db:"name"`
+	Schedule     string          `json:"schedule" db:"schedule"` // cron expression, e.g. "0 3 * * *"
+	Timezone     string          `json:"timezone" db:"timezone"` // IANA zone the schedule is evaluated in
+	Priority     int             `json:"priority" db:"priority"`
+	Config       TranscodeConfig `json:"config" db:"config"`
+	Requirements JobRequirements `json:"requirements" db:"requirements"`
+	Enabled      bool            `json:"enabled" db:"enabled"`
+	NextRunAt    time.Time       `json:"next_run_at" db:"next_run_at"`
+	LastRunAt    *time.Time      `json:"last_run_at,omitempty" db:"last_run_at"`
+	LastJobID    *string         `json:"last_job_id,omitempty" db:"last_job_id"`
+	CreatedAt    time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at" db:"updated_at"`
+}
+
+// NewJob creates a pending job from the template
+func (r *RecurringJob) NewJob() *Job {
+	return &Job{
+		VideoID:      r.VideoID,
+		UserID:       r.UserID,
+		Status:       JobStatusPending,
+		Priority:     r.Priority,
+		Config:       r.Config,
+		Requirements: r.Requirements,
+	}
+}
@@ -0,0 +1,189 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"strings"
+)
+
+// Worker pools jobs are routed to
+const (
+	WorkerPoolGPU   = "gpu"   // needs a GPU encoder
+	WorkerPoolCPU   = "cpu"   // CPU-heavy software encodes
+	WorkerPoolLight = "light" // short or low resolution encodes
+)
+
+// LightJobMaxCost is the cost, in 1080p H.264 minutes, below which jobs go
+// to the light pool; see EstimateJobCost
+const LightJobMaxCost = 1.0
+
+// JobRequirements are the worker capabilities a job needs
+type JobRequirements struct {
+	GPU         bool     `json:"gpu,omitempty"`
+	Encoders    []string `json:"encoders,omitempty"` // ffmpeg encoders the worker must have
+	MinCPUs     int      `json:"min_cpus,omitempty"`
+	MinMemoryMB int      `json:"min_memory_mb,omitempty"`
+}
+
+// Value implements driver.Valuer for database storage
+func (r JobRequirements) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+// Scan implements sql.Scanner for database retrieval
+func (r *JobRequirements) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+
+	return json.Unmarshal(bytes, r)
+}
+
+// WorkerCapabilities describes what a worker can run
+type WorkerCapabilities struct {
+	GPU           bool     `json:"gpu"`
+	GPUCount      int      `json:"gpu_count"`
+	Encoders      []string `json:"encoders"`
+	CPUs          int      `json:"cpus"`
+	MemoryMB      int      `json:"memory_mb"`
+	MaxConcurrent int      `json:"max_concurrent"`
+	Pools         []string `json:"pools"`
+}
+
+// Satisfies reports whether the worker meets the job's requirements
+func (c *WorkerCapabilities) Satisfies(req JobRequirements) bool {
+	if req.GPU && !c.GPU {
+		return false
+	}
+	if req.MinCPUs > 0 && c.CPUs < req.MinCPUs {
+		return false
+	}
+	if req.MinMemoryMB > 0 && c.MemoryMB > 0 && c.MemoryMB < req.MinMemoryMB {
+		return false
+	}
+	for _, encoder := range req.Encoders {
+		if !c.HasEncoder(encoder) {
+			return false
+		}
+	}
+	return true
+}
+
+// HasEncoder reports whether the worker's ffmpeg build has an encoder
+func (c *WorkerCapabilities) HasEncoder(encoder string) bool {
+	for _, e := range c.Encoders {
+		if e == encoder {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultPools returns the pools a worker serves when none are configured:
+// GPU workers take GPU and CPU-heavy jobs, others take CPU and light jobs
+func (c *WorkerCapabilities) DefaultPools() []string {
+	if c.GPU {
+		return []string{WorkerPoolGPU, WorkerPoolCPU}
+	}
+	return []string{WorkerPoolCPU, WorkerPoolLight}
+}
+
+// codecCostFactors is the relative encode cost of each codec against H.264
+var codecCostFactors = map[string]float64{
+	"h264": 1.0,
+	"hevc": 2.5,
+	"vp9":  3.0,
+	"av1":  6.0,
+	"copy": 0.1,
+}
+
+// SoftwareEncoder returns the ffmpeg software encoder for a codec name
+func SoftwareEncoder(codec string) string {
+	switch normalizeCodec(codec) {
+	case "h264":
+		return "libx264"
+	case "hevc":
+		return "libx265"
+	case "vp9":
+		return "libvpx-vp9"
+	case "av1":
+		return "libaom-av1"
+	default:
+		return ""
+	}
+}
+
+// normalizeCodec maps codec aliases and encoder names onto a codec
+func normalizeCodec(codec string) string {
+	switch strings.ToLower(codec) {
+	case "", "h264", "avc", "libx264", "h264_nvenc":
+		return "h264"
+	case "h265", "hevc", "libx265", "hevc_nvenc":
+		return "hevc"
+	case "vp9", "libvpx-vp9":
+		return "vp9"
+	case "av1", "libaom-av1", "libsvtav1":
+		return "av1"
+	default:
+		return strings.ToLower(codec)
+	}
+}
+
+// EstimateJobCost estimates the encode cost of a job in 1080p H.264 minutes:
+// source duration scaled by output pixel count and codec complexity
+func EstimateJobCost(durationSeconds float64, height int, codec string) float64 {
+	if durationSeconds <= 0 {
+		return 0
+	}
+	if height <= 0 {
+		height = 1080
+	}
+
+	factor, ok := codecCostFactors[normalizeCodec(codec)]
+	if !ok {
+		factor = 1.0
+	}
+
+	scale := float64(height) / 1080
+	return durationSeconds / 60 * scale * scale * factor
+}
+
+// PrepareRouting estimates the job's cost, fills in requirements the caller
+// did not declare and picks the worker pool for the job
+func (j *Job) PrepareRouting(video *Video) {
+	height := 0
+	if profile := GetResolutionProfile(j.Config.Resolution); profile != nil {
+		height = profile.Height
+	} else if video != nil {
+		height = video.Height
+	}
+
+	duration := 0.0
+	if video != nil {
+		duration = video.Duration
+	}
+	j.EstimatedCost = EstimateJobCost(duration, height, j.Config.Codec)
+
+	if encoder := SoftwareEncoder(j.Config.Codec); encoder != "" && !j.Requirements.GPU && len(j.Requirements.Encoders) == 0 {
+		j.Requirements.Encoders = []string{encoder}
+	}
+
+	j.Pool = RouteJob(j)
+}
+
+// RouteJob picks the worker pool for a job from its requirements and cost
+func RouteJob(j *Job) string {
+	switch {
+	case j.Requirements.GPU:
+		return WorkerPoolGPU
+	case j.EstimatedCost > 0 && j.EstimatedCost < LightJobMaxCost && j.Requirements.MinCPUs == 0 && j.Requirements.MinMemoryMB == 0:
+		return WorkerPoolLight
+	default:
+		return WorkerPoolCPU
+	}
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// TusUpload is a resumable upload over the tus protocol. Its data is stored
+// as one chunk object per PATCH request until the upload is complete.
+type TusUpload struct {
+	ID         string            `json:"id" db:"id"`
+	UserID     *string           `json:"user_id,omitempty" db:"user_id"`
+	Length     int64             `json:"length" db:"upload_length"`
+	Offset     int64             `json:"offset" db:"upload_offset"`
+	Metadata   map[string]string `json:"metadata" db:"metadata"` // decoded Upload-Metadata
+	Chunks     []TusChunk        `json:"chunks" db:"chunks"`
+	Status     string            `json:"status" db:"status"`
+	VideoID    string            `json:"video_id" db:"video_id"`
+	StorageKey string            `json:"storage_key" db:"storage_key"` // where the assembled upload goes
+	Checksum   string            `json:"checksum,omitempty" db:"-"`    // hex SHA-256, set once assembled
+	CreatedAt  time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at" db:"updated_at"`
+	ExpiresAt  time.Time         `json:"expires_at" db:"expires_at"`
+}
+
+// TusChunk is the data received by one PATCH request
+type TusChunk struct {
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Key    string `json:"key"`
+}
+
+// TusUpload status constants
+const (
+	TusUploadStatusActive    = "active"
+	TusUploadStatusCompleted = "completed"
+)
+
+// Received reports whether all of the upload's data has arrived
+func (u *TusUpload) Received() bool {
+	return u.Offset == u.Length
+}
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// MultipartUpload is a multipart upload session. Sessions are stored in the
+// database so any API replica can serve any of their requests.
+type MultipartUpload struct {
+	ID              string              `json:"id" db:"id"`
+	Mode            string              `json:"mode" db:"mode"`
+	Filename        string              `json:"filename" db:"filename"`
+	TotalSize       int64               `json:"total_size" db:"total_size"`
+	PartSize        int64               `json:"part_size" db:"part_size"`
+	TotalParts      int                 `json:"total_parts" db:"total_parts"`
+	Parts           map[int]*UploadPart `json:"parts"`
+	Status          string              `json:"status" db:"status"`
+	VideoID         string              `json:"video_id" db:"video_id"`       // video the upload becomes
+	StorageKey      string              `json:"storage_key" db:"storage_key"` // where the assembled upload goes
+	StorageUploadID string              `json:"-" db:"storage_upload_id"`     // multipart upload held by storage, direct uploads only
+	Checksum        string              `json:"checksum,omitempty" db:"checksum"`
+	CreatedAt       time.Time           `json:"created_at" db:"created_at"`
+	ExpiresAt       time.Time           `json:"expires_at" db:"expires_at"`
+	CompletedAt     *time.Time          `json:"completed_at,omitempty" db:"completed_at"`
+}
+
+// UploadPart is a received part of a multipart upload
+type UploadPart struct {
+	PartNumber int       `json:"part_number" db:"part_number"`
+	Size       int64     `json:"size" db:"size"`
+	ETag       string    `json:"etag" db:"etag"`               // hex MD5
+	SHA256     string    `json:"sha256,omitempty" db:"sha256"` // hex SHA-256
+	Key        string    `json:"-" db:"storage_key"`           // part object, proxy uploads only
+	Uploaded   bool      `json:"uploaded"`
+	UploadedAt time.Time `json:"uploaded_at,omitempty" db:"uploaded_at"`
+}
+
+// MultipartUpload status constants
+const (
+	MultipartUploadStatusActive    = "active"
+	MultipartUploadStatusCompleted = "completed"
+	MultipartUploadStatusAborted   = "aborted"
+)
+
+// ExpectedPartSize returns the size part partNumber must have: the part size,
+// or the remainder for the last part
+func (u *MultipartUpload) ExpectedPartSize(partNumber int) int64 {
+	if partNumber == u.TotalParts {
+		return u.TotalSize - int64(u.TotalParts-1)*u.PartSize
+	}
+	return u.PartSize
+}
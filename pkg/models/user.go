@@ -14,6 +14,13 @@ type User struct {
 	UsedQuota    int       `json:"used_quota" db:"used_quota"`
 	QuotaResetAt time.Time `json:"quota_reset_at" db:"quota_reset_at"`
 	IsActive     bool      `json:"is_active" db:"is_active"`
+
+	// Scheduling limits; MaxConcurrentJobs 0 uses the scheduler default
+	MaxConcurrentJobs int `json:"max_concurrent_jobs" db:"max_concurrent_jobs"`
+	SchedulingWeight  int `json:"scheduling_weight" db:"scheduling_weight"`
+
+	Role UserRole `json:"role" db:"role"`
+
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -9,6 +9,7 @@ import (
 // Video represents a video file in the system
 type Video struct {
 	ID          string    `json:"id" db:"id"`
+	UserID      *string   `json:"user_id,omitempty" db:"user_id"`
 	Filename    string    `json:"filename" db:"filename"`
 	OriginalURL string    `json:"original_url" db:"original_url"`
 	Size        int64     `json:"size" db:"size"`
@@ -19,6 +20,8 @@ type Video struct {
 	Bitrate     int64     `json:"bitrate" db:"bitrate"`
 	FrameRate   float64   `json:"frame_rate" db:"frame_rate"`
 	Metadata    Metadata  `json:"metadata" db:"metadata"`
+	Checksum    string    `json:"checksum,omitempty" db:"checksum"`         // hex SHA-256 of the original, when known
+	DuplicateOf *string   `json:"duplicate_of,omitempty" db:"duplicate_of"` // the tenant's earliest video with the same checksum
 	Status      string    `json:"status" db:"status"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
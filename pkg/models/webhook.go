@@ -20,11 +20,12 @@ type Webhook struct {
 
 // WebhookEvents holds the events a webhook subscribes to
 type WebhookEvents struct {
-	JobStarted    bool `json:"job_started"`
-	JobCompleted  bool `json:"job_completed"`
-	JobFailed     bool `json:"job_failed"`
-	JobProgress   bool `json:"job_progress"`
-	VideoUploaded bool `json:"video_uploaded"`
+	JobStarted     bool `json:"job_started"`
+	JobCompleted   bool `json:"job_completed"`
+	JobFailed      bool `json:"job_failed"`
+	JobProgress    bool `json:"job_progress"`
+	VideoUploaded  bool `json:"video_uploaded"`
+	BatchCompleted bool `json:"batch_completed"`
 }
 
 // Value implements driver.Valuer for database storage
@@ -59,6 +60,9 @@ type WebhookDelivery struct {
 	NextRetryAt   *time.Time `json:"next_retry_at,omitempty" db:"next_retry_at"`
 	CreatedAt     time.Time `json:"created_at" db:"created_at"`
 	CompletedAt   *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+
+	// IdempotencyKey dedupes deliveries of the same event to a webhook
+	IdempotencyKey string `json:"idempotency_key,omitempty" db:"idempotency_key"`
 }
 
 // WebhookDeliveryStatus constants
@@ -77,9 +81,11 @@ type WebhookEvent struct {
 
 // Webhook event types
 const (
-	WebhookEventJobStarted    = "job.started"
-	WebhookEventJobCompleted  = "job.completed"
-	WebhookEventJobFailed     = "job.failed"
-	WebhookEventJobProgress   = "job.progress"
-	WebhookEventVideoUploaded = "video.uploaded"
+	WebhookEventJobStarted     = "job.started"
+	WebhookEventJobCompleted   = "job.completed"
+	WebhookEventJobFailed      = "job.failed"
+	WebhookEventJobProgress    = "job.progress"
+	WebhookEventVideoUploaded  = "video.uploaded"
+	WebhookEventClipReady      = "clip.ready"
+	WebhookEventBatchCompleted = "batch.completed"
 )
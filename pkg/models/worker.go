@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Worker status constants
+const (
+	WorkerStatusActive   = "active"   // taking new jobs
+	WorkerStatusDraining = "draining" // finishing in-flight jobs, taking no new ones
+)
+
+// Worker is a transcode worker registered through its heartbeats
+type Worker struct {
+	ID          string    `json:"id" db:"id"`
+	Hostname    string    `json:"hostname" db:"hostname"`
+	Version     string    `json:"version" db:"version"`
+	Status      string    `json:"status" db:"status"`
+	Pools       []string  `json:"pools" db:"pools"`
+	Slots       int       `json:"slots" db:"slots"`
+	CurrentJobs []string  `json:"current_jobs" db:"current_jobs"`
+	CPUs        int       `json:"cpus" db:"cpus"`
+	MemoryMB    int       `json:"memory_mb" db:"memory_mb"`
+	CPULoad     float64   `json:"cpu_load" db:"cpu_load"` // load average per core
+	StartedAt   time.Time `json:"started_at" db:"started_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at" db:"heartbeat_at"`
+}
+
+// Alive reports whether the worker sent a heartbeat within ttl
+func (w *Worker) Alive(ttl time.Duration) bool {
+	return time.Since(w.HeartbeatAt) <= ttl
+}